@@ -3,3 +3,57 @@ package labeler
 const (
 	GroupName = "labeler.cfmr.site"
 )
+
+// Names of the annotations used by the operator, they are under the managed prefix.
+const (
+	// AppliedAtAnnotationName on a node has the time the operator last mutated it,
+	// with --stamp-applied.
+	AppliedAtAnnotationName = "applied-at"
+	// AppliedByAnnotationName on a node has the version and instance of the operator
+	// that last mutated it, with --stamp-applied.
+	AppliedByAnnotationName = "applied-by"
+	// AllowBlastRadiusAnnotationName on a labeler has the generation allowed to newly
+	// select more nodes than the max blast radius.
+	AllowBlastRadiusAnnotationName = "allow-blast-radius"
+	// AllowDeleteAnnotationName on a labeler allows deleting it even if it's applied
+	// to more nodes than the delete protection threshold.
+	AllowDeleteAnnotationName = "allow-delete"
+	// ApplyAnnotationName on a labeler set to "true" approves applying its generation,
+	// with --require-apply-trigger. It's cleared once approved.
+	ApplyAnnotationName = "apply"
+	// ApprovedGenerationAnnotationName on a labeler has its last generation approved
+	// by the apply trigger.
+	ApprovedGenerationAnnotationName = "approved-generation"
+	// CanaryAnnotationName on a node makes it a canary of the labelers it lists (comma separated).
+	CanaryAnnotationName = "canary"
+	// ContentHashAnnotationName on a node has the hash of its content when all the
+	// labelers were applied.
+	ContentHashAnnotationName = "content-hash"
+	// DrainingAnnotationName on a node marks it as being drained, the operator defers
+	// its sync while it's unschedulable with --skip-draining-nodes.
+	DrainingAnnotationName = "draining"
+	// ExemptAnnotationName on a node exempts it from the labelers it lists (comma
+	// separated), "*" from all of them.
+	ExemptAnnotationName = "exempt"
+	// FreezeUntilAnnotationName on the freeze ConfigMap pauses the node mutations
+	// until its RFC3339 time.
+	FreezeUntilAnnotationName = "freeze-until"
+	// MergeConversionAnnotationName on a labeler served at v1beta1 has the fields of
+	// its v1alpha1 merge that v1beta1 doesn't have, restored on the conversion back.
+	MergeConversionAnnotationName = "v1alpha1-merge"
+	// OwnedKeysAnnotationName on a node has the attributes set by every labeler.
+	OwnedKeysAnnotationName = "owned-keys"
+)
+
+// Annotations used by the operator with the default managed prefix.
+const (
+	AllowDeleteAnnotation     = GroupName + "/" + AllowDeleteAnnotationName
+	CanaryAnnotation          = GroupName + "/" + CanaryAnnotationName
+	MergeConversionAnnotation = GroupName + "/" + MergeConversionAnnotationName
+	OwnedKeysAnnotation       = GroupName + "/" + OwnedKeysAnnotationName
+)
+
+// Annotation returns the key of the annotation name under the prefix.
+func Annotation(prefix, name string) string {
+	return prefix + "/" + name
+}
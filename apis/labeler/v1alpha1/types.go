@@ -32,11 +32,304 @@ type LabelerSpec struct {
 	//Size int `json:"Size,omitempty"`
 	// TerminationPercent is the percent of pods that will be killed randomly.
 	Merge MergeSpec `json:"merge,omitempty"`
-	// DryRun will set the killing in dryrun mode or not.
+	// When are the node label requirements that need to be met to apply the labeler,
+	// once not met the applied attributes are removed (unless retained).
+	// +optional
+	When []v1.NodeSelectorRequirement `json:"when,omitempty"`
+	// VersionSelector are the node version ranges that need to be met to apply the
+	// labeler, like the when requirements.
+	// +optional
+	VersionSelector *VersionSelector `json:"versionSelector,omitempty"`
+	// ConditionSelector are the node conditions that need to be met to apply the
+	// labeler, like the when requirements.
+	// +optional
+	ConditionSelector []ConditionRequirement `json:"conditionSelector,omitempty"`
+	// NodeGroupSelector are the node groups (from the provider node group labels) the
+	// node needs to be in to apply the labeler, like the when requirements.
+	// +optional
+	NodeGroupSelector []string `json:"nodeGroupSelector,omitempty"`
+	// ReportNearMatches logs the nodes matching all but one clause of a node selector
+	// term with the failing clause, it doesn't change the selected nodes.
+	// +optional
+	ReportNearMatches bool `json:"reportNearMatches,omitempty"`
+	// Retain keeps the applied attributes on the nodes when the labeler doesn't
+	// apply anymore.
+	// +optional
+	Retain bool `json:"retain,omitempty"`
+	// ProtectedKeys are the label, annotation and taint keys the labeler sets but
+	// never removes, "prefix/*" entries protect a whole prefix.
+	// +optional
+	ProtectedKeys []string `json:"protectedKeys,omitempty"`
+	// DryRun plans and reports the changes of the labeler without applying them.
 	// +optional
 	DryRun bool `json:"dryRun,omitempty"`
+	// MaxBlastRadius is the maximum number of nodes a new generation of the labeler can
+	// newly select before being approved, it overrides the operator one and 0 disables
+	// it.
+	// +optional
+	MaxBlastRadius *int32 `json:"maxBlastRadius,omitempty"`
+	// PriorityClass is the priority of the syncs of the nodes the labeler selects or
+	// is applied to on the node queue: high, normal (default) or low.
+	// +optional
+	PriorityClass string `json:"priorityClass,omitempty"`
+	// RolloutPercentage is the percent of the matching nodes that will be labeled.
+	// If not set all the matching nodes will be labeled.
+	// +optional
+	RolloutPercentage *int32 `json:"rolloutPercentage,omitempty"`
+	// RolloutOrder is the order used to select the nodes of the rollout.
+	// +optional
+	RolloutOrder RolloutOrder `json:"rolloutOrder,omitempty"`
+	// RolloutStrategy is how the nodes of the rollout are picked from the matching ones.
+	// +optional
+	RolloutStrategy RolloutStrategy `json:"rolloutStrategy,omitempty"`
+	// RolloutZoneLabel is the node label with the zone of the BalancedByZone strategy,
+	// the well-known zone labels if not set.
+	// +optional
+	RolloutZoneLabel string `json:"rolloutZoneLabel,omitempty"`
+	// CanarySoak is how long the canary nodes need to be ready with the labeler
+	// applied before the rest of the rollout proceeds.
+	// +optional
+	CanarySoak *metav1.Duration `json:"canarySoak,omitempty"`
+	// ValueMap sets labels with values mapped from the values of other labels.
+	// +optional
+	ValueMap []ValueMapSpec `json:"valueMap,omitempty"`
+	// ValueFrom sets labels with values resolved from the nodes.
+	// +optional
+	ValueFrom []ValueFromSpec `json:"valueFrom,omitempty"`
+	// Rename renames label keys of the selected nodes keeping their values.
+	// +optional
+	Rename []RenameSpec `json:"rename,omitempty"`
+	// RemoveLabels removes label keys from the selected nodes. The entries between
+	// slashes (e.g. /^example\.com\/legacy-.*/) are regular expressions matching the
+	// whole key, the others exact keys.
+	// +optional
+	RemoveLabels []string `json:"removeLabels,omitempty"`
+	// RequeueAfter is the period the selected nodes will be checked again regardless
+	// of the node events and the resync period.
+	// +optional
+	RequeueAfter *metav1.Duration `json:"requeueAfter,omitempty"`
+	// RequireToleratingDaemonSet is the DaemonSet whose pod template needs to tolerate
+	// the NoExecute taints of the labeler before they are applied, so its pods are not
+	// evicted.
+	// +optional
+	RequireToleratingDaemonSet *DaemonSetReference `json:"requireToleratingDaemonSet,omitempty"`
+	// TaintRemovalPolicy is when the taints set by the labeler and no longer in its
+	// merge taints are removed from the nodes: Immediate (default) or Deferred.
+	// +optional
+	TaintRemovalPolicy TaintRemovalPolicy `json:"taintRemovalPolicy,omitempty"`
+	// TaintRemovalDelay is how long the Deferred policy keeps the removed NoSchedule and
+	// NoExecute taints on the nodes after the spec edit.
+	// +optional
+	TaintRemovalDelay *metav1.Duration `json:"taintRemovalDelay,omitempty"`
+	// TaintEscalation applies the NoExecute merge taints as NoSchedule first, and as
+	// NoExecute once the nodes carried them for the soak.
+	// +optional
+	TaintEscalation *TaintEscalation `json:"taintEscalation,omitempty"`
+	// ClusterSizeCondition activates the labeler only while the cluster has a number
+	// of nodes in its bounds, otherwise the nodes don't meet the labeler requirements.
+	// +optional
+	ClusterSizeCondition *ClusterSizeCondition `json:"clusterSizeCondition,omitempty"`
+	// EffectiveFrom activates the labeler only from that time on, before it the nodes
+	// don't meet the labeler requirements.
+	// +optional
+	EffectiveFrom *metav1.Time `json:"effectiveFrom,omitempty"`
+	// EffectiveUntil deactivates the labeler from that time on, after it the nodes
+	// don't meet the labeler requirements.
+	// +optional
+	EffectiveUntil *metav1.Time `json:"effectiveUntil,omitempty"`
+	// MetricsLabels are the values of the operator --labeler-metrics-labels on the
+	// metrics of the labeler (e.g. team, env), for cost attribution.
+	// +optional
+	MetricsLabels map[string]string `json:"metricsLabels,omitempty"`
+	// TargetKind is the kind of the objects the labeler acts on, Node if not set.
+	// +optional
+	TargetKind TargetKind `json:"targetKind,omitempty"`
+	// FieldManager is the server-side apply field manager of the labels and
+	// annotations of the labeler with the apply patch type, the operator one if not
+	// set.
+	// +optional
+	FieldManager string `json:"fieldManager,omitempty"`
+}
+
+// TaintEscalation is the NoSchedule soak of the NoExecute taints.
+type TaintEscalation struct {
+	// Soak is how long a node carries a taint as NoSchedule, Ready, before it's
+	// escalated to NoExecute.
+	Soak metav1.Duration `json:"soak"`
+}
+
+// ClusterSizeCondition is met when the number of nodes is in its bounds.
+type ClusterSizeCondition struct {
+	// MinNodes is the minimum number of nodes.
+	// +optional
+	MinNodes *int32 `json:"minNodes,omitempty"`
+	// MaxNodes is the maximum number of nodes.
+	// +optional
+	MaxNodes *int32 `json:"maxNodes,omitempty"`
+}
+
+// DaemonSetReference references a DaemonSet.
+type DaemonSetReference struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// VersionSelector selects nodes by the versions of their node info. The constraints
+// are comma separated comparisons (e.g. ">=1.9.0, <1.11.0"), alternatives are
+// separated by "||".
+type VersionSelector struct {
+	// Kubelet is the constraint on the kubelet version.
+	// +optional
+	Kubelet string `json:"kubelet,omitempty"`
+	// Kernel is the constraint on the kernel version.
+	// +optional
+	Kernel string `json:"kernel,omitempty"`
+}
+
+// ConditionRequirement is met by the nodes with the condition type on the status.
+type ConditionRequirement struct {
+	// Type is the node condition type (e.g. MemoryPressure, DiskPressure, PIDPressure).
+	Type v1.NodeConditionType `json:"type"`
+	// Status is the condition status (True, False or Unknown).
+	Status v1.ConditionStatus `json:"status"`
+}
+
+// ValueMapSpec sets a label with the value mapped from the value of a source label.
+type ValueMapSpec struct {
+	// From is the source label key.
+	From string `json:"from"`
+	// To is the label key set with the mapped value.
+	To string `json:"to"`
+	// Values maps the source values to the label values.
+	Values map[string]string `json:"values"`
+	// Default is the label value for the unmapped source values, without it the
+	// label is not set for them.
+	// +optional
+	Default *string `json:"default,omitempty"`
+	// ValueTransform transforms the mapped values, not the default.
+	// +optional
+	ValueTransform *ValueTransform `json:"valueTransform,omitempty"`
+	// ValuePattern is the regular expression the label values need to match, the
+	// others are not set.
+	// +optional
+	ValuePattern string `json:"valuePattern,omitempty"`
+}
+
+// ValueFromSpec sets a label with the value resolved by a value source.
+type ValueFromSpec struct {
+	// Label is the label key set with the resolved value.
+	Label string `json:"label"`
+	// Type is the value source type (label, capacity, allocatable, nodeInfo, regex).
+	Type string `json:"type"`
+	// Params are the settings of the value source, they depend on the type.
+	// +optional
+	Params map[string]string `json:"params,omitempty"`
+	// Sources are the named value sources of the composite type, rendered by its
+	// template param.
+	// +optional
+	Sources []NamedValueSource `json:"sources,omitempty"`
+	// Default is the label value if the source doesn't resolve a value, without it
+	// the label is not set.
+	// +optional
+	Default *string `json:"default,omitempty"`
+	// ValueTransform transforms the resolved values, not the default.
+	// +optional
+	ValueTransform *ValueTransform `json:"valueTransform,omitempty"`
+	// ValuePattern is the regular expression the label values need to match, the
+	// others are not set.
+	// +optional
+	ValuePattern string `json:"valuePattern,omitempty"`
+}
+
+// NamedValueSource is a value source of a composite value, referenced by its name.
+type NamedValueSource struct {
+	// Name is the name of the value on the template.
+	Name string `json:"name"`
+	// Type is the value source type.
+	Type string `json:"type"`
+	// Params are the settings of the value source, they depend on the type.
+	// +optional
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// ValueTransform transforms a resolved label value. The transforms are applied in
+// order: trim, lowercase or uppercase, prefix and suffix, and sanitize.
+type ValueTransform struct {
+	// Trim removes the leading and trailing white space.
+	// +optional
+	Trim bool `json:"trim,omitempty"`
+	// Lowercase converts the value to lower case.
+	// +optional
+	Lowercase bool `json:"lowercase,omitempty"`
+	// Uppercase converts the value to upper case.
+	// +optional
+	Uppercase bool `json:"uppercase,omitempty"`
+	// Prefix is prepended to the value.
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+	// Suffix is appended to the value.
+	// +optional
+	Suffix string `json:"suffix,omitempty"`
+	// Sanitize converts the transformed value to a valid label value.
+	// +optional
+	Sanitize bool `json:"sanitize,omitempty"`
+}
+
+// RenameSpec renames a label key.
+type RenameSpec struct {
+	// From is the label key to rename.
+	From string `json:"from"`
+	// To is the new label key.
+	To string `json:"to"`
 }
 
+// RolloutOrder is the order used to select the nodes of a rollout.
+type RolloutOrder string
+
+// Rollout orders.
+const (
+	// RolloutOrderHash selects the nodes in a deterministic pseudo random order (default).
+	RolloutOrderHash RolloutOrder = "Hash"
+	// RolloutOrderNewest selects the most recently created nodes first.
+	RolloutOrderNewest RolloutOrder = "Newest"
+	// RolloutOrderOldest selects the oldest nodes first.
+	RolloutOrderOldest RolloutOrder = "Oldest"
+)
+
+// RolloutStrategy is how the nodes of a rollout are picked.
+type RolloutStrategy string
+
+// Rollout strategies.
+const (
+	// RolloutStrategyOrdered picks the first nodes by the rollout order (default).
+	RolloutStrategyOrdered RolloutStrategy = "Ordered"
+	// RolloutStrategyBalancedByZone picks the nodes evenly across the zones, in the
+	// rollout order within every zone.
+	RolloutStrategyBalancedByZone RolloutStrategy = "BalancedByZone"
+)
+
+// TargetKind is the kind of the objects a labeler acts on.
+type TargetKind string
+
+// Target kinds.
+const (
+	// TargetKindNode acts on the nodes, the only kind watched by the operator (default).
+	TargetKindNode TargetKind = "Node"
+)
+
+// TaintRemovalPolicy is when the taints removed from the merge taints of a labeler are
+// removed from the nodes.
+type TaintRemovalPolicy string
+
+// Taint removal policies.
+const (
+	// TaintRemovalPolicyImmediate removes them on the next sync of the nodes (default).
+	TaintRemovalPolicyImmediate TaintRemovalPolicy = "Immediate"
+	// TaintRemovalPolicyDeferred keeps the NoSchedule and NoExecute ones for the taint
+	// removal delay, the others are removed right away.
+	TaintRemovalPolicyDeferred TaintRemovalPolicy = "Deferred"
+)
+
 type MergeSpec struct {
 	metav1.ObjectMeta `json:",inline" protobuf:"bytes,1,opt,name=metadata"`
 
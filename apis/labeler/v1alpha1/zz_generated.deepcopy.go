@@ -5,9 +5,77 @@
 package v1alpha1
 
 import (
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterSizeCondition) DeepCopyInto(out *ClusterSizeCondition) {
+	*out = *in
+	if in.MinNodes != nil {
+		in, out := &in.MinNodes, &out.MinNodes
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(int32)
+			**out = **in
+		}
+	}
+	if in.MaxNodes != nil {
+		in, out := &in.MaxNodes, &out.MaxNodes
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(int32)
+			**out = **in
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterSizeCondition.
+func (in *ClusterSizeCondition) DeepCopy() *ClusterSizeCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterSizeCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConditionRequirement) DeepCopyInto(out *ConditionRequirement) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConditionRequirement.
+func (in *ConditionRequirement) DeepCopy() *ConditionRequirement {
+	if in == nil {
+		return nil
+	}
+	out := new(ConditionRequirement)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DaemonSetReference) DeepCopyInto(out *DaemonSetReference) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DaemonSetReference.
+func (in *DaemonSetReference) DeepCopy() *DaemonSetReference {
+	if in == nil {
+		return nil
+	}
+	out := new(DaemonSetReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Labeler) DeepCopyInto(out *Labeler) {
 	*out = *in
@@ -73,7 +141,160 @@ func (in *LabelerList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LabelerSpec) DeepCopyInto(out *LabelerSpec) {
 	*out = *in
+	in.NodeSelector.DeepCopyInto(&out.NodeSelector)
 	in.Merge.DeepCopyInto(&out.Merge)
+	if in.When != nil {
+		in, out := &in.When, &out.When
+		*out = make([]core_v1.NodeSelectorRequirement, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.VersionSelector != nil {
+		in, out := &in.VersionSelector, &out.VersionSelector
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(VersionSelector)
+			**out = **in
+		}
+	}
+	if in.ConditionSelector != nil {
+		in, out := &in.ConditionSelector, &out.ConditionSelector
+		*out = make([]ConditionRequirement, len(*in))
+		copy(*out, *in)
+	}
+	if in.NodeGroupSelector != nil {
+		in, out := &in.NodeGroupSelector, &out.NodeGroupSelector
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ProtectedKeys != nil {
+		in, out := &in.ProtectedKeys, &out.ProtectedKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaxBlastRadius != nil {
+		in, out := &in.MaxBlastRadius, &out.MaxBlastRadius
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(int32)
+			**out = **in
+		}
+	}
+	if in.RolloutPercentage != nil {
+		in, out := &in.RolloutPercentage, &out.RolloutPercentage
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(int32)
+			**out = **in
+		}
+	}
+	if in.CanarySoak != nil {
+		in, out := &in.CanarySoak, &out.CanarySoak
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(meta_v1.Duration)
+			**out = **in
+		}
+	}
+	if in.ValueMap != nil {
+		in, out := &in.ValueMap, &out.ValueMap
+		*out = make([]ValueMapSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ValueFrom != nil {
+		in, out := &in.ValueFrom, &out.ValueFrom
+		*out = make([]ValueFromSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Rename != nil {
+		in, out := &in.Rename, &out.Rename
+		*out = make([]RenameSpec, len(*in))
+		copy(*out, *in)
+	}
+	if in.RemoveLabels != nil {
+		in, out := &in.RemoveLabels, &out.RemoveLabels
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RequeueAfter != nil {
+		in, out := &in.RequeueAfter, &out.RequeueAfter
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(meta_v1.Duration)
+			**out = **in
+		}
+	}
+	if in.RequireToleratingDaemonSet != nil {
+		in, out := &in.RequireToleratingDaemonSet, &out.RequireToleratingDaemonSet
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(DaemonSetReference)
+			**out = **in
+		}
+	}
+	if in.TaintRemovalDelay != nil {
+		in, out := &in.TaintRemovalDelay, &out.TaintRemovalDelay
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(meta_v1.Duration)
+			**out = **in
+		}
+	}
+	if in.TaintEscalation != nil {
+		in, out := &in.TaintEscalation, &out.TaintEscalation
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(TaintEscalation)
+			**out = **in
+		}
+	}
+	if in.ClusterSizeCondition != nil {
+		in, out := &in.ClusterSizeCondition, &out.ClusterSizeCondition
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(ClusterSizeCondition)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.EffectiveFrom != nil {
+		in, out := &in.EffectiveFrom, &out.EffectiveFrom
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(meta_v1.Time)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.EffectiveUntil != nil {
+		in, out := &in.EffectiveUntil, &out.EffectiveUntil
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(meta_v1.Time)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.MetricsLabels != nil {
+		in, out := &in.MetricsLabels, &out.MetricsLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	return
 }
 
@@ -91,6 +312,7 @@ func (in *LabelerSpec) DeepCopy() *LabelerSpec {
 func (in *MergeSpec) DeepCopyInto(out *MergeSpec) {
 	*out = *in
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.NodeSpec.DeepCopyInto(&out.NodeSpec)
 	return
 }
 
@@ -103,3 +325,180 @@ func (in *MergeSpec) DeepCopy() *MergeSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamedValueSource) DeepCopyInto(out *NamedValueSource) {
+	*out = *in
+	if in.Params != nil {
+		in, out := &in.Params, &out.Params
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamedValueSource.
+func (in *NamedValueSource) DeepCopy() *NamedValueSource {
+	if in == nil {
+		return nil
+	}
+	out := new(NamedValueSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RenameSpec) DeepCopyInto(out *RenameSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RenameSpec.
+func (in *RenameSpec) DeepCopy() *RenameSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RenameSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TaintEscalation) DeepCopyInto(out *TaintEscalation) {
+	*out = *in
+	out.Soak = in.Soak
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TaintEscalation.
+func (in *TaintEscalation) DeepCopy() *TaintEscalation {
+	if in == nil {
+		return nil
+	}
+	out := new(TaintEscalation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ValueFromSpec) DeepCopyInto(out *ValueFromSpec) {
+	*out = *in
+	if in.Params != nil {
+		in, out := &in.Params, &out.Params
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Sources != nil {
+		in, out := &in.Sources, &out.Sources
+		*out = make([]NamedValueSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Default != nil {
+		in, out := &in.Default, &out.Default
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(string)
+			**out = **in
+		}
+	}
+	if in.ValueTransform != nil {
+		in, out := &in.ValueTransform, &out.ValueTransform
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(ValueTransform)
+			**out = **in
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ValueFromSpec.
+func (in *ValueFromSpec) DeepCopy() *ValueFromSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ValueFromSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ValueMapSpec) DeepCopyInto(out *ValueMapSpec) {
+	*out = *in
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Default != nil {
+		in, out := &in.Default, &out.Default
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(string)
+			**out = **in
+		}
+	}
+	if in.ValueTransform != nil {
+		in, out := &in.ValueTransform, &out.ValueTransform
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(ValueTransform)
+			**out = **in
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ValueMapSpec.
+func (in *ValueMapSpec) DeepCopy() *ValueMapSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ValueMapSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ValueTransform) DeepCopyInto(out *ValueTransform) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ValueTransform.
+func (in *ValueTransform) DeepCopy() *ValueTransform {
+	if in == nil {
+		return nil
+	}
+	out := new(ValueTransform)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VersionSelector) DeepCopyInto(out *VersionSelector) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VersionSelector.
+func (in *VersionSelector) DeepCopy() *VersionSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(VersionSelector)
+	in.DeepCopyInto(out)
+	return out
+}
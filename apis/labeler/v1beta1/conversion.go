@@ -0,0 +1,142 @@
+package v1beta1
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	labeler "github.com/joshisa/resource-labeler-operator/apis/labeler"
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// Hub marks this version as the hub of the conversions, the other versions are
+// converted from and to it.
+func (*Labeler) Hub() {}
+
+// ConvertFrom converts the v1alpha1 labeler to this version. The v1alpha1 merge is a
+// whole node metadata and spec, its fields other than the labels, annotations and
+// taints are kept on the merge conversion annotation so converting the labeler back
+// doesn't lose them.
+func (dst *Labeler) ConvertFrom(src *labelerv1alpha1.Labeler) error {
+	src = src.DeepCopy()
+	dst.TypeMeta = metav1.TypeMeta{Kind: LabelerKind, APIVersion: SchemeGroupVersion.String()}
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec = convertSpecFromV1alpha1(&src.Spec)
+
+	rest := src.Spec.Merge
+	rest.Labels, rest.Annotations, rest.Taints = nil, nil, nil
+	if reflect.DeepEqual(rest, labelerv1alpha1.MergeSpec{}) {
+		return nil
+	}
+	b, err := json.Marshal(rest)
+	if err != nil {
+		return fmt.Errorf("could not encode the v1alpha1 merge of labeler %s: %s", src.Name, err)
+	}
+	if dst.Annotations == nil {
+		dst.Annotations = map[string]string{}
+	}
+	dst.Annotations[labeler.MergeConversionAnnotation] = string(b)
+	return nil
+}
+
+// ConvertTo converts the labeler to v1alpha1, restoring the merge fields kept on the
+// merge conversion annotation.
+func (src *Labeler) ConvertTo(dst *labelerv1alpha1.Labeler) error {
+	src = src.DeepCopy()
+	dst.TypeMeta = metav1.TypeMeta{Kind: labelerv1alpha1.LabelerKind, APIVersion: labelerv1alpha1.SchemeGroupVersion.String()}
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec = convertSpecToV1alpha1(&src.Spec)
+
+	if rest, ok := src.Annotations[labeler.MergeConversionAnnotation]; ok {
+		if err := json.Unmarshal([]byte(rest), &dst.Spec.Merge); err != nil {
+			return fmt.Errorf("could not decode the v1alpha1 merge of labeler %s: %s", src.Name, err)
+		}
+		delete(dst.Annotations, labeler.MergeConversionAnnotation)
+		if len(dst.Annotations) == 0 {
+			dst.Annotations = nil
+		}
+	}
+	dst.Spec.Merge.Labels = src.Spec.Merge.Labels
+	dst.Spec.Merge.Annotations = src.Spec.Merge.Annotations
+	dst.Spec.Merge.Taints = src.Spec.Merge.Taints
+	return nil
+}
+
+func convertSpecFromV1alpha1(src *labelerv1alpha1.LabelerSpec) LabelerSpec {
+	return LabelerSpec{
+		NodeSelector: src.NodeSelector,
+		Merge: MergeSpec{
+			Labels:      src.Merge.Labels,
+			Annotations: src.Merge.Annotations,
+			Taints:      src.Merge.Taints,
+		},
+		When:                       src.When,
+		VersionSelector:            src.VersionSelector,
+		ConditionSelector:          src.ConditionSelector,
+		NodeGroupSelector:          src.NodeGroupSelector,
+		ReportNearMatches:          src.ReportNearMatches,
+		Retain:                     src.Retain,
+		ProtectedKeys:              src.ProtectedKeys,
+		DryRun:                     src.DryRun,
+		MaxBlastRadius:             src.MaxBlastRadius,
+		PriorityClass:              src.PriorityClass,
+		RolloutPercentage:          src.RolloutPercentage,
+		RolloutOrder:               src.RolloutOrder,
+		RolloutStrategy:            src.RolloutStrategy,
+		RolloutZoneLabel:           src.RolloutZoneLabel,
+		CanarySoak:                 src.CanarySoak,
+		ValueMap:                   src.ValueMap,
+		ValueFrom:                  src.ValueFrom,
+		Rename:                     src.Rename,
+		RemoveLabels:               src.RemoveLabels,
+		RequeueAfter:               src.RequeueAfter,
+		RequireToleratingDaemonSet: src.RequireToleratingDaemonSet,
+		TaintRemovalPolicy:         src.TaintRemovalPolicy,
+		TaintRemovalDelay:          src.TaintRemovalDelay,
+		TaintEscalation:            src.TaintEscalation,
+		ClusterSizeCondition:       src.ClusterSizeCondition,
+		EffectiveFrom:              src.EffectiveFrom,
+		EffectiveUntil:             src.EffectiveUntil,
+		MetricsLabels:              src.MetricsLabels,
+		TargetKind:                 src.TargetKind,
+		FieldManager:               src.FieldManager,
+	}
+}
+
+func convertSpecToV1alpha1(src *LabelerSpec) labelerv1alpha1.LabelerSpec {
+	return labelerv1alpha1.LabelerSpec{
+		NodeSelector:               src.NodeSelector,
+		When:                       src.When,
+		VersionSelector:            src.VersionSelector,
+		ConditionSelector:          src.ConditionSelector,
+		NodeGroupSelector:          src.NodeGroupSelector,
+		ReportNearMatches:          src.ReportNearMatches,
+		Retain:                     src.Retain,
+		ProtectedKeys:              src.ProtectedKeys,
+		DryRun:                     src.DryRun,
+		MaxBlastRadius:             src.MaxBlastRadius,
+		PriorityClass:              src.PriorityClass,
+		RolloutPercentage:          src.RolloutPercentage,
+		RolloutOrder:               src.RolloutOrder,
+		RolloutStrategy:            src.RolloutStrategy,
+		RolloutZoneLabel:           src.RolloutZoneLabel,
+		CanarySoak:                 src.CanarySoak,
+		ValueMap:                   src.ValueMap,
+		ValueFrom:                  src.ValueFrom,
+		Rename:                     src.Rename,
+		RemoveLabels:               src.RemoveLabels,
+		RequeueAfter:               src.RequeueAfter,
+		RequireToleratingDaemonSet: src.RequireToleratingDaemonSet,
+		TaintRemovalPolicy:         src.TaintRemovalPolicy,
+		TaintRemovalDelay:          src.TaintRemovalDelay,
+		TaintEscalation:            src.TaintEscalation,
+		ClusterSizeCondition:       src.ClusterSizeCondition,
+		EffectiveFrom:              src.EffectiveFrom,
+		EffectiveUntil:             src.EffectiveUntil,
+		MetricsLabels:              src.MetricsLabels,
+		TargetKind:                 src.TargetKind,
+		FieldManager:               src.FieldManager,
+	}
+}
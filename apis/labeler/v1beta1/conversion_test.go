@@ -0,0 +1,133 @@
+package v1beta1
+
+import (
+	"reflect"
+	"testing"
+
+	fuzz "github.com/google/gofuzz"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	labeler "github.com/joshisa/resource-labeler-operator/apis/labeler"
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+func TestConvertFromV1alpha1(t *testing.T) {
+	taints := []corev1.Taint{{Key: "gpu", Effect: corev1.TaintEffectNoSchedule}}
+	tests := []struct {
+		name   string
+		src    labelerv1alpha1.Labeler
+		expHub Labeler
+	}{
+		{
+			name: "A labels only merge is the labels of the merge.",
+			src: labelerv1alpha1.Labeler{
+				ObjectMeta: metav1.ObjectMeta{Name: "gpu"},
+				Spec: labelerv1alpha1.LabelerSpec{
+					Merge:  labelerv1alpha1.MergeSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"gpu": "true"}}},
+					DryRun: true,
+				},
+			},
+			expHub: Labeler{
+				ObjectMeta: metav1.ObjectMeta{Name: "gpu"},
+				Spec: LabelerSpec{
+					Merge:  MergeSpec{Labels: map[string]string{"gpu": "true"}},
+					DryRun: true,
+				},
+			},
+		},
+		{
+			name: "The labels, annotations and taints are the merge.",
+			src: labelerv1alpha1.Labeler{
+				ObjectMeta: metav1.ObjectMeta{Name: "gpu"},
+				Spec: labelerv1alpha1.LabelerSpec{Merge: labelerv1alpha1.MergeSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"gpu": "true"}, Annotations: map[string]string{"team": "ml"}},
+					NodeSpec:   corev1.NodeSpec{Taints: taints},
+				}},
+			},
+			expHub: Labeler{
+				ObjectMeta: metav1.ObjectMeta{Name: "gpu"},
+				Spec: LabelerSpec{Merge: MergeSpec{
+					Labels:      map[string]string{"gpu": "true"},
+					Annotations: map[string]string{"team": "ml"},
+					Taints:      taints,
+				}},
+			},
+		},
+		{
+			name: "The other merge fields are kept on the annotation.",
+			src: labelerv1alpha1.Labeler{
+				ObjectMeta: metav1.ObjectMeta{Name: "gpu", Annotations: map[string]string{"owner": "ml"}},
+				Spec: labelerv1alpha1.LabelerSpec{Merge: labelerv1alpha1.MergeSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"gpu": "true"}},
+					NodeSpec:   corev1.NodeSpec{Unschedulable: true},
+				}},
+			},
+			expHub: Labeler{
+				ObjectMeta: metav1.ObjectMeta{Name: "gpu", Annotations: map[string]string{
+					"owner":                           "ml",
+					labeler.MergeConversionAnnotation: `{"creationTimestamp":null,"unschedulable":true}`,
+				}},
+				Spec: LabelerSpec{Merge: MergeSpec{Labels: map[string]string{"gpu": "true"}}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.expHub.TypeMeta = metav1.TypeMeta{Kind: LabelerKind, APIVersion: SchemeGroupVersion.String()}
+			hub := &Labeler{}
+			if err := hub.ConvertFrom(&test.src); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*hub, test.expHub) {
+				t.Errorf("expected the labeler %+v, got %+v", test.expHub, *hub)
+			}
+			// The source is not changed.
+			if _, ok := test.src.Annotations[labeler.MergeConversionAnnotation]; ok {
+				t.Errorf("expected the source labeler not annotated")
+			}
+		})
+	}
+}
+
+func TestConversionRoundTrip(t *testing.T) {
+	// The fuzzed times have no nanoseconds, they survive the JSON encoding of the
+	// merge conversion annotation.
+	f := fuzz.NewWithSeed(1).NilChance(0.3)
+	for i := 0; i < 200; i++ {
+		src := &labelerv1alpha1.Labeler{}
+		f.Fuzz(src)
+		src.TypeMeta = metav1.TypeMeta{Kind: labelerv1alpha1.LabelerKind, APIVersion: labelerv1alpha1.SchemeGroupVersion.String()}
+
+		hub := &Labeler{}
+		if err := hub.ConvertFrom(src); err != nil {
+			t.Fatal(err)
+		}
+		got := &labelerv1alpha1.Labeler{}
+		if err := hub.ConvertTo(got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, src) {
+			t.Fatalf("expected the v1alpha1 labeler unchanged by the round trip:\n%+v\ngot:\n%+v", src, got)
+		}
+	}
+
+	for i := 0; i < 200; i++ {
+		src := &Labeler{}
+		f.Fuzz(src)
+		src.TypeMeta = metav1.TypeMeta{Kind: LabelerKind, APIVersion: SchemeGroupVersion.String()}
+
+		spoke := &labelerv1alpha1.Labeler{}
+		if err := src.ConvertTo(spoke); err != nil {
+			t.Fatal(err)
+		}
+		got := &Labeler{}
+		if err := got.ConvertFrom(spoke); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, src) {
+			t.Fatalf("expected the v1beta1 labeler unchanged by the round trip:\n%+v\ngot:\n%+v", src, got)
+		}
+	}
+}
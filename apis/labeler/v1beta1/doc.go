@@ -0,0 +1,6 @@
+// +k8s:deepcopy-gen=package
+
+// Package v1beta1 is the v1beta1 version of the API, the hub of the conversions
+// between the versions.
+// +groupName=labeler.cfmr.site
+package v1beta1
@@ -0,0 +1,204 @@
+package v1beta1
+
+import (
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Labeler sets labels, annotations and taints on the nodes it selects.
+type Labeler struct {
+	metav1.TypeMeta `json:",inline"`
+	// Standard object's metadata.
+	// More info: https://git.k8s.io/community/contributors/devel/api-conventions.md#metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Specification of the desired behaviour of the labeler.
+	// More info: https://git.k8s.io/community/contributors/devel/api-conventions.md#spec-and-status
+	// +optional
+	Spec LabelerSpec `json:"spec,omitempty"`
+}
+
+type LabelerSpec struct {
+	// Selector is how the target will be selected.
+	v1.NodeSelector `json:",inline"`
+
+	// Merge are the labels, annotations and taints set on the selected nodes.
+	// +optional
+	Merge MergeSpec `json:"merge,omitempty"`
+	// When are the node label requirements that need to be met to apply the labeler,
+	// once not met the applied attributes are removed (unless retained).
+	// +optional
+	When []v1.NodeSelectorRequirement `json:"when,omitempty"`
+	// VersionSelector are the node version ranges that need to be met to apply the
+	// labeler, like the when requirements.
+	// +optional
+	VersionSelector *VersionSelector `json:"versionSelector,omitempty"`
+	// ConditionSelector are the node conditions that need to be met to apply the
+	// labeler, like the when requirements.
+	// +optional
+	ConditionSelector []ConditionRequirement `json:"conditionSelector,omitempty"`
+	// NodeGroupSelector are the node groups (from the provider node group labels) the
+	// node needs to be in to apply the labeler, like the when requirements.
+	// +optional
+	NodeGroupSelector []string `json:"nodeGroupSelector,omitempty"`
+	// ReportNearMatches logs the nodes matching all but one clause of a node selector
+	// term with the failing clause, it doesn't change the selected nodes.
+	// +optional
+	ReportNearMatches bool `json:"reportNearMatches,omitempty"`
+	// Retain keeps the applied attributes on the nodes when the labeler doesn't
+	// apply anymore.
+	// +optional
+	Retain bool `json:"retain,omitempty"`
+	// ProtectedKeys are the label, annotation and taint keys the labeler sets but
+	// never removes, "prefix/*" entries protect a whole prefix.
+	// +optional
+	ProtectedKeys []string `json:"protectedKeys,omitempty"`
+	// DryRun plans and reports the changes of the labeler without applying them.
+	// +optional
+	DryRun bool `json:"dryRun,omitempty"`
+	// MaxBlastRadius is the maximum number of nodes a new generation of the labeler can
+	// newly select before being approved, it overrides the operator one and 0 disables
+	// it.
+	// +optional
+	MaxBlastRadius *int32 `json:"maxBlastRadius,omitempty"`
+	// PriorityClass is the priority of the syncs of the nodes the labeler selects or
+	// is applied to on the node queue: high, normal (default) or low.
+	// +optional
+	PriorityClass string `json:"priorityClass,omitempty"`
+	// RolloutPercentage is the percent of the matching nodes that will be labeled.
+	// If not set all the matching nodes will be labeled.
+	// +optional
+	RolloutPercentage *int32 `json:"rolloutPercentage,omitempty"`
+	// RolloutOrder is the order used to select the nodes of the rollout.
+	// +optional
+	RolloutOrder RolloutOrder `json:"rolloutOrder,omitempty"`
+	// RolloutStrategy is how the nodes of the rollout are picked from the matching ones.
+	// +optional
+	RolloutStrategy RolloutStrategy `json:"rolloutStrategy,omitempty"`
+	// RolloutZoneLabel is the node label with the zone of the BalancedByZone strategy,
+	// the well-known zone labels if not set.
+	// +optional
+	RolloutZoneLabel string `json:"rolloutZoneLabel,omitempty"`
+	// CanarySoak is how long the canary nodes need to be ready with the labeler
+	// applied before the rest of the rollout proceeds.
+	// +optional
+	CanarySoak *metav1.Duration `json:"canarySoak,omitempty"`
+	// ValueMap sets labels with values mapped from the values of other labels.
+	// +optional
+	ValueMap []ValueMapSpec `json:"valueMap,omitempty"`
+	// ValueFrom sets labels with values resolved from the nodes.
+	// +optional
+	ValueFrom []ValueFromSpec `json:"valueFrom,omitempty"`
+	// Rename renames label keys of the selected nodes keeping their values.
+	// +optional
+	Rename []RenameSpec `json:"rename,omitempty"`
+	// RemoveLabels removes label keys from the selected nodes. The entries between
+	// slashes (e.g. /^example\.com\/legacy-.*/) are regular expressions matching the
+	// whole key, the others exact keys.
+	// +optional
+	RemoveLabels []string `json:"removeLabels,omitempty"`
+	// RequeueAfter is the period the selected nodes will be checked again regardless
+	// of the node events and the resync period.
+	// +optional
+	RequeueAfter *metav1.Duration `json:"requeueAfter,omitempty"`
+	// RequireToleratingDaemonSet is the DaemonSet whose pod template needs to tolerate
+	// the NoExecute taints of the labeler before they are applied, so its pods are not
+	// evicted.
+	// +optional
+	RequireToleratingDaemonSet *DaemonSetReference `json:"requireToleratingDaemonSet,omitempty"`
+	// TaintRemovalPolicy is when the taints set by the labeler and no longer in its
+	// merge taints are removed from the nodes: Immediate (default) or Deferred.
+	// +optional
+	TaintRemovalPolicy TaintRemovalPolicy `json:"taintRemovalPolicy,omitempty"`
+	// TaintRemovalDelay is how long the Deferred policy keeps the removed NoSchedule and
+	// NoExecute taints on the nodes after the spec edit.
+	// +optional
+	TaintRemovalDelay *metav1.Duration `json:"taintRemovalDelay,omitempty"`
+	// TaintEscalation applies the NoExecute merge taints as NoSchedule first, and as
+	// NoExecute once the nodes carried them for the soak.
+	// +optional
+	TaintEscalation *TaintEscalation `json:"taintEscalation,omitempty"`
+	// ClusterSizeCondition activates the labeler only while the cluster has a number
+	// of nodes in its bounds, otherwise the nodes don't meet the labeler requirements.
+	// +optional
+	ClusterSizeCondition *ClusterSizeCondition `json:"clusterSizeCondition,omitempty"`
+	// EffectiveFrom activates the labeler only from that time on, before it the nodes
+	// don't meet the labeler requirements.
+	// +optional
+	EffectiveFrom *metav1.Time `json:"effectiveFrom,omitempty"`
+	// EffectiveUntil deactivates the labeler from that time on, after it the nodes
+	// don't meet the labeler requirements.
+	// +optional
+	EffectiveUntil *metav1.Time `json:"effectiveUntil,omitempty"`
+	// MetricsLabels are the values of the operator --labeler-metrics-labels on the
+	// metrics of the labeler (e.g. team, env), for cost attribution.
+	// +optional
+	MetricsLabels map[string]string `json:"metricsLabels,omitempty"`
+	// TargetKind is the kind of the objects the labeler acts on, Node if not set.
+	// +optional
+	TargetKind TargetKind `json:"targetKind,omitempty"`
+	// FieldManager is the server-side apply field manager of the labels and
+	// annotations of the labeler with the apply patch type, the operator one if not
+	// set.
+	// +optional
+	FieldManager string `json:"fieldManager,omitempty"`
+}
+
+// MergeSpec are the attributes a labeler sets on the nodes. Unlike v1alpha1 it only
+// has the labels, annotations and taints, the only node fields the operator merges.
+type MergeSpec struct {
+	// Labels are the labels set on the nodes.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are the annotations set on the nodes.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Taints are the taints set on the nodes.
+	// +optional
+	Taints []v1.Taint `json:"taints,omitempty"`
+}
+
+// The types of the spec that didn't change from v1alpha1.
+type (
+	TaintEscalation      = labelerv1alpha1.TaintEscalation
+	ClusterSizeCondition = labelerv1alpha1.ClusterSizeCondition
+	DaemonSetReference   = labelerv1alpha1.DaemonSetReference
+	VersionSelector      = labelerv1alpha1.VersionSelector
+	ConditionRequirement = labelerv1alpha1.ConditionRequirement
+	ValueMapSpec         = labelerv1alpha1.ValueMapSpec
+	ValueFromSpec        = labelerv1alpha1.ValueFromSpec
+	NamedValueSource     = labelerv1alpha1.NamedValueSource
+	ValueTransform       = labelerv1alpha1.ValueTransform
+	RenameSpec           = labelerv1alpha1.RenameSpec
+	RolloutOrder         = labelerv1alpha1.RolloutOrder
+	RolloutStrategy      = labelerv1alpha1.RolloutStrategy
+	TargetKind           = labelerv1alpha1.TargetKind
+	TaintRemovalPolicy   = labelerv1alpha1.TaintRemovalPolicy
+)
+
+// Rollout orders, strategies, target kinds and taint removal policies.
+const (
+	RolloutOrderHash              = labelerv1alpha1.RolloutOrderHash
+	RolloutOrderNewest            = labelerv1alpha1.RolloutOrderNewest
+	RolloutOrderOldest            = labelerv1alpha1.RolloutOrderOldest
+	RolloutStrategyOrdered        = labelerv1alpha1.RolloutStrategyOrdered
+	RolloutStrategyBalancedByZone = labelerv1alpha1.RolloutStrategyBalancedByZone
+	TargetKindNode                = labelerv1alpha1.TargetKindNode
+	TaintRemovalPolicyImmediate   = labelerv1alpha1.TaintRemovalPolicyImmediate
+	TaintRemovalPolicyDeferred    = labelerv1alpha1.TaintRemovalPolicyDeferred
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// LabelerList is a list of Labeler resources
+type LabelerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []Labeler `json:"items"`
+}
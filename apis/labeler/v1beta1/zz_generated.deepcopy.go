@@ -0,0 +1,280 @@
+// +build !ignore_autogenerated
+
+// This file was autogenerated by deepcopy-gen. Do not edit it manually!
+
+package v1beta1
+
+import (
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Labeler) DeepCopyInto(out *Labeler) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Labeler.
+func (in *Labeler) DeepCopy() *Labeler {
+	if in == nil {
+		return nil
+	}
+	out := new(Labeler)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Labeler) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	} else {
+		return nil
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LabelerList) DeepCopyInto(out *LabelerList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Labeler, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LabelerList.
+func (in *LabelerList) DeepCopy() *LabelerList {
+	if in == nil {
+		return nil
+	}
+	out := new(LabelerList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LabelerList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	} else {
+		return nil
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LabelerSpec) DeepCopyInto(out *LabelerSpec) {
+	*out = *in
+	in.NodeSelector.DeepCopyInto(&out.NodeSelector)
+	in.Merge.DeepCopyInto(&out.Merge)
+	if in.When != nil {
+		in, out := &in.When, &out.When
+		*out = make([]core_v1.NodeSelectorRequirement, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.VersionSelector != nil {
+		in, out := &in.VersionSelector, &out.VersionSelector
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(VersionSelector)
+			**out = **in
+		}
+	}
+	if in.ConditionSelector != nil {
+		in, out := &in.ConditionSelector, &out.ConditionSelector
+		*out = make([]ConditionRequirement, len(*in))
+		copy(*out, *in)
+	}
+	if in.NodeGroupSelector != nil {
+		in, out := &in.NodeGroupSelector, &out.NodeGroupSelector
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ProtectedKeys != nil {
+		in, out := &in.ProtectedKeys, &out.ProtectedKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaxBlastRadius != nil {
+		in, out := &in.MaxBlastRadius, &out.MaxBlastRadius
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(int32)
+			**out = **in
+		}
+	}
+	if in.RolloutPercentage != nil {
+		in, out := &in.RolloutPercentage, &out.RolloutPercentage
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(int32)
+			**out = **in
+		}
+	}
+	if in.CanarySoak != nil {
+		in, out := &in.CanarySoak, &out.CanarySoak
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(meta_v1.Duration)
+			**out = **in
+		}
+	}
+	if in.ValueMap != nil {
+		in, out := &in.ValueMap, &out.ValueMap
+		*out = make([]ValueMapSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ValueFrom != nil {
+		in, out := &in.ValueFrom, &out.ValueFrom
+		*out = make([]ValueFromSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Rename != nil {
+		in, out := &in.Rename, &out.Rename
+		*out = make([]RenameSpec, len(*in))
+		copy(*out, *in)
+	}
+	if in.RemoveLabels != nil {
+		in, out := &in.RemoveLabels, &out.RemoveLabels
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RequeueAfter != nil {
+		in, out := &in.RequeueAfter, &out.RequeueAfter
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(meta_v1.Duration)
+			**out = **in
+		}
+	}
+	if in.RequireToleratingDaemonSet != nil {
+		in, out := &in.RequireToleratingDaemonSet, &out.RequireToleratingDaemonSet
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(DaemonSetReference)
+			**out = **in
+		}
+	}
+	if in.TaintRemovalDelay != nil {
+		in, out := &in.TaintRemovalDelay, &out.TaintRemovalDelay
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(meta_v1.Duration)
+			**out = **in
+		}
+	}
+	if in.TaintEscalation != nil {
+		in, out := &in.TaintEscalation, &out.TaintEscalation
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(TaintEscalation)
+			**out = **in
+		}
+	}
+	if in.ClusterSizeCondition != nil {
+		in, out := &in.ClusterSizeCondition, &out.ClusterSizeCondition
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(ClusterSizeCondition)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.EffectiveFrom != nil {
+		in, out := &in.EffectiveFrom, &out.EffectiveFrom
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(meta_v1.Time)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.EffectiveUntil != nil {
+		in, out := &in.EffectiveUntil, &out.EffectiveUntil
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(meta_v1.Time)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.MetricsLabels != nil {
+		in, out := &in.MetricsLabels, &out.MetricsLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LabelerSpec.
+func (in *LabelerSpec) DeepCopy() *LabelerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(LabelerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MergeSpec) DeepCopyInto(out *MergeSpec) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Taints != nil {
+		in, out := &in.Taints, &out.Taints
+		*out = make([]core_v1.Taint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MergeSpec.
+func (in *MergeSpec) DeepCopy() *MergeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MergeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,173 @@
+package cloudevents
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/joshisa/resource-labeler-operator/log"
+	"github.com/joshisa/resource-labeler-operator/metrics"
+	"github.com/joshisa/resource-labeler-operator/service/labeler"
+)
+
+// MutationType is the CloudEvents type of the node mutations.
+const MutationType = "com.example.labeler.mutation"
+
+// Delivery failure reasons.
+const (
+	failureDropped = "dropped"
+	failureFailed  = "failed"
+)
+
+const (
+	specVersion     = "1.0"
+	contentType     = "application/cloudevents+json"
+	queueSize       = 1000
+	requestTimeout  = 10 * time.Second
+	retryBackoff    = time.Second
+	defaultAttempts = 3
+)
+
+// Config is the CloudEvents sender configuration.
+type Config struct {
+	// Sink is the URL the events are POSTed to.
+	Sink string
+	// Source is the CloudEvents source of the events.
+	Source string
+	// Attempts is the number of deliveries of an event before it's dropped.
+	Attempts int
+	// MetricsRecorder records the delivery failures (optional).
+	MetricsRecorder metrics.Recorder
+}
+
+// event is a CloudEvent in the structured JSON mode.
+type event struct {
+	SpecVersion     string           `json:"specversion"`
+	ID              string           `json:"id"`
+	Source          string           `json:"source"`
+	Type            string           `json:"type"`
+	Subject         string           `json:"subject"`
+	Time            time.Time        `json:"time"`
+	DataContentType string           `json:"datacontenttype"`
+	Data            labeler.Mutation `json:"data"`
+}
+
+// Sender POSTs the node mutations as CloudEvents to a sink. It's best-effort: the
+// mutations are queued and sent in order, a mutation is dropped when the queue is full
+// or when its deliveries fail.
+type Sender struct {
+	cfg    Config
+	client *http.Client
+	queue  chan labeler.Mutation
+	logger log.Logger
+}
+
+// NewSender returns a new CloudEvents sender.
+func NewSender(cfg Config, logger log.Logger) *Sender {
+	if cfg.MetricsRecorder == nil {
+		cfg.MetricsRecorder = metrics.Dummy
+	}
+	if cfg.Attempts <= 0 {
+		cfg.Attempts = defaultAttempts
+	}
+	return &Sender{
+		cfg:    cfg,
+		client: &http.Client{Timeout: requestTimeout},
+		queue:  make(chan labeler.Mutation, queueSize),
+		logger: logger,
+	}
+}
+
+// RecordMutation queues the mutation to be sent. Satisfies labeler.MutationRecorder interface.
+func (s *Sender) RecordMutation(m labeler.Mutation) {
+	select {
+	case s.queue <- m:
+	default:
+		s.logger.Warningf("cloudevents queue full, mutation of node %s by %s dropped", m.Node, m.Rule)
+		s.cfg.MetricsRecorder.IncCloudEventsFailures(failureDropped)
+	}
+}
+
+// Run sends the queued mutations until stopC is closed. Satisfies kooper controller.Controller interface.
+func (s *Sender) Run(stopC <-chan struct{}) error {
+	s.logger.Infof("sending the node mutations as cloudevents to %s", s.cfg.Sink)
+	for {
+		select {
+		case m := <-s.queue:
+			s.deliver(m, stopC)
+		case <-stopC:
+			return nil
+		}
+	}
+}
+
+// deliver sends the mutation, retrying with a linear backoff up to the attempts.
+func (s *Sender) deliver(m labeler.Mutation, stopC <-chan struct{}) {
+	ev, err := newEvent(s.cfg.Source, m)
+	if err != nil {
+		s.logger.Errorf("could not create the cloudevent of the mutation of node %s: %s", m.Node, err)
+		s.cfg.MetricsRecorder.IncCloudEventsFailures(failureFailed)
+		return
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		s.logger.Errorf("could not marshal the cloudevent of the mutation of node %s: %s", m.Node, err)
+		s.cfg.MetricsRecorder.IncCloudEventsFailures(failureFailed)
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		if err = s.send(body); err == nil {
+			return
+		}
+		if attempt == s.cfg.Attempts {
+			break
+		}
+		select {
+		case <-time.After(time.Duration(attempt) * retryBackoff):
+		case <-stopC:
+			return
+		}
+	}
+	s.logger.Warningf("could not send cloudevent %s of the mutation of node %s after %d attempts: %s", ev.ID, m.Node, s.cfg.Attempts, err)
+	s.cfg.MetricsRecorder.IncCloudEventsFailures(failureFailed)
+}
+
+// send POSTs the event, any non 2xx response is an error.
+func (s *Sender) send(body []byte) error {
+	resp, err := s.client.Post(s.cfg.Sink, contentType, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Drain the body so the connection is reused.
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("sink responded %s", resp.Status)
+	}
+	return nil
+}
+
+// newEvent returns the CloudEvent of the mutation, with a random ID.
+func newEvent(source string, m labeler.Mutation) (event, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return event{}, err
+	}
+	return event{
+		SpecVersion:     specVersion,
+		ID:              hex.EncodeToString(id),
+		Source:          source,
+		Type:            MutationType,
+		Subject:         m.Node,
+		Time:            m.Time,
+		DataContentType: "application/json",
+		Data:            m,
+	}, nil
+}
@@ -0,0 +1,202 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	kooperlog "github.com/spotahome/kooper/log"
+
+	"github.com/joshisa/resource-labeler-operator/metrics"
+	"github.com/joshisa/resource-labeler-operator/service/labeler"
+)
+
+// sink is a test CloudEvents sink, it records the events it receives and answers
+// them with its statuses in order, then with 200.
+type sink struct {
+	mu       sync.Mutex
+	statuses []int
+	types    []string
+	events   []map[string]interface{}
+	received chan struct{}
+}
+
+func newSink(statuses ...int) *sink {
+	return &sink{statuses: statuses, received: make(chan struct{}, 10)}
+}
+
+func (s *sink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer func() {
+		s.mu.Unlock()
+		s.received <- struct{}{}
+	}()
+	var ev map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&ev)
+	s.types = append(s.types, r.Header.Get("Content-Type"))
+	s.events = append(s.events, ev)
+	status := http.StatusOK
+	if len(s.statuses) > 0 {
+		status, s.statuses = s.statuses[0], s.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+// await waits for n requests to the sink.
+func (s *sink) await(t *testing.T, n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case <-s.received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %d requests to the sink, got %d", n, i)
+		}
+	}
+}
+
+// failures records the delivery failures by reason.
+type failures struct {
+	metrics.Recorder
+	mu      sync.Mutex
+	reasons []string
+}
+
+func (f *failures) IncCloudEventsFailures(reason string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reasons = append(f.reasons, reason)
+}
+
+func (f *failures) get() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.reasons...)
+}
+
+// runSender runs a sender of the sink, it returns the func stopping it.
+func runSender(s *Sender) func() {
+	stopC := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		s.Run(stopC)
+		close(done)
+	}()
+	return func() {
+		close(stopC)
+		<-done
+	}
+}
+
+func TestSenderDelivers(t *testing.T) {
+	sk := newSink()
+	srv := httptest.NewServer(sk)
+	defer srv.Close()
+	f := &failures{Recorder: metrics.Dummy}
+	s := NewSender(Config{Sink: srv.URL, Source: "labeler/test", MetricsRecorder: f}, kooperlog.Dummy)
+	defer runSender(s)()
+
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.RecordMutation(labeler.Mutation{Time: now, Node: "n1", Rule: "gpu", Operation: "patch", Keys: []string{"labels/team"}})
+	s.RecordMutation(labeler.Mutation{Time: now, Node: "n2", Rule: "gpu", Operation: "patch", Keys: []string{"labels/team"}})
+	sk.await(t, 2)
+
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+	if exp := []string{contentType, contentType}; !reflect.DeepEqual(sk.types, exp) {
+		t.Errorf("expected the structured content type, got %v", sk.types)
+	}
+	ev := sk.events[0]
+	id, _ := ev["id"].(string)
+	if len(id) != 32 || id == sk.events[1]["id"] {
+		t.Errorf("expected a random ID per event, got %q and %q", id, sk.events[1]["id"])
+	}
+	delete(ev, "id")
+	exp := map[string]interface{}{
+		"specversion":     "1.0",
+		"source":          "labeler/test",
+		"type":            MutationType,
+		"subject":         "n1",
+		"time":            "2026-01-02T03:04:05Z",
+		"datacontenttype": "application/json",
+		"data": map[string]interface{}{
+			"time":      "2026-01-02T03:04:05Z",
+			"node":      "n1",
+			"rule":      "gpu",
+			"operation": "patch",
+			"keys":      []interface{}{"labels/team"},
+		},
+	}
+	if !reflect.DeepEqual(ev, exp) {
+		t.Errorf("expected the event %v, got %v", exp, ev)
+	}
+	if r := f.get(); len(r) != 0 {
+		t.Errorf("expected no failures, got %v", r)
+	}
+}
+
+func TestSenderRetries(t *testing.T) {
+	tests := []struct {
+		name        string
+		statuses    []int
+		expRequests int
+		expFailures []string
+	}{
+		{
+			name:        "A failed delivery is retried.",
+			statuses:    []int{http.StatusServiceUnavailable},
+			expRequests: 2,
+		},
+		{
+			name:        "An event failing all its attempts is dropped.",
+			statuses:    []int{http.StatusInternalServerError, http.StatusBadRequest},
+			expRequests: 2,
+			expFailures: []string{failureFailed},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sk := newSink(test.statuses...)
+			srv := httptest.NewServer(sk)
+			defer srv.Close()
+			f := &failures{Recorder: metrics.Dummy}
+			s := NewSender(Config{Sink: srv.URL, Attempts: 2, MetricsRecorder: f}, kooperlog.Dummy)
+			stop := runSender(s)
+
+			s.RecordMutation(labeler.Mutation{Node: "n1"})
+			sk.await(t, test.expRequests)
+			// The failure is recorded once the last attempt is answered.
+			deadline := time.Now().Add(time.Second)
+			for len(f.get()) != len(test.expFailures) && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			stop()
+
+			if r := f.get(); !reflect.DeepEqual(r, test.expFailures) {
+				t.Errorf("expected the failures %v, got %v", test.expFailures, r)
+			}
+			if n := len(sk.received); n != 0 {
+				t.Errorf("expected %d requests, got %d", test.expRequests, test.expRequests+n)
+			}
+		})
+	}
+}
+
+func TestSenderDropsOnFullQueue(t *testing.T) {
+	f := &failures{Recorder: metrics.Dummy}
+	// Not running, the queue is never drained.
+	s := NewSender(Config{Sink: "http://127.0.0.1:0", MetricsRecorder: f}, kooperlog.Dummy)
+	for i := 0; i < queueSize+2; i++ {
+		s.RecordMutation(labeler.Mutation{Node: "n1"})
+	}
+
+	if n := len(s.queue); n != queueSize {
+		t.Errorf("expected %d queued mutations, got %d", queueSize, n)
+	}
+	if exp := []string{failureDropped, failureDropped}; !reflect.DeepEqual(f.get(), exp) {
+		t.Errorf("expected the failures %v, got %v", exp, f.get())
+	}
+}
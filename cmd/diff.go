@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	kooperlog "github.com/spotahome/kooper/log"
+
+	apilabeler "github.com/joshisa/resource-labeler-operator/apis/labeler"
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+	"github.com/joshisa/resource-labeler-operator/service/labeler"
+)
+
+// Diff output formats.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// ANSI colors of the text diff.
+const (
+	colorReset  = "\x1b[0m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorRed    = "\x1b[31m"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show the node changes the labelers would make if the operator ran now",
+	Long: `diff reads the labelers and the nodes of the cluster and lists, per node, the
+labels, annotations and taints the operator would add, change or remove. Nothing
+is written to the cluster.`,
+
+	RunE: runDiff,
+}
+
+// nodeDiff is the changes the labelers would make on a node.
+type nodeDiff struct {
+	Node    string           `json:"node"`
+	Changes []labeler.Change `json:"changes"`
+}
+
+func init() {
+	diffCmd.Flags().StringP("output", "o", outputText, "The output format (text or json)")
+	diffCmd.Flags().Bool("no-color", false, "Don't colorize the text output")
+	rootCmd.AddCommand(diffCmd)
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	if output != outputText && output != outputJSON {
+		return fmt.Errorf("invalid output format %q, must be %s or %s", output, outputText, outputJSON)
+	}
+	noColor, _ := cmd.Flags().GetBool("no-color")
+	nodeList, lcs, ownerAnnotation, err := loadPlanning()
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(nodeList.Items, func(i, j int) bool { return nodeList.Items[i].Name < nodeList.Items[j].Name })
+	diffs := []nodeDiff{}
+	for i := range nodeList.Items {
+		node := &nodeList.Items[i]
+		planned, _, _, err := labeler.PlanNode(lcs, node)
+		if err != nil {
+			return fmt.Errorf("could not plan node %s: %s", node.Name, err)
+		}
+
+		if changes := labeler.Diff(node, planned, ownerAnnotation); len(changes) > 0 {
+			diffs = append(diffs, nodeDiff{Node: node.Name, Changes: changes})
+		}
+	}
+
+	if output == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diffs)
+	}
+	printDiffs(os.Stdout, diffs, !noColor)
+	return nil
+}
+
+// loadPlanning reads the nodes and the labelers of the cluster and returns the nodes,
+// the label controllers of the valid labelers in the order the operator applies them
+// and the owner annotation.
+func loadPlanning() (*corev1.NodeList, []*labeler.LabelController, string, error) {
+	lcfg, err := planningConfig()
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	nlCli, _, k8sCli, err := GetKubernetesClients(kooperlog.Dummy)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	nodeList, err := k8sCli.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("could not list nodes: %s", err)
+	}
+	labelerList, err := nlCli.LabelerV1alpha1().Labelers().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("could not list labelers: %s", err)
+	}
+
+	nodes := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for i := range nodeList.Items {
+		nodes.Add(&nodeList.Items[i])
+	}
+
+	// Plan the labelers in the same order as the operator.
+	all := make([]*labelerv1alpha1.Labeler, 0, len(labelerList.Items))
+	for i := range labelerList.Items {
+		all = append(all, &labelerList.Items[i])
+	}
+	labeler.SortLabelers(all, lcfg.ConflictTiebreak)
+	var lcs []*labeler.LabelController
+	var ls []*labelerv1alpha1.Labeler
+	for _, l := range all {
+		if err := validatePlanning(l); err != nil {
+			fmt.Fprintf(os.Stderr, "skipping %s\n", err)
+			continue
+		}
+		lcs = append(lcs, labeler.NewLabelController(lcfg, l, nodes, kooperlog.Dummy))
+		ls = append(ls, l)
+	}
+	for _, d := range labeler.SelectorDependencies(ls) {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", d)
+	}
+	for _, r := range labeler.RedundantLabelers(lcs) {
+		fmt.Fprintf(os.Stderr, "note: %s\n", r)
+	}
+
+	return nodeList, lcs, lcfg.OwnerAnnotation, nil
+}
+
+// planningConfig returns the label controllers configuration of the offline planning
+// from the flags, like the operator one.
+func planningConfig() (labeler.Config, error) {
+	prefix, ownerAnnotation, err := managedAnnotations()
+	if err != nil {
+		return labeler.Config{}, err
+	}
+	if err := registerNodeGroupLabels(); err != nil {
+		return labeler.Config{}, err
+	}
+	policy, err := combinePolicy()
+	if err != nil {
+		return labeler.Config{}, err
+	}
+	tiebreak, err := conflictTiebreak()
+	if err != nil {
+		return labeler.Config{}, err
+	}
+	return labeler.Config{
+		OwnerAnnotation:  ownerAnnotation,
+		CanaryAnnotation: apilabeler.Annotation(prefix, apilabeler.CanaryAnnotationName),
+		ExemptAnnotation: apilabeler.Annotation(prefix, apilabeler.ExemptAnnotationName),
+		CombinePolicy:    policy,
+		ConflictTiebreak: tiebreak,
+		ProtectKeys:      viper.GetStringSlice("protect-keys"),
+	}, nil
+}
+
+// validatePlanning returns an error if the operator would reject the labeler.
+func validatePlanning(l *labelerv1alpha1.Labeler) error {
+	if err := labeler.Validate(l); err != nil {
+		return fmt.Errorf("invalid labeler %s: %s", l.Name, err)
+	}
+	if !viper.GetBool("allow-reserved") {
+		if err := labeler.ValidateReserved(l); err != nil {
+			return fmt.Errorf("labeler %s: %s, they are only allowed with --allow-reserved", l.Name, err)
+		}
+	}
+	if err := labeler.ValidateMatchLabels(l, viper.GetStringSlice("match-label-allowlist")); err != nil {
+		return fmt.Errorf("labeler %s: %s", l.Name, err)
+	}
+	effects, err := allowedTaintEffects()
+	if err != nil {
+		return err
+	}
+	if err := labeler.ValidateTaintEffects(l, effects); err != nil {
+		return fmt.Errorf("labeler %s: %s", l.Name, err)
+	}
+	if err := labeler.ValidateHTTPSources(l, viper.GetStringSlice("http-source-hosts"), viper.GetStringSlice("http-source-secrets")); err != nil {
+		return fmt.Errorf("labeler %s: %s", l.Name, err)
+	}
+	return nil
+}
+
+// printDiffs writes the diffs as text, one node per block.
+func printDiffs(w io.Writer, diffs []nodeDiff, color bool) {
+	if len(diffs) == 0 {
+		fmt.Fprintln(w, "All nodes are in sync")
+		return
+	}
+
+	for _, d := range diffs {
+		fmt.Fprintf(w, "node %s\n", d.Node)
+		for _, c := range d.Changes {
+			fmt.Fprintln(w, "  "+changeLine(c, color))
+		}
+	}
+}
+
+// changeLine returns the change as a +, ~ or - line.
+func changeLine(c labeler.Change, color bool) string {
+	var line, code string
+	switch c.Operation {
+	case labeler.ChangeAdd:
+		line, code = fmt.Sprintf("+ %s=%s", c.Key, c.New), colorGreen
+	case labeler.ChangeUpdate:
+		line, code = fmt.Sprintf("~ %s=%s -> %s", c.Key, c.Old, c.New), colorYellow
+	case labeler.ChangeRemove:
+		line, code = fmt.Sprintf("- %s=%s", c.Key, c.Old), colorRed
+	}
+	if color {
+		line = code + line + colorReset
+	}
+	return line
+}
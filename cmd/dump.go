@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/spf13/cobra"
+	kooperlog "github.com/spotahome/kooper/log"
+
+	"github.com/joshisa/resource-labeler-operator/service/labeler"
+)
+
+// dumpTimeout is the timeout of the requests to the operator HTTP server.
+const dumpTimeout = 10 * time.Second
+
+var dumpCmd = &cobra.Command{
+	Use:   "dump",
+	Short: "Collect a diagnostic bundle for a support ticket",
+	Long: `dump collects, into a tar.gz bundle, the version, the effective configuration, the
+labelers and their published status, a summary of the labelers matching the nodes,
+the recent mutations and the metrics of a running operator. The sensitive values
+are redacted and the node names are left out of the node summary. Nothing is
+written to the cluster, a part that can't be collected is reported on errors.txt
+and the rest of the bundle is still written.`,
+
+	RunE: runDump,
+}
+
+func init() {
+	dumpCmd.Flags().StringP("output", "o", "", "The bundle file, resource-labeler-dump-<time>.tar.gz by default")
+	dumpCmd.Flags().String("address", "http://localhost:8080", "The URL of the operator HTTP server (--listen-address), empty to skip the metrics and mutations")
+	rootCmd.AddCommand(dumpCmd)
+}
+
+// dumpVersion is the version info of the bundle.
+type dumpVersion struct {
+	Version    string `json:"version"`
+	GoVersion  string `json:"goVersion"`
+	Platform   string `json:"platform"`
+	Kubernetes string `json:"kubernetes,omitempty"`
+}
+
+// dumpStatus is the status published by an operator instance.
+type dumpStatus struct {
+	Identity  string    `json:"identity"`
+	Heartbeat time.Time `json:"heartbeat"`
+	labeler.Status
+}
+
+// labelerMatches are the nodes of a labeler by explanation result.
+type labelerMatches struct {
+	Labeler string         `json:"labeler"`
+	Results map[string]int `json:"results"`
+}
+
+// nodeSummary is the redacted summary of the labelers matching the nodes.
+type nodeSummary struct {
+	Nodes    int              `json:"nodes"`
+	Labelers []labelerMatches `json:"labelers"`
+}
+
+// dumpBundle are the files of the bundle, in order.
+type dumpBundle struct {
+	names  []string
+	files  map[string][]byte
+	errors []string
+}
+
+// add adds the file, as indented JSON unless it's bytes.
+func (b *dumpBundle) add(name string, v interface{}) {
+	data, ok := v.([]byte)
+	if !ok {
+		var err error
+		if data, err = json.MarshalIndent(v, "", "  "); err != nil {
+			b.fail(name, err)
+			return
+		}
+		data = append(data, '\n')
+	}
+	b.names = append(b.names, name)
+	b.files[name] = data
+}
+
+// fail records why the file could not be collected.
+func (b *dumpBundle) fail(name string, err error) {
+	b.errors = append(b.errors, fmt.Sprintf("%s: %s", name, err))
+}
+
+func runDump(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	address, _ := cmd.Flags().GetString("address")
+	now := time.Now()
+	if output == "" {
+		output = fmt.Sprintf("resource-labeler-dump-%s.tar.gz", now.UTC().Format("20060102-150405"))
+	}
+	b := &dumpBundle{files: map[string][]byte{}}
+
+	nlCli, _, k8sCli, err := GetKubernetesClients(kooperlog.Dummy)
+	if err != nil {
+		return err
+	}
+
+	version := dumpVersion{Version: Version, GoVersion: runtime.Version(), Platform: runtime.GOOS + "/" + runtime.GOARCH}
+	if info, err := k8sCli.Discovery().ServerVersion(); err != nil {
+		b.fail("version.json", fmt.Errorf("could not get the Kubernetes version: %s", err))
+	} else {
+		version.Kubernetes = info.GitVersion
+	}
+	b.add("version.json", version)
+
+	// The configuration is the one the operator resolves with the same config file
+	// and env vars, its warnings are not part of the bundle.
+	oconfig, err := operatorConfig(cmd, kooperlog.Dummy)
+	if err != nil {
+		b.fail("config.json", err)
+	} else {
+		b.add("config.json", effectiveConfig(oconfig))
+	}
+
+	if labelers, err := nlCli.LabelerV1alpha1().Labelers().List(metav1.ListOptions{}); err != nil {
+		b.fail("labelers.json", fmt.Errorf("could not list labelers: %s", err))
+	} else {
+		b.add("labelers.json", labelers.Items)
+	}
+
+	if oconfig.Status.Name != "" {
+		if st, err := dumpStatuses(k8sCli.CoreV1().ConfigMaps(oconfig.Status.Namespace), oconfig.Status.Name); err != nil {
+			b.fail("status.json", err)
+		} else {
+			b.add("status.json", st)
+		}
+	}
+
+	if summary, err := summarizeNodes(); err != nil {
+		b.fail("nodes.json", err)
+	} else {
+		b.add("nodes.json", summary)
+	}
+
+	if address != "" {
+		address = strings.TrimSuffix(address, "/")
+		client := &http.Client{Timeout: dumpTimeout}
+		if body, err := getBody(client, address+"/debug/mutations"); err != nil {
+			b.fail("mutations.json", err)
+		} else if mutations, err := redactMutations(body); err != nil {
+			b.fail("mutations.json", err)
+		} else {
+			b.add("mutations.json", mutations)
+		}
+		if body, err := getBody(client, address+"/metrics"); err != nil {
+			b.fail("metrics.txt", err)
+		} else {
+			b.add("metrics.txt", body)
+		}
+	}
+
+	if len(b.errors) > 0 {
+		b.add("errors.txt", []byte(strings.Join(b.errors, "\n")+"\n"))
+	}
+	if err := writeBundle(output, b, now); err != nil {
+		return err
+	}
+	fmt.Printf("diagnostic bundle written to %s (%d files)\n", output, len(b.names))
+	for _, e := range b.errors {
+		fmt.Fprintf(os.Stderr, "not collected %s\n", e)
+	}
+	return nil
+}
+
+// dumpStatuses returns the status published by every operator instance on the status
+// ConfigMap, the messages of the conditions with node values are redacted.
+func dumpStatuses(cms corev1client.ConfigMapInterface, name string) ([]dumpStatus, error) {
+	cm, err := cms.Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not get the status configmap: %s", err)
+	}
+	identities := make([]string, 0, len(cm.Data))
+	for id := range cm.Data {
+		identities = append(identities, id)
+	}
+	sort.Strings(identities)
+	statuses := make([]dumpStatus, 0, len(identities))
+	for _, id := range identities {
+		var st dumpStatus
+		if err := json.Unmarshal([]byte(cm.Data[id]), &st); err != nil {
+			return nil, fmt.Errorf("invalid status of %s: %s", id, err)
+		}
+		for i := range st.Conditions {
+			if st.Conditions[i].Type == labeler.ConditionValueValidationFailed {
+				st.Conditions[i].Message = redact(st.Conditions[i].Message)
+			}
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses, nil
+}
+
+// summarizeNodes explains the labelers on every node and counts the nodes by result,
+// without the node names nor their values.
+func summarizeNodes() (nodeSummary, error) {
+	nodeList, lcs, ownerAnnotation, err := loadPlanning()
+	if err != nil {
+		return nodeSummary{}, err
+	}
+	summary := nodeSummary{Nodes: len(nodeList.Items), Labelers: []labelerMatches{}}
+	byLabeler := map[string]map[string]int{}
+	for i := range nodeList.Items {
+		exp := labeler.ExplainNode(lcs, &nodeList.Items[i], ownerAnnotation)
+		for _, le := range exp.Labelers {
+			if byLabeler[le.Labeler] == nil {
+				byLabeler[le.Labeler] = map[string]int{}
+				summary.Labelers = append(summary.Labelers, labelerMatches{Labeler: le.Labeler, Results: byLabeler[le.Labeler]})
+			}
+			byLabeler[le.Labeler][le.Result]++
+		}
+	}
+	return summary, nil
+}
+
+// redactMutations returns the mutation history without the overwritten values.
+func redactMutations(body []byte) ([]labeler.Mutation, error) {
+	var mutations []labeler.Mutation
+	if err := json.Unmarshal(body, &mutations); err != nil {
+		return nil, fmt.Errorf("invalid mutation history: %s", err)
+	}
+	for i := range mutations {
+		for j := range mutations[i].Overwrites {
+			o := &mutations[i].Overwrites[j]
+			o.Previous, o.New = redact(o.Previous), redact(o.New)
+		}
+	}
+	return mutations, nil
+}
+
+// getBody returns the body of the URL, an error unless it responds OK.
+func getBody(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// writeBundle writes the files of the bundle to the tar.gz file, under a directory
+// named like it.
+func writeBundle(file string, b *dumpBundle, now time.Time) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	dir := strings.TrimSuffix(filepath.Base(file), ".tar.gz")
+	for _, name := range b.names {
+		data := b.files[name]
+		hdr := &tar.Header{Name: dir + "/" + name, Mode: 0644, Size: int64(len(data)), ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, buf.Bytes(), 0600)
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/joshisa/resource-labeler-operator/service/labeler"
+)
+
+var explainNodeCmd = &cobra.Command{
+	Use:   "explain-node <name>",
+	Short: "Explain how every labeler applies to a node",
+	Long: `explain-node reads the labelers and the nodes of the cluster and explains, for the
+given node, whether and why every labeler applies to it, the changes of every
+labeler, the conflicts with the existing values, the resulting labels and the
+final plan. Nothing is written to the cluster.`,
+
+	Args: cobra.ExactArgs(1),
+	RunE: runExplainNode,
+}
+
+func init() {
+	explainNodeCmd.Flags().StringP("output", "o", outputText, "The output format (text or json)")
+	explainNodeCmd.Flags().Bool("no-color", false, "Don't colorize the text output")
+	rootCmd.AddCommand(explainNodeCmd)
+}
+
+func runExplainNode(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	if output != outputText && output != outputJSON {
+		return fmt.Errorf("invalid output format %q, must be %s or %s", output, outputText, outputJSON)
+	}
+	noColor, _ := cmd.Flags().GetBool("no-color")
+	nodeList, lcs, ownerAnnotation, err := loadPlanning()
+	if err != nil {
+		return err
+	}
+
+	var exp *labeler.NodeExplanation
+	for i := range nodeList.Items {
+		if node := &nodeList.Items[i]; node.Name == args[0] {
+			e := labeler.ExplainNode(lcs, node, ownerAnnotation)
+			exp = &e
+			break
+		}
+	}
+	if exp == nil {
+		return fmt.Errorf("node %s not found", args[0])
+	}
+
+	if output == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(exp)
+	}
+	printExplanation(os.Stdout, exp, !noColor)
+	return nil
+}
+
+// printExplanation writes the node explanation as text.
+func printExplanation(w io.Writer, exp *labeler.NodeExplanation, color bool) {
+	fmt.Fprintf(w, "node %s\n", exp.Node)
+
+	fmt.Fprintln(w, "\nlabelers (applied in this order):")
+	if len(exp.Labelers) == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+	for _, le := range exp.Labelers {
+		fmt.Fprintf(w, "  %s: %s, %s\n", le.Labeler, le.Result, le.Reason)
+		for _, c := range le.Changes {
+			fmt.Fprintln(w, "    "+changeLine(c, color))
+		}
+	}
+
+	if len(exp.Conflicts) > 0 {
+		fmt.Fprintln(w, "\nconflicts (existing values are kept):")
+		for _, c := range exp.Conflicts {
+			by := "the node"
+			if c.KeptBy != "" {
+				by = c.KeptBy
+			}
+			fmt.Fprintf(w, "  %s: %s wants %q, kept %q set by %s\n", c.Key, c.Labeler, c.Wanted, c.Kept, by)
+		}
+	}
+
+	fmt.Fprintln(w, "\nlabels:")
+	keys := make([]string, 0, len(exp.Labels))
+	for k := range exp.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %s=%s\n", k, exp.Labels[k])
+	}
+
+	fmt.Fprintln(w, "\nplan:")
+	if len(exp.Plan) == 0 {
+		fmt.Fprintln(w, "  in sync, nothing to change")
+	}
+	for _, c := range exp.Plan {
+		fmt.Fprintln(w, "  "+changeLine(c, color))
+	}
+}
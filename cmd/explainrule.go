@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	kooperlog "github.com/spotahome/kooper/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/tools/cache"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+	"github.com/joshisa/resource-labeler-operator/service/labeler"
+)
+
+var explainRuleCmd = &cobra.Command{
+	Use:   "explain-rule --rule <file> --nodes <file>",
+	Short: "Explain how labelers apply to node fixtures, without a cluster",
+	Long: `explain-rule reads labelers and nodes from YAML or JSON files, instead of the
+cluster, and explains for every node like explain-node whether and why every
+labeler applies to it, its changes, the resulting labels and the final plan.
+The files can have several documents and lists (e.g. a NodeList).`,
+
+	RunE: runExplainRule,
+}
+
+func init() {
+	explainRuleCmd.Flags().String("rule", "", "The file with the labelers")
+	explainRuleCmd.Flags().String("nodes", "", "The file with the node fixtures")
+	explainRuleCmd.Flags().StringP("output", "o", outputText, "The output format (text or json)")
+	explainRuleCmd.Flags().Bool("no-color", false, "Don't colorize the text output")
+	rootCmd.AddCommand(explainRuleCmd)
+}
+
+func runExplainRule(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	if output != outputText && output != outputJSON {
+		return fmt.Errorf("invalid output format %q, must be %s or %s", output, outputText, outputJSON)
+	}
+	noColor, _ := cmd.Flags().GetBool("no-color")
+	ruleFile, _ := cmd.Flags().GetString("rule")
+	nodesFile, _ := cmd.Flags().GetString("nodes")
+	if ruleFile == "" || nodesFile == "" {
+		return fmt.Errorf("--rule and --nodes are required")
+	}
+
+	lcfg, err := planningConfig()
+	if err != nil {
+		return err
+	}
+	var labelers []*labelerv1alpha1.Labeler
+	err = decodeObjects(ruleFile, func(raw []byte) error {
+		l := &labelerv1alpha1.Labeler{}
+		if err := json.Unmarshal(raw, l); err != nil {
+			return err
+		}
+		labelers = append(labelers, l)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(labelers) == 0 {
+		return fmt.Errorf("no labelers in %s", ruleFile)
+	}
+	nodes := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	var nodeList []*corev1.Node
+	err = decodeObjects(nodesFile, func(raw []byte) error {
+		node := &corev1.Node{}
+		if err := json.Unmarshal(raw, node); err != nil {
+			return err
+		}
+		if node.Name == "" {
+			return fmt.Errorf("node without name")
+		}
+		nodeList = append(nodeList, node)
+		return nodes.Add(node)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Plan the labelers in the same order as the operator.
+	labeler.SortLabelers(labelers, lcfg.ConflictTiebreak)
+	var lcs []*labeler.LabelController
+	for _, l := range labelers {
+		if err := validatePlanning(l); err != nil {
+			return err
+		}
+		lcs = append(lcs, labeler.NewLabelController(lcfg, l, nodes, kooperlog.Dummy))
+	}
+	for _, r := range labeler.RedundantLabelers(lcs) {
+		fmt.Fprintf(os.Stderr, "note: %s\n", r)
+	}
+
+	exps := []labeler.NodeExplanation{}
+	for _, node := range nodeList {
+		exps = append(exps, labeler.ExplainNode(lcs, node, lcfg.OwnerAnnotation))
+	}
+
+	if output == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(exps)
+	}
+	for i := range exps {
+		if i > 0 {
+			fmt.Fprintln(os.Stdout)
+		}
+		printExplanation(os.Stdout, &exps[i], !noColor)
+	}
+	return nil
+}
+
+// decodeObjects calls fn with the JSON of every object of the YAML or JSON documents
+// of the file, the items of the lists are decoded as objects.
+func decodeObjects(file string, fn func(raw []byte) error) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := yaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("could not decode %s: %s", file, err)
+		}
+		if len(raw) == 0 || string(raw) == "null" {
+			continue
+		}
+
+		var list struct {
+			Kind  string            `json:"kind"`
+			Items []json.RawMessage `json:"items"`
+		}
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return fmt.Errorf("could not decode %s: %s", file, err)
+		}
+		items := []json.RawMessage{raw}
+		if strings.HasSuffix(list.Kind, "List") {
+			items = list.Items
+		}
+		for _, item := range items {
+			if err := fn(item); err != nil {
+				return fmt.Errorf("could not decode %s: %s", file, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/joshisa/resource-labeler-operator/service/labeler"
+)
+
+const ruleFixture = `apiVersion: labeler.cfmr.site/v1alpha1
+kind: Labeler
+metadata:
+  name: gpu
+spec:
+  nodeSelectorTerms:
+  - matchExpressions:
+    - key: pool
+      operator: In
+      values: [gpu]
+  merge:
+    labels:
+      accelerator: "true"
+`
+
+const nodesFixture = `apiVersion: v1
+kind: NodeList
+items:
+- apiVersion: v1
+  kind: Node
+  metadata:
+    name: n1
+    labels:
+      pool: gpu
+- apiVersion: v1
+  kind: Node
+  metadata:
+    name: n2
+    labels:
+      pool: cpu
+---
+apiVersion: v1
+kind: Node
+metadata:
+  name: n3
+  labels:
+    pool: gpu
+    accelerator: "true"
+`
+
+// writeFixture writes the fixture in the directory and returns its path.
+func writeFixture(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDecodeObjects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "explain-rule")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var names []string
+	err = decodeObjects(writeFixture(t, dir, "nodes.yaml", nodesFixture), func(raw []byte) error {
+		var obj struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		}
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return err
+		}
+		names = append(names, obj.Metadata.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"n1", "n2", "n3"}; !reflect.DeepEqual(names, exp) {
+		t.Errorf("expected the items of the list and the documents %v, got %v", exp, names)
+	}
+
+	if err := decodeObjects(writeFixture(t, dir, "invalid.yaml", "kind: [Node"), func([]byte) error { return nil }); err == nil {
+		t.Errorf("expected an invalid file rejected")
+	}
+}
+
+func TestRunExplainRule(t *testing.T) {
+	dir, err := ioutil.TempDir("", "explain-rule")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	explainRuleCmd.Flags().Set("rule", writeFixture(t, dir, "rule.yaml", ruleFixture))
+	explainRuleCmd.Flags().Set("nodes", writeFixture(t, dir, "nodes.yaml", nodesFixture))
+	explainRuleCmd.Flags().Set("output", outputJSON)
+
+	// The explanations are printed on the standard output.
+	out, err := os.Create(filepath.Join(dir, "out.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = out
+	err = runExplainRule(explainRuleCmd, nil)
+	os.Stdout = stdout
+	out.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exps []labeler.NodeExplanation
+	if err := json.Unmarshal(b, &exps); err != nil {
+		t.Fatalf("could not decode the explanations %s: %s", b, err)
+	}
+
+	exp := map[string]struct {
+		result string
+		plan   []labeler.Change
+	}{
+		"n1": {result: labeler.ExplainChanges, plan: []labeler.Change{{Key: "labels/accelerator", Operation: labeler.ChangeAdd, New: "true"}}},
+		"n2": {result: labeler.ExplainNotSelected, plan: []labeler.Change{}},
+		"n3": {result: labeler.ExplainInSync, plan: []labeler.Change{}},
+	}
+	if len(exps) != len(exp) {
+		t.Fatalf("expected an explanation by node fixture, got %+v", exps)
+	}
+	for _, e := range exps {
+		want := exp[e.Node]
+		if len(e.Labelers) != 1 || e.Labelers[0].Result != want.result {
+			t.Errorf("%s: expected the labeler result %s, got %+v", e.Node, want.result, e.Labelers)
+		}
+		if plan := append([]labeler.Change{}, e.Plan...); !reflect.DeepEqual(plan, want.plan) {
+			t.Errorf("%s: expected the plan %+v, got %+v", e.Node, want.plan, e.Plan)
+		}
+	}
+}
@@ -2,16 +2,30 @@ package cmd
 
 import (
 	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
 
 	apiextensionscli "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/spf13/viper"
 	"github.com/spotahome/kooper/client/crd"
 
+	apilabeler "github.com/joshisa/resource-labeler-operator/apis/labeler"
 	labelerk8scli "github.com/joshisa/resource-labeler-operator/client/k8s/clientset/versioned"
+	"github.com/joshisa/resource-labeler-operator/cloudevents"
+	"github.com/joshisa/resource-labeler-operator/desiredstate"
 	"github.com/joshisa/resource-labeler-operator/log"
+	"github.com/joshisa/resource-labeler-operator/metrics"
+	"github.com/joshisa/resource-labeler-operator/operator"
+	"github.com/joshisa/resource-labeler-operator/service/labeler"
+	"github.com/joshisa/resource-labeler-operator/status"
 )
 
 // GetKubernetesClients returns all the required clients to communicate with
@@ -44,3 +58,544 @@ func GetKubernetesClients(logger log.Logger) (labelerk8scli.Interface, crd.Inter
 
 	return nlCli, crdCli, k8sCli, nil
 }
+
+// GetZoneClients returns the kubernetes core types clients of the zone API servers,
+// with the configuration of the default one on another host.
+func GetZoneClients(servers map[string]string) (map[string]kubernetes.Interface, error) {
+	if len(servers) == 0 {
+		return nil, nil
+	}
+	cfg, err := clientcmd.BuildConfigFromFlags(viper.GetString("master"), viper.GetString("kubeconfig"))
+	if err != nil {
+		return nil, fmt.Errorf("could not load configuration: %s", err)
+	}
+
+	clients := make(map[string]kubernetes.Interface, len(servers))
+	for zone, host := range servers {
+		zcfg := rest.CopyConfig(cfg)
+		zcfg.Host = host
+		cli, err := kubernetes.NewForConfig(zcfg)
+		if err != nil {
+			return nil, fmt.Errorf("zone %s API server %s: %s", zone, host, err)
+		}
+		clients[zone] = cli
+	}
+	return clients, nil
+}
+
+// GetLeaseClient returns the kubernetes core types client of the leader lease calls,
+// its requests time out.
+func GetLeaseClient(timeout time.Duration) (kubernetes.Interface, error) {
+	cfg, err := clientcmd.BuildConfigFromFlags(viper.GetString("master"), viper.GetString("kubeconfig"))
+	if err != nil {
+		return nil, fmt.Errorf("could not load configuration: %s", err)
+	}
+	cfg.Timeout = timeout
+	return kubernetes.NewForConfig(cfg)
+}
+
+// logEffectiveConfig logs once the configuration the operator resolved from
+// flags, environment and config file. Sensitive values are redacted.
+func logEffectiveConfig(logger log.Logger, cfg operator.Config) {
+	log.InfoFields(logger, "effective configuration", effectiveConfig(cfg))
+}
+
+// effectiveConfig returns the configuration by flag name, with the sensitive values
+// redacted.
+func effectiveConfig(cfg operator.Config) map[string]interface{} {
+	return map[string]interface{}{
+		"config-file":                     viper.ConfigFileUsed(),
+		"kubeconfig":                      redact(viper.GetString("kubeconfig")),
+		"master":                          viper.GetString("master"),
+		"log-format":                      viper.GetString("log-format"),
+		"log-level":                       viper.GetString("log-level"),
+		"resync-seconds":                  int(cfg.ResyncPeriod / time.Second),
+		"resync-jitter":                   cfg.ResyncJitter,
+		"labeler-versions":                cfg.LabelerVersions,
+		"report-redundant-labelers":       cfg.ReportRedundant,
+		"orphan-policy":                   cfg.OrphanPolicy,
+		"backpressure-high-water":         cfg.BackpressureHighWater,
+		"backpressure-low-water":          cfg.BackpressureLowWater,
+		"orphan-sweep-interval":           cfg.OrphanSweepInterval.String(),
+		"workers":                         cfg.Workers,
+		"max-workers":                     cfg.MaxWorkers,
+		"spread-initial-reconcile":        cfg.SpreadInitialReconcile.String(),
+		"audit-interval":                  cfg.AuditInterval.String(),
+		"log-noop":                        cfg.LogNoop,
+		"max-changes-per-pass":            cfg.MaxChangesPerPass,
+		"max-unavailable-per-zone":        cfg.MaxUnavailablePerZone,
+		"zone-disruption-window":          cfg.ZoneDisruptionWindow.String(),
+		"zone-label":                      cfg.ZoneLabel,
+		"zone-apiserver":                  cfg.ZoneAPIServers,
+		"audit-start":                     viper.GetString("audit-start"),
+		"taint-eviction-report":           cfg.TaintEvictionReport,
+		"dry-run":                         cfg.DryRun,
+		"require-apply-trigger":           cfg.RequireApplyTrigger,
+		"max-blast-radius":                cfg.MaxBlastRadius,
+		"watch-pods":                      cfg.WatchPods,
+		"watch-references":                cfg.WatchReferences,
+		"watch-node-leases":               cfg.WatchNodeLeases,
+		"watch-scheduling-failures":       cfg.WatchSchedulingFailures,
+		"max-annotation-bytes":            cfg.AnnotationsGuardBytes,
+		"max-patch-bytes":                 cfg.MaxPatchBytes,
+		"verify-idempotent":               cfg.VerifyIdempotent,
+		"index-nodes":                     cfg.IndexNodes,
+		"event-qps":                       cfg.EventQPS,
+		"event-burst":                     cfg.EventBurst,
+		"skip-draining-nodes":             cfg.SkipDrainingNodes,
+		"draining-requeue":                cfg.DrainingRequeue.String(),
+		"self-node-only":                  cfg.NodeName != "",
+		"node-name":                       cfg.NodeName,
+		"content-hash":                    cfg.ContentHash,
+		"stamp-applied":                   cfg.AppliedBy,
+		"fingerprint-annotation":          cfg.FingerprintAnnotation,
+		"patch-type":                      cfg.PatchType,
+		"allow-reserved":                  cfg.AllowReserved,
+		"match-label-allowlist":           cfg.MatchLabelAllowlist,
+		"protect-keys":                    cfg.ProtectKeys,
+		"allowed-taint-effects":           cfg.AllowedTaintEffects,
+		"http-source-hosts":               cfg.HTTPSourceHosts,
+		"http-source-secrets":             cfg.HTTPSourceSecrets,
+		"combine-policy":                  cfg.CombinePolicy,
+		"conflict-tiebreak":               cfg.ConflictTiebreak,
+		"node-group-label":                viper.GetStringSlice("node-group-label"),
+		"error-circuit-threshold":         cfg.ErrorCircuitThreshold,
+		"error-circuit-window":            cfg.ErrorCircuitWindow.String(),
+		"state-cache-size":                cfg.StateCacheSize,
+		"no-matches-window":               cfg.NoMatchesWindow.String(),
+		"spec-history-size":               cfg.SpecHistorySize,
+		"retry-policies":                  effectiveRetryPolicies(cfg.RetryPolicies),
+		"crash-on-panic":                  cfg.CrashOnPanic,
+		"watch-timeout":                   cfg.WatchTimeout.String(),
+		"listen-address":                  cfg.ListenAddress,
+		"metrics-tls-cert":                redact(cfg.ListenTLS.CertFile),
+		"metrics-tls-key":                 redact(cfg.ListenTLS.KeyFile),
+		"metrics-client-ca":               redact(cfg.ListenTLS.ClientCAFile),
+		"metrics-namespace":               cfg.Metrics.Namespace,
+		"metrics-subsystem":               cfg.Metrics.Subsystem,
+		"metrics-instance":                cfg.Metrics.Instance,
+		"labeler-metrics-labels":          cfg.Metrics.LabelerLabels,
+		"labeler-metrics-labels-limit":    cfg.MetricsLabelsLimit,
+		"enable-events-stream":            cfg.EventsStream,
+		"watch-output":                    viper.GetString("watch-output"),
+		"cloudevents-sink":                redactURL(cfg.CloudEvents.Sink),
+		"enable-debug-endpoints":          cfg.DebugEndpoints,
+		"mutation-history-size":           cfg.MutationHistorySize,
+		"webhook-address":                 cfg.Webhook.Address,
+		"webhook-tls-cert":                redact(cfg.Webhook.CertFile),
+		"webhook-tls-key":                 redact(cfg.Webhook.KeyFile),
+		"webhook-what-if":                 cfg.Webhook.WhatIf,
+		"delete-protection-threshold":     cfg.Webhook.DeleteProtectionThreshold,
+		"publish-status-configmap":        viper.GetString("publish-status-configmap"),
+		"freeze-until":                    viper.GetString("freeze-until"),
+		"freeze-configmap":                viper.GetString("freeze-configmap"),
+		"kill-switch-configmap":           viper.GetString("kill-switch-configmap"),
+		"leader-lease-configmap":          viper.GetString("leader-lease-configmap"),
+		"leader-lease-duration":           cfg.LeaseDuration.String(),
+		"prewarm":                         cfg.Prewarm,
+		"publish-status-interval":         viper.GetDuration("publish-status-interval").String(),
+		"status-update-interval":          viper.GetDuration("status-update-interval").String(),
+		"publish-desired-state-configmap": viper.GetString("publish-desired-state-configmap"),
+		"publish-desired-state-interval":  viper.GetDuration("publish-desired-state-interval").String(),
+		"managed-prefix":                  cfg.ManagedPrefix,
+		"owner-annotation":                cfg.OwnerAnnotation,
+		"requeue-on-managed-annotations":  cfg.RequeueOnManagedAnnotations,
+	}
+}
+
+// managedAnnotations returns the validated prefix of the operator annotations and
+// the owner annotation, by default under the prefix.
+func managedAnnotations() (string, string, error) {
+	prefix := viper.GetString("managed-prefix")
+	if errs := validation.IsDNS1123Subdomain(prefix); len(errs) > 0 {
+		return "", "", fmt.Errorf("invalid --managed-prefix %q, it must be a label prefix: %s", prefix, strings.Join(errs, ", "))
+	}
+
+	owner := viper.GetString("owner-annotation")
+	if owner == "" {
+		owner = apilabeler.Annotation(prefix, apilabeler.OwnedKeysAnnotationName)
+	}
+	if errs := validation.IsQualifiedName(owner); len(errs) > 0 {
+		return "", "", fmt.Errorf("invalid --owner-annotation %q: %s", owner, strings.Join(errs, ", "))
+	}
+	return prefix, owner, nil
+}
+
+// fingerprintAnnotation returns the validated --fingerprint-annotation, empty if not
+// set.
+func fingerprintAnnotation() (string, error) {
+	annotation := viper.GetString("fingerprint-annotation")
+	if annotation == "" {
+		return "", nil
+	}
+	if errs := validation.IsQualifiedName(annotation); len(errs) > 0 {
+		return "", fmt.Errorf("invalid --fingerprint-annotation %q: %s", annotation, strings.Join(errs, ", "))
+	}
+	return annotation, nil
+}
+
+// registerNodeGroupLabels registers the provider=key node group labels of the
+// --node-group-label flags, after the built-in ones.
+func registerNodeGroupLabels() error {
+	for _, ngl := range viper.GetStringSlice("node-group-label") {
+		parts := strings.SplitN(ngl, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid --node-group-label %q, must be provider=key", ngl)
+		}
+		if err := labeler.RegisterNodeGroupLabel(parts[0], parts[1]); err != nil {
+			return fmt.Errorf("invalid --node-group-label: %s", err)
+		}
+	}
+	return nil
+}
+
+// combinePolicy returns the --combine-policy, an error if it's not a known policy.
+func combinePolicy() (string, error) {
+	switch p := viper.GetString("combine-policy"); p {
+	case labeler.CombineUnion, labeler.CombineStrict:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid --combine-policy %q, must be %s or %s", p, labeler.CombineUnion, labeler.CombineStrict)
+	}
+}
+
+// conflictTiebreak returns the --conflict-tiebreak, an error if it's not a known
+// tiebreak.
+func conflictTiebreak() (string, error) {
+	t := viper.GetString("conflict-tiebreak")
+	for _, known := range labeler.Tiebreaks {
+		if t == known {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("invalid --conflict-tiebreak %q, must be one of %s", t, strings.Join(labeler.Tiebreaks, ", "))
+}
+
+// metricsLabelName are the valid Prometheus label names.
+var metricsLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// labelerMetricsLabels returns the --labeler-metrics-labels, an error if one is not a
+// valid label name or clashes with the labels the metrics already have.
+func labelerMetricsLabels() ([]string, error) {
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range viper.GetStringSlice("labeler-metrics-labels") {
+		name = strings.TrimSpace(name)
+		switch {
+		case !metricsLabelName.MatchString(name) || strings.HasPrefix(name, "__"):
+			return nil, fmt.Errorf("invalid --labeler-metrics-labels %q, it's not a valid metrics label name", name)
+		case name == "labeler" || name == "result" || name == "manager" || name == metrics.InstanceLabel:
+			return nil, fmt.Errorf("invalid --labeler-metrics-labels %q, the metrics already have the label", name)
+		case seen[name]:
+			return nil, fmt.Errorf("duplicated --labeler-metrics-labels %q", name)
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// backpressureMarks returns the --backpressure-high-water and --backpressure-low-water,
+// the low-water mark defaults to half of the high-water one.
+func backpressureMarks() (int, int, error) {
+	high, low := viper.GetInt("backpressure-high-water"), viper.GetInt("backpressure-low-water")
+	switch {
+	case high < 0 || low < 0:
+		return 0, 0, fmt.Errorf("--backpressure-high-water and --backpressure-low-water must not be negative")
+	case high == 0 && low > 0:
+		return 0, 0, fmt.Errorf("--backpressure-low-water requires --backpressure-high-water")
+	case high == 0:
+		return 0, 0, nil
+	case low == 0:
+		low = high / 2
+	}
+	if low >= high {
+		return 0, 0, fmt.Errorf("--backpressure-low-water %d must be lower than --backpressure-high-water %d", low, high)
+	}
+	return high, low, nil
+}
+
+// orphanPolicy returns the --orphan-policy, an error if it's not a known policy.
+func orphanPolicy() (string, error) {
+	p := viper.GetString("orphan-policy")
+	for _, known := range labeler.OrphanPolicies {
+		if p == known {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("invalid --orphan-policy %q, must be one of %s", p, strings.Join(labeler.OrphanPolicies, ", "))
+}
+
+// patchType returns the --patch-type, an error if it's not a known patch type.
+func patchType() (string, error) {
+	t := viper.GetString("patch-type")
+	for _, known := range labeler.PatchTypes {
+		if t == known {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("invalid --patch-type %q, must be one of %s", t, strings.Join(labeler.PatchTypes, ", "))
+}
+
+// zoneAPIServers returns the --zone-apiserver URLs by zone, an error if a zone is
+// repeated or a URL is not an http(s) one.
+func zoneAPIServers() (map[string]string, error) {
+	servers := map[string]string{}
+	for _, kv := range viper.GetStringSlice("zone-apiserver") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid --zone-apiserver %q, must be zone=URL", kv)
+		}
+		if _, ok := servers[parts[0]]; ok {
+			return nil, fmt.Errorf("invalid --zone-apiserver %q, zone %s repeated", kv, parts[0])
+		}
+		u, err := url.Parse(parts[1])
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid --zone-apiserver %q, the URL must be an http(s) one", kv)
+		}
+		servers[parts[0]] = parts[1]
+	}
+	return servers, nil
+}
+
+// retryPolicies returns the --retry-policies by error class, an error if a class or a
+// policy is not known.
+func retryPolicies() (map[string]string, error) {
+	policies := map[string]string{}
+	for _, kv := range viper.GetStringSlice("retry-policies") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || !contains(labeler.ErrorClasses, parts[0]) || !contains(labeler.RetryPolicies, parts[1]) {
+			return nil, fmt.Errorf("invalid --retry-policies %q, must be class=policy with the classes %s and the policies %s",
+				kv, strings.Join(labeler.ErrorClasses, ", "), strings.Join(labeler.RetryPolicies, ", "))
+		}
+		policies[parts[0]] = parts[1]
+	}
+	return policies, nil
+}
+
+// effectiveRetryPolicies returns the retry policies of every error class, with the
+// defaults of the classes not set, as class=policy.
+func effectiveRetryPolicies(policies map[string]string) []string {
+	var effective []string
+	for _, class := range labeler.ErrorClasses {
+		policy, ok := policies[class]
+		if !ok {
+			policy = labeler.DefaultRetryPolicies[class]
+		}
+		effective = append(effective, class+"="+policy)
+	}
+	return effective
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedTaintEffects returns the --allowed-taint-effects, they must be taint effects.
+func allowedTaintEffects() ([]string, error) {
+	effects := viper.GetStringSlice("allowed-taint-effects")
+	if len(effects) == 0 {
+		return nil, fmt.Errorf("--allowed-taint-effects needs at least one effect of %s", strings.Join(labeler.TaintEffects, ", "))
+	}
+	valid := map[string]bool{}
+	for _, e := range labeler.TaintEffects {
+		valid[e] = true
+	}
+	for _, e := range effects {
+		if !valid[e] {
+			return nil, fmt.Errorf("invalid --allowed-taint-effects %q, must be one of %s", e, strings.Join(labeler.TaintEffects, ", "))
+		}
+	}
+	return effects, nil
+}
+
+// freezeConfig returns the static freeze end of --freeze-until and the namespace and
+// name of the --freeze-configmap.
+func freezeConfig() (time.Time, string, string, error) {
+	var until time.Time
+	if v := viper.GetString("freeze-until"); v != "" {
+		var err error
+		if until, err = time.Parse(time.RFC3339, v); err != nil {
+			return until, "", "", fmt.Errorf("invalid --freeze-until %q, it must be a RFC3339 time", v)
+		}
+	}
+
+	cm := viper.GetString("freeze-configmap")
+	if cm == "" {
+		return until, "", "", nil
+	}
+	parts := strings.Split(cm, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return until, "", "", fmt.Errorf("invalid --freeze-configmap %q, it must be namespace/name", cm)
+	}
+	return until, parts[0], parts[1], nil
+}
+
+// killSwitchConfig returns the namespace and name of the --kill-switch-configmap.
+func killSwitchConfig() (string, string, error) {
+	cm := viper.GetString("kill-switch-configmap")
+	if cm == "" {
+		return "", "", nil
+	}
+	parts := strings.Split(cm, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid --kill-switch-configmap %q, it must be namespace/name", cm)
+	}
+	return parts[0], parts[1], nil
+}
+
+// watchOutputTable is the --watch-output redrawing the recent mutations.
+const watchOutputTable = "table"
+
+// watchTable returns true if the --watch-output is the table, the logs can't be JSON
+// then: the table is for humans at a terminal.
+func watchTable() (bool, error) {
+	switch output := viper.GetString("watch-output"); output {
+	case "":
+		return false, nil
+	case watchOutputTable:
+		if viper.GetString("log-format") == log.FormatJSON {
+			return false, fmt.Errorf("--watch-output %s can't be used with --log-format %s", watchOutputTable, log.FormatJSON)
+		}
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid --watch-output %q, must be %s", output, watchOutputTable)
+	}
+}
+
+// leaderLeaseConfig returns the namespace and name of the --leader-lease-configmap.
+func leaderLeaseConfig() (string, string, error) {
+	cm := viper.GetString("leader-lease-configmap")
+	if cm == "" {
+		return "", "", nil
+	}
+	parts := strings.Split(cm, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid --leader-lease-configmap %q, it must be namespace/name", cm)
+	}
+	return parts[0], parts[1], nil
+}
+
+// auditConfig returns the node audit interval and the time the audits are aligned to,
+// the audit start time of day of the now day.
+func auditConfig(now time.Time) (time.Duration, time.Time, error) {
+	interval := viper.GetDuration("audit-interval")
+	if interval < 0 {
+		return 0, time.Time{}, fmt.Errorf("--audit-interval can't be negative, got %s", interval)
+	}
+	v := viper.GetString("audit-start")
+	if v == "" || interval == 0 {
+		return interval, time.Time{}, nil
+	}
+	tod, err := time.Parse("15:04", v)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("invalid --audit-start %q, it must be a HH:MM time of day", v)
+	}
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), now.Day(), tod.Hour(), tod.Minute(), 0, 0, time.UTC)
+	return interval, start, nil
+}
+
+// statusConfig returns the status publisher configuration, the operator instance is
+// identified by its hostname (the pod name in the cluster).
+func statusConfig() (status.Config, error) {
+	cm := viper.GetString("publish-status-configmap")
+	if cm == "" {
+		return status.Config{}, nil
+	}
+
+	parts := strings.Split(cm, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return status.Config{}, fmt.Errorf("invalid --publish-status-configmap %q, it must be namespace/name", cm)
+	}
+	identity, err := os.Hostname()
+	if err != nil {
+		return status.Config{}, fmt.Errorf("could not get the operator identity: %s", err)
+	}
+	interval := viper.GetDuration("publish-status-interval")
+	if interval <= 0 {
+		return status.Config{}, fmt.Errorf("--publish-status-interval must be positive, got %s", interval)
+	}
+	updateInterval := viper.GetDuration("status-update-interval")
+	if updateInterval < 0 {
+		return status.Config{}, fmt.Errorf("--status-update-interval must not be negative, got %s", updateInterval)
+	}
+
+	return status.Config{
+		Namespace:      parts[0],
+		Name:           parts[1],
+		Identity:       identity,
+		Interval:       interval,
+		UpdateInterval: updateInterval,
+	}, nil
+}
+
+// cloudEventsConfig returns the CloudEvents sender configuration.
+func cloudEventsConfig() (cloudevents.Config, error) {
+	sink := viper.GetString("cloudevents-sink")
+	if sink == "" {
+		return cloudevents.Config{}, nil
+	}
+
+	u, err := url.Parse(sink)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return cloudevents.Config{}, fmt.Errorf("invalid --cloudevents-sink %q, it must be an http(s) URL", sink)
+	}
+
+	return cloudevents.Config{
+		Sink:   sink,
+		Source: appName,
+	}, nil
+}
+
+// desiredStateConfig returns the desired state publisher configuration.
+func desiredStateConfig() (desiredstate.Config, error) {
+	cm := viper.GetString("publish-desired-state-configmap")
+	if cm == "" {
+		return desiredstate.Config{}, nil
+	}
+
+	parts := strings.Split(cm, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return desiredstate.Config{}, fmt.Errorf("invalid --publish-desired-state-configmap %q, it must be namespace/name", cm)
+	}
+	interval := viper.GetDuration("publish-desired-state-interval")
+	if interval <= 0 {
+		return desiredstate.Config{}, fmt.Errorf("--publish-desired-state-interval must be positive, got %s", interval)
+	}
+
+	return desiredstate.Config{
+		Namespace: parts[0],
+		Name:      parts[1],
+		Interval:  interval,
+	}, nil
+}
+
+// redact hides a sensitive value, it keeps the information of the value being set or not.
+func redact(v string) string {
+	if v == "" {
+		return ""
+	}
+	return "<redacted>"
+}
+
+// redactURL returns the URL without its user info and query, they may hold
+// credentials.
+func redactURL(v string) string {
+	u, err := url.Parse(v)
+	if err != nil {
+		return redact(v)
+	}
+	if u.User != nil {
+		u.User = url.User("redacted")
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = "redacted"
+	}
+	return u.String()
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/joshisa/resource-labeler-operator/log"
+)
+
+// watchKubeconfig notifies on changedC every time the kubeconfig file changes until
+// stopC is closed. The directory is watched so files replaced by a rename (like the
+// mounted secrets) are also detected.
+func watchKubeconfig(path string, changedC chan<- struct{}, stopC <-chan struct{}, logger log.Logger) error {
+	path = filepath.Clean(path)
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := w.Add(filepath.Dir(path)); err != nil {
+		w.Close()
+		return err
+	}
+
+	go func() {
+		defer w.Close()
+		for {
+			select {
+			case ev := <-w.Events:
+				name := filepath.Clean(ev.Name)
+				if name != path && !strings.HasPrefix(filepath.Base(name), "..data") {
+					continue
+				}
+				// Coalesce bursts of events in a single notification.
+				select {
+				case changedC <- struct{}{}:
+				default:
+				}
+			case err := <-w.Errors:
+				logger.Warningf("error watching kubeconfig: %s", err)
+			case <-stopC:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/spf13/cobra"
+	kooperlog "github.com/spotahome/kooper/log"
+
+	"github.com/joshisa/resource-labeler-operator/service/labeler"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Move the node labels of a legacy tool to new keys owned by a labeler",
+	Long: `migrate reads a mapping of legacy label keys to new keys, with optional value
+maps and transforms, and moves the labels of every node. The migrated keys are
+stamped as owned by --labeler, so its reconciles manage them afterwards. Without
+--confirm the changes are only shown.`,
+
+	RunE: runMigrate,
+}
+
+// migrationFile is the mapping file of the migrate command.
+type migrationFile struct {
+	Migrations []labeler.Migration `json:"migrations"`
+}
+
+func init() {
+	migrateCmd.Flags().StringP("mapping", "f", "", "The YAML or JSON file of the migrations")
+	migrateCmd.Flags().String("labeler", "", "The labeler owning the migrated keys")
+	migrateCmd.Flags().StringP("selector", "l", "", "Only migrate the nodes matching the label selector")
+	migrateCmd.Flags().Bool("confirm", false, "Write the changes, they are only shown otherwise")
+	migrateCmd.Flags().Bool("no-color", false, "Don't colorize the text output")
+	rootCmd.AddCommand(migrateCmd)
+}
+
+func runMigrate(cmd *cobra.Command, args []string) error {
+	file, _ := cmd.Flags().GetString("mapping")
+	owner, _ := cmd.Flags().GetString("labeler")
+	selector, _ := cmd.Flags().GetString("selector")
+	confirm, _ := cmd.Flags().GetBool("confirm")
+	noColor, _ := cmd.Flags().GetBool("no-color")
+	if file == "" || owner == "" {
+		return fmt.Errorf("--mapping and --labeler are required")
+	}
+	migrations, err := readMigrations(file)
+	if err != nil {
+		return err
+	}
+	_, ownerAnnotation, err := managedAnnotations()
+	if err != nil {
+		return err
+	}
+
+	nlCli, _, k8sCli, err := GetKubernetesClients(kooperlog.Dummy)
+	if err != nil {
+		return err
+	}
+	if _, err := nlCli.LabelerV1alpha1().Labelers().Get(owner, metav1.GetOptions{}); err != nil {
+		return fmt.Errorf("could not get labeler %s: %s", owner, err)
+	}
+	nodeList, err := k8sCli.CoreV1().Nodes().List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("could not list nodes: %s", err)
+	}
+
+	sort.Slice(nodeList.Items, func(i, j int) bool { return nodeList.Items[i].Name < nodeList.Items[j].Name })
+	diffs := []nodeDiff{}
+	failed := 0
+	for i := range nodeList.Items {
+		node := &nodeList.Items[i]
+		migrated, skipped := labeler.MigrateNode(node, migrations, ownerAnnotation, owner)
+		for _, s := range skipped {
+			fmt.Fprintf(os.Stderr, "node %s: skipping %s\n", node.Name, s)
+		}
+		changes := labeler.Diff(node, migrated, ownerAnnotation)
+		if len(changes) == 0 {
+			continue
+		}
+		diffs = append(diffs, nodeDiff{Node: node.Name, Changes: changes})
+		if !confirm {
+			continue
+		}
+
+		patch, err := labeler.NodeMergePatch(node, migrated)
+		if err == nil {
+			_, err = k8sCli.CoreV1().Nodes().Patch(node.Name, types.MergePatchType, patch)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not migrate node %s: %s\n", node.Name, err)
+			failed++
+		}
+	}
+
+	if len(diffs) == 0 {
+		fmt.Println("No labels to migrate")
+		return nil
+	}
+	printDiffs(os.Stdout, diffs, !noColor)
+	if !confirm {
+		fmt.Printf("\n%d nodes would be migrated, run with --confirm to write them\n", len(diffs))
+		return nil
+	}
+	fmt.Printf("\n%d nodes migrated\n", len(diffs)-failed)
+	if failed > 0 {
+		return fmt.Errorf("%d nodes could not be migrated", failed)
+	}
+	return nil
+}
+
+// readMigrations returns the valid migrations of the mapping file.
+func readMigrations(file string) ([]labeler.Migration, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var mf migrationFile
+	if err := yaml.NewYAMLOrJSONDecoder(f, 4096).Decode(&mf); err != nil {
+		return nil, fmt.Errorf("could not decode %s: %s", file, err)
+	}
+	if len(mf.Migrations) == 0 {
+		return nil, fmt.Errorf("%s has no migrations", file)
+	}
+	if err := labeler.ValidateMigrations(mf.Migrations); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	return mf.Migrations, nil
+}
@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+	"github.com/joshisa/resource-labeler-operator/operator"
+)
+
+// RBAC scopes.
+const (
+	scopeCluster   = "cluster"
+	scopeNamespace = "namespace"
+)
+
+var genRBACCmd = &cobra.Command{
+	Use:   "gen-rbac",
+	Short: "Print the RBAC manifests the operator needs with the given features",
+	Long: `gen-rbac prints the minimal ClusterRole, Roles and bindings the operator needs
+with the features enabled by the given flags (they are the same flags as the
+operator ones). With --scope namespace the namespaced resources are granted by
+Roles on their namespaces, the cluster-scoped ones always need a ClusterRole.`,
+
+	RunE: runGenRBAC,
+}
+
+func init() {
+	genRBACCmd.Flags().String("scope", scopeCluster, "Where the namespaced resources are granted, cluster (ClusterRole) or namespace (Roles)")
+	genRBACCmd.Flags().String("service-account", "default/"+appName, "The namespace/name service account the operator runs as")
+	genRBACCmd.Flags().String("name", appName, "The name of the generated roles and bindings")
+	genRBACCmd.Flags().Bool("taint-eviction-report", false, "The operator reports the pods evicted by the NoExecute taints")
+	genRBACCmd.Flags().Bool("watch-pods", false, "The operator watches the pods of the nodes")
+	genRBACCmd.Flags().Bool("watch-references", false, "The operator watches the tolerating DaemonSets and value source Secrets")
+	genRBACCmd.Flags().Bool("watch-node-leases", false, "The operator lists the node leases")
+	genRBACCmd.Flags().Bool("watch-scheduling-failures", false, "The operator watches the FailedScheduling events and gets their pods")
+	genRBACCmd.Flags().Bool("skip-draining-nodes", false, "The operator checks the terminating pods of the unschedulable nodes")
+	genRBACCmd.Flags().Bool("require-apply-trigger", false, "The operator clears the apply trigger of the labelers")
+	genRBACCmd.Flags().String("publish-status-configmap", "", "The namespace/name ConfigMap the operator publishes its status to")
+	genRBACCmd.Flags().String("publish-desired-state-configmap", "", "The namespace/name ConfigMap the operator publishes the desired state to")
+	genRBACCmd.Flags().String("freeze-configmap", "", "The namespace/name ConfigMap the operator reads the runtime freeze from")
+	genRBACCmd.Flags().String("kill-switch-configmap", "", "The namespace/name ConfigMap the operator watches the kill switch of")
+	genRBACCmd.Flags().String("leader-lease-configmap", "", "The namespace/name ConfigMap of the operator leader lease")
+	genRBACCmd.Flags().StringSlice("tolerating-daemonsets", nil, "The namespace/name DaemonSets the labelers reference in requireToleratingDaemonSet")
+	genRBACCmd.Flags().StringSlice("value-source-secrets", nil, "The namespace/name Secrets the http value sources reference, the --http-source-secrets if empty")
+	genRBACCmd.Flags().StringSlice("labeler-versions", nil, "The other group/versions of the labelers the operator watches")
+	rootCmd.AddCommand(genRBACCmd)
+}
+
+// namespacedRules are the rules of a namespace.
+type namespacedRules struct {
+	namespace string
+	rules     []rbacv1.PolicyRule
+}
+
+func runGenRBAC(cmd *cobra.Command, args []string) error {
+	scope, _ := cmd.Flags().GetString("scope")
+	if scope != scopeCluster && scope != scopeNamespace {
+		return fmt.Errorf("invalid scope %q, must be %s or %s", scope, scopeCluster, scopeNamespace)
+	}
+	name, _ := cmd.Flags().GetString("name")
+	sa, _ := cmd.Flags().GetString("service-account")
+	saParts := strings.SplitN(sa, "/", 2)
+	if len(saParts) != 2 || saParts[0] == "" || saParts[1] == "" {
+		return fmt.Errorf("invalid service account %q, must be namespace/name", sa)
+	}
+	subject := rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Namespace: saParts[0], Name: saParts[1]}
+
+	labelerVerbs := []string{"get", "list", "watch"}
+	if ok, _ := cmd.Flags().GetBool("require-apply-trigger"); ok {
+		labelerVerbs = append(labelerVerbs, "update")
+	}
+	cluster := []rbacv1.PolicyRule{
+		{APIGroups: []string{"apiextensions.k8s.io"}, Resources: []string{"customresourcedefinitions"}, Verbs: []string{"get", "create"}},
+		{APIGroups: []string{labelerv1alpha1.SchemeGroupVersion.Group}, Resources: []string{labelerv1alpha1.LabelerNamePlural}, Verbs: labelerVerbs},
+		{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"get", "list", "watch", "patch"}},
+	}
+	// The node events (e.g. overwritten foreign values) are always created, and
+	// patched with the count of the identical ones.
+	namespaced := []namespacedRules{{
+		namespace: metav1.NamespaceDefault,
+		rules:     []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"create", "patch"}}},
+	}}
+
+	evictions, _ := cmd.Flags().GetBool("taint-eviction-report")
+	draining, _ := cmd.Flags().GetBool("skip-draining-nodes")
+	if evictions || draining {
+		// The pods of a node are in every namespace.
+		cluster = append(cluster, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"list"}})
+	}
+
+	if ok, _ := cmd.Flags().GetBool("watch-pods"); ok {
+		cluster = append(cluster, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"list", "watch"}})
+	}
+
+	for _, flag := range []string{"publish-status-configmap", "publish-desired-state-configmap", "leader-lease-configmap"} {
+		cm, _ := cmd.Flags().GetString(flag)
+		if cm == "" {
+			continue
+		}
+		parts := strings.SplitN(cm, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid --%s %q, must be namespace/name", flag, cm)
+		}
+		namespaced = append(namespaced, namespacedRules{
+			namespace: parts[0],
+			rules: []rbacv1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{parts[1]}, Verbs: []string{"get", "update"}},
+				// Creating can't be restricted by name.
+				{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"create"}},
+			},
+		})
+	}
+
+	if cm, _ := cmd.Flags().GetString("freeze-configmap"); cm != "" {
+		parts := strings.SplitN(cm, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid freeze configmap %q, must be namespace/name", cm)
+		}
+		namespaced = append(namespaced, namespacedRules{
+			namespace: parts[0],
+			rules:     []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{parts[1]}, Verbs: []string{"get"}}},
+		})
+	}
+
+	if cm, _ := cmd.Flags().GetString("kill-switch-configmap"); cm != "" {
+		parts := strings.SplitN(cm, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid kill switch configmap %q, must be namespace/name", cm)
+		}
+		namespaced = append(namespaced, namespacedRules{
+			namespace: parts[0],
+			// The informer lists and watches it by name with a field selector.
+			rules: []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{parts[1]}, Verbs: []string{"list", "watch"}}},
+		})
+	}
+
+	if ok, _ := cmd.Flags().GetBool("watch-scheduling-failures"); ok {
+		// The events and their pods are in every namespace.
+		cluster = append(cluster,
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"list", "watch"}},
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}},
+		)
+	}
+
+	if ok, _ := cmd.Flags().GetBool("watch-node-leases"); ok {
+		namespaced = append(namespaced, namespacedRules{
+			namespace: "kube-node-lease",
+			rules:     []rbacv1.PolicyRule{{APIGroups: []string{"coordination.k8s.io"}, Resources: []string{"leases"}, Verbs: []string{"list"}}},
+		})
+	}
+
+	// The referenced objects are listed and watched by name with a field selector.
+	referenceVerbs := []string{"get"}
+	if ok, _ := cmd.Flags().GetBool("watch-references"); ok {
+		referenceVerbs = []string{"get", "list", "watch"}
+	}
+
+	daemonSets, _ := cmd.Flags().GetStringSlice("tolerating-daemonsets")
+	for _, ds := range daemonSets {
+		parts := strings.SplitN(ds, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid tolerating daemonset %q, must be namespace/name", ds)
+		}
+		namespaced = append(namespaced, namespacedRules{
+			namespace: parts[0],
+			rules:     []rbacv1.PolicyRule{{APIGroups: []string{"apps"}, Resources: []string{"daemonsets"}, ResourceNames: []string{parts[1]}, Verbs: referenceVerbs}},
+		})
+	}
+
+	secrets, _ := cmd.Flags().GetStringSlice("value-source-secrets")
+	if len(secrets) == 0 {
+		secrets, _ = cmd.Flags().GetStringSlice("http-source-secrets")
+	}
+	for _, s := range secrets {
+		parts := strings.SplitN(s, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid value source secret %q, must be namespace/name", s)
+		}
+		namespaced = append(namespaced, namespacedRules{
+			namespace: parts[0],
+			rules:     []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{parts[1]}, Verbs: referenceVerbs}},
+		})
+	}
+
+	versions, _ := cmd.Flags().GetStringSlice("labeler-versions")
+	gvs, err := operator.ParseLabelerVersions(versions)
+	if err != nil {
+		return err
+	}
+	for _, gv := range gvs {
+		cluster = append(cluster, rbacv1.PolicyRule{APIGroups: []string{gv.Group}, Resources: []string{labelerv1alpha1.LabelerNamePlural}, Verbs: []string{"list", "watch"}})
+	}
+
+	var objs []interface{}
+	if scope == scopeCluster {
+		for _, nr := range namespaced {
+			cluster = append(cluster, nr.rules...)
+		}
+		namespaced = nil
+	}
+	objs = append(objs,
+		&rbacv1.ClusterRole{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRole"},
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Rules:      cluster,
+		},
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: name},
+			Subjects:   []rbacv1.Subject{subject},
+		},
+	)
+	for _, nr := range mergeNamespaced(namespaced) {
+		objs = append(objs,
+			&rbacv1.Role{
+				TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "Role"},
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: nr.namespace},
+				Rules:      nr.rules,
+			},
+			&rbacv1.RoleBinding{
+				TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "RoleBinding"},
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: nr.namespace},
+				RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: name},
+				Subjects:   []rbacv1.Subject{subject},
+			},
+		)
+	}
+
+	return printManifests(os.Stdout, objs)
+}
+
+// mergeNamespaced merges the rules of the same namespace keeping their order.
+func mergeNamespaced(nrs []namespacedRules) []namespacedRules {
+	var merged []namespacedRules
+	index := map[string]int{}
+	for _, nr := range nrs {
+		i, ok := index[nr.namespace]
+		if !ok {
+			index[nr.namespace] = len(merged)
+			merged = append(merged, namespacedRules{namespace: nr.namespace})
+			i = len(merged) - 1
+		}
+		merged[i].rules = append(merged[i].rules, nr.rules...)
+	}
+	return merged
+}
+
+// printManifests writes the objects as a multi-document YAML.
+func printManifests(w io.Writer, objs []interface{}) error {
+	for _, obj := range objs {
+		b, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "---\n%s", b)
+	}
+	return nil
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -28,13 +29,33 @@ import (
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
-	applogger "github.com/spotahome/kooper/log"
-
+	apilabeler "github.com/joshisa/resource-labeler-operator/apis/labeler"
+	"github.com/joshisa/resource-labeler-operator/log"
+	"github.com/joshisa/resource-labeler-operator/metrics"
 	"github.com/joshisa/resource-labeler-operator/operator"
+	"github.com/joshisa/resource-labeler-operator/server"
+	"github.com/joshisa/resource-labeler-operator/service/labeler"
+	"github.com/joshisa/resource-labeler-operator/webhook"
 )
 
 var cfgFile string
 
+// Version is the operator version, set at build time with
+// -ldflags "-X github.com/joshisa/resource-labeler-operator/cmd.Version=<version>".
+var Version = "dev"
+
+// Legacy name of the binary before the project was renamed, it's deprecated and will
+// be removed in v1.0.
+const (
+	appName           = "resource-labeler-operator"
+	legacyName        = "node-labeler-operator"
+	deprecationNotice = "it will be removed in v1.0"
+)
+
+// nodeNameEnv is the env var with the name of the node the operator runs on, with
+// --self-node-only.
+const nodeNameEnv = "NODE_NAME"
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "resource-labeler-operator",
@@ -52,6 +73,11 @@ var rootCmd = &cobra.Command{
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	if filepath.Base(os.Args[0]) == legacyName {
+		rootCmd.Use = legacyName
+		fmt.Fprintf(os.Stderr, "%s is deprecated, use %s instead, %s\n", legacyName, appName, deprecationNotice)
+	}
+
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -79,9 +105,195 @@ func init() {
 	viper.BindPFlag("kubeconfig", rootCmd.PersistentFlags().Lookup("kubeconfig"))
 	rootCmd.PersistentFlags().String("master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
 	viper.BindPFlag("master", rootCmd.PersistentFlags().Lookup("master"))
+	rootCmd.PersistentFlags().String("log-format", log.FormatText, "The format of the logs (text or json)")
+	viper.BindPFlag("log-format", rootCmd.PersistentFlags().Lookup("log-format"))
+	rootCmd.PersistentFlags().String("log-level", log.LevelInfo, "The level of the logs (info or debug)")
+	viper.BindPFlag("log-level", rootCmd.PersistentFlags().Lookup("log-level"))
+	rootCmd.PersistentFlags().String("managed-prefix", apilabeler.GroupName, "The prefix of the annotations used by the operator")
+	viper.BindPFlag("managed-prefix", rootCmd.PersistentFlags().Lookup("managed-prefix"))
+	rootCmd.PersistentFlags().Bool("allow-reserved", false, "Allow the labelers to write labels, annotations and taints with reserved prefixes (kubernetes.io, k8s.io and their subdomains)")
+	viper.BindPFlag("allow-reserved", rootCmd.PersistentFlags().Lookup("allow-reserved"))
+	rootCmd.PersistentFlags().StringSlice("match-label-allowlist", nil, "The only label keys the labelers can match the nodes on, prefix/* allows a whole prefix. Empty allows every key")
+	viper.BindPFlag("match-label-allowlist", rootCmd.PersistentFlags().Lookup("match-label-allowlist"))
+	rootCmd.PersistentFlags().StringSlice("protect-keys", nil, "The label, annotation and taint keys the labelers set but never remove, prefix/* protects a whole prefix")
+	viper.BindPFlag("protect-keys", rootCmd.PersistentFlags().Lookup("protect-keys"))
+	rootCmd.PersistentFlags().StringSlice("allowed-taint-effects", labeler.TaintEffects, "The only taint effects the labelers can merge, the labelers with other effects are rejected (repeatable)")
+	viper.BindPFlag("allowed-taint-effects", rootCmd.PersistentFlags().Lookup("allowed-taint-effects"))
+	rootCmd.PersistentFlags().StringSlice("http-source-hosts", nil, "The only URL hosts the http value sources can get, *.domain allows its subdomains. Empty rejects the labelers with http sources")
+	viper.BindPFlag("http-source-hosts", rootCmd.PersistentFlags().Lookup("http-source-hosts"))
+	rootCmd.PersistentFlags().StringSlice("http-source-secrets", nil, "The only namespace/name Secrets the http value sources can send, the labelers referencing others are rejected")
+	viper.BindPFlag("http-source-secrets", rootCmd.PersistentFlags().Lookup("http-source-secrets"))
+	rootCmd.PersistentFlags().String("combine-policy", labeler.CombineUnion, "How the labels and annotations of the labelers applied on the same node combine: union (the first labeler by --conflict-tiebreak wins a conflicting key) or strict (conflicting keys are left unchanged)")
+	viper.BindPFlag("combine-policy", rootCmd.PersistentFlags().Lookup("combine-policy"))
+	rootCmd.PersistentFlags().String("conflict-tiebreak", labeler.TiebreakName, "The order the labelers are applied in, so which one wins a conflicting key: name, creationTimestamp-oldest, creationTimestamp-newest or generation (the most edited first)")
+	viper.BindPFlag("conflict-tiebreak", rootCmd.PersistentFlags().Lookup("conflict-tiebreak"))
+	rootCmd.PersistentFlags().StringSlice("node-group-label", nil, "An extra provider=key node label with the node group of the nodes, checked after the built-in ones (repeatable)")
+	viper.BindPFlag("node-group-label", rootCmd.PersistentFlags().Lookup("node-group-label"))
+	rootCmd.Flags().Bool("requeue-on-managed-annotations", false, "Sync the nodes again when only the annotations managed by the operator changed")
+	viper.BindPFlag("requeue-on-managed-annotations", rootCmd.Flags().Lookup("requeue-on-managed-annotations"))
+	rootCmd.PersistentFlags().String("owner-annotation", "", "The node annotation with the attributes owned by the labelers (default is <managed-prefix>/owned-keys)")
+	viper.BindPFlag("owner-annotation", rootCmd.PersistentFlags().Lookup("owner-annotation"))
 
 	rootCmd.Flags().Int("resync-seconds", 30, "The number of seconds the controller will resync the resources")
 	viper.BindPFlag("resync-seconds", rootCmd.Flags().Lookup("resync-seconds"))
+	rootCmd.Flags().String("orphan-policy", labeler.OrphanKeep, "What to do with the managed keys of labelers that no longer exist or no longer set them: keep, report (log and metric) or remove")
+	viper.BindPFlag("orphan-policy", rootCmd.Flags().Lookup("orphan-policy"))
+	rootCmd.Flags().Duration("orphan-sweep-interval", 10*time.Minute, "The period of the orphaned keys sweeps with --orphan-policy report or remove")
+	viper.BindPFlag("orphan-sweep-interval", rootCmd.Flags().Lookup("orphan-sweep-interval"))
+	rootCmd.Flags().Int("backpressure-high-water", 0, "The nodes ready to sync putting the node queue under backpressure: the resyncs are not queued and the retries back off longer. Disabled if 0")
+	viper.BindPFlag("backpressure-high-water", rootCmd.Flags().Lookup("backpressure-high-water"))
+	rootCmd.Flags().Int("backpressure-low-water", 0, "The nodes ready to sync the node queue drains to to leave the backpressure (default half of --backpressure-high-water)")
+	viper.BindPFlag("backpressure-low-water", rootCmd.Flags().Lookup("backpressure-low-water"))
+	rootCmd.Flags().Bool("report-redundant-labelers", false, "Report the labelers whose attributes another labeler already sets on all their nodes, as a metric and in the logs")
+	viper.BindPFlag("report-redundant-labelers", rootCmd.Flags().Lookup("report-redundant-labelers"))
+	rootCmd.Flags().StringSlice("labeler-versions", nil, "Also watch the labelers of these group/versions (e.g. labeler.example.com/v1beta1), a labeler name in several versions is the one of the first")
+	viper.BindPFlag("labeler-versions", rootCmd.Flags().Lookup("labeler-versions"))
+	rootCmd.Flags().Float64("resync-jitter", 0, "Randomize the resync period within ±this fraction of it (e.g. 0.1), to decorrelate the operators of many clusters")
+	viper.BindPFlag("resync-jitter", rootCmd.Flags().Lookup("resync-jitter"))
+
+	rootCmd.Flags().Int("workers", 5, "The number of nodes synced concurrently")
+	viper.BindPFlag("workers", rootCmd.Flags().Lookup("workers"))
+	rootCmd.Flags().Int("max-workers", 0, "Scale the workers up to this number when the node queue backs up and back down to --workers when idle, 0 keeps them static")
+	viper.BindPFlag("max-workers", rootCmd.Flags().Lookup("max-workers"))
+	rootCmd.Flags().Duration("spread-initial-reconcile", 0, "Stagger the first sync of the nodes after startup randomly across this window, 0 disables it")
+	viper.BindPFlag("spread-initial-reconcile", rootCmd.Flags().Lookup("spread-initial-reconcile"))
+	rootCmd.Flags().Int("max-changes-per-pass", 0, "The maximum nodes every labeler changes per resync period, in its rolloutOrder, the rest of the nodes are requeued. 0 doesn't limit them")
+	viper.BindPFlag("max-changes-per-pass", rootCmd.Flags().Lookup("max-changes-per-pass"))
+	rootCmd.Flags().Int("max-unavailable-per-zone", 0, "The maximum disruptive mutations (NoSchedule and NoExecute taints) in flight in every zone, the rest of the nodes are requeued. 0 doesn't limit them")
+	viper.BindPFlag("max-unavailable-per-zone", rootCmd.Flags().Lookup("max-unavailable-per-zone"))
+	rootCmd.Flags().Duration("zone-disruption-window", time.Minute, "How long a disruptive mutation is in flight in its zone after its patch")
+	viper.BindPFlag("zone-disruption-window", rootCmd.Flags().Lookup("zone-disruption-window"))
+	rootCmd.Flags().String("zone-label", "", "The node label with the zone of --max-unavailable-per-zone, the well-known zone labels if empty")
+	viper.BindPFlag("zone-label", rootCmd.Flags().Lookup("zone-label"))
+	rootCmd.Flags().StringSlice("zone-apiserver", nil, "A zone=URL preferred API server of the node patches of the zone (e.g. eu-west-1a=https://10.0.1.10:6443), the default one if it can't be reached (repeatable)")
+	viper.BindPFlag("zone-apiserver", rootCmd.Flags().Lookup("zone-apiserver"))
+	rootCmd.Flags().Bool("log-noop", false, "Log the syncs that don't change the nodes at info level, otherwise only at debug level")
+	viper.BindPFlag("log-noop", rootCmd.Flags().Lookup("log-noop"))
+	rootCmd.Flags().Duration("audit-interval", 0, "Audit every node from the API this often, correcting those not in the desired state, 0 disables it")
+	viper.BindPFlag("audit-interval", rootCmd.Flags().Lookup("audit-interval"))
+	rootCmd.Flags().String("audit-start", "", "The HH:MM UTC time of day the audits are aligned to (e.g. 03:00 off-peak), an interval after startup if empty")
+	viper.BindPFlag("audit-start", rootCmd.Flags().Lookup("audit-start"))
+	rootCmd.Flags().Bool("taint-eviction-report", false, "Report as JSON and as a node event the pods evicted by the NoExecute taints before applying them")
+	viper.BindPFlag("taint-eviction-report", rootCmd.Flags().Lookup("taint-eviction-report"))
+	rootCmd.Flags().Bool("dry-run", false, "Plan and report the changes of all the labelers without applying them")
+	viper.BindPFlag("dry-run", rootCmd.Flags().Lookup("dry-run"))
+	rootCmd.Flags().Bool("require-apply-trigger", false, "Stage the changes of every labeler generation, planned like a dry run, until the labeler has the <managed-prefix>/apply=true annotation")
+	viper.BindPFlag("require-apply-trigger", rootCmd.Flags().Lookup("require-apply-trigger"))
+	rootCmd.Flags().Int("max-blast-radius", 0, "Plan like a dry run the labeler generations newly selecting more nodes than this, until the labeler has the <managed-prefix>/allow-blast-radius annotation with the generation. 0 doesn't limit them")
+	viper.BindPFlag("max-blast-radius", rootCmd.Flags().Lookup("max-blast-radius"))
+	rootCmd.Flags().Bool("watch-pods", false, "Watch the pods of every node for the podResourceSum value source, adding or removing pods syncs their node")
+	viper.BindPFlag("watch-pods", rootCmd.Flags().Lookup("watch-pods"))
+	rootCmd.Flags().Bool("watch-references", false, "Watch the Secrets and DaemonSets the labelers reference, their changes sync again the nodes of the labelers referencing them")
+	viper.BindPFlag("watch-references", rootCmd.Flags().Lookup("watch-references"))
+	rootCmd.Flags().Bool("watch-node-leases", false, "List the kubelet node leases every 10 seconds for the nodeLease value source, disabled if they can't be listed")
+	viper.BindPFlag("watch-node-leases", rootCmd.Flags().Lookup("watch-node-leases"))
+	rootCmd.Flags().Bool("watch-scheduling-failures", false, "Watch the FailedScheduling events of the pods for the schedulingPressure value source, disabled if they can't be listed")
+	viper.BindPFlag("watch-scheduling-failures", rootCmd.Flags().Lookup("watch-scheduling-failures"))
+	rootCmd.Flags().Float64("event-qps", 0, "The sustained rate of the events of a node and reason (e.g. 0.1), the rest are dropped. 0 doesn't limit them")
+	viper.BindPFlag("event-qps", rootCmd.Flags().Lookup("event-qps"))
+	rootCmd.Flags().Int("event-burst", 25, "The burst of the events of a node and reason over --event-qps")
+	viper.BindPFlag("event-burst", rootCmd.Flags().Lookup("event-burst"))
+	rootCmd.Flags().Bool("index-nodes", false, "Index the node cache by label and owner labeler, the labeler changes only sync and match the nodes their selectors may match")
+	viper.BindPFlag("index-nodes", rootCmd.Flags().Lookup("index-nodes"))
+	rootCmd.Flags().Bool("verify-idempotent", false, "Debug mode planning the nodes again right after patching them, the labelers that would still change them are logged and counted")
+	viper.BindPFlag("verify-idempotent", rootCmd.Flags().Lookup("verify-idempotent"))
+	rootCmd.Flags().Int("max-patch-bytes", 256*1024, "The size over which the node patches are applied in sequential chunks of labels and annotations")
+	viper.BindPFlag("max-patch-bytes", rootCmd.Flags().Lookup("max-patch-bytes"))
+	rootCmd.Flags().Int("max-annotation-bytes", 200*1024, "Don't patch the nodes whose annotations (keys and values) would grow over this total size, must be below the 256KiB API limit")
+	viper.BindPFlag("max-annotation-bytes", rootCmd.Flags().Lookup("max-annotation-bytes"))
+	rootCmd.Flags().Bool("skip-draining-nodes", false, "Defer the sync of the nodes being drained: unschedulable with pods terminating or the <managed-prefix>/draining annotation")
+	viper.BindPFlag("skip-draining-nodes", rootCmd.Flags().Lookup("skip-draining-nodes"))
+	rootCmd.Flags().Duration("draining-requeue", time.Minute, "When a draining node is synced again with --skip-draining-nodes")
+	viper.BindPFlag("draining-requeue", rootCmd.Flags().Lookup("draining-requeue"))
+	rootCmd.Flags().Bool("self-node-only", false, "Only label the node the operator runs on, named by the NODE_NAME env var (from the downward API spec.nodeName)")
+	viper.BindPFlag("self-node-only", rootCmd.Flags().Lookup("self-node-only"))
+	rootCmd.Flags().Bool("content-hash", false, "Store a hash of the node content on an annotation and skip syncing the nodes that didn't change since")
+	viper.BindPFlag("content-hash", rootCmd.Flags().Lookup("content-hash"))
+	rootCmd.Flags().String("patch-type", labeler.PatchMerge, "The patch type of the node mutations: merge, json, strategic or apply (server-side apply)")
+	viper.BindPFlag("patch-type", rootCmd.Flags().Lookup("patch-type"))
+	rootCmd.Flags().Bool("stamp-applied", false, "Stamp the nodes the operator mutates with the applied-by (its version and instance) and applied-at annotations")
+	viper.BindPFlag("stamp-applied", rootCmd.Flags().Lookup("stamp-applied"))
+	rootCmd.Flags().String("fingerprint-annotation", "", "The node annotation with a fingerprint of the managed keys and values of the node (e.g. labeler.cfmr.site/fingerprint), disabled if empty")
+	viper.BindPFlag("fingerprint-annotation", rootCmd.Flags().Lookup("fingerprint-annotation"))
+	rootCmd.Flags().Float64("error-circuit-threshold", 0, "Pause the node mutations when the sync error rate (0-1) over --error-circuit-window is higher than this, 0 disables it")
+	viper.BindPFlag("error-circuit-threshold", rootCmd.Flags().Lookup("error-circuit-threshold"))
+	rootCmd.Flags().Duration("error-circuit-window", 2*time.Minute, "The window of the sync error rate and how long the node mutations are paused")
+	viper.BindPFlag("error-circuit-window", rootCmd.Flags().Lookup("error-circuit-window"))
+	rootCmd.Flags().Int("state-cache-size", 10000, "The maximum number of entries of every per node state cache (content hashes, canary soaks)")
+	viper.BindPFlag("state-cache-size", rootCmd.Flags().Lookup("state-cache-size"))
+	rootCmd.Flags().Duration("no-matches-window", 30*time.Minute, "Set the NoMatches warning condition of the labelers matching no nodes for this long, 0 disables it")
+	viper.BindPFlag("no-matches-window", rootCmd.Flags().Lookup("no-matches-window"))
+	rootCmd.Flags().Int("spec-history-size", 10, "The number of spec edits of every labeler kept on the published status, 0 disables it")
+	viper.BindPFlag("spec-history-size", rootCmd.Flags().Lookup("spec-history-size"))
+	rootCmd.Flags().StringSlice("retry-policies", nil, "The retry policies of the failed node syncs as class=policy (e.g. Conflict=backoff), the classes are NotFound, Conflict, Forbidden, Timeout, Panic and Other, the policies drop, immediate, stop and backoff")
+	viper.BindPFlag("retry-policies", rootCmd.Flags().Lookup("retry-policies"))
+	rootCmd.Flags().Bool("crash-on-panic", false, "Let a panic of a node sync crash the operator instead of recovering it and retrying the node, for development")
+	viper.BindPFlag("crash-on-panic", rootCmd.Flags().Lookup("crash-on-panic"))
+	rootCmd.Flags().Duration("watch-timeout", 15*time.Minute, "Restart the node informer when it doesn't list, watch or get watch events for this long, at least 10m as it watches again every 5 to 10 minutes, 0 disables it")
+	viper.BindPFlag("watch-timeout", rootCmd.Flags().Lookup("watch-timeout"))
+
+	rootCmd.Flags().String("listen-address", ":8080", "The address of the HTTP server exposing the operator endpoints")
+	viper.BindPFlag("listen-address", rootCmd.Flags().Lookup("listen-address"))
+	rootCmd.Flags().String("metrics-tls-cert", "", "Path to the TLS certificate of the HTTP server exposing the metrics, plain HTTP if empty")
+	viper.BindPFlag("metrics-tls-cert", rootCmd.Flags().Lookup("metrics-tls-cert"))
+	rootCmd.Flags().String("metrics-tls-key", "", "Path to the TLS key of the HTTP server exposing the metrics")
+	viper.BindPFlag("metrics-tls-key", rootCmd.Flags().Lookup("metrics-tls-key"))
+	rootCmd.Flags().String("metrics-client-ca", "", "Path to the CA the client certificates of the HTTP server exposing the metrics need to be signed by, not required if empty")
+	viper.BindPFlag("metrics-client-ca", rootCmd.Flags().Lookup("metrics-client-ca"))
+	rootCmd.Flags().String("metrics-namespace", metrics.DefaultNamespace, "The namespace prefix of the metric names")
+	viper.BindPFlag("metrics-namespace", rootCmd.Flags().Lookup("metrics-namespace"))
+	rootCmd.Flags().String("metrics-subsystem", "", "The subsystem prefix of the metric names, after the namespace")
+	viper.BindPFlag("metrics-subsystem", rootCmd.Flags().Lookup("metrics-subsystem"))
+	rootCmd.Flags().String("metrics-instance", "", "The instance label set on every metric and prefixing the queue name, to tell several operator instances apart. Not set if empty")
+	viper.BindPFlag("metrics-instance", rootCmd.Flags().Lookup("metrics-instance"))
+	rootCmd.Flags().StringSlice("labeler-metrics-labels", nil, "The labels added to the per labeler metrics, set by the labelers metricsLabels (e.g. team,env)")
+	viper.BindPFlag("labeler-metrics-labels", rootCmd.Flags().Lookup("labeler-metrics-labels"))
+	rootCmd.Flags().Int("labeler-metrics-labels-limit", 50, "The maximum of distinct metricsLabels value sets of the labelers, the labelers past it are rejected")
+	viper.BindPFlag("labeler-metrics-labels-limit", rootCmd.Flags().Lookup("labeler-metrics-labels-limit"))
+	rootCmd.Flags().Bool("enable-debug-endpoints", false, "Serve the debug endpoints, /debug/queue with the node queue content and /debug/mutations with the recent mutations")
+	viper.BindPFlag("enable-debug-endpoints", rootCmd.Flags().Lookup("enable-debug-endpoints"))
+	rootCmd.Flags().Int("mutation-history-size", 1000, "The number of recent node mutations kept in memory for /debug/mutations with the debug endpoints, 0 disables it")
+	viper.BindPFlag("mutation-history-size", rootCmd.Flags().Lookup("mutation-history-size"))
+	rootCmd.Flags().Bool("enable-events-stream", false, "Stream the node mutations as server-sent events on /events (best-effort, no replay)")
+	viper.BindPFlag("enable-events-stream", rootCmd.Flags().Lookup("enable-events-stream"))
+	rootCmd.Flags().String("watch-output", "", "Print the recent node mutations on the standard output: table redraws them on the terminal, for the local development only. Disabled if empty")
+	viper.BindPFlag("watch-output", rootCmd.Flags().Lookup("watch-output"))
+	rootCmd.Flags().String("cloudevents-sink", "", "The http(s) URL every node mutation is POSTed to as a CloudEvent (best-effort, bounded retries). Disabled if empty")
+	viper.BindPFlag("cloudevents-sink", rootCmd.Flags().Lookup("cloudevents-sink"))
+
+	rootCmd.Flags().String("webhook-address", "", "The address the admission and conversion webhook will listen on (e.g. :8443). The webhook is disabled if empty")
+	viper.BindPFlag("webhook-address", rootCmd.Flags().Lookup("webhook-address"))
+	rootCmd.Flags().String("webhook-tls-cert", "", "Path to the TLS certificate of the admission and conversion webhook")
+	viper.BindPFlag("webhook-tls-cert", rootCmd.Flags().Lookup("webhook-tls-cert"))
+	rootCmd.Flags().String("webhook-tls-key", "", "Path to the TLS key of the admission and conversion webhook")
+	viper.BindPFlag("webhook-tls-key", rootCmd.Flags().Lookup("webhook-tls-key"))
+	rootCmd.Flags().Bool("webhook-what-if", false, "Annotate the labeler creations and updates admitted by the webhook with how many nodes they will change")
+	viper.BindPFlag("webhook-what-if", rootCmd.Flags().Lookup("webhook-what-if"))
+	rootCmd.Flags().String("publish-status-configmap", "", "The namespace/name ConfigMap the operator status is periodically published to. Disabled if empty")
+	viper.BindPFlag("publish-status-configmap", rootCmd.Flags().Lookup("publish-status-configmap"))
+	rootCmd.Flags().String("freeze-until", "", "Pause all the node mutations until this RFC3339 time, the nodes are still planned and the status published")
+	viper.BindPFlag("freeze-until", rootCmd.Flags().Lookup("freeze-until"))
+	rootCmd.Flags().String("freeze-configmap", "", "The namespace/name ConfigMap whose freeze-until annotation pauses the node mutations at runtime. Disabled if empty")
+	viper.BindPFlag("freeze-configmap", rootCmd.Flags().Lookup("freeze-configmap"))
+	rootCmd.Flags().String("kill-switch-configmap", "", "The namespace/name ConfigMap whose paused: \"true\" data stops all the node mutations until cleared, watched. Disabled if empty")
+	viper.BindPFlag("kill-switch-configmap", rootCmd.Flags().Lookup("kill-switch-configmap"))
+	rootCmd.Flags().String("leader-lease-configmap", "", "The namespace/name ConfigMap of the leader lease, only the instance holding it patches the nodes. Disabled if empty")
+	viper.BindPFlag("leader-lease-configmap", rootCmd.Flags().Lookup("leader-lease-configmap"))
+	rootCmd.Flags().Duration("leader-lease-duration", 15*time.Second, "How long the leader lease is held without renewal before the other instances take it over")
+	viper.BindPFlag("leader-lease-duration", rootCmd.Flags().Lookup("leader-lease-duration"))
+	rootCmd.Flags().Bool("prewarm", false, "Start the informers and sync the caches while waiting for the leader lease, to take over right away")
+	viper.BindPFlag("prewarm", rootCmd.Flags().Lookup("prewarm"))
+	rootCmd.Flags().Duration("publish-status-interval", 30*time.Second, "The period the operator status is published")
+	viper.BindPFlag("publish-status-interval", rootCmd.Flags().Lookup("publish-status-interval"))
+	rootCmd.Flags().Duration("status-update-interval", 10*time.Second, "The minimum time between publishing status changes, coalescing the changes in between (degraded and error changes are published right away), 0 only publishes every --publish-status-interval")
+	viper.BindPFlag("status-update-interval", rootCmd.Flags().Lookup("status-update-interval"))
+	rootCmd.Flags().String("publish-desired-state-configmap", "", "The namespace/name ConfigMap the desired labels of every node are published to, disabled if empty")
+	viper.BindPFlag("publish-desired-state-configmap", rootCmd.Flags().Lookup("publish-desired-state-configmap"))
+	rootCmd.Flags().Duration("publish-desired-state-interval", 10*time.Second, "How often the desired state changes are published")
+	viper.BindPFlag("publish-desired-state-interval", rootCmd.Flags().Lookup("publish-desired-state-interval"))
+
+	rootCmd.Flags().Int("delete-protection-threshold", 10, "Deny deleting a labeler owning attributes on more nodes than this, unless it has the allow-delete annotation")
+	viper.BindPFlag("delete-protection-threshold", rootCmd.Flags().Lookup("delete-protection-threshold"))
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -102,44 +314,286 @@ func initConfig() {
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
 }
 
 // Run runs the app.
 func run(cmd *cobra.Command, args []string) error {
-	logger := &applogger.Std{}
-
-	// Get kubernetes rest client.
-	nlCli, crdCli, k8sCli, err := GetKubernetesClients(logger)
+	logger, err := log.New(viper.GetString("log-format"), viper.GetString("log-level"))
 	if err != nil {
 		return err
 	}
 
-	// Create the operator and run
-	oconfig := operator.NewOperatorConfig(time.Duration(viper.GetInt("resync-seconds")) * time.Second)
-	op, err := operator.New(oconfig, nlCli, crdCli, k8sCli, logger)
+	oconfig, err := operatorConfig(cmd, logger)
 	if err != nil {
 		return err
 	}
+	logEffectiveConfig(logger, oconfig)
 
-	stopC := make(chan struct{})
-	finishC := make(chan error)
 	signalC := make(chan os.Signal, 1)
 	signal.Notify(signalC, syscall.SIGTERM, syscall.SIGINT)
 
-	// Run in background the operator.
-	go func() {
-		finishC <- op.Run(stopC)
-	}()
+	// Reconnect to the cluster when the kubeconfig changes (e.g. rotated credentials).
+	reloadC := make(chan struct{}, 1)
+	if kubeconfig := viper.GetString("kubeconfig"); kubeconfig != "" {
+		watchStopC := make(chan struct{})
+		defer close(watchStopC)
+		if err := watchKubeconfig(kubeconfig, reloadC, watchStopC, logger); err != nil {
+			logger.Warningf("could not watch kubeconfig, it will not be reloaded on changes: %s", err)
+		}
+	}
 
-	select {
-	case err := <-finishC:
+	for {
+		// Get kubernetes rest client.
+		nlCli, crdCli, k8sCli, err := GetKubernetesClients(logger)
 		if err != nil {
 			return err
 		}
-	case <-signalC:
-		logger.Infof("Signal captured, exiting...")
+		if oconfig.ZoneClients, err = GetZoneClients(oconfig.ZoneAPIServers); err != nil {
+			return err
+		}
+		if oconfig.LeaseConfigMapName != "" {
+			if oconfig.LeaseClient, err = GetLeaseClient(labeler.LeaseCallTimeout(oconfig.LeaseDuration)); err != nil {
+				return err
+			}
+		}
+
+		// Create the operator and run
+		op, err := operator.New(oconfig, nlCli, crdCli, k8sCli, logger)
+		if err != nil {
+			return err
+		}
+
+		stopC := make(chan struct{})
+		finishC := make(chan error, 1)
+
+		// Run in background the operator.
+		go func() {
+			finishC <- op.Run(stopC)
+		}()
+
+		select {
+		case err := <-finishC:
+			return err
+		case <-signalC:
+			logger.Infof("Signal captured, exiting...")
+			if oconfig.LeaseConfigMapName != "" {
+				// Hand the lease over before exiting.
+				close(stopC)
+				return <-finishC
+			}
+			return nil
+		case <-reloadC:
+			logger.Infof("kubeconfig changed, reconnecting to the cluster...")
+			close(stopC)
+			if err := <-finishC; err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// operatorConfig returns the operator configuration of the flags, the config file and
+// the env vars.
+func operatorConfig(cmd *cobra.Command, logger log.Logger) (operator.Config, error) {
+	var err error
+	resync := time.Duration(viper.GetInt("resync-seconds")) * time.Second
+
+	jitter := viper.GetFloat64("resync-jitter")
+	if jitter < 0 || jitter >= 1 {
+		return operator.Config{}, fmt.Errorf("--resync-jitter must be between 0 and 1 (excluded), got %g", jitter)
+	}
+
+	oconfig := operator.NewOperatorConfig(resync, jitter)
+	oconfig.LabelerVersions = viper.GetStringSlice("labeler-versions")
+	oconfig.ReportRedundant = viper.GetBool("report-redundant-labelers")
+	if oconfig.BackpressureHighWater, oconfig.BackpressureLowWater, err = backpressureMarks(); err != nil {
+		return operator.Config{}, err
+	}
+	if oconfig.OrphanPolicy, err = orphanPolicy(); err != nil {
+		return operator.Config{}, err
+	}
+	if oconfig.OrphanSweepInterval = viper.GetDuration("orphan-sweep-interval"); oconfig.OrphanSweepInterval <= 0 {
+		return operator.Config{}, fmt.Errorf("--orphan-sweep-interval must be positive, got %s", oconfig.OrphanSweepInterval)
+	}
+	if _, err := operator.ParseLabelerVersions(oconfig.LabelerVersions); err != nil {
+		return operator.Config{}, err
+	}
+	oconfig.Workers = viper.GetInt("workers")
+	oconfig.MaxWorkers = viper.GetInt("max-workers")
+	if oconfig.MaxWorkers != 0 && oconfig.MaxWorkers < oconfig.Workers {
+		return operator.Config{}, fmt.Errorf("--max-workers must be at least --workers (%d), got %d", oconfig.Workers, oconfig.MaxWorkers)
+	}
+	oconfig.SpreadInitialReconcile = viper.GetDuration("spread-initial-reconcile")
+	if oconfig.AuditInterval, oconfig.AuditStart, err = auditConfig(time.Now()); err != nil {
+		return operator.Config{}, err
+	}
+	oconfig.LogNoop = viper.GetBool("log-noop")
+	oconfig.MaxChangesPerPass = viper.GetInt("max-changes-per-pass")
+	if oconfig.MaxChangesPerPass < 0 {
+		return operator.Config{}, fmt.Errorf("--max-changes-per-pass can't be negative, got %d", oconfig.MaxChangesPerPass)
+	}
+	oconfig.MaxUnavailablePerZone = viper.GetInt("max-unavailable-per-zone")
+	oconfig.ZoneDisruptionWindow = viper.GetDuration("zone-disruption-window")
+	oconfig.ZoneLabel = viper.GetString("zone-label")
+	if oconfig.MaxUnavailablePerZone < 0 || oconfig.ZoneDisruptionWindow <= 0 {
+		return operator.Config{}, fmt.Errorf("--max-unavailable-per-zone can't be negative and --zone-disruption-window must be positive")
+	}
+	if oconfig.ZoneAPIServers, err = zoneAPIServers(); err != nil {
+		return operator.Config{}, err
+	}
+	oconfig.TaintEvictionReport = viper.GetBool("taint-eviction-report")
+	oconfig.WatchPods = viper.GetBool("watch-pods")
+	oconfig.WatchReferences = viper.GetBool("watch-references")
+	oconfig.WatchNodeLeases = viper.GetBool("watch-node-leases")
+	oconfig.WatchSchedulingFailures = viper.GetBool("watch-scheduling-failures")
+	oconfig.DryRun = viper.GetBool("dry-run")
+	oconfig.RequireApplyTrigger = viper.GetBool("require-apply-trigger")
+	oconfig.MaxBlastRadius = viper.GetInt("max-blast-radius")
+	if oconfig.MaxBlastRadius < 0 {
+		return operator.Config{}, fmt.Errorf("--max-blast-radius can't be negative, got %d", oconfig.MaxBlastRadius)
+	}
+	oconfig.SkipDrainingNodes = viper.GetBool("skip-draining-nodes")
+	oconfig.VerifyIdempotent = viper.GetBool("verify-idempotent")
+	oconfig.IndexNodes = viper.GetBool("index-nodes")
+	oconfig.EventQPS = float32(viper.GetFloat64("event-qps"))
+	oconfig.EventBurst = viper.GetInt("event-burst")
+	if oconfig.EventQPS < 0 || oconfig.EventBurst <= 0 {
+		return operator.Config{}, fmt.Errorf("--event-qps can't be negative and --event-burst must be positive")
+	}
+	oconfig.MaxPatchBytes = viper.GetInt("max-patch-bytes")
+	if oconfig.MaxPatchBytes <= 0 {
+		return operator.Config{}, fmt.Errorf("--max-patch-bytes must be positive, got %d", oconfig.MaxPatchBytes)
+	}
+	oconfig.AnnotationsGuardBytes = viper.GetInt("max-annotation-bytes")
+	if b := oconfig.AnnotationsGuardBytes; b <= 0 || b > 256*1024 {
+		return operator.Config{}, fmt.Errorf("--max-annotation-bytes must be between 1 and %d, got %d", 256*1024, b)
+	}
+	oconfig.DrainingRequeue = viper.GetDuration("draining-requeue")
+	if viper.GetBool("self-node-only") {
+		if oconfig.NodeName = os.Getenv(nodeNameEnv); oconfig.NodeName == "" {
+			return operator.Config{}, fmt.Errorf("--self-node-only requires the %s env var set to the node name from the downward API (fieldRef spec.nodeName)", nodeNameEnv)
+		}
+	}
+	oconfig.ContentHash = viper.GetBool("content-hash")
+	if oconfig.PatchType, err = patchType(); err != nil {
+		return operator.Config{}, err
+	}
+	if viper.GetBool("stamp-applied") {
+		identity, err := os.Hostname()
+		if err != nil {
+			return operator.Config{}, fmt.Errorf("could not get the operator identity: %s", err)
+		}
+		oconfig.AppliedBy = appName + "/" + Version + " " + identity
+	}
+	if oconfig.FingerprintAnnotation, err = fingerprintAnnotation(); err != nil {
+		return operator.Config{}, err
+	}
+	oconfig.AllowReserved = viper.GetBool("allow-reserved")
+	oconfig.MatchLabelAllowlist = viper.GetStringSlice("match-label-allowlist")
+	oconfig.ProtectKeys = viper.GetStringSlice("protect-keys")
+	if oconfig.AllowedTaintEffects, err = allowedTaintEffects(); err != nil {
+		return operator.Config{}, err
+	}
+	oconfig.HTTPSourceHosts = viper.GetStringSlice("http-source-hosts")
+	oconfig.HTTPSourceSecrets = viper.GetStringSlice("http-source-secrets")
+	if oconfig.CombinePolicy, err = combinePolicy(); err != nil {
+		return operator.Config{}, err
+	}
+	if oconfig.ConflictTiebreak, err = conflictTiebreak(); err != nil {
+		return operator.Config{}, err
+	}
+	oconfig.StateCacheSize = viper.GetInt("state-cache-size")
+	oconfig.ErrorCircuitThreshold = viper.GetFloat64("error-circuit-threshold")
+	oconfig.ErrorCircuitWindow = viper.GetDuration("error-circuit-window")
+	if t := oconfig.ErrorCircuitThreshold; t < 0 || t > 1 {
+		return operator.Config{}, fmt.Errorf("--error-circuit-threshold must be between 0 and 1, got %v", t)
+	}
+	oconfig.NoMatchesWindow = viper.GetDuration("no-matches-window")
+	oconfig.SpecHistorySize = viper.GetInt("spec-history-size")
+	oconfig.CrashOnPanic = viper.GetBool("crash-on-panic")
+	if oconfig.RetryPolicies, err = retryPolicies(); err != nil {
+		return operator.Config{}, err
+	}
+	oconfig.WatchTimeout = viper.GetDuration("watch-timeout")
+	oconfig.ListenAddress = viper.GetString("listen-address")
+	oconfig.ListenTLS = server.TLS{
+		CertFile:     viper.GetString("metrics-tls-cert"),
+		KeyFile:      viper.GetString("metrics-tls-key"),
+		ClientCAFile: viper.GetString("metrics-client-ca"),
+	}
+	if t := oconfig.ListenTLS; (t.CertFile == "") != (t.KeyFile == "") {
+		return operator.Config{}, fmt.Errorf("--metrics-tls-cert and --metrics-tls-key need to be set together")
+	}
+	if t := oconfig.ListenTLS; t.ClientCAFile != "" && t.CertFile == "" {
+		return operator.Config{}, fmt.Errorf("--metrics-client-ca requires --metrics-tls-cert and --metrics-tls-key")
+	}
+	oconfig.Metrics = metrics.Config{
+		Namespace: viper.GetString("metrics-namespace"),
+		Subsystem: viper.GetString("metrics-subsystem"),
+		Instance:  viper.GetString("metrics-instance"),
+	}
+	if oconfig.Metrics.LabelerLabels, err = labelerMetricsLabels(); err != nil {
+		return operator.Config{}, err
+	}
+	if oconfig.MetricsLabelsLimit = viper.GetInt("labeler-metrics-labels-limit"); oconfig.MetricsLabelsLimit <= 0 {
+		return operator.Config{}, fmt.Errorf("--labeler-metrics-labels-limit must be positive, got %d", oconfig.MetricsLabelsLimit)
+	}
+	oconfig.EventsStream = viper.GetBool("enable-events-stream")
+	if oconfig.WatchTable, err = watchTable(); err != nil {
+		return operator.Config{}, err
+	}
+	oconfig.DebugEndpoints = viper.GetBool("enable-debug-endpoints")
+	if oconfig.MutationHistorySize = viper.GetInt("mutation-history-size"); oconfig.MutationHistorySize < 0 {
+		return operator.Config{}, fmt.Errorf("--mutation-history-size must not be negative, got %d", oconfig.MutationHistorySize)
+	}
+	oconfig.Webhook = webhook.Config{
+		Address:                   viper.GetString("webhook-address"),
+		CertFile:                  viper.GetString("webhook-tls-cert"),
+		KeyFile:                   viper.GetString("webhook-tls-key"),
+		DeleteProtectionThreshold: viper.GetInt("delete-protection-threshold"),
+		WhatIf:                    viper.GetBool("webhook-what-if"),
+	}
+	if oconfig.Webhook.Address != "" && (oconfig.Webhook.CertFile == "" || oconfig.Webhook.KeyFile == "") {
+		return operator.Config{}, fmt.Errorf("the admission webhook requires --webhook-tls-cert and --webhook-tls-key")
+	}
+	if oconfig.ManagedPrefix, oconfig.OwnerAnnotation, err = managedAnnotations(); err != nil {
+		return operator.Config{}, err
+	}
+	if err := registerNodeGroupLabels(); err != nil {
+		return operator.Config{}, err
+	}
+	oconfig.RequeueOnManagedAnnotations = viper.GetBool("requeue-on-managed-annotations")
+	if oconfig.Status, err = statusConfig(); err != nil {
+		return operator.Config{}, err
+	}
+	if oconfig.DesiredState, err = desiredStateConfig(); err != nil {
+		return operator.Config{}, err
+	}
+	if oconfig.CloudEvents, err = cloudEventsConfig(); err != nil {
+		return operator.Config{}, err
+	}
+	if oconfig.KillSwitchConfigMapNamespace, oconfig.KillSwitchConfigMapName, err = killSwitchConfig(); err != nil {
+		return operator.Config{}, err
+	}
+	if oconfig.LeaseConfigMapNamespace, oconfig.LeaseConfigMapName, err = leaderLeaseConfig(); err != nil {
+		return operator.Config{}, err
+	}
+	oconfig.Prewarm = viper.GetBool("prewarm")
+	if oconfig.LeaseDuration = viper.GetDuration("leader-lease-duration"); oconfig.LeaseDuration < 5*time.Second {
+		return operator.Config{}, fmt.Errorf("--leader-lease-duration must be at least 5s, got %s", oconfig.LeaseDuration)
+	}
+	if oconfig.LeaseConfigMapName == "" && oconfig.Prewarm {
+		return operator.Config{}, fmt.Errorf("--prewarm requires --leader-lease-configmap")
+	}
+	if oconfig.LeaseConfigMapName != "" {
+		if oconfig.LeaseIdentity, err = os.Hostname(); err != nil {
+			return operator.Config{}, fmt.Errorf("could not get the operator identity: %s", err)
+		}
+	}
+	if oconfig.FreezeUntil, oconfig.FreezeConfigMapNamespace, oconfig.FreezeConfigMapName, err = freezeConfig(); err != nil {
+		return operator.Config{}, err
 	}
-	return nil
+	return oconfig, nil
 }
@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	kooperlog "github.com/spotahome/kooper/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+	"github.com/joshisa/resource-labeler-operator/service/labeler"
+)
+
+var simulateCmd = &cobra.Command{
+	Use:   "simulate --nodes <file> --rules <dir>",
+	Short: "Report the impact of labelers on a node inventory snapshot, without a cluster",
+	Long: `simulate plans the labelers of the --rules directory (or file) on the nodes of
+the --nodes snapshot (e.g. the output of kubectl get nodes -o json) with the
+operator planning, and reports the changes per labeler and per node. Nothing is
+written to a cluster. With --max-changed-nodes it fails when the labelers change
+more nodes, to gate the labeler changes on their impact in CI.`,
+
+	RunE: runSimulate,
+}
+
+func init() {
+	simulateCmd.Flags().String("nodes", "", "The file with the node inventory snapshot")
+	simulateCmd.Flags().String("rules", "", "The directory (or file) with the labelers, its .yaml, .yml and .json files")
+	simulateCmd.Flags().StringP("output", "o", outputText, "The output format (text or json)")
+	simulateCmd.Flags().Bool("no-color", false, "Don't colorize the text output")
+	simulateCmd.Flags().Int("max-changed-nodes", -1, "Fail if the labelers change more nodes, no limit if negative")
+	rootCmd.AddCommand(simulateCmd)
+}
+
+// ruleImpact is what a labeler changes on the snapshot.
+type ruleImpact struct {
+	Rule string `json:"rule"`
+	// Nodes are the nodes the labeler changes, Changes the attributes it changes.
+	Nodes   int `json:"nodes"`
+	Changes int `json:"changes"`
+}
+
+// nodeImpact is the plan of a node of the snapshot.
+type nodeImpact struct {
+	Node    string           `json:"node"`
+	Rules   []string         `json:"rules"`
+	Changes []labeler.Change `json:"changes"`
+	Error   string           `json:"error,omitempty"`
+}
+
+// simulation is the impact of the labelers on the snapshot.
+type simulation struct {
+	Nodes        int          `json:"nodes"`
+	ChangedNodes int          `json:"changedNodes"`
+	Changes      int          `json:"changes"`
+	Rules        []ruleImpact `json:"rules"`
+	NodeChanges  []nodeImpact `json:"nodeChanges"`
+}
+
+func runSimulate(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	if output != outputText && output != outputJSON {
+		return fmt.Errorf("invalid output format %q, must be %s or %s", output, outputText, outputJSON)
+	}
+	noColor, _ := cmd.Flags().GetBool("no-color")
+	maxChanged, _ := cmd.Flags().GetInt("max-changed-nodes")
+	nodesFile, _ := cmd.Flags().GetString("nodes")
+	rules, _ := cmd.Flags().GetString("rules")
+	if nodesFile == "" || rules == "" {
+		return fmt.Errorf("--nodes and --rules are required")
+	}
+
+	lcfg, err := planningConfig()
+	if err != nil {
+		return err
+	}
+	ruleFiles, err := ruleFiles(rules)
+	if err != nil {
+		return err
+	}
+	var labelers []*labelerv1alpha1.Labeler
+	for _, file := range ruleFiles {
+		err = decodeObjects(file, func(raw []byte) error {
+			l := &labelerv1alpha1.Labeler{}
+			if err := json.Unmarshal(raw, l); err != nil {
+				return err
+			}
+			labelers = append(labelers, l)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(labelers) == 0 {
+		return fmt.Errorf("no labelers in %s", rules)
+	}
+	nodes := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	var nodeList []*corev1.Node
+	err = decodeObjects(nodesFile, func(raw []byte) error {
+		node := &corev1.Node{}
+		if err := json.Unmarshal(raw, node); err != nil {
+			return err
+		}
+		if node.Name == "" {
+			return fmt.Errorf("node without name")
+		}
+		nodeList = append(nodeList, node)
+		return nodes.Add(node)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Plan the labelers in the same order as the operator.
+	labeler.SortLabelers(labelers, lcfg.ConflictTiebreak)
+	var lcs []*labeler.LabelController
+	var names []string
+	for _, l := range labelers {
+		if err := validatePlanning(l); err != nil {
+			return err
+		}
+		lcs = append(lcs, labeler.NewLabelController(lcfg, l, nodes, kooperlog.Dummy))
+		names = append(names, l.Name)
+	}
+	for _, r := range labeler.RedundantLabelers(lcs) {
+		fmt.Fprintf(os.Stderr, "note: %s\n", r)
+	}
+
+	sim := simulate(lcs, names, nodeList, lcfg.OwnerAnnotation)
+	if output == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(sim); err != nil {
+			return err
+		}
+	} else {
+		printSimulation(os.Stdout, sim, !noColor)
+	}
+	if maxChanged >= 0 && sim.ChangedNodes > maxChanged {
+		return fmt.Errorf("the labelers change %d nodes, over --max-changed-nodes %d", sim.ChangedNodes, maxChanged)
+	}
+	return nil
+}
+
+// ruleFiles returns the labeler files of the directory sorted by name, or the file.
+func ruleFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		switch filepath.Ext(e.Name()) {
+		case ".yaml", ".yml", ".json":
+			if !e.IsDir() {
+				files = append(files, filepath.Join(path, e.Name()))
+			}
+		}
+	}
+	return files, nil
+}
+
+// simulate plans the label controllers of the named labelers on the nodes. The changes
+// of a labeler are the attributes its applied mutations change, the dry run labelers
+// don't change anything.
+func simulate(lcs []*labeler.LabelController, names []string, nodes []*corev1.Node, ownerAnnotation string) simulation {
+	sim := simulation{Nodes: len(nodes), Rules: []ruleImpact{}, NodeChanges: []nodeImpact{}}
+	impacts := map[string]*ruleImpact{}
+	for _, name := range names {
+		impacts[name] = &ruleImpact{Rule: name}
+	}
+	ownerKey := "annotations/" + ownerAnnotation
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	for _, node := range nodes {
+		planned, mutations, _, err := labeler.PlanNode(lcs, node)
+		ni := nodeImpact{Node: node.Name, Changes: labeler.Diff(node, planned, ownerAnnotation)}
+		if err != nil {
+			ni.Error = err.Error()
+		}
+		rules := map[string]bool{}
+		for _, m := range mutations {
+			var keys int
+			for _, k := range m.Keys {
+				if k != ownerKey {
+					keys++
+				}
+			}
+			if m.DryRun || keys == 0 || impacts[m.Rule] == nil {
+				continue
+			}
+			if !rules[m.Rule] {
+				rules[m.Rule] = true
+				impacts[m.Rule].Nodes++
+				ni.Rules = append(ni.Rules, m.Rule)
+			}
+			impacts[m.Rule].Changes += keys
+		}
+		if len(ni.Changes) == 0 && ni.Error == "" {
+			continue
+		}
+		if len(ni.Changes) > 0 {
+			sim.ChangedNodes++
+			sim.Changes += len(ni.Changes)
+		}
+		sim.NodeChanges = append(sim.NodeChanges, ni)
+	}
+
+	for _, ri := range impacts {
+		sim.Rules = append(sim.Rules, *ri)
+	}
+	sort.Slice(sim.Rules, func(i, j int) bool {
+		if sim.Rules[i].Changes != sim.Rules[j].Changes {
+			return sim.Rules[i].Changes > sim.Rules[j].Changes
+		}
+		return sim.Rules[i].Rule < sim.Rules[j].Rule
+	})
+	return sim
+}
+
+// printSimulation writes the summary, the labelers table and the changes of every node.
+func printSimulation(w io.Writer, sim simulation, color bool) {
+	fmt.Fprintf(w, "%d labelers on %d nodes: %d nodes changed, %d changes\n\n", len(sim.Rules), sim.Nodes, sim.ChangedNodes, sim.Changes)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LABELER\tNODES\tCHANGES")
+	for _, r := range sim.Rules {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", r.Rule, r.Nodes, r.Changes)
+	}
+	tw.Flush()
+
+	for _, n := range sim.NodeChanges {
+		fmt.Fprintf(w, "\nnode %s (%s)\n", n.Node, strings.Join(n.Rules, ", "))
+		if n.Error != "" {
+			fmt.Fprintf(w, "  error: %s\n", n.Error)
+		}
+		for _, c := range n.Changes {
+			fmt.Fprintln(w, "  "+changeLine(c, color))
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/spf13/cobra"
+	kooperlog "github.com/spotahome/kooper/log"
+
+	"github.com/joshisa/resource-labeler-operator/service/labeler"
+)
+
+var exportStateCmd = &cobra.Command{
+	Use:   "export-state",
+	Short: "Dump the managed keys of every node and their owning labeler as JSON",
+	Long: `export-state reads the owner annotation of every node and prints, as JSON, the
+managed label, annotation and taint keys of each node by owning labeler. The dump
+is the backup import-state restores the ownership from.`,
+
+	RunE: runExportState,
+}
+
+var importStateCmd = &cobra.Command{
+	Use:   "import-state",
+	Short: "Restore the ownership of the managed keys from an export-state dump",
+	Long: `import-state reads an export-state dump and stamps the keys of every node of the
+same name as owned by their labeler again, for instance after the nodes are
+re-registered on a disaster recovery. Only the keys the node has and no other
+labeler owns are imported, importing the dump again changes nothing. Without
+--confirm the changes are only shown.`,
+
+	RunE: runImportState,
+}
+
+// stateFile is the dump of the export-state and import-state commands.
+type stateFile struct {
+	Nodes []labeler.NodeOwnership `json:"nodes"`
+}
+
+func init() {
+	exportStateCmd.Flags().StringP("output", "o", "", "The file the dump is written to, the standard output otherwise")
+	exportStateCmd.Flags().StringP("selector", "l", "", "Only export the nodes matching the label selector")
+	rootCmd.AddCommand(exportStateCmd)
+
+	importStateCmd.Flags().StringP("filename", "f", "", "The JSON or YAML dump of export-state")
+	importStateCmd.Flags().StringP("selector", "l", "", "Only import the nodes matching the label selector")
+	importStateCmd.Flags().Bool("confirm", false, "Write the changes, they are only shown otherwise")
+	rootCmd.AddCommand(importStateCmd)
+}
+
+func runExportState(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	selector, _ := cmd.Flags().GetString("selector")
+	_, ownerAnnotation, err := managedAnnotations()
+	if err != nil {
+		return err
+	}
+
+	_, _, k8sCli, err := GetKubernetesClients(kooperlog.Dummy)
+	if err != nil {
+		return err
+	}
+	nodeList, err := k8sCli.CoreV1().Nodes().List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("could not list nodes: %s", err)
+	}
+
+	sort.Slice(nodeList.Items, func(i, j int) bool { return nodeList.Items[i].Name < nodeList.Items[j].Name })
+	state := stateFile{Nodes: []labeler.NodeOwnership{}}
+	for i := range nodeList.Items {
+		own := labeler.ExportOwnership(&nodeList.Items[i], ownerAnnotation)
+		if len(own.Owned) > 0 {
+			state.Nodes = append(state.Nodes, own)
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(state); err != nil {
+		return fmt.Errorf("could not write the dump: %s", err)
+	}
+	if output != "" {
+		fmt.Fprintf(os.Stderr, "%d nodes exported to %s\n", len(state.Nodes), output)
+	}
+	return nil
+}
+
+func runImportState(cmd *cobra.Command, args []string) error {
+	file, _ := cmd.Flags().GetString("filename")
+	selector, _ := cmd.Flags().GetString("selector")
+	confirm, _ := cmd.Flags().GetBool("confirm")
+	if file == "" {
+		return fmt.Errorf("--filename is required")
+	}
+	state, err := readState(file)
+	if err != nil {
+		return err
+	}
+	_, ownerAnnotation, err := managedAnnotations()
+	if err != nil {
+		return err
+	}
+
+	_, _, k8sCli, err := GetKubernetesClients(kooperlog.Dummy)
+	if err != nil {
+		return err
+	}
+	nodeList, err := k8sCli.CoreV1().Nodes().List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("could not list nodes: %s", err)
+	}
+
+	sort.Slice(nodeList.Items, func(i, j int) bool { return nodeList.Items[i].Name < nodeList.Items[j].Name })
+	changed, failed := 0, 0
+	for i := range nodeList.Items {
+		node := &nodeList.Items[i]
+		own, ok := state[node.Name]
+		if !ok {
+			continue
+		}
+		imported, added, skipped := labeler.ImportOwnership(node, own, ownerAnnotation)
+		for _, s := range skipped {
+			fmt.Fprintf(os.Stderr, "node %s: skipping %s\n", node.Name, s)
+		}
+		delete(state, node.Name)
+		if len(added) == 0 {
+			continue
+		}
+		changed++
+		names := make([]string, 0, len(added))
+		for name := range added {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("node %s: %s owns %s\n", node.Name, name, strings.Join(added[name], ", "))
+		}
+		if !confirm {
+			continue
+		}
+
+		patch, err := labeler.NodeMergePatch(node, imported)
+		if err == nil {
+			_, err = k8sCli.CoreV1().Nodes().Patch(node.Name, types.MergePatchType, patch)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not import node %s: %s\n", node.Name, err)
+			failed++
+		}
+	}
+	if selector == "" {
+		missing := make([]string, 0, len(state))
+		for name := range state {
+			missing = append(missing, name)
+		}
+		sort.Strings(missing)
+		for _, name := range missing {
+			fmt.Fprintf(os.Stderr, "node %s: not found, skipping\n", name)
+		}
+	}
+
+	if changed == 0 {
+		fmt.Println("No ownership to import")
+		return nil
+	}
+	if !confirm {
+		fmt.Printf("\n%d nodes would be imported, run with --confirm to write them\n", changed)
+		return nil
+	}
+	fmt.Printf("\n%d nodes imported\n", changed-failed)
+	if failed > 0 {
+		return fmt.Errorf("%d nodes could not be imported", failed)
+	}
+	return nil
+}
+
+// readState returns the node ownership of the dump by node name.
+func readState(file string) (map[string]labeler.NodeOwnership, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sf stateFile
+	if err := yaml.NewYAMLOrJSONDecoder(f, 4096).Decode(&sf); err != nil {
+		return nil, fmt.Errorf("could not decode %s: %s", file, err)
+	}
+	state := make(map[string]labeler.NodeOwnership, len(sf.Nodes))
+	for _, own := range sf.Nodes {
+		if own.Node == "" {
+			return nil, fmt.Errorf("%s: node without name", file)
+		}
+		if _, ok := state[own.Node]; ok {
+			return nil, fmt.Errorf("%s: duplicated node %s", file, own.Node)
+		}
+		state[own.Node] = own
+	}
+	return state, nil
+}
@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/spf13/cobra"
+
+	"github.com/joshisa/resource-labeler-operator/metrics"
+	"github.com/joshisa/resource-labeler-operator/service/labeler"
+)
+
+// clearScreen moves the cursor home and clears the terminal.
+const clearScreen = "\x1b[H\x1b[2J"
+
+var topCmd = &cobra.Command{
+	Use:   "top",
+	Short: "Show the busiest labelers and nodes of a running operator",
+	Long: `top scrapes the metrics of a running operator every interval and shows the
+labelers by plan rate, with their change and error rates and matched nodes. With
+the operator --enable-events-stream it also follows the mutation stream and shows
+the most mutated nodes since top started.`,
+
+	RunE: runTop,
+}
+
+func init() {
+	topCmd.Flags().String("address", "http://localhost:8080", "The URL of the operator HTTP server (--listen-address)")
+	topCmd.Flags().Duration("interval", 5*time.Second, "The refresh interval, the rates are over it")
+	topCmd.Flags().Int("top", 10, "The number of labelers and nodes shown")
+	topCmd.Flags().String("metrics-prefix", "resource_labeler", "The operator --metrics-namespace and --metrics-subsystem prefix of the metrics")
+	rootCmd.AddCommand(topCmd)
+}
+
+// labelerSample are the metrics of a labeler on a scrape.
+type labelerSample struct {
+	plans   map[string]float64
+	matched float64
+}
+
+// topRow is a labeler of the top table.
+type topRow struct {
+	name    string
+	plans   float64
+	changed float64
+	errors  float64
+	matched float64
+}
+
+// nodeMutations counts the mutations of the nodes on the mutation stream.
+type nodeMutations struct {
+	mu     sync.Mutex
+	counts map[string]int
+	rules  map[string]map[string]bool
+	err    error
+}
+
+func runTop(cmd *cobra.Command, args []string) error {
+	address, _ := cmd.Flags().GetString("address")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	top, _ := cmd.Flags().GetInt("top")
+	prefix, _ := cmd.Flags().GetString("metrics-prefix")
+	if interval <= 0 || top <= 0 {
+		return fmt.Errorf("--interval and --top must be positive")
+	}
+	address = strings.TrimSuffix(address, "/")
+
+	client := &http.Client{Timeout: interval}
+	prev, err := scrapeLabelers(client, address+"/metrics", prefix)
+	if err != nil {
+		return err
+	}
+	nm := &nodeMutations{counts: map[string]int{}, rules: map[string]map[string]bool{}}
+	go nm.follow(address + "/events")
+
+	for range time.Tick(interval) {
+		cur, err := scrapeLabelers(client, address+"/metrics", prefix)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not scrape the operator metrics: %s\n", err)
+			continue
+		}
+		fmt.Print(clearScreen)
+		printTop(os.Stdout, topRows(prev, cur, interval), nm, top, interval)
+		prev = cur
+	}
+	return nil
+}
+
+// scrapeLabelers returns the labeler metrics of the operator by labeler.
+func scrapeLabelers(client *http.Client, url, prefix string) (map[string]*labelerSample, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded %s", url, resp.Status)
+	}
+	var parser expfmt.TextParser
+	mfs, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := map[string]*labelerSample{}
+	sample := func(m *dto.Metric) *labelerSample {
+		name := metricLabel(m, "labeler")
+		if samples[name] == nil {
+			samples[name] = &labelerSample{plans: map[string]float64{}}
+		}
+		return samples[name]
+	}
+	if mf, ok := mfs[prefix+"_labeler_plans_total"]; ok {
+		for _, m := range mf.GetMetric() {
+			sample(m).plans[metricLabel(m, "result")] = m.GetCounter().GetValue()
+		}
+	}
+	if mf, ok := mfs[prefix+"_labeler_matched_nodes"]; ok {
+		for _, m := range mf.GetMetric() {
+			sample(m).matched = m.GetGauge().GetValue()
+		}
+	}
+	return samples, nil
+}
+
+func metricLabel(m *dto.Metric, name string) string {
+	for _, lp := range m.GetLabel() {
+		if lp.GetName() == name {
+			return lp.GetValue()
+		}
+	}
+	return ""
+}
+
+// topRows returns the labelers with their rates per second between the scrapes, the
+// busiest first. Restarted counters count from zero.
+func topRows(prev, cur map[string]*labelerSample, interval time.Duration) []topRow {
+	rate := func(name, result string) float64 {
+		v := cur[name].plans[result]
+		if p, ok := prev[name]; ok && p.plans[result] <= v {
+			v -= p.plans[result]
+		}
+		return v / interval.Seconds()
+	}
+	var rows []topRow
+	for name, s := range cur {
+		row := topRow{
+			name:    name,
+			changed: rate(name, metrics.PlanChanged),
+			errors:  rate(name, metrics.PlanError),
+			matched: s.matched,
+		}
+		row.plans = row.changed + row.errors + rate(name, metrics.PlanUnchanged)
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].plans != rows[j].plans {
+			return rows[i].plans > rows[j].plans
+		}
+		return rows[i].name < rows[j].name
+	})
+	return rows
+}
+
+func printTop(w io.Writer, rows []topRow, nm *nodeMutations, top int, interval time.Duration) {
+	fmt.Fprintf(w, "%s, rates per second over %s\n\n", time.Now().Format(time.RFC3339), interval)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LABELER\tPLANS/S\tCHANGES/S\tERRORS/S\tERROR %\tMATCHED NODES")
+	for i, r := range rows {
+		if i == top {
+			break
+		}
+		pct := 0.0
+		if r.plans > 0 {
+			pct = r.errors / r.plans * 100
+		}
+		fmt.Fprintf(tw, "%s\t%.2f\t%.2f\t%.2f\t%.1f\t%.0f\n", r.name, r.plans, r.changed, r.errors, pct, r.matched)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	if nm.err != nil {
+		fmt.Fprintf(w, "no node mutations: %s\n", nm.err)
+		return
+	}
+	nodes := make([]string, 0, len(nm.counts))
+	for n := range nm.counts {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nm.counts[nodes[i]] != nm.counts[nodes[j]] {
+			return nm.counts[nodes[i]] > nm.counts[nodes[j]]
+		}
+		return nodes[i] < nodes[j]
+	})
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tMUTATIONS\tLABELERS")
+	for i, n := range nodes {
+		if i == top {
+			break
+		}
+		var rules []string
+		for r := range nm.rules[n] {
+			rules = append(rules, r)
+		}
+		sort.Strings(rules)
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", n, nm.counts[n], strings.Join(rules, ","))
+	}
+	tw.Flush()
+}
+
+// follow counts the applied mutations of the stream, it records why if the stream is
+// not available.
+func (nm *nodeMutations) follow(url string) {
+	resp, err := http.Get(url)
+	if err == nil && resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		err = fmt.Errorf("%s responded %s, is --enable-events-stream set?", url, resp.Status)
+	}
+	if err != nil {
+		nm.mu.Lock()
+		nm.err = err
+		nm.mu.Unlock()
+		return
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data := strings.TrimPrefix(scanner.Text(), "data: ")
+		var m labeler.Mutation
+		if data == scanner.Text() || json.Unmarshal([]byte(data), &m) != nil || m.DryRun {
+			continue
+		}
+		nm.mu.Lock()
+		nm.counts[m.Node]++
+		if nm.rules[m.Node] == nil {
+			nm.rules[m.Node] = map[string]bool{}
+		}
+		nm.rules[m.Node][m.Rule] = true
+		nm.mu.Unlock()
+	}
+	err = scanner.Err()
+	if err == nil {
+		err = fmt.Errorf("the operator closed it")
+	}
+	nm.mu.Lock()
+	nm.err = fmt.Errorf("the mutation stream ended: %s", err)
+	nm.mu.Unlock()
+}
@@ -0,0 +1,142 @@
+package desiredstate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/joshisa/resource-labeler-operator/log"
+)
+
+// maxBytes bounds the ConfigMap data, below the 1MiB object limit so the rest of the
+// object fits.
+const maxBytes = 1000 * 1024
+
+// errTooLarge is returned when the desired state doesn't fit the ConfigMap, it's only
+// warned when its size changes.
+var errTooLarge = errors.New("desired state too large")
+
+// Config is the desired state publisher configuration.
+type Config struct {
+	// Namespace and Name are the ConfigMap the desired state is published to.
+	Namespace string
+	Name      string
+	// Interval is how often the desired state is checked for changes.
+	Interval time.Duration
+}
+
+// Source knows the desired labels of the nodes.
+type Source interface {
+	DesiredLabels() map[string]map[string]string
+}
+
+// Publisher publishes the desired labels of every node to a ConfigMap, one key per
+// node with its labels as JSON, so GitOps tooling can diff the intended state. It's
+// observability only, the nodes are not mutated by it.
+type Publisher struct {
+	cfg    Config
+	source Source
+	k8sCli kubernetes.Interface
+	logger log.Logger
+
+	// published is the last published data, the nodes of this instance.
+	published map[string]string
+	// tooLarge is the size of the last data not published for being too large.
+	tooLarge int
+}
+
+// NewPublisher returns a new desired state publisher.
+func NewPublisher(cfg Config, source Source, k8sCli kubernetes.Interface, logger log.Logger) *Publisher {
+	return &Publisher{
+		cfg:    cfg,
+		source: source,
+		k8sCli: k8sCli,
+		logger: logger,
+	}
+}
+
+// Run publishes the desired state until stopC is closed. Satisfies kooper controller.Controller interface.
+func (p *Publisher) Run(stopC <-chan struct{}) error {
+	p.logger.Infof("publishing the desired state to %s/%s configmap", p.cfg.Namespace, p.cfg.Name)
+	wait.Until(p.check, p.cfg.Interval, stopC)
+	return nil
+}
+
+// check publishes the desired state if it changed since the last publish.
+func (p *Publisher) check() {
+	data := map[string]string{}
+	for node, labels := range p.source.DesiredLabels() {
+		b, err := json.Marshal(labels)
+		if err != nil {
+			p.logger.Warningf("could not encode the desired labels of node %s: %s", node, err)
+			return
+		}
+		data[node] = string(b)
+	}
+	if p.published != nil && reflect.DeepEqual(p.published, data) {
+		return
+	}
+	if err := p.publish(data); err != nil {
+		if err != errTooLarge {
+			p.logger.Warningf("could not publish the desired state: %s", err)
+		}
+		return
+	}
+	p.published = data
+}
+
+// publish writes the desired labels on the node keys of the ConfigMap, removing the
+// nodes published before that are gone, creating the ConfigMap if needed. The keys of
+// other nodes (e.g. of other operator instances) are kept.
+func (p *Publisher) publish(data map[string]string) error {
+	cms := p.k8sCli.CoreV1().ConfigMaps(p.cfg.Namespace)
+	cm, err := cms.Get(p.cfg.Name, metav1.GetOptions{})
+	notFound := apierrors.IsNotFound(err)
+	if err != nil && !notFound {
+		return err
+	}
+	if notFound {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: p.cfg.Name, Namespace: p.cfg.Namespace}}
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	for node := range p.published {
+		if _, ok := data[node]; !ok {
+			delete(cm.Data, node)
+		}
+	}
+	for node, labels := range data {
+		cm.Data[node] = labels
+	}
+
+	size := 0
+	for k, v := range cm.Data {
+		size += len(k) + len(v)
+	}
+	if size > maxBytes {
+		if size != p.tooLarge {
+			p.logger.Warningf("desired state of %d nodes is %d bytes, over the %d bytes the %s/%s configmap can hold, not published", len(data), size, maxBytes, p.cfg.Namespace, p.cfg.Name)
+			p.tooLarge = size
+		}
+		return errTooLarge
+	}
+	p.tooLarge = 0
+
+	if notFound {
+		_, err = cms.Create(cm)
+		return err
+	}
+	if _, err := cms.Update(cm); err != nil {
+		return fmt.Errorf("could not update %s/%s configmap: %s", p.cfg.Namespace, p.cfg.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package desiredstate
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	kooperlog "github.com/spotahome/kooper/log"
+)
+
+// configMapServer is a test API server of a single ConfigMap, it gets, creates and
+// updates it counting the writes.
+type configMapServer struct {
+	mu     sync.Mutex
+	cm     *corev1.ConfigMap
+	writes []string
+}
+
+func (s *configMapServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodGet && s.cm != nil:
+		json.NewEncoder(w).Encode(s.cm)
+	case r.Method == http.MethodPost && s.cm == nil, r.Method == http.MethodPut && s.cm != nil:
+		cm := &corev1.ConfigMap{}
+		if err := json.NewDecoder(r.Body).Decode(cm); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		cm.APIVersion, cm.Kind = "v1", "ConfigMap"
+		s.cm = cm
+		s.writes = append(s.writes, r.Method)
+		json.NewEncoder(w).Encode(cm)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(metav1.Status{Status: metav1.StatusFailure, Code: http.StatusNotFound, Reason: metav1.StatusReasonNotFound})
+	}
+}
+
+// data returns the data of the ConfigMap, nil if it doesn't exist.
+func (s *configMapServer) data() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cm == nil {
+		return nil
+	}
+	return s.cm.Data
+}
+
+// staticSource is a source of fixed desired labels.
+type staticSource map[string]map[string]string
+
+func (s staticSource) DesiredLabels() map[string]map[string]string { return s }
+
+func newTestPublisher(t *testing.T, s *configMapServer, source Source) (*Publisher, func()) {
+	srv := httptest.NewServer(s)
+	cli, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewPublisher(Config{Namespace: "ops", Name: "desired"}, source, cli, kooperlog.Dummy), srv.Close
+}
+
+func TestPublisherCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		cm        *corev1.ConfigMap
+		source    staticSource
+		expData   map[string]string
+		expWrites []string
+	}{
+		{
+			name:      "A missing ConfigMap is created with a key per node.",
+			source:    staticSource{"n1": {"team": "a"}, "n2": {}},
+			expData:   map[string]string{"n1": `{"team":"a"}`, "n2": `{}`},
+			expWrites: []string{http.MethodPost},
+		},
+		{
+			name:      "An existing ConfigMap is updated keeping the keys of other nodes.",
+			cm:        &corev1.ConfigMap{Data: map[string]string{"n1": `{"team":"b"}`, "other": `{"team":"c"}`}},
+			source:    staticSource{"n1": {"team": "a"}},
+			expData:   map[string]string{"n1": `{"team":"a"}`, "other": `{"team":"c"}`},
+			expWrites: []string{http.MethodPut},
+		},
+		{
+			name:      "An existing ConfigMap without data is updated.",
+			cm:        &corev1.ConfigMap{},
+			source:    staticSource{"n1": {"team": "a"}},
+			expData:   map[string]string{"n1": `{"team":"a"}`},
+			expWrites: []string{http.MethodPut},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &configMapServer{}
+			if test.cm != nil {
+				test.cm.Name, test.cm.Namespace = "desired", "ops"
+				s.cm = test.cm
+			}
+			p, stop := newTestPublisher(t, s, test.source)
+			defer stop()
+
+			p.check()
+			// An unchanged desired state is not published again.
+			p.check()
+			if !reflect.DeepEqual(s.data(), test.expData) {
+				t.Errorf("expected the data %v, got %v", test.expData, s.data())
+			}
+			if !reflect.DeepEqual(s.writes, test.expWrites) {
+				t.Errorf("expected the writes %v, got %v", test.expWrites, s.writes)
+			}
+		})
+	}
+}
+
+func TestPublisherRemovesGoneNodes(t *testing.T) {
+	s := &configMapServer{cm: &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "desired", Namespace: "ops"},
+		Data:       map[string]string{"other": `{}`},
+	}}
+	source := staticSource{"n1": {"team": "a"}, "n2": {"team": "b"}}
+	p, stop := newTestPublisher(t, s, source)
+	defer stop()
+
+	p.check()
+	delete(source, "n2")
+	p.check()
+
+	// The published nodes that are gone are removed, not the keys of other nodes.
+	exp := map[string]string{"n1": `{"team":"a"}`, "other": `{}`}
+	if !reflect.DeepEqual(s.data(), exp) {
+		t.Errorf("expected the data %v, got %v", exp, s.data())
+	}
+	if n := len(s.writes); n != 2 {
+		t.Errorf("expected a write per change, got %d", n)
+	}
+}
+
+func TestPublisherTooLarge(t *testing.T) {
+	s := &configMapServer{}
+	source := staticSource{"n1": {"team": strings.Repeat("a", maxBytes)}}
+	p, stop := newTestPublisher(t, s, source)
+	defer stop()
+
+	p.check()
+	if s.data() != nil || len(s.writes) != 0 {
+		t.Fatalf("expected a desired state over the size limit not published, got %v", s.writes)
+	}
+	if p.tooLarge == 0 {
+		t.Errorf("expected the size of the desired state not published kept")
+	}
+
+	// The desired state is published once it fits.
+	source["n1"] = map[string]string{"team": "a"}
+	p.check()
+	if exp := map[string]string{"n1": `{"team":"a"}`}; !reflect.DeepEqual(s.data(), exp) {
+		t.Errorf("expected the data %v, got %v", exp, s.data())
+	}
+	if p.tooLarge != 0 {
+		t.Errorf("expected the size reset once published, got %d", p.tooLarge)
+	}
+}
@@ -0,0 +1,69 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// JSON is a logger that writes every entry as a single JSON object per line.
+type JSON struct {
+	out   io.Writer
+	debug bool
+	mu    sync.Mutex
+}
+
+// NewJSON returns a new JSON logger that writes to out.
+func NewJSON(out io.Writer) *JSON {
+	return &JSON{
+		out: out,
+	}
+}
+
+// Infof satisfies Logger interface.
+func (j *JSON) Infof(format string, args ...interface{}) {
+	j.write("info", fmt.Sprintf(format, args...), nil)
+}
+
+// Warningf satisfies Logger interface.
+func (j *JSON) Warningf(format string, args ...interface{}) {
+	j.write("warning", fmt.Sprintf(format, args...), nil)
+}
+
+// Errorf satisfies Logger interface.
+func (j *JSON) Errorf(format string, args ...interface{}) {
+	j.write("error", fmt.Sprintf(format, args...), nil)
+}
+
+// Debugf satisfies DebugLogger interface, the entry is only written with the debug level.
+func (j *JSON) Debugf(format string, args ...interface{}) {
+	if j.debug {
+		j.write("debug", fmt.Sprintf(format, args...), nil)
+	}
+}
+
+// InfoFields satisfies FieldLogger interface.
+func (j *JSON) InfoFields(msg string, fields map[string]interface{}) {
+	j.write("info", msg, fields)
+}
+
+func (j *JSON) write(level, msg string, fields map[string]interface{}) {
+	entry := make(map[string]interface{}, len(fields)+3)
+	for k, v := range fields {
+		entry[k] = v
+	}
+	entry["time"] = time.Now().UTC().Format(time.RFC3339)
+	entry["level"] = level
+	entry["msg"] = msg
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		b = []byte(fmt.Sprintf(`{"level":"error","msg":"could not marshal log entry: %s"}`, err))
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.out.Write(append(b, '\n'))
+}
@@ -1,11 +1,89 @@
 package log
 
 import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
 	"github.com/spotahome/kooper/log"
 )
 
+// Log formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Log levels.
+const (
+	LevelInfo  = "info"
+	LevelDebug = "debug"
+)
+
 // Logger is the interface of the operator logger. This is an example
 // so our Loggger will be the same as the kooper one.
 type Logger interface {
 	log.Logger
 }
+
+// FieldLogger is a logger that knows how to log structured entries.
+type FieldLogger interface {
+	InfoFields(msg string, fields map[string]interface{})
+}
+
+// DebugLogger is a logger that knows how to log debug entries.
+type DebugLogger interface {
+	Debugf(format string, args ...interface{})
+}
+
+// New returns a logger for the required format and level.
+func New(format, level string) (Logger, error) {
+	var debug bool
+	switch level {
+	case LevelInfo, "":
+	case LevelDebug:
+		debug = true
+	default:
+		return nil, fmt.Errorf("%q is not a valid log level", level)
+	}
+
+	switch format {
+	case FormatText, "":
+		return &Text{debug: debug}, nil
+	case FormatJSON:
+		j := NewJSON(os.Stderr)
+		j.debug = debug
+		return j, nil
+	default:
+		return nil, fmt.Errorf("%q is not a valid log format", format)
+	}
+}
+
+// Debugf logs a debug entry, it's dropped if the logger doesn't support debug entries.
+func Debugf(logger log.Logger, format string, args ...interface{}) {
+	if dl, ok := logger.(DebugLogger); ok {
+		dl.Debugf(format, args...)
+	}
+}
+
+// InfoFields logs a single structured entry. If the logger doesn't support
+// structured entries the fields will be appended to the message as key=value.
+func InfoFields(logger Logger, msg string, fields map[string]interface{}) {
+	if fl, ok := logger.(FieldLogger); ok {
+		fl.InfoFields(msg, fields)
+		return
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, fmt.Sprintf("%s=%v", k, fields[k]))
+	}
+	logger.Infof("%s: %s", msg, strings.Join(kvs, " "))
+}
@@ -0,0 +1,193 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spotahome/kooper/log"
+)
+
+// recorder is a logger that records the info messages.
+type recorder struct {
+	log.Logger
+	infos []string
+}
+
+func (r *recorder) Infof(format string, args ...interface{}) {
+	r.infos = append(r.infos, fmt.Sprintf(format, args...))
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		level    string
+		expDebug bool
+		expErr   bool
+	}{
+		{name: "An empty format and level is text with info.", format: "", level: ""},
+		{name: "The text format.", format: FormatText, level: LevelInfo},
+		{name: "The json format.", format: FormatJSON, level: LevelInfo},
+		{name: "The text format with debug.", format: FormatText, level: LevelDebug, expDebug: true},
+		{name: "The json format with debug.", format: FormatJSON, level: LevelDebug, expDebug: true},
+		{name: "An unknown format is an error.", format: "xml", expErr: true},
+		{name: "An unknown level is an error.", format: FormatJSON, level: "trace", expErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger, err := New(test.format, test.level)
+			if (err != nil) != test.expErr {
+				t.Fatalf("expected error %t, got %v", test.expErr, err)
+			}
+			if test.expErr {
+				return
+			}
+			var debug bool
+			switch l := logger.(type) {
+			case *Text:
+				debug = l.debug
+			case *JSON:
+				debug = l.debug
+			default:
+				t.Fatalf("unexpected logger %T", logger)
+			}
+			if debug != test.expDebug {
+				t.Errorf("expected debug %t, got %t", test.expDebug, debug)
+			}
+		})
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewJSON(&out)
+	logger.Warningf("node %s not ready", "n1")
+	logger.InfoFields("effective configuration", map[string]interface{}{"master": "https://k8s", "msg": "overridden"})
+
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("expected one line per entry, got %q", out.String())
+	}
+	entries := make([]map[string]interface{}, len(lines))
+	for i, line := range lines {
+		if err := json.Unmarshal(line, &entries[i]); err != nil {
+			t.Fatalf("expected a JSON object per line, got %q: %s", line, err)
+		}
+		ts, _ := entries[i]["time"].(string)
+		if _, err := time.Parse(time.RFC3339, ts); err != nil {
+			t.Errorf("expected an RFC3339 time, got %q", ts)
+		}
+		delete(entries[i], "time")
+	}
+
+	exp := []map[string]interface{}{
+		{"level": "warning", "msg": "node n1 not ready"},
+		// The entry keys win over the fields.
+		{"level": "info", "msg": "effective configuration", "master": "https://k8s"},
+	}
+	if !reflect.DeepEqual(entries, exp) {
+		t.Errorf("expected %v, got %v", exp, entries)
+	}
+}
+
+func TestDebugf(t *testing.T) {
+	var info, debug bytes.Buffer
+	Debugf(&JSON{out: &info}, "node %s synced", "n1")
+	Debugf(&JSON{out: &debug, debug: true}, "node %s synced", "n1")
+	// A logger without debug entries drops them.
+	Debugf(&recorder{}, "node %s synced", "n1")
+
+	if info.Len() != 0 {
+		t.Errorf("expected no debug entries with the info level, got %q", info.String())
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(debug.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["level"] != "debug" || entry["msg"] != "node n1 synced" {
+		t.Errorf("expected the debug entry, got %v", entry)
+	}
+}
+
+func TestInfoFields(t *testing.T) {
+	fields := map[string]interface{}{"resync-period": "30s", "kubeconfig": "<redacted>", "master": ""}
+
+	// The structured loggers log the fields on the entry.
+	var out bytes.Buffer
+	InfoFields(NewJSON(&out), "effective configuration", fields)
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["resync-period"] != "30s" || entry["kubeconfig"] != "<redacted>" {
+		t.Errorf("expected the fields on the entry, got %v", entry)
+	}
+
+	// The other loggers log them sorted on the message.
+	r := &recorder{}
+	InfoFields(r, "effective configuration", fields)
+	exp := []string{"effective configuration: kubeconfig=<redacted> master= resync-period=30s"}
+	if !reflect.DeepEqual(r.infos, exp) {
+		t.Errorf("expected %q, got %q", exp, r.infos)
+	}
+}
+
+func TestWith(t *testing.T) {
+	// The JSON loggers log the fields on the entries, the last value of a key wins.
+	var out bytes.Buffer
+	logger := With(With(With(NewJSON(&out), "node", "n1"), "request", "r1"), "node", "n2")
+	logger.Warningf("node %s not ready", "n2")
+	Debugf(logger, "dropped without debug")
+	InfoFields(logger, "synced", map[string]interface{}{"request": "r2", "patched": true})
+
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 entries, got %q", out.String())
+	}
+	exp := []map[string]interface{}{
+		{"level": "warning", "msg": "node n2 not ready", "node": "n2", "request": "r1"},
+		// The fields of the entry win over the logger ones.
+		{"level": "info", "msg": "synced", "node": "n2", "request": "r2", "patched": true},
+	}
+	for i, line := range lines {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatal(err)
+		}
+		delete(entry, "time")
+		if !reflect.DeepEqual(entry, exp[i]) {
+			t.Errorf("expected %v, got %v", exp[i], entry)
+		}
+	}
+
+	// The other loggers prefix the message with the fields sorted.
+	r := &recorder{}
+	With(With(r, "request", "r1"), "node", "n1").Infof("node %s synced", "n1")
+	if exp := []string{"node=n1 request=r1 node n1 synced"}; !reflect.DeepEqual(r.infos, exp) {
+		t.Errorf("expected %q, got %q", exp, r.infos)
+	}
+}
+
+func TestWithDebugf(t *testing.T) {
+	var out bytes.Buffer
+	With(&JSON{out: &out, debug: true}, "node", "n1").(DebugLogger).Debugf("node %s synced", "n1")
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["level"] != "debug" || entry["node"] != "n1" {
+		t.Errorf("expected the debug entry with the field, got %v", entry)
+	}
+
+	// A logger without debug entries still drops them.
+	r := &recorder{}
+	With(r, "node", "n1").(DebugLogger).Debugf("node %s synced", "n1")
+	if len(r.infos) != 0 {
+		t.Errorf("expected the debug entries dropped, got %q", r.infos)
+	}
+}
@@ -0,0 +1,20 @@
+package log
+
+import (
+	stdlog "log"
+
+	"github.com/spotahome/kooper/log"
+)
+
+// Text is the kooper standard library logger with debug entries.
+type Text struct {
+	log.Std
+	debug bool
+}
+
+// Debugf satisfies DebugLogger interface, the entry is only written with the debug level.
+func (t *Text) Debugf(format string, args ...interface{}) {
+	if t.debug {
+		stdlog.Printf("[DEBUG] "+format, args...)
+	}
+}
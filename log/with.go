@@ -0,0 +1,85 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// fieldsLogger is a logger adding fields to every entry.
+type fieldsLogger struct {
+	base   Logger
+	fields map[string]interface{}
+	// prefix has the fields as key=value for the loggers without structured entries.
+	prefix string
+}
+
+// With returns a logger adding the field to every entry of the logger: a field of the
+// JSON entries, or a key=value prefix of the message of the others.
+func With(logger Logger, key string, value interface{}) Logger {
+	fields := map[string]interface{}{key: value}
+	if fl, ok := logger.(*fieldsLogger); ok {
+		for k, v := range fl.fields {
+			if k != key {
+				fields[k] = v
+			}
+		}
+		logger = fl.base
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, fmt.Sprintf("%s=%v", k, fields[k]))
+	}
+	return &fieldsLogger{base: logger, fields: fields, prefix: strings.Join(kvs, " ") + " "}
+}
+
+func (f *fieldsLogger) log(level string, logf func(string, ...interface{}), format string, args []interface{}) {
+	if j, ok := f.base.(*JSON); ok {
+		j.write(level, fmt.Sprintf(format, args...), f.fields)
+		return
+	}
+	logf(f.prefix+format, args...)
+}
+
+// Infof satisfies Logger interface.
+func (f *fieldsLogger) Infof(format string, args ...interface{}) {
+	f.log("info", f.base.Infof, format, args)
+}
+
+// Warningf satisfies Logger interface.
+func (f *fieldsLogger) Warningf(format string, args ...interface{}) {
+	f.log("warning", f.base.Warningf, format, args)
+}
+
+// Errorf satisfies Logger interface.
+func (f *fieldsLogger) Errorf(format string, args ...interface{}) {
+	f.log("error", f.base.Errorf, format, args)
+}
+
+// Debugf satisfies DebugLogger interface, the entry is dropped like by the logger.
+func (f *fieldsLogger) Debugf(format string, args ...interface{}) {
+	if j, ok := f.base.(*JSON); ok {
+		if j.debug {
+			j.write("debug", fmt.Sprintf(format, args...), f.fields)
+		}
+		return
+	}
+	Debugf(f.base, f.prefix+format, args...)
+}
+
+// InfoFields satisfies FieldLogger interface, the entry fields come first.
+func (f *fieldsLogger) InfoFields(msg string, fields map[string]interface{}) {
+	all := make(map[string]interface{}, len(f.fields)+len(fields))
+	for k, v := range f.fields {
+		all[k] = v
+	}
+	for k, v := range fields {
+		all[k] = v
+	}
+	InfoFields(f.base, msg, all)
+}
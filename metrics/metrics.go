@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"time"
+)
+
+// Informers.
+const (
+	InformerNodes    = "nodes"
+	InformerLabelers = "labelers"
+	InformerPods     = "pods"
+)
+
+// Labeler plan results.
+const (
+	PlanChanged   = "changed"
+	PlanUnchanged = "unchanged"
+	PlanError     = "error"
+	PlanDeferred  = "deferred"
+)
+
+// Recorder knows how to record the operator metrics.
+type Recorder interface {
+	// SetInformerCacheObjects sets the number of objects on the cache of an informer.
+	SetInformerCacheObjects(informer string, n int)
+	// SetInformerLastSync sets the last time an informer received objects (list, watch
+	// event or resync).
+	SetInformerLastSync(informer string, t time.Time)
+	// IncInformerRestarts increments the number of times an informer has been restarted.
+	IncInformerRestarts(informer string)
+	// SetLabelerNoMatches sets whether a labeler has the NoMatches condition.
+	SetLabelerNoMatches(labeler string, noMatches bool)
+	// ObserveStateCache records a lookup on a per node state cache, hit or miss.
+	ObserveStateCache(cache string, hit bool)
+	// SetCircuitBreakerOpen sets whether the circuit breaker pauses the node mutations.
+	SetCircuitBreakerOpen(open bool)
+	// IncForeignOverwrites increments the values a labeler replaced without owning
+	// them, by their manager.
+	IncForeignOverwrites(labeler, manager string)
+	// IncNodeSyncs increments the node syncs by outcome (e.g. patched, unchanged).
+	IncNodeSyncs(outcome string)
+	// SetWorkers sets the number of running node workers.
+	SetWorkers(n int)
+	// ObserveLabelerConvergence records how long a labeler spec change took to be
+	// applied on all the selected nodes.
+	ObserveLabelerConvergence(labeler string, elapsed time.Duration)
+	// DeleteLabelerMetrics removes the metrics of a deleted labeler.
+	DeleteLabelerMetrics(labeler string)
+	// SetLabelerMetricsLabels sets the values of the extra labels of the per labeler
+	// metrics of a labeler, the ones it doesn't set are empty.
+	SetLabelerMetricsLabels(labeler string, labels map[string]string)
+	// IncStatusWritesSuppressed increments the status changes not published right away
+	// by the status update coalescing.
+	IncStatusWritesSuppressed()
+	// IncNonIdempotentSyncs increments the node patches the labeler still wants to
+	// change right after them.
+	IncNonIdempotentSyncs(labeler string)
+	// IncEventsDropped increments the node events dropped by the rate limit.
+	IncEventsDropped(reason string)
+	// SetExemptNodes sets the number of nodes exempted from the labeler by their
+	// exempt annotation.
+	SetExemptNodes(labeler string, n int)
+	// IncChunkedPatches increments the node patches applied in sequential chunks.
+	IncChunkedPatches()
+	// IncCloudEventsFailures increments the node mutations not delivered to the
+	// cloudevents sink, dropped by the full queue or failed after the retries.
+	IncCloudEventsFailures(reason string)
+	// AddAuditCorrections adds the nodes an audit found not in the desired state and
+	// queued for correction.
+	AddAuditCorrections(n int)
+	// IncLabelerPlans increments the plans of the labeler on a node by result.
+	IncLabelerPlans(labeler, result string)
+	// SetLabelerMatchedNodes sets the number of nodes the labeler is applied to.
+	SetLabelerMatchedNodes(labeler string, n int)
+	// SetNodeQueueDepth sets the number of nodes ready to sync of the priority class.
+	SetNodeQueueDepth(priority string, n int)
+	// SetLabelerRedundant sets whether a labeler is redundant with another one.
+	SetLabelerRedundant(labeler string, redundant bool)
+	// SetOrphanedNodes sets the number of nodes with orphaned managed keys.
+	SetOrphanedNodes(n int)
+	// SetBackpressure sets whether the node queue is under backpressure.
+	SetBackpressure(active bool)
+	// IncReconcilePanics increments the node syncs recovered from a panic.
+	IncReconcilePanics()
+	// SetLeader sets whether the operator instance holds the leader lease and the
+	// holder of the lease.
+	SetLeader(leading bool, holder string)
+	// IncLeaderTransitions increments the leadership transitions of the leader lease.
+	IncLeaderTransitions()
+}
+
+// Dummy recorder doesn't record anything.
+var Dummy Recorder = &dummy{}
+
+type dummy struct{}
+
+func (d *dummy) SetInformerCacheObjects(informer string, n int)                   {}
+func (d *dummy) SetInformerLastSync(informer string, t time.Time)                 {}
+func (d *dummy) IncInformerRestarts(informer string)                              {}
+func (d *dummy) SetLabelerNoMatches(labeler string, noMatches bool)               {}
+func (d *dummy) ObserveStateCache(cache string, hit bool)                         {}
+func (d *dummy) SetCircuitBreakerOpen(open bool)                                  {}
+func (d *dummy) IncForeignOverwrites(labeler, manager string)                     {}
+func (d *dummy) IncNodeSyncs(outcome string)                                      {}
+func (d *dummy) SetWorkers(n int)                                                 {}
+func (d *dummy) ObserveLabelerConvergence(labeler string, elapsed time.Duration)  {}
+func (d *dummy) DeleteLabelerMetrics(labeler string)                              {}
+func (d *dummy) SetLabelerMetricsLabels(labeler string, labels map[string]string) {}
+func (d *dummy) IncStatusWritesSuppressed()                                       {}
+func (d *dummy) IncNonIdempotentSyncs(labeler string)                             {}
+func (d *dummy) IncEventsDropped(reason string)                                   {}
+func (d *dummy) SetExemptNodes(labeler string, n int)                             {}
+func (d *dummy) IncChunkedPatches()                                               {}
+func (d *dummy) IncCloudEventsFailures(reason string)                             {}
+func (d *dummy) AddAuditCorrections(n int)                                        {}
+func (d *dummy) IncLabelerPlans(labeler, result string)                           {}
+func (d *dummy) SetLabelerMatchedNodes(labeler string, n int)                     {}
+func (d *dummy) SetNodeQueueDepth(priority string, n int)                         {}
+func (d *dummy) SetLabelerRedundant(labeler string, redundant bool)               {}
+func (d *dummy) SetOrphanedNodes(n int)                                           {}
+func (d *dummy) SetBackpressure(active bool)                                      {}
+func (d *dummy) IncReconcilePanics()                                              {}
+func (d *dummy) SetLeader(leading bool, holder string)                            {}
+func (d *dummy) IncLeaderTransitions()                                            {}
@@ -0,0 +1,546 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// DefaultNamespace is the default namespace of the metrics.
+	DefaultNamespace = "resource_labeler"
+	// InstanceLabel is the label with the operator instance on every metric.
+	InstanceLabel = "instance"
+)
+
+// Config is the Prometheus metrics configuration.
+type Config struct {
+	// Namespace and Subsystem prefix the metric names (default namespace is
+	// DefaultNamespace).
+	Namespace string
+	Subsystem string
+	// Instance is the value of the instance label on every metric, the label is not
+	// set if empty.
+	Instance string
+	// LabelerLabels are the extra labels of the per labeler metrics, their values are
+	// set by labeler with SetLabelerMetricsLabels.
+	LabelerLabels []string
+}
+
+// Prometheus implements the metrics recording in a prometheus registry.
+type Prometheus struct {
+	informerCacheObjects   *prometheus.GaugeVec
+	informerLastSync       *prometheus.GaugeVec
+	informerRestarts       *prometheus.CounterVec
+	labelerNoMatches       *prometheus.GaugeVec
+	stateCacheLookups      *prometheus.CounterVec
+	circuitBreakerOpen     prometheus.Gauge
+	labelerConvergence     *prometheus.HistogramVec
+	workers                prometheus.Gauge
+	foreignOverwrites      *prometheus.CounterVec
+	nodeSyncs              *prometheus.CounterVec
+	statusWritesSuppressed prometheus.Counter
+	nonIdempotentSyncs     *prometheus.CounterVec
+	eventsDropped          *prometheus.CounterVec
+	exemptNodes            *prometheus.GaugeVec
+	chunkedPatches         prometheus.Counter
+	cloudEventsFailures    *prometheus.CounterVec
+	auditCorrections       prometheus.Counter
+	labelerPlans           *prometheus.CounterVec
+	labelerMatchedNodes    *prometheus.GaugeVec
+	nodeQueueDepth         *prometheus.GaugeVec
+	labelerRedundant       *prometheus.GaugeVec
+	orphanedNodes          prometheus.Gauge
+
+	// labelerLabelNames are the extra labels of the per labeler metrics, with their
+	// values by labeler.
+	labelerLabelNames []string
+	labelerLabelsMu   sync.RWMutex
+	labelerLabels     map[string][]string
+	backpressure      prometheus.Gauge
+	reconcilePanics   prometheus.Counter
+	isLeader          prometheus.Gauge
+	leader            *prometheus.GaugeVec
+	leaderTransitions prometheus.Counter
+}
+
+// NewPrometheus returns a new Prometheus metrics backend. The metrics already registered
+// on the registry (e.g. by a previous instance of the operator) are reused.
+func NewPrometheus(cfg Config, reg prometheus.Registerer) *Prometheus {
+	if cfg.Namespace == "" {
+		cfg.Namespace = DefaultNamespace
+	}
+	var constLabels prometheus.Labels
+	if cfg.Instance != "" {
+		constLabels = prometheus.Labels{InstanceLabel: cfg.Instance}
+	}
+
+	// labelerKeys returns the labels of a per labeler metric.
+	labelerKeys := func(rest ...string) []string {
+		keys := append([]string{"labeler"}, cfg.LabelerLabels...)
+		return append(keys, rest...)
+	}
+
+	p := &Prometheus{
+		labelerLabelNames: cfg.LabelerLabels,
+		labelerLabels:     map[string][]string{},
+		informerCacheObjects: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "informer_cache_objects",
+			Help:        "Number of objects on the cache of the informer.",
+		}, []string{"informer"}),
+
+		informerLastSync: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "informer_last_sync_timestamp_seconds",
+			Help:        "Last time the informer received objects (list, watch event or resync).",
+		}, []string{"informer"}),
+
+		informerRestarts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "informer_restarts_total",
+			Help:        "Number of times the informer has been restarted by the watchdog.",
+		}, []string{"informer"}),
+
+		labelerNoMatches: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "labeler_no_matches",
+			Help:        "Whether the labeler has matched no nodes for longer than the no matches window (1) or not (0).",
+		}, labelerKeys()),
+
+		stateCacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "state_cache_lookups_total",
+			Help:        "Number of lookups on the per node state caches by result (hit or miss).",
+		}, []string{"cache", "result"}),
+
+		circuitBreakerOpen: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "circuit_breaker_open",
+			Help:        "Whether the circuit breaker pauses the node mutations (1) or not (0).",
+		}),
+
+		labelerConvergence: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "convergence_seconds",
+			Help:        "Time from observing a labeler spec change until it's applied on all the selected nodes.",
+			Buckets:     prometheus.ExponentialBuckets(1, 2, 12),
+		}, labelerKeys()),
+
+		workers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "workers",
+			Help:        "Number of running node workers.",
+		}),
+
+		foreignOverwrites: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "foreign_overwrites_total",
+			Help:        "Number of node values the labeler replaced without owning them, by their manager (another labeler or unknown).",
+		}, labelerKeys("manager")),
+
+		nodeSyncs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "node_syncs_total",
+			Help:        "Number of node syncs by outcome (patched, unchanged, skipped, frozen, paused, draining, not-found, not-synced or error).",
+		}, []string{"outcome"}),
+
+		statusWritesSuppressed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "status_writes_suppressed_total",
+			Help:        "Number of status changes not published right away by the status update coalescing.",
+		}),
+
+		nonIdempotentSyncs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "non_idempotent_syncs_total",
+			Help:        "Number of node patches a second plan still wants to change, by labeler (with --verify-idempotent).",
+		}, labelerKeys()),
+
+		eventsDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "events_dropped_total",
+			Help:        "Number of node events dropped by the event rate limit, by reason.",
+		}, []string{"reason"}),
+
+		exemptNodes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "exempt_nodes",
+			Help:        "Number of nodes exempted from the labeler by their exempt annotation.",
+		}, labelerKeys()),
+
+		chunkedPatches: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "chunked_patches_total",
+			Help:        "Number of node patches over --max-patch-bytes applied in sequential chunks.",
+		}),
+
+		cloudEventsFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "cloudevents_delivery_failures_total",
+			Help:        "The node mutations not delivered to the cloudevents sink by reason.",
+		}, []string{"reason"}),
+
+		auditCorrections: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "audit_corrections_total",
+			Help:        "The nodes the audits found not in the desired state and queued for correction.",
+		}),
+
+		labelerPlans: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "labeler_plans_total",
+			Help:        "The plans of the labelers on the nodes by result.",
+		}, labelerKeys("result")),
+
+		labelerMatchedNodes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "labeler_matched_nodes",
+			Help:        "The number of nodes the labeler is applied to.",
+		}, labelerKeys()),
+
+		nodeQueueDepth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "node_queue_depth",
+			Help:        "The nodes ready to sync in the node queue by priority class.",
+		}, []string{"priority"}),
+
+		labelerRedundant: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "labeler_redundant",
+			Help:        "Whether the labeler is redundant with another one, 1 or 0.",
+		}, labelerKeys()),
+
+		orphanedNodes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "orphaned_nodes",
+			Help:        "Number of nodes with managed keys of labelers that no longer exist or no longer set them, on the last orphan sweep.",
+		}),
+
+		backpressure: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "backpressure",
+			Help:        "Whether the node queue is over the backpressure high-water mark (1) or not (0).",
+		}),
+
+		reconcilePanics: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "reconcile_panics_total",
+			Help:        "Number of node syncs recovered from a panic.",
+		}),
+
+		isLeader: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "is_leader",
+			Help:        "Whether the operator instance holds the leader lease (1) or not (0).",
+		}),
+
+		leader: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "leader",
+			Help:        "The holder of the leader lease, 1 for its identity.",
+		}, []string{"identity"}),
+
+		leaderTransitions: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			ConstLabels: constLabels,
+			Name:        "leader_transitions_total",
+			Help:        "Number of leadership transitions of the leader lease observed by the operator instance.",
+		}),
+	}
+
+	p.informerCacheObjects = register(reg, p.informerCacheObjects).(*prometheus.GaugeVec)
+	p.informerLastSync = register(reg, p.informerLastSync).(*prometheus.GaugeVec)
+	p.informerRestarts = register(reg, p.informerRestarts).(*prometheus.CounterVec)
+	p.labelerNoMatches = register(reg, p.labelerNoMatches).(*prometheus.GaugeVec)
+	p.stateCacheLookups = register(reg, p.stateCacheLookups).(*prometheus.CounterVec)
+	p.circuitBreakerOpen = register(reg, p.circuitBreakerOpen).(prometheus.Gauge)
+	p.labelerConvergence = register(reg, p.labelerConvergence).(*prometheus.HistogramVec)
+	p.workers = register(reg, p.workers).(prometheus.Gauge)
+	p.foreignOverwrites = register(reg, p.foreignOverwrites).(*prometheus.CounterVec)
+	p.nodeSyncs = register(reg, p.nodeSyncs).(*prometheus.CounterVec)
+	p.statusWritesSuppressed = register(reg, p.statusWritesSuppressed).(prometheus.Counter)
+	p.nonIdempotentSyncs = register(reg, p.nonIdempotentSyncs).(*prometheus.CounterVec)
+	p.eventsDropped = register(reg, p.eventsDropped).(*prometheus.CounterVec)
+	p.exemptNodes = register(reg, p.exemptNodes).(*prometheus.GaugeVec)
+	p.chunkedPatches = register(reg, p.chunkedPatches).(prometheus.Counter)
+	p.cloudEventsFailures = register(reg, p.cloudEventsFailures).(*prometheus.CounterVec)
+	p.auditCorrections = register(reg, p.auditCorrections).(prometheus.Counter)
+	p.labelerPlans = register(reg, p.labelerPlans).(*prometheus.CounterVec)
+	p.labelerMatchedNodes = register(reg, p.labelerMatchedNodes).(*prometheus.GaugeVec)
+	p.nodeQueueDepth = register(reg, p.nodeQueueDepth).(*prometheus.GaugeVec)
+	p.labelerRedundant = register(reg, p.labelerRedundant).(*prometheus.GaugeVec)
+	p.orphanedNodes = register(reg, p.orphanedNodes).(prometheus.Gauge)
+	p.backpressure = register(reg, p.backpressure).(prometheus.Gauge)
+	p.reconcilePanics = register(reg, p.reconcilePanics).(prometheus.Counter)
+	p.isLeader = register(reg, p.isLeader).(prometheus.Gauge)
+	p.leader = register(reg, p.leader).(*prometheus.GaugeVec)
+	p.leaderTransitions = register(reg, p.leaderTransitions).(prometheus.Counter)
+	return p
+}
+
+// register registers the collector, if it's already registered it returns the
+// registered one.
+func register(reg prometheus.Registerer, c prometheus.Collector) prometheus.Collector {
+	if err := reg.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector
+		}
+		panic(err)
+	}
+	return c
+}
+
+// SetInformerCacheObjects satisfies Recorder interface.
+func (p *Prometheus) SetInformerCacheObjects(informer string, n int) {
+	p.informerCacheObjects.WithLabelValues(informer).Set(float64(n))
+}
+
+// SetInformerLastSync satisfies Recorder interface.
+func (p *Prometheus) SetInformerLastSync(informer string, t time.Time) {
+	p.informerLastSync.WithLabelValues(informer).Set(float64(t.Unix()))
+}
+
+// IncInformerRestarts satisfies Recorder interface.
+func (p *Prometheus) IncInformerRestarts(informer string) {
+	p.informerRestarts.WithLabelValues(informer).Inc()
+}
+
+// SetLabelerNoMatches satisfies Recorder interface.
+func (p *Prometheus) SetLabelerNoMatches(labeler string, noMatches bool) {
+	v := 0.0
+	if noMatches {
+		v = 1
+	}
+	p.labelerNoMatches.WithLabelValues(p.labelerValues(labeler)...).Set(v)
+}
+
+// ObserveStateCache satisfies Recorder interface.
+func (p *Prometheus) ObserveStateCache(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	p.stateCacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+// SetCircuitBreakerOpen satisfies Recorder interface.
+func (p *Prometheus) SetCircuitBreakerOpen(open bool) {
+	v := 0.0
+	if open {
+		v = 1
+	}
+	p.circuitBreakerOpen.Set(v)
+}
+
+// IncForeignOverwrites satisfies Recorder interface.
+func (p *Prometheus) IncForeignOverwrites(labeler, manager string) {
+	p.foreignOverwrites.WithLabelValues(p.labelerValues(labeler, manager)...).Inc()
+}
+
+// IncNodeSyncs satisfies Recorder interface.
+func (p *Prometheus) IncNodeSyncs(outcome string) {
+	p.nodeSyncs.WithLabelValues(outcome).Inc()
+}
+
+// SetWorkers satisfies Recorder interface.
+func (p *Prometheus) SetWorkers(n int) {
+	p.workers.Set(float64(n))
+}
+
+// ObserveLabelerConvergence satisfies Recorder interface.
+func (p *Prometheus) ObserveLabelerConvergence(labeler string, elapsed time.Duration) {
+	p.labelerConvergence.WithLabelValues(p.labelerValues(labeler)...).Observe(elapsed.Seconds())
+}
+
+// DeleteLabelerMetrics satisfies Recorder interface.
+func (p *Prometheus) DeleteLabelerMetrics(labeler string) {
+	values := p.labelerValues(labeler)
+	p.labelerNoMatches.DeleteLabelValues(values...)
+	p.labelerConvergence.DeleteLabelValues(values...)
+	p.exemptNodes.DeleteLabelValues(values...)
+	p.labelerMatchedNodes.DeleteLabelValues(values...)
+	p.labelerRedundant.DeleteLabelValues(values...)
+	for _, result := range []string{PlanChanged, PlanUnchanged, PlanError, PlanDeferred} {
+		p.labelerPlans.DeleteLabelValues(p.labelerValues(labeler, result)...)
+	}
+	p.labelerLabelsMu.Lock()
+	delete(p.labelerLabels, labeler)
+	p.labelerLabelsMu.Unlock()
+}
+
+// SetLabelerMetricsLabels satisfies Recorder interface.
+func (p *Prometheus) SetLabelerMetricsLabels(labeler string, labels map[string]string) {
+	values := make([]string, 0, len(p.labelerLabelNames))
+	for _, name := range p.labelerLabelNames {
+		values = append(values, labels[name])
+	}
+	p.labelerLabelsMu.Lock()
+	defer p.labelerLabelsMu.Unlock()
+	p.labelerLabels[labeler] = values
+}
+
+// labelerValues returns the label values of a per labeler metric: the labeler, its
+// extra labels (empty if not set) and the rest.
+func (p *Prometheus) labelerValues(labeler string, rest ...string) []string {
+	values := make([]string, 0, 1+len(p.labelerLabelNames)+len(rest))
+	values = append(values, labeler)
+	p.labelerLabelsMu.RLock()
+	extra, ok := p.labelerLabels[labeler]
+	p.labelerLabelsMu.RUnlock()
+	if !ok {
+		extra = make([]string, len(p.labelerLabelNames))
+	}
+	values = append(values, extra...)
+	return append(values, rest...)
+}
+
+// IncStatusWritesSuppressed satisfies Recorder interface.
+func (p *Prometheus) IncStatusWritesSuppressed() {
+	p.statusWritesSuppressed.Inc()
+}
+
+// IncNonIdempotentSyncs satisfies Recorder interface.
+func (p *Prometheus) IncNonIdempotentSyncs(labeler string) {
+	p.nonIdempotentSyncs.WithLabelValues(p.labelerValues(labeler)...).Inc()
+}
+
+// IncEventsDropped satisfies Recorder interface.
+func (p *Prometheus) IncEventsDropped(reason string) {
+	p.eventsDropped.WithLabelValues(reason).Inc()
+}
+
+// SetExemptNodes satisfies Recorder interface.
+func (p *Prometheus) SetExemptNodes(labeler string, n int) {
+	p.exemptNodes.WithLabelValues(p.labelerValues(labeler)...).Set(float64(n))
+}
+
+// IncChunkedPatches satisfies Recorder interface.
+func (p *Prometheus) IncChunkedPatches() {
+	p.chunkedPatches.Inc()
+}
+
+// IncCloudEventsFailures satisfies Recorder interface.
+func (p *Prometheus) IncCloudEventsFailures(reason string) {
+	p.cloudEventsFailures.WithLabelValues(reason).Inc()
+}
+
+// AddAuditCorrections satisfies Recorder interface.
+func (p *Prometheus) AddAuditCorrections(n int) {
+	p.auditCorrections.Add(float64(n))
+}
+
+// IncLabelerPlans satisfies Recorder interface.
+func (p *Prometheus) IncLabelerPlans(labeler, result string) {
+	p.labelerPlans.WithLabelValues(p.labelerValues(labeler, result)...).Inc()
+}
+
+// SetLabelerMatchedNodes satisfies Recorder interface.
+func (p *Prometheus) SetLabelerMatchedNodes(labeler string, n int) {
+	p.labelerMatchedNodes.WithLabelValues(p.labelerValues(labeler)...).Set(float64(n))
+}
+
+// SetNodeQueueDepth satisfies Recorder interface.
+func (p *Prometheus) SetNodeQueueDepth(priority string, n int) {
+	p.nodeQueueDepth.WithLabelValues(priority).Set(float64(n))
+}
+
+// SetLabelerRedundant satisfies Recorder interface.
+func (p *Prometheus) SetLabelerRedundant(labeler string, redundant bool) {
+	v := 0.0
+	if redundant {
+		v = 1
+	}
+	p.labelerRedundant.WithLabelValues(p.labelerValues(labeler)...).Set(v)
+}
+
+// SetOrphanedNodes satisfies Recorder interface.
+func (p *Prometheus) SetOrphanedNodes(n int) {
+	p.orphanedNodes.Set(float64(n))
+}
+
+// SetBackpressure satisfies Recorder interface.
+func (p *Prometheus) SetBackpressure(active bool) {
+	v := 0.0
+	if active {
+		v = 1
+	}
+	p.backpressure.Set(v)
+}
+
+// IncReconcilePanics satisfies Recorder interface.
+func (p *Prometheus) IncReconcilePanics() {
+	p.reconcilePanics.Inc()
+}
+
+// SetLeader satisfies Recorder interface.
+func (p *Prometheus) SetLeader(leading bool, holder string) {
+	v := 0.0
+	if leading {
+		v = 1
+	}
+	p.isLeader.Set(v)
+	p.leader.Reset()
+	if holder != "" {
+		p.leader.WithLabelValues(holder).Set(1)
+	}
+}
+
+// IncLeaderTransitions satisfies Recorder interface.
+func (p *Prometheus) IncLeaderTransitions() {
+	p.leaderTransitions.Inc()
+}
@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gather returns the metrics of the registry by name.
+func gather(t *testing.T, reg *prometheus.Registry) map[string][]*dto.Metric {
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := map[string][]*dto.Metric{}
+	for _, mf := range mfs {
+		metrics[mf.GetName()] = mf.GetMetric()
+	}
+	return metrics
+}
+
+// labels returns the labels of the metric.
+func labels(m *dto.Metric) map[string]string {
+	ls := map[string]string{}
+	for _, l := range m.GetLabel() {
+		ls[l.GetName()] = l.GetValue()
+	}
+	return ls
+}
+
+func TestPrometheusNames(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       Config
+		expName   string
+		expLabels map[string]string
+	}{
+		{
+			name:      "The default namespace without instance label.",
+			expName:   "resource_labeler_reconcile_panics_total",
+			expLabels: map[string]string{},
+		},
+		{
+			name:      "The namespace, subsystem and instance label.",
+			cfg:       Config{Namespace: "ops", Subsystem: "labeler", Instance: "eu"},
+			expName:   "ops_labeler_reconcile_panics_total",
+			expLabels: map[string]string{InstanceLabel: "eu"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			NewPrometheus(test.cfg, reg).IncReconcilePanics()
+
+			ms := gather(t, reg)[test.expName]
+			if len(ms) != 1 {
+				t.Fatalf("expected the %s metric, got %v", test.expName, ms)
+			}
+			if got := labels(ms[0]); !reflect.DeepEqual(got, test.expLabels) {
+				t.Errorf("expected the labels %v, got %v", test.expLabels, got)
+			}
+			if v := ms[0].GetCounter().GetValue(); v != 1 {
+				t.Errorf("expected 1 panic, got %v", v)
+			}
+		})
+	}
+}
+
+func TestNewPrometheusReusesRegistered(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	NewPrometheus(Config{}, reg).IncNodeSyncs("patched")
+	// A second instance on the same registry doesn't panic and records on the same
+	// metrics.
+	NewPrometheus(Config{}, reg).IncNodeSyncs("patched")
+
+	ms := gather(t, reg)["resource_labeler_node_syncs_total"]
+	if len(ms) != 1 || ms[0].GetCounter().GetValue() != 2 {
+		t.Errorf("expected 2 patched syncs, got %v", ms)
+	}
+}
+
+func TestPrometheusLabelerLabels(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	p := NewPrometheus(Config{LabelerLabels: []string{"team", "tier"}}, reg)
+	p.SetLabelerMetricsLabels("gpu", map[string]string{"team": "ml", "other": "x"})
+	p.SetLabelerMatchedNodes("gpu", 3)
+	p.SetLabelerMatchedNodes("cpu", 5)
+
+	exp := map[string]map[string]string{
+		"gpu": {"labeler": "gpu", "team": "ml", "tier": ""},
+		// The labels of a labeler without extra labels set are empty.
+		"cpu": {"labeler": "cpu", "team": "", "tier": ""},
+	}
+	ms := gather(t, reg)["resource_labeler_labeler_matched_nodes"]
+	if len(ms) != 2 {
+		t.Fatalf("expected a metric by labeler, got %v", ms)
+	}
+	for _, m := range ms {
+		ls := labels(m)
+		if !reflect.DeepEqual(ls, exp[ls["labeler"]]) {
+			t.Errorf("expected the labels %v, got %v", exp[ls["labeler"]], ls)
+		}
+	}
+
+	// The metrics of a deleted labeler are removed, with its extra labels.
+	p.DeleteLabelerMetrics("gpu")
+	ms = gather(t, reg)["resource_labeler_labeler_matched_nodes"]
+	if len(ms) != 1 || labels(ms[0])["labeler"] != "cpu" {
+		t.Errorf("expected only the cpu labeler metric, got %v", ms)
+	}
+	if _, ok := p.labelerLabels["gpu"]; ok {
+		t.Errorf("expected the extra labels of the deleted labeler removed")
+	}
+}
+
+func TestPrometheusLeader(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	p := NewPrometheus(Config{}, reg)
+	p.SetLeader(false, "a")
+	p.IncLeaderTransitions()
+	p.SetLeader(true, "b")
+	p.IncLeaderTransitions()
+
+	ms := gather(t, reg)
+	if v := ms["resource_labeler_leader_transitions_total"][0].GetCounter().GetValue(); v != 2 {
+		t.Errorf("expected 2 transitions, got %v", v)
+	}
+	if v := ms["resource_labeler_is_leader"][0].GetGauge().GetValue(); v != 1 {
+		t.Errorf("expected the instance leading, got %v", v)
+	}
+	// Only the last holder is set.
+	if leader := ms["resource_labeler_leader"]; len(leader) != 1 || labels(leader[0])["identity"] != "b" {
+		t.Errorf("expected the b holder, got %v", leader)
+	}
+}
@@ -1,18 +1,231 @@
 package operator
 
 import (
+	"math/rand"
 	"time"
+
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/joshisa/resource-labeler-operator/apis/labeler"
+	"github.com/joshisa/resource-labeler-operator/cloudevents"
+	"github.com/joshisa/resource-labeler-operator/desiredstate"
+	"github.com/joshisa/resource-labeler-operator/metrics"
+	"github.com/joshisa/resource-labeler-operator/server"
+	"github.com/joshisa/resource-labeler-operator/status"
+	"github.com/joshisa/resource-labeler-operator/webhook"
 )
 
 // Config is the controller configuration.
 type Config struct {
 	// ResyncPeriod is the resync period of the operator.
 	ResyncPeriod time.Duration
+	// ResyncJitter is the fraction of the resync period it was randomized within.
+	ResyncJitter float64
+	// OrphanPolicy is what is done with the managed keys of the deleted labelers
+	// (keep, report or remove), swept every OrphanSweepInterval.
+	OrphanPolicy        string
+	OrphanSweepInterval time.Duration
+	// BackpressureHighWater and BackpressureLowWater are the node queue depths entering
+	// and leaving the backpressure, disabled without high-water mark.
+	BackpressureHighWater int
+	BackpressureLowWater  int
+	// ReportRedundant reports the labelers redundant with another one.
+	ReportRedundant bool
+	// LabelerVersions are the group/versions of the labelers watched besides the
+	// internal one, e.g. during a CRD migration.
+	LabelerVersions []string
+	// Metrics is the metrics naming configuration.
+	Metrics metrics.Config
+	// MetricsLabelsLimit is the maximum of distinct value sets of the labelers
+	// metricsLabels, the Metrics LabelerLabels.
+	MetricsLabelsLimit int
+	// ListenAddress is the address of the HTTP server exposing the operator endpoints.
+	ListenAddress string
+	// ListenTLS is the TLS configuration of the HTTP server, plain HTTP without
+	// certificate.
+	ListenTLS server.TLS
+	// DebugEndpoints enables the /debug endpoints (e.g. /debug/queue with the node
+	// queue content).
+	DebugEndpoints bool
+	// MutationHistorySize is the number of recent mutations served on
+	// /debug/mutations with the debug endpoints, 0 disables the history.
+	MutationHistorySize int
+	// EventsStream enables the /events endpoint streaming the node mutations.
+	EventsStream bool
+	// WatchTable prints the recent node mutations as a table on the standard output,
+	// for the local development.
+	WatchTable bool
+	// CloudEvents is the CloudEvents sender configuration, the node mutations are not
+	// sent if it doesn't have a sink.
+	CloudEvents cloudevents.Config
+	// Webhook is the admission webhook configuration, the webhook is disabled
+	// if it doesn't have an address.
+	Webhook webhook.Config
+	// ManagedPrefix is the prefix of the annotations used by the operator.
+	ManagedPrefix string
+	// OwnerAnnotation is the node annotation with the attributes owned by the labelers.
+	OwnerAnnotation string
+	// RequeueOnManagedAnnotations syncs the nodes again when only their managed
+	// annotations changed.
+	RequeueOnManagedAnnotations bool
+	// WatchTimeout is the time without node lists, watches or watch events after which
+	// the node informer is restarted, 0 disables it.
+	WatchTimeout time.Duration
+	// Workers is the number of nodes synced concurrently.
+	Workers int
+	// MaxWorkers scales the workers up to this number on queue backlogs, 0 keeps
+	// them static.
+	MaxWorkers int
+	// TaintEvictionReport reports the pods evicted by the NoExecute taints before
+	// applying them.
+	TaintEvictionReport bool
+	// DryRun plans and reports the changes of all the labelers without applying them.
+	DryRun bool
+	// RequireApplyTrigger stages the changes of every labeler generation until the
+	// labeler has the apply trigger annotation.
+	RequireApplyTrigger bool
+	// MaxBlastRadius holds back the labeler generations newly selecting more nodes
+	// until allowed, 0 disables it.
+	MaxBlastRadius int
+	// CombinePolicy is how the labelers applied on the same node combine, union or strict.
+	CombinePolicy string
+	// ConflictTiebreak is the order the labelers are applied in, so which one wins a
+	// conflicting key.
+	ConflictTiebreak string
+	// SkipDrainingNodes defers the sync of the nodes being drained for DrainingRequeue.
+	SkipDrainingNodes bool
+	DrainingRequeue   time.Duration
+	// EventQPS and EventBurst rate limit the events of a node and reason.
+	EventQPS   float32
+	EventBurst int
+	// IndexNodes indexes the node cache so the labeler changes only sync their
+	// candidate nodes.
+	IndexNodes bool
+	// VerifyIdempotent reports the labelers still changing the just patched nodes.
+	VerifyIdempotent bool
+	// MaxPatchBytes is the size over which the node patches are chunked.
+	MaxPatchBytes int
+	// AnnotationsGuardBytes is the maximum total size of the node annotations patched.
+	AnnotationsGuardBytes int
+	// NodeName restricts the operator to the node with this name (optional).
+	NodeName string
+	// WatchPods watches the pods of the nodes for the value sources that need them.
+	WatchPods bool
+	// WatchReferences watches the objects the labelers reference and syncs their nodes
+	// again when they change.
+	WatchReferences bool
+	// WatchNodeLeases lists the node leases for the value sources that need them.
+	WatchNodeLeases bool
+	// WatchSchedulingFailures watches the FailedScheduling events for the value
+	// sources that need them.
+	WatchSchedulingFailures bool
+	// AllowReserved allows the labelers to write keys with reserved prefixes.
+	AllowReserved bool
+	// MatchLabelAllowlist are the only label keys the labelers can match the nodes
+	// on, empty allows every key.
+	MatchLabelAllowlist []string
+	// ProtectKeys are the keys the labelers set but never remove.
+	ProtectKeys []string
+	// AllowedTaintEffects are the only taint effects the labelers can merge.
+	AllowedTaintEffects []string
+	// HTTPSourceHosts are the only URL hosts the http value sources can get.
+	HTTPSourceHosts []string
+	// HTTPSourceSecrets are the only Secrets the http value sources can send.
+	HTTPSourceSecrets []string
+	// ContentHash skips syncing the nodes whose content didn't change since all the
+	// labelers were applied.
+	ContentHash bool
+	// PatchType is the patch type of the node mutations (merge, json, strategic or
+	// apply).
+	PatchType string
+	// AppliedBy is the operator version and instance stamped with the time on the
+	// nodes it mutates, empty disables the stamps.
+	AppliedBy string
+	// FingerprintAnnotation is the node annotation with the fingerprint of the managed
+	// keys and values, empty disables it.
+	FingerprintAnnotation string
+	// ErrorCircuitThreshold is the sync error rate (0-1) over the error circuit window
+	// that pauses the node mutations, 0 disables it.
+	ErrorCircuitThreshold float64
+	// ErrorCircuitWindow is the window of the error rate and how long the mutations
+	// are paused.
+	ErrorCircuitWindow time.Duration
+	// SpreadInitialReconcile staggers the first sync of the nodes after startup
+	// across this window, 0 disables it.
+	SpreadInitialReconcile time.Duration
+	// LogNoop logs the syncs that don't change the nodes at info level.
+	LogNoop bool
+	// MaxChangesPerPass caps the nodes every labeler changes per resync period, 0
+	// doesn't cap them.
+	MaxChangesPerPass int
+	// MaxUnavailablePerZone caps the disruptive mutations in flight in every zone
+	// for ZoneDisruptionWindow after their patch, 0 doesn't cap them.
+	MaxUnavailablePerZone int
+	ZoneDisruptionWindow  time.Duration
+	// ZoneLabel is the node label with the zone, the well-known ones if empty.
+	ZoneLabel string
+	// ZoneAPIServers are the preferred API server URLs of the node mutations by zone,
+	// ZoneClients their clients.
+	ZoneAPIServers map[string]string
+	ZoneClients    map[string]kubernetes.Interface
+	// AuditInterval is the period of the node audits, 0 disables them.
+	AuditInterval time.Duration
+	// AuditStart is the time the audits are aligned to, zero doesn't align them.
+	AuditStart time.Time
+	// StateCacheSize is the maximum number of entries of every per node state cache.
+	StateCacheSize int
+	// NoMatchesWindow is the time a labeler can match no nodes before having the
+	// NoMatches condition, 0 disables it.
+	NoMatchesWindow time.Duration
+	// SpecHistorySize is the number of spec edits kept by labeler for the status.
+	SpecHistorySize int
+	// RetryPolicies are the retry policies of the failed node syncs by error class.
+	RetryPolicies map[string]string
+	// CrashOnPanic lets the panics of the node syncs crash the operator.
+	CrashOnPanic bool
+	// FreezeUntil pauses the node mutations until this time.
+	FreezeUntil time.Time
+	// FreezeConfigMapNamespace and FreezeConfigMapName are the sentinel ConfigMap
+	// freezing the node mutations at runtime, disabled without name.
+	FreezeConfigMapNamespace string
+	FreezeConfigMapName      string
+	// KillSwitchConfigMapNamespace and KillSwitchConfigMapName are the watched ConfigMap
+	// stopping the node mutations, disabled without name.
+	KillSwitchConfigMapNamespace string
+	KillSwitchConfigMapName      string
+	// LeaseConfigMapNamespace and LeaseConfigMapName are the leader lease ConfigMap of
+	// the operator instances, disabled without name. LeaseIdentity is the instance
+	// identity on the lease, Prewarm syncs the caches while waiting for it.
+	LeaseConfigMapNamespace string
+	LeaseConfigMapName      string
+	LeaseIdentity           string
+	LeaseDuration           time.Duration
+	Prewarm                 bool
+	// LeaseClient is the client of the leader lease calls, with their timeout.
+	LeaseClient kubernetes.Interface
+	// Status is the status publisher configuration, the status is not published if
+	// it doesn't have a ConfigMap name.
+	Status status.Config
+	// DesiredState is the desired state publisher configuration, the desired state is
+	// not published if it doesn't have a ConfigMap name.
+	DesiredState desiredstate.Config
 }
 
 // NewOperatorConfig converts the command line flag arguments to operator configuration.
-func NewOperatorConfig(t time.Duration) Config {
+// The resync period is randomized once within ±jitter (a fraction of it), so that the
+// operators of many clusters don't resync at the same time.
+func NewOperatorConfig(t time.Duration, jitter float64) Config {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 	return Config{
-		ResyncPeriod: t,
+		ResyncPeriod:    jitterPeriod(t, jitter, r.Float64()),
+		ResyncJitter:    jitter,
+		ManagedPrefix:   labeler.GroupName,
+		OwnerAnnotation: labeler.OwnedKeysAnnotation,
 	}
 }
+
+// jitterPeriod returns the period moved by the jitter fraction of it, from -jitter (f is
+// 0) to +jitter (f is 1).
+func jitterPeriod(t time.Duration, jitter, f float64) time.Duration {
+	return t + time.Duration(float64(t)*jitter*(2*f-1))
+}
@@ -0,0 +1,42 @@
+package operator
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/joshisa/resource-labeler-operator/service/labeler"
+)
+
+// queueInspector returns the content of the node queue.
+type queueInspector interface {
+	QueueSnapshot() labeler.QueueSnapshot
+}
+
+// mutationsHandler serves the recent mutations of the history as JSON, of the node
+// query parameter if set.
+func mutationsHandler(h *labeler.MutationHistory) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(h.Mutations(r.URL.Query().Get("node")))
+	})
+}
+
+// queueHandler serves the content of the node queue as JSON.
+func queueHandler(qi queueInspector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(qi.QueueSnapshot())
+	})
+}
@@ -1,13 +1,29 @@
 package operator
 
 import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spotahome/kooper/client/crd"
 	"github.com/spotahome/kooper/operator"
 	"github.com/spotahome/kooper/operator/controller"
+	"github.com/spotahome/kooper/operator/resource"
 	"k8s.io/client-go/kubernetes"
 
+	apilabeler "github.com/joshisa/resource-labeler-operator/apis/labeler"
 	labelerk8scli "github.com/joshisa/resource-labeler-operator/client/k8s/clientset/versioned"
+	"github.com/joshisa/resource-labeler-operator/cloudevents"
+	"github.com/joshisa/resource-labeler-operator/desiredstate"
 	"github.com/joshisa/resource-labeler-operator/log"
+	"github.com/joshisa/resource-labeler-operator/metrics"
+	"github.com/joshisa/resource-labeler-operator/server"
+	"github.com/joshisa/resource-labeler-operator/service/labeler"
+	"github.com/joshisa/resource-labeler-operator/status"
+	"github.com/joshisa/resource-labeler-operator/stream"
+	"github.com/joshisa/resource-labeler-operator/watchtable"
+	"github.com/joshisa/resource-labeler-operator/webhook"
 )
 
 // New returns pod terminator operator.
@@ -15,13 +31,228 @@ func New(cfg Config, labelerCli labelerk8scli.Interface, crdCli crd.Interface, k
 
 	// Create crd.
 	ptCRD := newLabelerCRD(labelerCli, crdCli, kubeCli)
+	gvs, err := ParseLabelerVersions(cfg.LabelerVersions)
+	if err != nil {
+		return nil, err
+	}
+	// The apply patch type needs server-side apply.
+	if cfg.PatchType == labeler.PatchApply {
+		if err := labeler.CheckServerSideApply(kubeCli); err != nil {
+			return nil, fmt.Errorf("--patch-type %s: %s", labeler.PatchApply, err)
+		}
+	}
+
+	// Create the metrics recorder and expose them.
+	metricsRecorder := metrics.NewPrometheus(cfg.Metrics, prometheus.DefaultRegisterer)
+	srv := server.New(cfg.ListenAddress, cfg.ListenTLS, logger)
+	srv.Handle("/metrics", prometheus.Handler())
+
+	// Track the labelers of every version, the orphaned keys are only swept once they
+	// are all listed.
+	versions := labelerVersionNames(gvs)
+	lsync := newLabelerSync(versions)
+
+	lcfg := labeler.Config{
+		ResyncPeriod:                 cfg.ResyncPeriod,
+		MetricsRecorder:              metricsRecorder,
+		OwnerAnnotation:              cfg.OwnerAnnotation,
+		WatchTimeout:                 cfg.WatchTimeout,
+		Workers:                      cfg.Workers,
+		MaxWorkers:                   cfg.MaxWorkers,
+		TaintEvictionReport:          cfg.TaintEvictionReport,
+		WatchPods:                    cfg.WatchPods,
+		WatchReferences:              cfg.WatchReferences,
+		WatchNodeLeases:              cfg.WatchNodeLeases,
+		WatchSchedulingFailures:      cfg.WatchSchedulingFailures,
+		NodeName:                     cfg.NodeName,
+		AnnotationsGuardBytes:        cfg.AnnotationsGuardBytes,
+		MaxPatchBytes:                cfg.MaxPatchBytes,
+		VerifyIdempotent:             cfg.VerifyIdempotent,
+		IndexNodes:                   cfg.IndexNodes,
+		TrackDesiredLabels:           cfg.DesiredState.Name != "",
+		EventQPS:                     cfg.EventQPS,
+		EventBurst:                   cfg.EventBurst,
+		SkipDrainingNodes:            cfg.SkipDrainingNodes,
+		DrainingRequeue:              cfg.DrainingRequeue,
+		DrainingAnnotation:           apilabeler.Annotation(cfg.ManagedPrefix, apilabeler.DrainingAnnotationName),
+		ExemptAnnotation:             apilabeler.Annotation(cfg.ManagedPrefix, apilabeler.ExemptAnnotationName),
+		CombinePolicy:                cfg.CombinePolicy,
+		ConflictTiebreak:             cfg.ConflictTiebreak,
+		DryRun:                       cfg.DryRun,
+		RequireApplyTrigger:          cfg.RequireApplyTrigger,
+		MaxBlastRadius:               cfg.MaxBlastRadius,
+		Labelers:                     labelerCli.LabelerV1alpha1().Labelers(),
+		NoMatchesWindow:              cfg.NoMatchesWindow,
+		SpecHistorySize:              cfg.SpecHistorySize,
+		ReportRedundant:              cfg.ReportRedundant,
+		BackpressureHighWater:        cfg.BackpressureHighWater,
+		BackpressureLowWater:         cfg.BackpressureLowWater,
+		MetricsLabels:                cfg.Metrics.LabelerLabels,
+		MetricsLabelsLimit:           cfg.MetricsLabelsLimit,
+		OrphanPolicy:                 cfg.OrphanPolicy,
+		OrphanSweepInterval:          cfg.OrphanSweepInterval,
+		LabelerSync:                  lsync,
+		RetryPolicies:                cfg.RetryPolicies,
+		CrashOnPanic:                 cfg.CrashOnPanic,
+		FreezeUntil:                  cfg.FreezeUntil,
+		FreezeConfigMapNamespace:     cfg.FreezeConfigMapNamespace,
+		FreezeConfigMapName:          cfg.FreezeConfigMapName,
+		KillSwitchConfigMapNamespace: cfg.KillSwitchConfigMapNamespace,
+		KillSwitchConfigMapName:      cfg.KillSwitchConfigMapName,
+		LeaseConfigMapNamespace:      cfg.LeaseConfigMapNamespace,
+		LeaseConfigMapName:           cfg.LeaseConfigMapName,
+		LeaseIdentity:                cfg.LeaseIdentity,
+		LeaseDuration:                cfg.LeaseDuration,
+		LeaseClient:                  cfg.LeaseClient,
+		Prewarm:                      cfg.Prewarm,
+		ContentHash:                  cfg.ContentHash,
+		AppliedBy:                    cfg.AppliedBy,
+		FingerprintAnnotation:        cfg.FingerprintAnnotation,
+		PatchType:                    cfg.PatchType,
+		StateCacheSize:               cfg.StateCacheSize,
+		ErrorCircuitThreshold:        cfg.ErrorCircuitThreshold,
+		ErrorCircuitWindow:           cfg.ErrorCircuitWindow,
+		SpreadInitialReconcile:       cfg.SpreadInitialReconcile,
+		AuditInterval:                cfg.AuditInterval,
+		LogNoop:                      cfg.LogNoop,
+		MaxChangesPerPass:            cfg.MaxChangesPerPass,
+		MaxUnavailablePerZone:        cfg.MaxUnavailablePerZone,
+		ZoneDisruptionWindow:         cfg.ZoneDisruptionWindow,
+		ZoneLabel:                    cfg.ZoneLabel,
+		ZoneClients:                  cfg.ZoneClients,
+		ZoneAPIServers:               cfg.ZoneAPIServers,
+		AuditStart:                   cfg.AuditStart,
+		QueueName:                    queueName(cfg.Metrics.Instance),
+		AllowReserved:                cfg.AllowReserved,
+		MatchLabelAllowlist:          cfg.MatchLabelAllowlist,
+		ProtectKeys:                  cfg.ProtectKeys,
+		AllowedTaintEffects:          cfg.AllowedTaintEffects,
+		HTTPSourceHosts:              cfg.HTTPSourceHosts,
+		HTTPSourceSecrets:            cfg.HTTPSourceSecrets,
+		CanaryAnnotation:             apilabeler.Annotation(cfg.ManagedPrefix, apilabeler.CanaryAnnotationName),
+		ManagedPrefix:                cfg.ManagedPrefix,
+		RequeueOnManagedAnnotations:  cfg.RequeueOnManagedAnnotations,
+	}
+
+	// Stream the node mutations and send them as cloudevents if enabled.
+	var recorders []labeler.MutationRecorder
+	var history *labeler.MutationHistory
+	if cfg.DebugEndpoints && cfg.MutationHistorySize > 0 {
+		history = labeler.NewMutationHistory(cfg.MutationHistorySize)
+		recorders = append(recorders, history)
+	}
+	if cfg.EventsStream {
+		b := stream.NewBroadcaster(logger)
+		recorders = append(recorders, labeler.MutationRecorderFunc(func(m labeler.Mutation) { b.Publish(m) }))
+		srv.Handle("/events", b)
+	}
+	var ceSender *cloudevents.Sender
+	if cfg.CloudEvents.Sink != "" {
+		cecfg := cfg.CloudEvents
+		cecfg.MetricsRecorder = metricsRecorder
+		ceSender = cloudevents.NewSender(cecfg, logger)
+		recorders = append(recorders, ceSender)
+	}
+	if len(recorders) > 0 {
+		lcfg.MutationRecorder = labeler.MutationRecorderFunc(func(m labeler.Mutation) {
+			for _, r := range recorders {
+				r.RecordMutation(m)
+			}
+		})
+	}
+
+	// Print the recent mutations on the terminal if enabled.
+	var table *watchtable.Table
+	if cfg.WatchTable {
+		table = watchtable.New(watchtable.Config{OwnerAnnotation: cfg.OwnerAnnotation}, os.Stdout)
+		lcfg.ReconcileRecorder = table
+	}
+
+	// Create the labeler service, it also runs the node informer shared by the label controllers.
+	labelerSvc := labeler.NewLabeler(lcfg, kubeCli, logger)
+
+	// Expose the debug endpoints if enabled, they show the cluster nodes.
+	if cfg.DebugEndpoints {
+		logger.Warningf("debug endpoints enabled, they are served without authentication unless --metrics-client-ca is set")
+		srv.Handle("/debug/queue", queueHandler(labelerSvc))
+		if history != nil {
+			srv.Handle("/debug/mutations", mutationsHandler(history))
+		}
+	}
 
 	// Create handler.
-	handler := newHandler(kubeCli, logger)
+	handler := newHandler(labelerSvc, metricsRecorder, logger)
+
+	// Create the controllers, one by labeler version so a version failing to be watched
+	// doesn't stop the others.
+	ctrls := []controller.Controller{labelerSvc, srv}
+	crdRetriever := lsync.retriever(versions[0], ptCRD)
+	if len(gvs) == 0 {
+		ctrls = append(ctrls, controller.NewSequential(cfg.ResyncPeriod, handler, crdRetriever, nil, logger))
+	} else {
+		vh := newVersionedHandler(handler, versions, logger)
+		ctrls = append(ctrls, controller.NewSequential(cfg.ResyncPeriod, vh.forVersion(versions[0]), crdRetriever, nil, logger))
+		for i, gv := range gvs {
+			retriever := lsync.retriever(versions[i+1], newVersionRetriever(gv, labelerCli.LabelerV1alpha1().RESTClient(), logger))
+			ctrls = append(ctrls, controller.NewSequential(cfg.ResyncPeriod, vh.forVersion(versions[i+1]), retriever, nil, logger))
+		}
+	}
+	logger.Infof("watching the labelers of %s", strings.Join(versions, ", "))
+	if ceSender != nil {
+		ctrls = append(ctrls, ceSender)
+	}
+	if table != nil {
+		ctrls = append(ctrls, table)
+	}
 
-	// Create controller.
-	ctrl := controller.NewSequential(cfg.ResyncPeriod, handler, ptCRD, nil, logger)
+	// Create the admission webhook if enabled.
+	if cfg.Webhook.Address != "" {
+		wcfg := cfg.Webhook
+		wcfg.AllowDeleteAnnotation = apilabeler.Annotation(cfg.ManagedPrefix, apilabeler.AllowDeleteAnnotationName)
+		wcfg.AllowedTaintEffects = cfg.AllowedTaintEffects
+		wcfg.HTTPSourceHosts, wcfg.HTTPSourceSecrets = cfg.HTTPSourceHosts, cfg.HTTPSourceSecrets
+		ctrls = append(ctrls, webhook.NewServer(wcfg, labelerSvc, labelerCli, logger))
+	}
+
+	// Publish the status if enabled.
+	if cfg.Status.Name != "" {
+		scfg := cfg.Status
+		scfg.MetricsRecorder = metricsRecorder
+		ctrls = append(ctrls, status.NewPublisher(scfg, labelerSvc, kubeCli, logger))
+	}
+
+	// Publish the desired state if enabled.
+	if cfg.DesiredState.Name != "" {
+		ctrls = append(ctrls, desiredstate.NewPublisher(cfg.DesiredState, labelerSvc, kubeCli, logger))
+	}
+
+	// Assemble CRD and controllers to create the operator.
+	op := operator.NewMultiOperator([]resource.CRD{ptCRD}, ctrls, logger)
+	if cfg.LeaseConfigMapName != "" {
+		return &handoffOperator{Operator: op, labeler: labelerSvc}, nil
+	}
+	return op, nil
+}
+
+// handoffOperator steps the labeler service down from the leader lease when the
+// operator stops, so the next instance takes over without waiting for the lease to
+// expire. The controllers are not waited for, the lease gate stops the mutations.
+type handoffOperator struct {
+	operator.Operator
+	labeler *labeler.Labeler
+}
+
+// Run satisfies operator.Operator interface.
+func (o *handoffOperator) Run(stopC <-chan struct{}) error {
+	err := o.Operator.Run(stopC)
+	o.labeler.StepDown()
+	return err
+}
 
-	// Assemble CRD and controller to create the operator.
-	return operator.NewOperator(ptCRD, ctrl, logger), nil
+// queueName returns the name of the node queue of the operator instance.
+func queueName(instance string) string {
+	if instance == "" {
+		return "nodes"
+	}
+	return instance + "-nodes"
 }
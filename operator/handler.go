@@ -2,12 +2,13 @@ package operator
 
 import (
 	"fmt"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/kubernetes"
 
 	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
 	"github.com/joshisa/resource-labeler-operator/log"
+	"github.com/joshisa/resource-labeler-operator/metrics"
 	"github.com/joshisa/resource-labeler-operator/service/labeler"
 )
 
@@ -15,13 +16,15 @@ import (
 // events received from kubernetes.
 type handler struct {
 	labelerService labeler.Syncer
+	metrics        metrics.Recorder
 	logger         log.Logger
 }
 
 // newHandler returns a new handler.
-func newHandler(k8sCli kubernetes.Interface, logger log.Logger) *handler {
+func newHandler(labelerService labeler.Syncer, metricsRecorder metrics.Recorder, logger log.Logger) *handler {
 	return &handler{
-		labelerService: labeler.NewLabeler(k8sCli, logger),
+		labelerService: labelerService,
+		metrics:        metricsRecorder,
 		logger:         logger,
 	}
 }
@@ -32,6 +35,7 @@ func (h *handler) Add(obj runtime.Object) error {
 	if !ok {
 		return fmt.Errorf("%v is not a labeler object", obj.GetObjectKind())
 	}
+	h.metrics.SetInformerLastSync(metrics.InformerLabelers, time.Now())
 
 	return h.labelerService.EnsureLabeler(l)
 }
@@ -0,0 +1,158 @@
+package operator
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/spotahome/kooper/operator/retrieve"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// labelerSync tracks the labelers of the watched versions from their list and watch
+// calls, the labeler service only sweeps the orphaned keys once they are all listed.
+// It satisfies labeler.LabelerSync interface.
+type labelerSync struct {
+	mu       sync.Mutex
+	versions map[string]*versionSync
+}
+
+// versionSync is the state of the labelers of a version.
+type versionSync struct {
+	listed bool
+	// failing is set when listing or watching fails, until a watch starts.
+	failing bool
+	// names are the labelers of the version, from the last list and the watch events
+	// since. A failing version keeps them.
+	names map[string]bool
+}
+
+func newLabelerSync(versions []string) *labelerSync {
+	s := &labelerSync{versions: map[string]*versionSync{}}
+	for _, v := range versions {
+		s.versions[v] = &versionSync{names: map[string]bool{}}
+	}
+	return s
+}
+
+// retriever returns the retriever of the version tracking its labelers.
+func (s *labelerSync) retriever(version string, r retrieve.Retriever) retrieve.Retriever {
+	return &syncedRetriever{Retriever: r, version: version, sync: s}
+}
+
+// Unlisted satisfies labeler.LabelerSync interface.
+func (s *labelerSync) Unlisted() []string {
+	return s.filter(func(vs *versionSync) bool { return !vs.listed })
+}
+
+// Failing satisfies labeler.LabelerSync interface.
+func (s *labelerSync) Failing() []string {
+	return s.filter(func(vs *versionSync) bool { return vs.failing })
+}
+
+// Known satisfies labeler.LabelerSync interface.
+func (s *labelerSync) Known(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, vs := range s.versions {
+		if vs.names[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the sorted versions matching f.
+func (s *labelerSync) filter(f func(*versionSync) bool) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var versions []string
+	for v, vs := range s.versions {
+		if f(vs) {
+			versions = append(versions, v)
+		}
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// list records the labelers listed of the version, or that it failed.
+func (s *labelerSync) list(version string, obj runtime.Object, err error) {
+	var names map[string]bool
+	if err == nil {
+		var items []runtime.Object
+		if items, err = meta.ExtractList(obj); err == nil {
+			names = map[string]bool{}
+			for _, item := range items {
+				if m, err := meta.Accessor(item); err == nil {
+					names[m.GetName()] = true
+				}
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	vs := s.versions[version]
+	if err != nil {
+		vs.failing = true
+		return
+	}
+	vs.listed, vs.names = true, names
+}
+
+// watch records whether the watch of the version started.
+func (s *labelerSync) watch(version string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.versions[version].failing = err != nil
+}
+
+// event records the labeler of a watch event of the version.
+func (s *labelerSync) event(version string, ev watch.Event) {
+	m, err := meta.Accessor(ev.Object)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch ev.Type {
+	case watch.Added, watch.Modified:
+		s.versions[version].names[m.GetName()] = true
+	case watch.Deleted:
+		delete(s.versions[version].names, m.GetName())
+	}
+}
+
+// syncedRetriever is a retriever recording its labelers on the labeler sync.
+type syncedRetriever struct {
+	retrieve.Retriever
+	version string
+	sync    *labelerSync
+}
+
+// GetListerWatcher satisfies retrieve.Retriever interface.
+func (r *syncedRetriever) GetListerWatcher() cache.ListerWatcher {
+	lw := r.Retriever.GetListerWatcher()
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			obj, err := lw.List(options)
+			r.sync.list(r.version, obj, err)
+			return obj, err
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			w, err := lw.Watch(options)
+			r.sync.watch(r.version, err)
+			if err != nil {
+				return nil, err
+			}
+			return watch.Filter(w, func(ev watch.Event) (watch.Event, bool) {
+				r.sync.event(r.version, ev)
+				return ev, true
+			}), nil
+		},
+	}
+}
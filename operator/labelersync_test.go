@@ -0,0 +1,87 @@
+package operator
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// testRetriever retrieves the labelers of its list and watch functions.
+type testRetriever struct {
+	lw *cache.ListWatch
+}
+
+func (r testRetriever) GetListerWatcher() cache.ListerWatcher { return r.lw }
+func (r testRetriever) GetObject() runtime.Object             { return &labelerv1alpha1.Labeler{} }
+
+func testLabeler(name string) *labelerv1alpha1.Labeler {
+	return &labelerv1alpha1.Labeler{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
+
+func TestLabelerSync(t *testing.T) {
+	versions := []string{"v1alpha1", "v1beta1"}
+	s := newLabelerSync(versions)
+	fw := watch.NewFake()
+	ok := s.retriever("v1alpha1", testRetriever{&cache.ListWatch{
+		ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+			return &labelerv1alpha1.LabelerList{Items: []labelerv1alpha1.Labeler{*testLabeler("listed")}}, nil
+		},
+		WatchFunc: func(metav1.ListOptions) (watch.Interface, error) { return fw, nil },
+	}}).GetListerWatcher()
+	failing := s.retriever("v1beta1", testRetriever{&cache.ListWatch{
+		ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+			return &labelerv1alpha1.LabelerList{Items: []labelerv1alpha1.Labeler{*testLabeler("other")}}, nil
+		},
+		WatchFunc: func(metav1.ListOptions) (watch.Interface, error) { return nil, errors.New("not served") },
+	}}).GetListerWatcher()
+
+	if got := s.Unlisted(); !reflect.DeepEqual(got, versions) {
+		t.Fatalf("expected %v unlisted, got %v", versions, got)
+	}
+	ok.List(metav1.ListOptions{})
+	if got := s.Unlisted(); !reflect.DeepEqual(got, []string{"v1beta1"}) {
+		t.Fatalf("expected v1beta1 unlisted, got %v", got)
+	}
+	failing.List(metav1.ListOptions{})
+	failing.Watch(metav1.ListOptions{})
+	if got := s.Unlisted(); len(got) != 0 {
+		t.Errorf("expected every version listed, got %v unlisted", got)
+	}
+	if got := s.Failing(); !reflect.DeepEqual(got, []string{"v1beta1"}) {
+		t.Errorf("expected v1beta1 failing, got %v", got)
+	}
+	if !s.Known("other") {
+		t.Errorf("expected the labeler of the failing version to stay known")
+	}
+
+	w, err := ok.Watch(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		fw.Add(testLabeler("added"))
+		fw.Delete(testLabeler("listed"))
+	}()
+	// The events are recorded before they are received.
+	for i := 0; i < 2; i++ {
+		select {
+		case <-w.ResultChan():
+		case <-time.After(time.Second):
+			t.Fatal("expected a watch event")
+		}
+	}
+	if !s.Known("added") {
+		t.Errorf("expected the added labeler known")
+	}
+	if s.Known("listed") {
+		t.Errorf("expected the deleted labeler unknown")
+	}
+}
@@ -0,0 +1,281 @@
+package operator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+	"github.com/joshisa/resource-labeler-operator/client/k8s/clientset/versioned/scheme"
+	"github.com/joshisa/resource-labeler-operator/log"
+)
+
+// Conversion converts the JSON of a labeler of another group/version to the internal
+// labeler type.
+type Conversion func(raw []byte) (*labelerv1alpha1.Labeler, error)
+
+var (
+	conversionsMu sync.Mutex
+	// conversions are the registered conversions by group/version.
+	conversions = map[string]Conversion{}
+)
+
+// RegisterConversion registers the conversion of the labelers of a group/version, the
+// versions without conversion have the same schema as the internal type.
+func RegisterConversion(groupVersion string, fn Conversion) {
+	conversionsMu.Lock()
+	defer conversionsMu.Unlock()
+	conversions[groupVersion] = fn
+}
+
+// conversionFor returns the conversion of the group/version.
+func conversionFor(gv schema.GroupVersion) Conversion {
+	conversionsMu.Lock()
+	defer conversionsMu.Unlock()
+	if fn, ok := conversions[gv.String()]; ok {
+		return fn
+	}
+	return convertSameSchema
+}
+
+// convertSameSchema converts a labeler of a version with the same schema, e.g. the
+// same type under a renamed group.
+func convertSameSchema(raw []byte) (*labelerv1alpha1.Labeler, error) {
+	l := &labelerv1alpha1.Labeler{}
+	if err := json.Unmarshal(raw, l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// ParseLabelerVersions returns the group/versions of the labelers to watch besides the
+// internal one.
+func ParseLabelerVersions(versions []string) ([]schema.GroupVersion, error) {
+	var gvs []schema.GroupVersion
+	seen := map[schema.GroupVersion]bool{labelerv1alpha1.SchemeGroupVersion: true}
+	for _, v := range versions {
+		gv, err := schema.ParseGroupVersion(v)
+		if err != nil || gv.Group == "" || gv.Version == "" {
+			return nil, fmt.Errorf("invalid labeler version %q, must be group/version", v)
+		}
+		if seen[gv] {
+			continue
+		}
+		seen[gv] = true
+		gvs = append(gvs, gv)
+	}
+	return gvs, nil
+}
+
+// versionRetriever retrieves the labelers of another group/version converted to the
+// internal type. The CRD of the version is not managed by the operator.
+type versionRetriever struct {
+	gv      schema.GroupVersion
+	client  rest.Interface
+	convert Conversion
+	logger  log.Logger
+}
+
+func newVersionRetriever(gv schema.GroupVersion, client rest.Interface, logger log.Logger) *versionRetriever {
+	fn := conversionFor(gv)
+	// The converted labelers are of the internal type.
+	convert := func(raw []byte) (*labelerv1alpha1.Labeler, error) {
+		l, err := fn(raw)
+		if err != nil {
+			return nil, err
+		}
+		l.TypeMeta = metav1.TypeMeta{Kind: labelerv1alpha1.LabelerKind, APIVersion: labelerv1alpha1.SchemeGroupVersion.String()}
+		return l, nil
+	}
+	return &versionRetriever{gv: gv, client: client, convert: convert, logger: logger}
+}
+
+// GetListerWatcher satisfies retrieve.Retriever interface.
+func (r *versionRetriever) GetListerWatcher() cache.ListerWatcher {
+	return &cache.ListWatch{
+		ListFunc:  r.list,
+		WatchFunc: r.watch,
+	}
+}
+
+// GetObject satisfies retrieve.Retriever interface.
+func (r *versionRetriever) GetObject() runtime.Object {
+	return &labelerv1alpha1.Labeler{}
+}
+
+func (r *versionRetriever) request(options metav1.ListOptions) *rest.Request {
+	return r.client.Get().
+		AbsPath("/apis", r.gv.Group, r.gv.Version, labelerv1alpha1.LabelerNamePlural).
+		VersionedParams(&options, scheme.ParameterCodec)
+}
+
+// list lists the labelers of the version, the ones that can't be converted are skipped.
+func (r *versionRetriever) list(options metav1.ListOptions) (runtime.Object, error) {
+	b, err := r.request(options).DoRaw()
+	if err != nil {
+		return nil, fmt.Errorf("could not list the %s labelers: %s", r.gv, err)
+	}
+	var raw struct {
+		metav1.ListMeta `json:"metadata"`
+		Items           []json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("could not decode the %s labelers: %s", r.gv, err)
+	}
+
+	list := &labelerv1alpha1.LabelerList{ListMeta: raw.ListMeta}
+	for _, item := range raw.Items {
+		l, err := r.convert(item)
+		if err != nil {
+			r.logger.Warningf("skipping a %s labeler: %s", r.gv, err)
+			continue
+		}
+		list.Items = append(list.Items, *l)
+	}
+	return list, nil
+}
+
+func (r *versionRetriever) watch(options metav1.ListOptions) (watch.Interface, error) {
+	options.Watch = true
+	body, err := r.request(options).Stream()
+	if err != nil {
+		return nil, fmt.Errorf("could not watch the %s labelers: %s", r.gv, err)
+	}
+	return watch.NewStreamWatcher(&versionDecoder{r: r, body: body, dec: json.NewDecoder(body)}), nil
+}
+
+// versionDecoder decodes the watch events of the labelers of a version.
+type versionDecoder struct {
+	r    *versionRetriever
+	body io.ReadCloser
+	dec  *json.Decoder
+}
+
+// Decode satisfies watch.Decoder interface. The labelers that can't be converted are
+// skipped.
+func (d *versionDecoder) Decode() (watch.EventType, runtime.Object, error) {
+	for {
+		var ev metav1.WatchEvent
+		if err := d.dec.Decode(&ev); err != nil {
+			return "", nil, err
+		}
+		if watch.EventType(ev.Type) == watch.Error {
+			status := &metav1.Status{}
+			if err := json.Unmarshal(ev.Object.Raw, status); err != nil {
+				return "", nil, err
+			}
+			return watch.Error, status, nil
+		}
+		l, err := d.r.convert(ev.Object.Raw)
+		if err != nil {
+			d.r.logger.Warningf("skipping a %s labeler: %s", d.r.gv, err)
+			continue
+		}
+		return watch.EventType(ev.Type), l, nil
+	}
+}
+
+// Close satisfies watch.Decoder interface.
+func (d *versionDecoder) Close() {
+	d.body.Close()
+}
+
+// versionedHandler merges the labelers of several versions in the handler, a labeler
+// name in several versions is the labeler of the first one. Deleting it from a version
+// falls back to the next version that has it.
+type versionedHandler struct {
+	next     *handler
+	versions []string
+	logger   log.Logger
+
+	mu       sync.Mutex
+	labelers map[string]map[string]*labelerv1alpha1.Labeler
+}
+
+func newVersionedHandler(next *handler, versions []string, logger log.Logger) *versionedHandler {
+	return &versionedHandler{
+		next:     next,
+		versions: versions,
+		logger:   logger,
+		labelers: map[string]map[string]*labelerv1alpha1.Labeler{},
+	}
+}
+
+// forVersion returns the handler of the labelers of the version.
+func (h *versionedHandler) forVersion(version string) *versionHandler {
+	return &versionHandler{h: h, version: version}
+}
+
+// effective returns the labeler of the first version that has the name, nil if none.
+func (h *versionedHandler) effective(name string) (string, *labelerv1alpha1.Labeler) {
+	for _, v := range h.versions {
+		if l, ok := h.labelers[name][v]; ok {
+			return v, l
+		}
+	}
+	return "", nil
+}
+
+func (h *versionedHandler) add(version string, obj runtime.Object) error {
+	l, ok := obj.(*labelerv1alpha1.Labeler)
+	if !ok {
+		return fmt.Errorf("%v is not a labeler object", obj.GetObjectKind())
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.labelers[l.Name] == nil {
+		h.labelers[l.Name] = map[string]*labelerv1alpha1.Labeler{}
+	}
+	h.labelers[l.Name][version] = l
+	if v, _ := h.effective(l.Name); v != version {
+		log.Debugf(h.logger, "labeler %s of %s shadowed by the one of %s", l.Name, version, v)
+		return nil
+	}
+	return h.next.Add(l)
+}
+
+func (h *versionedHandler) delete(version, name string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.labelers[name], version)
+	if v, l := h.effective(name); l != nil {
+		h.logger.Infof("labeler %s deleted from %s, using the one of %s", name, version, v)
+		return h.next.Add(l)
+	}
+	delete(h.labelers, name)
+	return h.next.Delete(name)
+}
+
+// versionHandler is the handler of the labelers of a version.
+type versionHandler struct {
+	h       *versionedHandler
+	version string
+}
+
+// Add satisfies handler.Handler interface.
+func (vh *versionHandler) Add(obj runtime.Object) error {
+	return vh.h.add(vh.version, obj)
+}
+
+// Delete satisfies handler.Handler interface.
+func (vh *versionHandler) Delete(name string) error {
+	return vh.h.delete(vh.version, name)
+}
+
+// labelerVersionNames returns the names of the internal and the other versions.
+func labelerVersionNames(gvs []schema.GroupVersion) []string {
+	names := []string{labelerv1alpha1.SchemeGroupVersion.String()}
+	for _, gv := range gvs {
+		names = append(names, gv.String())
+	}
+	return names
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/joshisa/resource-labeler-operator/log"
+)
+
+const (
+	shutdownTimeout = 5 * time.Second
+	listenRetries   = 10
+	listenRetryWait = 500 * time.Millisecond
+)
+
+// TLS is the TLS configuration of the server, it serves plain HTTP without certificate.
+type TLS struct {
+	// CertFile and KeyFile are the server certificate.
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is the CA the client certificates are required to be signed by,
+	// client certificates are not required if empty.
+	ClientCAFile string
+}
+
+// Server is the HTTP server that exposes the operator endpoints.
+type Server struct {
+	addr   string
+	tls    TLS
+	mux    *http.ServeMux
+	logger log.Logger
+}
+
+// New returns a new server that will listen on addr.
+func New(addr string, tlsCfg TLS, logger log.Logger) *Server {
+	return &Server{
+		addr:   addr,
+		tls:    tlsCfg,
+		mux:    http.NewServeMux(),
+		logger: logger,
+	}
+}
+
+// Handle registers the handler for the pattern.
+func (s *Server) Handle(pattern string, h http.Handler) {
+	s.logger.Infof("serving %s on %s", pattern, s.addr)
+	s.mux.Handle(pattern, h)
+}
+
+// Run serves the registered endpoints until stopC is closed. Satisfies kooper
+// controller.Controller interface.
+func (s *Server) Run(stopC <-chan struct{}) error {
+	ln, err := Listen(s.addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Addr: s.addr, Handler: s.mux}
+
+	errC := make(chan error, 1)
+	if s.tls.CertFile == "" {
+		s.logger.Warningf("serving %s on plain HTTP, set a TLS certificate to serve HTTPS", s.addr)
+		go func() {
+			errC <- srv.Serve(ln)
+		}()
+	} else {
+		if srv.TLSConfig, err = s.tlsConfig(); err != nil {
+			ln.Close()
+			return err
+		}
+		go func() {
+			errC <- srv.ServeTLS(ln, s.tls.CertFile, s.tls.KeyFile)
+		}()
+	}
+
+	select {
+	case err := <-errC:
+		return fmt.Errorf("http server stopped: %s", err)
+	case <-stopC:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
+
+// tlsConfig returns the TLS configuration requiring client certificates signed by the
+// client CA if it's set.
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if s.tls.ClientCAFile == "" {
+		return cfg, nil
+	}
+
+	ca, err := ioutil.ReadFile(s.tls.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read client CA: %s", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates on client CA %s", s.tls.ClientCAFile)
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	return cfg, nil
+}
+
+// Listen listens on the TCP address. It retries for a while so a previous server
+// of the operator being stopped has time to release the address.
+func Listen(addr string) (net.Listener, error) {
+	var err error
+	for i := 0; i < listenRetries; i++ {
+		var ln net.Listener
+		if ln, err = net.Listen("tcp", addr); err == nil {
+			return ln, nil
+		}
+		time.Sleep(listenRetryWait)
+	}
+	return nil, fmt.Errorf("could not listen on %s: %s", addr, err)
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	kooperlog "github.com/spotahome/kooper/log"
+)
+
+// freeAddr returns a local address nothing listens on.
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// get returns the status and body of the URL, retrying until the server listens.
+func get(cli *http.Client, url string) (string, error) {
+	var err error
+	for i := 0; i < 100; i++ {
+		var resp *http.Response
+		if resp, err = cli.Get(url); err == nil {
+			defer resp.Body.Close()
+			b, _ := ioutil.ReadAll(resp.Body)
+			return fmt.Sprintf("%d %s", resp.StatusCode, b), nil
+		}
+		if !strings.Contains(err.Error(), "connection refused") {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return "", err
+}
+
+// runServer runs a server of the events handler, it returns the func stopping it
+// and returning its result.
+func runServer(t *testing.T, addr string, tlsCfg TLS) func() error {
+	s := New(addr, tlsCfg, kooperlog.Dummy)
+	s.Handle("/events", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "events")
+	}))
+
+	stopC := make(chan struct{})
+	errC := make(chan error, 1)
+	go func() { errC <- s.Run(stopC) }()
+	return func() error {
+		close(stopC)
+		select {
+		case err := <-errC:
+			return err
+		case <-time.After(shutdownTimeout + time.Second):
+			t.Fatalf("expected the server stopped")
+			return nil
+		}
+	}
+}
+
+func TestServerRun(t *testing.T) {
+	addr := freeAddr(t)
+	stop := runServer(t, addr, TLS{})
+
+	if got, err := get(http.DefaultClient, "http://"+addr+"/events"); got != "200 events" {
+		t.Errorf("expected the registered handler served, got %q: %v", got, err)
+	}
+	if got, _ := get(http.DefaultClient, "http://"+addr+"/unknown"); len(got) < 3 || got[:3] != "404" {
+		t.Errorf("expected the unregistered paths not found, got %q", got)
+	}
+
+	// The server stops once stopped.
+	if err := stop(); err != nil {
+		t.Errorf("expected a clean shutdown, got %s", err)
+	}
+	if _, err := http.Get("http://" + addr + "/events"); err == nil {
+		t.Errorf("expected the server not listening once stopped")
+	}
+}
+
+// certs are the PEM files of a test CA and of the server certificate it signed, and
+// a client certificate it signed.
+type certs struct {
+	ca, serverCert, serverKey string
+	pool                      *x509.CertPool
+	client                    tls.Certificate
+}
+
+func newCerts(t *testing.T, dir string) certs {
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	sign := func(serial int64, usage x509.ExtKeyUsage) ([]byte, []byte) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "localhost"},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	}
+
+	c := certs{
+		ca:         filepath.Join(dir, "ca.crt"),
+		serverCert: filepath.Join(dir, "tls.crt"),
+		serverKey:  filepath.Join(dir, "tls.key"),
+		pool:       x509.NewCertPool(),
+	}
+	c.pool.AddCert(ca)
+	serverCert, serverKey := sign(2, x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := sign(3, x509.ExtKeyUsageClientAuth)
+	if c.client, err = tls.X509KeyPair(clientCert, clientKey); err != nil {
+		t.Fatal(err)
+	}
+	for path, b := range map[string][]byte{
+		c.ca:         pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		c.serverCert: serverCert,
+		c.serverKey:  serverKey,
+	} {
+		if err := ioutil.WriteFile(path, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+func TestServerRunTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := newCerts(t, dir)
+
+	tests := []struct {
+		name       string
+		clientCA   bool
+		clientCert bool
+		expOK      bool
+	}{
+		{name: "Without client CA the clients are served.", expOK: true},
+		{name: "Without client CA the clients with a certificate are served.", clientCert: true, expOK: true},
+		{name: "With client CA the clients without certificate are rejected.", clientCA: true},
+		{name: "With client CA the clients with a signed certificate are served.", clientCA: true, clientCert: true, expOK: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tlsCfg := TLS{CertFile: c.serverCert, KeyFile: c.serverKey}
+			if test.clientCA {
+				tlsCfg.ClientCAFile = c.ca
+			}
+			addr := freeAddr(t)
+			stop := runServer(t, addr, tlsCfg)
+			defer stop()
+
+			clientTLS := &tls.Config{RootCAs: c.pool}
+			if test.clientCert {
+				clientTLS.Certificates = []tls.Certificate{c.client}
+			}
+			cli := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+			got, err := get(cli, "https://"+addr+"/events")
+			if test.expOK && got != "200 events" {
+				t.Errorf("expected the client served, got %q: %v", got, err)
+			}
+			if !test.expOK && err == nil {
+				t.Errorf("expected the client rejected, got %q", got)
+			}
+		})
+	}
+}
+
+func TestServerRunTLSErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := newCerts(t, dir)
+	invalid := filepath.Join(dir, "invalid.crt")
+	if err := ioutil.WriteFile(invalid, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, ca := range map[string]string{
+		"A missing client CA is an error.":              filepath.Join(dir, "missing.crt"),
+		"A client CA without certificates is an error.": invalid,
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := New(freeAddr(t), TLS{CertFile: c.serverCert, KeyFile: c.serverKey, ClientCAFile: ca}, kooperlog.Dummy)
+			if err := s.Run(make(chan struct{})); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestListen(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+
+	// An address in use is an error once the retries are exhausted.
+	start := time.Now()
+	if _, err := Listen(addr); err == nil {
+		t.Fatalf("expected an error listening on an address in use")
+	}
+	if d := time.Since(start); d < (listenRetries-1)*listenRetryWait {
+		t.Errorf("expected the listen retried, got an error after %s", d)
+	}
+
+	// An address released while retrying is listened on.
+	go func() {
+		time.Sleep(2 * listenRetryWait)
+		ln.Close()
+	}()
+	ln, err = Listen(addr)
+	if err != nil {
+		t.Fatalf("expected the released address listened on, got %s", err)
+	}
+	ln.Close()
+}
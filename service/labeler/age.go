@@ -0,0 +1,161 @@
+package labeler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// TimedValueSource is a value source whose value changes with the time for the same
+// node, the node is synced again when it changes.
+type TimedValueSource interface {
+	ValueSource
+	// NextChange returns when the value of the node changes from now, 0 if it doesn't.
+	NextChange(node *corev1.Node, now time.Time) time.Duration
+}
+
+// ageTier is a named tier of the node age, up to (excluding) max.
+type ageTier struct {
+	name string
+	max  time.Duration
+}
+
+// ageSource resolves the tier of the node age, from its creation timestamp.
+type ageSource struct {
+	tiers []ageTier
+	now   func() time.Time
+}
+
+// newAgeSource resolves the tier of the node age with the "tiers" name:max ages in
+// ascending order, the last one has no max (e.g. "fresh:7d,aging:30d,stale").
+func newAgeSource(params map[string]string) (ValueSource, error) {
+	param, err := requiredParam(params, "tiers")
+	if err != nil {
+		return nil, err
+	}
+
+	src := ageSource{now: time.Now}
+	tiers := strings.Split(param, ",")
+	if len(tiers) < 2 {
+		return nil, fmt.Errorf("tiers param needs at least two tiers, got %q", param)
+	}
+	for i, t := range tiers {
+		parts := strings.SplitN(strings.TrimSpace(t), ":", 2)
+		tier := ageTier{name: parts[0]}
+		if errs := validation.IsValidLabelValue(tier.name); tier.name == "" || len(errs) > 0 {
+			return nil, fmt.Errorf("invalid tier name %q", tier.name)
+		}
+		last := i == len(tiers)-1
+		switch {
+		case last && len(parts) == 2:
+			return nil, fmt.Errorf("the last tier %q can't have a max age", tier.name)
+		case !last && len(parts) != 2:
+			return nil, fmt.Errorf("tier %q needs a max age", tier.name)
+		case !last:
+			if tier.max, err = parseAge(parts[1]); err != nil || tier.max <= 0 {
+				return nil, fmt.Errorf("invalid tier %q max age %q", tier.name, parts[1])
+			}
+			if i > 0 && tier.max <= src.tiers[i-1].max {
+				return nil, fmt.Errorf("tier %q max age must be greater than the previous one", tier.name)
+			}
+		}
+		src.tiers = append(src.tiers, tier)
+	}
+	return src, nil
+}
+
+// parseAge parses a duration, also in days with the "d" suffix (e.g. 30d).
+func parseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// tier returns the index of the tier of the node age, false without creation timestamp.
+func (s ageSource) tier(node *corev1.Node, now time.Time) (int, time.Duration, bool) {
+	if node.CreationTimestamp.IsZero() {
+		return 0, 0, false
+	}
+	age := now.Sub(node.CreationTimestamp.Time)
+	for i, t := range s.tiers[:len(s.tiers)-1] {
+		if age < t.max {
+			return i, age, true
+		}
+	}
+	return len(s.tiers) - 1, age, true
+}
+
+// Resolve satisfies ValueSource interface.
+func (s ageSource) Resolve(node *corev1.Node) (string, bool, error) {
+	i, _, ok := s.tier(node, s.now())
+	if !ok {
+		return "", false, nil
+	}
+	return s.tiers[i].name, true, nil
+}
+
+// NextChange satisfies TimedValueSource interface, the node crosses into the next tier.
+func (s ageSource) NextChange(node *corev1.Node, now time.Time) time.Duration {
+	i, age, ok := s.tier(node, now)
+	if !ok || i == len(s.tiers)-1 {
+		return 0
+	}
+	return s.tiers[i].max - age
+}
+
+// nextValueChange returns when the value of a timed value source of the labeler changes
+// on the node, 0 if none does.
+func (lc *LabelController) nextValueChange(node *corev1.Node) time.Duration {
+	var next time.Duration
+	now := time.Now()
+	for _, lv := range lc.values {
+		for _, src := range leafSources(lv.source) {
+			var d time.Duration
+			switch ts := src.(type) {
+			case TimedValueSource:
+				d = ts.NextChange(node, now)
+			case LeaseValueSource:
+				if lc.cfg.Leases == nil {
+					continue
+				}
+				if renewed, ok := lc.cfg.Leases.NodeLeaseRenewTime(node.Name); ok {
+					d = ts.NextLeaseChange(renewed, now)
+				}
+			case FailuresValueSource:
+				if lc.cfg.SchedulingFailures == nil {
+					continue
+				}
+				if failures, ok := lc.cfg.SchedulingFailures.NodeSchedulingFailures(node.Name); ok {
+					d = ts.NextFailuresChange(failures, now)
+				}
+			}
+			if d > 0 && (next == 0 || d < next) {
+				next = d
+			}
+		}
+	}
+	return next
+}
+
+// timed returns true if the labeler has timed value sources, the lease and scheduling
+// failure ones too.
+func (lc *LabelController) timed() bool {
+	for _, lv := range lc.values {
+		for _, src := range leafSources(lv.source) {
+			switch src.(type) {
+			case TimedValueSource, LeaseValueSource, FailuresValueSource:
+				return true
+			}
+		}
+	}
+	return false
+}
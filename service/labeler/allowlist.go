@@ -0,0 +1,88 @@
+package labeler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// labelAllowed returns true if the label key is in the allowlist, entries ending in
+// "/*" allow all the keys of their prefix. An empty allowlist allows every key.
+func labelAllowed(key string, allowlist []string) bool {
+	if len(allowlist) == 0 {
+		return true
+	}
+	for _, a := range allowlist {
+		if a == key || strings.HasSuffix(a, "/*") && strings.HasPrefix(key, strings.TrimSuffix(a, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchedLabels returns the label keys the labeler reads to match the nodes: the keys
+// of the node selector terms and when requirements, and the node group labels with a
+// node group selector.
+func matchedLabels(l *labelerv1alpha1.Labeler) []string {
+	set := map[string]bool{}
+	for _, term := range l.Spec.NodeSelectorTerms {
+		for _, expr := range term.MatchExpressions {
+			set[expr.Key] = true
+		}
+	}
+	for _, req := range l.Spec.When {
+		set[req.Key] = true
+	}
+	if len(l.Spec.NodeGroupSelector) > 0 {
+		for _, ngl := range NodeGroupLabels() {
+			set[ngl.Key] = true
+		}
+	}
+
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ValidateMatchLabels returns an error if the labeler matches the nodes on label keys
+// out of the allowlist, an empty allowlist allows every key.
+func ValidateMatchLabels(l *labelerv1alpha1.Labeler, allowlist []string) error {
+	var denied []string
+	for _, k := range matchedLabels(l) {
+		if !labelAllowed(k, allowlist) {
+			denied = append(denied, k)
+		}
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("%s: matches on label keys out of the match label allowlist: %s", l.Name, strings.Join(denied, ", "))
+	}
+	return nil
+}
+
+// TaintEffects are all the taint effects, allowed by default.
+var TaintEffects = []string{
+	string(corev1.TaintEffectNoSchedule),
+	string(corev1.TaintEffectPreferNoSchedule),
+	string(corev1.TaintEffectNoExecute),
+}
+
+// ValidateTaintEffects returns an error if the labeler merges taints with effects out
+// of the allowed ones, no allowed effects allow all of them.
+func ValidateTaintEffects(l *labelerv1alpha1.Labeler, allowed []string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	for _, t := range l.Spec.Merge.Taints {
+		if !contains(allowed, string(t.Effect)) {
+			return fmt.Errorf("%s: taint %s has the %s effect, not allowed by the cluster policy (allowed taint effects: %s)", l.Name, t.Key, t.Effect, strings.Join(allowed, ", "))
+		}
+	}
+	return nil
+}
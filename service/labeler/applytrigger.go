@@ -0,0 +1,90 @@
+package labeler
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// ConditionAwaitingApply is set while the generation of a labeler is staged, until its
+// apply trigger annotation is set.
+const ConditionAwaitingApply = "AwaitingApply"
+
+// LabelerUpdater updates the labelers, the apply triggers are consumed with it.
+type LabelerUpdater interface {
+	Update(l *labelerv1alpha1.Labeler) (*labelerv1alpha1.Labeler, error)
+}
+
+// applyTriggered returns true if the labeler has the apply trigger annotation.
+func (c *Labeler) applyTriggered(l *labelerv1alpha1.Labeler) bool {
+	return l.Annotations[c.cfg.ApplyAnnotation] == "true"
+}
+
+// applyApproved returns true if the changes of the labeler are applied: without
+// RequireApplyTrigger or when a trigger approved its generation.
+func (c *Labeler) applyApproved(l *labelerv1alpha1.Labeler) bool {
+	if !c.cfg.RequireApplyTrigger {
+		return true
+	}
+	gen, err := strconv.ParseInt(l.Annotations[c.cfg.ApprovedGenerationAnnotation], 10, 64)
+	return err == nil && gen >= l.Generation
+}
+
+// consumeApplyTrigger clears the apply trigger of the labeler recording its generation
+// as approved, so a trigger approves a single change, and returns true once done. A
+// trigger not cleared doesn't approve anything, otherwise it would approve the next
+// changes too: the update fails on conflict if the labeler changed meanwhile, it's
+// retried with the next labeler event.
+func (c *Labeler) consumeApplyTrigger(l *labelerv1alpha1.Labeler) bool {
+	if c.cfg.Labelers == nil {
+		c.logger.Warningf("%s: the apply trigger can't be cleared without labeler client, not applied", l.Name)
+		return false
+	}
+	l = l.DeepCopy()
+	delete(l.Annotations, c.cfg.ApplyAnnotation)
+	l.Annotations[c.cfg.ApprovedGenerationAnnotation] = strconv.FormatInt(l.Generation, 10)
+	if _, err := c.cfg.Labelers.Update(l); err != nil {
+		c.logger.Warningf("%s: could not clear the apply trigger, not applied until cleared: %s", l.Name, err)
+		return false
+	}
+	c.logger.Infof("%s: apply triggered, generation %d approved", l.Name, l.Generation)
+	return true
+}
+
+// stage stages the changes of the labeler, they are planned like a dry run.
+func (lc *LabelController) stage() {
+	atomic.StoreInt32(&lc.staged, 1)
+}
+
+// isStaged returns true if the changes of the labeler wait for the apply trigger.
+func (lc *LabelController) isStaged() bool {
+	return atomic.LoadInt32(&lc.staged) == 1
+}
+
+// applyStaged applies the staged changes of the label controller once approved.
+func (c *Labeler) applyStaged(lc *LabelController, approved bool) {
+	if !approved || !lc.isStaged() {
+		return
+	}
+	atomic.StoreInt32(&lc.staged, 0)
+	c.logger.Infof("%s: applying the staged generation %d", lc.l.Name, lc.ObservedGeneration())
+	c.enqueueLabeler(lc)
+}
+
+// awaitingApplyCondition returns the AwaitingApply condition of the staged labeler with
+// the number of nodes its plan changes, nil if it's not staged.
+func (lc *LabelController) awaitingApplyCondition() *Condition {
+	if !lc.isStaged() {
+		return nil
+	}
+	return &Condition{
+		Labeler:  lc.l.Name,
+		Type:     ConditionAwaitingApply,
+		Severity: ConditionSeverityWarning,
+		Since:    lc.created.UTC(),
+		Message: fmt.Sprintf("generation %d staged, it would change %d nodes: annotate the labeler with %s=true to apply it",
+			lc.ObservedGeneration(), lc.dryRunNodes(), lc.cfg.ApplyAnnotation),
+	}
+}
@@ -0,0 +1,108 @@
+package labeler
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// labelerUpdates records the labeler updates, failing them with err if set.
+type labelerUpdates struct {
+	mu      sync.Mutex
+	updates []*labelerv1alpha1.Labeler
+	err     error
+}
+
+func (u *labelerUpdates) Update(l *labelerv1alpha1.Labeler) (*labelerv1alpha1.Labeler, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.err != nil {
+		return nil, u.err
+	}
+	u.updates = append(u.updates, l)
+	return l, nil
+}
+
+// awaitingApply returns true if the status has the AwaitingApply condition of the labeler.
+func awaitingApply(c *Labeler, name string) bool {
+	for _, cond := range c.Status().Conditions {
+		if cond.Type == ConditionAwaitingApply && cond.Labeler == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestApplyTriggerAppliesStagedGeneration(t *testing.T) {
+	tests := []struct {
+		name       string
+		updateErr  error
+		expApplied bool
+	}{
+		{name: "A consumed trigger applies the staged generation.", expApplied: true},
+		{name: "A trigger that can't be cleared applies nothing.", updateErr: errors.New("conflict")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			updates := &labelerUpdates{err: test.updateErr}
+			s := newNodeServer(testNode("n1", map[string]string{"pool": "a"}))
+			l := poolLabeler("ops", "a", labelerv1alpha1.LabelerSpec{Merge: mergeSpec(map[string]string{"team": "ops"})})
+			c, stop := newSyncedLabeler(t, s, Config{RequireApplyTrigger: true, Labelers: updates}, l)
+			defer stop()
+
+			// The generation is planned like a dry run until triggered.
+			if res := syncPatched(t, c, "n1"); res.Patched != nil {
+				t.Fatalf("expected the staged generation not patched, got %s", res.Outcome)
+			}
+			if !awaitingApply(c, "ops") {
+				t.Errorf("expected the AwaitingApply condition")
+			}
+
+			triggered := l.DeepCopy()
+			triggered.Annotations = map[string]string{c.cfg.ApplyAnnotation: "true"}
+			if err := c.EnsureLabeler(triggered); err != nil {
+				t.Fatal(err)
+			}
+			syncPatched(t, c, "n1")
+			if n := s.patchCount(); (n == 1) != test.expApplied {
+				t.Errorf("expected applied %t, got %d patches", test.expApplied, n)
+			}
+			if awaitingApply(c, "ops") == test.expApplied {
+				t.Errorf("expected the AwaitingApply condition %t", !test.expApplied)
+			}
+			if !test.expApplied {
+				return
+			}
+
+			// The trigger is consumed recording the approved generation.
+			if len(updates.updates) != 1 {
+				t.Fatalf("expected the labeler updated once, got %d", len(updates.updates))
+			}
+			updated := updates.updates[0]
+			if _, ok := updated.Annotations[c.cfg.ApplyAnnotation]; ok {
+				t.Errorf("expected the apply trigger removed, got %v", updated.Annotations)
+			}
+			if gen := updated.Annotations[c.cfg.ApprovedGenerationAnnotation]; gen != "1" {
+				t.Errorf("expected the approved generation 1, got %q", gen)
+			}
+
+			// The next generation is staged again.
+			edited := poolLabeler("ops", "a", labelerv1alpha1.LabelerSpec{Merge: mergeSpec(map[string]string{"team": "platform"})})
+			edited.Generation = 2
+			edited.Annotations = updated.Annotations
+			if err := c.EnsureLabeler(edited); err != nil {
+				t.Fatal(err)
+			}
+			syncPatched(t, c, "n1")
+			if n := s.patchCount(); n != 1 {
+				t.Errorf("expected the next generation staged, got %d patches", n)
+			}
+			if !awaitingApply(c, "ops") {
+				t.Errorf("expected the AwaitingApply condition of the next generation")
+			}
+		})
+	}
+}
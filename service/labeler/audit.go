@@ -0,0 +1,138 @@
+package labeler
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/joshisa/resource-labeler-operator/log"
+)
+
+// auditPageSize is the number of nodes listed per page by the audits.
+const auditPageSize = 500
+
+// runAudits audits the nodes every AuditInterval until stopC is closed, aligned to
+// AuditStart if set so they can be scheduled off-peak.
+func (c *Labeler) runAudits(stopC <-chan struct{}) {
+	for {
+		next := nextAudit(time.Now(), c.cfg.AuditStart, c.cfg.AuditInterval)
+		c.logger.Infof("next node audit at %s", next.Format(time.RFC3339))
+		select {
+		case <-time.After(time.Until(next)):
+			c.audit()
+		case <-stopC:
+			return
+		}
+	}
+}
+
+// nextAudit returns the next audit time after now: start plus a multiple of the
+// interval, an interval from now without start.
+func nextAudit(now, start time.Time, interval time.Duration) time.Time {
+	if start.IsZero() {
+		return now.Add(interval)
+	}
+	if start.After(now) {
+		return start
+	}
+	return start.Add((now.Sub(start)/interval + 1) * interval)
+}
+
+// audit lists every node from the API, not the cache, and plans all the labelers on
+// them. The nodes that are not in the desired state are synced again, regardless of
+// their content hash, and from the API if the cache missed their events.
+// It's much heavier than a resync, it guarantees the eventual consistency even if the
+// watch missed events or syncs gave up.
+func (c *Labeler) audit() {
+	start := time.Now()
+	lcs := c.controllers()
+	nodes, corrections := 0, 0
+	options := metav1.ListOptions{Limit: auditPageSize}
+	c.selectNode(&options, "metadata.name")
+	for {
+		list, err := c.k8sCli.CoreV1().Nodes().List(options)
+		if err != nil {
+			c.logger.Errorf("node audit failed after %d nodes: %s", nodes, err)
+			return
+		}
+		for i := range list.Items {
+			nodes++
+			if c.auditNode(lcs, &list.Items[i]) {
+				corrections++
+			}
+		}
+		if list.Continue == "" {
+			break
+		}
+		options.Continue = list.Continue
+	}
+
+	c.cfg.MetricsRecorder.AddAuditCorrections(corrections)
+	c.logger.Infof("node audit of %d nodes with %d labelers in %s: %d nodes not in the desired state queued for correction", nodes, len(lcs), time.Since(start).Round(time.Millisecond), corrections)
+}
+
+// auditNode returns true and queues the node for correction if the labelers would
+// change it.
+func (c *Labeler) auditNode(lcs []*LabelController, node *corev1.Node) bool {
+	dst, _, _, err := PlanNode(lcs, node)
+	if err != nil {
+		log.Debugf(c.logger, "node audit could not plan node %s: %s", node.Name, err)
+	}
+	if dst == node {
+		return false
+	}
+
+	// The cache is the informer one, only the informer writes it.
+	obj, exists, err := c.informer().GetStore().GetByKey(node.Name)
+	if cached, ok := obj.(*corev1.Node); err == nil && (!exists || ok && cached.ResourceVersion != node.ResourceVersion) {
+		c.logger.Warningf("node audit found node %s stale in the cache, synced from the API until the cache is updated", node.Name)
+		if exists {
+			c.staleNodes.Store(node.Name, cached.ResourceVersion)
+		} else {
+			c.staleNodes.Store(node.Name, "")
+		}
+	}
+	log.Debugf(c.logger, "node audit found node %s not in the desired state", node.Name)
+	c.forceSync.Store(node.Name, struct{}{})
+	c.enqueue(node.Name)
+	return true
+}
+
+// getNode returns the node of the key from the cache, or from the API while the cache
+// has the version of the node the audit found stale (or still misses it).
+func (c *Labeler) getNode(key string) (interface{}, bool, error) {
+	obj, exists, err := c.informer().GetStore().GetByKey(key)
+	staleVersion, stale := c.staleNodes.Load(key)
+	if err != nil || !stale {
+		return obj, exists, err
+	}
+	if cached, ok := obj.(*corev1.Node); exists && (!ok || cached.ResourceVersion != staleVersion.(string)) {
+		// The cache got the node events since.
+		c.staleNodes.Delete(key)
+		return obj, exists, nil
+	}
+
+	c.cycle.apiCall()
+	node, err := c.k8sCli.CoreV1().Nodes().Get(key, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		c.staleNodes.Delete(key)
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("could not get node %s stale in the cache: %s", key, err)
+	}
+	return node, true, nil
+}
+
+// forced returns true, once, if the node needs to be synced regardless of its content
+// hash.
+func (c *Labeler) forced(key string) bool {
+	if _, ok := c.forceSync.Load(key); !ok {
+		return false
+	}
+	c.forceSync.Delete(key)
+	return true
+}
@@ -0,0 +1,110 @@
+package labeler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	kooperlog "github.com/spotahome/kooper/log"
+)
+
+func TestNextAudit(t *testing.T) {
+	now := time.Date(2020, 1, 10, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		start time.Time
+		exp   time.Time
+	}{
+		{
+			name: "Without start the audit is an interval from now.",
+			exp:  now.Add(6 * time.Hour),
+		},
+		{
+			name:  "A future start is the next audit.",
+			start: now.Add(time.Hour),
+			exp:   now.Add(time.Hour),
+		},
+		{
+			name:  "A past start is the next audit aligned to it.",
+			start: time.Date(2020, 1, 1, 3, 0, 0, 0, time.UTC),
+			exp:   time.Date(2020, 1, 10, 15, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := nextAudit(now, test.start, 6*time.Hour); !got.Equal(test.exp) {
+				t.Errorf("expected %s, got %s", test.exp, got)
+			}
+		})
+	}
+}
+
+func TestGetNodeStaleInCache(t *testing.T) {
+	fresh := testNode("n1", map[string]string{"fresh": "true"})
+	fresh.ResourceVersion = "2"
+	gets := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gets++
+		if r.URL.Path != "/api/v1/nodes/n1" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(fresh)
+	}))
+	defer srv.Close()
+	cli, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Labeler{
+		cfg:          Config{}.withDefaults(),
+		logger:       kooperlog.Dummy,
+		k8sCli:       cli,
+		nodeInformer: cache.NewSharedIndexInformer(&cache.ListWatch{}, &corev1.Node{}, 0, cache.Indexers{}),
+	}
+	cached := testNode("n1", nil)
+	cached.ResourceVersion = "1"
+	c.informer().GetStore().Add(cached)
+
+	obj, _, _ := c.getNode("n1")
+	if obj.(*corev1.Node).ResourceVersion != "1" || gets != 0 {
+		t.Fatalf("expected the cached node, got version %s and %d gets", obj.(*corev1.Node).ResourceVersion, gets)
+	}
+
+	// The audit found the cached version stale.
+	c.staleNodes.Store("n1", "1")
+	obj, _, err = c.getNode("n1")
+	if err != nil || obj.(*corev1.Node).ResourceVersion != "2" {
+		t.Fatalf("expected the node from the API, got %v (%v)", obj, err)
+	}
+	if obj, _, _ := c.informer().GetStore().GetByKey("n1"); obj.(*corev1.Node).ResourceVersion != "1" {
+		t.Errorf("expected the cache untouched")
+	}
+
+	// The cache got the node events.
+	c.informer().GetStore().Update(fresh)
+	gets = 0
+	obj, _, _ = c.getNode("n1")
+	if obj.(*corev1.Node).ResourceVersion != "2" || gets != 0 {
+		t.Errorf("expected the cached node once updated, got %d gets", gets)
+	}
+	if _, ok := c.staleNodes.Load("n1"); ok {
+		t.Errorf("expected the node no longer stale")
+	}
+
+	// A stale node missing from the cache is deleted if the API doesn't have it.
+	c.staleNodes.Store("n2", "")
+	if _, exists, err := c.getNode("n2"); exists || err != nil {
+		t.Errorf("expected node n2 not found, got exists %t (%v)", exists, err)
+	}
+}
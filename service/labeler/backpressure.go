@@ -0,0 +1,40 @@
+package labeler
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	backpressureCheckInterval = time.Second
+	// backpressureRetryFactor multiplies the retry backoff of the failed syncs under
+	// backpressure, so a slow API server is not retried at full pace.
+	backpressureRetryFactor = 4
+)
+
+// underBackpressure returns true if the node queue is over the high-water mark and
+// hasn't drained below the low-water mark yet.
+func (c *Labeler) underBackpressure() bool {
+	return atomic.LoadInt32(&c.backpressure) == 1
+}
+
+// checkBackpressure enters the backpressure when the ready nodes reach the high-water
+// mark and leaves it when they drain to the low-water mark. The workers keep syncing
+// under backpressure, the resyncs are not queued and the retries back off longer.
+func (c *Labeler) checkBackpressure() {
+	depth := c.queue.Len()
+	active := c.underBackpressure()
+	switch {
+	case !active && depth >= c.cfg.BackpressureHighWater:
+		atomic.StoreInt32(&c.backpressure, 1)
+		c.queue.setRetryFactor(backpressureRetryFactor)
+		c.logger.Warningf("entering backpressure: %d nodes ready to sync, at the high-water mark %d, the resyncs are not queued until %d", depth, c.cfg.BackpressureHighWater, c.cfg.BackpressureLowWater)
+	case active && depth <= c.cfg.BackpressureLowWater:
+		atomic.StoreInt32(&c.backpressure, 0)
+		c.queue.setRetryFactor(1)
+		c.logger.Infof("leaving backpressure: %d nodes ready to sync", depth)
+	default:
+		return
+	}
+	c.cfg.MetricsRecorder.SetBackpressure(!active)
+}
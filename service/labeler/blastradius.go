@@ -0,0 +1,123 @@
+package labeler
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// ConditionBlastRadiusExceeded is set while a labeler generation newly selecting more
+// nodes than the max blast radius waits for its allow annotation.
+const ConditionBlastRadiusExceeded = "BlastRadiusExceeded"
+
+// syncedStore is a node store that knows if it has all the nodes.
+type syncedStore interface {
+	HasSynced() bool
+}
+
+// blastRadius is the number of nodes the labeler generation newly selects.
+type blastRadius struct {
+	mu       sync.Mutex
+	computed bool
+	nodes    int
+	// allowed is set by the allow annotation of the generation.
+	allowed bool
+}
+
+// maxBlastRadius returns the max blast radius of the labeler, its own or the operator
+// one, 0 if disabled.
+func (lc *LabelController) maxBlastRadius() int {
+	if m := lc.l.Spec.MaxBlastRadius; m != nil {
+		return int(*m)
+	}
+	return lc.cfg.MaxBlastRadius
+}
+
+// blastRadius returns the number of matching nodes the labeler owns no attribute of,
+// the nodes its generation newly affects. It's computed once the node cache is synced,
+// false until then.
+func (lc *LabelController) blastRadius() (int, bool) {
+	b := &lc.blast
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.computed {
+		return b.nodes, true
+	}
+	if s, ok := lc.nodes.(syncedStore); ok && !s.HasSynced() {
+		return 0, false
+	}
+	for _, n := range lc.matchingNodes() {
+		if _, ok := ownedKeys(n, lc.cfg.OwnerAnnotation)[lc.l.Name]; !ok {
+			b.nodes++
+		}
+	}
+	b.computed = true
+	if max := lc.maxBlastRadius(); max > 0 && b.nodes > max && !b.allowed {
+		lc.logger.Warningf("%s: generation %d newly selects %d nodes, over the max blast radius of %d: planned like a dry run until the labeler has the %s=%d annotation",
+			lc.l.Name, lc.ObservedGeneration(), b.nodes, max, lc.cfg.AllowBlastRadiusAnnotation, lc.ObservedGeneration())
+	}
+	return b.nodes, true
+}
+
+// blastGated returns true if the changes of the labeler generation are held back by
+// its blast radius.
+func (lc *LabelController) blastGated() bool {
+	max := lc.maxBlastRadius()
+	if max <= 0 {
+		return false
+	}
+	n, ok := lc.blastRadius()
+	if !ok || n <= max {
+		return false
+	}
+	lc.blast.mu.Lock()
+	defer lc.blast.mu.Unlock()
+	return !lc.blast.allowed
+}
+
+// allowBlastRadius allows the labeler generation to exceed the max blast radius, it
+// returns true if it was held back.
+func (lc *LabelController) allowBlastRadius() bool {
+	gated := lc.blastGated()
+	lc.blast.mu.Lock()
+	defer lc.blast.mu.Unlock()
+	lc.blast.allowed = true
+	return gated
+}
+
+// blastRadiusAllowed returns true if the labeler has the allow annotation of its
+// generation.
+func (c *Labeler) blastRadiusAllowed(l *labelerv1alpha1.Labeler) bool {
+	gen, err := strconv.ParseInt(l.Annotations[c.cfg.AllowBlastRadiusAnnotation], 10, 64)
+	return err == nil && gen >= l.Generation
+}
+
+// applyBlastRadiusAllowance applies the changes of the label controller held back by
+// its blast radius once allowed.
+func (c *Labeler) applyBlastRadiusAllowance(lc *LabelController, allowed bool) {
+	if !allowed || !lc.allowBlastRadius() {
+		return
+	}
+	n, _ := lc.blastRadius()
+	c.logger.Infof("%s: generation %d allowed to newly select %d nodes, applying it", lc.l.Name, lc.ObservedGeneration(), n)
+	c.enqueueLabeler(lc)
+}
+
+// blastRadiusCondition returns the BlastRadiusExceeded condition of the labeler held
+// back by its blast radius, nil if it's not.
+func (lc *LabelController) blastRadiusCondition() *Condition {
+	if !lc.blastGated() {
+		return nil
+	}
+	n, _ := lc.blastRadius()
+	return &Condition{
+		Labeler:  lc.l.Name,
+		Type:     ConditionBlastRadiusExceeded,
+		Severity: ConditionSeverityWarning,
+		Since:    lc.created.UTC(),
+		Message: fmt.Sprintf("generation %d newly selects %d nodes, over the max blast radius of %d: annotate the labeler with %s=%d to apply it",
+			lc.ObservedGeneration(), n, lc.maxBlastRadius(), lc.cfg.AllowBlastRadiusAnnotation, lc.ObservedGeneration()),
+	}
+}
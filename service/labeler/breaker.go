@@ -0,0 +1,87 @@
+package labeler
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultErrorCircuitWindow = 2 * time.Minute
+	// errorCircuitMinSyncs is the minimum number of syncs on the window to trip the
+	// circuit breaker, so a few errors don't trip it.
+	errorCircuitMinSyncs = 10
+)
+
+type syncResult struct {
+	time   time.Time
+	failed bool
+}
+
+// circuitBreaker stops the node mutations when the sync error rate over the window is
+// higher than the threshold. Once open it stays open for a window, then it's closed
+// again with no results.
+type circuitBreaker struct {
+	threshold float64
+	window    time.Duration
+
+	mu       sync.Mutex
+	results  []syncResult
+	open     bool
+	openedAt time.Time
+}
+
+// record records the result of a sync and returns true if it trips the breaker.
+func (b *circuitBreaker) record(failed bool, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.open {
+		return false
+	}
+
+	b.results = append(b.results, syncResult{time: now, failed: failed})
+	i := 0
+	for i < len(b.results) && now.Sub(b.results[i].time) > b.window {
+		i++
+	}
+	b.results = b.results[i:]
+
+	if len(b.results) < errorCircuitMinSyncs {
+		return false
+	}
+	failures := 0
+	for _, r := range b.results {
+		if r.failed {
+			failures++
+		}
+	}
+	if float64(failures)/float64(len(b.results)) <= b.threshold {
+		return false
+	}
+
+	b.open = true
+	b.openedAt = now
+	b.results = nil
+	return true
+}
+
+// allow returns true if the breaker is closed, otherwise how long it will stay open.
+// It also returns true if it was closed by this call.
+func (b *circuitBreaker) allow(now time.Time) (allowed bool, closed bool, remaining time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return true, false, 0
+	}
+	if elapsed := now.Sub(b.openedAt); elapsed < b.window {
+		return false, false, b.window - elapsed
+	}
+	b.open = false
+	return true, true, 0
+}
+
+// isOpen returns true if the breaker is open and since when.
+func (b *circuitBreaker) isOpen() (bool, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open, b.openedAt
+}
@@ -0,0 +1,72 @@
+package labeler
+
+import (
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// isCanary returns true if the node is annotated as canary of the labeler.
+func (lc *LabelController) isCanary(node *corev1.Node) bool {
+	for _, n := range strings.Split(node.Annotations[lc.cfg.CanaryAnnotation], ",") {
+		if strings.TrimSpace(n) == lc.l.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// isReady returns true if the node has the ready condition.
+func isReady(node *corev1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// observeCanary tracks since when a canary node is ready and has the labeler applied.
+func (lc *LabelController) observeCanary(node *corev1.Node, applied bool) {
+	if !lc.isCanary(node) {
+		return
+	}
+
+	lc.canaryMu.Lock()
+	defer lc.canaryMu.Unlock()
+	if !applied || !isReady(node) {
+		lc.canarySince.remove(node.Name)
+		return
+	}
+	if _, ok := lc.canarySince.get(node.Name); !ok {
+		lc.canarySince.add(node.Name, time.Now())
+	}
+}
+
+// canarySoakWait returns how long the rest of the rollout needs to wait for the canary
+// nodes to soak, 0 if it doesn't need to wait.
+func (lc *LabelController) canarySoakWait(matching []*corev1.Node) time.Duration {
+	if lc.l.Spec.CanarySoak == nil {
+		return 0
+	}
+	soak := lc.l.Spec.CanarySoak.Duration
+
+	lc.canaryMu.Lock()
+	defer lc.canaryMu.Unlock()
+	var wait time.Duration
+	for _, n := range matching {
+		if !lc.isCanary(n) {
+			continue
+		}
+		// Not healthy yet (or evicted from the cache), check again after a full soak.
+		since := time.Now()
+		if v, ok := lc.canarySince.get(n.Name); ok {
+			since = v.(time.Time)
+		}
+		if remaining := soak - time.Since(since); remaining > wait {
+			wait = remaining
+		}
+	}
+	return wait
+}
@@ -0,0 +1,86 @@
+package labeler
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// changePassRetry is when a node is planned again while its changes wait for the
+	// nodes before it in the rollout order.
+	changePassRetry = 5 * time.Second
+
+	defaultChangePass = 30 * time.Second
+)
+
+// changePass is the pass of MaxChangesPerPass, the nodes a labeler was allowed to
+// change since it started.
+type changePass struct {
+	mu       sync.Mutex
+	start    time.Time
+	admitted map[string]bool
+}
+
+// limitsChanges returns true if the changes of the labeler are capped by pass. The dry
+// run labelers don't change the nodes.
+func (lc *LabelController) limitsChanges() bool {
+	return lc.cfg.MaxChangesPerPass > 0 && !lc.DryRun()
+}
+
+// passPeriod returns the length of a pass, the resync period.
+func (lc *LabelController) passPeriod() time.Duration {
+	if lc.cfg.ResyncPeriod > 0 {
+		return lc.cfg.ResyncPeriod
+	}
+	return defaultChangePass
+}
+
+// admitChange returns true if the labeler can change the node in the current pass,
+// otherwise when to plan it again. The nodes are admitted in the rollout order: the
+// rollout nodes before it not planned yet, or whose changes were deferred, come first.
+func (lc *LabelController) admitChange(name string, now time.Time) (bool, time.Duration) {
+	sel := lc.selection()
+	period := lc.passPeriod()
+
+	lc.pass.mu.Lock()
+	defer lc.pass.mu.Unlock()
+	if lc.pass.start.IsZero() || now.Sub(lc.pass.start) >= period {
+		lc.pass.start, lc.pass.admitted = now, map[string]bool{}
+	}
+	if lc.pass.admitted[name] {
+		return true, 0
+	}
+	ends := lc.pass.start.Add(period).Sub(now)
+	limit := lc.cfg.MaxChangesPerPass
+	if len(lc.pass.admitted) >= limit {
+		return false, ends
+	}
+
+	// The canaries out of the rollout don't wait.
+	ahead := 0
+	for _, other := range sel.ordered {
+		if !sel.rollout[name] || other == name {
+			break
+		}
+		if lc.pass.admitted[other] {
+			continue
+		}
+		if st := lc.states.get(other); !st.passPlanned || st.passDeferred {
+			ahead++
+		}
+		if len(lc.pass.admitted)+ahead >= limit {
+			if ends < changePassRetry {
+				return false, ends
+			}
+			return false, changePassRetry
+		}
+	}
+	lc.pass.admitted[name] = true
+	return true, 0
+}
+
+// trackPassPlanned records that the node was planned with MaxChangesPerPass and if
+// its changes were deferred to a later pass.
+func (lc *LabelController) trackPassPlanned(name string, deferred bool) {
+	lc.states.update(name, func(st *nodeState) { st.passPlanned, st.passDeferred = true, deferred })
+}
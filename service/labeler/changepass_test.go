@@ -0,0 +1,82 @@
+package labeler
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	kooperlog "github.com/spotahome/kooper/log"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+func TestAdmitChange(t *testing.T) {
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for i, name := range []string{"n1", "n2", "n3", "n4"} {
+		store.Add(rolloutNode(name, i, "a"))
+	}
+	l := &labelerv1alpha1.Labeler{ObjectMeta: metav1.ObjectMeta{Name: "l"}, Spec: labelerv1alpha1.LabelerSpec{
+		NodeSelector: corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{
+			{Key: "topology.kubernetes.io/zone", Operator: corev1.NodeSelectorOpExists},
+		}}}},
+		RolloutOrder: labelerv1alpha1.RolloutOrderOldest,
+	}}
+	lc := NewLabelController(Config{MaxChangesPerPass: 2, ResyncPeriod: time.Minute}, l, store, kooperlog.Dummy)
+	now := time.Now()
+
+	steps := []struct {
+		name     string
+		node     string
+		planned  []string
+		after    time.Duration
+		expOK    bool
+		expAfter time.Duration
+	}{
+		{name: "n3 waits for the older nodes not planned yet.", node: "n3", expAfter: changePassRetry},
+		{name: "n1 is the oldest.", node: "n1", expOK: true},
+		{name: "n3 waits for n2.", node: "n3", planned: []string{"n1"}, expAfter: changePassRetry},
+		{name: "n3 is admitted once n2 is planned without change.", node: "n3", planned: []string{"n2"}, expOK: true},
+		{name: "An admitted node is admitted again in the pass.", node: "n3", expOK: true},
+		{name: "n4 waits for the next pass.", node: "n4", after: time.Second, expAfter: time.Minute - time.Second},
+		{name: "n4 is admitted in the next pass.", node: "n4", planned: []string{"n3"}, after: time.Minute, expOK: true},
+	}
+	for _, step := range steps {
+		for _, name := range step.planned {
+			lc.trackPassPlanned(name, false)
+		}
+		ok, after := lc.admitChange(step.node, now.Add(step.after))
+		if ok != step.expOK || after != step.expAfter {
+			t.Errorf("%s expected %t and %s, got %t and %s", step.name, step.expOK, step.expAfter, ok, after)
+		}
+	}
+}
+
+func TestMaxChangesPerPass(t *testing.T) {
+	var nodes []*corev1.Node
+	for i, name := range []string{"n1", "n2", "n3"} {
+		n := rolloutNode(name, i, "a")
+		n.Labels["pool"] = "a"
+		nodes = append(nodes, n)
+	}
+	s := newNodeServer(nodes...)
+	spec := labelerv1alpha1.LabelerSpec{Merge: mergeSpec(map[string]string{"team": "ops"}), RolloutOrder: labelerv1alpha1.RolloutOrderNewest}
+	c, stop := newSyncedLabeler(t, s, Config{MaxChangesPerPass: 1, ResyncPeriod: time.Minute}, poolLabeler("ops", "a", spec))
+	defer stop()
+
+	// The newest node is changed first, the others are deferred.
+	for _, name := range []string{"n1", "n2", "n3", "n1", "n2"} {
+		res := syncPatched(t, c, name)
+		if exp := name == "n3"; (res.Outcome == ReconcilePatched) != exp {
+			t.Errorf("expected node %s patched %t, got %s", name, exp, res.Outcome)
+		}
+		if res.Outcome != ReconcilePatched && res.RequeueAfter <= 0 {
+			t.Errorf("expected the deferred node %s requeued, got %s", name, res.RequeueAfter)
+		}
+	}
+	if n := s.patchCount(); n != 1 {
+		t.Errorf("expected a single patch in the pass, got %d", n)
+	}
+}
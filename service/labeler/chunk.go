@@ -0,0 +1,87 @@
+package labeler
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// defaultMaxPatchBytes is the default size over which the node patches are chunked.
+const defaultMaxPatchBytes = 256 * (1 << 10)
+
+// chunkPatch splits a node patch over max bytes in sequential patches of its labels and
+// annotations. The rest of the patch (e.g. the taints) and the last annotations (the
+// ownership, the content hash, the stamps and the fingerprint) are on the last chunk, so they are only
+// written once the rest is applied. A failed chunk leaves the node partially patched,
+// the next sync plans the remaining changes from it.
+func chunkPatch(patch map[string]interface{}, max int, last ...string) []map[string]interface{} {
+	b, err := json.Marshal(patch)
+	metadata, _ := patch["metadata"].(map[string]interface{})
+	if err != nil || len(b) <= max || metadata == nil {
+		return []map[string]interface{}{patch}
+	}
+
+	restMeta := map[string]interface{}{}
+	for k, v := range metadata {
+		restMeta[k] = v
+	}
+	var chunks []map[string]interface{}
+	chunk, size := map[string]interface{}{}, 0
+	flush := func() {
+		if size > 0 {
+			chunks = append(chunks, map[string]interface{}{"metadata": chunk})
+			chunk, size = map[string]interface{}{}, 0
+		}
+	}
+	for _, field := range []string{"labels", "annotations"} {
+		values, _ := metadata[field].(map[string]interface{})
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			if field == "annotations" && contains(last, k) {
+				continue
+			}
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		rest := map[string]interface{}{}
+		for k, v := range values {
+			rest[k] = v
+		}
+		for _, k := range keys {
+			vb, _ := json.Marshal(values[k])
+			// The quoted key, the colon and the comma.
+			entry := len(k) + len(vb) + 4
+			if size > 0 && size+entry > max {
+				flush()
+			}
+			fieldChunk, _ := chunk[field].(map[string]interface{})
+			if fieldChunk == nil {
+				fieldChunk = map[string]interface{}{}
+				chunk[field] = fieldChunk
+			}
+			fieldChunk[k] = values[k]
+			size += entry
+			delete(rest, k)
+		}
+		if len(rest) > 0 {
+			restMeta[field] = rest
+		} else {
+			delete(restMeta, field)
+		}
+	}
+	flush()
+
+	final := map[string]interface{}{}
+	for k, v := range patch {
+		if k != "metadata" {
+			final[k] = v
+		}
+	}
+	if len(restMeta) > 0 {
+		final["metadata"] = restMeta
+	}
+	if len(final) > 0 {
+		chunks = append(chunks, final)
+	}
+	return chunks
+}
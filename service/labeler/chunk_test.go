@@ -0,0 +1,70 @@
+package labeler
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChunkPatch(t *testing.T) {
+	labels := map[string]interface{}{"removed": nil}
+	for i := 0; i < 10; i++ {
+		labels[fmt.Sprintf("l%d", i)] = strings.Repeat("v", 20)
+	}
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels":      labels,
+			"annotations": map[string]interface{}{"note": strings.Repeat("n", 100), "owned": "{}"},
+		},
+		"spec": map[string]interface{}{"taints": []interface{}{}},
+	}
+	const max = 100
+
+	if chunks := chunkPatch(patch, 1<<20, "owned"); len(chunks) != 1 || !reflect.DeepEqual(chunks[0], patch) {
+		t.Errorf("expected a patch under the max as is, got %v", chunks)
+	}
+
+	chunks := chunkPatch(patch, max, "owned")
+	if len(chunks) < 3 {
+		t.Fatalf("expected the patch split in chunks, got %v", chunks)
+	}
+	// Every field is in a single chunk.
+	fields := map[string]interface{}{}
+	for i, chunk := range chunks {
+		metadata, _ := chunk["metadata"].(map[string]interface{})
+		size, entries := 0, 0
+		for _, field := range []string{"labels", "annotations"} {
+			values, _ := metadata[field].(map[string]interface{})
+			for k, v := range values {
+				if _, ok := fields[field+"/"+k]; ok {
+					t.Errorf("expected %s/%s in a single chunk, got %v", field, k, chunks)
+				}
+				fields[field+"/"+k] = v
+				vb, _ := json.Marshal(v)
+				size += len(k) + len(vb) + 4
+				entries++
+			}
+		}
+		last := i == len(chunks)-1
+		if _, ok := chunk["spec"]; ok != last {
+			t.Errorf("chunk %d: expected the spec on the last chunk only, got %v", i, chunk)
+		}
+		// A field over the max is a chunk alone.
+		if !last && size > max && entries > 1 {
+			t.Errorf("chunk %d: expected the chunk under %d bytes, got %d: %v", i, max, size, chunk)
+		}
+	}
+	exp := map[string]interface{}{"annotations/note": strings.Repeat("n", 100), "annotations/owned": "{}"}
+	for k, v := range labels {
+		exp["labels/"+k] = v
+	}
+	if !reflect.DeepEqual(fields, exp) {
+		t.Errorf("expected the chunks having the fields %v, got %v", exp, fields)
+	}
+	lastMeta, _ := chunks[len(chunks)-1]["metadata"].(map[string]interface{})
+	if annotations, _ := lastMeta["annotations"].(map[string]interface{}); annotations["owned"] != "{}" {
+		t.Errorf("expected the last annotations on the last chunk, got %v", chunks[len(chunks)-1])
+	}
+}
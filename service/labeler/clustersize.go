@@ -0,0 +1,75 @@
+package labeler
+
+import (
+	"fmt"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// clusterSizeMet returns true if the number of nodes is in the bounds of the condition,
+// no condition is always met.
+func clusterSizeMet(cond *labelerv1alpha1.ClusterSizeCondition, nodes int) bool {
+	if cond == nil {
+		return true
+	}
+	if cond.MinNodes != nil && nodes < int(*cond.MinNodes) {
+		return false
+	}
+	return cond.MaxNodes == nil || nodes <= int(*cond.MaxNodes)
+}
+
+// clusterSize returns the number of cached nodes.
+func (lc *LabelController) clusterSize() int {
+	return len(lc.nodes.ListKeys())
+}
+
+// clusterSizeUnmet returns why the cluster size condition of the labeler is not met,
+// empty if it is.
+func (lc *LabelController) clusterSizeUnmet() string {
+	cond := lc.l.Spec.ClusterSizeCondition
+	if cond == nil {
+		return ""
+	}
+	if n := lc.clusterSize(); !clusterSizeMet(cond, n) {
+		return fmt.Sprintf("the clusterSizeCondition is not met (%d nodes)", n)
+	}
+	return ""
+}
+
+// onAdd queues the added node to be synced, and the nodes of the labelers activated or
+// deactivated by the new cluster size.
+func (c *Labeler) onAdd(obj interface{}) {
+	c.nodesChanged(nil, nil)
+	c.dispatch(obj)
+	c.clusterSizeChanged(1)
+}
+
+// clusterSizeChanged queues the nodes of the labelers whose cluster size condition
+// changed with the last node added (1) or deleted (-1). Nothing is queued until the
+// cache is synced, the workers plan all the nodes after it.
+func (c *Labeler) clusterSizeChanged(delta int) {
+	if !c.nodesSynced() {
+		return
+	}
+	n := len(c.informer().GetStore().ListKeys())
+	var lcs []*LabelController
+	for _, lc := range c.controllers() {
+		cond := lc.l.Spec.ClusterSizeCondition
+		if cond == nil {
+			continue
+		}
+		met := clusterSizeMet(cond, n)
+		if met == clusterSizeMet(cond, n-delta) {
+			continue
+		}
+		if met {
+			c.logger.Infof("%s: cluster size condition met with %d nodes", lc.l.Name, n)
+		} else {
+			c.logger.Infof("%s: cluster size condition unmet with %d nodes", lc.l.Name, n)
+		}
+		lcs = append(lcs, lc)
+	}
+	if len(lcs) > 0 {
+		c.enqueueLabeler(lcs...)
+	}
+}
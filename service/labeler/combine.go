@@ -0,0 +1,201 @@
+package labeler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+	"github.com/joshisa/resource-labeler-operator/log"
+)
+
+// Combine policies, how the labels and annotations of the labelers applied on the
+// same node combine.
+const (
+	// CombineUnion applies all of them, on a key conflict the first labeler by the
+	// tiebreak order sets the value and the rest are reported as conflicts.
+	CombineUnion = "union"
+	// CombineStrict applies all of them except the conflicting keys, no labeler
+	// changes them and the labelers get a Conflict condition.
+	CombineStrict = "strict"
+
+	// ConditionConflict is set on the labelers that want different values for the
+	// same key on a node with the strict combine policy.
+	ConditionConflict = "Conflict"
+)
+
+// Conflict tiebreaks, the order the labelers are applied in so the first one wins the
+// conflicting keys. Ties of every tiebreak are broken by name.
+const (
+	TiebreakName       = "name"
+	TiebreakOldest     = "creationTimestamp-oldest"
+	TiebreakNewest     = "creationTimestamp-newest"
+	TiebreakGeneration = "generation"
+)
+
+// Tiebreaks are the known conflict tiebreaks.
+var Tiebreaks = []string{TiebreakName, TiebreakOldest, TiebreakNewest, TiebreakGeneration}
+
+// SortLabelers sorts the labelers in the order they are applied with the tiebreak: by
+// name, by creation (oldest or newest first) or by generation (the most edited first).
+func SortLabelers(ls []*labelerv1alpha1.Labeler, tiebreak string) {
+	sort.SliceStable(ls, func(i, j int) bool { return appliedBefore(ls[i], ls[j], tiebreak) })
+}
+
+func appliedBefore(a, b *labelerv1alpha1.Labeler, tiebreak string) bool {
+	switch tiebreak {
+	case TiebreakOldest, TiebreakNewest:
+		ta, tb := a.CreationTimestamp.Time, b.CreationTimestamp.Time
+		if !ta.Equal(tb) {
+			return ta.Before(tb) == (tiebreak == TiebreakOldest)
+		}
+	case TiebreakGeneration:
+		if a.Generation != b.Generation {
+			return a.Generation > b.Generation
+		}
+	}
+	return a.Name < b.Name
+}
+
+// strictConflict is a key that labelers want with different values on a node.
+type strictConflict struct {
+	key string
+	// with are the other labelers wanting the key.
+	with []string
+}
+
+func (sc strictConflict) String() string {
+	return fmt.Sprintf("%s (with %s)", sc.key, strings.Join(sc.with, ", "))
+}
+
+// strictConflicts returns the conflicting keys of every label controller applied on
+// the node, if the label controllers combine with the strict policy. Dry run label
+// controllers are not applied, they don't conflict.
+func strictConflicts(lcs []*LabelController, node *corev1.Node) map[*LabelController][]strictConflict {
+	if len(lcs) == 0 || lcs[0].cfg.CombinePolicy != CombineStrict {
+		return nil
+	}
+
+	// wanted are the labelers by value of every key.
+	wanted := map[string]map[string][]*LabelController{}
+	want := func(lc *LabelController, prefix string, m map[string]string) {
+		for k, v := range m {
+			if wanted[prefix+k] == nil {
+				wanted[prefix+k] = map[string][]*LabelController{}
+			}
+			wanted[prefix+k][v] = append(wanted[prefix+k][v], lc)
+		}
+	}
+	for _, lc := range lcs {
+		if lc.DryRun() {
+			continue
+		}
+		if result, _ := lc.explain(node); result != ExplainInSync {
+			continue
+		}
+		want(lc, labelsPrefix, lc.l.Spec.Merge.Labels)
+		want(lc, annotationsPrefix, lc.l.Spec.Merge.Annotations)
+	}
+
+	conflicts := map[*LabelController][]strictConflict{}
+	keys := make([]string, 0, len(wanted))
+	for k := range wanted {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if len(wanted[k]) < 2 {
+			continue
+		}
+		var all []*LabelController
+		for _, ls := range wanted[k] {
+			all = append(all, ls...)
+		}
+		for _, lc := range all {
+			sc := strictConflict{key: k}
+			for _, other := range all {
+				if other != lc {
+					sc.with = append(sc.with, other.l.Name)
+				}
+			}
+			sort.Strings(sc.with)
+			conflicts[lc] = append(conflicts[lc], sc)
+		}
+	}
+	return conflicts
+}
+
+// keepKeys restores on dst the value the node has (or doesn't have) of the conflicting
+// labels and annotations.
+func keepKeys(dst, node *corev1.Node, conflicts []strictConflict) {
+	keep := func(dstm *map[string]string, m map[string]string, k string) {
+		if v, ok := m[k]; ok {
+			if *dstm == nil {
+				*dstm = map[string]string{}
+			}
+			(*dstm)[k] = v
+			return
+		}
+		delete(*dstm, k)
+	}
+	for _, sc := range conflicts {
+		switch {
+		case strings.HasPrefix(sc.key, labelsPrefix):
+			keep(&dst.Labels, node.Labels, strings.TrimPrefix(sc.key, labelsPrefix))
+		case strings.HasPrefix(sc.key, annotationsPrefix):
+			keep(&dst.Annotations, node.Annotations, strings.TrimPrefix(sc.key, annotationsPrefix))
+		}
+	}
+}
+
+// trackStrictConflicts records the conflicting keys of the label controller on the
+// node, the new ones are logged.
+func (lc *LabelController) trackStrictConflicts(name string, conflicts []strictConflict, logger log.Logger) {
+	lc.states.update(name, func(st *nodeState) {
+		if len(conflicts) == 0 {
+			st.strictConflicts, st.conflictSince = nil, time.Time{}
+			return
+		}
+		if fmt.Sprint(st.strictConflicts) != fmt.Sprint(conflicts) {
+			logger.Warningf("%s: conflicting values on node %s left unchanged by the strict combine policy: %v", lc.l.Name, name, conflicts)
+		}
+		if len(st.strictConflicts) == 0 {
+			st.conflictSince = time.Now()
+		}
+		st.strictConflicts = conflicts
+	})
+}
+
+// conflictCondition returns the Conflict condition of the labeler with the conflicting
+// keys on the cached nodes, nil if there are none.
+func (lc *LabelController) conflictCondition() *Condition {
+	states := lc.states.cached(lc.nodes, func(st *nodeState) bool { return len(st.strictConflicts) > 0 })
+	if len(states) == 0 {
+		return nil
+	}
+	var since time.Time
+	seen := map[string]bool{}
+	var descs []string
+	for _, st := range states {
+		if since.IsZero() || st.conflictSince.Before(since) {
+			since = st.conflictSince
+		}
+		for _, sc := range st.strictConflicts {
+			if !seen[sc.String()] {
+				seen[sc.String()] = true
+				descs = append(descs, sc.String())
+			}
+		}
+	}
+	sort.Strings(descs)
+	return &Condition{
+		Labeler:  lc.l.Name,
+		Type:     ConditionConflict,
+		Severity: ConditionSeverityError,
+		Since:    since.UTC(),
+		Message:  fmt.Sprintf("conflicting values on %d nodes, left unchanged by the strict combine policy: %s", len(states), strings.Join(descs, "; ")),
+	}
+}
@@ -0,0 +1,129 @@
+package labeler
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// CompositeType is the valueFrom type combining the values of named value sources
+// with a template.
+const CompositeType = "composite"
+
+// sourceName are the names of the composite sources, usable as .name on the template.
+var sourceName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// namedSource is a value source of a composite value.
+type namedSource struct {
+	name   string
+	source ValueSource
+}
+
+// compositeSource resolves its sources and renders the template with their values by
+// name. If a source is not resolved the label gets the default, without it the label
+// is left untouched with an error naming the unresolved sources.
+type compositeSource struct {
+	sources    []namedSource
+	tmpl       *template.Template
+	hasDefault bool
+}
+
+// newCompositeSource returns the composite source of the valueFrom spec: its sources
+// and the "template" param, with the value template helpers.
+func newCompositeSource(vf labelerv1alpha1.ValueFromSpec) (ValueSource, error) {
+	if len(vf.Sources) == 0 {
+		return nil, fmt.Errorf("the %s type needs sources", CompositeType)
+	}
+	text, err := requiredParam(vf.Params, "template")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &compositeSource{hasDefault: vf.Default != nil}
+	empty := map[string]string{}
+	for _, ns := range vf.Sources {
+		if !sourceName.MatchString(ns.Name) {
+			return nil, fmt.Errorf("source name %q must be alphanumeric or '_', not starting with a digit", ns.Name)
+		}
+		if _, ok := empty[ns.Name]; ok {
+			return nil, fmt.Errorf("duplicated source %q", ns.Name)
+		}
+		if ns.Type == CompositeType {
+			return nil, fmt.Errorf("source %s can't be %s", ns.Name, CompositeType)
+		}
+		src, err := NewValueSource(labelerv1alpha1.ValueFromSpec{Type: ns.Type, Params: ns.Params})
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %s", ns.Name, err)
+		}
+		s.sources = append(s.sources, namedSource{name: ns.Name, source: src})
+		empty[ns.Name] = ""
+	}
+	if s.tmpl, err = template.New(CompositeType).Option("missingkey=error").Funcs(templateFuncs).Parse(text); err != nil {
+		return nil, fmt.Errorf("invalid template: %s", err)
+	}
+	// Rendering with every source catches the references to undeclared ones.
+	if err := s.tmpl.Execute(&bytes.Buffer{}, empty); err != nil {
+		return nil, fmt.Errorf("invalid template: %s", err)
+	}
+	return s, nil
+}
+
+// Resolve satisfies ValueSource interface, the sources are resolved by themselves.
+func (s *compositeSource) Resolve(node *corev1.Node) (string, bool, error) {
+	return s.resolveWith(node, func(src ValueSource, node *corev1.Node) (string, bool, error) {
+		return src.Resolve(node)
+	})
+}
+
+// resolveWith resolves the sources with resolve, so they get the pods and Secrets they
+// need, and renders the template.
+func (s *compositeSource) resolveWith(node *corev1.Node, resolve func(ValueSource, *corev1.Node) (string, bool, error)) (string, bool, error) {
+	values := make(map[string]string, len(s.sources))
+	var unresolved []string
+	for _, ns := range s.sources {
+		v, ok, err := resolve(ns.source, node)
+		if _, unavailable := err.(valueUnavailable); unavailable {
+			return "", false, err
+		}
+		if err != nil {
+			return "", false, fmt.Errorf("source %s: %s", ns.name, err)
+		}
+		if !ok {
+			unresolved = append(unresolved, ns.name)
+			continue
+		}
+		values[ns.name] = v
+	}
+	if len(unresolved) > 0 {
+		if s.hasDefault {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("sources %s not resolved", strings.Join(unresolved, ", "))
+	}
+
+	var buf bytes.Buffer
+	if err := s.tmpl.Execute(&buf, values); err != nil {
+		return "", false, fmt.Errorf("could not render the template: %s", err)
+	}
+	v := strings.TrimSpace(buf.String())
+	return v, v != "", nil
+}
+
+// leafSources returns the value source, or the sources of a composite one.
+func leafSources(src ValueSource) []ValueSource {
+	cs, ok := src.(*compositeSource)
+	if !ok {
+		return []ValueSource{src}
+	}
+	srcs := make([]ValueSource, 0, len(cs.sources))
+	for _, ns := range cs.sources {
+		srcs = append(srcs, ns.source)
+	}
+	return srcs
+}
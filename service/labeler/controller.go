@@ -3,42 +3,85 @@ package labeler
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"sync"
 	"time"
 
 	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
 	"github.com/joshisa/resource-labeler-operator/log"
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/watch"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/cache"
-
-	"github.com/spotahome/kooper/operator/controller"
-	"github.com/spotahome/kooper/operator/handler"
-	"github.com/spotahome/kooper/operator/retrieve"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	"github.com/imdario/mergo"
 )
 
-// PodKiller will kill pods at regular intervals.
+// NodeStore is where the label controllers get the nodes from, cache.Store satisfies it.
+type NodeStore interface {
+	List() []interface{}
+	ListKeys() []string
+	GetByKey(key string) (interface{}, bool, error)
+}
+
+// LabelController plans the changes of a labeler on the nodes.
 type LabelController struct {
+	cfg    Config
 	l      *labelerv1alpha1.Labeler
-	k8sCli kubernetes.Interface
+	nodes  NodeStore
 	logger log.Logger
 
-	running bool
-	mutex   sync.Mutex
-	stopC   chan struct{}
+	values   []labelValue
+	removals []labelRemoval
+
+	// observedGeneration is the latest labeler generation with the same spec.
+	observedGeneration int64
+	generationMu       sync.Mutex
+
+	// canarySince is since when every canary node is ready with the labeler applied.
+	canarySince *stateCache
+	canaryMu    sync.Mutex
+
+	// noMatchesSince is since when the labeler matches no nodes, zero if it matches.
+	noMatchesSince time.Time
+	noMatches      bool
+	// unknownKeys are the selector label keys that no node has, since unknownKeysSince.
+	unknownKeys      []string
+	unknownKeysSince time.Time
+	matchesMu        sync.Mutex
+
+	convergence   convergence
+	convergenceMu sync.Mutex
+
+	// states are what is tracked of the nodes between their syncs.
+	states nodeStates
+	// created is when the label controller was created, after the last spec edit.
+	created time.Time
+	// staged is 1 while the changes wait for the apply trigger.
+	staged int32
+	// blast is the blast radius of the generation, held back over the max.
+	blast blastRadius
+	// rollout is the rollout selection of the last node store generation.
+	rollout   rolloutSelection
+	rolloutMu sync.Mutex
+	// pass are the nodes changed in the current pass of MaxChangesPerPass.
+	pass changePass
 }
 
-// NewCustomPodKiller is a constructor that lets you customize everything on the object construction.
-func NewLabelController(l *labelerv1alpha1.Labeler, k8sCli kubernetes.Interface, logger log.Logger) *LabelController {
+// NewLabelController returns a new label controller. The nodes store is where the
+// nodes of the rollouts are, usually the cache of a node informer.
+func NewLabelController(cfg Config, l *labelerv1alpha1.Labeler, nodes NodeStore, logger log.Logger) *LabelController {
+	cfg = cfg.withDefaults()
+
 	return &LabelController{
-		l:      l,
-		k8sCli: k8sCli,
-		logger: logger,
+		cfg:                cfg,
+		l:                  l,
+		nodes:              nodes,
+		logger:             logger,
+		values:             labelValues(l),
+		removals:           labelRemovals(l),
+		observedGeneration: l.Generation,
+		canarySince:        newStateCache(stateCacheCanary, cfg.StateCacheSize, cfg.MetricsRecorder),
+		convergence:        convergence{since: time.Now()},
+		created:            time.Now(),
 	}
 }
 
@@ -47,98 +90,303 @@ func (lc *LabelController) SameSpec(l *labelerv1alpha1.Labeler) bool {
 	return reflect.DeepEqual(lc.l.Spec, l.Spec)
 }
 
-// Start will run the pod killer at regular intervals.
-func (lc *LabelController) Start() error {
-	lc.mutex.Lock()
-	defer lc.mutex.Unlock()
-	if lc.running {
-		return fmt.Errorf("already running")
+// DryRun returns true if the changes of the labeler are not applied, by its spec, the
+// global dry run, while staged or held back by its blast radius.
+func (lc *LabelController) DryRun() bool {
+	return lc.cfg.DryRun || lc.l.Spec.DryRun || lc.isStaged() || lc.blastGated()
+}
+
+// trackDryRun records whether the dry run labeler would change the node.
+func (lc *LabelController) trackDryRun(name string, changes bool) {
+	lc.states.update(name, func(st *nodeState) { st.wouldChange = changes })
+}
+
+// dryRunNodes returns the number of cached nodes the dry run labeler would change.
+func (lc *LabelController) dryRunNodes() int {
+	return len(lc.states.cached(lc.nodes, func(st *nodeState) bool { return st.wouldChange }))
+}
+
+// ObservedGeneration returns the latest labeler generation the label controller runs.
+func (lc *LabelController) ObservedGeneration() int64 {
+	lc.generationMu.Lock()
+	defer lc.generationMu.Unlock()
+	return lc.observedGeneration
+}
+
+// observe records a labeler generation with the same spec as the label controller.
+func (lc *LabelController) observe(generation int64) {
+	lc.generationMu.Lock()
+	defer lc.generationMu.Unlock()
+	lc.observedGeneration = generation
+}
+
+// Plan returns the node with the labeler applied (or withdrawn) and the mutation
+// operation, the node is nil if the labeler doesn't need to change it. It also returns
+// when the node needs to be planned again regardless of its events, 0 if not needed.
+func (lc *LabelController) Plan(node *corev1.Node) (*corev1.Node, string, time.Duration, error) {
+	return lc.plan(node, nil, lc.logger)
+}
+
+// plan is Plan leaving the conflicting keys of the strict combine policy unchanged,
+// logging with the logger of the node sync.
+func (lc *LabelController) plan(node *corev1.Node, conflicts []strictConflict, logger log.Logger) (*corev1.Node, string, time.Duration, error) {
+	exempt := lc.isExempt(node)
+	lc.trackExempt(node.Name, exempt)
+	if exempt {
+		log.Debugf(logger, "node %s exempted from the labeler by its %s annotation", node.Name, lc.cfg.ExemptAnnotation)
+		return nil, "", 0, nil
 	}
 
-	lc.stopC = make(chan struct{})
-	lc.running = true
+	if !NodeMatchesNodeSelectorTerms(node, lc.l.Spec.NodeSelectorTerms) {
+		if lc.l.Spec.ReportNearMatches {
+			lc.reportNearMatches(node, logger)
+		}
+		// The node may have been matched by a broader selector.
+		if dst := lc.withdrawn(node, logger); dst != nil {
+			logger.Infof("Node %s unmatch", node.Name)
+			return dst, MutationOperationRemove, 0, nil
+		}
+		logNoop(logger, lc.cfg.LogNoop, "Node %s unmatch", node.Name)
+		return nil, "", 0, nil
+	}
 
-	go func() {
-		lc.logger.Infof("started %s label controller", lc.l.Name)
-		if err := lc.run(); err != nil {
-			lc.logger.Errorf("error executing label controller: %s", err)
+	met, err := NodeMatchesRequirements(node, lc.l.Spec.When)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if met {
+		if met, err = NodeMatchesVersionSelector(node, lc.l.Spec.VersionSelector); err != nil {
+			return nil, "", 0, err
 		}
-	}()
+	}
+	met = met && NodeMatchesConditions(node, lc.l.Spec.ConditionSelector) && NodeMatchesNodeGroups(node, lc.l.Spec.NodeGroupSelector) &&
+		lc.clusterSizeUnmet() == ""
+	// The node is planned again when the effective window opens.
+	var opens time.Duration
+	if met {
+		var unmet string
+		unmet, opens = lc.effectiveUnmet(time.Now())
+		met = unmet == ""
+	}
+	if !met {
+		dst := lc.withdrawn(node, logger)
+		if dst != nil {
+			logger.Infof("Node %s doesn't meet the labeler requirements", node.Name)
+		} else {
+			logNoop(logger, lc.cfg.LogNoop, "Node %s doesn't meet the labeler requirements", node.Name)
+		}
+		lc.trackConvergence(node.Name, dst == nil)
+		return dst, MutationOperationRemove, opens, nil
+	}
 
-	return nil
+	if ok, wait := lc.inRollout(node); !ok {
+		logNoop(logger, lc.cfg.LogNoop, "Node %s not selected by the rollout", node.Name)
+		return nil, "", wait, nil
+	}
+
+	dst := lc.desiredNode(node, conflicts, logger)
+	applied := samePatchable(node, dst)
+	lc.observeCanary(node, applied)
+	lc.trackConvergence(node.Name, applied)
+	if applied {
+		logNoop(logger, lc.cfg.LogNoop, "Node %s unchanged", node.Name)
+		return nil, "", lc.requeueAfter(node), nil
+	}
+	return dst, MutationOperationUpdate, lc.requeueAfter(node), nil
 }
 
-// Stop stops the pod killer.
-func (lc *LabelController) Stop() error {
-	lc.mutex.Lock()
-	defer lc.mutex.Unlock()
-	if lc.running {
-		close(lc.stopC)
-		lc.logger.Infof("stopped %s label controller", lc.l.Name)
+// withdrawn returns the node without the attributes owned by the labeler, nil if
+// there is nothing to remove or they are retained.
+func (lc *LabelController) withdrawn(node *corev1.Node, logger log.Logger) *corev1.Node {
+	lc.trackDeferredTaints(node.Name, nil, logger)
+	lc.trackSoaks(node.Name, nil)
+	if lc.l.Spec.Retain {
+		return nil
+	}
+	if _, ok := ownedKeys(node, lc.cfg.OwnerAnnotation)[lc.l.Name]; !ok {
+		return nil
 	}
 
-	lc.running = false
-	return nil
+	dst := node.DeepCopy()
+	if kept := removeOwned(dst, lc.cfg.OwnerAnnotation, lc.l.Name, lc.protected); len(kept) > 0 {
+		logger.Infof("%s: protected keys %s of node %s not removed", lc.l.Name, strings.Join(kept, ", "), node.Name)
+	}
+	return dst
+}
+
+// protected returns true if the attribute key is protected from removal by the
+// operator or the labeler protect lists.
+func (lc *LabelController) protected(key string) bool {
+	return keyProtected(key, lc.cfg.ProtectKeys, lc.l.Spec.ProtectedKeys)
+}
+
+// requeueAfter returns when a selected node needs to be synced again regardless
+// of its events, 0 if not needed.
+func (lc *LabelController) requeueAfter(node *corev1.Node) time.Duration {
+	requeue := lc.nextValueChange(node)
+	// The DaemonSet is not watched, it's checked again until it tolerates the taints.
+	if lc.taintsBlocked(node.Name) && (requeue == 0 || blockedTaintsRetry < requeue) {
+		requeue = blockedTaintsRetry
+	}
+	if lc.removalDeferred(node.Name) {
+		if due := time.Until(lc.removalDue()); requeue == 0 || due < requeue {
+			requeue = due
+		}
+	}
+	if r := lc.l.Spec.RequeueAfter; r != nil && (requeue == 0 || r.Duration < requeue) {
+		requeue = r.Duration
+	}
+	if left := lc.effectiveLeft(time.Now()); left > 0 && (requeue == 0 || left < requeue) {
+		requeue = left
+	}
+	if left := lc.soakLeft(node.Name); left > 0 && (requeue == 0 || left < requeue) {
+		requeue = left
+	}
+	return requeue
 }
 
-// run will run the loop that will kill eventually the required pods.
-func (lc *LabelController) run() error {
-	// Create our retriever so the controller knows how to get/listen for pod events.
-	retr := &retrieve.Resource{
-		Object: &corev1.Node{},
-		ListerWatcher: &cache.ListWatch{
-			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
-				return lc.k8sCli.CoreV1().Nodes().List(options)
-			},
-			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
-				return lc.k8sCli.CoreV1().Nodes().Watch(options)
-			},
-		},
+// desiredNode returns a copy of the node with the labeler attributes applied, except
+// for the conflicting keys.
+func (lc *LabelController) desiredNode(node *corev1.Node, conflicts []strictConflict, logger log.Logger) *corev1.Node {
+	//dst := *lc.l.Spec.Merge.DeepCopy()
+	dst := node.DeepCopy()
+
+	if err := mergo.Merge(&dst.ObjectMeta, lc.l.Spec.Merge.ObjectMeta, mergo.WithAppendSlice); err != nil {
+		logger.Infof("merge error: %v", err)
 	}
 
-	// Our domain logic that will print every add/sync/update and delete event we .
-	hand := &handler.HandlerFunc{
-		AddFunc: func(obj runtime.Object) error {
-			node, ok := obj.(*corev1.Node)
-			if !ok {
-				return fmt.Errorf("invalid node object %s", node)
-			}
-			lc.logger.Infof("Node updated: %s", node.Name)
+	if err := mergo.Merge(&dst.Spec, lc.l.Spec.Merge.NodeSpec, mergo.WithOverride); err != nil {
+		logger.Infof("merge error: %v", err)
+	}
 
-			if !NodeMatchesNodeSelectorTerms(node, lc.l.Spec.NodeSelectorTerms) {
-				lc.logger.Infof("Node unmatch")
-				return nil
-			}
+	lc.resolveValues(dst, logger)
+	lc.blockUntolerated(node, dst, logger)
+	lc.removeDroppedTaints(node, dst, logger)
+	lc.escalateTaints(node, dst, logger)
+	keepKeys(dst, node, conflicts)
+	renameLabels(dst, lc.l.Spec.Rename)
+	removeLabels(dst, lc.removals)
+	setOwnedKeys(dst, lc.cfg.OwnerAnnotation, lc.l.Name, lc.appliedKeys(node, dst))
+	return dst
+}
 
-			//dst := *lc.l.Spec.Merge.DeepCopy()
-			dst := node.DeepCopy()
+// reportNearMatches logs the selector terms the node matches except for one clause.
+func (lc *LabelController) reportNearMatches(node *corev1.Node, logger log.Logger) {
+	for _, nm := range NodeNearMatches(node, lc.l.Spec.NodeSelectorTerms) {
+		logger.Infof("%s: node %s near match on node selector term %d, failing clause: %s", lc.l.Name, node.Name, nm.Term, FormatRequirement(nm.Clause))
+	}
+}
 
-			if err := mergo.Merge(&dst.ObjectMeta, lc.l.Spec.Merge.ObjectMeta, mergo.WithAppendSlice); err != nil {
-				lc.logger.Infof("merge error: %v", err)
+// resolveValues sets the labels with values resolved from the node. Labels without
+// resolved value nor default are withdrawn if the labeler owns them, left untouched
+// otherwise. Labels whose value doesn't match the value pattern, can't be resolved or
+// isn't available yet are left untouched.
+func (lc *LabelController) resolveValues(node *corev1.Node, logger log.Logger) {
+	var mismatches []string
+	defer func() { lc.trackValueMismatches(node.Name, mismatches, logger) }()
+	owned := map[string]bool{}
+	for _, k := range ownedKeys(node, lc.cfg.OwnerAnnotation)[lc.l.Name] {
+		owned[k] = true
+	}
+	for _, lv := range lc.values {
+		v, ok, err := lc.resolve(lv.source, node)
+		if _, unavailable := err.(valueUnavailable); unavailable {
+			log.Debugf(logger, "%s: label %s value of node %s not available, left untouched: %s", lc.l.Name, lv.label, node.Name, err)
+			continue
+		}
+		if err != nil {
+			logger.Warningf("%s: could not resolve label %s value of node %s: %s", lc.l.Name, lv.label, node.Name, err)
+			continue
+		}
+		if !ok {
+			if lv.def == nil {
+				if _, ok := node.Labels[lv.label]; ok && owned[labelsPrefix+lv.label] {
+					logger.Infof("%s: node %s has no value for label %s, withdrawn", lc.l.Name, node.Name, lv.label)
+					delete(node.Labels, lv.label)
+					continue
+				}
+				log.Debugf(logger, "%s: node %s has no value for label %s, skipping it", lc.l.Name, node.Name, lv.label)
+				continue
 			}
+			v = *lv.def
+		} else {
+			v = transformValue(v, lv.transform)
+		}
+		if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+			logger.Warningf("%s: resolved label %s value %q of node %s is not valid: %s", lc.l.Name, lv.label, v, node.Name, strings.Join(errs, ", "))
+			continue
+		}
+		if lv.pattern != nil && !lv.pattern.MatchString(v) {
+			mismatches = append(mismatches, fmt.Sprintf("label %s value %q doesn't match %s", lv.label, v, lv.pattern))
+			continue
+		}
 
-			if err := mergo.Merge(&dst.Spec, lc.l.Spec.Merge.NodeSpec, mergo.WithOverride); err != nil {
-				lc.logger.Infof("merge error: %v", err)
-			}
+		if node.Labels == nil {
+			node.Labels = map[string]string{}
+		}
+		node.Labels[lv.label] = v
+	}
+}
 
-			if reflect.DeepEqual(dst, node) {
-				lc.logger.Infof("Node unchanged")
-				return nil
+// forgetNode drops the state of the deleted node and what the value sources cached of
+// it.
+func (lc *LabelController) forgetNode(name string) {
+	if st := lc.states.forget(name); st.exempt {
+		lc.recordExemptNodes()
+	}
+	for _, lv := range lc.values {
+		for _, src := range leafSources(lv.source) {
+			if cs, ok := src.(NodeCachingValueSource); ok {
+				cs.ForgetNode(name)
 			}
-			_, err := lc.k8sCli.CoreV1().Nodes().Update(dst)
-			lc.logger.Infof("Node updated")
-			return err
-		},
-		DeleteFunc: func(s string) error {
-			// log.Infof("Node deleted: %s", s)
-			return nil
-		},
-	}
-
-	// Create the controller that will refresh every 30 seconds.
-
-	ctrl := controller.NewSequential(30*time.Second, hand, retr, nil, lc.logger)
-	// Start our controller.
-	stopC := make(chan struct{})
-	return ctrl.Run(stopC)
+		}
+	}
+}
+
+// resolve resolves the value of the source, with the pods assigned to the node, the
+// Secrets, the node lease or the scheduling failures if the source needs them and they
+// are available.
+func (lc *LabelController) resolve(src ValueSource, node *corev1.Node) (string, bool, error) {
+	if cs, ok := src.(*compositeSource); ok {
+		return cs.resolveWith(node, lc.resolve)
+	}
+	if ss, ok := src.(SecretsValueSource); ok && lc.cfg.Secrets != nil {
+		return ss.ResolveSecrets(node, lc.cfg.Secrets)
+	}
+	if ls, ok := src.(LeaseValueSource); ok && lc.cfg.Leases != nil {
+		renewed, ok := lc.cfg.Leases.NodeLeaseRenewTime(node.Name)
+		if !ok {
+			return "", false, nil
+		}
+		return ls.ResolveLease(node, renewed)
+	}
+	if fs, ok := src.(FailuresValueSource); ok && lc.cfg.SchedulingFailures != nil {
+		failures, ok := lc.cfg.SchedulingFailures.NodeSchedulingFailures(node.Name)
+		if !ok {
+			return "", false, nil
+		}
+		return fs.ResolveFailures(node, failures)
+	}
+	ps, ok := src.(PodsValueSource)
+	if !ok || lc.cfg.Pods == nil {
+		return src.Resolve(node)
+	}
+	pods, err := lc.cfg.Pods.NodePods(node.Name)
+	if err != nil {
+		return "", false, err
+	}
+	return ps.ResolvePods(node, pods)
+}
+
+// renameLabels moves the value of the renamed label keys to their new key. Nodes
+// without the source key are left untouched.
+func renameLabels(node *corev1.Node, renames []labelerv1alpha1.RenameSpec) {
+	for _, r := range renames {
+		v, ok := node.Labels[r.From]
+		if !ok {
+			continue
+		}
+		node.Labels[r.To] = v
+		delete(node.Labels, r.From)
+	}
 }
@@ -0,0 +1,124 @@
+package labeler
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+func TestNarrowedSelectorWithdrawsOwnedAttributes(t *testing.T) {
+	dedicated := corev1.Taint{Key: "dedicated", Value: "ops", Effect: corev1.TaintEffectNoSchedule}
+	tests := []struct {
+		name      string
+		retain    bool
+		expLabels map[string]string
+		expAnnots map[string]string
+		expTaints []corev1.Taint
+	}{
+		{
+			name:      "The owned attributes are removed, the ones the node had are kept.",
+			expLabels: map[string]string{"pool": "a", "env": "prod"},
+			expAnnots: map[string]string{},
+		},
+		{
+			name:      "With retain the owned attributes are kept.",
+			retain:    true,
+			expLabels: map[string]string{"pool": "a", "env": "prod", "team": "ops"},
+			expAnnots: map[string]string{"owner": "ops"},
+			expTaints: []corev1.Taint{dedicated},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newNodeServer(testNode("n1", map[string]string{"pool": "a", "env": "prod"}))
+			spec := labelerv1alpha1.LabelerSpec{Retain: test.retain, Merge: labelerv1alpha1.MergeSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"team": "ops", "env": "prod"}, Annotations: map[string]string{"owner": "ops"}},
+				NodeSpec:   corev1.NodeSpec{Taints: []corev1.Taint{dedicated}},
+			}}
+			c, stop := newSyncedLabeler(t, s, Config{}, poolLabeler("ops", "a", spec))
+			defer stop()
+			if res := syncPatched(t, c, "n1"); res.Outcome != ReconcilePatched {
+				t.Fatalf("expected the selected node patched, got %s", res.Outcome)
+			}
+
+			// The selector no longer matches the node.
+			narrowed := poolLabeler("ops", "b", spec)
+			narrowed.Generation = 2
+			if err := c.EnsureLabeler(narrowed); err != nil {
+				t.Fatal(err)
+			}
+			syncPatched(t, c, "n1")
+
+			node := s.node("n1")
+			if !reflect.DeepEqual(node.Labels, test.expLabels) {
+				t.Errorf("expected the labels %v, got %v", test.expLabels, node.Labels)
+			}
+			annots := map[string]string{}
+			for k, v := range node.Annotations {
+				if k != c.cfg.OwnerAnnotation {
+					annots[k] = v
+				}
+			}
+			if !reflect.DeepEqual(annots, test.expAnnots) {
+				t.Errorf("expected the annotations %v, got %v", test.expAnnots, annots)
+			}
+			if len(node.Spec.Taints) != len(test.expTaints) || len(test.expTaints) > 0 && !reflect.DeepEqual(node.Spec.Taints, test.expTaints) {
+				t.Errorf("expected the taints %v, got %v", test.expTaints, node.Spec.Taints)
+			}
+			if _, owned := ownedKeys(node, c.cfg.OwnerAnnotation)["ops"]; owned != test.retain {
+				t.Errorf("expected the labeler owning attributes %t, got %t", test.retain, owned)
+			}
+		})
+	}
+}
+
+func TestRenamedLabelsWithdrawn(t *testing.T) {
+	s := newNodeServer(testNode("n1", map[string]string{"pool": "a", "zone": "eu-west-1a"}))
+	spec := labelerv1alpha1.LabelerSpec{Rename: []labelerv1alpha1.RenameSpec{{From: "zone", To: "example.com/zone"}}}
+	c, stop := newSyncedLabeler(t, s, Config{}, poolLabeler("ops", "a", spec))
+	defer stop()
+	syncPatched(t, c, "n1")
+
+	node := s.node("n1")
+	if exp := map[string]string{"pool": "a", "example.com/zone": "eu-west-1a"}; !reflect.DeepEqual(node.Labels, exp) {
+		t.Fatalf("expected the labels %v, got %v", exp, node.Labels)
+	}
+	if exp := []string{"labels/example.com/zone"}; !reflect.DeepEqual(ownedKeys(node, c.cfg.OwnerAnnotation)["ops"], exp) {
+		t.Errorf("expected the owned keys %v, got %v", exp, ownedKeys(node, c.cfg.OwnerAnnotation)["ops"])
+	}
+
+	// The selector no longer matches the node, the renamed label is withdrawn.
+	narrowed := poolLabeler("ops", "b", spec)
+	narrowed.Generation = 2
+	if err := c.EnsureLabeler(narrowed); err != nil {
+		t.Fatal(err)
+	}
+	syncPatched(t, c, "n1")
+	if exp := map[string]string{"pool": "a"}; !reflect.DeepEqual(s.node("n1").Labels, exp) {
+		t.Errorf("expected the labels %v, got %v", exp, s.node("n1").Labels)
+	}
+}
+
+func TestRemovedLabels(t *testing.T) {
+	s := newNodeServer(testNode("n1", map[string]string{
+		"pool": "a", "legacy": "x", "example.com/old-gpu": "x", "example.com/gpu": "x", "node.kubernetes.io/old-gpu": "x",
+	}))
+	spec := labelerv1alpha1.LabelerSpec{
+		Merge:        mergeSpec(map[string]string{"team": "ops"}),
+		RemoveLabels: []string{"legacy", `/.*old-.*/`},
+	}
+	c, stop := newSyncedLabeler(t, s, Config{}, poolLabeler("ops", "a", spec))
+	defer stop()
+	syncPatched(t, c, "n1")
+
+	// The expressions don't match the reserved keys.
+	exp := map[string]string{"pool": "a", "team": "ops", "example.com/gpu": "x", "node.kubernetes.io/old-gpu": "x"}
+	if got := s.node("n1").Labels; !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected the labels %v, got %v", exp, got)
+	}
+}
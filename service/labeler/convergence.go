@@ -0,0 +1,80 @@
+package labeler
+
+import (
+	"time"
+)
+
+// convergenceCheckInterval is the period the converging labelers are checked.
+const convergenceCheckInterval = 5 * time.Second
+
+// convergence tracks a labeler spec until it's applied on all the selected nodes.
+type convergence struct {
+	// since is when the spec was observed.
+	since time.Time
+	// converged are when every node was last planned with the labeler converged.
+	converged map[string]time.Time
+	done      bool
+}
+
+// trackConvergence records whether the labeler doesn't need to change the node anymore
+// (it's applied or there is nothing left to withdraw) or still does.
+func (lc *LabelController) trackConvergence(name string, converged bool) {
+	lc.convergenceMu.Lock()
+	defer lc.convergenceMu.Unlock()
+	if lc.convergence.done {
+		return
+	}
+	if !converged {
+		delete(lc.convergence.converged, name)
+		return
+	}
+	if lc.convergence.converged == nil {
+		lc.convergence.converged = map[string]time.Time{}
+	}
+	lc.convergence.converged[name] = time.Now()
+}
+
+// checkConvergence returns how long the labeler took to converge if all the selected
+// nodes are converged, once. The selected nodes are checked every time, nodes that
+// start matching while converging need to converge too and the ones that stop
+// matching are not waited for. Labelers selecting no nodes converge without
+// duration.
+func (lc *LabelController) checkConvergence() (time.Duration, bool) {
+	lc.convergenceMu.Lock()
+	done := lc.convergence.done
+	lc.convergenceMu.Unlock()
+	if done {
+		return 0, false
+	}
+	selected := lc.selectedNodes()
+
+	lc.convergenceMu.Lock()
+	defer lc.convergenceMu.Unlock()
+	var last time.Time
+	for name := range selected {
+		t, ok := lc.convergence.converged[name]
+		if !ok {
+			return 0, false
+		}
+		if t.After(last) {
+			last = t
+		}
+	}
+	lc.convergence.done = true
+	lc.convergence.converged = nil
+	if len(selected) == 0 {
+		return 0, false
+	}
+	return last.Sub(lc.convergence.since), true
+}
+
+// checkConvergences records the convergence time of the labelers that converged since
+// the last check.
+func (c *Labeler) checkConvergences() {
+	for _, lc := range c.controllers() {
+		if d, ok := lc.checkConvergence(); ok {
+			c.logger.Infof("%s: labeler applied on %d nodes in %s", lc.l.Name, lc.AffectedNodes(), d)
+			c.cfg.MetricsRecorder.ObserveLabelerConvergence(lc.l.Name, d)
+		}
+	}
+}
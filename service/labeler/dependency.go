@@ -0,0 +1,135 @@
+package labeler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// ConditionSelectorDependency is set on the labelers selecting the nodes on label keys
+// other labelers set, their matches depend on the order the labelers are applied.
+const ConditionSelectorDependency = "SelectorDependency"
+
+// SelectorDependency is a labeler selecting the nodes on label keys another labeler
+// sets or removes.
+type SelectorDependency struct {
+	Labeler string
+	// Dependency is the labeler setting the keys.
+	Dependency string
+	Keys       []string
+	// SecondSync is true if the dependency is applied after the labeler, the nodes
+	// converge on their next sync instead of the same one.
+	SecondSync bool
+}
+
+func (d SelectorDependency) String() string {
+	order := "applied before it"
+	if d.SecondSync {
+		order = "applied after it, the nodes converge on a second sync"
+	}
+	return fmt.Sprintf("%s selects on %s set by %s (%s)", d.Labeler, strings.Join(d.Keys, ", "), d.Dependency, order)
+}
+
+// appliedLabels returns the label keys the labeler sets or removes, sorted.
+func appliedLabels(l *labelerv1alpha1.Labeler) []string {
+	set := map[string]bool{}
+	for k := range l.Spec.Merge.Labels {
+		set[k] = true
+	}
+	for _, vm := range l.Spec.ValueMap {
+		set[vm.To] = true
+	}
+	for _, vf := range l.Spec.ValueFrom {
+		set[vf.Label] = true
+	}
+	for _, r := range l.Spec.Rename {
+		set[r.From] = true
+		set[r.To] = true
+	}
+	for _, r := range labelRemovals(l) {
+		if r.re == nil {
+			set[r.key] = true
+		}
+	}
+
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SelectorDependencies returns the labelers selecting the nodes on label keys other
+// labelers set. The labelers are in the order they are applied.
+func SelectorDependencies(ls []*labelerv1alpha1.Labeler) []SelectorDependency {
+	applied := make([]map[string]bool, len(ls))
+	for i, l := range ls {
+		applied[i] = map[string]bool{}
+		for _, k := range appliedLabels(l) {
+			applied[i][k] = true
+		}
+	}
+
+	var deps []SelectorDependency
+	for i, l := range ls {
+		matched := matchedLabels(l)
+		for j, dep := range ls {
+			if i == j {
+				continue
+			}
+			var keys []string
+			for _, k := range matched {
+				if applied[j][k] {
+					keys = append(keys, k)
+				}
+			}
+			if len(keys) > 0 {
+				deps = append(deps, SelectorDependency{Labeler: l.Name, Dependency: dep.Name, Keys: keys, SecondSync: j > i})
+			}
+		}
+	}
+	return deps
+}
+
+// dependencyConditions returns the SelectorDependency conditions of the label
+// controllers, the unchanged ones keep their time.
+func (c *Labeler) dependencyConditions(lcs []*LabelController) []Condition {
+	ls := make([]*labelerv1alpha1.Labeler, 0, len(lcs))
+	for _, lc := range lcs {
+		ls = append(ls, lc.l)
+	}
+	descs := map[string][]string{}
+	var names []string
+	for _, d := range SelectorDependencies(ls) {
+		if _, ok := descs[d.Labeler]; !ok {
+			names = append(names, d.Labeler)
+		}
+		descs[d.Labeler] = append(descs[d.Labeler], d.String())
+	}
+
+	c.dependencyMu.Lock()
+	defer c.dependencyMu.Unlock()
+	prev := c.dependencies
+	c.dependencies = map[string]Condition{}
+	conds := make([]Condition, 0, len(names))
+	for _, name := range names {
+		msg := "the matches depend on the labelers order: " + strings.Join(descs[name], "; ")
+		cond, ok := prev[name]
+		if !ok || cond.Message != msg {
+			cond = Condition{
+				Labeler:  name,
+				Type:     ConditionSelectorDependency,
+				Severity: ConditionSeverityWarning,
+				Since:    time.Now().UTC(),
+				Message:  msg,
+			}
+		}
+		c.dependencies[name] = cond
+		conds = append(conds, cond)
+	}
+	return conds
+}
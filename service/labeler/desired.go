@@ -0,0 +1,42 @@
+package labeler
+
+import "sync"
+
+// desiredLabels are the labels of every node once all the labelers are applied, for
+// the desired state publishing.
+type desiredLabels struct {
+	mu    sync.Mutex
+	nodes map[string]map[string]string
+}
+
+// record sets the desired labels of the node, a copy.
+func (d *desiredLabels) record(name string, labels map[string]string) {
+	cp := make(map[string]string, len(labels))
+	for k, v := range labels {
+		cp[k] = v
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.nodes == nil {
+		d.nodes = map[string]map[string]string{}
+	}
+	d.nodes[name] = cp
+}
+
+func (d *desiredLabels) remove(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.nodes, name)
+}
+
+// DesiredLabels returns the labels every synced node has once all the labelers are
+// applied, only recorded with TrackDesiredLabels. The maps must not be modified.
+func (c *Labeler) DesiredLabels() map[string]map[string]string {
+	c.desired.mu.Lock()
+	defer c.desired.mu.Unlock()
+	nodes := make(map[string]map[string]string, len(c.desired.nodes))
+	for name, labels := range c.desired.nodes {
+		nodes[name] = labels
+	}
+	return nodes
+}
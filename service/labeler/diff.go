@@ -0,0 +1,72 @@
+package labeler
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Change operations.
+const (
+	ChangeAdd    = "add"
+	ChangeUpdate = "change"
+	ChangeRemove = "remove"
+)
+
+// Change is the difference of a node attribute between two versions of a node.
+type Change struct {
+	// Key is the attribute, prefixed by its kind (labels/, annotations/, taints/).
+	Key       string `json:"key"`
+	Operation string `json:"operation"`
+	Old       string `json:"old,omitempty"`
+	New       string `json:"new,omitempty"`
+}
+
+// Diff returns the attribute changes between the old and the new node, sorted by key.
+// The owner annotation is bookkeeping, not a change.
+func Diff(old, new *corev1.Node, ownerAnnotation string) []Change {
+	changes := diffMap(labelsPrefix, old.Labels, new.Labels)
+	changes = append(changes, diffMap(annotationsPrefix, without(old.Annotations, ownerAnnotation), without(new.Annotations, ownerAnnotation))...)
+	changes = append(changes, diffMap(taintsPrefix, taintValues(old.Spec.Taints), taintValues(new.Spec.Taints))...)
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+func diffMap(prefix string, old, new map[string]string) []Change {
+	var changes []Change
+	for k, v := range new {
+		ov, ok := old[k]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Key: prefix + k, Operation: ChangeAdd, New: v})
+		case ov != v:
+			changes = append(changes, Change{Key: prefix + k, Operation: ChangeUpdate, Old: ov, New: v})
+		}
+	}
+	for k, v := range old {
+		if _, ok := new[k]; !ok {
+			changes = append(changes, Change{Key: prefix + k, Operation: ChangeRemove, Old: v})
+		}
+	}
+	return changes
+}
+
+func without(m map[string]string, keys ...string) map[string]string {
+	res := make(map[string]string, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+	for _, k := range keys {
+		delete(res, k)
+	}
+	return res
+}
+
+func taintValues(taints []corev1.Taint) map[string]string {
+	m := make(map[string]string, len(taints))
+	for _, t := range taints {
+		m[taintKey(t)] = t.Value
+	}
+	return m
+}
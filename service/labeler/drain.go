@@ -0,0 +1,63 @@
+package labeler
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultDrainingRequeue is when a draining node is synced again by default.
+const defaultDrainingRequeue = time.Minute
+
+// draining returns true if the node is being drained, and why: it's unschedulable and
+// it has the draining annotation or pods being evicted (terminating).
+func (c *Labeler) draining(node *corev1.Node) (bool, string, error) {
+	if !node.Spec.Unschedulable {
+		return false, "", nil
+	}
+	if _, ok := node.Annotations[c.cfg.DrainingAnnotation]; ok {
+		return true, "draining annotation", nil
+	}
+
+	pods, err := c.terminatingPods(node)
+	if err != nil {
+		return false, "", err
+	}
+	if pods > 0 {
+		return true, fmt.Sprintf("%d pods terminating", pods), nil
+	}
+	return false, "", nil
+}
+
+// terminatingPods returns the number of pods of the node being deleted, from the pod
+// cache if the pods are watched.
+func (c *Labeler) terminatingPods(node *corev1.Node) (int, error) {
+	var pods []*corev1.Pod
+	if c.podInformer != nil {
+		var err error
+		if pods, err = c.NodePods(node.Name); err != nil {
+			return 0, err
+		}
+	} else {
+		c.cycle.apiCall()
+		list, err := c.k8sCli.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+			FieldSelector: "spec.nodeName=" + node.Name,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("could not list the pods of node %s: %s", node.Name, err)
+		}
+		for i := range list.Items {
+			pods = append(pods, &list.Items[i])
+		}
+	}
+
+	n := 0
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil && !podTerminated(pod) {
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,28 @@
+package labeler
+
+import (
+	"fmt"
+	"time"
+)
+
+// effectiveUnmet returns why the labeler is out of its effectiveFrom and effectiveUntil
+// window at the time, empty if it's in, and how long until the window opens, 0 if it
+// doesn't open again.
+func (lc *LabelController) effectiveUnmet(now time.Time) (string, time.Duration) {
+	if from := lc.l.Spec.EffectiveFrom; from != nil && now.Before(from.Time) {
+		return fmt.Sprintf("the labeler is effective from %s", from.UTC().Format(time.RFC3339)), from.Sub(now)
+	}
+	if until := lc.l.Spec.EffectiveUntil; until != nil && !now.Before(until.Time) {
+		return fmt.Sprintf("the labeler was effective until %s", until.UTC().Format(time.RFC3339)), 0
+	}
+	return "", 0
+}
+
+// effectiveLeft returns how long until the effectiveUntil closes the window of the
+// effective labeler, 0 without it.
+func (lc *LabelController) effectiveLeft(now time.Time) time.Duration {
+	if until := lc.l.Spec.EffectiveUntil; until != nil && now.Before(until.Time) {
+		return until.Sub(now)
+	}
+	return 0
+}
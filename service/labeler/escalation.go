@@ -0,0 +1,161 @@
+package labeler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/joshisa/resource-labeler-operator/log"
+)
+
+const (
+	// ConditionTaintEscalation is set while NoExecute taints of the labeler soak as
+	// NoSchedule on some nodes.
+	ConditionTaintEscalation = "TaintEscalation"
+
+	// killSwitchHaltEscalationKey is the kill switch ConfigMap data key that halts the
+	// taint escalations when "true".
+	killSwitchHaltEscalationKey = "haltTaintEscalation"
+)
+
+// EscalationHalter knows if the taint escalations are halted fleet-wide.
+type EscalationHalter interface {
+	EscalationHalted() bool
+}
+
+// soakTaint returns the NoSchedule taint a NoExecute taint soaks as.
+func soakTaint(t corev1.Taint) corev1.Taint {
+	t.Effect = corev1.TaintEffectNoSchedule
+	t.TimeAdded = nil
+	return t
+}
+
+// soaks returns true if the taint is the NoSchedule soak taint of an escalated merge
+// taint.
+func (lc *LabelController) soaks(t corev1.Taint) bool {
+	if lc.l.Spec.TaintEscalation == nil || t.Effect != corev1.TaintEffectNoSchedule {
+		return false
+	}
+	t.Effect = corev1.TaintEffectNoExecute
+	return lc.mergesTaint(t)
+}
+
+// escalationHalted returns true if the taint escalations are halted fleet-wide.
+func (lc *LabelController) escalationHalted() bool {
+	return lc.cfg.EscalationHalt != nil && lc.cfg.EscalationHalt.EscalationHalted()
+}
+
+// escalateTaints replaces on the desired node the NoExecute merge taints the node
+// doesn't have yet by their NoSchedule soak taint. The soak starts when the node is
+// seen Ready with the soak taint and restarts if it's not Ready, once over the node
+// gets the NoExecute taint instead unless the escalations are halted. NoExecute taints
+// blocked by the required tolerating DaemonSet keep soaking.
+func (lc *LabelController) escalateTaints(node, dst *corev1.Node, logger log.Logger) {
+	esc := lc.l.Spec.TaintEscalation
+	if esc == nil {
+		return
+	}
+	current := taintValues(node.Spec.Taints)
+	desired := taintValues(dst.Spec.Taints)
+	now := time.Now()
+	halted := lc.escalationHalted()
+	soaking := map[string]time.Time{}
+	for _, t := range lc.l.Spec.Merge.Taints {
+		if t.Effect != corev1.TaintEffectNoExecute {
+			continue
+		}
+		if _, ok := current[taintKey(t)]; ok {
+			continue
+		}
+		soak := soakTaint(t)
+		if _, ok := current[taintKey(soak)]; ok && isReady(node) {
+			since, ok := lc.soakSince(node.Name, taintKey(t))
+			if !ok {
+				since = now
+			}
+			_, applicable := desired[taintKey(t)]
+			if !halted && applicable && now.Sub(since) >= esc.Soak.Duration {
+				logger.Infof("%s: taint %s soaked for %s on node %s, escalated to %s", lc.l.Name, soak.ToString(), now.Sub(since).Round(time.Second), node.Name, corev1.TaintEffectNoExecute)
+				removeTaint(dst, soak)
+				continue
+			}
+			soaking[taintKey(t)] = since
+		}
+		removeTaint(dst, t)
+		removeTaint(dst, soak)
+		dst.Spec.Taints = append(dst.Spec.Taints, soak)
+	}
+	lc.trackSoaks(node.Name, soaking)
+}
+
+// soakSince returns since when the NoExecute taint soaks on the node.
+func (lc *LabelController) soakSince(name, key string) (time.Time, bool) {
+	since, ok := lc.states.get(name).soaking[key]
+	return since, ok
+}
+
+// trackSoaks records since when the NoExecute taints soak on the node, none clears it.
+func (lc *LabelController) trackSoaks(name string, soaking map[string]time.Time) {
+	lc.states.update(name, func(st *nodeState) { st.soaking = soaking })
+}
+
+// soakLeft returns how long until the next taint soak on the node is over, 0 if none
+// is soaking or the escalations are halted.
+func (lc *LabelController) soakLeft(name string) time.Duration {
+	esc := lc.l.Spec.TaintEscalation
+	if esc == nil || lc.escalationHalted() {
+		return 0
+	}
+	var left time.Duration
+	for _, since := range lc.states.get(name).soaking {
+		d := time.Until(since.Add(esc.Soak.Duration))
+		if d <= 0 {
+			d = time.Second
+		}
+		if left == 0 || d < left {
+			left = d
+		}
+	}
+	return left
+}
+
+// taintEscalationCondition returns the TaintEscalation condition of the labeler with
+// the cached nodes whose NoExecute taints soak as NoSchedule, nil if there are none.
+func (lc *LabelController) taintEscalationCondition() *Condition {
+	states := lc.states.cached(lc.nodes, func(st *nodeState) bool { return len(st.soaking) > 0 })
+	nodes := len(states)
+	var since time.Time
+	seen := map[string]bool{}
+	var taints []string
+	for _, st := range states {
+		for key, s := range st.soaking {
+			if since.IsZero() || s.Before(since) {
+				since = s
+			}
+			if !seen[key] {
+				seen[key] = true
+				taints = append(taints, key)
+			}
+		}
+	}
+	if nodes == 0 {
+		return nil
+	}
+	sort.Strings(taints)
+	msg := fmt.Sprintf("taints %s soaking as %s on %d nodes for %s before their escalation",
+		strings.Join(taints, ", "), corev1.TaintEffectNoSchedule, nodes, lc.l.Spec.TaintEscalation.Soak.Duration)
+	if lc.escalationHalted() {
+		msg = fmt.Sprintf("taints %s soaking as %s on %d nodes, the escalations are halted by the kill switch",
+			strings.Join(taints, ", "), corev1.TaintEffectNoSchedule, nodes)
+	}
+	return &Condition{
+		Labeler:  lc.l.Name,
+		Type:     ConditionTaintEscalation,
+		Severity: ConditionSeverityWarning,
+		Since:    since.UTC(),
+		Message:  msg,
+	}
+}
@@ -0,0 +1,146 @@
+package labeler
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/flowcontrol"
+
+	"github.com/joshisa/resource-labeler-operator/log"
+)
+
+const (
+	eventComponent = "resource-labeler-operator"
+	// eventAggregationWindow is how long the identical events of a node are counted on
+	// the same event, like the Kubernetes event aggregation.
+	eventAggregationWindow = 10 * time.Minute
+	defaultEventBurst      = 25
+)
+
+// Event state caches.
+const (
+	stateCacheEvents        = "events"
+	stateCacheEventLimiters = "event-limiters"
+)
+
+// aggregatedEvent is a created event counting the identical ones.
+type aggregatedEvent struct {
+	name  string
+	first metav1.Time
+	last  time.Time
+	count int32
+}
+
+// eventSink creates the node events. The identical events of a node are aggregated in
+// counts and, with a QPS, the events of a node and reason are rate limited by a token
+// bucket, the dropped ones are counted by the next aggregated one.
+type eventSink struct {
+	qps   float32
+	burst int
+
+	mu         sync.Mutex
+	aggregated *stateCache
+	limiters   *stateCache
+}
+
+func newEventSink(cfg Config) *eventSink {
+	return &eventSink{
+		qps:        cfg.EventQPS,
+		burst:      cfg.EventBurst,
+		aggregated: newStateCache(stateCacheEvents, cfg.StateCacheSize, cfg.MetricsRecorder),
+		limiters:   newStateCache(stateCacheEventLimiters, cfg.StateCacheSize, cfg.MetricsRecorder),
+	}
+}
+
+// next returns the event to write, with the name of the event to update if it's an
+// identical one, or false if the event is rate limited.
+func (s *eventSink) next(node *corev1.Node, reason, message string, now time.Time) (*aggregatedEvent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := node.Name + "/" + reason + "/" + message
+	var ev *aggregatedEvent
+	if v, ok := s.aggregated.get(key); ok && now.Sub(v.(*aggregatedEvent).last) < eventAggregationWindow {
+		ev = v.(*aggregatedEvent)
+		ev.count++
+		ev.last = now
+	} else {
+		ev = &aggregatedEvent{first: metav1.NewTime(now), last: now, count: 1}
+		s.aggregated.add(key, ev)
+	}
+
+	if s.qps > 0 {
+		lkey := node.Name + "/" + reason
+		v, ok := s.limiters.get(lkey)
+		if !ok {
+			v = flowcontrol.NewTokenBucketRateLimiter(s.qps, s.burst)
+			s.limiters.add(lkey, v)
+		}
+		if !v.(flowcontrol.RateLimiter).TryAccept() {
+			return nil, false
+		}
+	}
+	// A copy, the API calls are done out of the lock.
+	cp := *ev
+	return &cp, true
+}
+
+// created sets the name of the aggregated event once it's created.
+func (s *eventSink) created(node *corev1.Node, reason, message, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.aggregated.get(node.Name + "/" + reason + "/" + message); ok {
+		v.(*aggregatedEvent).name = name
+	}
+}
+
+// nodeEvent creates a warning event on the node, or updates the count of the identical
+// one. Failures are only logged.
+func (c *Labeler) nodeEvent(node *corev1.Node, reason, message string) {
+	ev, ok := c.events.next(node, reason, message, time.Now())
+	if !ok {
+		log.Debugf(c.nodeLogger(node.Name), "%s event of node %s rate limited", reason, node.Name)
+		c.cfg.MetricsRecorder.IncEventsDropped(reason)
+		return
+	}
+	events := c.k8sCli.CoreV1().Events(metav1.NamespaceDefault)
+	if ev.name != "" {
+		patch, _ := json.Marshal(map[string]interface{}{"count": ev.count, "lastTimestamp": metav1.NewTime(ev.last)})
+		_, err := events.Patch(ev.name, types.MergePatchType, patch)
+		if err == nil {
+			return
+		}
+		// E.g. the event expired, a new one is created.
+		log.Debugf(c.nodeLogger(node.Name), "could not update %s event %s of node %s: %s", reason, ev.name, node.Name, err)
+	}
+
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", node.Name, ev.last.UnixNano()),
+			Namespace: metav1.NamespaceDefault,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind: "Node",
+			Name: node.Name,
+			UID:  node.UID,
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           corev1.EventTypeWarning,
+		Source:         corev1.EventSource{Component: eventComponent},
+		FirstTimestamp: ev.first,
+		LastTimestamp:  metav1.NewTime(ev.last),
+		Count:          ev.count,
+	}
+	created, err := events.Create(event)
+	if err != nil {
+		c.nodeLogger(node.Name).Warningf("could not create %s event of node %s: %s", reason, node.Name, err)
+		return
+	}
+	c.events.created(node, reason, message, created.Name)
+}
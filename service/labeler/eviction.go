@@ -0,0 +1,160 @@
+package labeler
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	evictionEventReason = "TaintEviction"
+	// stateCacheEvictionReports caches the NoExecute taints reported of a node.
+	stateCacheEvictionReports = "eviction-reports"
+)
+
+// EvictionReport is the impact of the NoExecute taints a node patch adds.
+type EvictionReport struct {
+	Node string `json:"node"`
+	// Taints are the added NoExecute taints.
+	Taints []string `json:"taints"`
+	// Pods are the pods of the node that will be evicted.
+	Pods []EvictedPod `json:"pods"`
+}
+
+// EvictedPod is a pod evicted by the added taints.
+type EvictedPod struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// TolerationSeconds is how long the pod tolerates the taints before being
+	// evicted, not set if the pod is evicted right away.
+	TolerationSeconds *int64 `json:"tolerationSeconds,omitempty"`
+}
+
+// addedNoExecuteTaints returns the NoExecute taints of the desired node that the node
+// doesn't have.
+func addedNoExecuteTaints(node, dst *corev1.Node) []corev1.Taint {
+	current := map[string]bool{}
+	for _, t := range node.Spec.Taints {
+		current[taintKey(t)] = true
+	}
+
+	var added []corev1.Taint
+	for _, t := range dst.Spec.Taints {
+		if t.Effect == corev1.TaintEffectNoExecute && !current[taintKey(t)] {
+			added = append(added, t)
+		}
+	}
+	return added
+}
+
+// evictionReport returns the pods evicted by the NoExecute taints the patch from the
+// node to the desired one adds, nil if it doesn't add NoExecute taints or if they were
+// already reported, e.g. by a previous attempt of the patch.
+func (c *Labeler) evictionReport(node, dst *corev1.Node) (*EvictionReport, error) {
+	taints := addedNoExecuteTaints(node, dst)
+	if len(taints) == 0 {
+		// The reported taints are applied (or no longer desired), reported again if
+		// they are added again.
+		c.evictionReports.remove(node.Name)
+		return nil, nil
+	}
+	keys := make([]string, 0, len(taints))
+	for _, t := range taints {
+		keys = append(keys, taintKey(t))
+	}
+	sort.Strings(keys)
+	if v, ok := c.evictionReports.get(node.Name); ok && v.(string) == strings.Join(keys, ",") {
+		return nil, nil
+	}
+
+	pods, err := c.evictionPods(node.Name)
+	if err != nil {
+		return nil, fmt.Errorf("could not list the pods of node %s: %s", node.Name, err)
+	}
+
+	report := &EvictionReport{Node: node.Name, Taints: keys, Pods: []EvictedPod{}}
+	for _, pod := range pods {
+		if podTerminated(pod) {
+			continue
+		}
+		if evicted, seconds := evictedBy(pod, taints); evicted {
+			report.Pods = append(report.Pods, EvictedPod{Namespace: pod.Namespace, Name: pod.Name, TolerationSeconds: seconds})
+		}
+	}
+	return report, nil
+}
+
+// evictionPods returns the pods of the node, from the pod informer if the pods are
+// watched.
+func (c *Labeler) evictionPods(nodeName string) ([]*corev1.Pod, error) {
+	if c.podInformer != nil && c.podInformer.HasSynced() {
+		return c.NodePods(nodeName)
+	}
+	list, err := c.k8sCli.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: "spec.nodeName=" + nodeName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	pods := make([]*corev1.Pod, 0, len(list.Items))
+	for i := range list.Items {
+		pods = append(pods, &list.Items[i])
+	}
+	return pods, nil
+}
+
+// evictedBy returns true if the pod is evicted by the taints, and after how many
+// seconds if it tolerates them for a while.
+func evictedBy(pod *corev1.Pod, taints []corev1.Taint) (bool, *int64) {
+	var evicted bool
+	var seconds *int64
+	for i := range taints {
+		var tolerated, forever bool
+		var taintSeconds *int64
+		for j := range pod.Spec.Tolerations {
+			tol := &pod.Spec.Tolerations[j]
+			if !tol.ToleratesTaint(&taints[i]) {
+				continue
+			}
+			tolerated = true
+			if tol.TolerationSeconds == nil {
+				forever = true
+				break
+			}
+			if taintSeconds == nil || *tol.TolerationSeconds > *taintSeconds {
+				taintSeconds = tol.TolerationSeconds
+			}
+		}
+
+		switch {
+		case !tolerated:
+			// Evicted right away.
+			return true, nil
+		case forever:
+		default:
+			evicted = true
+			if seconds == nil || *taintSeconds < *seconds {
+				seconds = taintSeconds
+			}
+		}
+	}
+	return evicted, seconds
+}
+
+// reportEviction outputs the eviction report as JSON and as a node event, once per
+// node and taints.
+func (c *Labeler) reportEviction(node *corev1.Node, report *EvictionReport) {
+	c.evictionReports.add(node.Name, strings.Join(report.Taints, ","))
+	b, _ := json.Marshal(report)
+	c.nodeLogger(node.Name).Warningf("taint eviction report: %s", b)
+
+	pods := make([]string, 0, len(report.Pods))
+	for _, p := range report.Pods {
+		pods = append(pods, p.Namespace+"/"+p.Name)
+	}
+	c.nodeEvent(node, evictionEventReason, fmt.Sprintf("NoExecute taints %s evict %d pods: %s", strings.Join(report.Taints, ", "), len(pods), strings.Join(pods, ", ")))
+}
@@ -0,0 +1,207 @@
+package labeler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	kooperlog "github.com/spotahome/kooper/log"
+)
+
+func int64Ptr(i int64) *int64 { return &i }
+
+func TestEvictedBy(t *testing.T) {
+	dedicated := corev1.Taint{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoExecute}
+	drain := corev1.Taint{Key: "drain", Effect: corev1.TaintEffectNoExecute}
+	tolerate := func(key string, seconds *int64) corev1.Toleration {
+		return corev1.Toleration{Key: key, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute, TolerationSeconds: seconds}
+	}
+	tests := []struct {
+		name        string
+		tolerations []corev1.Toleration
+		taints      []corev1.Taint
+		expEvicted  bool
+		expSeconds  *int64
+	}{
+		{
+			name:       "A pod not tolerating a taint is evicted right away.",
+			taints:     []corev1.Taint{dedicated},
+			expEvicted: true,
+		},
+		{
+			name:        "A pod tolerating the taints forever is not evicted.",
+			tolerations: []corev1.Toleration{tolerate("dedicated", nil)},
+			taints:      []corev1.Taint{dedicated},
+		},
+		{
+			name:        "A pod tolerating a taint for a while is evicted after the longest toleration.",
+			tolerations: []corev1.Toleration{tolerate("dedicated", int64Ptr(60)), tolerate("", int64Ptr(300))},
+			taints:      []corev1.Taint{dedicated},
+			expEvicted:  true,
+			expSeconds:  int64Ptr(300),
+		},
+		{
+			name:        "A pod tolerating the taints for a while is evicted after the shortest one.",
+			tolerations: []corev1.Toleration{tolerate("dedicated", int64Ptr(600)), tolerate("drain", int64Ptr(30))},
+			taints:      []corev1.Taint{dedicated, drain},
+			expEvicted:  true,
+			expSeconds:  int64Ptr(30),
+		},
+		{
+			name:        "A pod not tolerating one of the taints is evicted right away.",
+			tolerations: []corev1.Toleration{tolerate("dedicated", int64Ptr(600))},
+			taints:      []corev1.Taint{dedicated, drain},
+			expEvicted:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Tolerations: test.tolerations}}
+			evicted, seconds := evictedBy(pod, test.taints)
+			if evicted != test.expEvicted || !reflect.DeepEqual(seconds, test.expSeconds) {
+				t.Errorf("expected evicted %t after %v, got %t after %v", test.expEvicted, test.expSeconds, evicted, seconds)
+			}
+		})
+	}
+}
+
+// evictionServer serves the pods of node n1 and counts the pod lists and the events.
+type evictionServer struct {
+	done chan struct{}
+
+	mu     sync.Mutex
+	lists  int
+	events int
+}
+
+func (s *evictionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.URL.Path == "/api/v1/pods" && r.URL.Query().Get("watch") == "true":
+		// The pod watches get no events until the test is done.
+		s.mu.Unlock()
+		<-s.done
+		s.mu.Lock()
+	case r.URL.Path == "/api/v1/pods":
+		s.lists++
+		json.NewEncoder(w).Encode(&corev1.PodList{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "PodList"},
+			ListMeta: metav1.ListMeta{ResourceVersion: "1"},
+			Items: []corev1.Pod{
+				{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-1"}, Spec: corev1.PodSpec{NodeName: "n1"}},
+				{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "done"}, Spec: corev1.PodSpec{NodeName: "n1"}, Status: corev1.PodStatus{Phase: corev1.PodSucceeded}},
+			},
+		})
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/namespaces/default/events":
+		s.events++
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("{}"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *evictionServer) counts() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lists, s.events
+}
+
+func TestEvictionReportedOnce(t *testing.T) {
+	s := &evictionServer{done: make(chan struct{})}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	defer close(s.done)
+	cli, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{TaintEvictionReport: true}.withDefaults()
+	c := &Labeler{
+		cfg:             cfg,
+		logger:          kooperlog.Dummy,
+		k8sCli:          cli,
+		queue:           newTrackedQueue("eviction"),
+		evictionReports: newStateCache(stateCacheEvictionReports, cfg.StateCacheSize, cfg.MetricsRecorder),
+		events:          newEventSink(cfg),
+	}
+	defer c.queue.ShutDown()
+
+	node := testNode("n1", nil)
+	drain := corev1.Taint{Key: "drain", Effect: corev1.TaintEffectNoExecute}
+	dst := testNode("n1", nil, drain)
+	report := func() *EvictionReport {
+		r, err := c.evictionReport(node, dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r != nil {
+			c.reportEviction(node, r)
+		}
+		return r
+	}
+
+	r := report()
+	exp := &EvictionReport{Node: "n1", Taints: []string{"drain:NoExecute"}, Pods: []EvictedPod{{Namespace: "default", Name: "web-1"}}}
+	if !reflect.DeepEqual(r, exp) {
+		t.Fatalf("expected report %+v, got %+v", exp, r)
+	}
+	if lists, events := s.counts(); lists != 1 || events != 1 {
+		t.Errorf("expected a pod list and an event, got %d lists and %d events", lists, events)
+	}
+
+	// A retry of the patch doesn't report the same taints again.
+	if r := report(); r != nil {
+		t.Errorf("expected the taints reported once, got %+v", r)
+	}
+	if lists, events := s.counts(); lists != 1 || events != 1 {
+		t.Errorf("expected no pod list nor event on retries, got %d lists and %d events", lists, events)
+	}
+
+	// Other taints are reported.
+	dst = testNode("n1", nil, drain, corev1.Taint{Key: "dedicated", Effect: corev1.TaintEffectNoExecute})
+	if r := report(); r == nil || !reflect.DeepEqual(r.Taints, []string{"dedicated:NoExecute", "drain:NoExecute"}) {
+		t.Errorf("expected the new taint set reported, got %+v", r)
+	}
+
+	// Once applied the taints are reported again if they are added again.
+	node = dst
+	if r := report(); r != nil {
+		t.Errorf("expected no report without added taints, got %+v", r)
+	}
+	node = testNode("n1", nil)
+	if r := report(); r == nil {
+		t.Errorf("expected the taints added again reported")
+	}
+
+	// With the pods watched they come from the informer.
+	stopC := make(chan struct{})
+	defer close(stopC)
+	c.podInformer = c.newPodInformer()
+	go c.podInformer.Run(stopC)
+	if !cache.WaitForCacheSync(stopC, c.podInformer.HasSynced) {
+		t.Fatal("expected the pod informer synced")
+	}
+	lists, _ := s.counts()
+	c.evictionReports.remove("n1")
+	if r := report(); r == nil || len(r.Pods) != 1 {
+		t.Errorf("expected the pod of the informer evicted, got %+v", r)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if got, _ := s.counts(); got != lists {
+		t.Errorf("expected no pod list with the pod informer, got %d lists", got-lists)
+	}
+}
@@ -0,0 +1,44 @@
+package labeler
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// exemptAll in the exempt annotation exempts the node from all the labelers.
+const exemptAll = "*"
+
+// isExempt returns true if the exempt annotation of the node lists the labeler, or all
+// of them.
+func (lc *LabelController) isExempt(node *corev1.Node) bool {
+	v, ok := node.Annotations[lc.cfg.ExemptAnnotation]
+	if !ok {
+		return false
+	}
+	for _, n := range strings.Split(v, ",") {
+		if n = strings.TrimSpace(n); n == lc.l.Name || n == exemptAll {
+			return true
+		}
+	}
+	return false
+}
+
+// trackExempt records whether the node is exempted from the labeler and sets the
+// number of cached exempt nodes.
+func (lc *LabelController) trackExempt(name string, exempt bool) {
+	changed := false
+	lc.states.update(name, func(st *nodeState) {
+		changed = st.exempt != exempt
+		st.exempt = exempt
+	})
+	if changed {
+		lc.recordExemptNodes()
+	}
+}
+
+// recordExemptNodes sets the number of cached exempt nodes.
+func (lc *LabelController) recordExemptNodes() {
+	n := len(lc.states.cached(lc.nodes, func(st *nodeState) bool { return st.exempt }))
+	lc.cfg.MetricsRecorder.SetExemptNodes(lc.l.Name, n)
+}
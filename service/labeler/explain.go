@@ -0,0 +1,183 @@
+package labeler
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Labeler explanation results.
+const (
+	ExplainNotSelected        = "NotSelected"
+	ExplainRequirementsNotMet = "RequirementsNotMet"
+	ExplainNotInRollout       = "NotInRollout"
+	ExplainInSync             = "InSync"
+	ExplainChanges            = "Changes"
+	ExplainError              = "Error"
+)
+
+// LabelerExplanation is why and how a labeler applies to a node.
+type LabelerExplanation struct {
+	Labeler string `json:"labeler"`
+	Result  string `json:"result"`
+	Reason  string `json:"reason"`
+	// DryRun labelers changes are not applied, the next labelers don't see them.
+	DryRun bool `json:"dryRun,omitempty"`
+	// Changes are the changes of the labeler, on top of the previous labelers.
+	Changes []Change `json:"changes,omitempty"`
+}
+
+// Conflict is a label or annotation a labeler wants with a value the node keeps, the
+// existing values are never overridden.
+type Conflict struct {
+	Key     string `json:"key"`
+	Labeler string `json:"labeler"`
+	Wanted  string `json:"wanted"`
+	Kept    string `json:"kept"`
+	// KeptBy is the labeler that set the kept value, empty if the node already had it.
+	KeptBy string `json:"keptBy,omitempty"`
+}
+
+// NodeExplanation is how the labelers plan a node.
+type NodeExplanation struct {
+	Node      string               `json:"node"`
+	Labelers  []LabelerExplanation `json:"labelers"`
+	Conflicts []Conflict           `json:"conflicts,omitempty"`
+	// Labels are the node labels once planned.
+	Labels map[string]string `json:"labels"`
+	// Plan are the changes of the node once planned.
+	Plan []Change `json:"plan"`
+}
+
+// ExplainNode plans the label controllers in order on the node like PlanNode and
+// explains the result of every one of them. Nothing is mutated.
+func ExplainNode(lcs []*LabelController, node *corev1.Node, ownerAnnotation string) NodeExplanation {
+	exp := NodeExplanation{Node: node.Name, Labelers: []LabelerExplanation{}}
+	dst := node
+	// setBy is the labeler that set every attribute.
+	setBy := map[string]string{}
+	conflicts := strictConflicts(lcs, node)
+	for _, lc := range lcs {
+		result, reason := lc.explain(dst)
+		le := LabelerExplanation{Labeler: lc.l.Name, Result: result, Reason: reason, DryRun: lc.DryRun()}
+		if cs := conflicts[lc]; len(cs) > 0 {
+			le.Reason += fmt.Sprintf(", conflicting keys left unchanged by the strict combine policy: %v", cs)
+		}
+
+		planned, _, _, err := lc.plan(dst, conflicts[lc], lc.logger)
+		switch {
+		case err != nil:
+			le.Result, le.Reason = ExplainError, err.Error()
+		case planned != nil:
+			le.Changes = Diff(dst, planned, ownerAnnotation)
+			if le.Result == ExplainInSync {
+				le.Result = ExplainChanges
+			}
+			if le.DryRun {
+				le.Reason += ", dry run: the changes are not applied"
+				break
+			}
+			for _, c := range le.Changes {
+				setBy[c.Key] = lc.l.Name
+			}
+			dst = planned
+		}
+		if result == ExplainInSync || result == ExplainChanges {
+			exp.Conflicts = append(exp.Conflicts, lc.conflicts(dst, setBy)...)
+		}
+		exp.Labelers = append(exp.Labelers, le)
+	}
+
+	exp.Labels = dst.Labels
+	exp.Plan = Diff(node, dst, ownerAnnotation)
+	return exp
+}
+
+// explain returns why the labeler applies or not to the node, like Plan.
+func (lc *LabelController) explain(node *corev1.Node) (string, string) {
+	if !NodeMatchesNodeSelectorTerms(node, lc.l.Spec.NodeSelectorTerms) {
+		reason := "the node doesn't match the nodeSelectorTerms"
+		if _, ok := ownedKeys(node, lc.cfg.OwnerAnnotation)[lc.l.Name]; ok {
+			switch {
+			case lc.l.Spec.Retain:
+				reason += ", the applied attributes are retained"
+			default:
+				reason += ", the applied attributes are removed"
+			}
+		}
+		return ExplainNotSelected, reason
+	}
+
+	var unmet string
+	met, err := NodeMatchesRequirements(node, lc.l.Spec.When)
+	if err != nil {
+		return ExplainError, err.Error()
+	}
+	if !met {
+		unmet = "the when requirements are not met"
+	}
+	if unmet == "" {
+		if met, err = NodeMatchesVersionSelector(node, lc.l.Spec.VersionSelector); err != nil {
+			return ExplainError, err.Error()
+		}
+		if !met {
+			unmet = fmt.Sprintf("the versionSelector is not met (kubelet %q, kernel %q)", node.Status.NodeInfo.KubeletVersion, node.Status.NodeInfo.KernelVersion)
+		}
+	}
+	if unmet == "" && !NodeMatchesConditions(node, lc.l.Spec.ConditionSelector) {
+		unmet = "the conditionSelector is not met"
+	}
+	if unmet == "" && !NodeMatchesNodeGroups(node, lc.l.Spec.NodeGroupSelector) {
+		group, _ := NodeGroup(node)
+		unmet = fmt.Sprintf("the nodeGroupSelector is not met (node group %q)", group)
+	}
+	if unmet == "" {
+		unmet = lc.clusterSizeUnmet()
+	}
+	if unmet == "" {
+		unmet, _ = lc.effectiveUnmet(time.Now())
+	}
+	if unmet != "" {
+		switch {
+		case lc.l.Spec.Retain:
+			unmet += ", the applied attributes are retained"
+		case lc.withdrawn(node, lc.logger) != nil:
+			unmet += ", the applied attributes are removed"
+		}
+		return ExplainRequirementsNotMet, unmet
+	}
+
+	if ok, wait := lc.inRollout(node); !ok {
+		if wait > 0 {
+			return ExplainNotInRollout, fmt.Sprintf("the rollout waits %s for the canary nodes to soak", wait)
+		}
+		return ExplainNotInRollout, "the node is not selected by the rollout"
+	}
+	if lc.isCanary(node) {
+		return ExplainInSync, "the node is a canary of the labeler"
+	}
+	return ExplainInSync, "the node is selected"
+}
+
+// conflicts returns the labels and annotations of the labeler that the planned node
+// keeps with another value.
+func (lc *LabelController) conflicts(planned *corev1.Node, setBy map[string]string) []Conflict {
+	var conflicts []Conflict
+	check := func(prefix string, wanted, kept map[string]string) {
+		keys := make([]string, 0, len(wanted))
+		for k := range wanted {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if v, ok := kept[k]; ok && v != wanted[k] {
+				conflicts = append(conflicts, Conflict{Key: prefix + k, Labeler: lc.l.Name, Wanted: wanted[k], Kept: v, KeptBy: setBy[prefix+k]})
+			}
+		}
+	}
+	check(labelsPrefix, lc.l.Spec.Merge.Labels, planned.Labels)
+	check(annotationsPrefix, lc.l.Spec.Merge.Annotations, planned.Annotations)
+	return conflicts
+}
@@ -0,0 +1,171 @@
+package labeler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// fieldRoots are the node object fields a field path can start with.
+var fieldRoots = []string{"metadata", "spec", "status"}
+
+// fieldStep is a step of a field path: a map key or a list index.
+type fieldStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+func (s fieldStep) String() string {
+	if s.isIndex {
+		return fmt.Sprintf("[%d]", s.index)
+	}
+	return s.key
+}
+
+// parseFieldPath parses JSONPath-like field paths of the node object, like
+// "spec.podCIDR", "status.addresses[0].address" or "metadata.labels[example.com/team]"
+// (keys with dots need brackets). The JSONPath "{.spec.podCIDR}" form is also accepted.
+func parseFieldPath(path string) ([]fieldStep, error) {
+	p := strings.TrimSpace(path)
+	if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+		p = p[1 : len(p)-1]
+	}
+	p = strings.TrimPrefix(p, ".")
+
+	var steps []fieldStep
+	for p != "" {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			if p == "" || p[0] == '.' || p[0] == '[' {
+				return nil, fmt.Errorf("invalid field path %q: empty field", path)
+			}
+		case '[':
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid field path %q: unclosed bracket", path)
+			}
+			inner := p[1:end]
+			if inner == "" {
+				return nil, fmt.Errorf("invalid field path %q: empty brackets", path)
+			}
+			if i, err := strconv.Atoi(inner); err == nil {
+				if i < 0 {
+					return nil, fmt.Errorf("invalid field path %q: negative index", path)
+				}
+				steps = append(steps, fieldStep{index: i, isIndex: true})
+			} else {
+				steps = append(steps, fieldStep{key: inner})
+			}
+			p = p[end+1:]
+			if p != "" && p[0] != '.' && p[0] != '[' {
+				return nil, fmt.Errorf("invalid field path %q: unexpected %q after brackets", path, p[0])
+			}
+		default:
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			steps = append(steps, fieldStep{key: p[:end]})
+			p = p[end:]
+		}
+	}
+
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("invalid field path %q: empty path", path)
+	}
+	if steps[0].isIndex || !contains(fieldRoots, steps[0].key) {
+		return nil, fmt.Errorf("invalid field path %q: it must start with %s", path, strings.Join(fieldRoots, ", "))
+	}
+	return steps, nil
+}
+
+// lookupField returns the scalar value of the field path on the object, false if a
+// field is missing, null or empty. Lists and objects are not values.
+func lookupField(obj map[string]interface{}, steps []fieldStep) (string, bool, error) {
+	var cur interface{} = obj
+	for i, s := range steps {
+		switch v := cur.(type) {
+		case map[string]interface{}:
+			if s.isIndex {
+				return "", false, fmt.Errorf("%s is an object, not a list", fieldPathString(steps[:i]))
+			}
+			var ok bool
+			if cur, ok = v[s.key]; !ok {
+				return "", false, nil
+			}
+		case []interface{}:
+			if !s.isIndex {
+				return "", false, fmt.Errorf("%s is a list, not an object", fieldPathString(steps[:i]))
+			}
+			if s.index >= len(v) {
+				return "", false, nil
+			}
+			cur = v[s.index]
+		default:
+			return "", false, fmt.Errorf("%s is a value, it has no fields", fieldPathString(steps[:i]))
+		}
+	}
+
+	switch v := cur.(type) {
+	case nil:
+		return "", false, nil
+	case string:
+		return v, v != "", nil
+	case bool:
+		return strconv.FormatBool(v), true, nil
+	case int64:
+		return strconv.FormatInt(v, 10), true, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true, nil
+	}
+	return "", false, fmt.Errorf("%s is not a value (a list or an object)", fieldPathString(steps))
+}
+
+func fieldPathString(steps []fieldStep) string {
+	s := ""
+	for i, step := range steps {
+		if i > 0 && !step.isIndex {
+			s += "."
+		}
+		s += step.String()
+	}
+	return s
+}
+
+// newFieldSource resolves the value of the "path" field of the node object, sanitized
+// as a label value if "sanitize" is "true". Missing, null and empty fields are not
+// resolved, like false booleans omitted by the API (e.g. spec.unschedulable).
+func newFieldSource(params map[string]string) (ValueSource, error) {
+	path, err := requiredParam(params, "path")
+	if err != nil {
+		return nil, err
+	}
+	steps, err := parseFieldPath(path)
+	if err != nil {
+		return nil, err
+	}
+	sanitize, err := boolParam(params, "sanitize")
+	if err != nil {
+		return nil, err
+	}
+
+	return ValueSourceFunc(func(node *corev1.Node) (string, bool, error) {
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(node)
+		if err != nil {
+			return "", false, err
+		}
+		v, ok, err := lookupField(obj, steps)
+		if err != nil || !ok {
+			return "", false, err
+		}
+		if sanitize {
+			v = sanitizeLabelValue(v)
+		}
+		return v, true, nil
+	}), nil
+}
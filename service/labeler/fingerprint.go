@@ -0,0 +1,58 @@
+package labeler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// fingerprint returns the fingerprint of the managed keys of the node: the first 16 hex
+// characters of the SHA-256 of a "key=value\n" line for every key owned by any labeler,
+// sorted, with the owned key format (labels/, annotations/ and taints/key:effect) and
+// the value on the node. The fingerprint annotation itself is not part of it. It's
+// empty without managed keys.
+func fingerprint(node *corev1.Node, ownerAnnotation, annotation string) string {
+	set := map[string]bool{}
+	for _, keys := range ownedKeys(node, ownerAnnotation) {
+		for _, k := range keys {
+			set[k] = true
+		}
+	}
+	delete(set, annotationsPrefix+annotation)
+
+	taints := map[string]string{}
+	for _, t := range node.Spec.Taints {
+		taints[taintKey(t)] = t.Value
+	}
+	var lines []string
+	for k := range set {
+		var v string
+		var ok bool
+		switch {
+		case strings.HasPrefix(k, labelsPrefix):
+			v, ok = node.Labels[strings.TrimPrefix(k, labelsPrefix)]
+		case strings.HasPrefix(k, annotationsPrefix):
+			v, ok = node.Annotations[strings.TrimPrefix(k, annotationsPrefix)]
+		case strings.HasPrefix(k, taintsPrefix):
+			v, ok = taints[strings.TrimPrefix(k, taintsPrefix)]
+		}
+		if ok {
+			lines = append(lines, k+"="+v+"\n")
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "")))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// withFingerprint returns the node with the fingerprint annotation of its managed keys,
+// removed without managed keys. The node is copied only if it changes.
+func (c *Labeler) withFingerprint(node *corev1.Node) *corev1.Node {
+	return withContentHash(node, c.cfg.FingerprintAnnotation, fingerprint(node, c.cfg.OwnerAnnotation, c.cfg.FingerprintAnnotation))
+}
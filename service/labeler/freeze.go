@@ -0,0 +1,126 @@
+package labeler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/joshisa/resource-labeler-operator/apis/labeler"
+)
+
+const (
+	// ConditionFrozen is set while the node mutations are frozen.
+	ConditionFrozen = "Frozen"
+
+	freezeCheckInterval = 10 * time.Second
+)
+
+// freeze pauses the node mutations until a time, set on startup or at runtime by the
+// freeze annotation of the sentinel ConfigMap.
+type freeze struct {
+	mu sync.Mutex
+	// until is the static freeze, runtime the one of the sentinel ConfigMap.
+	until   time.Time
+	runtime time.Time
+	// frozen is the state of the last check, since when.
+	frozen bool
+	since  time.Time
+}
+
+// end returns the end of the freeze window, the latest of the static and runtime ones.
+func (f *freeze) end() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.runtime.After(f.until) {
+		return f.runtime
+	}
+	return f.until
+}
+
+// frozenFor returns how long the node mutations are still frozen, 0 if they aren't.
+func (c *Labeler) frozenFor() time.Duration {
+	if d := time.Until(c.freeze.end()); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// checkFreeze refreshes the runtime freeze from the sentinel ConfigMap and logs the
+// freeze transitions. Leaving it syncs all the nodes again, a shortened window
+// doesn't wait for the nodes requeued at its previous end.
+func (c *Labeler) checkFreeze() {
+	if c.cfg.FreezeConfigMapName != "" {
+		until, err := c.runtimeFreeze()
+		if err != nil {
+			c.logger.Warningf("could not check the freeze of configmap %s/%s: %s", c.cfg.FreezeConfigMapNamespace, c.cfg.FreezeConfigMapName, err)
+		} else {
+			c.freeze.mu.Lock()
+			c.freeze.runtime = until
+			c.freeze.mu.Unlock()
+		}
+	}
+
+	end := c.freeze.end()
+	frozen := time.Now().Before(end)
+	c.freeze.mu.Lock()
+	changed := frozen != c.freeze.frozen
+	c.freeze.frozen = frozen
+	if changed && frozen {
+		c.freeze.since = time.Now()
+	}
+	c.freeze.mu.Unlock()
+
+	switch {
+	case changed && frozen:
+		c.logger.Warningf("entering freeze: node mutations paused until %s", end.UTC().Format(time.RFC3339))
+	case changed:
+		c.logger.Infof("leaving freeze: resuming node mutations")
+		c.enqueueAll()
+	}
+}
+
+// runtimeFreeze returns the end of the freeze of the sentinel ConfigMap annotation,
+// zero without ConfigMap or annotation.
+func (c *Labeler) runtimeFreeze() (time.Time, error) {
+	cm, err := c.k8sCli.CoreV1().ConfigMaps(c.cfg.FreezeConfigMapNamespace).Get(c.cfg.FreezeConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	annotation := labeler.Annotation(c.cfg.ManagedPrefix, labeler.FreezeUntilAnnotationName)
+	v, ok := cm.Annotations[annotation]
+	if !ok || v == "" {
+		return time.Time{}, nil
+	}
+	until, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s annotation %q, must be a RFC3339 time", annotation, v)
+	}
+	return until, nil
+}
+
+// frozenCondition returns the Frozen condition, nil if the mutations are not frozen.
+func (c *Labeler) frozenCondition() *Condition {
+	end := c.freeze.end()
+	if !time.Now().Before(end) {
+		return nil
+	}
+	c.freeze.mu.Lock()
+	since := c.freeze.since
+	c.freeze.mu.Unlock()
+	if since.IsZero() {
+		since = time.Now()
+	}
+	return &Condition{
+		Type:     ConditionFrozen,
+		Severity: ConditionSeverityWarning,
+		Since:    since.UTC(),
+		Message:  "the node mutations are frozen until " + end.UTC().Format(time.RFC3339),
+	}
+}
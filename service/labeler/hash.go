@@ -0,0 +1,133 @@
+package labeler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// hashedLabeler is the part of a labeler the content hash depends on.
+type hashedLabeler struct {
+	Name       string                      `json:"name"`
+	Generation int64                       `json:"generation"`
+	Spec       labelerv1alpha1.LabelerSpec `json:"spec"`
+	// Staged labelers are planned like a dry run until their apply trigger.
+	Staged bool `json:"staged,omitempty"`
+	// Gated labelers are planned like a dry run until their blast radius is allowed.
+	Gated bool `json:"gated,omitempty"`
+}
+
+// hashedNode is the part of a node the plan of the labelers depends on.
+type hashedNode struct {
+	Labels      map[string]string     `json:"labels"`
+	Annotations map[string]string     `json:"annotations"`
+	Taints      []corev1.Taint        `json:"taints"`
+	Capacity    corev1.ResourceList   `json:"capacity"`
+	Allocatable corev1.ResourceList   `json:"allocatable"`
+	NodeInfo    corev1.NodeSystemInfo `json:"nodeInfo"`
+	// Conditions are the status of every condition type, the heartbeats are not
+	// part of the content.
+	Conditions map[corev1.NodeConditionType]corev1.ConditionStatus `json:"conditions"`
+}
+
+// hashable returns true if the plan of the label controllers only depends on the node
+// content, a node with the same content hash would be planned the same. Rollouts
+// depend on the rest of the nodes, requeues and timed value sources on time and the pod
+// value sources on the pods of the node, the blocked NoExecute taints on the DaemonSet,
+// the cluster size conditions on the number of nodes, the effective windows and the
+// taint escalations on time.
+func hashable(lcs []*LabelController) bool {
+	for _, lc := range lcs {
+		spec := lc.l.Spec
+		if spec.RolloutPercentage != nil || spec.CanarySoak != nil || spec.RequeueAfter != nil || lc.needsPods() || lc.timed() || spec.RequireToleratingDaemonSet != nil ||
+			spec.ClusterSizeCondition != nil || spec.EffectiveFrom != nil || spec.EffectiveUntil != nil ||
+			spec.TaintEscalation != nil || lc.cfg.MaxChangesPerPass > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// contentHash returns the hash of the node content planned by the label controllers,
+// the hash and the bookkeeping annotations are not part of it.
+func contentHash(node *corev1.Node, lcs []*LabelController, annotations ...string) string {
+	content := struct {
+		Labelers []hashedLabeler `json:"labelers"`
+		Node     hashedNode      `json:"node"`
+	}{
+		Node: hashedNode{
+			Labels:      node.Labels,
+			Annotations: without(node.Annotations, annotations...),
+			Taints:      node.Spec.Taints,
+			Capacity:    node.Status.Capacity,
+			Allocatable: node.Status.Allocatable,
+			NodeInfo:    node.Status.NodeInfo,
+			Conditions:  map[corev1.NodeConditionType]corev1.ConditionStatus{},
+		},
+	}
+	for _, c := range node.Status.Conditions {
+		content.Node.Conditions[c.Type] = c.Status
+	}
+	for _, lc := range lcs {
+		content.Labelers = append(content.Labelers, hashedLabeler{Name: lc.l.Name, Generation: lc.ObservedGeneration(), Spec: lc.l.Spec, Staged: lc.isStaged(), Gated: lc.blastGated()})
+	}
+
+	// Maps are marshaled with sorted keys, the hash is stable.
+	b, _ := json.Marshal(content)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:16])
+}
+
+// cachedHash is the content hash of a node version with a set of label controllers.
+type cachedHash struct {
+	resourceVersion string
+	controllers     string
+	hash            string
+}
+
+// nodeContentHash returns the content hash of the node, it's only computed once for
+// every node version and set of label controllers.
+func (c *Labeler) nodeContentHash(key string, node *corev1.Node, lcs []*LabelController) string {
+	// Label controllers are recreated when their spec changes.
+	ids := make([]string, 0, len(lcs))
+	for _, lc := range lcs {
+		ids = append(ids, fmt.Sprintf("%p/%d/%t/%t", lc, lc.ObservedGeneration(), lc.isStaged(), lc.blastGated()))
+	}
+	controllers := strings.Join(ids, ",")
+
+	if v, ok := c.hashes.get(key); ok {
+		ch := v.(cachedHash)
+		if ch.resourceVersion == node.ResourceVersion && ch.controllers == controllers {
+			return ch.hash
+		}
+	}
+	hash := contentHash(node, lcs, c.hashIgnored()...)
+	c.hashes.add(key, cachedHash{resourceVersion: node.ResourceVersion, controllers: controllers, hash: hash})
+	return hash
+}
+
+// withContentHash returns the node with the content hash annotation set to the
+// hash, or removed if the hash is empty. The node is copied only if it changes.
+func withContentHash(node *corev1.Node, annotation, hash string) *corev1.Node {
+	current, ok := node.Annotations[annotation]
+	if (hash == "" && !ok) || (hash != "" && current == hash) {
+		return node
+	}
+
+	node = node.DeepCopy()
+	if hash == "" {
+		delete(node.Annotations, annotation)
+		return node
+	}
+	if node.Annotations == nil {
+		node.Annotations = map[string]string{}
+	}
+	node.Annotations[annotation] = hash
+	return node
+}
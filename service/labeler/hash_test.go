@@ -0,0 +1,101 @@
+package labeler
+
+import (
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// syncPatched syncs the node and updates the node cache with the patched node, like
+// its watch event would.
+func syncPatched(t testing.TB, c *Labeler, key string) ReconcileResult {
+	res, err := c.syncNode(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Patched != nil {
+		c.informer().GetStore().Update(res.Patched)
+	}
+	return res
+}
+
+func TestContentHashSkipsUnchangedNodes(t *testing.T) {
+	s := newNodeServer(testNode("n1", map[string]string{"pool": "a"}))
+	l := poolLabeler("checked", "a", labelerv1alpha1.LabelerSpec{Merge: mergeSpec(map[string]string{"checked": "true"})})
+	c, stop := newSyncedLabeler(t, s, Config{ContentHash: true}, l)
+	defer stop()
+
+	if res := syncPatched(t, c, "n1"); res.Outcome != ReconcilePatched {
+		t.Fatalf("expected the node patched, got %s", res.Outcome)
+	}
+	if res := syncPatched(t, c, "n1"); res.Outcome != ReconcileSkipped {
+		t.Errorf("expected the node with the same content skipped, got %s", res.Outcome)
+	}
+
+	// A node change is planned again.
+	changed := cachedNode(c.informer().GetStore(), "n1").DeepCopy()
+	changed.Labels["team"] = "ops"
+	changed.ResourceVersion = "100"
+	c.informer().GetStore().Update(changed)
+	if res := syncPatched(t, c, "n1"); res.Outcome == ReconcileSkipped {
+		t.Errorf("expected the changed node planned again")
+	}
+
+	// A new generation of the labeler invalidates the hash.
+	l = l.DeepCopy()
+	l.Generation = 2
+	l.Spec.Merge = mergeSpec(map[string]string{"checked": "true", "audited": "true"})
+	if err := c.EnsureLabeler(l); err != nil {
+		t.Fatal(err)
+	}
+	if res := syncPatched(t, c, "n1"); res.Outcome != ReconcilePatched {
+		t.Errorf("expected the node patched by the new generation, got %s", res.Outcome)
+	}
+	if v := s.node("n1").Labels["audited"]; v != "true" {
+		t.Errorf("expected the new generation applied, got labels %v", s.node("n1").Labels)
+	}
+}
+
+// BenchmarkSteadyStateSync measures the syncs of a cluster whose nodes are all in the
+// desired state, with and without the content hash: the plans computed and the patch
+// attempts of every round of syncs.
+func BenchmarkSteadyStateSync(b *testing.B) {
+	const nodes = 100
+	for _, contentHash := range []bool{false, true} {
+		b.Run(fmt.Sprintf("content hash %t", contentHash), func(b *testing.B) {
+			var fixtures []*corev1.Node
+			for i := 0; i < nodes; i++ {
+				fixtures = append(fixtures, testNode(fmt.Sprintf("n%d", i), map[string]string{"pool": "a"}))
+			}
+			s := newNodeServer(fixtures...)
+			var ls []*labelerv1alpha1.Labeler
+			for i := 0; i < 10; i++ {
+				ls = append(ls, poolLabeler(fmt.Sprintf("l%d", i), "a", labelerv1alpha1.LabelerSpec{
+					Merge: mergeSpec(map[string]string{fmt.Sprintf("l%d", i): "true"}),
+				}))
+			}
+			c, stop := newSyncedLabeler(b, s, Config{ContentHash: contentHash}, ls...)
+			defer stop()
+			// The first round brings the nodes to the desired state.
+			for _, n := range fixtures {
+				syncPatched(b, c, n.Name)
+			}
+			patches := s.patchCount()
+
+			b.ResetTimer()
+			planned := 0
+			for i := 0; i < b.N; i++ {
+				for _, n := range fixtures {
+					if res := syncPatched(b, c, n.Name); res.Outcome != ReconcileSkipped {
+						planned++
+					}
+				}
+			}
+			b.ReportMetric(float64(planned)/float64(b.N), "plans/round")
+			b.ReportMetric(float64(s.patchCount()-patches)/float64(b.N), "patches/round")
+		})
+	}
+}
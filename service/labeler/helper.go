@@ -6,6 +6,8 @@ import (
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
 )
 
 func NodeMatchesNodeSelectorTerms(node *v1.Node, nodeSelectorTerms []v1.NodeSelectorTerm) bool {
@@ -22,6 +24,75 @@ func NodeMatchesNodeSelectorTerms(node *v1.Node, nodeSelectorTerms []v1.NodeSele
 	return false
 }
 
+// NearMatch is a node selector term a node matches except for one clause.
+type NearMatch struct {
+	// Term is the index of the node selector term.
+	Term int
+	// Clause is the requirement the node doesn't meet.
+	Clause v1.NodeSelectorRequirement
+}
+
+// NodeNearMatches returns the node selector terms of at least two clauses the node
+// matches except for one of them.
+func NodeNearMatches(node *v1.Node, nodeSelectorTerms []v1.NodeSelectorTerm) []NearMatch {
+	var nms []NearMatch
+	for i, term := range nodeSelectorTerms {
+		if len(term.MatchExpressions) < 2 {
+			continue
+		}
+		var failing []v1.NodeSelectorRequirement
+		for _, expr := range term.MatchExpressions {
+			met, err := NodeMatchesRequirements(node, []v1.NodeSelectorRequirement{expr})
+			if err != nil || !met {
+				failing = append(failing, expr)
+			}
+		}
+		if len(failing) == 1 {
+			nms = append(nms, NearMatch{Term: i, Clause: failing[0]})
+		}
+	}
+	return nms
+}
+
+// FormatRequirement formats a node selector requirement like "zone In [a b]".
+func FormatRequirement(req v1.NodeSelectorRequirement) string {
+	if len(req.Values) == 0 {
+		return fmt.Sprintf("%s %s", req.Key, req.Operator)
+	}
+	return fmt.Sprintf("%s %s %v", req.Key, req.Operator, req.Values)
+}
+
+// NodeMatchesRequirements returns true if the node labels meet all the requirements,
+// no requirements are always met.
+func NodeMatchesRequirements(node *v1.Node, reqs []v1.NodeSelectorRequirement) (bool, error) {
+	if len(reqs) == 0 {
+		return true, nil
+	}
+	selector, err := NodeSelectorRequirementsAsSelector(reqs)
+	if err != nil {
+		return false, err
+	}
+	return selector.Matches(labels.Set(node.Labels)), nil
+}
+
+// NodeMatchesConditions returns true if the node has all the conditions with their
+// status, no requirements are always met.
+func NodeMatchesConditions(node *v1.Node, reqs []labelerv1alpha1.ConditionRequirement) bool {
+	for _, req := range reqs {
+		met := false
+		for _, c := range node.Status.Conditions {
+			if c.Type == req.Type && c.Status == req.Status {
+				met = true
+				break
+			}
+		}
+		if !met {
+			return false
+		}
+	}
+	return true
+}
+
 // NodeSelectorRequirementsAsSelector converts the []NodeSelectorRequirement api type into a struct that implements
 // labels.Selector.
 func NodeSelectorRequirementsAsSelector(nsm []v1.NodeSelectorRequirement) (labels.Selector, error) {
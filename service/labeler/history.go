@@ -0,0 +1,107 @@
+package labeler
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// SpecEdit is a generation of a labeler observed by the operator.
+type SpecEdit struct {
+	Generation int64     `json:"generation"`
+	Time       time.Time `json:"time"`
+	// Changed are the spec fields changed from the previous generation (e.g.
+	// merge.labels), none on the first generation observed.
+	Changed []string `json:"changed,omitempty"`
+}
+
+// specHistory are the last spec edits of every labeler, the oldest first.
+type specHistory struct {
+	mu       sync.Mutex
+	labelers map[string][]SpecEdit
+}
+
+// record appends the edit to the labeler history keeping the last size edits, a first
+// observation (without previous spec) starts a new history.
+func (h *specHistory) record(name string, edit SpecEdit, first bool, size int) {
+	if size <= 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.labelers == nil {
+		h.labelers = map[string][]SpecEdit{}
+	}
+	edits := h.labelers[name]
+	if first {
+		edits = nil
+	}
+	edits = append(edits, edit)
+	if len(edits) > size {
+		edits = append([]SpecEdit(nil), edits[len(edits)-size:]...)
+	}
+	h.labelers[name] = edits
+}
+
+func (h *specHistory) get(name string) []SpecEdit {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]SpecEdit(nil), h.labelers[name]...)
+}
+
+// recordSpecEdit records the new generation of the labeler with the fields changed
+// from the previous spec, nil on the first observation.
+func (c *Labeler) recordSpecEdit(prev, l *labelerv1alpha1.Labeler) {
+	edit := SpecEdit{Generation: l.Generation, Time: time.Now().UTC()}
+	if prev != nil {
+		edit.Changed = specChanges(prev.Spec, l.Spec)
+	}
+	c.history.record(l.Name, edit, prev == nil, c.cfg.SpecHistorySize)
+}
+
+// specChanges returns the changed spec fields, by their JSON path up to the second
+// level (e.g. merge.labels), sorted.
+func specChanges(old, new labelerv1alpha1.LabelerSpec) []string {
+	var o, n map[string]interface{}
+	ob, _ := json.Marshal(old)
+	nb, _ := json.Marshal(new)
+	json.Unmarshal(ob, &o)
+	json.Unmarshal(nb, &n)
+
+	var changed []string
+	for _, k := range unionKeys(o, n) {
+		if reflect.DeepEqual(o[k], n[k]) {
+			continue
+		}
+		om, ok1 := o[k].(map[string]interface{})
+		nm, ok2 := n[k].(map[string]interface{})
+		if !ok1 || !ok2 {
+			changed = append(changed, k)
+			continue
+		}
+		for _, sk := range unionKeys(om, nm) {
+			if !reflect.DeepEqual(om[sk], nm[sk]) {
+				changed = append(changed, k+"."+sk)
+			}
+		}
+	}
+	return changed
+}
+
+func unionKeys(a, b map[string]interface{}) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
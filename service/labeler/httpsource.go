@@ -0,0 +1,355 @@
+package labeler
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+const (
+	// HTTPType is the value source type of the external HTTP endpoints.
+	HTTPType = "http"
+
+	// httpNodePlaceholder is replaced by the node name on the URL.
+	httpNodePlaceholder = "{node}"
+	// httpFailureTTL is how long a failed fetch is reused, shorter than the TTL of the
+	// values so the endpoint recovers soon but is not hammered.
+	httpFailureTTL = 30 * time.Second
+	// httpMaxBody is the maximum body read, the values are label values.
+	httpMaxBody        = 1024
+	defaultHTTPTTL     = 5 * time.Minute
+	defaultHTTPTimeout = 5 * time.Second
+	// httpPendingRequeue is how soon a node is synced again while its value is
+	// fetched.
+	httpPendingRequeue = time.Second
+	// secretCacheTTL is how long a fetched Secret is reused, a Secret referenced by
+	// the value sources of many nodes is got once.
+	secretCacheTTL = 30 * time.Second
+)
+
+// valueUnavailable is the error of a value not known yet, the label is left untouched
+// without a warning.
+type valueUnavailable string
+
+func (e valueUnavailable) Error() string {
+	return string(e)
+}
+
+const (
+	errHTTPPending valueUnavailable = "the value is being fetched"
+	errHTTPOffline valueUnavailable = "the http values are only fetched by the operator"
+)
+
+// SecretGetter is where the value sources get the Secrets with their credentials from.
+type SecretGetter interface {
+	Secret(namespace, name string) (*corev1.Secret, error)
+}
+
+// cachedSecret is a fetched Secret, or the error getting it.
+type cachedSecret struct {
+	secret  *corev1.Secret
+	err     error
+	fetched time.Time
+}
+
+// secretCache gets the Secrets from the API, reusing them for secretCacheTTL.
+type secretCache struct {
+	c       *Labeler
+	mu      sync.Mutex
+	secrets map[string]cachedSecret
+}
+
+// Secret satisfies SecretGetter interface.
+func (s *secretCache) Secret(namespace, name string) (*corev1.Secret, error) {
+	key := namespace + "/" + name
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cs, ok := s.secrets[key]; ok && time.Since(cs.fetched) < secretCacheTTL {
+		return cs.secret, cs.err
+	}
+	secret, err := s.c.k8sCli.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if s.secrets == nil {
+		s.secrets = map[string]cachedSecret{}
+	}
+	s.secrets[key] = cachedSecret{secret: secret, err: err, fetched: time.Now()}
+	return secret, err
+}
+
+// forget drops the cached Secret, it's got again on next use.
+func (s *secretCache) forget(namespace, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.secrets, namespace+"/"+name)
+}
+
+// SecretsValueSource is a value source that needs Secrets to resolve the value. Its
+// Resolve is used when the Secrets are not available (e.g. offline diffs).
+type SecretsValueSource interface {
+	ValueSource
+	ResolveSecrets(node *corev1.Node, secrets SecretGetter) (string, bool, error)
+}
+
+// httpResult is a fetched value of a node, or the error fetching it.
+type httpResult struct {
+	value   string
+	ok      bool
+	err     error
+	expires time.Time
+}
+
+// NodeCachingValueSource is a value source caching what it resolved by node, the
+// deleted nodes are forgotten.
+type NodeCachingValueSource interface {
+	ValueSource
+	ForgetNode(name string)
+}
+
+// httpSource resolves the value from the body of an HTTP GET of the URL with the node
+// name, the results are cached by node. The GETs are sent in the background, never
+// by the syncs.
+type httpSource struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+	// secret is the auth header value key of the namespace/name Secret (optional).
+	secretNamespace, secretName, secretKey string
+	header                                 string
+
+	mu      sync.Mutex
+	results map[string]httpResult
+	// fetching are the nodes whose value is being fetched.
+	fetching map[string]bool
+}
+
+// newHTTPSource resolves the value from an HTTP GET of the "url" template, "{node}" is
+// replaced by the node name. The results are cached for "ttl" (5m), the requests time
+// out after "timeout" (5s). With "secret" namespace/name and "secretKey" the value of the
+// key is sent on the "header" request header (Authorization).
+func newHTTPSource(params map[string]string) (ValueSource, error) {
+	rawURL, err := requiredParam(params, "url")
+	if err != nil {
+		return nil, err
+	}
+	if u, err := url.Parse(strings.Replace(rawURL, httpNodePlaceholder, "node", -1)); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("url param must be an http(s) URL, got %q", rawURL)
+	}
+	s := &httpSource{url: rawURL, ttl: defaultHTTPTTL, header: "Authorization", results: map[string]httpResult{}, fetching: map[string]bool{}}
+	timeout := defaultHTTPTimeout
+	for name, d := range map[string]*time.Duration{"ttl": &s.ttl, "timeout": &timeout} {
+		if v := params[name]; v != "" {
+			if *d, err = time.ParseDuration(v); err != nil || *d <= 0 {
+				return nil, fmt.Errorf("%s param must be a positive duration, got %q", name, v)
+			}
+		}
+	}
+	// The redirects are not followed, they could lead out of the allowed hosts.
+	s.client = &http.Client{
+		Timeout:       timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	if secret := params["secret"]; secret != "" {
+		parts := strings.SplitN(secret, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("secret param must be namespace/name, got %q", secret)
+		}
+		s.secretNamespace, s.secretName = parts[0], parts[1]
+		if s.secretKey, err = requiredParam(params, "secretKey"); err != nil {
+			return nil, err
+		}
+		if h := params["header"]; h != "" {
+			s.header = h
+		}
+	}
+	return s, nil
+}
+
+// References satisfies ReferencingValueSource interface, the Secret if any.
+func (s *httpSource) References() []ObjectReference {
+	if s.secretName == "" {
+		return nil
+	}
+	return []ObjectReference{{Kind: ReferenceSecret, Namespace: s.secretNamespace, Name: s.secretName}}
+}
+
+// ReferenceChanged satisfies ReferencingValueSource interface, the values fetched with
+// the old credentials are fetched again.
+func (s *httpSource) ReferenceChanged(ObjectReference) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = map[string]httpResult{}
+}
+
+// host returns the host of the URL, "{node}" is replaced by "node".
+func (s *httpSource) host() string {
+	u, err := url.Parse(strings.Replace(s.url, httpNodePlaceholder, "node", -1))
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// Resolve satisfies ValueSource interface. Without the Secrets it's used offline, the
+// values are not fetched.
+func (s *httpSource) Resolve(node *corev1.Node) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.results[node.Name]; ok {
+		return r.value, r.ok, r.err
+	}
+	return "", false, errHTTPOffline
+}
+
+// ResolveSecrets satisfies SecretsValueSource interface. The not found responses are
+// not resolved, the rest of the failures are errors and the label is left untouched.
+// A value not fetched yet is fetched in the background and the label is left
+// untouched, an expired one is used until fetched again.
+func (s *httpSource) ResolveSecrets(node *corev1.Node, secrets SecretGetter) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, cached := s.results[node.Name]
+	if !cached || !time.Now().Before(r.expires) {
+		s.startFetch(node.Name, secrets)
+	}
+	if !cached {
+		return "", false, errHTTPPending
+	}
+	return r.value, r.ok, r.err
+}
+
+// startFetch fetches the value of the node in the background if it's not being
+// fetched. s.mu must be held.
+func (s *httpSource) startFetch(name string, secrets SecretGetter) {
+	if s.fetching[name] {
+		return
+	}
+	s.fetching[name] = true
+	go func() {
+		now := time.Now()
+		r := s.fetch(name, secrets)
+		r.expires = now.Add(s.ttl)
+		if r.err != nil {
+			r.expires = now.Add(httpFailureTTL)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// A node forgotten meanwhile is not cached again.
+		if s.fetching[name] {
+			s.results[name] = r
+			delete(s.fetching, name)
+		}
+	}()
+}
+
+// ForgetNode satisfies NodeCachingValueSource interface.
+func (s *httpSource) ForgetNode(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.results, name)
+	delete(s.fetching, name)
+}
+
+func (s *httpSource) fetch(name string, secrets SecretGetter) httpResult {
+	u := strings.Replace(s.url, httpNodePlaceholder, url.PathEscape(name), -1)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return httpResult{err: err}
+	}
+	if s.secretName != "" {
+		if secrets == nil {
+			return httpResult{err: fmt.Errorf("the secret %s/%s is not available", s.secretNamespace, s.secretName)}
+		}
+		secret, err := secrets.Secret(s.secretNamespace, s.secretName)
+		if err != nil {
+			return httpResult{err: fmt.Errorf("could not get the secret %s/%s: %s", s.secretNamespace, s.secretName, err)}
+		}
+		v, ok := secret.Data[s.secretKey]
+		if !ok {
+			return httpResult{err: fmt.Errorf("the secret %s/%s has no %s key", s.secretNamespace, s.secretName, s.secretKey)}
+		}
+		req.Header.Set(s.header, strings.TrimSpace(string(v)))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return httpResult{err: err}
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return httpResult{}
+	case resp.StatusCode != http.StatusOK:
+		return httpResult{err: fmt.Errorf("GET %s responded %s", u, resp.Status)}
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, httpMaxBody))
+	if err != nil {
+		return httpResult{err: err}
+	}
+	v := strings.TrimSpace(string(b))
+	return httpResult{value: v, ok: v != ""}
+}
+
+// NextChange satisfies TimedValueSource interface, the value is fetched again when the
+// cached result expires, and the node synced again soon while it's fetched.
+func (s *httpSource) NextChange(node *corev1.Node, now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fetching[node.Name] {
+		return httpPendingRequeue
+	}
+	if r, ok := s.results[node.Name]; ok && r.expires.After(now) {
+		return r.expires.Sub(now)
+	}
+	return s.ttl
+}
+
+// hostAllowed returns true if the host is in the allowed ones, "*.domain" entries allow
+// its subdomains.
+func hostAllowed(host string, allowed []string) bool {
+	for _, a := range allowed {
+		if a == host || strings.HasPrefix(a, "*.") && strings.HasSuffix(host, a[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateHTTPSources returns an error if the http value sources of the labeler get
+// URLs out of the allowed hosts, or send Secrets out of the allowed ones: the requests
+// are sent by the operator, with the Secrets it can read. No allowed hosts reject every
+// http source.
+func ValidateHTTPSources(l *labelerv1alpha1.Labeler, hosts, secrets []string) error {
+	for _, vf := range l.Spec.ValueFrom {
+		src, err := NewValueSource(vf)
+		if err != nil {
+			// Validate reports it.
+			continue
+		}
+		for _, leaf := range leafSources(src) {
+			hs, ok := leaf.(*httpSource)
+			if !ok {
+				continue
+			}
+			if h := hs.host(); !hostAllowed(h, hosts) {
+				if len(hosts) == 0 {
+					return fmt.Errorf("%s: valueFrom %s gets %s, no http source hosts are allowed", l.Name, vf.Label, h)
+				}
+				return fmt.Errorf("%s: valueFrom %s gets %s, not an allowed http source host (allowed: %s)", l.Name, vf.Label, h, strings.Join(hosts, ", "))
+			}
+			if secret := hs.secretNamespace + "/" + hs.secretName; hs.secretName != "" && !contains(secrets, secret) {
+				return fmt.Errorf("%s: valueFrom %s sends the secret %s, not an allowed http source secret", l.Name, vf.Label, secret)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package labeler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+func TestValidateHTTPSources(t *testing.T) {
+	httpSpec := func(params map[string]string) labelerv1alpha1.ValueFromSpec {
+		return labelerv1alpha1.ValueFromSpec{Label: "example.com/rack", Type: HTTPType, Params: params}
+	}
+	tests := []struct {
+		name    string
+		vf      labelerv1alpha1.ValueFromSpec
+		hosts   []string
+		secrets []string
+		expErr  bool
+	}{
+		{
+			name:  "An allowed host is accepted.",
+			vf:    httpSpec(map[string]string{"url": "https://inventory.example.com:8443/nodes/{node}"}),
+			hosts: []string{"inventory.example.com"},
+		},
+		{
+			name:  "A subdomain of a wildcard host is accepted, with the node in the host.",
+			vf:    httpSpec(map[string]string{"url": "http://{node}.metadata.example.com/rack"}),
+			hosts: []string{"*.example.com"},
+		},
+		{
+			name:   "A host out of the allowed ones is rejected.",
+			vf:     httpSpec(map[string]string{"url": "http://169.254.169.254/latest/meta-data"}),
+			hosts:  []string{"*.example.com"},
+			expErr: true,
+		},
+		{
+			name:   "Without allowed hosts the http sources are rejected.",
+			vf:     httpSpec(map[string]string{"url": "https://inventory.example.com/{node}"}),
+			expErr: true,
+		},
+		{
+			name:    "An allowed Secret is accepted.",
+			vf:      httpSpec(map[string]string{"url": "https://inventory.example.com/{node}", "secret": "ops/token", "secretKey": "token"}),
+			hosts:   []string{"inventory.example.com"},
+			secrets: []string{"ops/token"},
+		},
+		{
+			name:    "A Secret out of the allowed ones is rejected.",
+			vf:      httpSpec(map[string]string{"url": "https://inventory.example.com/{node}", "secret": "kube-system/admin", "secretKey": "token"}),
+			hosts:   []string{"inventory.example.com"},
+			secrets: []string{"ops/token"},
+			expErr:  true,
+		},
+		{
+			name: "The http sources of a composite source are checked.",
+			vf: labelerv1alpha1.ValueFromSpec{
+				Label:   "example.com/location",
+				Type:    CompositeType,
+				Params:  map[string]string{"template": "{{.rack}}"},
+				Sources: []labelerv1alpha1.NamedValueSource{{Name: "rack", Type: HTTPType, Params: map[string]string{"url": "http://evil.example.org/{node}"}}},
+			},
+			hosts:  []string{"*.example.com"},
+			expErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := &labelerv1alpha1.Labeler{
+				ObjectMeta: metav1.ObjectMeta{Name: "l"},
+				Spec:       labelerv1alpha1.LabelerSpec{ValueFrom: []labelerv1alpha1.ValueFromSpec{test.vf}},
+			}
+			if err := ValidateHTTPSources(l, test.hosts, test.secrets); (err != nil) != test.expErr {
+				t.Errorf("expected error %t, got %v", test.expErr, err)
+			}
+		})
+	}
+}
+
+func TestHTTPSourceFetchesInBackground(t *testing.T) {
+	var mu sync.Mutex
+	gets := 0
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		mu.Lock()
+		gets++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/n1":
+			fmt.Fprint(w, "rack-1\n")
+		case "/redirect":
+			http.Redirect(w, r, "/n1", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	src, err := newHTTPSource(map[string]string{"url": srv.URL + "/{node}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := src.(*httpSource)
+	n1 := testNode("n1", nil)
+
+	if _, _, err := s.Resolve(n1); err != errHTTPOffline {
+		t.Errorf("expected the value not fetched offline, got %v", err)
+	}
+
+	// The sync doesn't wait for the response.
+	if _, _, err := s.ResolveSecrets(n1, nil); err != errHTTPPending {
+		t.Fatalf("expected the value pending, got %v", err)
+	}
+	if d := s.NextChange(n1, time.Now()); d != httpPendingRequeue {
+		t.Errorf("expected the node synced again in %s while fetched, got %s", httpPendingRequeue, d)
+	}
+	close(release)
+	v, ok, err := waitResolved(t, s, n1)
+	if err != nil || !ok || v != "rack-1" {
+		t.Fatalf("expected rack-1, got %q %t %v", v, ok, err)
+	}
+	if v, _, _ := s.Resolve(n1); v != "rack-1" {
+		t.Errorf("expected offline resolves to use the cached value, got %q", v)
+	}
+
+	// The cached value is used, its node is forgotten once deleted.
+	s.ResolveSecrets(n1, nil)
+	mu.Lock()
+	if gets != 1 {
+		t.Errorf("expected a single GET, got %d", gets)
+	}
+	mu.Unlock()
+	s.ForgetNode(n1.Name)
+	if _, _, err := s.Resolve(n1); err != errHTTPOffline {
+		t.Errorf("expected the deleted node forgotten, got %v", err)
+	}
+
+	// The redirects are not followed.
+	redirect := testNode("redirect", nil)
+	s.ResolveSecrets(redirect, nil)
+	if _, _, err := waitResolved(t, s, redirect); err == nil {
+		t.Errorf("expected the redirect not followed")
+	}
+}
+
+// waitResolved waits until the value of the node is fetched.
+func waitResolved(t *testing.T, s *httpSource, node *corev1.Node) (string, bool, error) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		v, ok, err := s.ResolveSecrets(node, nil)
+		if err != errHTTPPending {
+			return v, ok, err
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected node %s value fetched", node.Name)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
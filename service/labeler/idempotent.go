@@ -0,0 +1,26 @@
+package labeler
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/joshisa/resource-labeler-operator/log"
+)
+
+// verifyIdempotent plans the label controllers again on the just patched node, the
+// labelers still changing it don't converge (e.g. an unstable value source) and would
+// mutate the node endlessly. They are logged and counted, the node is not patched again.
+func (c *Labeler) verifyIdempotent(lcs []*LabelController, node *corev1.Node) {
+	_, mutations, _, err := planNode(lcs, node, c.RequestID(node.Name), true)
+	if err != nil {
+		log.Debugf(c.nodeLogger(node.Name), "could not verify the idempotency on node %s: %s", node.Name, err)
+	}
+	for _, m := range mutations {
+		if m.DryRun {
+			continue
+		}
+		c.nodeLogger(node.Name).Warningf("labeler %s is not idempotent: node %s was just patched and a second plan would %s %s again", m.Rule, node.Name, m.Operation, strings.Join(m.Keys, ", "))
+		c.cfg.MetricsRecorder.IncNonIdempotentSyncs(m.Rule)
+	}
+}
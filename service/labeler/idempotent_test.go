@@ -0,0 +1,97 @@
+package labeler
+
+import (
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+	"github.com/joshisa/resource-labeler-operator/metrics"
+)
+
+// idempotencyRecorder counts the non idempotent syncs by labeler.
+type idempotencyRecorder struct {
+	metrics.Recorder
+
+	mu    sync.Mutex
+	syncs map[string]int
+}
+
+func (r *idempotencyRecorder) IncNonIdempotentSyncs(labeler string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.syncs[labeler]++
+}
+
+func TestSecondSyncIsNoop(t *testing.T) {
+	tests := []struct {
+		name string
+		spec labelerv1alpha1.LabelerSpec
+	}{
+		{
+			name: "Merged labels, annotations and taints.",
+			spec: labelerv1alpha1.LabelerSpec{Merge: labelerv1alpha1.MergeSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"team": "ops"}, Annotations: map[string]string{"owner": "ops"}},
+				NodeSpec:   corev1.NodeSpec{Taints: []corev1.Taint{{Key: "dedicated", Value: "ops", Effect: corev1.TaintEffectNoSchedule}}},
+			}},
+		},
+		{
+			name: "A renamed label.",
+			spec: labelerv1alpha1.LabelerSpec{Rename: []labelerv1alpha1.RenameSpec{{From: "zone", To: "example.com/zone"}}},
+		},
+		{
+			name: "Removed labels.",
+			spec: labelerv1alpha1.LabelerSpec{RemoveLabels: []string{"legacy", "/zo.*/"}},
+		},
+		{
+			name: "A mapped value.",
+			spec: labelerv1alpha1.LabelerSpec{ValueMap: []labelerv1alpha1.ValueMapSpec{{From: "zone", To: "example.com/region", Values: map[string]string{"eu-west-1a": "eu-west"}}}},
+		},
+		{
+			name: "A templated value.",
+			spec: labelerv1alpha1.LabelerSpec{ValueFrom: []labelerv1alpha1.ValueFromSpec{{
+				Label: "example.com/name", Type: TemplateType, Params: map[string]string{"template": "{{.Name}}-{{.Labels.pool}}"},
+			}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newNodeServer(testNode("n1", map[string]string{"pool": "a", "zone": "eu-west-1a"}))
+			c, stop := newSyncedLabeler(t, s, Config{}, poolLabeler("l", "a", test.spec))
+			defer stop()
+
+			if res := syncPatched(t, c, "n1"); res.Outcome != ReconcilePatched {
+				t.Fatalf("expected the first sync to patch the node, got %s", res.Outcome)
+			}
+			if res := syncPatched(t, c, "n1"); res.Outcome != ReconcileUnchanged || len(res.Mutations) != 0 {
+				t.Errorf("expected the second sync to be a no-op, got %s with %+v", res.Outcome, res.Mutations)
+			}
+			if n := s.patchCount(); n != 1 {
+				t.Errorf("expected a single patch, got %d", n)
+			}
+		})
+	}
+}
+
+func TestVerifyIdempotentReportsUnstableLabelers(t *testing.T) {
+	recorder := &idempotencyRecorder{Recorder: metrics.Dummy, syncs: map[string]int{}}
+	s := newNodeServer(testNode("n1", map[string]string{"pool": "a", "gen": "x"}))
+	stable := poolLabeler("stable", "a", labelerv1alpha1.LabelerSpec{Merge: mergeSpec(map[string]string{"team": "ops"})})
+	// The template reads the label it writes, every plan appends to it.
+	unstable := poolLabeler("unstable", "a", labelerv1alpha1.LabelerSpec{ValueFrom: []labelerv1alpha1.ValueFromSpec{{
+		Label: "gen", Type: TemplateType, Params: map[string]string{"template": "{{.Labels.gen}}x"},
+	}}})
+	c, stop := newSyncedLabeler(t, s, Config{VerifyIdempotent: true, MetricsRecorder: recorder}, stable, unstable)
+	defer stop()
+
+	syncPatched(t, c, "n1")
+	if n := recorder.syncs["unstable"]; n != 1 {
+		t.Errorf("expected the unstable labeler reported once, got %d", n)
+	}
+	if n := recorder.syncs["stable"]; n != 0 {
+		t.Errorf("expected the stable labeler not reported, got %d", n)
+	}
+}
@@ -0,0 +1,146 @@
+package labeler
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Node informer indexes, only with IndexNodes.
+const (
+	// nodeLabelIndex has every label of the node as key=value, and its key alone.
+	nodeLabelIndex = "labels"
+	// nodeOwnerIndex has the labelers owning attributes of the node.
+	nodeOwnerIndex = "owners"
+)
+
+// nodeIndexers returns the indexers of the node informer, none without IndexNodes.
+func (c *Labeler) nodeIndexers() cache.Indexers {
+	if !c.cfg.IndexNodes {
+		return cache.Indexers{}
+	}
+	return cache.Indexers{
+		nodeLabelIndex: func(obj interface{}) ([]string, error) {
+			node, ok := obj.(*corev1.Node)
+			if !ok {
+				return nil, nil
+			}
+			values := make([]string, 0, 2*len(node.Labels))
+			for k, v := range node.Labels {
+				values = append(values, k, k+"="+v)
+			}
+			return values, nil
+		},
+		nodeOwnerIndex: func(obj interface{}) ([]string, error) {
+			node, ok := obj.(*corev1.Node)
+			if !ok {
+				return nil, nil
+			}
+			var owners []string
+			for name := range ownedKeys(node, c.cfg.OwnerAnnotation) {
+				owners = append(owners, name)
+			}
+			return owners, nil
+		},
+	}
+}
+
+// nodeIndexer is a node store with the node informer indexes.
+type nodeIndexer interface {
+	ByIndex(indexName, indexedValue string) ([]interface{}, error)
+}
+
+// indexedValues returns the label index values of the candidate nodes of the
+// requirement, false if the requirement can't be looked up on the index (e.g. NotIn).
+func indexedValues(req corev1.NodeSelectorRequirement) ([]string, bool) {
+	switch req.Operator {
+	case corev1.NodeSelectorOpIn:
+		values := make([]string, 0, len(req.Values))
+		for _, v := range req.Values {
+			values = append(values, req.Key+"="+v)
+		}
+		return values, true
+	case corev1.NodeSelectorOpExists:
+		return []string{req.Key}, true
+	}
+	return nil, false
+}
+
+// candidateNodes returns the cached nodes that may match the labeler selector, the
+// callers still match them. With IndexNodes every term is looked up on the label index
+// by one of its In or Exists requirements, a term without them falls back to all the
+// nodes.
+func (lc *LabelController) candidateNodes() []interface{} {
+	idx, ok := lc.nodes.(nodeIndexer)
+	if !lc.cfg.IndexNodes || !ok {
+		return lc.nodes.List()
+	}
+
+	var lookups [][]string
+	for _, term := range lc.l.Spec.NodeSelectorTerms {
+		// Empty terms match no nodes.
+		if len(term.MatchExpressions) == 0 {
+			continue
+		}
+		var values []string
+		for _, req := range term.MatchExpressions {
+			if values, ok = indexedValues(req); ok {
+				break
+			}
+		}
+		if values == nil {
+			return lc.nodes.List()
+		}
+		lookups = append(lookups, values)
+	}
+
+	seen := map[string]bool{}
+	var candidates []interface{}
+	for _, values := range lookups {
+		for _, v := range values {
+			objs, err := idx.ByIndex(nodeLabelIndex, v)
+			if err != nil {
+				return lc.nodes.List()
+			}
+			for _, obj := range objs {
+				node, ok := obj.(*corev1.Node)
+				if ok && !seen[node.Name] {
+					seen[node.Name] = true
+					candidates = append(candidates, obj)
+				}
+			}
+		}
+	}
+	return candidates
+}
+
+// enqueueLabeler queues the nodes the labeler change may affect: the candidates of its
+// new and old selectors and the nodes it owns attributes of. Without IndexNodes all the
+// cached nodes are queued.
+func (c *Labeler) enqueueLabeler(lcs ...*LabelController) {
+	if !c.cfg.IndexNodes {
+		c.enqueueAll()
+		return
+	}
+
+	keys := map[string]bool{}
+	for _, lc := range lcs {
+		for _, obj := range lc.candidateNodes() {
+			if key, err := cache.MetaNamespaceKeyFunc(obj); err == nil {
+				keys[key] = true
+			}
+		}
+		owned, err := c.informer().GetIndexer().ByIndex(nodeOwnerIndex, lc.l.Name)
+		if err != nil {
+			c.enqueueAll()
+			return
+		}
+		for _, obj := range owned {
+			if key, err := cache.MetaNamespaceKeyFunc(obj); err == nil {
+				keys[key] = true
+			}
+		}
+	}
+	for key := range keys {
+		c.enqueue(key)
+	}
+}
@@ -0,0 +1,175 @@
+package labeler
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	kooperlog "github.com/spotahome/kooper/log"
+
+	"github.com/joshisa/resource-labeler-operator/apis/labeler"
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// indexedNodes returns a node cache with the node informer indexes, or without
+// indexes if not indexed.
+func indexedNodes(indexed bool, nodes ...*corev1.Node) cache.Indexer {
+	c := &Labeler{cfg: Config{IndexNodes: indexed}.withDefaults()}
+	idx := cache.NewIndexer(cache.MetaNamespaceKeyFunc, c.nodeIndexers())
+	for _, n := range nodes {
+		idx.Add(n)
+	}
+	return idx
+}
+
+func selectorLabeler(terms ...[]corev1.NodeSelectorRequirement) *labelerv1alpha1.Labeler {
+	l := &labelerv1alpha1.Labeler{ObjectMeta: metav1.ObjectMeta{Name: "l"}}
+	for _, reqs := range terms {
+		l.Spec.NodeSelectorTerms = append(l.Spec.NodeSelectorTerms, corev1.NodeSelectorTerm{MatchExpressions: reqs})
+	}
+	return l
+}
+
+func TestCandidateNodes(t *testing.T) {
+	nodes := []*corev1.Node{
+		testNode("n1", map[string]string{"pool": "a", "gpu": "true"}),
+		testNode("n2", map[string]string{"pool": "b"}),
+		testNode("n3", map[string]string{"pool": "c", "gpu": "true"}),
+		testNode("n4", nil),
+	}
+	tests := []struct {
+		name string
+		l    *labelerv1alpha1.Labeler
+		exp  []string
+	}{
+		{
+			name: "An In requirement looks up its values.",
+			l:    selectorLabeler([]corev1.NodeSelectorRequirement{{Key: "pool", Operator: corev1.NodeSelectorOpIn, Values: []string{"a", "b"}}}),
+			exp:  []string{"n1", "n2"},
+		},
+		{
+			name: "An Exists requirement looks up its key.",
+			l:    selectorLabeler([]corev1.NodeSelectorRequirement{{Key: "gpu", Operator: corev1.NodeSelectorOpExists}}),
+			exp:  []string{"n1", "n3"},
+		},
+		{
+			name: "A term is looked up by its first indexed requirement.",
+			l: selectorLabeler([]corev1.NodeSelectorRequirement{
+				{Key: "pool", Operator: corev1.NodeSelectorOpNotIn, Values: []string{"a"}},
+				{Key: "gpu", Operator: corev1.NodeSelectorOpExists},
+			}),
+			exp: []string{"n1", "n3"},
+		},
+		{
+			name: "The candidates of the terms are merged once.",
+			l: selectorLabeler(
+				[]corev1.NodeSelectorRequirement{{Key: "pool", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}}},
+				[]corev1.NodeSelectorRequirement{{Key: "gpu", Operator: corev1.NodeSelectorOpExists}},
+			),
+			exp: []string{"n1", "n3"},
+		},
+		{
+			name: "A term that can't be indexed falls back to all the nodes.",
+			l: selectorLabeler(
+				[]corev1.NodeSelectorRequirement{{Key: "pool", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}}},
+				[]corev1.NodeSelectorRequirement{{Key: "pool", Operator: corev1.NodeSelectorOpDoesNotExist}},
+			),
+			exp: []string{"n1", "n2", "n3", "n4"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lc := NewLabelController(Config{IndexNodes: true}, test.l, indexedNodes(true, nodes...), kooperlog.Dummy)
+			got := []string{}
+			for _, obj := range lc.candidateNodes() {
+				got = append(got, obj.(*corev1.Node).Name)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, test.exp) {
+				t.Errorf("expected the candidates %v, got %v", test.exp, got)
+			}
+		})
+	}
+}
+
+// BenchmarkCandidateNodes measures the nodes examined by the labelers of a 5000 node
+// cluster with 100 labelers, each selecting a pool of 50 nodes, with and without the
+// node indexes.
+func BenchmarkCandidateNodes(b *testing.B) {
+	const nodes, labelers = 5000, 100
+	var fixtures []*corev1.Node
+	for i := 0; i < nodes; i++ {
+		fixtures = append(fixtures, testNode(fmt.Sprintf("n%d", i), map[string]string{
+			"pool": fmt.Sprintf("p%d", i%labelers),
+			"zone": fmt.Sprintf("z%d", i%3),
+		}))
+	}
+	for _, indexed := range []bool{false, true} {
+		b.Run(fmt.Sprintf("indexed %t", indexed), func(b *testing.B) {
+			store := indexedNodes(indexed, fixtures...)
+			var lcs []*LabelController
+			for i := 0; i < labelers; i++ {
+				l := selectorLabeler([]corev1.NodeSelectorRequirement{{Key: "pool", Operator: corev1.NodeSelectorOpIn, Values: []string{fmt.Sprintf("p%d", i)}}})
+				lcs = append(lcs, NewLabelController(Config{IndexNodes: indexed}, l, store, kooperlog.Dummy))
+			}
+
+			b.ResetTimer()
+			examined, matched := 0, 0
+			for i := 0; i < b.N; i++ {
+				for _, lc := range lcs {
+					for _, obj := range lc.candidateNodes() {
+						examined++
+						if NodeMatchesNodeSelectorTerms(obj.(*corev1.Node), lc.l.Spec.NodeSelectorTerms) {
+							matched++
+						}
+					}
+				}
+			}
+			if matched != b.N*nodes {
+				b.Fatalf("expected every node matched once, got %d", matched/b.N)
+			}
+			b.ReportMetric(float64(examined)/float64(b.N), "nodes-examined/op")
+		})
+	}
+}
+
+func TestEnqueueLabelerQueuesAffectedNodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		indexed bool
+		exp     []string
+	}{
+		{name: "Without the indexes every node is queued.", exp: []string{"n1", "n2", "n3"}},
+		{name: "With the indexes the candidates and the owned nodes are queued.", indexed: true, exp: []string{"n1", "n3"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			owned := testNode("n3", map[string]string{"pool": "b"})
+			owned.Annotations = map[string]string{labeler.OwnedKeysAnnotation: `{"l":["labels/team"]}`}
+			s := newNodeServer(testNode("n1", map[string]string{"pool": "a"}), testNode("n2", map[string]string{"pool": "b"}), owned)
+			c, stop := newSyncedLabeler(t, s, Config{IndexNodes: test.indexed})
+			defer stop()
+			// The nodes queued by the informer.
+			for i := 0; i < 3; i++ {
+				key, _ := c.queue.Get()
+				c.queue.Done(key)
+			}
+
+			if err := c.EnsureLabeler(poolLabeler("l", "a", labelerv1alpha1.LabelerSpec{Merge: mergeSpec(map[string]string{"team": "ops"})})); err != nil {
+				t.Fatal(err)
+			}
+			got := c.queue.snapshot().Waiting
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, test.exp) {
+				t.Errorf("expected the nodes %v queued, got %v", test.exp, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package labeler
+
+import (
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// ConditionKillSwitch is set while the kill switch pauses the node mutations.
+	ConditionKillSwitch = "KillSwitch"
+
+	// killSwitchPausedKey is the kill switch ConfigMap data key that pauses the node
+	// mutations when "true".
+	killSwitchPausedKey = "paused"
+)
+
+// killSwitch is the state of the kill switch ConfigMap.
+type killSwitch struct {
+	mu     sync.Mutex
+	paused bool
+	since  time.Time
+	// haltEscalation halts the taint escalations, the rest of the mutations go on.
+	haltEscalation bool
+}
+
+// newKillSwitchInformer returns a new informer of the kill switch ConfigMap, its changes
+// pause or resume the node mutations as soon as they are watched.
+func (c *Labeler) newKillSwitchInformer() cache.SharedIndexInformer {
+	selectName := func(options *metav1.ListOptions) {
+		options.FieldSelector = fields.OneTermEqualSelector("metadata.name", c.cfg.KillSwitchConfigMapName).String()
+	}
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			selectName(&options)
+			return c.k8sCli.CoreV1().ConfigMaps(c.cfg.KillSwitchConfigMapNamespace).List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			selectName(&options)
+			return c.k8sCli.CoreV1().ConfigMaps(c.cfg.KillSwitchConfigMapNamespace).Watch(options)
+		},
+	}
+	informer := cache.NewSharedIndexInformer(lw, &corev1.ConfigMap{}, c.cfg.ResyncPeriod, cache.Indexers{})
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.setKillSwitch(obj, false) },
+		UpdateFunc: func(_, obj interface{}) { c.setKillSwitch(obj, false) },
+		DeleteFunc: func(obj interface{}) { c.setKillSwitch(obj, true) },
+	})
+	return informer
+}
+
+// killSwitchSynced returns true if the kill switch is disabled or its informer has
+// synced, the nodes are not patched before its state is known.
+func (c *Labeler) killSwitchSynced() bool {
+	return c.killSwitchInformer == nil || c.killSwitchInformer.HasSynced()
+}
+
+// setKillSwitch updates the kill switch from its ConfigMap and logs the transitions.
+// A deleted ConfigMap resumes the mutations, resuming syncs all the nodes again.
+func (c *Labeler) setKillSwitch(obj interface{}, deleted bool) {
+	paused, halted := false, false
+	if cm, ok := obj.(*corev1.ConfigMap); ok && !deleted {
+		paused = cm.Data[killSwitchPausedKey] == "true"
+		halted = cm.Data[killSwitchHaltEscalationKey] == "true"
+	}
+
+	c.killSwitch.mu.Lock()
+	changed := paused != c.killSwitch.paused
+	c.killSwitch.paused = paused
+	if changed && paused {
+		c.killSwitch.since = time.Now()
+	}
+	haltChanged := halted != c.killSwitch.haltEscalation
+	c.killSwitch.haltEscalation = halted
+	c.killSwitch.mu.Unlock()
+
+	switch {
+	case haltChanged && halted:
+		c.logger.Warningf("kill switch configmap %s/%s halted the taint escalations", c.cfg.KillSwitchConfigMapNamespace, c.cfg.KillSwitchConfigMapName)
+	case haltChanged:
+		c.logger.Infof("kill switch configmap %s/%s resumed the taint escalations", c.cfg.KillSwitchConfigMapNamespace, c.cfg.KillSwitchConfigMapName)
+	}
+	switch {
+	case changed && paused:
+		c.logger.Warningf("kill switch configmap %s/%s paused: node mutations stopped", c.cfg.KillSwitchConfigMapNamespace, c.cfg.KillSwitchConfigMapName)
+	case changed:
+		c.logger.Infof("kill switch configmap %s/%s cleared: resuming node mutations", c.cfg.KillSwitchConfigMapNamespace, c.cfg.KillSwitchConfigMapName)
+		c.enqueueAll()
+	case haltChanged && !halted:
+		// The soaked taints are escalated right away.
+		c.enqueueAll()
+	}
+}
+
+// EscalationHalted satisfies EscalationHalter interface, the kill switch halts the
+// taint escalations.
+func (c *Labeler) EscalationHalted() bool {
+	c.killSwitch.mu.Lock()
+	defer c.killSwitch.mu.Unlock()
+	return c.killSwitch.haltEscalation
+}
+
+// killed returns true if the kill switch pauses the node mutations.
+func (c *Labeler) killed() bool {
+	c.killSwitch.mu.Lock()
+	defer c.killSwitch.mu.Unlock()
+	return c.killSwitch.paused
+}
+
+// killSwitchCondition returns the KillSwitch condition, nil if the kill switch doesn't
+// pause the node mutations.
+func (c *Labeler) killSwitchCondition() *Condition {
+	c.killSwitch.mu.Lock()
+	defer c.killSwitch.mu.Unlock()
+	if !c.killSwitch.paused {
+		return nil
+	}
+	return &Condition{
+		Type:     ConditionKillSwitch,
+		Severity: ConditionSeverityWarning,
+		Since:    c.killSwitch.since.UTC(),
+		Message:  "the node mutations are stopped by the kill switch configmap " + c.cfg.KillSwitchConfigMapNamespace + "/" + c.cfg.KillSwitchConfigMapName,
+	}
+}
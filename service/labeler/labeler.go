@@ -1,12 +1,32 @@
 package labeler
 
 import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 
+	"github.com/joshisa/resource-labeler-operator/apis/labeler"
 	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
 	"github.com/joshisa/resource-labeler-operator/log"
+	"github.com/joshisa/resource-labeler-operator/metrics"
+)
+
+const (
+	cacheMetricsInterval = 10 * time.Second
+	defaultWorkers       = 5
+	defaultQueueName     = "nodes"
 )
 
 // Syncer is the interface that every labeler service implementation
@@ -18,62 +38,1029 @@ type Syncer interface {
 	DeleteLabeler(name string) error
 }
 
-// Chaos is the service that will ensure that the desired pod terminator CRDs are met.
-// Chaos will have running instances of PodDestroyers.
+// Config is the labeler service configuration.
+type Config struct {
+	// ResyncPeriod is the resync period of the node informer.
+	ResyncPeriod time.Duration
+	// MutationRecorder is notified of the node mutations (optional).
+	MutationRecorder MutationRecorder
+	// ReconcileRecorder is notified of the node sync results (optional).
+	ReconcileRecorder ReconcileRecorder
+	// MetricsRecorder records the service metrics (optional).
+	MetricsRecorder metrics.Recorder
+	// OwnerAnnotation is the node annotation with the attributes owned by every
+	// labeler (optional).
+	OwnerAnnotation string
+	// CanaryAnnotation is the node annotation with the labelers the node is canary
+	// of (optional).
+	CanaryAnnotation string
+	// ManagedPrefix is the prefix of the annotations managed by the operator (optional).
+	ManagedPrefix string
+	// RequeueOnManagedAnnotations syncs the nodes again when only their managed
+	// annotations changed, usually by the operator itself.
+	RequeueOnManagedAnnotations bool
+	// WatchTimeout is the time without node lists, watches or watch events after which
+	// the node informer is restarted, 0 disables the watchdog.
+	WatchTimeout time.Duration
+	// Workers is the number of nodes synced concurrently (optional), the minimum
+	// with MaxWorkers.
+	Workers int
+	// MaxWorkers scales the workers up to this number when the node queue backs up
+	// and back down when it's empty, 0 (or not over Workers) keeps them static.
+	MaxWorkers int
+	// CombinePolicy is how the labels and annotations of the labelers applied on the
+	// same node combine, union (default) or strict.
+	CombinePolicy string
+	// ConflictTiebreak is the order the labelers are applied in, so which one wins a
+	// conflicting key: name (default), creationTimestamp-oldest,
+	// creationTimestamp-newest or generation.
+	ConflictTiebreak string
+	// SkipDrainingNodes defers the sync of the nodes being drained, they are synced
+	// again after DrainingRequeue.
+	SkipDrainingNodes bool
+	DrainingRequeue   time.Duration
+	// DrainingAnnotation is the node annotation marking it as being drained (optional).
+	DrainingAnnotation string
+	// ExemptAnnotation is the node annotation with the labelers the node is exempted
+	// from (optional).
+	ExemptAnnotation string
+	// EventQPS is the sustained rate of the events of a node and reason, 0 doesn't
+	// limit them.
+	EventQPS float32
+	// EventBurst is the burst of the events of a node and reason over EventQPS.
+	EventBurst int
+	// IndexNodes indexes the node cache by label and owner labeler, the labeler
+	// changes only sync and match their candidate nodes instead of all of them.
+	IndexNodes bool
+	// TrackDesiredLabels records the labels of every node once all the labelers are
+	// applied, for DesiredLabels.
+	TrackDesiredLabels bool
+	// VerifyIdempotent plans the nodes again right after patching them and reports the
+	// labelers that would still change them.
+	VerifyIdempotent bool
+	// MaxPatchBytes is the size over which the node patches are applied in sequential
+	// chunks (optional).
+	MaxPatchBytes int
+	// AnnotationsGuardBytes is the maximum total size of the node annotations the
+	// operator patches, below the API limit (optional).
+	AnnotationsGuardBytes int
+	// NodeName restricts the labeler to the node with this name (optional), only
+	// that node (and its pods) are watched.
+	NodeName string
+	// TaintEvictionReport reports the pods evicted by the NoExecute taints before
+	// applying them.
+	TaintEvictionReport bool
+	// DryRun plans and reports the changes of all the labelers without applying them,
+	// like if every labeler was in dry run.
+	DryRun bool
+	// AllowReserved allows the labelers to write keys with reserved prefixes.
+	AllowReserved bool
+	// MatchLabelAllowlist are the only label keys the labelers can match the nodes
+	// on, "prefix/*" entries allow a whole prefix. Empty allows every key.
+	MatchLabelAllowlist []string
+	// AllowedTaintEffects are the only taint effects the labelers can merge, empty
+	// allows all of them.
+	AllowedTaintEffects []string
+	// HTTPSourceHosts are the only URL hosts the http value sources can get,
+	// "*.domain" entries allow its subdomains. Empty rejects every http source.
+	HTTPSourceHosts []string
+	// HTTPSourceSecrets are the only namespace/name Secrets the http value sources
+	// can send.
+	HTTPSourceSecrets []string
+	// MaxChangesPerPass caps the nodes every labeler changes per resync period, in
+	// its rollout order, 0 doesn't cap them.
+	MaxChangesPerPass int
+	// MaxUnavailablePerZone caps the disruptive mutations (adding or changing NoSchedule
+	// and NoExecute taints) in flight in every zone, 0 doesn't cap them. A mutation is
+	// in flight from its patch until the end of ZoneDisruptionWindow.
+	MaxUnavailablePerZone int
+	ZoneDisruptionWindow  time.Duration
+	// ZoneLabel is the node label with the zone, the well-known zone labels if empty.
+	ZoneLabel string
+	// ZoneClients are the clients of the preferred API servers of the node mutations by
+	// zone, ZoneAPIServers their URLs. The nodes of the other zones, and those whose
+	// preferred API server can't be reached, are patched with the default client.
+	ZoneClients    map[string]kubernetes.Interface
+	ZoneAPIServers map[string]string
+	// LogNoop logs the syncs that don't change the nodes at info level, otherwise they
+	// are only logged at debug level.
+	LogNoop bool
+	// ProtectKeys are the label, annotation and taint keys the labelers set but never
+	// remove, "prefix/*" entries protect a whole prefix.
+	ProtectKeys []string
+	// ContentHash skips syncing the nodes whose content hash annotation matches their
+	// content and the labelers.
+	ContentHash bool
+	// AuditInterval is the period of the audits listing all the nodes from the API and
+	// correcting those not in the desired state, 0 disables them.
+	AuditInterval time.Duration
+	// AuditStart aligns the audits to this time plus multiples of AuditInterval,
+	// the first audit is an interval after starting if zero.
+	AuditStart time.Time
+	// ContentHashAnnotation is the node annotation with the content hash (optional).
+	ContentHashAnnotation string
+	// PatchType is the patch type of the node mutations, merge by default.
+	PatchType string
+	// AppliedBy is the operator version and instance stamped with the time on the
+	// nodes it mutates, for provenance. Empty disables the stamps.
+	AppliedBy string
+	// AppliedByAnnotation and AppliedAtAnnotation are the node annotations of the
+	// stamps (optional).
+	AppliedByAnnotation string
+	AppliedAtAnnotation string
+	// FingerprintAnnotation is the node annotation with the fingerprint of the managed
+	// keys and values of the node, empty disables it.
+	FingerprintAnnotation string
+	// ErrorCircuitThreshold is the sync error rate (0-1) over the error circuit window
+	// that pauses the node mutations, 0 disables the circuit breaker.
+	ErrorCircuitThreshold float64
+	// ErrorCircuitWindow is the window of the error rate and how long the mutations
+	// are paused (optional).
+	ErrorCircuitWindow time.Duration
+	// SpreadInitialReconcile staggers the nodes queued after startup across this
+	// window so the first sync of all of them doesn't burst the API server, 0
+	// disables it.
+	SpreadInitialReconcile time.Duration
+	// QueueName is the name of the node queue (optional).
+	QueueName string
+	// StateCacheSize is the maximum number of entries of every per node state cache
+	// (optional).
+	StateCacheSize int
+	// WatchPods runs a pod informer so the value sources can use the pods assigned
+	// to the nodes, assigning and removing pods syncs their node.
+	WatchPods bool
+	// WatchReferences watches the Secrets and DaemonSets the labelers reference, their
+	// changes sync again the nodes of the labelers referencing them.
+	WatchReferences bool
+	// WatchNodeLeases lists the node leases every 10 seconds so the value sources can
+	// use their renewal time.
+	WatchNodeLeases bool
+	// Leases is where the value sources get the node lease renewal times from, set by
+	// the labeler service with WatchNodeLeases (optional).
+	Leases LeaseStore
+	// WatchSchedulingFailures watches the FailedScheduling events so the value sources
+	// can use the resource pressure failures of the pods pinned to the nodes.
+	WatchSchedulingFailures bool
+	// SchedulingFailures is where the value sources get the scheduling failures of
+	// the nodes from, set by the labeler service with WatchSchedulingFailures
+	// (optional).
+	SchedulingFailures SchedulingFailureStore
+	// Pods is where the value sources get the pods assigned to the nodes from, set by
+	// the labeler service with WatchPods (optional).
+	Pods PodStore
+	// DaemonSets is where the labelers get the DaemonSets that need to tolerate their
+	// NoExecute taints from, set by the labeler service (optional).
+	DaemonSets DaemonSetGetter
+	// Secrets is where the value sources get the Secrets with their credentials from,
+	// set by the labeler service (optional).
+	Secrets SecretGetter
+	// FreezeUntil pauses the node mutations until this time, the nodes are still
+	// planned and the status updated.
+	FreezeUntil time.Time
+	// FreezeConfigMapNamespace and FreezeConfigMapName are the sentinel ConfigMap
+	// whose freeze-until annotation freezes the node mutations at runtime (optional).
+	FreezeConfigMapNamespace string
+	FreezeConfigMapName      string
+	// KillSwitchConfigMapNamespace and KillSwitchConfigMapName are the watched ConfigMap
+	// whose paused "true" data key stops the node mutations until cleared, and whose
+	// haltTaintEscalation "true" data key halts the taint escalations (optional).
+	KillSwitchConfigMapNamespace string
+	KillSwitchConfigMapName      string
+	// EscalationHalt is where the labelers know if their taint escalations are halted,
+	// set by the labeler service with the kill switch ConfigMap (optional).
+	EscalationHalt EscalationHalter
+	// LeaseConfigMapNamespace and LeaseConfigMapName are the leader lease ConfigMap, only
+	// the operator instance holding the lease as LeaseIdentity patches the nodes
+	// (optional). The lease is renewed within LeaseDuration.
+	LeaseConfigMapNamespace string
+	LeaseConfigMapName      string
+	LeaseIdentity           string
+	LeaseDuration           time.Duration
+	// LeaseClient is the client of the leader lease calls, its requests time out in
+	// LeaseCallTimeout so the node mutations stop before the lease expires (optional,
+	// the default client without).
+	LeaseClient kubernetes.Interface
+	// Prewarm starts the informers and syncs the caches while waiting for the leader
+	// lease, so the instance takes over right away. Otherwise nothing starts before.
+	Prewarm bool
+	// NoMatchesWindow is the time a labeler can match no nodes before having the
+	// NoMatches condition, 0 disables it.
+	NoMatchesWindow time.Duration
+	// SpecHistorySize is the number of spec edits kept by labeler for the status, 0
+	// disables the history.
+	SpecHistorySize int
+	// OrphanPolicy is what is done with the managed keys of the labelers that no
+	// longer exist or no longer set them, kept by default.
+	OrphanPolicy string
+	// OrphanSweepInterval is the period of the orphaned keys sweeps (optional).
+	OrphanSweepInterval time.Duration
+	// LabelerSync tracks the labelers of the watched versions, the orphaned keys are
+	// only swept once they are all listed (optional, the loaded labelers are all the
+	// labelers without it).
+	LabelerSync LabelerSync
+	// MetricsLabels are the labels of the per labeler metrics the labelers set with
+	// metricsLabels, at most MetricsLabelsLimit distinct value sets (optional).
+	MetricsLabels      []string
+	MetricsLabelsLimit int
+	// BackpressureHighWater is the number of nodes ready to sync putting the node queue
+	// under backpressure until it drains to BackpressureLowWater (half of it by default),
+	// disabled if 0.
+	BackpressureHighWater int
+	BackpressureLowWater  int
+	// ReportRedundant periodically reports the labelers redundant with another one,
+	// as a metric and in the logs.
+	ReportRedundant bool
+	// RetryPolicies are the retry policies of the failed node syncs by error class,
+	// the missing classes get the DefaultRetryPolicies.
+	RetryPolicies map[string]string
+	// CrashOnPanic doesn't recover the panics of the node syncs, they crash the
+	// operator. Otherwise they fail the sync with the Panic error class.
+	CrashOnPanic bool
+	// RequireApplyTrigger stages the changes of every labeler generation, planned like
+	// a dry run, until the labeler has the ApplyAnnotation set to "true". The trigger
+	// is cleared with Labelers recording the generation on the
+	// ApprovedGenerationAnnotation.
+	RequireApplyTrigger          bool
+	ApplyAnnotation              string
+	ApprovedGenerationAnnotation string
+	Labelers                     LabelerUpdater
+	// MaxBlastRadius is the maximum number of nodes a new labeler generation can newly
+	// select, the generations over it are planned like a dry run until the labeler has
+	// the AllowBlastRadiusAnnotation with their generation. 0 disables it, the labelers
+	// can override it.
+	MaxBlastRadius             int
+	AllowBlastRadiusAnnotation string
+}
+
+// withDefaults returns the configuration with the defaults of the optional settings.
+func (c Config) withDefaults() Config {
+	if c.MutationRecorder == nil {
+		c.MutationRecorder = dummyRecorder
+	}
+	if c.LeaseDuration <= 0 {
+		c.LeaseDuration = defaultLeaseDuration
+	}
+	if c.MetricsRecorder == nil {
+		c.MetricsRecorder = metrics.Dummy
+	}
+	if c.OwnerAnnotation == "" {
+		c.OwnerAnnotation = labeler.OwnedKeysAnnotation
+	}
+	if c.CanaryAnnotation == "" {
+		c.CanaryAnnotation = labeler.CanaryAnnotation
+	}
+	if c.ManagedPrefix == "" {
+		c.ManagedPrefix = labeler.GroupName
+	}
+	if c.ContentHashAnnotation == "" {
+		c.ContentHashAnnotation = labeler.Annotation(c.ManagedPrefix, labeler.ContentHashAnnotationName)
+	}
+	if c.BackpressureHighWater > 0 && c.BackpressureLowWater <= 0 {
+		c.BackpressureLowWater = c.BackpressureHighWater / 2
+	}
+	if c.MetricsLabelsLimit <= 0 {
+		c.MetricsLabelsLimit = defaultMetricsLabelsLimit
+	}
+	if c.OrphanPolicy == "" {
+		c.OrphanPolicy = OrphanKeep
+	}
+	if c.OrphanSweepInterval <= 0 {
+		c.OrphanSweepInterval = defaultOrphanSweepInterval
+	}
+	if c.PatchType == "" {
+		c.PatchType = PatchMerge
+	}
+	if c.AppliedByAnnotation == "" {
+		c.AppliedByAnnotation = labeler.Annotation(c.ManagedPrefix, labeler.AppliedByAnnotationName)
+	}
+	if c.AppliedAtAnnotation == "" {
+		c.AppliedAtAnnotation = labeler.Annotation(c.ManagedPrefix, labeler.AppliedAtAnnotationName)
+	}
+	if c.ApplyAnnotation == "" {
+		c.ApplyAnnotation = labeler.Annotation(c.ManagedPrefix, labeler.ApplyAnnotationName)
+	}
+	if c.ApprovedGenerationAnnotation == "" {
+		c.ApprovedGenerationAnnotation = labeler.Annotation(c.ManagedPrefix, labeler.ApprovedGenerationAnnotationName)
+	}
+	if c.AllowBlastRadiusAnnotation == "" {
+		c.AllowBlastRadiusAnnotation = labeler.Annotation(c.ManagedPrefix, labeler.AllowBlastRadiusAnnotationName)
+	}
+	if c.Workers <= 0 {
+		c.Workers = defaultWorkers
+	}
+	if c.ErrorCircuitWindow <= 0 {
+		c.ErrorCircuitWindow = defaultErrorCircuitWindow
+	}
+	if c.QueueName == "" {
+		c.QueueName = defaultQueueName
+	}
+	if c.StateCacheSize <= 0 {
+		c.StateCacheSize = defaultStateCacheSize
+	}
+	if c.DrainingAnnotation == "" {
+		c.DrainingAnnotation = labeler.Annotation(c.ManagedPrefix, labeler.DrainingAnnotationName)
+	}
+	if c.ExemptAnnotation == "" {
+		c.ExemptAnnotation = labeler.Annotation(c.ManagedPrefix, labeler.ExemptAnnotationName)
+	}
+	if c.EventBurst <= 0 {
+		c.EventBurst = defaultEventBurst
+	}
+	if c.ZoneDisruptionWindow <= 0 {
+		c.ZoneDisruptionWindow = defaultZoneDisruptionWindow
+	}
+	if c.MaxPatchBytes <= 0 {
+		c.MaxPatchBytes = defaultMaxPatchBytes
+	}
+	if c.AnnotationsGuardBytes <= 0 {
+		c.AnnotationsGuardBytes = defaultAnnotationsGuardBytes
+	}
+	if c.DrainingRequeue <= 0 {
+		c.DrainingRequeue = defaultDrainingRequeue
+	}
+	if c.CombinePolicy == "" {
+		c.CombinePolicy = CombineUnion
+	}
+	if c.ConflictTiebreak == "" {
+		c.ConflictTiebreak = TiebreakName
+	}
+	policies := make(map[string]string, len(DefaultRetryPolicies))
+	for class, policy := range DefaultRetryPolicies {
+		policies[class] = policy
+	}
+	for class, policy := range c.RetryPolicies {
+		policies[class] = policy
+	}
+	c.RetryPolicies = policies
+	return c
+}
+
+// Labeler is the service that applies the labelers on the nodes: it runs a label
+// controller per labeler and syncs the cached nodes with all of them.
 type Labeler struct {
+	cfg    Config
 	k8sCli kubernetes.Interface
 	reg    sync.Map
 	logger log.Logger
+	// invalid are the InvalidSpec conditions of the labelers rejected by name.
+	invalid sync.Map
+
+	// nodeInformer is replaced when the watchdog restarts it.
+	nodeInformer cache.SharedIndexInformer
+	informerMu   sync.RWMutex
+	// lastEvent is the unix nano time of the last node list, watch or watch event.
+	lastEvent int64
+	// nodeGeneration counts the node cache changes the rollouts depend on.
+	nodeGeneration uint64
+	// podInformer has the pods by node, nil if the pods are not watched.
+	podInformer cache.SharedIndexInformer
+	// references watches the objects the labelers reference, nil if they are not
+	// watched.
+	references *referenceTracker
+	// nodeLeases has the node lease renewal times, nil if they are not watched.
+	nodeLeases *nodeLeases
+	// schedulingFailures has the scheduling failures of the nodes, nil if they are not
+	// watched.
+	schedulingFailures *schedulingFailures
+	// requestIDs are the request IDs of the node syncs in flight by node name.
+	requestIDs sync.Map
+
+	// queue has the nodes to sync, every node is synced with all the labelers at once.
+	queue   *trackedQueue
+	workers workerPool
+	cycle   reconcileCycle
+	// hashes are the content hashes of the nodes.
+	hashes *stateCache
+	// evictionReports are the NoExecute taints reported of the nodes.
+	evictionReports *stateCache
+	// breaker pauses the mutations on high error rates, nil if disabled.
+	breaker *circuitBreaker
+	freeze  freeze
+	// killSwitchInformer watches the kill switch ConfigMap, nil without kill switch.
+	killSwitchInformer cache.SharedIndexInformer
+	killSwitch         killSwitch
+	guard              sizeGuard
+	stopped            stoppedNodes
+	events             *eventSink
+	desired            desiredLabels
+	history            specHistory
+	// zones caps the disruptive mutations by zone, nil if disabled.
+	zones *zoneLimiter
+	// apiServer is the URL of the default API server, set with zone API servers.
+	apiServer string
+	// lease gates the node mutations on the leader lease, nil without lease.
+	lease *leaderLease
+	// forceSync are the nodes the audit queued, their next sync doesn't skip them by
+	// their content hash.
+	forceSync sync.Map
+	// staleNodes are the nodes the audit found stale in the cache, with their cached
+	// resource version ("" if missing): they are synced from the API until the cache
+	// has another version.
+	staleNodes sync.Map
+	// orphaned are the nodes the orphan sweep queued to remove their orphaned keys.
+	orphaned sync.Map
+	// backpressure is 1 while the node queue is under backpressure.
+	backpressure int32
+
+	dependencies map[string]Condition
+	dependencyMu sync.Mutex
+	// redundant are the redundant labelers of the last check.
+	redundant   map[string]Redundancy
+	redundantMu sync.Mutex
+	// spreadUntil is the end of the initial reconcile window, the unix nano time.
+	spreadUntil int64
+
+	lastErr     error
+	lastErrTime time.Time
+	statusMu    sync.Mutex
+}
+
+// Status is a summary of the labeler service.
+type Status struct {
+	// MatchedNodes are the number of nodes every labeler is applied to.
+	MatchedNodes map[string]int `json:"matchedNodes"`
+	// ZoneNodes are the number of nodes by zone every labeler with the BalancedByZone
+	// rollout strategy is applied to.
+	ZoneNodes map[string]map[string]int `json:"zoneNodes,omitempty"`
+	// DryRunNodes are the number of nodes every dry run labeler would change.
+	DryRunNodes map[string]int `json:"dryRunNodes,omitempty"`
+	// BlastRadius are the number of nodes the generation of every labeler with a max
+	// blast radius newly selects.
+	BlastRadius map[string]int `json:"blastRadius,omitempty"`
+	// ObservedGenerations are the labeler generations every label controller runs.
+	ObservedGenerations map[string]int64 `json:"observedGenerations,omitempty"`
+	LastError           string           `json:"lastError,omitempty"`
+	LastErrorTime       *time.Time       `json:"lastErrorTime,omitempty"`
+	// Conditions are the warning conditions of the labelers (e.g. NoMatches).
+	Conditions []Condition `json:"conditions,omitempty"`
+	// Degraded is set while the circuit breaker pauses the node mutations.
+	Degraded      bool       `json:"degraded,omitempty"`
+	DegradedSince *time.Time `json:"degradedSince,omitempty"`
+	// ZoneDisruptions are the disruptive mutations in flight by zone, with
+	// --max-unavailable-per-zone.
+	ZoneDisruptions map[string]int `json:"zoneDisruptions,omitempty"`
+	// History are the last spec edits of every labeler, the oldest first.
+	History map[string][]SpecEdit `json:"history,omitempty"`
+	// RetryPolicies are the effective retry policies of the failed node syncs by
+	// error class.
+	RetryPolicies map[string]string `json:"retryPolicies,omitempty"`
+	// Leader is the holder of the leader lease, with a lease.
+	Leader string `json:"leader,omitempty"`
 }
 
-// NewChaos returns a new Chaos service.
-func NewLabeler(k8sCli kubernetes.Interface, logger log.Logger) *Labeler {
-	return &Labeler{
-		k8sCli: k8sCli,
-		reg:    sync.Map{},
-		logger: logger,
+// NewLabeler returns a new labeler service.
+func NewLabeler(cfg Config, k8sCli kubernetes.Interface, logger log.Logger) *Labeler {
+	cfg = cfg.withDefaults()
+
+	c := &Labeler{
+		cfg:             cfg,
+		k8sCli:          k8sCli,
+		reg:             sync.Map{},
+		logger:          logger,
+		queue:           newTrackedQueue(cfg.QueueName),
+		hashes:          newStateCache(stateCacheContentHash, cfg.StateCacheSize, cfg.MetricsRecorder),
+		evictionReports: newStateCache(stateCacheEvictionReports, cfg.StateCacheSize, cfg.MetricsRecorder),
+		freeze:          freeze{until: cfg.FreezeUntil},
+		events:          newEventSink(cfg),
+	}
+	c.nodeInformer = c.newNodeInformer()
+	c.queue.priority = c.nodePriority
+	if cfg.WatchPods {
+		c.podInformer = c.newPodInformer()
+		c.cfg.Pods = c
+	}
+	if cfg.WatchReferences {
+		c.references = newReferenceTracker(c)
+	}
+	if cfg.WatchNodeLeases {
+		c.nodeLeases = &nodeLeases{c: c}
+		c.cfg.Leases = c.nodeLeases
+	}
+	if cfg.WatchSchedulingFailures {
+		c.schedulingFailures = newSchedulingFailures(c)
+		c.cfg.SchedulingFailures = c.schedulingFailures
 	}
+	if cfg.KillSwitchConfigMapName != "" {
+		c.killSwitchInformer = c.newKillSwitchInformer()
+		c.cfg.EscalationHalt = c
+	}
+	if cfg.LeaseConfigMapName != "" {
+		c.lease = &leaderLease{since: time.Now(), leadingC: make(chan struct{})}
+	}
+	c.cfg.DaemonSets = &daemonSetCache{c: c}
+	c.cfg.Secrets = &secretCache{c: c}
+	if cfg.MaxUnavailablePerZone > 0 {
+		c.zones = newZoneLimiter(cfg.MaxUnavailablePerZone, cfg.ZoneDisruptionWindow, cfg.ZoneLabel)
+	}
+	if len(cfg.ZoneClients) > 0 {
+		c.apiServer = defaultAPIServer(k8sCli)
+	}
+	if cfg.ErrorCircuitThreshold > 0 {
+		c.breaker = &circuitBreaker{threshold: cfg.ErrorCircuitThreshold, window: cfg.ErrorCircuitWindow}
+	}
+
+	return c
+}
+
+// newNodeInformer returns a new node informer. All the label controllers share the
+// same node cache, every node event queues the node to be synced.
+func (c *Labeler) newNodeInformer() cache.SharedIndexInformer {
+	informer := cache.NewSharedIndexInformer(c.nodeListWatch(), &corev1.Node{}, c.cfg.ResyncPeriod, c.nodeIndexers())
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.onAdd,
+		UpdateFunc: c.onUpdate,
+		DeleteFunc: c.onDelete,
+	})
+	return informer
+}
+
+// selectNode restricts the list options to the objects whose field is the node
+// name, when the labeler is restricted to a node.
+func (c *Labeler) selectNode(options *metav1.ListOptions, field string) {
+	if c.cfg.NodeName != "" {
+		options.FieldSelector = fields.OneTermEqualSelector(field, c.cfg.NodeName).String()
+	}
+}
+
+// Run will run the shared node informer and the node workers until stopC is closed,
+// restarting the informer when the watchdog detects it's stuck. Satisfies kooper
+// controller.Controller interface.
+func (c *Labeler) Run(stopC <-chan struct{}) error {
+	defer c.queue.ShutDown()
+	if c.lease != nil {
+		go c.runLease(stopC)
+		if !c.cfg.Prewarm {
+			c.logger.Infof("waiting for the leader lease %s before starting", c.leaseName())
+			if !c.waitLease(stopC) {
+				return nil
+			}
+		}
+	}
+	if c.cfg.SpreadInitialReconcile > 0 {
+		atomic.StoreInt64(&c.spreadUntil, time.Now().Add(c.cfg.SpreadInitialReconcile).UnixNano())
+	}
+	go wait.Until(c.recordCacheMetrics, cacheMetricsInterval, stopC)
+	if c.podInformer != nil {
+		c.logger.Infof("starting pod informer")
+		go c.podInformer.Run(stopC)
+	}
+	if c.killSwitchInformer != nil {
+		c.logger.Infof("starting kill switch informer")
+		go c.killSwitchInformer.Run(stopC)
+	}
+	if c.references != nil {
+		go c.references.run(stopC)
+	}
+	if c.nodeLeases != nil {
+		c.logger.Infof("starting node lease polling")
+		go c.nodeLeases.run(stopC)
+	}
+	if c.schedulingFailures != nil {
+		c.logger.Infof("starting scheduling failure event informer")
+		go c.schedulingFailures.run(stopC)
+	}
+	go func() {
+		// Wait until the node cache is ready so the rollouts see all the nodes, the
+		// pod cache so the pod value sources see all the pods, the node leases and the
+		// scheduling failures so their value sources resolve, and the kill switch so no
+		// node is patched while it's on.
+		if !cache.WaitForCacheSync(stopC, c.nodesSynced, c.podsSynced, c.leasesSynced, c.schedulingFailuresSynced, c.killSwitchSynced) {
+			return
+		}
+		c.leaseSynced()
+		go c.runWorkers(stopC)
+		if c.cfg.NoMatchesWindow > 0 {
+			go wait.Until(c.checkNoMatches, noMatchesCheckInterval, stopC)
+		}
+		go wait.Until(c.checkSelectorKeys, noMatchesCheckInterval, stopC)
+		if c.cfg.OrphanPolicy == OrphanReport || c.cfg.OrphanPolicy == OrphanRemove {
+			go c.runOrphanSweeps(stopC)
+		}
+		if c.cfg.ReportRedundant {
+			go wait.Until(c.checkRedundancy, noMatchesCheckInterval, stopC)
+		}
+		go wait.Until(c.checkConvergences, convergenceCheckInterval, stopC)
+		if c.cfg.BackpressureHighWater > 0 {
+			go wait.Until(c.checkBackpressure, backpressureCheckInterval, stopC)
+		}
+		if c.cfg.AuditInterval > 0 {
+			go c.runAudits(stopC)
+		}
+		if !c.cfg.FreezeUntil.IsZero() || c.cfg.FreezeConfigMapName != "" {
+			go wait.Until(c.checkFreeze, freezeCheckInterval, stopC)
+		}
+	}()
+
+	for {
+		c.logger.Infof("starting node informer")
+		informer := c.informer()
+		informerStopC := make(chan struct{})
+		c.touch()
+		go informer.Run(informerStopC)
+
+		restart := c.watchdog(stopC)
+		close(informerStopC)
+		if !restart {
+			break
+		}
+
+		c.logger.Warningf("no node events for %s, restarting the node informer", c.cfg.WatchTimeout)
+		c.cfg.MetricsRecorder.IncInformerRestarts(metrics.InformerNodes)
+		c.informerMu.Lock()
+		c.nodeInformer = c.newNodeInformer()
+		c.informerMu.Unlock()
+	}
+	c.logger.Infof("stopping node informer")
+	return nil
+}
+
+// recordCacheMetrics records the size of the node cache and the running labelers.
+func (c *Labeler) recordCacheMetrics() {
+	c.cfg.MetricsRecorder.SetInformerCacheObjects(metrics.InformerNodes, len(c.informer().GetStore().ListKeys()))
+	if c.podInformer != nil {
+		c.cfg.MetricsRecorder.SetInformerCacheObjects(metrics.InformerPods, len(c.podInformer.GetStore().ListKeys()))
+	}
+	labelers := 0
+	c.reg.Range(func(_, v interface{}) bool {
+		labelers++
+		lc := v.(*LabelController)
+		c.cfg.MetricsRecorder.SetLabelerMatchedNodes(lc.l.Name, lc.AffectedNodes())
+		return true
+	})
+	c.cfg.MetricsRecorder.SetInformerCacheObjects(metrics.InformerLabelers, labelers)
+	for priority, n := range c.queue.depths() {
+		c.cfg.MetricsRecorder.SetNodeQueueDepth(priority, n)
+	}
+}
+
+// onUpdate queues the updated node to be synced, unless only its managed annotations
+// changed so the operator updates don't trigger themselves.
+func (c *Labeler) onUpdate(old, new interface{}) {
+	on, ok1 := old.(*corev1.Node)
+	nn, ok2 := new.(*corev1.Node)
+	c.nodesChanged(on, nn)
+	if ok1 && ok2 && !c.cfg.RequeueOnManagedAnnotations && c.onlyManagedChanges(on, nn) {
+		return
+	}
+	// Under backpressure the resyncs don't grow the queue, the next resync after it
+	// catches up.
+	if ok1 && ok2 && on.ResourceVersion == nn.ResourceVersion && c.underBackpressure() {
+		return
+	}
+	c.dispatch(new)
 }
 
-// EnsurePodTerminator satisfies ChaosSyncer interface.
+// onlyManagedChanges returns true if the only changes between the node versions are
+// on the managed annotations. Resyncs (same version) are not changes.
+func (c *Labeler) onlyManagedChanges(old, new *corev1.Node) bool {
+	if old.ResourceVersion == new.ResourceVersion {
+		return false
+	}
+
+	o, n := old.DeepCopy(), new.DeepCopy()
+	for _, node := range []*corev1.Node{o, n} {
+		node.ResourceVersion = ""
+		for k := range node.Annotations {
+			if c.managedAnnotation(k) {
+				delete(node.Annotations, k)
+			}
+		}
+		if len(node.Annotations) == 0 {
+			node.Annotations = nil
+		}
+	}
+	return reflect.DeepEqual(o, n)
+}
+
+// managedAnnotation returns true if the annotation is written by the operator: the
+// owner annotation and the ones under the managed prefix except the user inputs
+// (canary and draining annotations).
+func (c *Labeler) managedAnnotation(key string) bool {
+	if key == c.cfg.OwnerAnnotation {
+		return true
+	}
+	return strings.HasPrefix(key, c.cfg.ManagedPrefix+"/") && key != c.cfg.CanaryAnnotation && key != c.cfg.DrainingAnnotation &&
+		key != c.cfg.ExemptAnnotation
+}
+
+// onDelete forgets the state of the deleted node.
+func (c *Labeler) onDelete(obj interface{}) {
+	c.nodesChanged(nil, nil)
+	if key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err == nil {
+		c.hashes.remove(key)
+		c.evictionReports.remove(key)
+		c.guard.track(key, 0)
+		c.desired.remove(key)
+		c.stopped.track(key, nil)
+		for _, lc := range c.controllers() {
+			lc.forgetNode(key)
+		}
+	}
+	c.clusterSizeChanged(-1)
+}
+
+// dispatch queues the node to be synced.
+func (c *Labeler) dispatch(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	c.cfg.MetricsRecorder.SetInformerLastSync(metrics.InformerNodes, time.Now())
+	c.enqueue(key)
+}
+
+// enqueueAll queues all the cached nodes to be synced.
+func (c *Labeler) enqueueAll() {
+	for _, key := range c.informer().GetStore().ListKeys() {
+		c.enqueue(key)
+	}
+}
+
+// enqueue queues the node to be synced. During the initial reconcile window the node
+// is queued after a random delay until the end of the window.
+func (c *Labeler) enqueue(key string) {
+	remaining := time.Duration(atomic.LoadInt64(&c.spreadUntil) - time.Now().UnixNano())
+	if remaining <= 0 {
+		c.queue.Add(key)
+		return
+	}
+	c.queue.AddAfter(key, time.Duration(rand.Int63n(int64(remaining))))
+}
+
+// controllers returns the label controllers sorted by the conflict tiebreak, the order
+// the labelers are applied in.
+func (c *Labeler) controllers() []*LabelController {
+	var lcs []*LabelController
+	c.reg.Range(func(_, v interface{}) bool {
+		lcs = append(lcs, v.(*LabelController))
+		return true
+	})
+	sort.Slice(lcs, func(i, j int) bool { return appliedBefore(lcs[i].l, lcs[j].l, c.cfg.ConflictTiebreak) })
+	return lcs
+}
+
+// EnsureLabeler satisfies Syncer interface. An invalid labeler is reported with an
+// InvalidSpec condition.
 func (c *Labeler) EnsureLabeler(l *labelerv1alpha1.Labeler) error {
+	err := c.ensureLabeler(l)
+	if err == nil {
+		c.invalid.Delete(l.Name)
+		return nil
+	}
+	// The resyncs of the same error keep its time.
+	if prev, ok := c.invalid.Load(l.Name); !ok || prev.(Condition).Message != err.Error() {
+		c.invalid.Store(l.Name, Condition{
+			Labeler:  l.Name,
+			Type:     ConditionInvalidSpec,
+			Severity: ConditionSeverityError,
+			Since:    time.Now().UTC(),
+			Message:  err.Error(),
+		})
+	}
+	return err
+}
+
+// ensureLabeler validates the labeler and runs its label controller.
+func (c *Labeler) ensureLabeler(l *labelerv1alpha1.Labeler) error {
+	if err := Validate(l); err != nil {
+		return err
+	}
+	if !c.cfg.AllowReserved {
+		if err := ValidateReserved(l); err != nil {
+			return fmt.Errorf("%s, they are only allowed with --allow-reserved", err)
+		}
+	}
+	if err := ValidateMatchLabels(l, c.cfg.MatchLabelAllowlist); err != nil {
+		return err
+	}
+	if err := ValidateTaintEffects(l, c.cfg.AllowedTaintEffects); err != nil {
+		return err
+	}
+	if err := ValidateHTTPSources(l, c.cfg.HTTPSourceHosts, c.cfg.HTTPSourceSecrets); err != nil {
+		return err
+	}
+	if err := c.validateMetricsLabels(l); err != nil {
+		return err
+	}
+
+	approved := c.applyApproved(l)
+	if c.cfg.RequireApplyTrigger && c.applyTriggered(l) && c.consumeApplyTrigger(l) {
+		approved = true
+	}
+	blastAllowed := c.blastRadiusAllowed(l)
+
 	labelController, ok := c.reg.Load(l.Name)
-	var lc *LabelController
+	var lc, old *LabelController
 
 	// We are already running.
 	if ok {
 		lc = labelController.(*LabelController)
-		// If not the same spec means options have changed, so we don't longer need this pod killer.
+		// The spec only changes with the generation, resyncs of the same generation
+		// don't need to be compared. Without generation (not maintained by the API
+		// server) the spec is always compared.
+		if l.Generation != 0 && lc.ObservedGeneration() == l.Generation {
+			c.applyStaged(lc, approved)
+			c.applyBlastRadiusAllowance(lc, blastAllowed)
+			return nil
+		}
+		// If not the same spec the label controller is recreated with the new one.
 		if !lc.SameSpec(l) {
-			c.logger.Infof("spec of %s changed, recreating label controller", l.Name)
-			if err := c.DeleteLabeler(l.Name); err != nil {
-				return err
-			}
+			old = lc
 		} else { // We are ok, nothing changed.
+			lc.observe(l.Generation)
+			c.applyStaged(lc, approved)
+			c.applyBlastRadiusAllowance(lc, blastAllowed)
 			return nil
 		}
 	}
 
-	// Create a pod killer.
+	// Create the label controller.
 	lCopy := l.DeepCopy()
-	lc = NewLabelController(lCopy, c.k8sCli, c.logger)
+	lc = NewLabelController(c.cfg, lCopy, nodeStore{c}, c.logger)
+	// The running label controller is only replaced once the new one can run.
+	if lc.needsPods() && c.cfg.Pods == nil {
+		return fmt.Errorf("%s: the %s value source needs the pods, they are only watched with --watch-pods", l.Name, PodResourceSumType)
+	}
+	if lc.needsLeases() && c.cfg.Leases == nil {
+		return fmt.Errorf("%s: the %s value source needs the node leases, they are only watched with --watch-node-leases", l.Name, NodeLeaseType)
+	}
+	if lc.needsSchedulingFailures() && c.cfg.SchedulingFailures == nil {
+		return fmt.Errorf("%s: the %s value source needs the scheduling failures, they are only watched with --watch-scheduling-failures", l.Name, SchedulingPressureType)
+	}
+	if old != nil {
+		c.logger.Infof("spec of %s changed, recreating label controller", l.Name)
+		if err := c.DeleteLabeler(l.Name); err != nil {
+			return err
+		}
+	}
+	if !approved {
+		lc.stage()
+		c.logger.Infof("%s: generation %d staged until the labeler has the %s=true annotation", l.Name, l.Generation, c.cfg.ApplyAnnotation)
+	}
+	if blastAllowed {
+		lc.allowBlastRadius()
+	}
+	c.cfg.MetricsRecorder.SetLabelerMetricsLabels(l.Name, l.Spec.MetricsLabels)
 	c.reg.Store(l.Name, lc)
-	return lc.Start()
-	// TODO: garbage collection.
+	c.trackReferences(l.Name, lc.references())
+	c.logger.Infof("started %s label controller", l.Name)
+	var prev *labelerv1alpha1.Labeler
+	if old != nil {
+		prev = old.l
+	}
+	c.recordSpecEdit(prev, lCopy)
+	if old != nil {
+		c.enqueueLabeler(lc, old)
+	} else {
+		c.enqueueLabeler(lc)
+	}
+	return nil
 }
 
-// DeletePodTerminator satisfies ChaosSyncer interface.
+// DeleteLabeler satisfies Syncer interface, the labeler is no longer applied and its
+// metrics are removed.
 func (c *Labeler) DeleteLabeler(name string) error {
-	l, ok := c.reg.Load(name)
-	if !ok {
+	c.invalid.Delete(name)
+	if _, ok := c.reg.Load(name); !ok {
 		return nil
 	}
 
-	lc := l.(*LabelController)
-	if err := lc.Stop(); err != nil {
-		return err
-	}
-
 	c.reg.Delete(name)
+	c.trackReferences(name, nil)
+	c.cfg.MetricsRecorder.DeleteLabelerMetrics(name)
+	c.logger.Infof("stopped %s label controller", name)
 	return nil
 }
+
+// OwnedNodes returns the number of cached nodes whose owner annotation lists the
+// labeler, the nodes it would be withdrawn from. It fails until the nodes are synced.
+func (c *Labeler) OwnedNodes(name string) (int, error) {
+	if !c.nodesSynced() {
+		return 0, fmt.Errorf("the nodes are not synced yet")
+	}
+	n := 0
+	for _, obj := range c.informer().GetStore().List() {
+		node, ok := obj.(*corev1.Node)
+		if !ok {
+			continue
+		}
+		if _, ok := ownedKeys(node, c.cfg.OwnerAnnotation)[name]; ok {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Status returns the summary of the labeler service.
+func (c *Labeler) Status() Status {
+	st := Status{MatchedNodes: map[string]int{}, ObservedGenerations: map[string]int64{}}
+	lcs := c.controllers()
+	for _, lc := range lcs {
+		st.MatchedNodes[lc.l.Name] = lc.AffectedNodes()
+		st.ObservedGenerations[lc.l.Name] = lc.ObservedGeneration()
+		if edits := c.history.get(lc.l.Name); len(edits) > 0 {
+			if st.History == nil {
+				st.History = map[string][]SpecEdit{}
+			}
+			st.History[lc.l.Name] = edits
+		}
+		if zones := lc.zoneCounts(); zones != nil {
+			if st.ZoneNodes == nil {
+				st.ZoneNodes = map[string]map[string]int{}
+			}
+			st.ZoneNodes[lc.l.Name] = zones
+		}
+		if lc.DryRun() {
+			if st.DryRunNodes == nil {
+				st.DryRunNodes = map[string]int{}
+			}
+			st.DryRunNodes[lc.l.Name] = lc.dryRunNodes()
+		}
+		if lc.maxBlastRadius() > 0 {
+			if n, ok := lc.blastRadius(); ok {
+				if st.BlastRadius == nil {
+					st.BlastRadius = map[string]int{}
+				}
+				st.BlastRadius[lc.l.Name] = n
+			}
+		}
+		if cond := lc.noMatchesCondition(); cond != nil {
+			st.Conditions = append(st.Conditions, *cond)
+		}
+		if cond := lc.unknownSelectorKeysCondition(); cond != nil {
+			st.Conditions = append(st.Conditions, *cond)
+		}
+		if cond := lc.conflictCondition(); cond != nil {
+			st.Conditions = append(st.Conditions, *cond)
+		}
+		if cond := lc.blockedTaintsCondition(); cond != nil {
+			st.Conditions = append(st.Conditions, *cond)
+		}
+		if cond := lc.deferredTaintsCondition(); cond != nil {
+			st.Conditions = append(st.Conditions, *cond)
+		}
+		if cond := lc.valueMismatchesCondition(); cond != nil {
+			st.Conditions = append(st.Conditions, *cond)
+		}
+		if cond := lc.awaitingApplyCondition(); cond != nil {
+			st.Conditions = append(st.Conditions, *cond)
+		}
+		if cond := lc.taintEscalationCondition(); cond != nil {
+			st.Conditions = append(st.Conditions, *cond)
+		}
+		if cond := lc.blastRadiusCondition(); cond != nil {
+			st.Conditions = append(st.Conditions, *cond)
+		}
+	}
+
+	st.Conditions = append(st.Conditions, c.dependencyConditions(lcs)...)
+
+	var invalid []Condition
+	c.invalid.Range(func(_, v interface{}) bool {
+		invalid = append(invalid, v.(Condition))
+		return true
+	})
+	sort.Slice(invalid, func(i, j int) bool { return invalid[i].Labeler < invalid[j].Labeler })
+	st.Conditions = append(st.Conditions, invalid...)
+	if cond := c.killSwitchCondition(); cond != nil {
+		st.Conditions = append(st.Conditions, *cond)
+	}
+	if cond := c.frozenCondition(); cond != nil {
+		st.Conditions = append(st.Conditions, *cond)
+	}
+	if cond := c.degradedCondition(); cond != nil {
+		st.Conditions = append(st.Conditions, *cond)
+	}
+	if cond := c.stopped.condition(); cond != nil {
+		st.Conditions = append(st.Conditions, *cond)
+	}
+	st.RetryPolicies = c.cfg.RetryPolicies
+	st.Leader = c.leader()
+	if c.zones != nil {
+		st.ZoneDisruptions = c.zones.inFlight(time.Now())
+	}
+	if c.breaker != nil {
+		if open, since := c.breaker.isOpen(); open {
+			since = since.UTC()
+			st.Degraded = true
+			st.DegradedSince = &since
+		}
+	}
+
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	if c.lastErr != nil {
+		t := c.lastErrTime
+		st.LastError = c.lastErr.Error()
+		st.LastErrorTime = &t
+	}
+	return st
+}
+
+// recordError keeps the last node sync error for the status.
+func (c *Labeler) recordError(err error) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	c.lastErr = err
+	c.lastErrTime = time.Now().UTC()
+}
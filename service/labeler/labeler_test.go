@@ -0,0 +1,124 @@
+package labeler
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	kooperlog "github.com/spotahome/kooper/log"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+func TestOnUpdateIgnoresManagedAnnotations(t *testing.T) {
+	cfg := Config{}.withDefaults()
+	tests := []struct {
+		name      string
+		requeue   bool
+		change    func(n *corev1.Node)
+		expQueued bool
+	}{
+		{
+			name:   "A change of the owner annotation is not synced.",
+			change: func(n *corev1.Node) { n.Annotations[cfg.OwnerAnnotation] = `{"l":["a"]}` },
+		},
+		{
+			name:   "A change of an annotation under the managed prefix is not synced.",
+			change: func(n *corev1.Node) { n.Annotations[cfg.ContentHashAnnotation] = "abc" },
+		},
+		{
+			name:      "A change of the canary annotation, a user input, is synced.",
+			change:    func(n *corev1.Node) { n.Annotations[cfg.CanaryAnnotation] = "true" },
+			expQueued: true,
+		},
+		{
+			name:      "A change of another annotation is synced.",
+			change:    func(n *corev1.Node) { n.Annotations["team"] = "ops" },
+			expQueued: true,
+		},
+		{
+			name: "A change of a label along the managed annotations is synced.",
+			change: func(n *corev1.Node) {
+				n.Annotations[cfg.OwnerAnnotation] = `{"l":["a"]}`
+				n.Labels["a"] = "1"
+			},
+			expQueued: true,
+		},
+		{
+			name:      "With --requeue-on-managed-annotations the managed annotations are synced.",
+			requeue:   true,
+			change:    func(n *corev1.Node) { n.Annotations[cfg.OwnerAnnotation] = `{"l":["a"]}` },
+			expQueued: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &Labeler{
+				cfg:          Config{RequeueOnManagedAnnotations: test.requeue}.withDefaults(),
+				logger:       kooperlog.Dummy,
+				queue:        newTrackedQueue("managed"),
+				nodeInformer: cache.NewSharedIndexInformer(&cache.ListWatch{}, &corev1.Node{}, 0, cache.Indexers{}),
+			}
+			old := testNode("n1", map[string]string{"pool": "a"})
+			old.Annotations = map[string]string{}
+			old.ResourceVersion = "1"
+			new := old.DeepCopy()
+			new.ResourceVersion = "2"
+			test.change(new)
+
+			c.onUpdate(old, new)
+			if queued := c.queue.Len() == 1; queued != test.expQueued {
+				t.Errorf("expected the node queued %t, got %t", test.expQueued, queued)
+			}
+		})
+	}
+}
+
+func TestManagedAnnotationsDontLoop(t *testing.T) {
+	// The node has the labels, the sync only writes the managed content hash.
+	s := newNodeServer(testNode("n1", map[string]string{"pool": "a", "checked": "true"}))
+	l := poolLabeler("checked", "a", labelerv1alpha1.LabelerSpec{Merge: mergeSpec(map[string]string{"checked": "true"})})
+	c, stop := newSyncedLabeler(t, s, Config{ContentHash: true}, l)
+	defer stop()
+
+	syncs := 0
+	for ; c.queue.Len() > 0 && syncs < 5; syncs++ {
+		old := cachedNode(c.informer().GetStore(), "n1")
+		c.processNextNode()
+		// The informer gets the patched node as a watch event.
+		if patched := s.node("n1"); patched.ResourceVersion != old.ResourceVersion {
+			c.informer().GetStore().Update(patched)
+			c.onUpdate(old, patched)
+		}
+	}
+	if syncs != 1 {
+		t.Errorf("expected a single sync, got %d", syncs)
+	}
+	if n := s.patchCount(); n != 1 {
+		t.Errorf("expected the content hash patched once, got %d patches", n)
+	}
+	if h := s.node("n1").Annotations[c.cfg.ContentHashAnnotation]; h == "" {
+		t.Errorf("expected the content hash annotation written")
+	}
+}
+
+func TestInvalidSpecChangeKeepsRunningLabeler(t *testing.T) {
+	s := newNodeServer(testNode("n1", map[string]string{"pool": "a"}))
+	l := poolLabeler("gpu", "a", labelerv1alpha1.LabelerSpec{Merge: mergeSpec(map[string]string{"team": "ml"})})
+	c, stop := newSyncedLabeler(t, s, Config{}, l)
+	defer stop()
+	running, _ := c.reg.Load("gpu")
+
+	// The pod resource sum can't run without --watch-pods.
+	changed := l.DeepCopy()
+	changed.Generation = 2
+	changed.Spec.ValueFrom = []labelerv1alpha1.ValueFromSpec{{Label: "cpu-tier", Type: PodResourceSumType, Params: map[string]string{"resource": "cpu"}}}
+	if err := c.EnsureLabeler(changed); err == nil {
+		t.Fatalf("expected an error without the pods watched")
+	}
+	if lc, ok := c.reg.Load("gpu"); !ok || lc != running {
+		t.Errorf("expected the running label controller kept, got %v", lc)
+	}
+}
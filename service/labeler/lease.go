@@ -0,0 +1,360 @@
+package labeler
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// leaseRecordKey is the leader lease ConfigMap data key with the lease record.
+	leaseRecordKey = "leader"
+
+	defaultLeaseDuration = 15 * time.Second
+)
+
+// LeaseCallTimeout returns the timeout of the leader lease calls for the lease
+// duration. The two calls of a renewal started before the renew deadline are done
+// before the lease expires.
+func LeaseCallTimeout(leaseDuration time.Duration) time.Duration {
+	return leaseDuration / 6
+}
+
+// leaseRecord is the leader lease, like the client-go leader election record.
+type leaseRecord struct {
+	HolderIdentity       string    `json:"holderIdentity"`
+	LeaseDurationSeconds int       `json:"leaseDurationSeconds"`
+	AcquireTime          time.Time `json:"acquireTime"`
+	RenewTime            time.Time `json:"renewTime"`
+	LeaderTransitions    int       `json:"leaderTransitions"`
+}
+
+// leaderLease is the lease of the operator instances on the leader lease ConfigMap,
+// only its holder patches the nodes.
+type leaderLease struct {
+	// gate is held for reading by the syncs patching the nodes while leading, stepping
+	// down takes it so the syncs in flight are done first.
+	gate    sync.RWMutex
+	leading bool
+
+	mu sync.Mutex
+	// observed is the last record read and when, the expiry of the other holders is
+	// from the local clock so the clock skew doesn't matter.
+	observed     leaseRecord
+	observedTime time.Time
+	// renewed is the last renewal of the lease held.
+	renewed time.Time
+	// since is since when the lease is waited for, synced when the caches synced.
+	since  time.Time
+	synced time.Time
+	// stopped is set once stepped down for good, the lease is not acquired again.
+	stopped  bool
+	leadingC chan struct{}
+	// holder is the last holder logged, leader the last one that wasn't empty so the
+	// releases before a handoff are not transitions.
+	holder string
+	leader string
+}
+
+// hold returns true if the operator instance holds the lease, or there is no lease. A
+// true hold needs a done once the node is patched.
+func (l *leaderLease) hold() bool {
+	if l == nil {
+		return true
+	}
+	l.gate.RLock()
+	if !l.leading {
+		l.gate.RUnlock()
+		return false
+	}
+	return true
+}
+
+// done ends a hold.
+func (l *leaderLease) done() {
+	if l != nil {
+		l.gate.RUnlock()
+	}
+}
+
+// setLeading starts or stops the node mutations, stopping waits for the patches in
+// flight. It returns true if it changed.
+func (l *leaderLease) setLeading(leading bool) bool {
+	l.gate.Lock()
+	defer l.gate.Unlock()
+	changed := l.leading != leading
+	l.leading = leading
+	return changed
+}
+
+// leaseDuration returns the lease duration of the record, at least a second.
+func (r leaseRecord) leaseDuration() time.Duration {
+	if r.LeaseDurationSeconds < 1 {
+		return time.Second
+	}
+	return time.Duration(r.LeaseDurationSeconds) * time.Second
+}
+
+// leaseName returns the namespace/name of the leader lease ConfigMap.
+func (c *Labeler) leaseName() string {
+	return c.cfg.LeaseConfigMapNamespace + "/" + c.cfg.LeaseConfigMapName
+}
+
+// leaseClient returns the client of the leader lease calls.
+func (c *Labeler) leaseClient() kubernetes.Interface {
+	if c.cfg.LeaseClient != nil {
+		return c.cfg.LeaseClient
+	}
+	return c.k8sCli
+}
+
+// runLease acquires and renews the leader lease until stopped, every fifth of the lease
+// duration. Failing to renew it for two thirds of the duration, or a lease call timing
+// out, stops the node mutations before the others can take it over.
+func (c *Labeler) runLease(stopC <-chan struct{}) {
+	retry := c.cfg.LeaseDuration / 5
+	deadline := c.cfg.LeaseDuration * 2 / 3
+	ticker := time.NewTicker(retry)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		held, err := c.tryLease(now)
+		if err != nil {
+			c.logger.Warningf("could not get or renew the leader lease %s: %s", c.leaseName(), err)
+		}
+		timedOut := err != nil && errorClass(err) == ErrorClassTimeout
+
+		l := c.lease
+		l.mu.Lock()
+		if l.stopped {
+			l.mu.Unlock()
+			return
+		}
+		if held {
+			l.renewed = now
+		}
+		acquired := false
+		switch {
+		case held && l.setLeading(true):
+			acquired = true
+			c.logLeading(now)
+			close(l.leadingC)
+		case !held && (timedOut || now.Sub(l.renewed) > deadline) && l.setLeading(false):
+			lost := time.Now()
+			c.logger.Warningf("lost the leader lease %s at %s, not renewed for %s, held by %q: node mutations stopped", c.leaseName(), lost.UTC().Format(time.RFC3339), lost.Sub(l.renewed).Round(time.Millisecond), l.observed.HolderIdentity)
+			l.since, l.leadingC = lost, make(chan struct{})
+		}
+		c.recordLeader(l)
+		l.mu.Unlock()
+		if acquired {
+			// The syncs waiting for the lease didn't patch, they are due again.
+			c.enqueueAll()
+		}
+
+		select {
+		case <-stopC:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tryLease acquires or renews the leader lease, it returns true if the operator instance
+// holds it. The lease is taken over when released or when the holder hasn't renewed it
+// for its duration.
+func (c *Labeler) tryLease(now time.Time) (bool, error) {
+	l := c.lease
+	cms := c.leaseClient().CoreV1().ConfigMaps(c.cfg.LeaseConfigMapNamespace)
+	rec := leaseRecord{
+		HolderIdentity:       c.cfg.LeaseIdentity,
+		LeaseDurationSeconds: int(c.cfg.LeaseDuration / time.Second),
+		AcquireTime:          now,
+		RenewTime:            now,
+	}
+
+	cm, err := cms.Get(c.cfg.LeaseConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		b, _ := json.Marshal(rec)
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: c.cfg.LeaseConfigMapName, Namespace: c.cfg.LeaseConfigMapNamespace},
+			Data:       map[string]string{leaseRecordKey: string(b)},
+		}
+		if _, err := cms.Create(cm); err != nil {
+			return false, err
+		}
+		c.observeLease(rec, now)
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// A broken record is taken over like a released one.
+	var old leaseRecord
+	json.Unmarshal([]byte(cm.Data[leaseRecordKey]), &old)
+	l.mu.Lock()
+	if old != l.observed {
+		l.observed, l.observedTime = old, now
+	}
+	expiry := l.observedTime.Add(old.leaseDuration())
+	l.mu.Unlock()
+	if old.HolderIdentity != "" && old.HolderIdentity != rec.HolderIdentity && now.Before(expiry) {
+		return false, nil
+	}
+
+	rec.LeaderTransitions = old.LeaderTransitions
+	if old.HolderIdentity == rec.HolderIdentity {
+		rec.AcquireTime = old.AcquireTime
+	} else {
+		rec.LeaderTransitions++
+	}
+	b, _ := json.Marshal(rec)
+	cm = cm.DeepCopy()
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[leaseRecordKey] = string(b)
+	// The update fails on conflict if another instance got the lease meanwhile.
+	if _, err := cms.Update(cm); err != nil {
+		return false, err
+	}
+	c.observeLease(rec, now)
+	return true, nil
+}
+
+// recordLeader records the leader metrics and logs the changes of the other holders,
+// with the lease mutex held. A holder replacing the previous one is a transition.
+func (c *Labeler) recordLeader(l *leaderLease) {
+	leading := l.hold()
+	if leading {
+		l.done()
+	}
+	holder := l.observed.HolderIdentity
+	c.cfg.MetricsRecorder.SetLeader(leading, holder)
+	if holder != l.holder && holder != c.cfg.LeaseIdentity && holder != "" {
+		c.logger.Infof("leader lease %s held by %q since %s", c.leaseName(), holder, l.observedTime.UTC().Format(time.RFC3339))
+	}
+	if holder != "" {
+		if l.leader != "" && holder != l.leader {
+			c.cfg.MetricsRecorder.IncLeaderTransitions()
+		}
+		l.leader = holder
+	}
+	l.holder = holder
+}
+
+// observeLease records the lease record written.
+func (c *Labeler) observeLease(rec leaseRecord, now time.Time) {
+	c.lease.mu.Lock()
+	defer c.lease.mu.Unlock()
+	c.lease.observed, c.lease.observedTime = rec, now
+}
+
+// logLeading logs the handoff timing once the lease is acquired: how long it was
+// waited for, and for how long the prewarmed caches were ready.
+func (c *Labeler) logLeading(now time.Time) {
+	l := c.lease
+	at := now.UTC().Format(time.RFC3339)
+	switch {
+	case !c.cfg.Prewarm:
+		c.logger.Infof("acquired the leader lease %s at %s after waiting %s, starting the informers", c.leaseName(), at, now.Sub(l.since).Round(time.Millisecond))
+		return
+	case l.synced.IsZero():
+		c.logger.Infof("acquired the leader lease %s at %s after waiting %s, starting the node mutations once the caches are synced", c.leaseName(), at, now.Sub(l.since).Round(time.Millisecond))
+		return
+	}
+	c.logger.Infof("acquired the leader lease %s at %s after waiting %s with the caches synced for %s, starting the node mutations", c.leaseName(), at, now.Sub(l.since).Round(time.Millisecond), now.Sub(l.synced).Round(time.Millisecond))
+}
+
+// leader returns the last holder of the leader lease observed, empty without lease.
+func (c *Labeler) leader() string {
+	if c.lease == nil {
+		return ""
+	}
+	c.lease.mu.Lock()
+	defer c.lease.mu.Unlock()
+	return c.lease.observed.HolderIdentity
+}
+
+// Leading returns true if the operator instance holds the leader lease, or there is
+// no lease.
+func (c *Labeler) Leading() bool {
+	if !c.lease.hold() {
+		return false
+	}
+	c.lease.done()
+	return true
+}
+
+// waitLease blocks until the lease is acquired, it returns false if stopped first.
+func (c *Labeler) waitLease(stopC <-chan struct{}) bool {
+	c.lease.mu.Lock()
+	leadingC := c.lease.leadingC
+	c.lease.mu.Unlock()
+	select {
+	case <-leadingC:
+		return true
+	case <-stopC:
+		return false
+	}
+}
+
+// leaseSynced records that the caches are synced, a prewarmed standby is ready to take
+// over.
+func (c *Labeler) leaseSynced() {
+	if c.lease == nil {
+		return
+	}
+	c.lease.mu.Lock()
+	c.lease.synced = time.Now()
+	c.lease.mu.Unlock()
+	if !c.lease.hold() {
+		c.logger.Infof("caches synced, waiting for the leader lease %s to start the node mutations", c.leaseName())
+		return
+	}
+	c.lease.done()
+}
+
+// StepDown stops the node mutations for good once the patches in flight are done, and
+// releases the leader lease if held so the next instance takes over right away.
+// Without lease it does nothing.
+func (c *Labeler) StepDown() {
+	if c.lease == nil {
+		return
+	}
+	start := time.Now()
+	c.lease.mu.Lock()
+	c.lease.stopped = true
+	c.lease.mu.Unlock()
+	if !c.lease.setLeading(false) {
+		return
+	}
+	stopped := time.Since(start)
+	c.cfg.MetricsRecorder.SetLeader(false, "")
+
+	cms := c.leaseClient().CoreV1().ConfigMaps(c.cfg.LeaseConfigMapNamespace)
+	cm, err := cms.Get(c.cfg.LeaseConfigMapName, metav1.GetOptions{})
+	if err == nil {
+		var rec leaseRecord
+		json.Unmarshal([]byte(cm.Data[leaseRecordKey]), &rec)
+		if rec.HolderIdentity != c.cfg.LeaseIdentity {
+			c.logger.Warningf("leader lease %s held by %q, node mutations stopped in %s", c.leaseName(), rec.HolderIdentity, stopped.Round(time.Millisecond))
+			return
+		}
+		rec.HolderIdentity, rec.LeaseDurationSeconds, rec.RenewTime = "", 1, time.Now()
+		b, _ := json.Marshal(rec)
+		cm = cm.DeepCopy()
+		cm.Data[leaseRecordKey] = string(b)
+		_, err = cms.Update(cm)
+	}
+	if err != nil {
+		c.logger.Warningf("node mutations stopped in %s, could not release the leader lease %s, it expires in %s: %s", stopped.Round(time.Millisecond), c.leaseName(), c.cfg.LeaseDuration, err)
+		return
+	}
+	c.logger.Infof("stepped down at %s: node mutations stopped in %s, leader lease %s released in %s", start.UTC().Format(time.RFC3339), stopped.Round(time.Millisecond), c.leaseName(), time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,107 @@
+package labeler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	kooperlog "github.com/spotahome/kooper/log"
+
+	"github.com/joshisa/resource-labeler-operator/metrics"
+)
+
+func TestRunLeaseStepsDownOnTimeout(t *testing.T) {
+	// The API server hangs on the lease calls.
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(time.Minute):
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	leaseDuration := 6 * time.Second
+	cli, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL, Timeout: LeaseCallTimeout(leaseDuration)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Labeler{
+		cfg: Config{
+			LeaseConfigMapNamespace: "ns",
+			LeaseConfigMapName:      "lease",
+			LeaseIdentity:           "me",
+			LeaseDuration:           leaseDuration,
+			LeaseClient:             cli,
+		}.withDefaults(),
+		logger: kooperlog.Dummy,
+		lease:  &leaderLease{leading: true, renewed: time.Now(), leadingC: make(chan struct{})},
+	}
+
+	stopC := make(chan struct{})
+	defer close(stopC)
+	go c.runLease(stopC)
+
+	// The renew deadline is 4s, the call times out in 1s.
+	deadline := time.Now().Add(3 * time.Second)
+	for c.Leading() {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the node mutations stopped when the lease call timed out")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// leaderRecorder records the leader metrics.
+type leaderRecorder struct {
+	metrics.Recorder
+	leading     bool
+	holder      string
+	transitions int
+}
+
+func (r *leaderRecorder) SetLeader(leading bool, holder string) {
+	r.leading, r.holder = leading, holder
+}
+
+func (r *leaderRecorder) IncLeaderTransitions() { r.transitions++ }
+
+func TestRecordLeaderTransitions(t *testing.T) {
+	tests := []struct {
+		name           string
+		holders        []string
+		expTransitions int
+	}{
+		{name: "The first holder observed is not a transition.", holders: []string{"other"}},
+		{name: "A renewed lease is not a transition.", holders: []string{"me", "me", "me"}},
+		{name: "Every holder change is a transition.", holders: []string{"other", "me", "other"}, expTransitions: 2},
+		{name: "A released lease taken over is a single transition.", holders: []string{"me", "", "other"}, expTransitions: 1},
+		{name: "A released lease taken back is not a transition.", holders: []string{"me", "", "me"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := &leaderRecorder{Recorder: metrics.Dummy}
+			c := &Labeler{
+				cfg:    Config{LeaseIdentity: "me", MetricsRecorder: recorder},
+				logger: kooperlog.Dummy,
+				lease:  &leaderLease{},
+			}
+			for _, holder := range test.holders {
+				c.lease.observed.HolderIdentity = holder
+				c.recordLeader(c.lease)
+			}
+			if recorder.transitions != test.expTransitions {
+				t.Errorf("expected %d transitions, got %d", test.expTransitions, recorder.transitions)
+			}
+			if last := test.holders[len(test.holders)-1]; recorder.holder != last {
+				t.Errorf("expected the holder %q, got %q", last, recorder.holder)
+			}
+		})
+	}
+}
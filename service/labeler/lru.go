@@ -0,0 +1,89 @@
+package labeler
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/joshisa/resource-labeler-operator/metrics"
+)
+
+const defaultStateCacheSize = 10000
+
+// Per node state caches.
+const (
+	stateCacheContentHash = "content-hash"
+	stateCacheCanary      = "canary"
+)
+
+// stateCache is a bounded LRU cache of per node state so the memory doesn't grow with
+// the nodes of the cluster. Evicted entries are recomputed by their users, the cache is
+// never required for correctness.
+type stateCache struct {
+	name    string
+	size    int
+	metrics metrics.Recorder
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type stateEntry struct {
+	key   string
+	value interface{}
+}
+
+func newStateCache(name string, size int, metricsRecorder metrics.Recorder) *stateCache {
+	return &stateCache{
+		name:    name,
+		size:    size,
+		metrics: metricsRecorder,
+		ll:      list.New(),
+		items:   map[string]*list.Element{},
+	}
+}
+
+// get returns the value of the key and marks it as recently used.
+func (s *stateCache) get(key string) (interface{}, bool) {
+	s.mu.Lock()
+	e, ok := s.items[key]
+	if ok {
+		s.ll.MoveToFront(e)
+	}
+	s.mu.Unlock()
+
+	s.metrics.ObserveStateCache(s.name, ok)
+	if !ok {
+		return nil, false
+	}
+	return e.Value.(*stateEntry).value, true
+}
+
+// add sets the value of the key, evicting the least recently used entry if the cache
+// is full.
+func (s *stateCache) add(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[key]; ok {
+		s.ll.MoveToFront(e)
+		e.Value.(*stateEntry).value = value
+		return
+	}
+
+	s.items[key] = s.ll.PushFront(&stateEntry{key: key, value: value})
+	if s.ll.Len() > s.size {
+		oldest := s.ll.Back()
+		s.ll.Remove(oldest)
+		delete(s.items, oldest.Value.(*stateEntry).key)
+	}
+}
+
+// remove deletes the key from the cache.
+func (s *stateCache) remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[key]; ok {
+		s.ll.Remove(e)
+		delete(s.items, key)
+	}
+}
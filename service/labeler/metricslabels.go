@@ -0,0 +1,54 @@
+package labeler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+const defaultMetricsLabelsLimit = 50
+
+// metricsLabelSet returns the values of the metrics labels as a comparable set.
+func (c *Labeler) metricsLabelSet(labels map[string]string) string {
+	values := make([]string, 0, len(c.cfg.MetricsLabels))
+	for _, name := range c.cfg.MetricsLabels {
+		values = append(values, labels[name])
+	}
+	return strings.Join(values, "\x00")
+}
+
+// validateMetricsLabels returns an error if the labeler metricsLabels are not the
+// allowed ones, or if their values would take the distinct label sets of the running
+// labelers past the limit: every set is a new series of each per labeler metric.
+func (c *Labeler) validateMetricsLabels(l *labelerv1alpha1.Labeler) error {
+	if len(l.Spec.MetricsLabels) == 0 {
+		return nil
+	}
+	allowed := map[string]bool{}
+	for _, name := range c.cfg.MetricsLabels {
+		allowed[name] = true
+	}
+	var unknown []string
+	for name := range l.Spec.MetricsLabels {
+		if !allowed[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("metricsLabels %s are not allowed, the operator --labeler-metrics-labels are %v", strings.Join(unknown, ", "), c.cfg.MetricsLabels)
+	}
+
+	sets := map[string]bool{c.metricsLabelSet(l.Spec.MetricsLabels): true}
+	for _, lc := range c.controllers() {
+		if lc.l.Name != l.Name {
+			sets[c.metricsLabelSet(lc.l.Spec.MetricsLabels)] = true
+		}
+	}
+	if len(sets) > c.cfg.MetricsLabelsLimit {
+		return fmt.Errorf("metricsLabels would make %d distinct label sets, over the --labeler-metrics-labels-limit %d", len(sets), c.cfg.MetricsLabelsLimit)
+	}
+	return nil
+}
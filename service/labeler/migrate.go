@@ -0,0 +1,104 @@
+package labeler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// Migration moves the values of a label key of a legacy tool to a new key.
+type Migration struct {
+	// From is the legacy label key, removed from the nodes.
+	From string `json:"from"`
+	// To is the new label key.
+	To string `json:"to"`
+	// Values maps the legacy values to the new ones, the unmapped values are kept.
+	Values map[string]string `json:"values,omitempty"`
+	// Transform is applied to the (mapped) value.
+	Transform *labelerv1alpha1.ValueTransform `json:"transform,omitempty"`
+}
+
+// ValidateMigrations returns an error if a migration is not valid or two of them
+// migrate the same key.
+func ValidateMigrations(migrations []Migration) error {
+	seen := map[string]bool{}
+	for _, m := range migrations {
+		for _, k := range []string{m.From, m.To} {
+			if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+				return fmt.Errorf("migration key %q is not valid: %s", k, strings.Join(errs, ", "))
+			}
+		}
+		if m.From == m.To {
+			return fmt.Errorf("migration of %s to itself", m.From)
+		}
+		if seen[m.From] || seen[m.To] {
+			return fmt.Errorf("migration of %s to %s: the keys are already migrated", m.From, m.To)
+		}
+		seen[m.From], seen[m.To] = true, true
+		if err := validateValueTransform(m.Transform); err != nil {
+			return fmt.Errorf("migration of %s: %s", m.From, err)
+		}
+	}
+	return nil
+}
+
+// MigrateNode returns the node with the legacy keys moved to their new keys, owned by
+// the labeler so its reconciles manage them, and why the keys that can't be migrated
+// are skipped: a new key already set to another value or an invalid new value.
+func MigrateNode(node *corev1.Node, migrations []Migration, ownerAnnotation, owner string) (*corev1.Node, []string) {
+	dst := node.DeepCopy()
+	set := map[string]bool{}
+	for _, k := range ownedKeys(node, ownerAnnotation)[owner] {
+		set[k] = true
+	}
+	var skipped []string
+	migrated := false
+	for _, m := range migrations {
+		v, ok := node.Labels[m.From]
+		if !ok {
+			continue
+		}
+		if mapped, ok := m.Values[v]; ok {
+			v = mapped
+		}
+		v = transformValue(v, m.Transform)
+		if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+			skipped = append(skipped, fmt.Sprintf("%s: the migrated value %q is not valid: %s", m.From, v, strings.Join(errs, ", ")))
+			continue
+		}
+		if current, ok := node.Labels[m.To]; ok && current != v {
+			skipped = append(skipped, fmt.Sprintf("%s: %s is already set to %q, not %q", m.From, m.To, current, v))
+			continue
+		}
+		delete(dst.Labels, m.From)
+		dst.Labels[m.To] = v
+		set[labelsPrefix+m.To] = true
+		migrated = true
+	}
+	if !migrated {
+		return node, skipped
+	}
+
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	setOwnedKeys(dst, ownerAnnotation, owner, keys)
+	return dst, skipped
+}
+
+// NodeMergePatch returns the merge patch from the node to dst, conditional on the
+// resource version of the node. It's empty if there is nothing to patch.
+func NodeMergePatch(node, dst *corev1.Node) ([]byte, error) {
+	patch, err := nodePatch(node, dst)
+	if err != nil || len(patch) == 0 {
+		return nil, err
+	}
+	return mergePatch(patch, node.ResourceVersion)
+}
@@ -0,0 +1,89 @@
+package labeler
+
+import (
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Mutation operations.
+const (
+	MutationOperationUpdate = "update"
+	MutationOperationRemove = "remove"
+)
+
+// Mutation is a change made by a labeler on a node.
+type Mutation struct {
+	Time      time.Time `json:"time"`
+	Node      string    `json:"node"`
+	Rule      string    `json:"rule"`
+	Operation string    `json:"operation"`
+	// Keys are the changed attributes, prefixed by their kind (labels/, annotations/, taints/).
+	Keys []string `json:"keys"`
+	// Overwrites are the values the labeler replaced without owning them.
+	Overwrites []Overwrite `json:"overwrites,omitempty"`
+	// DryRun mutations are planned by dry run labelers, they are not applied.
+	DryRun bool `json:"dryRun,omitempty"`
+	// RequestID is the request ID of the node sync, in its log lines.
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// MutationRecorder is notified of the node mutations.
+type MutationRecorder interface {
+	RecordMutation(m Mutation)
+}
+
+// MutationRecorderFunc is a helper to use a function as a MutationRecorder.
+type MutationRecorderFunc func(m Mutation)
+
+// RecordMutation satisfies MutationRecorder interface.
+func (f MutationRecorderFunc) RecordMutation(m Mutation) {
+	f(m)
+}
+
+// dummyRecorder is a recorder that doesn't do anything.
+var dummyRecorder = MutationRecorderFunc(func(Mutation) {})
+
+// changedKeys returns the attributes that differ between the old and the new node.
+func changedKeys(old, new *corev1.Node) []string {
+	keys := changedMapKeys(labelsPrefix, old.Labels, new.Labels)
+	keys = append(keys, changedMapKeys(annotationsPrefix, old.Annotations, new.Annotations)...)
+
+	oldTaints := map[string]corev1.Taint{}
+	for _, t := range old.Spec.Taints {
+		oldTaints[taintKey(t)] = t
+	}
+	newTaints := map[string]corev1.Taint{}
+	for _, t := range new.Spec.Taints {
+		newTaints[taintKey(t)] = t
+	}
+	for k, t := range newTaints {
+		if ot, ok := oldTaints[k]; !ok || ot.Value != t.Value {
+			keys = append(keys, taintsPrefix+k)
+		}
+	}
+	for k := range oldTaints {
+		if _, ok := newTaints[k]; !ok {
+			keys = append(keys, taintsPrefix+k)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func changedMapKeys(prefix string, old, new map[string]string) []string {
+	var keys []string
+	for k, v := range new {
+		if ov, ok := old[k]; !ok || ov != v {
+			keys = append(keys, prefix+k)
+		}
+	}
+	for k := range old {
+		if _, ok := new[k]; !ok {
+			keys = append(keys, prefix+k)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,53 @@
+package labeler
+
+import (
+	"sync"
+)
+
+// MutationHistory keeps the last mutations in a ring buffer, the memory is bounded by
+// its size. It's in memory only, it's lost on restarts.
+type MutationHistory struct {
+	mu   sync.Mutex
+	ring []Mutation
+	// next is where the next mutation is recorded, full once it wrapped around.
+	next int
+	full bool
+}
+
+// NewMutationHistory returns a mutation history of the last size mutations.
+func NewMutationHistory(size int) *MutationHistory {
+	return &MutationHistory{ring: make([]Mutation, size)}
+}
+
+// RecordMutation satisfies MutationRecorder interface.
+func (h *MutationHistory) RecordMutation(m Mutation) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.ring) == 0 {
+		return
+	}
+	h.ring[h.next] = m
+	h.next++
+	if h.next == len(h.ring) {
+		h.next, h.full = 0, true
+	}
+}
+
+// Mutations returns the recorded mutations of the node, of all the nodes if empty,
+// the oldest first.
+func (h *MutationHistory) Mutations(node string) []Mutation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ordered := h.ring[:h.next]
+	if h.full {
+		ordered = append(append([]Mutation{}, h.ring[h.next:]...), h.ring[:h.next]...)
+	}
+
+	res := []Mutation{}
+	for _, m := range ordered {
+		if node == "" || m.Node == node {
+			res = append(res, m)
+		}
+	}
+	return res
+}
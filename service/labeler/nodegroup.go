@@ -0,0 +1,101 @@
+package labeler
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// NodeGroupLabel is the node label a provider sets with the node group (or node pool,
+// agent pool) of the node.
+type NodeGroupLabel struct {
+	Provider string
+	Key      string
+}
+
+var (
+	// nodeGroupLabels are checked in order, the first one the node has is its group.
+	nodeGroupLabels = []NodeGroupLabel{
+		{Provider: "eks", Key: "eks.amazonaws.com/nodegroup"},
+		{Provider: "gke", Key: "cloud.google.com/gke-nodepool"},
+		{Provider: "aks", Key: "kubernetes.azure.com/agentpool"},
+		{Provider: "aks", Key: "agentpool"},
+	}
+	nodeGroupLabelsMu sync.RWMutex
+)
+
+// RegisterNodeGroupLabel adds a provider node group label, checked after the already
+// registered ones.
+func RegisterNodeGroupLabel(provider, key string) error {
+	if provider == "" {
+		return fmt.Errorf("node group label %q needs a provider", key)
+	}
+	if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+		return fmt.Errorf("node group label key %q is not valid: %s", key, strings.Join(errs, ", "))
+	}
+	nodeGroupLabelsMu.Lock()
+	defer nodeGroupLabelsMu.Unlock()
+	nodeGroupLabels = append(nodeGroupLabels, NodeGroupLabel{Provider: provider, Key: key})
+	return nil
+}
+
+// NodeGroupLabels returns the registered node group labels in order.
+func NodeGroupLabels() []NodeGroupLabel {
+	nodeGroupLabelsMu.RLock()
+	defer nodeGroupLabelsMu.RUnlock()
+	ngls := make([]NodeGroupLabel, len(nodeGroupLabels))
+	copy(ngls, nodeGroupLabels)
+	return ngls
+}
+
+// NodeGroup returns the node group of the node from the first node group label it has
+// of the providers, all of them if no providers are given. It returns false if the node
+// has none.
+func NodeGroup(node *corev1.Node, providers ...string) (string, bool) {
+	for _, ngl := range NodeGroupLabels() {
+		if len(providers) > 0 && !contains(providers, ngl.Provider) {
+			continue
+		}
+		if v, ok := node.Labels[ngl.Key]; ok && v != "" {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// NodeMatchesNodeGroups returns true if the node group of the node is one of the
+// groups, no groups are always met.
+func NodeMatchesNodeGroups(node *corev1.Node, groups []string) bool {
+	if len(groups) == 0 {
+		return true
+	}
+	group, ok := NodeGroup(node)
+	return ok && contains(groups, group)
+}
+
+// newNodeGroupSource resolves the node group of the node, only from the node group
+// labels of the comma separated "providers" if set.
+func newNodeGroupSource(params map[string]string) (ValueSource, error) {
+	var providers []string
+	if params["providers"] != "" {
+		for _, p := range strings.Split(params["providers"], ",") {
+			providers = append(providers, strings.TrimSpace(p))
+		}
+	}
+	return ValueSourceFunc(func(node *corev1.Node) (string, bool, error) {
+		v, ok := NodeGroup(node, providers...)
+		return v, ok, nil
+	}), nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,255 @@
+package labeler
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// NodeLeaseType is the value source type that needs the node leases.
+	NodeLeaseType = "nodeLease"
+
+	// nodeLeaseNamespace has the kubelet heartbeat leases, named like their node.
+	nodeLeaseNamespace = "kube-node-lease"
+	// nodeLeasePollInterval is how often the node leases are listed.
+	nodeLeasePollInterval = 10 * time.Second
+)
+
+// nodeLeasePaths are the API paths of the node leases, by preference. The vendored
+// client has no coordination API, the leases are listed raw.
+var nodeLeasePaths = []string{
+	"/apis/coordination.k8s.io/v1/namespaces/" + nodeLeaseNamespace + "/leases",
+	"/apis/coordination.k8s.io/v1beta1/namespaces/" + nodeLeaseNamespace + "/leases",
+}
+
+// LeaseStore is where the label controllers get the renewal time of the node leases
+// from.
+type LeaseStore interface {
+	// NodeLeaseRenewTime returns the last renewal of the node lease, false if unknown.
+	NodeLeaseRenewTime(nodeName string) (time.Time, bool)
+}
+
+// LeaseValueSource is a value source that resolves the value from the node lease
+// renewal time. Its Resolve is used when the leases are not available (e.g. offline
+// diffs).
+type LeaseValueSource interface {
+	ValueSource
+	ResolveLease(node *corev1.Node, renewed time.Time) (string, bool, error)
+	// NextLeaseChange returns when the value changes from now without renewal, 0 if
+	// it doesn't.
+	NextLeaseChange(renewed, now time.Time) time.Duration
+}
+
+// nodeLeaseSource resolves whether the node lease wasn't renewed for the staleness
+// threshold.
+type nodeLeaseSource struct {
+	staleAfter   time.Duration
+	stale, fresh string
+}
+
+// newNodeLeaseSource resolves the "stale" value (true) when the node lease wasn't
+// renewed for "staleAfter", the "fresh" one (false) otherwise.
+func newNodeLeaseSource(params map[string]string) (ValueSource, error) {
+	param, err := requiredParam(params, "staleAfter")
+	if err != nil {
+		return nil, err
+	}
+	s := nodeLeaseSource{stale: "true", fresh: "false"}
+	if s.staleAfter, err = time.ParseDuration(param); err != nil || s.staleAfter <= 0 {
+		return nil, fmt.Errorf("staleAfter param must be a positive duration, got %q", param)
+	}
+	if v := params["stale"]; v != "" {
+		s.stale = v
+	}
+	if v := params["fresh"]; v != "" {
+		s.fresh = v
+	}
+	if s.stale == s.fresh {
+		return nil, fmt.Errorf("stale and fresh params must differ, got %q", s.stale)
+	}
+	return s, nil
+}
+
+// Resolve satisfies ValueSource interface, without the leases it's not resolved.
+func (s nodeLeaseSource) Resolve(node *corev1.Node) (string, bool, error) {
+	return "", false, nil
+}
+
+// ResolveLease satisfies LeaseValueSource interface.
+func (s nodeLeaseSource) ResolveLease(node *corev1.Node, renewed time.Time) (string, bool, error) {
+	if time.Since(renewed) >= s.staleAfter {
+		return s.stale, true, nil
+	}
+	return s.fresh, true, nil
+}
+
+// NextLeaseChange satisfies LeaseValueSource interface, the lease gets stale.
+func (s nodeLeaseSource) NextLeaseChange(renewed, now time.Time) time.Duration {
+	if d := renewed.Add(s.staleAfter).Sub(now); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// needsLeases returns true if the label controller has value sources that need the
+// node leases.
+func (lc *LabelController) needsLeases() bool {
+	for _, lv := range lc.values {
+		for _, src := range leafSources(lv.source) {
+			if _, ok := src.(LeaseValueSource); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rawLeases are the node leases of a list response.
+type rawLeases struct {
+	Items []struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Spec struct {
+			RenewTime *metav1.MicroTime `json:"renewTime"`
+		} `json:"spec"`
+	} `json:"items"`
+}
+
+// nodeLeases has the renewal times of the node leases, listed every poll interval.
+type nodeLeases struct {
+	c *Labeler
+
+	mu      sync.Mutex
+	renewed map[string]time.Time
+	// polled is set once listed, or disabled.
+	polled bool
+	// path is the API path the leases are served at, empty until found.
+	path string
+}
+
+// NodeLeaseRenewTime satisfies LeaseStore interface.
+func (l *nodeLeases) NodeLeaseRenewTime(nodeName string) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	t, ok := l.renewed[nodeName]
+	return t, ok
+}
+
+// synced returns true once the leases were listed, or they can't be.
+func (l *nodeLeases) synced() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.polled
+}
+
+// run lists the node leases every poll interval until stopped. Without access to the
+// leases, or if the API server doesn't serve them, it stops and the lease value
+// sources are not resolved.
+func (l *nodeLeases) run(stopC <-chan struct{}) {
+	ticker := time.NewTicker(nodeLeasePollInterval)
+	defer ticker.Stop()
+	for {
+		err := l.poll()
+		switch {
+		case errors.IsForbidden(err) || errors.IsNotFound(err):
+			l.c.logger.Warningf("node leases can't be listed, the %s value sources are not resolved: %s", NodeLeaseType, err)
+			l.mu.Lock()
+			l.polled = true
+			l.mu.Unlock()
+			return
+		case err != nil:
+			l.c.logger.Warningf("could not list the node leases: %s", err)
+		}
+		select {
+		case <-stopC:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll lists the node leases and queues the nodes whose lease changed other than by
+// a renewal within the smallest staleness threshold: new, deleted or renewed again
+// after getting stale.
+func (l *nodeLeases) poll() error {
+	var raw []byte
+	var err error
+	l.mu.Lock()
+	paths := nodeLeasePaths
+	if l.path != "" {
+		paths = []string{l.path}
+	}
+	l.mu.Unlock()
+	path := ""
+	for _, path = range paths {
+		req := l.c.k8sCli.Discovery().RESTClient().Get().AbsPath(path)
+		if l.c.cfg.NodeName != "" {
+			req = req.Param("fieldSelector", "metadata.name="+l.c.cfg.NodeName)
+		}
+		if raw, err = req.Do().Raw(); !errors.IsNotFound(err) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	var list rawLeases
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return fmt.Errorf("invalid lease list: %s", err)
+	}
+	renewed := make(map[string]time.Time, len(list.Items))
+	for _, item := range list.Items {
+		if item.Spec.RenewTime != nil {
+			renewed[item.Metadata.Name] = item.Spec.RenewTime.Time
+		}
+	}
+
+	staleAfter := l.c.minStaleAfter()
+	now := time.Now()
+	l.mu.Lock()
+	prev, first := l.renewed, !l.polled
+	l.renewed, l.polled, l.path = renewed, true, path
+	l.mu.Unlock()
+	if first || staleAfter == 0 {
+		return nil
+	}
+	for name, t := range renewed {
+		if old, ok := prev[name]; !ok || t.After(old) && now.Sub(old) >= staleAfter {
+			l.c.enqueue(name)
+		}
+	}
+	for name := range prev {
+		if _, ok := renewed[name]; !ok {
+			l.c.enqueue(name)
+		}
+	}
+	return nil
+}
+
+// minStaleAfter returns the smallest staleness threshold of the lease value sources
+// of the labelers, 0 without them.
+func (c *Labeler) minStaleAfter() time.Duration {
+	var min time.Duration
+	for _, lc := range c.controllers() {
+		for _, lv := range lc.values {
+			for _, src := range leafSources(lv.source) {
+				if s, ok := src.(nodeLeaseSource); ok && (min == 0 || s.staleAfter < min) {
+					min = s.staleAfter
+				}
+			}
+		}
+	}
+	return min
+}
+
+// leasesSynced returns true if the node leases are not watched or were listed.
+func (c *Labeler) leasesSynced() bool {
+	return c.nodeLeases == nil || c.nodeLeases.synced()
+}
@@ -0,0 +1,119 @@
+package labeler
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// nodeState is what a label controller tracks of a node between its syncs.
+type nodeState struct {
+	// wouldChange is true if the dry run labeler would change the node.
+	wouldChange bool
+	// exempt is true if the node is exempted from the labeler by its annotation.
+	exempt bool
+	// strictConflicts are the conflicting keys with the strict combine policy, since
+	// conflictSince.
+	strictConflicts []strictConflict
+	conflictSince   time.Time
+	// blockedTaints is why the NoExecute taints are blocked, since blockedSince.
+	blockedTaints string
+	blockedSince  time.Time
+	// valueMismatches are the resolved values not matching their value pattern, since
+	// mismatchSince.
+	valueMismatches []string
+	mismatchSince   time.Time
+	// deferredTaints are the dropped taints whose removal is deferred.
+	deferredTaints []string
+	// soaking are since when the escalated NoExecute taints soak.
+	soaking map[string]time.Time
+	// passPlanned is true once the node is planned with the max changes per pass,
+	// passDeferred while its changes are deferred to a later pass.
+	passPlanned  bool
+	passDeferred bool
+}
+
+// empty returns true if nothing is tracked of the node.
+func (s *nodeState) empty() bool {
+	return !s.wouldChange && !s.exempt && len(s.strictConflicts) == 0 && s.blockedTaints == "" &&
+		len(s.valueMismatches) == 0 && len(s.deferredTaints) == 0 && len(s.soaking) == 0 && !s.passPlanned
+}
+
+// namedState is the state of a node with its name.
+type namedState struct {
+	name string
+	nodeState
+}
+
+// nodeStates are the states of the nodes by name, the deleted nodes are forgotten.
+type nodeStates struct {
+	mu    sync.Mutex
+	nodes map[string]*nodeState
+}
+
+// update changes the state of the node with fn, the empty states are dropped.
+func (s *nodeStates) update(name string, fn func(st *nodeState)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.nodes[name]
+	if !ok {
+		st = &nodeState{}
+	}
+	fn(st)
+	if st.empty() {
+		delete(s.nodes, name)
+		return
+	}
+	if s.nodes == nil {
+		s.nodes = map[string]*nodeState{}
+	}
+	s.nodes[name] = st
+}
+
+// get returns the state of the node.
+func (s *nodeStates) get(name string) nodeState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st, ok := s.nodes[name]; ok {
+		return *st
+	}
+	return nodeState{}
+}
+
+// forget drops the state of the node and returns it.
+func (s *nodeStates) forget(name string) nodeState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.nodes[name]
+	if !ok {
+		return nodeState{}
+	}
+	delete(s.nodes, name)
+	return *st
+}
+
+// cached returns the states matched by the nodes of the store, sorted by name.
+func (s *nodeStates) cached(nodes NodeStore, match func(st *nodeState) bool) []namedState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var states []namedState
+	for name, st := range s.nodes {
+		if match(st) && cachedNode(nodes, name) != nil {
+			states = append(states, namedState{name: name, nodeState: *st})
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].name < states[j].name })
+	return states
+}
+
+// cachedNode returns the node of the store by name, nil if it's not there.
+func cachedNode(nodes NodeStore, name string) *corev1.Node {
+	// Nodes are cluster scoped, their key is the name.
+	obj, ok, _ := nodes.GetByKey(name)
+	if n, isNode := obj.(*corev1.Node); ok && isNode {
+		return n
+	}
+	return nil
+}
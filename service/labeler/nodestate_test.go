@@ -0,0 +1,55 @@
+package labeler
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	kooperlog "github.com/spotahome/kooper/log"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+func TestNodeStates(t *testing.T) {
+	nodes := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	nodes.Add(testNode("n1", nil))
+	nodes.Add(testNode("n2", nil))
+	l := &labelerv1alpha1.Labeler{ObjectMeta: metav1.ObjectMeta{Name: "l"}}
+	lc := NewLabelController(Config{}, l, nodes, kooperlog.Dummy)
+
+	lc.trackDryRun("n1", true)
+	lc.trackBlockedTaints("n1", "blocked", kooperlog.Dummy)
+	lc.trackValueMismatches("n2", []string{"value x"}, kooperlog.Dummy)
+	lc.trackSoaks("n2", map[string]time.Time{"t": time.Now()})
+	// n3 is not cached.
+	lc.trackDryRun("n3", true)
+
+	if n := lc.dryRunNodes(); n != 1 {
+		t.Errorf("expected the cached dry run nodes counted, got %d", n)
+	}
+	if cond := lc.blockedTaintsCondition(); cond == nil || cond.Since.IsZero() {
+		t.Errorf("expected a blocked taints condition since the node was blocked, got %+v", cond)
+	}
+
+	// Clearing every state of a node drops it.
+	lc.trackBlockedTaints("n1", "", kooperlog.Dummy)
+	lc.trackDryRun("n1", false)
+	if _, ok := lc.states.nodes["n1"]; ok {
+		t.Errorf("expected the empty state of n1 dropped")
+	}
+	if cond := lc.blockedTaintsCondition(); cond != nil {
+		t.Errorf("expected no blocked taints condition, got %+v", cond)
+	}
+
+	// A deleted node is forgotten.
+	lc.forgetNode("n2")
+	lc.forgetNode("n3")
+	if len(lc.states.nodes) != 0 {
+		t.Errorf("expected the deleted nodes forgotten, got %v", lc.states.nodes)
+	}
+	if _, ok := lc.soakSince("n2", "t"); ok {
+		t.Errorf("expected the soak of the deleted node forgotten")
+	}
+}
@@ -0,0 +1,82 @@
+package labeler
+
+import (
+	"time"
+)
+
+const (
+	// ConditionNoMatches is set on labelers that have matched no nodes for longer than
+	// the no matches window, usually a misconfigured selector.
+	ConditionNoMatches = "NoMatches"
+	// ConditionInvalidSpec is set on labelers rejected by the validation, they don't
+	// run until fixed.
+	ConditionInvalidSpec = "InvalidSpec"
+	// ConditionSeverityWarning conditions are informative, not errors.
+	ConditionSeverityWarning = "Warning"
+	// ConditionSeverityError conditions need to be fixed.
+	ConditionSeverityError = "Error"
+
+	noMatchesCheckInterval = 30 * time.Second
+)
+
+// Condition is a condition of a labeler, or of the operator without labeler.
+type Condition struct {
+	Labeler  string    `json:"labeler,omitempty"`
+	Type     string    `json:"type"`
+	Severity string    `json:"severity"`
+	Since    time.Time `json:"since"`
+	Message  string    `json:"message"`
+}
+
+// checkMatches tracks since when the labeler matches no nodes and returns true if it's
+// longer than the window.
+func (lc *LabelController) checkMatches(now time.Time, window time.Duration) bool {
+	matched := lc.AffectedNodes()
+
+	lc.matchesMu.Lock()
+	defer lc.matchesMu.Unlock()
+	if matched > 0 {
+		lc.noMatchesSince = time.Time{}
+		return false
+	}
+	if lc.noMatchesSince.IsZero() {
+		lc.noMatchesSince = now
+	}
+	return now.Sub(lc.noMatchesSince) >= window
+}
+
+// noMatchesCondition returns the NoMatches condition of the labeler, nil if it's not set.
+func (lc *LabelController) noMatchesCondition() *Condition {
+	lc.matchesMu.Lock()
+	defer lc.matchesMu.Unlock()
+	if !lc.noMatches {
+		return nil
+	}
+	return &Condition{
+		Labeler:  lc.l.Name,
+		Type:     ConditionNoMatches,
+		Severity: ConditionSeverityWarning,
+		Since:    lc.noMatchesSince.UTC(),
+		Message:  "the labeler has matched no nodes since " + lc.noMatchesSince.UTC().Format(time.RFC3339) + ", check its selector",
+	}
+}
+
+// checkNoMatches sets the NoMatches condition of the labelers that have matched no
+// nodes for longer than the window. It's not an error, some labelers legitimately
+// match nothing yet, the condition is logged once and recorded as a metric.
+func (c *Labeler) checkNoMatches() {
+	now := time.Now()
+	for _, lc := range c.controllers() {
+		noMatches := lc.checkMatches(now, c.cfg.NoMatchesWindow)
+
+		lc.matchesMu.Lock()
+		changed := noMatches != lc.noMatches
+		lc.noMatches = noMatches
+		lc.matchesMu.Unlock()
+
+		if changed && noMatches {
+			c.logger.Warningf("%s: labeler has matched no nodes for %s, check its selector", lc.l.Name, c.cfg.NoMatchesWindow)
+		}
+		c.cfg.MetricsRecorder.SetLabelerNoMatches(lc.l.Name, noMatches)
+	}
+}
@@ -0,0 +1,256 @@
+package labeler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Orphan policies, for the managed keys of labelers that no longer exist or no longer
+// set them.
+const (
+	// OrphanKeep leaves them on the nodes, the default.
+	OrphanKeep = "keep"
+	// OrphanReport logs them and records the orphaned nodes as a metric.
+	OrphanReport = "report"
+	// OrphanRemove also removes them from the nodes.
+	OrphanRemove = "remove"
+)
+
+// OrphanPolicies are the valid orphan policies.
+var OrphanPolicies = []string{OrphanKeep, OrphanReport, OrphanRemove}
+
+const defaultOrphanSweepInterval = 10 * time.Minute
+
+// LabelerSync tracks the labelers of the watched versions from their informers, the
+// orphan sweeps need them all listed to tell the deleted labelers from the ones not
+// loaded yet.
+type LabelerSync interface {
+	// Unlisted returns the versions whose labelers are not listed yet.
+	Unlisted() []string
+	// Failing returns the versions whose labelers currently can't be watched.
+	Failing() []string
+	// Known returns true if a watched version has the labeler, loaded or not.
+	Known(name string) bool
+}
+
+// labelersUnsynced returns the versions whose labelers are not listed yet and the ones
+// that currently can't be watched. Without labeler sync the loaded labelers are all
+// the labelers.
+func (c *Labeler) labelersUnsynced() (unlisted, failing []string) {
+	if c.cfg.LabelerSync == nil {
+		return nil, nil
+	}
+	return c.cfg.LabelerSync.Unlisted(), c.cfg.LabelerSync.Failing()
+}
+
+// orphanedKeys returns the orphaned managed keys on the node by owner: all the keys of
+// the labelers the operator doesn't know, the deleted ones, and the labels and
+// annotations the existing labelers no longer set. The invalid labelers and the ones a
+// watched version has but not loaded yet are known, they are only waiting to be fixed
+// or loaded.
+func (c *Labeler) orphanedKeys(node *corev1.Node) map[string][]string {
+	orphaned := map[string][]string{}
+	for name, keys := range ownedKeys(node, c.cfg.OwnerAnnotation) {
+		if lc, ok := c.reg.Load(name); ok {
+			if dropped := lc.(*LabelController).droppedKeys(keys); len(dropped) > 0 {
+				orphaned[name] = dropped
+			}
+			continue
+		}
+		if _, ok := c.invalid.Load(name); ok {
+			continue
+		}
+		if c.cfg.LabelerSync != nil && c.cfg.LabelerSync.Known(name) {
+			continue
+		}
+		orphaned[name] = keys
+	}
+	return orphaned
+}
+
+// droppedKeys returns the owned labels and annotations the labeler no longer sets, the
+// ones removed from its spec. Its dropped taints are removed by its taint removal
+// policy.
+func (lc *LabelController) droppedKeys(owned []string) []string {
+	sets := map[string]bool{}
+	for k := range lc.l.Spec.Merge.Labels {
+		sets[labelsPrefix+k] = true
+	}
+	for k := range lc.l.Spec.Merge.Annotations {
+		sets[annotationsPrefix+k] = true
+	}
+	for _, lv := range lc.values {
+		sets[labelsPrefix+lv.label] = true
+	}
+	var dropped []string
+	for _, k := range owned {
+		if !strings.HasPrefix(k, taintsPrefix) && !sets[k] {
+			dropped = append(dropped, k)
+		}
+	}
+	return dropped
+}
+
+// runOrphanSweeps sweeps the cached nodes for orphaned keys every interval.
+func (c *Labeler) runOrphanSweeps(stopC <-chan struct{}) {
+	ticker := time.NewTicker(c.cfg.OrphanSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopC:
+			return
+		case <-ticker.C:
+			c.sweepOrphans()
+		}
+	}
+}
+
+// sweepOrphans finds the nodes with orphaned managed keys, logs them and records their
+// count. With the remove policy the nodes are queued, their sync removes the orphaned
+// keys. Nothing is swept until the labelers of every version are listed, and nothing
+// is removed while a version can't be watched: its deleted labelers can't be told
+// from the ones created meanwhile.
+func (c *Labeler) sweepOrphans() {
+	unlisted, failing := c.labelersUnsynced()
+	if len(unlisted) > 0 {
+		c.logger.Warningf("orphaned keys not swept, the labelers of %s are not listed yet", strings.Join(unlisted, ", "))
+		return
+	}
+	remove := c.cfg.OrphanPolicy == OrphanRemove && len(failing) == 0
+
+	deleted, dropped := map[string]int{}, map[string]int{}
+	nodes := 0
+	for _, obj := range c.informer().GetStore().List() {
+		node, ok := obj.(*corev1.Node)
+		if !ok {
+			continue
+		}
+		orphaned := c.orphanedKeys(node)
+		if len(orphaned) == 0 {
+			continue
+		}
+		nodes++
+		for name := range orphaned {
+			if _, ok := c.reg.Load(name); ok {
+				dropped[name]++
+			} else {
+				deleted[name]++
+			}
+		}
+		if remove {
+			c.orphaned.Store(node.Name, struct{}{})
+			c.forceSync.Store(node.Name, struct{}{})
+			c.enqueue(node.Name)
+		}
+	}
+	c.cfg.MetricsRecorder.SetOrphanedNodes(nodes)
+	if nodes == 0 {
+		return
+	}
+
+	var descs []string
+	if len(deleted) > 0 {
+		descs = append(descs, "deleted labelers "+orphanCounts(deleted))
+	}
+	if len(dropped) > 0 {
+		descs = append(descs, "dropped from the spec of "+orphanCounts(dropped))
+	}
+	action := "kept"
+	switch {
+	case remove:
+		action = "removing them"
+	case c.cfg.OrphanPolicy == OrphanRemove:
+		action = fmt.Sprintf("kept while the labelers of %s can't be watched", strings.Join(failing, ", "))
+	}
+	c.logger.Warningf("%d nodes have orphaned managed keys, %s: %s", nodes, action, strings.Join(descs, "; "))
+}
+
+// orphanCounts returns the sorted labeler names with their number of nodes.
+func orphanCounts(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	descs := make([]string, 0, len(names))
+	for _, name := range names {
+		descs = append(descs, fmt.Sprintf("%s (%d nodes)", name, counts[name]))
+	}
+	return strings.Join(descs, ", ")
+}
+
+// removeOrphans returns the planned node without its orphaned keys, with their
+// mutations, if the sweep queued the node and the labelers are still all listed and
+// watched. The protected keys and the keys also owned by another labeler stay on the
+// node, unowned by the orphan owner. The keys dropped by a dry run labeler are only
+// reported.
+func (c *Labeler) removeOrphans(node, dst *corev1.Node) (*corev1.Node, []Mutation) {
+	if _, ok := c.orphaned.Load(node.Name); !ok {
+		return dst, nil
+	}
+	c.orphaned.Delete(node.Name)
+	if unlisted, failing := c.labelersUnsynced(); len(unlisted) > 0 || len(failing) > 0 {
+		return dst, nil
+	}
+	orphaned := c.orphanedKeys(dst)
+	if len(orphaned) == 0 {
+		return dst, nil
+	}
+
+	owned := ownedKeys(dst, c.cfg.OwnerAnnotation)
+	live := map[string]bool{}
+	for name, keys := range owned {
+		orphan := map[string]bool{}
+		for _, k := range orphaned[name] {
+			orphan[k] = true
+		}
+		for _, k := range keys {
+			if !orphan[k] {
+				live[k] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(orphaned))
+	for name := range orphaned {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	dst = dst.DeepCopy()
+	var mutations []Mutation
+	for _, name := range names {
+		protected := func(key string) bool { return keyProtected(key, c.cfg.ProtectKeys) }
+		dryRun := false
+		if v, ok := c.reg.Load(name); ok {
+			lc := v.(*LabelController)
+			protected, dryRun = lc.protected, lc.DryRun()
+		}
+		var removed []string
+		for _, k := range orphaned[name] {
+			if !live[k] && !protected(attributeKey(k)) {
+				removed = append(removed, k)
+			}
+		}
+		if len(removed) > 0 {
+			mutations = append(mutations, Mutation{Node: node.Name, Rule: name, Operation: MutationOperationRemove, Keys: removed, DryRun: dryRun})
+		}
+		if dryRun {
+			continue
+		}
+		// The owner keeps its keys that are not orphaned.
+		var kept []string
+		for _, k := range owned[name] {
+			if !contains(orphaned[name], k) {
+				kept = append(kept, k)
+			}
+		}
+		setOwnedKeys(dst, c.cfg.OwnerAnnotation, name, removed)
+		removeOwned(dst, c.cfg.OwnerAnnotation, name, nil)
+		setOwnedKeys(dst, c.cfg.OwnerAnnotation, name, kept)
+	}
+	return dst, mutations
+}
@@ -0,0 +1,103 @@
+package labeler
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	kooperlog "github.com/spotahome/kooper/log"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// testLabelerSync is a labeler sync with fixed versions and labelers.
+type testLabelerSync struct {
+	unlisted, failing []string
+	known             map[string]bool
+}
+
+func (s testLabelerSync) Unlisted() []string     { return s.unlisted }
+func (s testLabelerSync) Failing() []string      { return s.failing }
+func (s testLabelerSync) Known(name string) bool { return s.known[name] }
+
+func TestRemoveOrphans(t *testing.T) {
+	const owner = "owned-keys"
+	live := &labelerv1alpha1.Labeler{
+		ObjectMeta: metav1.ObjectMeta{Name: "live"},
+		Spec:       labelerv1alpha1.LabelerSpec{Merge: mergeSpec(map[string]string{"kept": "v"})},
+	}
+
+	tests := []struct {
+		name     string
+		sync     testLabelerSync
+		owned    string
+		labels   map[string]string
+		expOwned string
+		expKeys  []string
+	}{
+		{
+			name:     "The keys of a deleted labeler are removed.",
+			owned:    `{"deleted":["labels/old"],"live":["labels/kept"]}`,
+			labels:   map[string]string{"old": "v", "kept": "v"},
+			expOwned: `{"live":["labels/kept"]}`,
+			expKeys:  []string{"deleted:labels/old"},
+		},
+		{
+			name:     "The keys dropped from the spec of a live labeler are removed, it keeps the others.",
+			owned:    `{"live":["labels/dropped","labels/kept"]}`,
+			labels:   map[string]string{"dropped": "v", "kept": "v"},
+			expOwned: `{"live":["labels/kept"]}`,
+			expKeys:  []string{"live:labels/dropped"},
+		},
+		{
+			name:     "The keys of a labeler known by a watched version are kept.",
+			sync:     testLabelerSync{known: map[string]bool{"unloaded": true}},
+			owned:    `{"unloaded":["labels/old"]}`,
+			labels:   map[string]string{"old": "v"},
+			expOwned: `{"unloaded":["labels/old"]}`,
+		},
+		{
+			name:     "Nothing is removed until the labelers of every version are listed.",
+			sync:     testLabelerSync{unlisted: []string{"labeler.example.com/v1beta1"}},
+			owned:    `{"deleted":["labels/old"]}`,
+			labels:   map[string]string{"old": "v"},
+			expOwned: `{"deleted":["labels/old"]}`,
+		},
+		{
+			name:     "Nothing is removed while a version can't be watched.",
+			sync:     testLabelerSync{failing: []string{"labeler.example.com/v1beta1"}},
+			owned:    `{"deleted":["labels/old"]}`,
+			labels:   map[string]string{"old": "v"},
+			expOwned: `{"deleted":["labels/old"]}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &Labeler{cfg: Config{OwnerAnnotation: owner, LabelerSync: test.sync}}
+			c.reg.Store(live.Name, NewLabelController(c.cfg, live, cache.NewStore(cache.MetaNamespaceKeyFunc), kooperlog.Dummy))
+			node := testNode("n1", test.labels)
+			node.Annotations = map[string]string{owner: test.owned}
+			c.orphaned.Store(node.Name, struct{}{})
+
+			dst, mutations := c.removeOrphans(node, node)
+			if got := dst.Annotations[owner]; got != test.expOwned {
+				t.Errorf("expected owned keys %s, got %s", test.expOwned, got)
+			}
+			var keys []string
+			for _, m := range mutations {
+				for _, k := range m.Keys {
+					keys = append(keys, m.Rule+":"+k)
+					if _, ok := dst.Labels[attributeKey(k)]; ok {
+						t.Errorf("expected %s removed from the node", k)
+					}
+				}
+			}
+			if !reflect.DeepEqual(keys, test.expKeys) {
+				t.Errorf("expected removed keys %v, got %v", test.expKeys, keys)
+			}
+		})
+	}
+}
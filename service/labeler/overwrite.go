@@ -0,0 +1,57 @@
+package labeler
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	overwriteEventReason = "OverwriteForeignField"
+	// unknownManager is the manager of the values not set by a labeler.
+	unknownManager = "unknown"
+)
+
+// Overwrite is an existing value a labeler replaces on a node that it doesn't own.
+type Overwrite struct {
+	Key      string `json:"key"`
+	Previous string `json:"previous"`
+	New      string `json:"new"`
+	// Manager is the labeler owning the previous value, unknown if it was not set by
+	// a labeler (another controller or a user).
+	Manager string `json:"manager"`
+}
+
+// foreignOverwrites returns the values of the node the labeler changes without
+// owning them.
+func (lc *LabelController) foreignOverwrites(node, planned *corev1.Node) []Overwrite {
+	owners := map[string]string{}
+	for name, keys := range ownedKeys(node, lc.cfg.OwnerAnnotation) {
+		for _, k := range keys {
+			owners[k] = name
+		}
+	}
+
+	var ows []Overwrite
+	for _, c := range Diff(node, planned, lc.cfg.OwnerAnnotation) {
+		if c.Operation != ChangeUpdate || owners[c.Key] == lc.l.Name {
+			continue
+		}
+		manager := owners[c.Key]
+		if manager == "" {
+			manager = unknownManager
+		}
+		ows = append(ows, Overwrite{Key: c.Key, Previous: c.Old, New: c.New, Manager: manager})
+	}
+	return ows
+}
+
+// reportOverwrites logs, counts and records as node events the foreign values the
+// mutation replaced.
+func (c *Labeler) reportOverwrites(node *corev1.Node, m Mutation) {
+	for _, ow := range m.Overwrites {
+		c.nodeLogger(node.Name).Warningf("%s overwrote %s of node %s owned by %s: %q -> %q", m.Rule, ow.Key, node.Name, ow.Manager, ow.Previous, ow.New)
+		c.cfg.MetricsRecorder.IncForeignOverwrites(m.Rule, ow.Manager)
+		c.nodeEvent(node, overwriteEventReason, fmt.Sprintf("labeler %s overwrote %s owned by %s, previous value %q, new value %q", m.Rule, ow.Key, ow.Manager, ow.Previous, ow.New))
+	}
+}
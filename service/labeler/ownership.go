@@ -0,0 +1,185 @@
+package labeler
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Owned keys prefixes, same as the mutation keys.
+const (
+	labelsPrefix      = "labels/"
+	annotationsPrefix = "annotations/"
+	taintsPrefix      = "taints/"
+)
+
+// ownedKeys returns the attributes owned by every labeler on the node, they are on the
+// owner annotation.
+func ownedKeys(node *corev1.Node, annotation string) map[string][]string {
+	owned := map[string][]string{}
+	if v, ok := node.Annotations[annotation]; ok {
+		// A broken annotation is handled as nothing being owned.
+		json.Unmarshal([]byte(v), &owned)
+	}
+	return owned
+}
+
+// setOwnedKeys sets the attributes owned by a labeler on the node, no keys removes
+// the labeler from the owners.
+func setOwnedKeys(node *corev1.Node, annotation, name string, keys []string) {
+	owned := ownedKeys(node, annotation)
+	if len(keys) == 0 {
+		delete(owned, name)
+	} else {
+		owned[name] = keys
+	}
+
+	if len(owned) == 0 {
+		delete(node.Annotations, annotation)
+		return
+	}
+
+	b, _ := json.Marshal(owned)
+	if node.Annotations == nil {
+		node.Annotations = map[string]string{}
+	}
+	node.Annotations[annotation] = string(b)
+}
+
+// taintKey returns the key used to identify a taint.
+func taintKey(t corev1.Taint) string {
+	return t.Key + ":" + string(t.Effect)
+}
+
+// appliedKeys returns the attributes owned by the labeler once applied on a node: the
+// ones it already owned and the ones it has set, with the renamed labels. Attributes that
+// the node already had are not owned, nor the owned labels and taints removed from the
+// desired node.
+func (lc *LabelController) appliedKeys(node, dst *corev1.Node) []string {
+	nodeTaints, dstTaints := map[string]bool{}, map[string]bool{}
+	for _, t := range node.Spec.Taints {
+		nodeTaints[taintKey(t)] = true
+	}
+	for _, t := range dst.Spec.Taints {
+		dstTaints[taintKey(t)] = true
+	}
+	set := map[string]bool{}
+	for _, k := range ownedKeys(node, lc.cfg.OwnerAnnotation)[lc.l.Name] {
+		if strings.HasPrefix(k, taintsPrefix) && !dstTaints[strings.TrimPrefix(k, taintsPrefix)] {
+			continue
+		}
+		if _, ok := dst.Labels[strings.TrimPrefix(k, labelsPrefix)]; strings.HasPrefix(k, labelsPrefix) && !ok {
+			continue
+		}
+		set[k] = true
+	}
+
+	merge := lc.l.Spec.Merge
+	for k, v := range merge.Labels {
+		if _, ok := node.Labels[k]; !ok && dst.Labels[k] == v {
+			set[labelsPrefix+k] = true
+		}
+	}
+	for k, v := range merge.Annotations {
+		if _, ok := node.Annotations[k]; !ok && dst.Annotations[k] == v {
+			set[annotationsPrefix+k] = true
+		}
+	}
+	for _, lv := range lc.values {
+		_, had := node.Labels[lv.label]
+		if _, ok := dst.Labels[lv.label]; ok && !had {
+			set[labelsPrefix+lv.label] = true
+		}
+	}
+	// The renamed labels are owned under their new key, the node had the old one.
+	for _, r := range lc.l.Spec.Rename {
+		_, had := node.Labels[r.To]
+		if _, ok := node.Labels[r.From]; ok && !had && dst.Labels[r.To] == node.Labels[r.From] {
+			set[labelsPrefix+r.To] = true
+		}
+	}
+	// Blocked taints are not applied, the escalated ones soak first.
+	applied := func(t corev1.Taint) bool {
+		return !nodeTaints[taintKey(t)] && dstTaints[taintKey(t)]
+	}
+	for _, t := range merge.Taints {
+		if applied(t) {
+			set[taintsPrefix+taintKey(t)] = true
+		}
+		if soak := soakTaint(t); t.Effect == corev1.TaintEffectNoExecute && lc.l.Spec.TaintEscalation != nil && applied(soak) {
+			set[taintsPrefix+taintKey(soak)] = true
+		}
+	}
+
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// keyProtected returns true if the attribute key (without kind prefix, the key of a
+// taint) is in a protect list, entries ending in "/*" protect all the keys of their
+// prefix.
+func keyProtected(key string, lists ...[]string) bool {
+	for _, list := range lists {
+		for _, p := range list {
+			if p == key || strings.HasSuffix(p, "/*") && strings.HasPrefix(key, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// attributeKey returns the label, annotation or taint key of an owned key.
+func attributeKey(owned string) string {
+	for _, prefix := range []string{labelsPrefix, annotationsPrefix} {
+		if strings.HasPrefix(owned, prefix) {
+			return strings.TrimPrefix(owned, prefix)
+		}
+	}
+	k := strings.TrimPrefix(owned, taintsPrefix)
+	if i := strings.LastIndex(k, ":"); i >= 0 {
+		k = k[:i]
+	}
+	return k
+}
+
+// removeOwned removes from the node the attributes owned by the labeler, except the
+// protected ones that are kept unowned. It returns the protected keys kept.
+func removeOwned(node *corev1.Node, annotation, name string, protected func(string) bool) []string {
+	owned := ownedKeys(node, annotation)[name]
+	taints := map[string]bool{}
+	var kept []string
+	for _, k := range owned {
+		if protected != nil && protected(attributeKey(k)) {
+			kept = append(kept, k)
+			continue
+		}
+		switch {
+		case strings.HasPrefix(k, labelsPrefix):
+			delete(node.Labels, strings.TrimPrefix(k, labelsPrefix))
+		case strings.HasPrefix(k, annotationsPrefix):
+			delete(node.Annotations, strings.TrimPrefix(k, annotationsPrefix))
+		case strings.HasPrefix(k, taintsPrefix):
+			taints[strings.TrimPrefix(k, taintsPrefix)] = true
+		}
+	}
+
+	if len(taints) > 0 {
+		var kept []corev1.Taint
+		for _, t := range node.Spec.Taints {
+			if !taints[taintKey(t)] {
+				kept = append(kept, t)
+			}
+		}
+		node.Spec.Taints = kept
+	}
+
+	setOwnedKeys(node, annotation, name, nil)
+	return kept
+}
@@ -0,0 +1,138 @@
+package labeler
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	kooperlog "github.com/spotahome/kooper/log"
+
+	"github.com/joshisa/resource-labeler-operator/apis/labeler"
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+func TestAppliedKeys(t *testing.T) {
+	noSchedule := corev1.Taint{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule}
+	noExecute := corev1.Taint{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoExecute}
+
+	tests := []struct {
+		name       string
+		merge      labelerv1alpha1.MergeSpec
+		rename     []labelerv1alpha1.RenameSpec
+		escalation *labelerv1alpha1.TaintEscalation
+		node       *corev1.Node
+		dst        *corev1.Node
+		exp        []string
+	}{
+		{
+			name:  "Labels and taints set by the labeler are owned.",
+			merge: mergeSpec(map[string]string{"role": "gpu"}, noSchedule),
+			node:  testNode("n1", nil),
+			dst:   testNode("n1", map[string]string{"role": "gpu"}, noSchedule),
+			exp:   []string{"labels/role", "taints/dedicated:NoSchedule"},
+		},
+		{
+			name:  "Labels and taints the node already had are not owned.",
+			merge: mergeSpec(map[string]string{"role": "gpu"}, noSchedule),
+			node:  testNode("n1", map[string]string{"role": "cpu"}, corev1.Taint{Key: "dedicated", Value: "admin", Effect: corev1.TaintEffectNoSchedule}),
+			dst:   testNode("n1", map[string]string{"role": "gpu"}, noSchedule),
+			exp:   []string{},
+		},
+		{
+			name:       "A soaking taint the node already had is not owned.",
+			merge:      mergeSpec(nil, noExecute),
+			escalation: &labelerv1alpha1.TaintEscalation{},
+			node:       testNode("n1", nil, noSchedule),
+			dst:        testNode("n1", nil, noSchedule),
+			exp:        []string{},
+		},
+		{
+			name:       "A soaking taint set by the labeler is owned.",
+			merge:      mergeSpec(nil, noExecute),
+			escalation: &labelerv1alpha1.TaintEscalation{},
+			node:       testNode("n1", nil),
+			dst:        testNode("n1", nil, noSchedule),
+			exp:        []string{"taints/dedicated:NoSchedule"},
+		},
+		{
+			name:   "A renamed label is owned under its new key.",
+			rename: []labelerv1alpha1.RenameSpec{{From: "zone", To: "example.com/zone"}},
+			node:   testNode("n1", map[string]string{"zone": "a"}),
+			dst:    testNode("n1", map[string]string{"example.com/zone": "a"}),
+			exp:    []string{"labels/example.com/zone"},
+		},
+		{
+			name:   "A rename overwriting a key the node already had is not owned.",
+			rename: []labelerv1alpha1.RenameSpec{{From: "zone", To: "example.com/zone"}},
+			node:   testNode("n1", map[string]string{"zone": "a", "example.com/zone": "b"}),
+			dst:    testNode("n1", map[string]string{"example.com/zone": "a"}),
+			exp:    []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := &labelerv1alpha1.Labeler{
+				ObjectMeta: metav1.ObjectMeta{Name: "test"},
+				Spec:       labelerv1alpha1.LabelerSpec{Merge: test.merge, Rename: test.rename, TaintEscalation: test.escalation},
+			}
+			lc := NewLabelController(Config{}, l, cache.NewStore(cache.MetaNamespaceKeyFunc), kooperlog.Dummy)
+
+			got := lc.appliedKeys(test.node, test.dst)
+			if !reflect.DeepEqual(got, test.exp) {
+				t.Errorf("expected %v, got %v", test.exp, got)
+			}
+		})
+	}
+}
+
+func TestOwnedNodes(t *testing.T) {
+	owned := func(name, annotation string) *corev1.Node {
+		n := testNode(name, nil)
+		n.Annotations = map[string]string{labeler.OwnedKeysAnnotation: annotation}
+		return n
+	}
+	s := newNodeServer(
+		owned("n1", `{"gpu":["labels/gpu"]}`),
+		owned("n2", `{"gpu":["taints/gpu:NoSchedule"],"other":["labels/team"]}`),
+		owned("n3", `{"other":["labels/team"]}`),
+		// A broken annotation owns nothing.
+		owned("n4", `{"gpu":`),
+		testNode("n5", nil),
+	)
+	c, stop := newSyncedLabeler(t, s, Config{})
+	defer stop()
+
+	for name, exp := range map[string]int{"gpu": 2, "other": 2, "none": 0} {
+		if n, err := c.OwnedNodes(name); err != nil || n != exp {
+			t.Errorf("expected %d nodes owned by %s, got %d (%v)", exp, name, n, err)
+		}
+	}
+}
+
+func TestOwnedNodesNotSynced(t *testing.T) {
+	c := &Labeler{
+		cfg:          Config{}.withDefaults(),
+		nodeInformer: cache.NewSharedIndexInformer(&cache.ListWatch{}, &corev1.Node{}, 0, cache.Indexers{}),
+	}
+	if _, err := c.OwnedNodes("gpu"); err == nil {
+		t.Errorf("expected an error before the nodes are synced")
+	}
+}
+
+func mergeSpec(labels map[string]string, taints ...corev1.Taint) labelerv1alpha1.MergeSpec {
+	return labelerv1alpha1.MergeSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: labels},
+		NodeSpec:   corev1.NodeSpec{Taints: taints},
+	}
+}
+
+func testNode(name string, labels map[string]string, taints ...corev1.Taint) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Spec:       corev1.NodeSpec{Taints: taints},
+	}
+}
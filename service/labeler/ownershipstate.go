@@ -0,0 +1,97 @@
+package labeler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NodeOwnership are the managed keys of a node by owning labeler, as on the owner
+// annotation.
+type NodeOwnership struct {
+	Node  string              `json:"node"`
+	Owned map[string][]string `json:"owned"`
+}
+
+// ExportOwnership returns the managed keys of the node by owning labeler, its owned
+// map is empty without managed keys.
+func ExportOwnership(node *corev1.Node, ownerAnnotation string) NodeOwnership {
+	return NodeOwnership{Node: node.Name, Owned: ownedKeys(node, ownerAnnotation)}
+}
+
+// ImportOwnership returns a copy of the node owning the keys of the ownership, added to
+// the ones it already owns, and the skipped keys: those the node doesn't have and those
+// another labeler owns. The node is returned as is if nothing is added, importing the
+// same ownership again doesn't change it.
+func ImportOwnership(node *corev1.Node, own NodeOwnership, ownerAnnotation string) (*corev1.Node, map[string][]string, []string) {
+	current := ownedKeys(node, ownerAnnotation)
+	ownerOf := map[string]string{}
+	for name, keys := range current {
+		for _, k := range keys {
+			ownerOf[k] = name
+		}
+	}
+	taints := taintValues(node.Spec.Taints)
+
+	names := make([]string, 0, len(own.Owned))
+	for name := range own.Owned {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	added := map[string][]string{}
+	var skipped []string
+	dst := node.DeepCopy()
+	for _, name := range names {
+		set := map[string]bool{}
+		for _, k := range current[name] {
+			set[k] = true
+		}
+		for _, k := range own.Owned[name] {
+			if owner, ok := ownerOf[k]; ok {
+				if owner != name {
+					skipped = append(skipped, fmt.Sprintf("%s: owned by %s, not %s", k, owner, name))
+				}
+				continue
+			}
+			if !hasKey(node, k, taints) {
+				skipped = append(skipped, fmt.Sprintf("%s: not on the node, not owned by %s", k, name))
+				continue
+			}
+			set[k] = true
+			ownerOf[k] = name
+			added[name] = append(added[name], k)
+		}
+		if len(added[name]) == 0 {
+			continue
+		}
+		keys := make([]string, 0, len(set))
+		for k := range set {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		setOwnedKeys(dst, ownerAnnotation, name, keys)
+	}
+	if len(added) == 0 {
+		return node, nil, skipped
+	}
+	return dst, added, skipped
+}
+
+// hasKey returns true if the node has the attribute of the owned key, the taints are
+// the node taint values by key.
+func hasKey(node *corev1.Node, key string, taints map[string]string) bool {
+	switch {
+	case strings.HasPrefix(key, labelsPrefix):
+		_, ok := node.Labels[strings.TrimPrefix(key, labelsPrefix)]
+		return ok
+	case strings.HasPrefix(key, annotationsPrefix):
+		_, ok := node.Annotations[strings.TrimPrefix(key, annotationsPrefix)]
+		return ok
+	case strings.HasPrefix(key, taintsPrefix):
+		_, ok := taints[strings.TrimPrefix(key, taintsPrefix)]
+		return ok
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package labeler
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// panicError is the panic of a node sync recovered, its class is Panic.
+type panicError struct {
+	value interface{}
+}
+
+func (e panicError) Error() string {
+	return fmt.Sprintf("sync panicked: %v", e.value)
+}
+
+// syncNodeRecovered syncs the node recovering its panics as a panicError, so a single
+// malformed node or labeler doesn't crash the operator: the stack is logged, the panic
+// counted and the worker keeps running. With CrashOnPanic the panics are not
+// recovered.
+func (c *Labeler) syncNodeRecovered(key string) (res ReconcileResult, err error) {
+	if !c.cfg.CrashOnPanic {
+		defer func() {
+			if r := recover(); r != nil {
+				c.nodeLogger(key).Errorf("panic syncing node %s: %v\n%s", key, r, debug.Stack())
+				c.cfg.MetricsRecorder.IncReconcilePanics()
+				res, err = ReconcileResult{Node: key}, panicError{value: r}
+			}
+		}()
+	}
+	return c.syncNode(key)
+}
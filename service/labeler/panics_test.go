@@ -0,0 +1,80 @@
+package labeler
+
+import (
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+	"github.com/joshisa/resource-labeler-operator/metrics"
+)
+
+// registerPanicSource registers the testPanic value source panicking on every node,
+// it returns the func unregistering it so the built-in sources stay the same.
+func registerPanicSource() func() {
+	RegisterValueSource("testPanic", func(params map[string]string) (ValueSource, error) {
+		return ValueSourceFunc(func(node *corev1.Node) (string, bool, error) {
+			panic("malformed node " + node.Name)
+		}), nil
+	})
+	return func() {
+		valueSourcesMu.Lock()
+		defer valueSourcesMu.Unlock()
+		delete(valueSources, "testPanic")
+	}
+}
+
+// panicRecorder counts the recovered panics.
+type panicRecorder struct {
+	metrics.Recorder
+	mu     sync.Mutex
+	panics int
+}
+
+func (r *panicRecorder) IncReconcilePanics() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.panics++
+}
+
+func TestProcessNextNodeRecoversPanics(t *testing.T) {
+	defer registerPanicSource()()
+	s := newNodeServer(testNode("n1", map[string]string{"pool": "a"}))
+	recorder := &panicRecorder{Recorder: metrics.Dummy}
+	results := &reconcileResults{}
+	l := poolLabeler("a", "a", labelerv1alpha1.LabelerSpec{ValueFrom: []labelerv1alpha1.ValueFromSpec{{Label: "team", Type: "testPanic"}}})
+	c, stop := newSyncedLabeler(t, s, Config{MetricsRecorder: recorder, ReconcileRecorder: results}, l)
+	defer stop()
+
+	if !c.processNextNode() {
+		t.Fatalf("expected the worker to keep running")
+	}
+	if recorder.panics != 1 {
+		t.Errorf("expected the panic counted, got %d", recorder.panics)
+	}
+	if len(results.results) != 1 || results.results[0].Outcome != ReconcileError {
+		t.Errorf("expected the error outcome, got %+v", results.results)
+	}
+	if delayed := c.queue.snapshot().Delayed; len(delayed) != 1 || delayed[0].Key != "n1" {
+		t.Errorf("expected the node retried after a backoff, got %+v", delayed)
+	}
+	if n := s.patchCount(); n != 0 {
+		t.Errorf("expected no patch, got %d", n)
+	}
+}
+
+func TestCrashOnPanic(t *testing.T) {
+	defer registerPanicSource()()
+	s := newNodeServer(testNode("n1", map[string]string{"pool": "a"}))
+	l := poolLabeler("a", "a", labelerv1alpha1.LabelerSpec{ValueFrom: []labelerv1alpha1.ValueFromSpec{{Label: "team", Type: "testPanic"}}})
+	c, stop := newSyncedLabeler(t, s, Config{CrashOnPanic: true}, l)
+	defer stop()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected the panic not recovered")
+		}
+	}()
+	c.syncNodeRecovered("n1")
+}
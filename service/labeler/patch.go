@@ -0,0 +1,87 @@
+package labeler
+
+import (
+	"encoding/json"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// mergePatch returns the JSON merge patch (RFC 7386) of a node patch with the resource
+// version of the node, so the patch fails if the node changed since it was planned.
+func mergePatch(patch map[string]interface{}, resourceVersion string) ([]byte, error) {
+	metadata, _ := patch["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+		patch["metadata"] = metadata
+	}
+	metadata["resourceVersion"] = resourceVersion
+	return json.Marshal(patch)
+}
+
+// nodePatch returns the merge patch of the metadata and spec from the node to dst.
+func nodePatch(node, dst *corev1.Node) (map[string]interface{}, error) {
+	from, err := toMap(struct {
+		Metadata interface{} `json:"metadata"`
+		Spec     interface{} `json:"spec"`
+	}{node.ObjectMeta, node.Spec})
+	if err != nil {
+		return nil, err
+	}
+	to, err := toMap(struct {
+		Metadata interface{} `json:"metadata"`
+		Spec     interface{} `json:"spec"`
+	}{dst.ObjectMeta, dst.Spec})
+	if err != nil {
+		return nil, err
+	}
+	return diffObjects(from, to), nil
+}
+
+// samePatchable returns true if the node and dst have the same metadata and spec as
+// the API sees them: the values are compared once serialized, so nil and empty maps,
+// lists and fields are the same. A node already in the desired state is not patched.
+func samePatchable(node, dst *corev1.Node) bool {
+	patch, err := nodePatch(node, dst)
+	return err == nil && len(patch) == 0
+}
+
+func toMap(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]interface{}{}
+	err = json.Unmarshal(b, &m)
+	return m, err
+}
+
+// diffObjects returns the merge patch from one JSON object to the other: the changed
+// fields, objects are patched recursively and removed fields are null.
+func diffObjects(from, to map[string]interface{}) map[string]interface{} {
+	patch := map[string]interface{}{}
+	for k, tv := range to {
+		fv, ok := from[k]
+		if !ok {
+			patch[k] = tv
+			continue
+		}
+		fm, fok := fv.(map[string]interface{})
+		tm, tok := tv.(map[string]interface{})
+		if fok && tok {
+			if p := diffObjects(fm, tm); len(p) > 0 {
+				patch[k] = p
+			}
+			continue
+		}
+		if !reflect.DeepEqual(fv, tv) {
+			patch[k] = tv
+		}
+	}
+	for k := range from {
+		if _, ok := to[k]; !ok {
+			patch[k] = nil
+		}
+	}
+	return patch
+}
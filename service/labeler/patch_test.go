@@ -0,0 +1,98 @@
+package labeler
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+func TestNodePatch(t *testing.T) {
+	dedicated := corev1.Taint{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule}
+	tests := []struct {
+		name   string
+		node   *corev1.Node
+		change func(dst *corev1.Node)
+		exp    map[string]interface{}
+	}{
+		{
+			name:   "An identical node has no patch.",
+			node:   testNode("n1", map[string]string{"a": "1"}),
+			change: func(dst *corev1.Node) {},
+			exp:    map[string]interface{}{},
+		},
+		{
+			name: "Nil and empty maps and lists are the same.",
+			node: testNode("n1", nil),
+			change: func(dst *corev1.Node) {
+				dst.Labels = map[string]string{}
+				dst.Annotations = map[string]string{}
+				dst.Spec.Taints = []corev1.Taint{}
+			},
+			exp: map[string]interface{}{},
+		},
+		{
+			name:   "A changed label is patched alone.",
+			node:   testNode("n1", map[string]string{"a": "1", "b": "2"}),
+			change: func(dst *corev1.Node) { dst.Labels["a"] = "2" },
+			exp:    map[string]interface{}{"metadata": map[string]interface{}{"labels": map[string]interface{}{"a": "2"}}},
+		},
+		{
+			name:   "A removed label is null.",
+			node:   testNode("n1", map[string]string{"a": "1", "b": "2"}),
+			change: func(dst *corev1.Node) { delete(dst.Labels, "a") },
+			exp:    map[string]interface{}{"metadata": map[string]interface{}{"labels": map[string]interface{}{"a": nil}}},
+		},
+		{
+			name:   "The taints are patched as a whole list.",
+			node:   testNode("n1", nil),
+			change: func(dst *corev1.Node) { dst.Spec.Taints = []corev1.Taint{dedicated} },
+			exp: map[string]interface{}{"spec": map[string]interface{}{"taints": []interface{}{
+				map[string]interface{}{"key": "dedicated", "value": "gpu", "effect": "NoSchedule"},
+			}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dst := test.node.DeepCopy()
+			test.change(dst)
+			patch, err := nodePatch(test.node, dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(patch, test.exp) {
+				t.Errorf("expected the patch %v, got %v", test.exp, patch)
+			}
+			if same := samePatchable(test.node, dst); same != (len(test.exp) == 0) {
+				t.Errorf("expected the nodes the same %t, got %t", len(test.exp) == 0, same)
+			}
+		})
+	}
+}
+
+func TestDesiredNodeNotPatched(t *testing.T) {
+	// The node has the labeler attributes, with empty maps and lists the labeler doesn't
+	// have.
+	node := testNode("n1", map[string]string{"pool": "a", "team": "ops"}, corev1.Taint{Key: "dedicated", Effect: corev1.TaintEffectNoSchedule})
+	node.Annotations = map[string]string{}
+	s := newNodeServer(node)
+	l := poolLabeler("ops", "a", labelerv1alpha1.LabelerSpec{
+		Merge: mergeSpec(map[string]string{"team": "ops"}, corev1.Taint{Key: "dedicated", Effect: corev1.TaintEffectNoSchedule}),
+	})
+	c, stop := newSyncedLabeler(t, s, Config{}, l)
+	defer stop()
+
+	res, err := c.syncNode("n1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Outcome != ReconcileUnchanged {
+		t.Errorf("expected the node unchanged, got %s", res.Outcome)
+	}
+	if n := s.patchCount(); n != 0 {
+		t.Errorf("expected no patch of a node in the desired state, got %d: %v", n, s.patches)
+	}
+}
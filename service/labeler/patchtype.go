@@ -0,0 +1,389 @@
+package labeler
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/joshisa/resource-labeler-operator/log"
+)
+
+// Patch types of the node mutations.
+const (
+	// PatchMerge is a JSON merge patch (RFC 7386), the default.
+	PatchMerge = "merge"
+	// PatchJSON is a JSON patch (RFC 6902) of operations on the changed fields.
+	PatchJSON = "json"
+	// PatchStrategic is a strategic merge patch, the same as the merge patch for the
+	// node labels, annotations and taints.
+	PatchStrategic = "strategic"
+	// PatchApply is a server-side apply of the labels and annotations owned by the
+	// operator, the rest of the changes are a merge patch.
+	PatchApply = "apply"
+)
+
+// PatchTypes are the valid patch types.
+var PatchTypes = []string{PatchMerge, PatchJSON, PatchStrategic, PatchApply}
+
+const (
+	// applyPatchType is the server-side apply patch type, the vendored client predates it.
+	applyPatchType types.PatchType = "application/apply-patch+yaml"
+	// fieldManager is the server-side apply field manager of the operator, and of the
+	// labelers without their own.
+	fieldManager = "resource-labeler-operator"
+	// maxFieldManagerLength is the longest field manager the API server accepts.
+	maxFieldManagerLength = 128
+)
+
+// minApplyVersion is the first Kubernetes version with server-side apply enabled by
+// default.
+var minApplyVersion = version{1, 16, 0}
+
+// CheckServerSideApply returns an error if the API server doesn't support server-side
+// apply. Up to Kubernetes 1.17 it can be disabled by its feature gate, so a node is
+// applied with a dry run too. A cluster without nodes is only checked by its version.
+func CheckServerSideApply(cli kubernetes.Interface) error {
+	info, err := cli.Discovery().ServerVersion()
+	if err != nil {
+		return fmt.Errorf("could not get the server version: %s", err)
+	}
+	v, err := parseVersion(info.GitVersion)
+	if err != nil {
+		return err
+	}
+	if v.compare(minApplyVersion) < 0 {
+		return fmt.Errorf("server-side apply needs Kubernetes 1.16 or later, the server is %s", info.GitVersion)
+	}
+
+	nodes, err := cli.CoreV1().Nodes().List(metav1.ListOptions{Limit: 1})
+	if err != nil {
+		return fmt.Errorf("could not list the nodes: %s", err)
+	}
+	if len(nodes.Items) == 0 {
+		return nil
+	}
+	name := nodes.Items[0].Name
+	b, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Node",
+		"metadata":   map[string]interface{}{"name": name},
+	})
+	if err != nil {
+		return err
+	}
+	err = cli.CoreV1().RESTClient().Patch(applyPatchType).
+		Resource("nodes").
+		Name(name).
+		Param("fieldManager", fieldManager).
+		Param("dryRun", "All").
+		Body(b).
+		Do().
+		Error()
+	if err != nil {
+		return fmt.Errorf("the dry run apply of node %s failed, is the ServerSideApply feature gate enabled? %s", name, err)
+	}
+	return nil
+}
+
+// sendPatch patches the node with a chunk of the node patch with the configured patch
+// type, conditional on the resource version of the node, through the preferred API
+// server of its zone. On a conflict it's sent again once at the new resource version
+// if only the node status changed, as the kubelet heartbeats do.
+func (c *Labeler) sendPatch(node *corev1.Node, patch map[string]interface{}) (*corev1.Node, error) {
+	send := func(node *corev1.Node) (*corev1.Node, error) {
+		return c.withZoneAPIServer(node, func(cli kubernetes.Interface) (*corev1.Node, error) {
+			return c.sendPatchWith(cli, node, patch)
+		})
+	}
+	patched, err := send(node)
+	if !errors.IsConflict(err) {
+		return patched, err
+	}
+	fresh, ok := c.statusChanged(node)
+	if !ok {
+		return nil, err
+	}
+	log.Debugf(c.nodeLogger(node.Name), "only the status of node %s changed since planned, patched again at resource version %s", node.Name, fresh.ResourceVersion)
+	return send(fresh)
+}
+
+// statusChanged returns the node from the API and true if only its status changed
+// since the node version.
+func (c *Labeler) statusChanged(node *corev1.Node) (*corev1.Node, bool) {
+	c.cycle.apiCall()
+	fresh, err := c.k8sCli.CoreV1().Nodes().Get(node.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, false
+	}
+	current := fresh.DeepCopy()
+	current.ResourceVersion = node.ResourceVersion
+	return fresh, samePatchable(node, current)
+}
+
+// sendPatchWith patches the node with a chunk of the node patch with the client.
+func (c *Labeler) sendPatchWith(cli kubernetes.Interface, node *corev1.Node, patch map[string]interface{}) (*corev1.Node, error) {
+	nodes := cli.CoreV1().Nodes()
+	switch c.cfg.PatchType {
+	case PatchJSON:
+		b, err := jsonPatch(node, patch)
+		if err != nil {
+			return nil, err
+		}
+		c.cycle.apiCall()
+		return nodes.Patch(node.Name, types.JSONPatchType, b)
+	case PatchStrategic:
+		b, err := mergePatch(patch, node.ResourceVersion)
+		if err != nil {
+			return nil, err
+		}
+		c.cycle.apiCall()
+		return nodes.Patch(node.Name, types.StrategicMergePatchType, b)
+	case PatchApply:
+		return c.applyNode(cli, node, patch)
+	default:
+		b, err := mergePatch(patch, node.ResourceVersion)
+		if err != nil {
+			return nil, err
+		}
+		c.cycle.apiCall()
+		return nodes.Patch(node.Name, types.MergePatchType, b)
+	}
+}
+
+// jsonPatchOp is a JSON patch operation.
+type jsonPatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// jsonPatch returns the JSON patch of the node patch, it tests the resource version
+// first so the patch fails if the node changed since it was planned.
+func jsonPatch(node *corev1.Node, patch map[string]interface{}) ([]byte, error) {
+	from, err := toMap(struct {
+		Metadata interface{} `json:"metadata"`
+		Spec     interface{} `json:"spec"`
+	}{node.ObjectMeta, node.Spec})
+	if err != nil {
+		return nil, err
+	}
+	ops := []jsonPatchOp{{Op: "test", Path: "/metadata/resourceVersion", Value: node.ResourceVersion}}
+	return json.Marshal(appendPatchOps(ops, "", from, patch))
+}
+
+// appendPatchOps appends the operations of the merge patch of the object: the null
+// fields are removed, the objects of both are patched recursively and the rest added
+// or replaced.
+func appendPatchOps(ops []jsonPatchOp, prefix string, from, patch map[string]interface{}) []jsonPatchOp {
+	keys := make([]string, 0, len(patch))
+	for k := range patch {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	escaper := strings.NewReplacer("~", "~0", "/", "~1")
+	for _, k := range keys {
+		path := prefix + "/" + escaper.Replace(k)
+		fv, ok := from[k]
+		pv := patch[k]
+		fm, fromObject := fv.(map[string]interface{})
+		pm, patchObject := pv.(map[string]interface{})
+		switch {
+		case pv == nil:
+			if ok {
+				ops = append(ops, jsonPatchOp{Op: "remove", Path: path})
+			}
+		case ok && fromObject && patchObject:
+			ops = appendPatchOps(ops, path, fm, pm)
+		case ok:
+			ops = append(ops, jsonPatchOp{Op: "replace", Path: path, Value: pv})
+		default:
+			ops = append(ops, jsonPatchOp{Op: "add", Path: path, Value: pv})
+		}
+	}
+	return ops
+}
+
+// applyNode applies the labels and annotations owned by the operator on the patched
+// node with server-side apply, one apply by field manager with changed fields: the
+// field managers of the labelers and the operator one, for the labelers without one,
+// the labelers deleted and the annotations of the operator. Every apply has all the
+// fields of its manager, a field left out would be removed by the API server. The
+// owned fields are forced, they are taken over from the other managers like the merge
+// patches overwrite them; the fields the operator doesn't own are never applied. The
+// rest of the patch (the removals, the changed fields not owned and the taints) is a
+// merge patch after the applies.
+func (c *Labeler) applyNode(cli kubernetes.Interface, node *corev1.Node, patch map[string]interface{}) (*corev1.Node, error) {
+	applies, rest := c.nodeApplies(node, patch)
+	applied := node
+	for _, a := range applies {
+		metadata := map[string]interface{}{
+			"name":            node.Name,
+			"resourceVersion": applied.ResourceVersion,
+		}
+		if len(a.labels) > 0 {
+			metadata["labels"] = a.labels
+		}
+		if len(a.annotations) > 0 {
+			metadata["annotations"] = a.annotations
+		}
+		// JSON is valid YAML.
+		b, err := json.Marshal(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Node",
+			"metadata":   metadata,
+		})
+		if err != nil {
+			return nil, err
+		}
+		c.cycle.apiCall()
+		result := &corev1.Node{}
+		err = cli.CoreV1().RESTClient().Patch(applyPatchType).
+			Resource("nodes").
+			Name(node.Name).
+			Param("fieldManager", a.manager).
+			Param("force", "true").
+			Body(b).
+			Do().
+			Into(result)
+		if err != nil {
+			return nil, err
+		}
+		applied = result
+	}
+	if len(rest) == 0 {
+		return applied, nil
+	}
+
+	b, err := mergePatch(rest, applied.ResourceVersion)
+	if err != nil {
+		return nil, err
+	}
+	c.cycle.apiCall()
+	return cli.CoreV1().Nodes().Patch(node.Name, types.MergePatchType, b)
+}
+
+// nodeApply is a server-side apply of the owned fields of a field manager.
+type nodeApply struct {
+	manager     string
+	labels      map[string]string
+	annotations map[string]string
+}
+
+// nodeApplies returns the applies of the field managers whose owned fields the node
+// patch changes, sorted by manager, and the rest of the patch.
+func (c *Labeler) nodeApplies(node *corev1.Node, patch map[string]interface{}) ([]nodeApply, map[string]interface{}) {
+	metadata, _ := patch["metadata"].(map[string]interface{})
+	labelsPatch, _ := metadata["labels"].(map[string]interface{})
+	annotationsPatch, _ := metadata["annotations"].(map[string]interface{})
+	labels := appliedValues(node.Labels, labelsPatch)
+	annotations := appliedValues(node.Annotations, annotationsPatch)
+
+	// The managers of the owned keys once patched.
+	managers := map[string]string{}
+	owned := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}}
+	for name, keys := range ownedKeys(owned, c.cfg.OwnerAnnotation) {
+		m := c.fieldManager(name)
+		for _, k := range keys {
+			if !strings.HasPrefix(k, taintsPrefix) {
+				managers[k] = m
+			}
+		}
+	}
+	for _, a := range []string{c.cfg.OwnerAnnotation, c.cfg.ContentHashAnnotation, c.cfg.AppliedByAnnotation, c.cfg.AppliedAtAnnotation, c.cfg.FingerprintAnnotation} {
+		if a != "" {
+			managers[annotationsPrefix+a] = fieldManager
+		}
+	}
+
+	// The managers with changed fields, the applied changes are not in the rest.
+	changed := map[string]bool{}
+	restLabels, restAnnotations := map[string]interface{}{}, map[string]interface{}{}
+	for _, p := range []struct {
+		prefix string
+		patch  map[string]interface{}
+		rest   map[string]interface{}
+	}{{labelsPrefix, labelsPatch, restLabels}, {annotationsPrefix, annotationsPatch, restAnnotations}} {
+		for k, v := range p.patch {
+			if m, ok := managers[p.prefix+k]; ok && v != nil {
+				changed[m] = true
+				continue
+			}
+			p.rest[k] = v
+		}
+	}
+
+	applies := map[string]*nodeApply{}
+	for k, m := range managers {
+		if !changed[m] {
+			continue
+		}
+		a, ok := applies[m]
+		if !ok {
+			a = &nodeApply{manager: m, labels: map[string]string{}, annotations: map[string]string{}}
+			applies[m] = a
+		}
+		if strings.HasPrefix(k, labelsPrefix) {
+			if v, ok := labels[strings.TrimPrefix(k, labelsPrefix)]; ok {
+				a.labels[strings.TrimPrefix(k, labelsPrefix)] = v
+			}
+		} else if v, ok := annotations[strings.TrimPrefix(k, annotationsPrefix)]; ok {
+			a.annotations[strings.TrimPrefix(k, annotationsPrefix)] = v
+		}
+	}
+	sorted := make([]nodeApply, 0, len(applies))
+	for _, a := range applies {
+		sorted = append(sorted, *a)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].manager < sorted[j].manager })
+
+	rest := map[string]interface{}{}
+	restMetadata := map[string]interface{}{}
+	if len(restLabels) > 0 {
+		restMetadata["labels"] = restLabels
+	}
+	if len(restAnnotations) > 0 {
+		restMetadata["annotations"] = restAnnotations
+	}
+	if len(restMetadata) > 0 {
+		rest["metadata"] = restMetadata
+	}
+	if spec, ok := patch["spec"]; ok {
+		rest["spec"] = spec
+	}
+	return sorted, rest
+}
+
+// fieldManager returns the field manager of the labeler: its own, otherwise the
+// operator one.
+func (c *Labeler) fieldManager(name string) string {
+	if lc, ok := c.reg.Load(name); ok {
+		if m := lc.(*LabelController).l.Spec.FieldManager; m != "" {
+			return m
+		}
+	}
+	return fieldManager
+}
+
+// appliedValues returns the labels or annotations of the node with their patch.
+func appliedValues(current map[string]string, patch map[string]interface{}) map[string]string {
+	values := make(map[string]string, len(current))
+	for k, v := range current {
+		values[k] = v
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(values, k)
+			continue
+		}
+		values[k], _ = v.(string)
+	}
+	return values
+}
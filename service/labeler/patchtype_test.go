@@ -0,0 +1,414 @@
+package labeler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	kooperlog "github.com/spotahome/kooper/log"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// patchRequest is a node patch received by the test API server.
+type patchRequest struct {
+	contentType string
+	query       map[string]string
+	body        interface{}
+}
+
+// patchServer is a test API server answering the node patches with the node at a new
+// resource version.
+type patchServer struct {
+	mu       sync.Mutex
+	version  string
+	nodes    []corev1.Node
+	applyErr int
+	requests []patchRequest
+}
+
+func (s *patchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.URL.Path == "/version":
+		json.NewEncoder(w).Encode(map[string]string{"gitVersion": s.version})
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/nodes":
+		json.NewEncoder(w).Encode(corev1.NodeList{Items: s.nodes})
+	case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/api/v1/nodes/"):
+		b, _ := ioutil.ReadAll(r.Body)
+		req := patchRequest{contentType: r.Header.Get("Content-Type"), query: map[string]string{}}
+		json.Unmarshal(b, &req.body)
+		for k := range r.URL.Query() {
+			req.query[k] = r.URL.Query().Get(k)
+		}
+		s.requests = append(s.requests, req)
+		if s.applyErr != 0 && req.contentType == string(applyPatchType) {
+			w.WriteHeader(s.applyErr)
+			json.NewEncoder(w).Encode(metav1.Status{Status: metav1.StatusFailure, Code: int32(s.applyErr)})
+			return
+		}
+		node := corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:            strings.TrimPrefix(r.URL.Path, "/api/v1/nodes/"),
+			ResourceVersion: strconv.Itoa(len(s.requests) + 1),
+		}}
+		json.NewEncoder(w).Encode(node)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newPatchServer(t *testing.T, s *patchServer) (kubernetes.Interface, func()) {
+	srv := httptest.NewServer(s)
+	cli, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cli, srv.Close
+}
+
+// decode returns a JSON value as decoded from a request body.
+func decode(t *testing.T, s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestSendPatchWith(t *testing.T) {
+	const owner = "owned-keys"
+	node := testNode("n1", map[string]string{"kube": "v", "owned": "old", "dropped": "v"})
+	node.ResourceVersion = "1"
+	node.Annotations = map[string]string{owner: `{"l1":["labels/dropped","labels/owned"]}`}
+	// l1 stops owning dropped and changes owned, l2 sets fm, kube is changed by a
+	// labeler not owning it.
+	patch := func() map[string]interface{} {
+		return map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"labels":      map[string]interface{}{"owned": "new", "kube": "x", "dropped": nil, "fm": "v"},
+				"annotations": map[string]interface{}{owner: `{"l1":["labels/owned"],"l2":["labels/fm"]}`},
+			},
+			"spec": map[string]interface{}{"taints": []interface{}{map[string]interface{}{"key": "t", "effect": "NoSchedule"}}},
+		}
+	}
+	mergeBody := `{
+		"metadata": {
+			"resourceVersion": "1",
+			"labels": {"owned": "new", "kube": "x", "dropped": null, "fm": "v"},
+			"annotations": {"owned-keys": "{\"l1\":[\"labels/owned\"],\"l2\":[\"labels/fm\"]}"}
+		},
+		"spec": {"taints": [{"key": "t", "effect": "NoSchedule"}]}
+	}`
+
+	tests := []struct {
+		name      string
+		patchType string
+		exp       []patchRequest
+	}{
+		{
+			name:      "A merge patch has the changes and the resource version.",
+			patchType: PatchMerge,
+			exp:       []patchRequest{{contentType: "application/merge-patch+json", body: decode(t, mergeBody)}},
+		},
+		{
+			name:      "A strategic merge patch has the same body as the merge patch.",
+			patchType: PatchStrategic,
+			exp:       []patchRequest{{contentType: "application/strategic-merge-patch+json", body: decode(t, mergeBody)}},
+		},
+		{
+			name:      "A JSON patch tests the resource version first.",
+			patchType: PatchJSON,
+			exp: []patchRequest{{contentType: "application/json-patch+json", body: decode(t, `[
+				{"op": "test", "path": "/metadata/resourceVersion", "value": "1"},
+				{"op": "replace", "path": "/metadata/annotations/owned-keys", "value": "{\"l1\":[\"labels/owned\"],\"l2\":[\"labels/fm\"]}"},
+				{"op": "remove", "path": "/metadata/labels/dropped"},
+				{"op": "add", "path": "/metadata/labels/fm", "value": "v"},
+				{"op": "replace", "path": "/metadata/labels/kube", "value": "x"},
+				{"op": "replace", "path": "/metadata/labels/owned", "value": "new"},
+				{"op": "add", "path": "/spec/taints", "value": [{"key": "t", "effect": "NoSchedule"}]}
+			]`)}},
+		},
+		{
+			name:      "An apply only has the owned fields, by field manager, the rest is a merge patch.",
+			patchType: PatchApply,
+			exp: []patchRequest{
+				{
+					contentType: string(applyPatchType),
+					query:       map[string]string{"fieldManager": "l2-manager", "force": "true"},
+					body: decode(t, `{"apiVersion": "v1", "kind": "Node", "metadata": {
+						"name": "n1", "resourceVersion": "1", "labels": {"fm": "v"}
+					}}`),
+				},
+				{
+					contentType: string(applyPatchType),
+					query:       map[string]string{"fieldManager": fieldManager, "force": "true"},
+					body: decode(t, `{"apiVersion": "v1", "kind": "Node", "metadata": {
+						"name": "n1", "resourceVersion": "2", "labels": {"owned": "new"},
+						"annotations": {"owned-keys": "{\"l1\":[\"labels/owned\"],\"l2\":[\"labels/fm\"]}"}
+					}}`),
+				},
+				{
+					contentType: "application/merge-patch+json",
+					body: decode(t, `{
+						"metadata": {"resourceVersion": "3", "labels": {"kube": "x", "dropped": null}},
+						"spec": {"taints": [{"key": "t", "effect": "NoSchedule"}]}
+					}`),
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &patchServer{}
+			cli, stop := newPatchServer(t, s)
+			defer stop()
+			c := &Labeler{cfg: Config{OwnerAnnotation: owner, PatchType: test.patchType}.withDefaults(), logger: kooperlog.Dummy}
+			l2 := &labelerv1alpha1.Labeler{
+				ObjectMeta: metav1.ObjectMeta{Name: "l2"},
+				Spec:       labelerv1alpha1.LabelerSpec{FieldManager: "l2-manager"},
+			}
+			c.reg.Store(l2.Name, NewLabelController(c.cfg, l2, cache.NewStore(cache.MetaNamespaceKeyFunc), kooperlog.Dummy))
+
+			if _, err := c.sendPatchWith(cli, node, patch()); err != nil {
+				t.Fatal(err)
+			}
+			for i := range test.exp {
+				if test.exp[i].query == nil {
+					test.exp[i].query = map[string]string{}
+				}
+			}
+			if !reflect.DeepEqual(s.requests, test.exp) {
+				got, _ := json.MarshalIndent(s.requests, "", "  ")
+				t.Errorf("unexpected requests %d (expected %d): %+v", len(s.requests), len(test.exp), string(got))
+				for i := range s.requests {
+					if i < len(test.exp) && !reflect.DeepEqual(s.requests[i], test.exp[i]) {
+						t.Errorf("request %d: expected %+v, got %+v", i+1, test.exp[i], s.requests[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCheckServerSideApply(t *testing.T) {
+	nodes := []corev1.Node{*testNode("n1", nil)}
+	tests := []struct {
+		name     string
+		server   *patchServer
+		expErr   bool
+		expProbe bool
+	}{
+		{
+			name:   "A server before 1.16 is rejected.",
+			server: &patchServer{version: "v1.15.3", nodes: nodes},
+			expErr: true,
+		},
+		{
+			name:     "A server whose dry run apply fails is rejected, the feature gate is off.",
+			server:   &patchServer{version: "v1.17.2", nodes: nodes, applyErr: http.StatusUnsupportedMediaType},
+			expErr:   true,
+			expProbe: true,
+		},
+		{
+			name:     "A server applying a node with a dry run is accepted.",
+			server:   &patchServer{version: "v1.17.2", nodes: nodes},
+			expProbe: true,
+		},
+		{
+			name:   "A server without nodes is only checked by its version.",
+			server: &patchServer{version: "v1.18.0"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cli, stop := newPatchServer(t, test.server)
+			defer stop()
+			err := CheckServerSideApply(cli)
+			if (err != nil) != test.expErr {
+				t.Errorf("expected error %t, got %v", test.expErr, err)
+			}
+			if probed := len(test.server.requests) == 1; probed != test.expProbe {
+				t.Fatalf("expected a dry run apply %t, got %d requests", test.expProbe, len(test.server.requests))
+			}
+			if test.expProbe {
+				if q := test.server.requests[0].query; q["dryRun"] != "All" {
+					t.Errorf("expected a dry run apply, got %v", q)
+				}
+			}
+		})
+	}
+}
+
+// heartbeatServer is a test API server whose node got a heartbeat since planned at
+// resource version 1, the patches at that version conflict.
+type heartbeatServer struct {
+	mu      sync.Mutex
+	node    corev1.Node
+	gets    int
+	patches []string
+}
+
+func (s *heartbeatServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		s.gets++
+		json.NewEncoder(w).Encode(s.node)
+	case http.MethodPatch:
+		var body struct {
+			Metadata metav1.ObjectMeta `json:"metadata"`
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(b, &body)
+		s.patches = append(s.patches, body.Metadata.ResourceVersion)
+		if body.Metadata.ResourceVersion != s.node.ResourceVersion {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(metav1.Status{Status: metav1.StatusFailure, Code: http.StatusConflict, Reason: metav1.StatusReasonConflict})
+			return
+		}
+		v, _ := strconv.Atoi(s.node.ResourceVersion)
+		s.node.ResourceVersion = strconv.Itoa(v + 1)
+		json.NewEncoder(w).Encode(s.node)
+	}
+}
+
+func TestSendPatchRetriesStatusConflicts(t *testing.T) {
+	planned := testNode("n1", map[string]string{"kube": "v"})
+	planned.ResourceVersion = "1"
+	tests := []struct {
+		name       string
+		current    *corev1.Node
+		expErr     bool
+		expPatches []string
+	}{
+		{
+			name: "A node whose status changed is patched again at its new version.",
+			current: func() *corev1.Node {
+				n := planned.DeepCopy()
+				n.ResourceVersion = "2"
+				n.Status.Conditions = []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}
+				return n
+			}(),
+			expPatches: []string{"1", "2"},
+		},
+		{
+			name: "A node whose labels changed is not patched again.",
+			current: func() *corev1.Node {
+				n := testNode("n1", map[string]string{"kube": "x"})
+				n.ResourceVersion = "2"
+				return n
+			}(),
+			expErr:     true,
+			expPatches: []string{"1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &heartbeatServer{node: *test.current}
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+			cli, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := &Labeler{cfg: Config{}.withDefaults(), logger: kooperlog.Dummy, k8sCli: cli}
+
+			_, err = c.sendPatch(planned, map[string]interface{}{"metadata": map[string]interface{}{"labels": map[string]interface{}{"role": "gpu"}}})
+			if (err != nil) != test.expErr {
+				t.Errorf("expected error %t, got %v", test.expErr, err)
+			}
+			if !reflect.DeepEqual(s.patches, test.expPatches) {
+				t.Errorf("expected patches at versions %v, got %v", test.expPatches, s.patches)
+			}
+			if s.gets != 1 {
+				t.Errorf("expected the node got once on conflict, got %d", s.gets)
+			}
+		})
+	}
+}
+
+func TestAppendPatchOps(t *testing.T) {
+	from := map[string]interface{}{
+		"labels": map[string]interface{}{"pool": "a", "example.com/zone": "eu", "old": "x"},
+		"taints": []interface{}{"t1"},
+	}
+	tests := []struct {
+		name  string
+		patch map[string]interface{}
+		exp   []jsonPatchOp
+	}{
+		{
+			name:  "A changed field is replaced and a new one added.",
+			patch: map[string]interface{}{"labels": map[string]interface{}{"pool": "b", "team": "ops"}},
+			exp:   []jsonPatchOp{{Op: "replace", Path: "/labels/pool", Value: "b"}, {Op: "add", Path: "/labels/team", Value: "ops"}},
+		},
+		{
+			name:  "A null field is removed, a missing one is skipped.",
+			patch: map[string]interface{}{"labels": map[string]interface{}{"old": nil, "missing": nil}},
+			exp:   []jsonPatchOp{{Op: "remove", Path: "/labels/old"}},
+		},
+		{
+			name:  "The pointer of a key is escaped.",
+			patch: map[string]interface{}{"labels": map[string]interface{}{"example.com/zone": "us", "a~b": "1"}},
+			exp:   []jsonPatchOp{{Op: "add", Path: "/labels/a~0b", Value: "1"}, {Op: "replace", Path: "/labels/example.com~1zone", Value: "us"}},
+		},
+		{
+			name:  "A list is replaced as a whole.",
+			patch: map[string]interface{}{"taints": []interface{}{"t2"}},
+			exp:   []jsonPatchOp{{Op: "replace", Path: "/taints", Value: []interface{}{"t2"}}},
+		},
+		{
+			name:  "A missing object is added as a whole.",
+			patch: map[string]interface{}{"annotations": map[string]interface{}{"a": "1"}},
+			exp:   []jsonPatchOp{{Op: "add", Path: "/annotations", Value: map[string]interface{}{"a": "1"}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := appendPatchOps(nil, "", from, test.patch); !reflect.DeepEqual(got, test.exp) {
+				t.Errorf("expected the operations %+v, got %+v", test.exp, got)
+			}
+		})
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	node := testNode("n1", map[string]string{"pool": "a"})
+	node.ResourceVersion = "7"
+	b, err := jsonPatch(node, map[string]interface{}{"metadata": map[string]interface{}{"labels": map[string]interface{}{"pool": nil, "team": "ops"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []map[string]interface{}
+	if err := json.Unmarshal(b, &ops); err != nil {
+		t.Fatal(err)
+	}
+	exp := []map[string]interface{}{
+		{"op": "test", "path": "/metadata/resourceVersion", "value": "7"},
+		{"op": "remove", "path": "/metadata/labels/pool"},
+		{"op": "add", "path": "/metadata/labels/team", "value": "ops"},
+	}
+	if !reflect.DeepEqual(ops, exp) {
+		t.Errorf("expected the patch testing the resource version %v, got %v", exp, ops)
+	}
+}
@@ -0,0 +1,104 @@
+package labeler
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/joshisa/resource-labeler-operator/metrics"
+)
+
+// podNodeIndex is the index of the pods by their node name.
+const podNodeIndex = "nodeName"
+
+// PodStore is where the label controllers get the pods assigned to a node from.
+type PodStore interface {
+	// NodePods returns the pods assigned to the node.
+	NodePods(nodeName string) ([]*corev1.Pod, error)
+}
+
+// newPodInformer returns a new pod informer indexed by node. Assigning and removing
+// pods queues their node to be synced.
+func (c *Labeler) newPodInformer() cache.SharedIndexInformer {
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			c.selectNode(&options, "spec.nodeName")
+			return c.k8sCli.CoreV1().Pods(metav1.NamespaceAll).List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			c.selectNode(&options, "spec.nodeName")
+			return c.k8sCli.CoreV1().Pods(metav1.NamespaceAll).Watch(options)
+		},
+	}
+	informer := cache.NewSharedIndexInformer(lw, &corev1.Pod{}, c.cfg.ResyncPeriod, cache.Indexers{
+		podNodeIndex: func(obj interface{}) ([]string, error) {
+			pod, ok := obj.(*corev1.Pod)
+			if !ok || pod.Spec.NodeName == "" {
+				return nil, nil
+			}
+			return []string{pod.Spec.NodeName}, nil
+		},
+	})
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.onPodChange,
+		UpdateFunc: c.onPodUpdate,
+		DeleteFunc: c.onPodChange,
+	})
+	return informer
+}
+
+// onPodUpdate queues the node of the pod when the pod is assigned to it or terminated,
+// the rest of the updates don't change the pods counted on the node.
+func (c *Labeler) onPodUpdate(old, new interface{}) {
+	op, ok1 := old.(*corev1.Pod)
+	np, ok2 := new.(*corev1.Pod)
+	if ok1 && ok2 && op.Spec.NodeName == np.Spec.NodeName && podTerminated(op) == podTerminated(np) {
+		return
+	}
+	c.onPodChange(new)
+}
+
+// onPodChange queues the node the pod is assigned to.
+func (c *Labeler) onPodChange(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pod, ok := obj.(*corev1.Pod)
+	if !ok || pod.Spec.NodeName == "" {
+		return
+	}
+	c.cfg.MetricsRecorder.SetInformerLastSync(metrics.InformerPods, time.Now())
+	c.enqueue(pod.Spec.NodeName)
+}
+
+// podsSynced returns true if the pod informer is disabled or has synced.
+func (c *Labeler) podsSynced() bool {
+	return c.podInformer == nil || c.podInformer.HasSynced()
+}
+
+// NodePods satisfies PodStore interface.
+func (c *Labeler) NodePods(nodeName string) ([]*corev1.Pod, error) {
+	objs, err := c.podInformer.GetIndexer().ByIndex(podNodeIndex, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	pods := make([]*corev1.Pod, 0, len(objs))
+	for _, obj := range objs {
+		pod, ok := obj.(*corev1.Pod)
+		if !ok {
+			return nil, fmt.Errorf("invalid pod object on node %s", nodeName)
+		}
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+// podTerminated returns true if the pod doesn't use the node resources anymore.
+func podTerminated(pod *corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed
+}
@@ -0,0 +1,358 @@
+package labeler
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Priority classes of the node queue, the nodes of high priority labelers are synced
+// before a backlog of the rest.
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+// Priorities are the priority classes from the highest.
+var Priorities = []string{PriorityHigh, PriorityNormal, PriorityLow}
+
+// prioritySlots is the weighted round robin of the Gets, the priority served first on
+// every slot, so a backlog of high priority nodes leaves 2 of 7 syncs to the normal
+// ones and 1 of 7 to the low ones.
+var prioritySlots = []string{PriorityHigh, PriorityHigh, PriorityNormal, PriorityHigh, PriorityNormal, PriorityHigh, PriorityLow}
+
+// priorityRank returns the order of the priority class, the highest first. Unknown
+// classes are normal.
+func priorityRank(priority string) int {
+	for i, p := range Priorities {
+		if p == priority {
+			return i
+		}
+	}
+	return 1
+}
+
+// trackedQueue is the node queue keeping track of its keys so it can be inspected,
+// workqueue doesn't list them. Like workqueue a key is queued once and never processed
+// concurrently, and the ready keys are served by priority class.
+type trackedQueue struct {
+	name    string
+	limiter workqueue.RateLimiter
+	// priority returns the priority class of a key, nil queues all of them as normal.
+	priority func(key string) string
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// ready are the keys ready to be processed of every priority, in order.
+	ready map[string][]interface{}
+	// waiting are the queued keys with their priority, the ones being processed are
+	// queued again once done.
+	waiting    map[interface{}]string
+	delayed    map[interface{}]time.Time
+	processing map[interface{}]bool
+	gets       int
+	shutdown   bool
+	// retryFactor multiplies the rate limited delays, 1 unless under backpressure.
+	retryFactor int64
+}
+
+func newTrackedQueue(name string) *trackedQueue {
+	q := &trackedQueue{
+		name:        name,
+		limiter:     workqueue.DefaultControllerRateLimiter(),
+		ready:       map[string][]interface{}{},
+		waiting:     map[interface{}]string{},
+		delayed:     map[interface{}]time.Time{},
+		processing:  map[interface{}]bool{},
+		retryFactor: 1,
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Add satisfies workqueue.Interface interface. A queued key raised to a higher
+// priority moves to it.
+func (q *trackedQueue) Add(item interface{}) {
+	priority := PriorityNormal
+	if key, ok := item.(string); ok && q.priority != nil {
+		priority = Priorities[priorityRank(q.priority(key))]
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.shutdown {
+		return
+	}
+	if prev, ok := q.waiting[item]; ok {
+		if priorityRank(priority) >= priorityRank(prev) {
+			return
+		}
+		if !q.processing[item] {
+			q.ready[prev] = withoutItem(q.ready[prev], item)
+		}
+	}
+	q.waiting[item] = priority
+	if q.processing[item] {
+		return
+	}
+	q.ready[priority] = append(q.ready[priority], item)
+	q.cond.Signal()
+}
+
+func withoutItem(items []interface{}, item interface{}) []interface{} {
+	for i, it := range items {
+		if it == item {
+			return append(items[:i:i], items[i+1:]...)
+		}
+	}
+	return items
+}
+
+// AddAfter satisfies workqueue.DelayingInterface interface.
+func (q *trackedQueue) AddAfter(item interface{}, duration time.Duration) {
+	if duration <= 0 {
+		q.Add(item)
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.shutdown {
+		return
+	}
+	// Like workqueue, the earliest time wins.
+	readyAt := time.Now().Add(duration)
+	if t, ok := q.delayed[item]; ok && !readyAt.Before(t) {
+		return
+	}
+	q.delayed[item] = readyAt
+	time.AfterFunc(duration, func() {
+		q.mu.Lock()
+		current := q.delayed[item] == readyAt
+		if current {
+			delete(q.delayed, item)
+		}
+		q.mu.Unlock()
+		if current {
+			q.Add(item)
+		}
+	})
+}
+
+// AddRateLimited satisfies workqueue.RateLimitingInterface interface.
+func (q *trackedQueue) AddRateLimited(item interface{}) {
+	q.AddAfter(item, q.limiter.When(item)*time.Duration(atomic.LoadInt64(&q.retryFactor)))
+}
+
+// setRetryFactor sets the multiplier of the rate limited delays.
+func (q *trackedQueue) setRetryFactor(f int64) {
+	atomic.StoreInt64(&q.retryFactor, f)
+}
+
+// Forget satisfies workqueue.RateLimitingInterface interface.
+func (q *trackedQueue) Forget(item interface{}) {
+	q.limiter.Forget(item)
+}
+
+// NumRequeues satisfies workqueue.RateLimitingInterface interface.
+func (q *trackedQueue) NumRequeues(item interface{}) int {
+	return q.limiter.NumRequeues(item)
+}
+
+// Get satisfies workqueue.Interface interface, it blocks until a key is ready.
+func (q *trackedQueue) Get() (interface{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.readyLen() == 0 && !q.shutdown {
+		q.cond.Wait()
+	}
+	if q.readyLen() == 0 {
+		return nil, true
+	}
+
+	priority := prioritySlots[q.gets%len(prioritySlots)]
+	q.gets++
+	if len(q.ready[priority]) == 0 {
+		for _, p := range Priorities {
+			if len(q.ready[p]) > 0 {
+				priority = p
+				break
+			}
+		}
+	}
+	item := q.ready[priority][0]
+	q.ready[priority] = q.ready[priority][1:]
+	delete(q.waiting, item)
+	q.processing[item] = true
+	return item, false
+}
+
+// Done satisfies workqueue.Interface interface, the key queued again while being
+// processed is ready again.
+func (q *trackedQueue) Done(item interface{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.processing, item)
+	if priority, ok := q.waiting[item]; ok {
+		q.ready[priority] = append(q.ready[priority], item)
+		q.cond.Signal()
+	}
+}
+
+// Len satisfies workqueue.Interface interface, the number of ready keys.
+func (q *trackedQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.readyLen()
+}
+
+func (q *trackedQueue) readyLen() int {
+	n := 0
+	for _, items := range q.ready {
+		n += len(items)
+	}
+	return n
+}
+
+// depths returns the number of ready keys of every priority.
+func (q *trackedQueue) depths() map[string]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	depths := make(map[string]int, len(Priorities))
+	for _, p := range Priorities {
+		depths[p] = len(q.ready[p])
+	}
+	return depths
+}
+
+// ShutDown satisfies workqueue.Interface interface, the Gets return once the ready
+// keys are processed.
+func (q *trackedQueue) ShutDown() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.shutdown = true
+	q.cond.Broadcast()
+}
+
+// ShuttingDown satisfies workqueue.Interface interface.
+func (q *trackedQueue) ShuttingDown() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.shutdown
+}
+
+// DelayedKey is a key queued after a delay.
+type DelayedKey struct {
+	Key     string    `json:"key"`
+	ReadyAt time.Time `json:"readyAt"`
+}
+
+// QueueSnapshot is the content of the node queue at a point in time.
+type QueueSnapshot struct {
+	// Name is the name of the node queue.
+	Name string `json:"name"`
+	// Length is the number of keys ready to be synced.
+	Length int `json:"length"`
+	// Depths are the number of keys ready to be synced by priority class.
+	Depths map[string]int `json:"depths"`
+	// Waiting are the keys ready to be synced.
+	Waiting []string `json:"waiting"`
+	// Delayed are the keys that will be ready after a delay (e.g. requeues, retries).
+	Delayed []DelayedKey `json:"delayed"`
+	// Processing are the keys being synced.
+	Processing []string `json:"processing"`
+	// Retries are the failed syncs of the keys being retried.
+	Retries map[string]int `json:"retries"`
+}
+
+// snapshot returns the keys of the queue sorted.
+func (q *trackedQueue) snapshot() QueueSnapshot {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s := QueueSnapshot{
+		Name:       q.name,
+		Length:     q.readyLen(),
+		Waiting:    []string{},
+		Delayed:    []DelayedKey{},
+		Processing: []string{},
+		Depths:     map[string]int{},
+		Retries:    map[string]int{},
+	}
+	for _, p := range Priorities {
+		s.Depths[p] = len(q.ready[p])
+	}
+	retries := func(item interface{}) {
+		if n := q.NumRequeues(item); n > 0 {
+			s.Retries[item.(string)] = n
+		}
+	}
+	for item := range q.waiting {
+		s.Waiting = append(s.Waiting, item.(string))
+		retries(item)
+	}
+	for item, t := range q.delayed {
+		s.Delayed = append(s.Delayed, DelayedKey{Key: item.(string), ReadyAt: t})
+		retries(item)
+	}
+	for item := range q.processing {
+		s.Processing = append(s.Processing, item.(string))
+		retries(item)
+	}
+	sort.Strings(s.Waiting)
+	sort.Slice(s.Delayed, func(i, j int) bool { return s.Delayed[i].ReadyAt.Before(s.Delayed[j].ReadyAt) })
+	sort.Strings(s.Processing)
+	return s
+}
+
+// nodePriority returns the highest priority class of the labelers selecting the node
+// or applied to it, the labelers without class are normal. The nodes without labelers
+// or not cached are normal.
+func (c *Labeler) nodePriority(key string) string {
+	var lcs []*LabelController
+	classes := false
+	c.reg.Range(func(_, v interface{}) bool {
+		lc := v.(*LabelController)
+		lcs = append(lcs, lc)
+		classes = classes || lc.l.Spec.PriorityClass != ""
+		return true
+	})
+	if !classes {
+		return PriorityNormal
+	}
+	obj, ok, err := c.informer().GetStore().GetByKey(key)
+	if err != nil || !ok {
+		return PriorityNormal
+	}
+	node, ok := obj.(*corev1.Node)
+	if !ok {
+		return PriorityNormal
+	}
+
+	owned := ownedKeys(node, c.cfg.OwnerAnnotation)
+	priority := ""
+	for _, lc := range lcs {
+		pc := lc.l.Spec.PriorityClass
+		if pc == "" {
+			pc = PriorityNormal
+		}
+		if priority != "" && priorityRank(pc) >= priorityRank(priority) {
+			continue
+		}
+		if _, ok := owned[lc.l.Name]; ok || NodeMatchesNodeSelectorTerms(node, lc.l.Spec.NodeSelectorTerms) {
+			priority = pc
+		}
+	}
+	if priority == "" {
+		return PriorityNormal
+	}
+	return priority
+}
+
+// QueueSnapshot returns the content of the node queue.
+func (c *Labeler) QueueSnapshot() QueueSnapshot {
+	return c.queue.snapshot()
+}
@@ -0,0 +1,125 @@
+package labeler
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTrackedQueue(t *testing.T) {
+	q := slowRetryQueue()
+	defer q.ShutDown()
+
+	// A queued key is queued once.
+	q.Add("n1")
+	q.Add("n2")
+	q.Add("n1")
+	if n := q.Len(); n != 2 {
+		t.Fatalf("expected 2 ready keys, got %d", n)
+	}
+
+	// A key queued while processed is ready once done.
+	key, _ := q.Get()
+	q.Add(key)
+	snap := q.snapshot()
+	if !reflect.DeepEqual(snap.Processing, []string{"n1"}) || !reflect.DeepEqual(snap.Waiting, []string{"n1", "n2"}) || snap.Length != 1 {
+		t.Errorf("expected n1 processing and queued again, got %+v", snap)
+	}
+	q.Done(key)
+	if n := q.Len(); n != 2 {
+		t.Errorf("expected n1 ready again once done, got %d ready keys", n)
+	}
+
+	// The earliest delay wins.
+	q.AddAfter("n3", time.Hour)
+	q.AddAfter("n3", time.Minute)
+	q.AddAfter("n3", 2*time.Hour)
+	delayed := q.snapshot().Delayed
+	if len(delayed) != 1 || delayed[0].Key != "n3" || time.Until(delayed[0].ReadyAt) > time.Minute {
+		t.Errorf("expected n3 delayed a minute, got %+v", delayed)
+	}
+	q.AddAfter("n4", time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	if snap := q.snapshot(); len(snap.Delayed) != 1 || snap.Length != 3 {
+		t.Errorf("expected n4 ready after its delay, got %+v", snap)
+	}
+
+	// The retries of the keys are listed.
+	q.AddRateLimited("n5")
+	if retries := q.snapshot().Retries; retries["n5"] != 1 {
+		t.Errorf("expected the retry of n5, got %v", retries)
+	}
+}
+
+func TestTrackedQueueShutDown(t *testing.T) {
+	q := newTrackedQueue("test")
+	q.Add("n1")
+	q.ShutDown()
+	q.Add("n2")
+
+	// The ready keys are still served, then the Gets return.
+	if key, shutdown := q.Get(); key != "n1" || shutdown {
+		t.Errorf("expected n1 served, got %v (shut down %t)", key, shutdown)
+	}
+	done := make(chan bool)
+	go func() {
+		_, shutdown := q.Get()
+		done <- shutdown
+	}()
+	select {
+	case shutdown := <-done:
+		if !shutdown {
+			t.Errorf("expected the queue shut down")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the Get to return once the queue is shut down")
+	}
+}
+
+func TestTrackedQueuePriorities(t *testing.T) {
+	// The class of a key is the class of its first letter.
+	priorities := map[string]string{"h": PriorityHigh, "n": PriorityNormal, "l": PriorityLow, "u": "unknown"}
+	priorityQueue := func() *trackedQueue {
+		q := newTrackedQueue("test")
+		q.priority = func(key string) string { return priorities[key[:1]] }
+		return q
+	}
+
+	// A backlog of every class is served by the weighted round robin.
+	q := priorityQueue()
+	defer q.ShutDown()
+	for _, class := range []string{"h", "n", "l"} {
+		for i := 0; i < 10; i++ {
+			q.Add(fmt.Sprintf("%s%d", class, i))
+		}
+	}
+	served := map[string]int{}
+	for i := 0; i < len(prioritySlots); i++ {
+		key, _ := q.Get()
+		served[priorities[key.(string)[:1]]]++
+		q.Done(key)
+	}
+	if exp := map[string]int{PriorityHigh: 4, PriorityNormal: 2, PriorityLow: 1}; !reflect.DeepEqual(served, exp) {
+		t.Errorf("expected the syncs by class %v, got %v", exp, served)
+	}
+
+	// An unknown class is normal, a key raised to a higher class moves to it and a
+	// lowered one keeps its class.
+	raised := priorityQueue()
+	defer raised.ShutDown()
+	raised.Add("u1")
+	if depths := raised.depths(); depths[PriorityNormal] != 1 {
+		t.Errorf("expected the unknown class queued as normal, got %v", depths)
+	}
+	priorities["u"] = PriorityHigh
+	raised.Add("u1")
+	if depths := raised.depths(); depths[PriorityNormal] != 0 || depths[PriorityHigh] != 1 {
+		t.Errorf("expected the raised key moved to high, got %v", depths)
+	}
+	priorities["u"] = PriorityLow
+	raised.Add("u1")
+	if depths := raised.depths(); depths[PriorityHigh] != 1 || depths[PriorityLow] != 0 {
+		t.Errorf("expected the lowered key kept high, got %v", depths)
+	}
+}
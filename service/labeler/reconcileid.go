@@ -0,0 +1,68 @@
+package labeler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/joshisa/resource-labeler-operator/log"
+)
+
+// reconcileField is the log field with the request ID of the node sync.
+const reconcileField = "reconcile"
+
+// newRequestID returns a new random request ID.
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// beginReconcile records a new request ID for the sync of the node. The queue never
+// syncs a node in several workers at once.
+func (c *Labeler) beginReconcile(key string) string {
+	id := newRequestID()
+	c.requestIDs.Store(key, id)
+	return id
+}
+
+// endReconcile drops the request ID of the sync of the node.
+func (c *Labeler) endReconcile(key string) {
+	c.requestIDs.Delete(key)
+}
+
+// RequestID returns the request ID of the sync of the node in flight, empty if none.
+// Only the sync of the node uses it, the other plans of the node (e.g. audits) run
+// concurrently. Nodes are cluster scoped, their key is the name.
+func (c *Labeler) RequestID(nodeName string) string {
+	id, ok := c.requestIDs.Load(nodeName)
+	if !ok {
+		return ""
+	}
+	return id.(string)
+}
+
+// nodeLogger returns the logger of the node sync in flight, with its request ID.
+func (c *Labeler) nodeLogger(nodeName string) log.Logger {
+	if id := c.RequestID(nodeName); id != "" {
+		return log.With(c.logger, reconcileField, id)
+	}
+	return c.logger
+}
+
+// requestLogger returns the logger of the label controller with the request ID of the
+// node sync. Outside of the syncs (e.g. audits or offline plans) there is no request ID.
+func (lc *LabelController) requestLogger(requestID string) log.Logger {
+	if requestID == "" {
+		return lc.logger
+	}
+	return log.With(lc.logger, reconcileField, requestID)
+}
+
+// logNoop logs what doesn't change the nodes, only at debug level unless enabled.
+func logNoop(logger log.Logger, enabled bool, format string, args ...interface{}) {
+	if enabled {
+		logger.Infof(format, args...)
+		return
+	}
+	log.Debugf(logger, format, args...)
+}
@@ -0,0 +1,82 @@
+package labeler
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	kooperlog "github.com/spotahome/kooper/log"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// recordLogger is a logger recording the messages.
+type recordLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (r *recordLogger) record(format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs = append(r.msgs, fmt.Sprintf(format, args...))
+}
+
+func (r *recordLogger) Infof(format string, args ...interface{})    { r.record(format, args...) }
+func (r *recordLogger) Warningf(format string, args ...interface{}) { r.record(format, args...) }
+func (r *recordLogger) Errorf(format string, args ...interface{})   { r.record(format, args...) }
+func (r *recordLogger) Debugf(format string, args ...interface{})   { r.record(format, args...) }
+
+// flush returns the recorded messages and forgets them.
+func (r *recordLogger) flush() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	msgs := r.msgs
+	r.msgs = nil
+	return msgs
+}
+
+func TestPlanNodeRequestID(t *testing.T) {
+	logger := &recordLogger{}
+	l := &labelerv1alpha1.Labeler{
+		ObjectMeta: metav1.ObjectMeta{Name: "l"},
+		Spec: labelerv1alpha1.LabelerSpec{NodeSelector: corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{
+			{Key: "pool", Operator: corev1.NodeSelectorOpExists},
+		}}}}},
+	}
+	lc := NewLabelController(Config{LogNoop: true}, l, cache.NewStore(cache.MetaNamespaceKeyFunc), logger)
+	node := testNode("n1", nil)
+
+	// The node is synced while planned by an audit or a what-if.
+	c := &Labeler{cfg: Config{}.withDefaults(), logger: kooperlog.Dummy}
+	id := c.beginReconcile(node.Name)
+	defer c.endReconcile(node.Name)
+
+	PlanNode([]*LabelController{lc}, node)
+	lc.Plan(node)
+	msgs := logger.flush()
+	if len(msgs) == 0 {
+		t.Fatalf("expected the plans logged")
+	}
+	for _, msg := range msgs {
+		if strings.Contains(msg, reconcileField+"=") {
+			t.Errorf("expected the plan out of the sync without request ID, got %q", msg)
+		}
+	}
+
+	planNode([]*LabelController{lc}, node, c.RequestID(node.Name), false)
+	msgs = logger.flush()
+	if len(msgs) == 0 {
+		t.Fatalf("expected the sync plan logged")
+	}
+	for _, msg := range msgs {
+		if !strings.HasPrefix(msg, reconcileField+"="+id+" ") {
+			t.Errorf("expected the sync plan with request ID %s, got %q", id, msg)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package labeler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// Redundancy is a labeler whose attributes are all set, with the same values, by another
+// labeler on every node it selects. It changes nothing, it can be consolidated in the
+// other one.
+type Redundancy struct {
+	Labeler string `json:"labeler"`
+	// CoveredBy is the labeler setting the attributes.
+	CoveredBy string   `json:"coveredBy"`
+	Keys      []string `json:"keys"`
+}
+
+func (r Redundancy) String() string {
+	return fmt.Sprintf("%s is redundant with %s, which sets %s identically on all its nodes", r.Labeler, r.CoveredBy, strings.Join(r.Keys, ", "))
+}
+
+// mergedAttributes returns the attributes the labeler merges by their owned key, the
+// taints by key and effect with their value.
+func mergedAttributes(l *labelerv1alpha1.Labeler) map[string]string {
+	attrs := map[string]string{}
+	for k, v := range l.Spec.Merge.Labels {
+		attrs[labelsPrefix+k] = v
+	}
+	for k, v := range l.Spec.Merge.Annotations {
+		attrs[annotationsPrefix+k] = v
+	}
+	for _, t := range l.Spec.Merge.Taints {
+		attrs[taintsPrefix+taintKey(t)] = t.Value
+	}
+	return attrs
+}
+
+// onlyMerges returns true if the labeler only merges static attributes, it can then be
+// redundant with another one.
+func onlyMerges(l *labelerv1alpha1.Labeler) bool {
+	return len(l.Spec.ValueMap) == 0 && len(l.Spec.ValueFrom) == 0 && len(l.Spec.Rename) == 0 && len(l.Spec.RemoveLabels) == 0
+}
+
+// covers returns true if all the attributes are in the covering ones with the same values.
+func covers(covering, attrs map[string]string) bool {
+	for k, v := range attrs {
+		if cv, ok := covering[k]; !ok || cv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// RedundantLabelers returns the labelers that are strict subsets of another one: that
+// labeler sets all their attributes with the same values on a superset of their nodes.
+// Of identical labelers the ones applied after the first are redundant. The dry run
+// labelers set nothing, they are neither redundant nor covering. It's advisory, the
+// applied attributes don't change. The label controllers are in the order they are
+// applied.
+func RedundantLabelers(lcs []*LabelController) []Redundancy {
+	selected := make([]map[string]bool, len(lcs))
+	attrs := make([]map[string]string, len(lcs))
+	for i, lc := range lcs {
+		selected[i] = lc.selectedNodes()
+		attrs[i] = mergedAttributes(lc.l)
+	}
+	subset := func(i, j int) bool {
+		for n := range selected[i] {
+			if !selected[j][n] {
+				return false
+			}
+		}
+		return true
+	}
+
+	var res []Redundancy
+	for i, lc := range lcs {
+		if lc.DryRun() || !onlyMerges(lc.l) || len(attrs[i]) == 0 || len(selected[i]) == 0 {
+			continue
+		}
+		for j, other := range lcs {
+			if i == j || other.DryRun() || !covers(attrs[j], attrs[i]) || !subset(i, j) {
+				continue
+			}
+			identical := onlyMerges(other.l) && len(attrs[j]) == len(attrs[i]) && len(selected[j]) == len(selected[i])
+			if identical && j > i {
+				continue
+			}
+			keys := make([]string, 0, len(attrs[i]))
+			for k := range attrs[i] {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			res = append(res, Redundancy{Labeler: lc.l.Name, CoveredBy: other.l.Name, Keys: keys})
+			break
+		}
+	}
+	return res
+}
+
+// checkRedundancy records the redundant labelers as a metric, the newly redundant ones
+// are logged once.
+func (c *Labeler) checkRedundancy() {
+	redundant := map[string]Redundancy{}
+	for _, r := range RedundantLabelers(c.controllers()) {
+		redundant[r.Labeler] = r
+	}
+
+	c.redundantMu.Lock()
+	defer c.redundantMu.Unlock()
+	for _, lc := range c.controllers() {
+		r, ok := redundant[lc.l.Name]
+		if prev, was := c.redundant[lc.l.Name]; ok && (!was || prev.CoveredBy != r.CoveredBy) {
+			c.logger.Infof("%s, consolidate them", r)
+		}
+		c.cfg.MetricsRecorder.SetLabelerRedundant(lc.l.Name, ok)
+	}
+	c.redundant = redundant
+}
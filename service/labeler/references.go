@@ -0,0 +1,276 @@
+package labeler
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Kinds of the objects the labelers reference.
+const (
+	ReferenceSecret    = "Secret"
+	ReferenceDaemonSet = "DaemonSet"
+)
+
+// ObjectReference is an object of the cluster a labeler resolves its attributes with.
+type ObjectReference struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (r ObjectReference) String() string {
+	return fmt.Sprintf("%s %s/%s", r.Kind, r.Namespace, r.Name)
+}
+
+// ReferencingValueSource is a value source resolving its values with other objects of
+// the cluster, with WatchReferences the nodes are synced again when they change.
+type ReferencingValueSource interface {
+	ValueSource
+	References() []ObjectReference
+	// ReferenceChanged drops what the value source cached of the changed object.
+	ReferenceChanged(ref ObjectReference)
+}
+
+// referenceForgetter is a cache of referenced objects.
+type referenceForgetter interface {
+	forget(namespace, name string)
+}
+
+// references returns the objects the labeler references, sorted.
+func (lc *LabelController) references() []ObjectReference {
+	seen := map[ObjectReference]bool{}
+	if ref := lc.l.Spec.RequireToleratingDaemonSet; ref != nil {
+		seen[ObjectReference{Kind: ReferenceDaemonSet, Namespace: ref.Namespace, Name: ref.Name}] = true
+	}
+	for _, lv := range lc.values {
+		for _, src := range leafSources(lv.source) {
+			if rs, ok := src.(ReferencingValueSource); ok {
+				for _, ref := range rs.References() {
+					seen[ref] = true
+				}
+			}
+		}
+	}
+	refs := make([]ObjectReference, 0, len(seen))
+	for ref := range seen {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].String() < refs[j].String() })
+	return refs
+}
+
+// referenceInformer watches a referenced object until stopped.
+type referenceInformer struct {
+	informer cache.SharedIndexInformer
+	stopC    chan struct{}
+}
+
+// referenceTracker watches the objects the labelers reference, an informer by object
+// while a labeler references it. Their changes sync again the nodes of the labelers
+// referencing them.
+type referenceTracker struct {
+	c *Labeler
+
+	mu sync.Mutex
+	// stopC is the stop of the labeler service, nil until it runs.
+	stopC <-chan struct{}
+	// refs are the references of every labeler.
+	refs      map[string][]ObjectReference
+	informers map[ObjectReference]*referenceInformer
+}
+
+func newReferenceTracker(c *Labeler) *referenceTracker {
+	return &referenceTracker{
+		c:         c,
+		refs:      map[string][]ObjectReference{},
+		informers: map[ObjectReference]*referenceInformer{},
+	}
+}
+
+// track sets the references of the labeler, none once deleted, starting the informers
+// of the new references and stopping the ones no labeler references anymore.
+func (t *referenceTracker) track(name string, refs []ObjectReference) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(refs) == 0 {
+		delete(t.refs, name)
+	} else {
+		t.refs[name] = refs
+	}
+	t.reconcile()
+}
+
+// run starts the informers of the references until stopped.
+func (t *referenceTracker) run(stopC <-chan struct{}) {
+	t.mu.Lock()
+	t.stopC = stopC
+	t.reconcile()
+	t.mu.Unlock()
+	<-stopC
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for ref, ri := range t.informers {
+		close(ri.stopC)
+		delete(t.informers, ref)
+	}
+}
+
+// reconcile starts and stops the informers for the references, with the lock held.
+func (t *referenceTracker) reconcile() {
+	if t.stopC == nil {
+		return
+	}
+	select {
+	case <-t.stopC:
+		return
+	default:
+	}
+	used := map[ObjectReference]bool{}
+	for _, refs := range t.refs {
+		for _, ref := range refs {
+			used[ref] = true
+		}
+	}
+	for ref, ri := range t.informers {
+		if !used[ref] {
+			close(ri.stopC)
+			delete(t.informers, ref)
+			t.c.logger.Infof("stopped watching the referenced %s", ref)
+		}
+	}
+	for ref := range used {
+		if _, ok := t.informers[ref]; ok {
+			continue
+		}
+		informer, err := t.newInformer(ref)
+		if err != nil {
+			t.c.logger.Warningf("could not watch the referenced %s: %s", ref, err)
+			continue
+		}
+		ri := &referenceInformer{informer: informer, stopC: make(chan struct{})}
+		t.informers[ref] = ri
+		go informer.Run(ri.stopC)
+		t.c.logger.Infof("watching the referenced %s", ref)
+	}
+}
+
+// trackReferences sets the objects the labeler references, none once deleted. Without
+// WatchReferences it does nothing.
+func (c *Labeler) trackReferences(name string, refs []ObjectReference) {
+	if c.references != nil {
+		c.references.track(name, refs)
+	}
+}
+
+// newInformer returns a new informer of the referenced object.
+func (t *referenceTracker) newInformer(ref ObjectReference) (cache.SharedIndexInformer, error) {
+	selectName := func(options *metav1.ListOptions) {
+		options.FieldSelector = fields.OneTermEqualSelector("metadata.name", ref.Name).String()
+	}
+	cli := t.c.k8sCli
+	var lw *cache.ListWatch
+	var obj runtime.Object
+	switch ref.Kind {
+	case ReferenceSecret:
+		obj = &corev1.Secret{}
+		lw = &cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				selectName(&options)
+				return cli.CoreV1().Secrets(ref.Namespace).List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				selectName(&options)
+				return cli.CoreV1().Secrets(ref.Namespace).Watch(options)
+			},
+		}
+	case ReferenceDaemonSet:
+		obj = &appsv1.DaemonSet{}
+		lw = &cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				selectName(&options)
+				return cli.AppsV1().DaemonSets(ref.Namespace).List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				selectName(&options)
+				return cli.AppsV1().DaemonSets(ref.Namespace).Watch(options)
+			},
+		}
+	default:
+		return nil, fmt.Errorf("unknown kind %q", ref.Kind)
+	}
+
+	informer := cache.NewSharedIndexInformer(lw, obj, 0, cache.Indexers{})
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		// The objects listed on start are not changes.
+		AddFunc: func(interface{}) {
+			if informer.HasSynced() {
+				t.changed(ref)
+			}
+		},
+		UpdateFunc: func(old, new interface{}) {
+			om, err1 := meta(old)
+			nm, err2 := meta(new)
+			if err1 == nil && err2 == nil && om.GetResourceVersion() == nm.GetResourceVersion() {
+				return
+			}
+			t.changed(ref)
+		},
+		DeleteFunc: func(interface{}) { t.changed(ref) },
+	})
+	return informer, nil
+}
+
+// meta returns the object metadata.
+func meta(obj interface{}) (metav1.Object, error) {
+	o, ok := obj.(metav1.Object)
+	if !ok {
+		return nil, fmt.Errorf("%T has no metadata", obj)
+	}
+	return o, nil
+}
+
+// changed drops the cached copies of the changed object and queues the nodes of the
+// labelers referencing it.
+func (t *referenceTracker) changed(ref ObjectReference) {
+	for _, getter := range []interface{}{t.c.cfg.Secrets, t.c.cfg.DaemonSets} {
+		if f, ok := getter.(referenceForgetter); ok {
+			f.forget(ref.Namespace, ref.Name)
+		}
+	}
+	var lcs []*LabelController
+	for _, lc := range t.c.controllers() {
+		for _, r := range lc.references() {
+			if r != ref {
+				continue
+			}
+			for _, lv := range lc.values {
+				for _, src := range leafSources(lv.source) {
+					if rs, ok := src.(ReferencingValueSource); ok {
+						rs.ReferenceChanged(ref)
+					}
+				}
+			}
+			lcs = append(lcs, lc)
+			break
+		}
+	}
+	if len(lcs) == 0 {
+		return
+	}
+	log := t.c.logger
+	names := make([]string, 0, len(lcs))
+	for _, lc := range lcs {
+		names = append(names, lc.l.Name)
+	}
+	log.Infof("referenced %s changed, syncing the nodes of %v again", ref, names)
+	t.c.enqueueLabeler(lcs...)
+}
@@ -0,0 +1,68 @@
+package labeler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// labelRemoval matches the label keys removed by a removeLabels entry, an exact key
+// or a regular expression.
+type labelRemoval struct {
+	entry string
+	key   string
+	re    *regexp.Regexp
+}
+
+// matches returns true if the label key is removed. The regular expressions don't
+// match the reserved keys, they are only removed by exact key.
+func (r labelRemoval) matches(key string) bool {
+	if r.re == nil {
+		return key == r.key
+	}
+	return !IsReservedKey(key) && r.re.MatchString(key)
+}
+
+// compileRemoval returns the removal of a removeLabels entry. The entries between
+// slashes are regular expressions anchored on the whole key.
+func compileRemoval(entry string) (labelRemoval, error) {
+	if len(entry) > 1 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/") {
+		re, err := regexp.Compile("^(?:" + entry[1:len(entry)-1] + ")$")
+		if err != nil {
+			return labelRemoval{}, fmt.Errorf("invalid removeLabels expression %s: %s", entry, err)
+		}
+		return labelRemoval{entry: entry, re: re}, nil
+	}
+	if errs := validation.IsQualifiedName(entry); len(errs) > 0 {
+		return labelRemoval{}, fmt.Errorf("removeLabels key %q is not valid: %s", entry, strings.Join(errs, ", "))
+	}
+	return labelRemoval{entry: entry, key: entry}, nil
+}
+
+// labelRemovals returns the removals of the labeler. The labeler needs to be valid.
+func labelRemovals(l *labelerv1alpha1.Labeler) []labelRemoval {
+	var rs []labelRemoval
+	for _, entry := range l.Spec.RemoveLabels {
+		if r, err := compileRemoval(entry); err == nil {
+			rs = append(rs, r)
+		}
+	}
+	return rs
+}
+
+// removeLabels removes the label keys matching the removals from the node.
+func removeLabels(node *corev1.Node, removals []labelRemoval) {
+	for k := range node.Labels {
+		for _, r := range removals {
+			if r.matches(k) {
+				delete(node.Labels, k)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package labeler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// reservedDomains are the key prefix domains reserved for the Kubernetes components,
+// their subdomains (e.g. node.kubernetes.io) are reserved too.
+var reservedDomains = []string{"kubernetes.io", "k8s.io"}
+
+// IsReservedKey returns true if the label, annotation or taint key has a reserved prefix.
+func IsReservedKey(key string) bool {
+	i := strings.Index(key, "/")
+	if i < 0 {
+		return false
+	}
+	prefix := key[:i]
+	for _, d := range reservedDomains {
+		if prefix == d || strings.HasSuffix(prefix, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// reservedKeys returns the attributes with reserved keys the labeler writes or removes,
+// prefixed by their kind and sorted.
+func reservedKeys(l *labelerv1alpha1.Labeler) []string {
+	set := map[string]bool{}
+	add := func(prefix, key string) {
+		if IsReservedKey(key) {
+			set[prefix+key] = true
+		}
+	}
+
+	for k := range l.Spec.Merge.Labels {
+		add(labelsPrefix, k)
+	}
+	for k := range l.Spec.Merge.Annotations {
+		add(annotationsPrefix, k)
+	}
+	for _, t := range l.Spec.Merge.Taints {
+		add(taintsPrefix, t.Key)
+	}
+	for _, vm := range l.Spec.ValueMap {
+		add(labelsPrefix, vm.To)
+	}
+	for _, vf := range l.Spec.ValueFrom {
+		add(labelsPrefix, vf.Label)
+	}
+	for _, r := range l.Spec.Rename {
+		// Renaming removes the old key.
+		add(labelsPrefix, r.From)
+		add(labelsPrefix, r.To)
+	}
+	for _, r := range labelRemovals(l) {
+		// The expressions don't match the reserved keys.
+		if r.re == nil {
+			add(labelsPrefix, r.key)
+		}
+	}
+
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ValidateReserved checks that the labeler doesn't write labels, annotations nor
+// taints with reserved prefixes (kubernetes.io, k8s.io and their subdomains).
+func ValidateReserved(l *labelerv1alpha1.Labeler) error {
+	if keys := reservedKeys(l); len(keys) > 0 {
+		return fmt.Errorf("%s: the %s keys have reserved prefixes", l.Name, strings.Join(keys, ", "))
+	}
+	return nil
+}
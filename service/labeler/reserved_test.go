@@ -0,0 +1,90 @@
+package labeler
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kooperlog "github.com/spotahome/kooper/log"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+func TestIsReservedKey(t *testing.T) {
+	tests := []struct {
+		key string
+		exp bool
+	}{
+		{key: "kubernetes.io/hostname", exp: true},
+		{key: "node.kubernetes.io/instance-type", exp: true},
+		{key: "k8s.io/role", exp: true},
+		{key: "node-role.k8s.io/worker", exp: true},
+		{key: "example.com/kubernetes.io", exp: false},
+		{key: "notkubernetes.io/role", exp: false},
+		{key: "kubernetes.io", exp: false},
+		{key: "team", exp: false},
+	}
+
+	for _, test := range tests {
+		if got := IsReservedKey(test.key); got != test.exp {
+			t.Errorf("%s: expected reserved %t, got %t", test.key, test.exp, got)
+		}
+	}
+}
+
+func TestReservedKeysByMutation(t *testing.T) {
+	tests := []struct {
+		name string
+		spec labelerv1alpha1.LabelerSpec
+		// expReserved is the reserved key rejected without --allow-reserved, empty if
+		// the labeler is accepted anyway.
+		expReserved string
+	}{
+		{
+			name:        "A label with a reserved prefix.",
+			spec:        labelerv1alpha1.LabelerSpec{Merge: mergeSpec(map[string]string{"node.kubernetes.io/pool": "a"})},
+			expReserved: "labels/node.kubernetes.io/pool",
+		},
+		{
+			name:        "An annotation with a reserved prefix.",
+			spec:        labelerv1alpha1.LabelerSpec{Merge: labelerv1alpha1.MergeSpec{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"k8s.io/owner": "ops"}}}},
+			expReserved: "annotations/k8s.io/owner",
+		},
+		{
+			name:        "A taint with a reserved prefix.",
+			spec:        labelerv1alpha1.LabelerSpec{Merge: mergeSpec(nil, corev1.Taint{Key: "kubernetes.io/dedicated", Effect: corev1.TaintEffectNoSchedule})},
+			expReserved: "taints/kubernetes.io/dedicated",
+		},
+		{
+			name:        "A renamed reserved label, removed by the rename.",
+			spec:        labelerv1alpha1.LabelerSpec{Rename: []labelerv1alpha1.RenameSpec{{From: "kubernetes.io/pool", To: "example.com/pool"}}},
+			expReserved: "labels/kubernetes.io/pool",
+		},
+		{
+			name: "Labels, annotations and taints without reserved prefixes.",
+			spec: labelerv1alpha1.LabelerSpec{Merge: labelerv1alpha1.MergeSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"example.com/pool": "a"}, Annotations: map[string]string{"team": "ops"}},
+				NodeSpec:   corev1.NodeSpec{Taints: []corev1.Taint{{Key: "dedicated", Effect: corev1.TaintEffectNoSchedule}}},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := &labelerv1alpha1.Labeler{ObjectMeta: metav1.ObjectMeta{Name: "l"}, Spec: test.spec}
+			keys := reservedKeys(l)
+			if test.expReserved == "" && len(keys) > 0 || test.expReserved != "" && (len(keys) != 1 || keys[0] != test.expReserved) {
+				t.Errorf("expected the reserved keys %q, got %v", test.expReserved, keys)
+			}
+
+			for _, allow := range []bool{false, true} {
+				c := NewLabeler(Config{AllowReserved: allow}, nil, kooperlog.Dummy)
+				err := c.EnsureLabeler(l)
+				if blocked := test.expReserved != "" && !allow; (err != nil) != blocked {
+					t.Errorf("with --allow-reserved %t expected blocked %t, got %v", allow, blocked, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package labeler
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Error classes of the failed node syncs.
+const (
+	ErrorClassNotFound  = "NotFound"
+	ErrorClassConflict  = "Conflict"
+	ErrorClassForbidden = "Forbidden"
+	ErrorClassTimeout   = "Timeout"
+	ErrorClassPanic     = "Panic"
+	ErrorClassOther     = "Other"
+)
+
+// Retry policies of the failed node syncs.
+const (
+	// RetryDrop forgets the node until its next event.
+	RetryDrop = "drop"
+	// RetryImmediate retries once right away and then with backoff.
+	RetryImmediate = "immediate"
+	// RetryStop forgets the node and sets the Degraded condition until it syncs.
+	RetryStop = "stop"
+	// RetryBackoff retries with exponential backoff.
+	RetryBackoff = "backoff"
+)
+
+// ErrorClasses are the known error classes.
+var ErrorClasses = []string{ErrorClassNotFound, ErrorClassConflict, ErrorClassForbidden, ErrorClassTimeout, ErrorClassPanic, ErrorClassOther}
+
+// RetryPolicies are the known retry policies.
+var RetryPolicies = []string{RetryDrop, RetryImmediate, RetryStop, RetryBackoff}
+
+// DefaultRetryPolicies are the retry policies of every error class: the deleted nodes
+// are dropped, the stale resource versions retried right away, the errors the RBAC
+// won't fix by retrying stopped and the rest backed off.
+var DefaultRetryPolicies = map[string]string{
+	ErrorClassNotFound:  RetryDrop,
+	ErrorClassConflict:  RetryImmediate,
+	ErrorClassForbidden: RetryStop,
+	ErrorClassTimeout:   RetryBackoff,
+	ErrorClassPanic:     RetryBackoff,
+	ErrorClassOther:     RetryBackoff,
+}
+
+// causer is an error wrapping the error that caused it.
+type causer interface {
+	Cause() error
+}
+
+// errorClass returns the class of the error by its API status, or by its cause.
+func errorClass(err error) string {
+	for err != nil {
+		switch {
+		case errors.IsNotFound(err):
+			return ErrorClassNotFound
+		case errors.IsConflict(err):
+			return ErrorClassConflict
+		case errors.IsForbidden(err):
+			return ErrorClassForbidden
+		case errors.IsTimeout(err), errors.IsServerTimeout(err):
+			return ErrorClassTimeout
+		}
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return ErrorClassTimeout
+		}
+		if _, ok := err.(panicError); ok {
+			return ErrorClassPanic
+		}
+		c, ok := err.(causer)
+		if !ok {
+			break
+		}
+		err = c.Cause()
+	}
+	return ErrorClassOther
+}
+
+// retry requeues the failed item by the policy and returns true if it's retried, the
+// retries are bounded by max.
+func (q *trackedQueue) retry(item interface{}, policy string, max int) bool {
+	switch policy {
+	case RetryDrop, RetryStop:
+		q.Forget(item)
+		return false
+	}
+	if q.NumRequeues(item) >= max {
+		q.Forget(item)
+		return false
+	}
+	if policy == RetryImmediate && q.NumRequeues(item) == 0 {
+		// The retry counts for the backoff of the next ones.
+		q.limiter.When(item)
+		q.Add(item)
+		return true
+	}
+	q.AddRateLimited(item)
+	return true
+}
+
+// stoppedNodes are the nodes not retried by the stop policy, with their error.
+type stoppedNodes struct {
+	mu    sync.Mutex
+	nodes map[string]string
+	since time.Time
+}
+
+// track records the error stopping the node retries, nil once it syncs.
+func (s *stoppedNodes) track(name string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		delete(s.nodes, name)
+		return
+	}
+	if s.nodes == nil {
+		s.nodes = map[string]string{}
+	}
+	if len(s.nodes) == 0 {
+		s.since = time.Now()
+	}
+	s.nodes[name] = err.Error()
+}
+
+// condition returns the Degraded condition while nodes are stopped, nil otherwise.
+func (s *stoppedNodes) condition() *Condition {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.nodes) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(s.nodes))
+	for name := range s.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &Condition{
+		Type:     ConditionDegraded,
+		Severity: ConditionSeverityError,
+		Since:    s.since.UTC(),
+		Message:  fmt.Sprintf("%d nodes not retried by the %s policy until their next event, last error %q: %s", len(names), RetryStop, s.nodes[names[0]], strings.Join(names, ", ")),
+	}
+}
+
+// handleSyncError logs the failed sync of the node and requeues it by the retry policy
+// of its error class.
+func (c *Labeler) handleSyncError(key string, err error) {
+	class := errorClass(err)
+	policy := c.cfg.RetryPolicies[class]
+	if policy == RetryStop {
+		c.stopped.track(key, err)
+	}
+	if c.queue.retry(key, policy, processingJobRetries) {
+		c.nodeLogger(key).Warningf("error processing node %s (%s, requeued by the %s policy): %v", key, class, policy, err)
+		return
+	}
+	c.nodeLogger(key).Errorf("error processing node %s (%s, not retried by the %s policy): %v", key, class, policy, err)
+}
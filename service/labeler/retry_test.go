@@ -0,0 +1,169 @@
+package labeler
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/workqueue"
+
+	kooperlog "github.com/spotahome/kooper/log"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// timeoutError is a network error timing out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestErrorClass(t *testing.T) {
+	nodes := schema.GroupResource{Resource: "nodes"}
+	tests := []struct {
+		name string
+		err  error
+		exp  string
+	}{
+		{name: "A missing node is NotFound.", err: apierrors.NewNotFound(nodes, "n1"), exp: ErrorClassNotFound},
+		{name: "A stale resource version is Conflict.", err: apierrors.NewConflict(nodes, "n1", errors.New("stale")), exp: ErrorClassConflict},
+		{name: "A denied patch is Forbidden.", err: apierrors.NewForbidden(nodes, "n1", errors.New("denied")), exp: ErrorClassForbidden},
+		{name: "An API timeout is Timeout.", err: apierrors.NewTimeoutError("slow", 1), exp: ErrorClassTimeout},
+		{name: "A server timeout is Timeout.", err: apierrors.NewServerTimeout(nodes, "patch", 1), exp: ErrorClassTimeout},
+		{name: "A network timeout is Timeout.", err: timeoutError{}, exp: ErrorClassTimeout},
+		{name: "A chunk error has the class of its cause.", err: chunkError{chunk: 2, chunks: 3, err: apierrors.NewConflict(nodes, "n1", errors.New("stale"))}, exp: ErrorClassConflict},
+		{name: "A recovered panic is Panic.", err: panicError{value: "boom"}, exp: ErrorClassPanic},
+		{name: "An internal error is Other.", err: apierrors.NewInternalError(errors.New("boom")), exp: ErrorClassOther},
+		{name: "A plain error is Other.", err: errors.New("boom"), exp: ErrorClassOther},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := errorClass(test.err); got != test.exp {
+				t.Errorf("expected the class %s, got %s", test.exp, got)
+			}
+		})
+	}
+}
+
+// slowRetryQueue returns a queue whose backoffs outlast the tests.
+func slowRetryQueue() *trackedQueue {
+	q := newTrackedQueue("test")
+	q.limiter = workqueue.NewItemExponentialFailureRateLimiter(time.Minute, time.Hour)
+	return q
+}
+
+func TestQueueRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		requeues   int
+		expRetried bool
+		expReady   bool
+	}{
+		{name: "Drop forgets the item.", policy: RetryDrop},
+		{name: "Stop forgets the item.", policy: RetryStop},
+		{name: "Immediate retries the first failure right away.", policy: RetryImmediate, expRetried: true, expReady: true},
+		{name: "Immediate backs off the next failures.", policy: RetryImmediate, requeues: 1, expRetried: true},
+		{name: "Backoff retries after a delay.", policy: RetryBackoff, expRetried: true},
+		{name: "The retries are bounded.", policy: RetryBackoff, requeues: 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := slowRetryQueue()
+			defer q.ShutDown()
+			for i := 0; i < test.requeues; i++ {
+				q.limiter.When("n1")
+			}
+
+			if retried := q.retry("n1", test.policy, 3); retried != test.expRetried {
+				t.Fatalf("expected retried %t, got %t", test.expRetried, retried)
+			}
+			snap := q.snapshot()
+			if ready := len(snap.Waiting) == 1; ready != test.expReady {
+				t.Errorf("expected ready %t, got %+v", test.expReady, snap)
+			}
+			if delayed := len(snap.Delayed) == 1; delayed != (test.expRetried && !test.expReady) {
+				t.Errorf("expected delayed %t, got %+v", test.expRetried && !test.expReady, snap)
+			}
+			if !test.expRetried && q.NumRequeues("n1") != 0 {
+				t.Errorf("expected the item forgotten, got %d requeues", q.NumRequeues("n1"))
+			}
+		})
+	}
+}
+
+func TestProcessNextNodeRetryPolicies(t *testing.T) {
+	tests := []struct {
+		name        string
+		code        int
+		reason      metav1.StatusReason
+		expReady    bool
+		expDelayed  bool
+		expDegraded bool
+	}{
+		{name: "A missing node is dropped.", code: http.StatusNotFound, reason: metav1.StatusReasonNotFound},
+		{name: "A conflict is retried right away.", code: http.StatusConflict, reason: metav1.StatusReasonConflict, expReady: true},
+		{name: "A denied patch is stopped.", code: http.StatusForbidden, reason: metav1.StatusReasonForbidden, expDegraded: true},
+		{name: "A timeout is backed off.", code: http.StatusGatewayTimeout, reason: metav1.StatusReasonTimeout, expDelayed: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newNodeServer(testNode("n1", map[string]string{"pool": "a"}))
+			s.patchErr, s.patchReason = test.code, test.reason
+			l := poolLabeler("a", "a", labelerv1alpha1.LabelerSpec{Merge: mergeSpec(map[string]string{"team": "a"})})
+			c, stop := newSyncedLabeler(t, s, Config{}, l)
+			defer stop()
+			c.queue.limiter = slowRetryQueue().limiter
+
+			c.processNextNode()
+			snap := c.queue.snapshot()
+			if ready := len(snap.Waiting) == 1; ready != test.expReady {
+				t.Errorf("expected the node ready %t, got %+v", test.expReady, snap)
+			}
+			if delayed := len(snap.Delayed) == 1; delayed != test.expDelayed {
+				t.Errorf("expected the node delayed %t, got %+v", test.expDelayed, snap)
+			}
+			var degraded *Condition
+			for _, cond := range c.Status().Conditions {
+				if cond.Type == ConditionDegraded && strings.Contains(cond.Message, RetryStop) {
+					cond := cond
+					degraded = &cond
+				}
+			}
+			if (degraded != nil) != test.expDegraded {
+				t.Errorf("expected the stopped nodes Degraded condition %t, got %+v", test.expDegraded, degraded)
+			}
+
+			if !test.expReady {
+				return
+			}
+			// The conflict retried right away fails again, it's backed off.
+			c.processNextNode()
+			if snap := c.queue.snapshot(); len(snap.Waiting) != 0 || len(snap.Delayed) != 1 {
+				t.Errorf("expected the second conflict backed off, got %+v", snap)
+			}
+		})
+	}
+}
+
+func TestStatusRetryPolicies(t *testing.T) {
+	c := NewLabeler(Config{RetryPolicies: map[string]string{ErrorClassForbidden: RetryBackoff}}, nil, kooperlog.Dummy)
+	exp := map[string]string{}
+	for class, policy := range DefaultRetryPolicies {
+		exp[class] = policy
+	}
+	exp[ErrorClassForbidden] = RetryBackoff
+	if got := c.Status().RetryPolicies; !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected the effective policies %v, got %v", exp, got)
+	}
+}
@@ -0,0 +1,242 @@
+package labeler
+
+import (
+	"hash/fnv"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// inRollout returns true if the node is part of the nodes selected by the labeler
+// rollout: the canary nodes and, once they have soaked, the rollout percentage of the
+// matching nodes (all of them without rollout percentage). If the node is waiting for
+// the canaries it also returns when it should be checked again.
+func (lc *LabelController) inRollout(node *corev1.Node) (bool, time.Duration) {
+	if lc.isCanary(node) {
+		return true, 0
+	}
+	// Without rollout nor canaries every matching node is selected.
+	if lc.l.Spec.RolloutPercentage == nil && lc.l.Spec.CanarySoak == nil {
+		return true, 0
+	}
+
+	matching, rollout := lc.rolloutSelection()
+	if wait := lc.canarySoakWait(matching); wait > 0 {
+		return false, wait
+	}
+
+	if lc.l.Spec.RolloutPercentage == nil {
+		return true, 0
+	}
+	return rollout[node.Name], 0
+}
+
+// AffectedNodes returns the number of nodes the labeler is applied to.
+func (lc *LabelController) AffectedNodes() int {
+	return len(lc.selectedNodes())
+}
+
+// selectedNodes returns the names of the cached nodes the labeler is applied to: the
+// canaries and the rollout nodes of the matching ones.
+func (lc *LabelController) selectedNodes() map[string]bool {
+	matching, rollout := lc.rolloutSelection()
+	selected := make(map[string]bool, len(rollout))
+	for _, n := range matching {
+		if lc.isCanary(n) {
+			selected[n.Name] = true
+		}
+	}
+	for name := range rollout {
+		selected[name] = true
+	}
+	return selected
+}
+
+// generationStore is a node store counting its changes.
+type generationStore interface {
+	Generation() uint64
+}
+
+// rolloutSelection is the rollout of the labeler at a generation of the node store.
+type rolloutSelection struct {
+	generation uint64
+	cached     bool
+	matching   []*corev1.Node
+	rollout    map[string]bool
+	// ordered are the names of the rollout nodes in the order they are changed.
+	ordered []string
+}
+
+// rolloutSelection returns the cached nodes matching the labeler and the ones its
+// rollout selects, they are not to be modified.
+func (lc *LabelController) rolloutSelection() ([]*corev1.Node, map[string]bool) {
+	s := lc.selection()
+	return s.matching, s.rollout
+}
+
+// selection returns the rollout of the labeler. It's computed once per generation of
+// the node store, every time if the store doesn't count its changes.
+func (lc *LabelController) selection() rolloutSelection {
+	gs, cacheable := lc.nodes.(generationStore)
+	var generation uint64
+	if cacheable {
+		// Read first, a change while computing only makes the next call compute again.
+		generation = gs.Generation()
+		lc.rolloutMu.Lock()
+		defer lc.rolloutMu.Unlock()
+		if lc.rollout.cached && lc.rollout.generation == generation {
+			return lc.rollout
+		}
+	}
+
+	s := rolloutSelection{generation: generation, cached: cacheable, matching: lc.matchingNodes(), rollout: map[string]bool{}}
+	for _, n := range RolloutNodes(lc.l, s.matching) {
+		s.rollout[n.Name] = true
+		s.ordered = append(s.ordered, n.Name)
+	}
+	if cacheable {
+		lc.rollout = s
+	}
+	return s
+}
+
+// Generation satisfies generationStore interface, the changes of the node cache the
+// rollouts depend on.
+func (s nodeStore) Generation() uint64 {
+	return atomic.LoadUint64(&s.c.nodeGeneration)
+}
+
+// nodesChanged counts a change of the node cache the rollouts depend on, the status
+// only updates (e.g. the kubelet heartbeats) are not.
+func (c *Labeler) nodesChanged(old, new *corev1.Node) {
+	if old == nil || new == nil || !reflect.DeepEqual(old.Labels, new.Labels) || !reflect.DeepEqual(old.Annotations, new.Annotations) {
+		atomic.AddUint64(&c.nodeGeneration, 1)
+	}
+}
+
+// matchingNodes returns the cached nodes that match the labeler selector.
+func (lc *LabelController) matchingNodes() []*corev1.Node {
+	var matching []*corev1.Node
+	for _, obj := range lc.candidateNodes() {
+		n, ok := obj.(*corev1.Node)
+		if ok && NodeMatchesNodeSelectorTerms(n, lc.l.Spec.NodeSelectorTerms) {
+			matching = append(matching, n)
+		}
+	}
+	return matching
+}
+
+// RolloutNodes returns the nodes (from the matching ones) that are selected by the
+// rollout of the labeler, sorted by the rollout order.
+func RolloutNodes(l *labelerv1alpha1.Labeler, matching []*corev1.Node) []*corev1.Node {
+	nodes := make([]*corev1.Node, len(matching))
+	copy(nodes, matching)
+	sortNodes(nodes, l.Name, l.Spec.RolloutOrder)
+
+	if l.Spec.RolloutPercentage == nil {
+		return nodes
+	}
+
+	// Round up so a percentage greater than 0 selects at least one node.
+	pct := int(*l.Spec.RolloutPercentage)
+	count := (len(nodes)*pct + 99) / 100
+	if l.Spec.RolloutStrategy == labelerv1alpha1.RolloutStrategyBalancedByZone {
+		return balancedByZone(nodes, count, l.Spec.RolloutZoneLabel)
+	}
+	return nodes[:count]
+}
+
+// zoneLabels are the well-known node labels with the zone, checked in order.
+var zoneLabels = []string{"topology.kubernetes.io/zone", "failure-domain.beta.kubernetes.io/zone"}
+
+// NodeZone returns the zone of the node from the label, or from the well-known zone
+// labels if empty. Nodes without zone are in the "" zone.
+func NodeZone(node *corev1.Node, label string) string {
+	if label != "" {
+		return node.Labels[label]
+	}
+	for _, k := range zoneLabels {
+		if z, ok := node.Labels[k]; ok {
+			return z
+		}
+	}
+	return ""
+}
+
+// balancedByZone picks count nodes taking one from every zone in turn (zones sorted by
+// name), the nodes of every zone in their order, so the zone counts differ by at most
+// one until a zone runs out of nodes.
+func balancedByZone(nodes []*corev1.Node, count int, label string) []*corev1.Node {
+	byZone := map[string][]*corev1.Node{}
+	var zones []string
+	for _, n := range nodes {
+		z := NodeZone(n, label)
+		if _, ok := byZone[z]; !ok {
+			zones = append(zones, z)
+		}
+		byZone[z] = append(byZone[z], n)
+	}
+	sort.Strings(zones)
+
+	picked := make([]*corev1.Node, 0, count)
+	for i := 0; len(picked) < count; i++ {
+		for _, z := range zones {
+			if i < len(byZone[z]) && len(picked) < count {
+				picked = append(picked, byZone[z][i])
+			}
+		}
+	}
+	return picked
+}
+
+// zoneCounts returns the number of nodes the labeler is applied to by zone, nil if
+// the labeler rollout is not balanced by zone.
+func (lc *LabelController) zoneCounts() map[string]int {
+	if lc.l.Spec.RolloutStrategy != labelerv1alpha1.RolloutStrategyBalancedByZone {
+		return nil
+	}
+	counts := map[string]int{}
+	for name := range lc.selectedNodes() {
+		if n := cachedNode(lc.nodes, name); n != nil {
+			counts[NodeZone(n, lc.l.Spec.RolloutZoneLabel)]++
+		}
+	}
+	return counts
+}
+
+// sortNodes sorts the nodes by the rollout order, ties are broken by name so the
+// order is deterministic.
+func sortNodes(nodes []*corev1.Node, seed string, order labelerv1alpha1.RolloutOrder) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := nodes[i], nodes[j]
+		switch order {
+		case labelerv1alpha1.RolloutOrderNewest:
+			if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+				return b.CreationTimestamp.Before(&a.CreationTimestamp)
+			}
+		case labelerv1alpha1.RolloutOrderOldest:
+			if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+				return a.CreationTimestamp.Before(&b.CreationTimestamp)
+			}
+		default:
+			ha, hb := nodeHash(seed, a.Name), nodeHash(seed, b.Name)
+			if ha != hb {
+				return ha < hb
+			}
+		}
+		return a.Name < b.Name
+	})
+}
+
+// nodeHash returns a stable hash of the node for a labeler, using the labeler name
+// as seed so different labelers don't always select the same nodes first.
+func nodeHash(seed, name string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(seed + "/" + name))
+	return h.Sum32()
+}
@@ -0,0 +1,143 @@
+package labeler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	kooperlog "github.com/spotahome/kooper/log"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// rolloutNode returns a node created at the hour of the day in a zone.
+func rolloutNode(name string, hour int, zone string) *corev1.Node {
+	n := testNode(name, map[string]string{"topology.kubernetes.io/zone": zone})
+	n.CreationTimestamp = metav1.NewTime(time.Date(2020, 1, 1, hour, 0, 0, 0, time.UTC))
+	return n
+}
+
+func int32Ptr(i int32) *int32 { return &i }
+
+func TestRolloutNodes(t *testing.T) {
+	matching := []*corev1.Node{
+		rolloutNode("n1", 1, "a"),
+		rolloutNode("n2", 2, "a"),
+		rolloutNode("n3", 3, "a"),
+		rolloutNode("n4", 4, "b"),
+	}
+	tests := []struct {
+		name string
+		spec labelerv1alpha1.LabelerSpec
+		exp  []string
+	}{
+		{
+			name: "Without percentage every node is selected.",
+			spec: labelerv1alpha1.LabelerSpec{RolloutOrder: labelerv1alpha1.RolloutOrderOldest},
+			exp:  []string{"n1", "n2", "n3", "n4"},
+		},
+		{
+			name: "The newest nodes are selected first, rounded up.",
+			spec: labelerv1alpha1.LabelerSpec{RolloutPercentage: int32Ptr(30), RolloutOrder: labelerv1alpha1.RolloutOrderNewest},
+			exp:  []string{"n4", "n3"},
+		},
+		{
+			name: "The oldest nodes are selected first.",
+			spec: labelerv1alpha1.LabelerSpec{RolloutPercentage: int32Ptr(50), RolloutOrder: labelerv1alpha1.RolloutOrderOldest},
+			exp:  []string{"n1", "n2"},
+		},
+		{
+			name: "A balanced rollout takes a node of every zone in turn.",
+			spec: labelerv1alpha1.LabelerSpec{
+				RolloutPercentage: int32Ptr(50),
+				RolloutOrder:      labelerv1alpha1.RolloutOrderOldest,
+				RolloutStrategy:   labelerv1alpha1.RolloutStrategyBalancedByZone,
+			},
+			exp: []string{"n1", "n4"},
+		},
+		{
+			name: "No percentage selects no node.",
+			spec: labelerv1alpha1.LabelerSpec{RolloutPercentage: int32Ptr(0)},
+			exp:  []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := &labelerv1alpha1.Labeler{ObjectMeta: metav1.ObjectMeta{Name: "l"}, Spec: test.spec}
+			got := []string{}
+			for _, n := range RolloutNodes(l, matching) {
+				got = append(got, n.Name)
+			}
+			if !reflect.DeepEqual(got, test.exp) {
+				t.Errorf("expected %v, got %v", test.exp, got)
+			}
+		})
+	}
+}
+
+// generationNodes is a node store counting its changes and lists.
+type generationNodes struct {
+	cache.Store
+	generation uint64
+	lists      int
+}
+
+func (s *generationNodes) List() []interface{} {
+	s.lists++
+	return s.Store.List()
+}
+
+func (s *generationNodes) Generation() uint64 { return s.generation }
+
+func TestInRolloutCachesSelection(t *testing.T) {
+	store := &generationNodes{Store: cache.NewStore(cache.MetaNamespaceKeyFunc)}
+	for i, name := range []string{"n1", "n2", "n3", "n4"} {
+		store.Add(rolloutNode(name, i, "a"))
+	}
+	terms := []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{
+		{Key: "topology.kubernetes.io/zone", Operator: corev1.NodeSelectorOpExists},
+	}}}
+	newController := func(spec labelerv1alpha1.LabelerSpec) *LabelController {
+		spec.NodeSelector = corev1.NodeSelector{NodeSelectorTerms: terms}
+		l := &labelerv1alpha1.Labeler{ObjectMeta: metav1.ObjectMeta{Name: "l"}, Spec: spec}
+		return NewLabelController(Config{}, l, store, kooperlog.Dummy)
+	}
+
+	lc := newController(labelerv1alpha1.LabelerSpec{})
+	for _, obj := range store.Store.List() {
+		if in, _ := lc.inRollout(obj.(*corev1.Node)); !in {
+			t.Errorf("expected every node in the rollout without percentage")
+		}
+	}
+	if store.lists != 0 {
+		t.Errorf("expected no node listed without rollout, got %d lists", store.lists)
+	}
+
+	lc = newController(labelerv1alpha1.LabelerSpec{RolloutPercentage: int32Ptr(50), RolloutOrder: labelerv1alpha1.RolloutOrderOldest})
+	var selected []string
+	for _, name := range []string{"n1", "n2", "n3", "n4"} {
+		obj, _, _ := store.GetByKey(name)
+		if in, _ := lc.inRollout(obj.(*corev1.Node)); in {
+			selected = append(selected, name)
+		}
+	}
+	if !reflect.DeepEqual(selected, []string{"n1", "n2"}) {
+		t.Errorf("expected n1 and n2 in the rollout, got %v", selected)
+	}
+	if store.lists != 1 {
+		t.Errorf("expected the rollout computed once, got %d lists", store.lists)
+	}
+
+	// A node cache change computes it again.
+	store.generation++
+	obj, _, _ := store.GetByKey("n1")
+	lc.inRollout(obj.(*corev1.Node))
+	if store.lists != 2 {
+		t.Errorf("expected the rollout computed again once the nodes changed, got %d lists", store.lists)
+	}
+}
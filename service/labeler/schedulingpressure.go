@@ -0,0 +1,350 @@
+package labeler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// SchedulingPressureType is the value source type that needs the scheduling
+	// failures of the nodes.
+	SchedulingPressureType = "schedulingPressure"
+
+	// failedSchedulingReason is the reason of the scheduler events of the pods it
+	// couldn't schedule.
+	failedSchedulingReason = "FailedScheduling"
+	// hostnameLabel is the well-known node label the pods are pinned to a node with.
+	hostnameLabel = "kubernetes.io/hostname"
+	// maxNodeFailures bounds the scheduling failures kept by node, the threshold
+	// can't be over it.
+	maxNodeFailures = 100
+	// stateCacheSchedulingPods caches the node the failed pods are pinned to.
+	stateCacheSchedulingPods = "scheduling-pods"
+)
+
+// resourcePressure are the parts of the FailedScheduling messages of the resource
+// pressure failures, the rest (affinity, taints) are not counted.
+var resourcePressure = []string{"Insufficient ", "Too many pods"}
+
+// SchedulingFailureStore is where the label controllers get the recent resource
+// pressure scheduling failures of the pods pinned to a node from.
+type SchedulingFailureStore interface {
+	// NodeSchedulingFailures returns when the pods pinned to the node failed to
+	// schedule, false if unknown.
+	NodeSchedulingFailures(nodeName string) ([]time.Time, bool)
+}
+
+// FailuresValueSource is a value source that resolves the value from the recent
+// scheduling failures of the node. Its Resolve is used when they are not available
+// (e.g. offline diffs).
+type FailuresValueSource interface {
+	ValueSource
+	ResolveFailures(node *corev1.Node, failures []time.Time) (string, bool, error)
+	// NextFailuresChange returns when the value changes from now without new
+	// failures, 0 if it doesn't.
+	NextFailuresChange(failures []time.Time, now time.Time) time.Duration
+}
+
+// schedulingPressureSource resolves whether the pods pinned to the node failed to
+// schedule for lack of resources at least threshold times in the window.
+type schedulingPressureSource struct {
+	threshold      int
+	window         time.Duration
+	pressure, none string
+}
+
+// newSchedulingPressureSource resolves the "pressure" value (true) when "threshold"
+// scheduling failures happened in the last "window", the "none" one (false) otherwise.
+func newSchedulingPressureSource(params map[string]string) (ValueSource, error) {
+	s := schedulingPressureSource{pressure: "true", none: "false"}
+	param, err := requiredParam(params, "threshold")
+	if err != nil {
+		return nil, err
+	}
+	if s.threshold, err = strconv.Atoi(param); err != nil || s.threshold < 1 || s.threshold > maxNodeFailures {
+		return nil, fmt.Errorf("threshold param must be between 1 and %d, got %q", maxNodeFailures, param)
+	}
+	if param, err = requiredParam(params, "window"); err != nil {
+		return nil, err
+	}
+	if s.window, err = time.ParseDuration(param); err != nil || s.window <= 0 {
+		return nil, fmt.Errorf("window param must be a positive duration, got %q", param)
+	}
+	if v := params["pressure"]; v != "" {
+		s.pressure = v
+	}
+	if v := params["none"]; v != "" {
+		s.none = v
+	}
+	if s.pressure == s.none {
+		return nil, fmt.Errorf("pressure and none params must differ, got %q", s.pressure)
+	}
+	return s, nil
+}
+
+// Resolve satisfies ValueSource interface, without the failures it's not resolved.
+func (s schedulingPressureSource) Resolve(node *corev1.Node) (string, bool, error) {
+	return "", false, nil
+}
+
+// recent returns the failures in the window, oldest first.
+func (s schedulingPressureSource) recent(failures []time.Time, now time.Time) []time.Time {
+	var recent []time.Time
+	for _, t := range failures {
+		if now.Sub(t) < s.window {
+			recent = append(recent, t)
+		}
+	}
+	sort.Slice(recent, func(i, j int) bool { return recent[i].Before(recent[j]) })
+	return recent
+}
+
+// ResolveFailures satisfies FailuresValueSource interface.
+func (s schedulingPressureSource) ResolveFailures(node *corev1.Node, failures []time.Time) (string, bool, error) {
+	if len(s.recent(failures, time.Now())) >= s.threshold {
+		return s.pressure, true, nil
+	}
+	return s.none, true, nil
+}
+
+// NextFailuresChange satisfies FailuresValueSource interface, the pressure subsides
+// once enough failures leave the window.
+func (s schedulingPressureSource) NextFailuresChange(failures []time.Time, now time.Time) time.Duration {
+	recent := s.recent(failures, now)
+	if len(recent) < s.threshold {
+		return 0
+	}
+	return recent[len(recent)-s.threshold].Add(s.window).Sub(now)
+}
+
+// needsSchedulingFailures returns true if the label controller has value sources that
+// need the scheduling failures of the nodes.
+func (lc *LabelController) needsSchedulingFailures() bool {
+	for _, lv := range lc.values {
+		for _, src := range leafSources(lv.source) {
+			if _, ok := src.(FailuresValueSource); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// schedulingFailures has the recent resource pressure scheduling failures of the pods
+// pinned to every node, from the FailedScheduling events.
+type schedulingFailures struct {
+	c *Labeler
+	// pods caches the node the failed pods are pinned to by UID, empty if none.
+	pods *stateCache
+
+	mu       sync.Mutex
+	failures map[string][]time.Time
+	informer cache.SharedIndexInformer
+	// disabled is set if the events can't be listed.
+	disabled bool
+}
+
+func newSchedulingFailures(c *Labeler) *schedulingFailures {
+	return &schedulingFailures{
+		c:        c,
+		pods:     newStateCache(stateCacheSchedulingPods, c.cfg.StateCacheSize, c.cfg.MetricsRecorder),
+		failures: map[string][]time.Time{},
+	}
+}
+
+// NodeSchedulingFailures satisfies SchedulingFailureStore interface.
+func (s *schedulingFailures) NodeSchedulingFailures(nodeName string) ([]time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.disabled {
+		return nil, false
+	}
+	return append([]time.Time(nil), s.failures[nodeName]...), true
+}
+
+// synced returns true once the events were listed, or they can't be.
+func (s *schedulingFailures) synced() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.disabled || s.informer != nil && s.informer.HasSynced()
+}
+
+// selectFailures selects the FailedScheduling events of the pods.
+func selectFailures(options *metav1.ListOptions) {
+	options.FieldSelector = fields.Set{"reason": failedSchedulingReason, "involvedObject.kind": "Pod"}.AsSelector().String()
+}
+
+// run watches the FailedScheduling events until stopped. Without access to the events
+// it's disabled and the scheduling pressure value sources are not resolved.
+func (s *schedulingFailures) run(stopC <-chan struct{}) {
+	events := s.c.k8sCli.CoreV1().Events(metav1.NamespaceAll)
+	options := metav1.ListOptions{Limit: 1}
+	selectFailures(&options)
+	if _, err := events.List(options); errors.IsForbidden(err) || errors.IsNotFound(err) {
+		s.c.logger.Warningf("scheduling failure events can't be listed, the %s value sources are not resolved: %s", SchedulingPressureType, err)
+		s.mu.Lock()
+		s.disabled = true
+		s.mu.Unlock()
+		return
+	}
+
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			selectFailures(&options)
+			return events.List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			selectFailures(&options)
+			return events.Watch(options)
+		},
+	}
+	informer := cache.NewSharedIndexInformer(lw, &corev1.Event{}, 0, cache.Indexers{})
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if ev, ok := obj.(*corev1.Event); ok {
+				s.record(ev, ev.Count)
+			}
+		},
+		// Repeated failures update the count of the event.
+		UpdateFunc: func(old, new interface{}) {
+			oe, ok1 := old.(*corev1.Event)
+			ne, ok2 := new.(*corev1.Event)
+			if ok1 && ok2 && ne.Count > oe.Count {
+				s.record(ne, ne.Count-oe.Count)
+			}
+		},
+	})
+	s.mu.Lock()
+	s.informer = informer
+	s.mu.Unlock()
+	informer.Run(stopC)
+}
+
+// record records count resource pressure failures of the event at its last time on
+// the node the pod is pinned to, and queues the node.
+func (s *schedulingFailures) record(ev *corev1.Event, count int32) {
+	if !pressureMessage(ev.Message) {
+		return
+	}
+	window := s.c.maxFailuresWindow()
+	last := ev.LastTimestamp.Time
+	if window == 0 || time.Since(last) >= window {
+		return
+	}
+	name := s.pinnedNode(ev.InvolvedObject)
+	if name == "" {
+		return
+	}
+
+	s.mu.Lock()
+	kept := s.failures[name][:0]
+	for _, t := range s.failures[name] {
+		if time.Since(t) < window {
+			kept = append(kept, t)
+		}
+	}
+	for i := int32(0); i < count && len(kept) < maxNodeFailures; i++ {
+		kept = append(kept, last)
+	}
+	s.failures[name] = kept
+	s.mu.Unlock()
+	s.c.enqueue(name)
+}
+
+// pressureMessage returns true if the FailedScheduling message is about resources.
+func pressureMessage(msg string) bool {
+	for _, p := range resourcePressure {
+		if strings.Contains(msg, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// pinnedNode returns the name of the cached node the pod is pinned to by its hostname
+// node selector or required node affinity, empty if none. The nodes are looked up by
+// name, they are named like their hostname. The pods are read from the pod cache with
+// WatchPods, otherwise from the API once by UID.
+func (s *schedulingFailures) pinnedNode(ref corev1.ObjectReference) string {
+	if v, ok := s.pods.get(string(ref.UID)); ok {
+		return v.(string)
+	}
+	var pod *corev1.Pod
+	if s.c.podInformer != nil {
+		obj, ok, _ := s.c.podInformer.GetStore().GetByKey(ref.Namespace + "/" + ref.Name)
+		if !ok {
+			return ""
+		}
+		pod = obj.(*corev1.Pod)
+	} else {
+		var err error
+		if pod, err = s.c.k8sCli.CoreV1().Pods(ref.Namespace).Get(ref.Name, metav1.GetOptions{}); err != nil {
+			return ""
+		}
+	}
+
+	name := ""
+	if hostname := podHostname(pod); hostname != "" {
+		obj, ok, _ := s.c.informer().GetStore().GetByKey(hostname)
+		if node, isNode := obj.(*corev1.Node); ok && isNode && node.Labels[hostnameLabel] == hostname {
+			name = node.Name
+		}
+	}
+	s.pods.add(string(ref.UID), name)
+	return name
+}
+
+// podHostname returns the single hostname the pod requires, empty if none.
+func podHostname(pod *corev1.Pod) string {
+	if h := pod.Spec.NodeSelector[hostnameLabel]; h != "" {
+		return h
+	}
+	a := pod.Spec.Affinity
+	if a == nil || a.NodeAffinity == nil || a.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return ""
+	}
+	terms := a.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) != 1 {
+		return ""
+	}
+	for _, req := range terms[0].MatchExpressions {
+		if req.Key == hostnameLabel && req.Operator == corev1.NodeSelectorOpIn && len(req.Values) == 1 {
+			return req.Values[0]
+		}
+	}
+	return ""
+}
+
+// maxFailuresWindow returns the largest window of the scheduling pressure value
+// sources of the labelers, 0 without them.
+func (c *Labeler) maxFailuresWindow() time.Duration {
+	var max time.Duration
+	for _, lc := range c.controllers() {
+		for _, lv := range lc.values {
+			for _, src := range leafSources(lv.source) {
+				if s, ok := src.(schedulingPressureSource); ok && s.window > max {
+					max = s.window
+				}
+			}
+		}
+	}
+	return max
+}
+
+// schedulingFailuresSynced returns true if the scheduling failures are not watched or
+// the events were listed.
+func (c *Labeler) schedulingFailuresSynced() bool {
+	return c.schedulingFailures == nil || c.schedulingFailures.synced()
+}
@@ -0,0 +1,89 @@
+package labeler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ConditionDegraded is set while nodes are not patched because of the annotations
+	// size guard, and on labelers whose NoExecute taints are blocked.
+	ConditionDegraded = "Degraded"
+
+	// maxAnnotationsBytes is the API limit of the total size of the annotations of an
+	// object, the keys and the values.
+	maxAnnotationsBytes = 256 * (1 << 10)
+	// defaultAnnotationsGuardBytes is the default guard, below the limit so the rest
+	// of the writers still have room.
+	defaultAnnotationsGuardBytes = 200 * (1 << 10)
+)
+
+// annotationsSize returns the size of the annotations like the API computes it.
+func annotationsSize(annotations map[string]string) int {
+	size := 0
+	for k, v := range annotations {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+// sizeGuard has the nodes not patched because their annotations would be too large,
+// with their projected size.
+type sizeGuard struct {
+	mu    sync.Mutex
+	nodes map[string]int
+	since time.Time
+}
+
+// track records the projected annotations size of the node, 0 if it's under the guard.
+func (g *sizeGuard) track(name string, size int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if size == 0 {
+		delete(g.nodes, name)
+		return
+	}
+	if g.nodes == nil {
+		g.nodes = map[string]int{}
+	}
+	if len(g.nodes) == 0 {
+		g.since = time.Now()
+	}
+	g.nodes[name] = size
+}
+
+// checkAnnotationsSize returns an error if patching the node would grow its annotations
+// over the guard, nodes already over it (e.g. by other writers) can still shrink.
+func (c *Labeler) checkAnnotationsSize(name string, current, projected map[string]string) error {
+	size := annotationsSize(projected)
+	if size <= c.cfg.AnnotationsGuardBytes || size <= annotationsSize(current) {
+		c.guard.track(name, 0)
+		return nil
+	}
+	c.guard.track(name, size)
+	return fmt.Errorf("annotations would be %d bytes, over the %d bytes guard (the API limit is %d), not patched", size, c.cfg.AnnotationsGuardBytes, maxAnnotationsBytes)
+}
+
+// degradedCondition returns the Degraded condition while nodes are not patched by the
+// annotations size guard, nil otherwise.
+func (c *Labeler) degradedCondition() *Condition {
+	c.guard.mu.Lock()
+	defer c.guard.mu.Unlock()
+	if len(c.guard.nodes) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(c.guard.nodes))
+	for name := range c.guard.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &Condition{
+		Type:     ConditionDegraded,
+		Severity: ConditionSeverityError,
+		Since:    c.guard.since.UTC(),
+		Message:  fmt.Sprintf("%d nodes not patched, their annotations would be over the %d bytes guard: %s", len(names), c.cfg.AnnotationsGuardBytes, strings.Join(names, ", ")),
+	}
+}
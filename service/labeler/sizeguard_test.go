@@ -0,0 +1,76 @@
+package labeler
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// sized returns annotations of the size, a key of a byte and its value.
+func sized(size int) map[string]string {
+	if size == 0 {
+		return nil
+	}
+	return map[string]string{"a": strings.Repeat("x", size-1)}
+}
+
+func TestCheckAnnotationsSize(t *testing.T) {
+	const guard = 100
+	tests := []struct {
+		name      string
+		current   int
+		projected int
+		expErr    bool
+	}{
+		{name: "Annotations at the guard are patched.", projected: guard},
+		{name: "Annotations a byte over the guard are not patched.", projected: guard + 1, expErr: true},
+		{name: "Annotations over the guard that shrink are patched.", current: guard + 50, projected: guard + 20},
+		{name: "Annotations over the guard that keep their size are patched.", current: guard + 50, projected: guard + 50},
+		{name: "Annotations over the guard that grow are not patched.", current: guard + 50, projected: guard + 51, expErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &Labeler{cfg: Config{AnnotationsGuardBytes: guard}.withDefaults()}
+			err := c.checkAnnotationsSize("n1", sized(test.current), sized(test.projected))
+			if (err != nil) != test.expErr {
+				t.Fatalf("expected error %t, got %v", test.expErr, err)
+			}
+			cond := c.degradedCondition()
+			if (cond != nil) != test.expErr {
+				t.Fatalf("expected the Degraded condition %t, got %+v", test.expErr, cond)
+			}
+			if cond != nil && (cond.Type != ConditionDegraded || !strings.Contains(cond.Message, "n1")) {
+				t.Errorf("expected the Degraded condition listing n1, got %+v", cond)
+			}
+
+			// The node is cleared once under the guard.
+			c.checkAnnotationsSize("n1", nil, sized(guard))
+			if cond := c.degradedCondition(); cond != nil {
+				t.Errorf("expected the Degraded condition cleared, got %+v", cond)
+			}
+		})
+	}
+}
+
+func TestAnnotationsSizeGuardBlocksPatch(t *testing.T) {
+	s := newNodeServer(testNode("n1", map[string]string{"pool": "a"}))
+	l := poolLabeler("notes", "a", labelerv1alpha1.LabelerSpec{Merge: labelerv1alpha1.MergeSpec{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"notes": strings.Repeat("x", 2048)}},
+	}})
+	c, stop := newSyncedLabeler(t, s, Config{AnnotationsGuardBytes: 1024}, l)
+	defer stop()
+
+	if _, err := c.syncNode("n1"); err == nil {
+		t.Fatalf("expected the sync to fail over the guard")
+	}
+	if n := s.patchCount(); n != 0 {
+		t.Errorf("expected the node not patched, got %d patches", n)
+	}
+	if cond := c.degradedCondition(); cond == nil {
+		t.Errorf("expected the Degraded condition")
+	}
+}
@@ -0,0 +1,26 @@
+package labeler
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// withAppliedStamps returns a copy of the node with the applied-by and applied-at
+// provenance annotations. They are only stamped on the nodes a labeler mutates and no
+// plan changes them, so they don't trigger reconciles.
+func (c *Labeler) withAppliedStamps(node *corev1.Node, now time.Time) *corev1.Node {
+	node = node.DeepCopy()
+	if node.Annotations == nil {
+		node.Annotations = map[string]string{}
+	}
+	node.Annotations[c.cfg.AppliedByAnnotation] = c.cfg.AppliedBy
+	node.Annotations[c.cfg.AppliedAtAnnotation] = now.UTC().Format(time.RFC3339)
+	return node
+}
+
+// hashIgnored returns the annotations that are not part of the content hash: the hash
+// itself, the stamps, which change on every mutation, and the fingerprint.
+func (c *Labeler) hashIgnored() []string {
+	return []string{c.cfg.ContentHashAnnotation, c.cfg.AppliedByAnnotation, c.cfg.AppliedAtAnnotation, c.cfg.FingerprintAnnotation}
+}
@@ -0,0 +1,473 @@
+package labeler
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joshisa/resource-labeler-operator/log"
+	"github.com/joshisa/resource-labeler-operator/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	processingJobRetries = 3
+	// notSyncedRetry is when a node is processed again if the node cache is not
+	// synced (e.g. the node informer has been restarted).
+	notSyncedRetry = time.Second
+)
+
+// PlanNode plans the label controllers in order on the node, the changes of one are
+// seen by the next ones. It returns the node with all the changes, the mutation of
+// every label controller that changes it and when the node needs to be planned again
+// regardless of its events, 0 if not needed. On label controller errors the changes
+// of the rest of them are still planned. The changes of dry run label controllers are
+// only returned as dry run mutations. With the strict combine policy the keys the label
+// controllers want with different values are left unchanged.
+func PlanNode(lcs []*LabelController, node *corev1.Node) (*corev1.Node, []Mutation, time.Duration, error) {
+	return planNode(lcs, node, "", false)
+}
+
+// planNode is PlanNode logging with the request ID of the node sync, if any. With
+// limitChanges the changes of the label controllers over their max changes per pass
+// are deferred.
+func planNode(lcs []*LabelController, node *corev1.Node, requestID string, limitChanges bool) (*corev1.Node, []Mutation, time.Duration, error) {
+	dst := node
+	var mutations []Mutation
+	var requeue time.Duration
+	var errs []string
+	conflicts := strictConflicts(lcs, node)
+	for _, lc := range lcs {
+		logger := lc.requestLogger(requestID)
+		if conflicts != nil {
+			lc.trackStrictConflicts(node.Name, conflicts[lc], logger)
+		}
+		planned, operation, wait, err := lc.plan(dst, conflicts[lc], logger)
+		if err != nil {
+			lc.cfg.MetricsRecorder.IncLabelerPlans(lc.l.Name, metrics.PlanError)
+			errs = append(errs, fmt.Sprintf("%s: %s", lc.l.Name, err))
+			continue
+		}
+		if wait > 0 && (requeue == 0 || wait < requeue) {
+			requeue = wait
+		}
+		dryRun := lc.DryRun()
+		if dryRun {
+			lc.trackDryRun(node.Name, planned != nil)
+		}
+		if limitChanges && lc.limitsChanges() {
+			admitted, wait := true, time.Duration(0)
+			if planned != nil {
+				admitted, wait = lc.admitChange(node.Name, time.Now())
+			}
+			lc.trackPassPlanned(node.Name, !admitted)
+			if !admitted {
+				logger.Infof("%s: node %s changes deferred by --max-changes-per-pass %d, planned again in %s", lc.l.Name, node.Name, lc.cfg.MaxChangesPerPass, wait)
+				lc.cfg.MetricsRecorder.IncLabelerPlans(lc.l.Name, metrics.PlanDeferred)
+				if requeue == 0 || wait < requeue {
+					requeue = wait
+				}
+				continue
+			}
+		}
+		if planned == nil {
+			lc.cfg.MetricsRecorder.IncLabelerPlans(lc.l.Name, metrics.PlanUnchanged)
+			continue
+		}
+		lc.cfg.MetricsRecorder.IncLabelerPlans(lc.l.Name, metrics.PlanChanged)
+
+		mutations = append(mutations, Mutation{
+			Node:       node.Name,
+			Rule:       lc.l.Name,
+			Operation:  operation,
+			Keys:       changedKeys(dst, planned),
+			Overwrites: lc.foreignOverwrites(dst, planned),
+			DryRun:     dryRun,
+		})
+		if !dryRun {
+			dst = planned
+		}
+	}
+
+	if len(errs) > 0 {
+		return dst, mutations, requeue, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return dst, mutations, requeue, nil
+}
+
+// Reconcile outcomes.
+const (
+	ReconcilePatched     = "patched"
+	ReconcileUnchanged   = "unchanged"
+	ReconcileSkipped     = "skipped"
+	ReconcileFrozen      = "frozen"
+	ReconcilePaused      = "paused"
+	ReconcileKillSwitch  = "kill-switch"
+	ReconcileNotLeader   = "not-leader"
+	ReconcileNotFound    = "not-found"
+	ReconcileNotSynced   = "not-synced"
+	ReconcileDraining    = "draining"
+	ReconcileZoneLimited = "zone-limited"
+	ReconcileError       = "error"
+)
+
+// ReconcileResult is what a node sync did.
+type ReconcileResult struct {
+	Node string
+	// Outcome is how the sync ended, one of the reconcile outcomes.
+	Outcome string
+	// Matched is the number of labelers whose selector matches the node.
+	Matched int
+	// Mutations are the applied mutations, and the dry run ones.
+	Mutations []Mutation
+	// Conflicts are the values of the matching labelers the node keeps.
+	Conflicts []Conflict
+	// RequeueAfter is when the node needs to be synced again regardless of its
+	// events, 0 if not needed.
+	RequeueAfter time.Duration
+	// Patched is the node once patched, nil if it was not.
+	Patched *corev1.Node
+	// RequestID correlates the log lines of the sync.
+	RequestID string
+}
+
+// ReconcileRecorder is notified of the node sync results.
+type ReconcileRecorder interface {
+	RecordReconcile(res ReconcileResult)
+}
+
+// processNextNode processes the next queued node and returns false when the queue
+// has been shut down. It translates the result of the sync into the queue decisions.
+func (c *Labeler) processNextNode() bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+	c.cycle.begin()
+	defer c.cycle.end(c.queue, c.logger.Infof, c.noopf)
+	// The request ID is kept until the result is handled, for the error logs.
+	requestID := c.beginReconcile(key.(string))
+	defer c.endReconcile(key.(string))
+
+	res, err := c.syncNodeRecovered(key.(string))
+	res.RequestID = requestID
+	if err != nil {
+		res.Outcome = ReconcileError
+		c.recordError(fmt.Errorf("node %s: %s", key, err))
+	}
+	c.cfg.MetricsRecorder.IncNodeSyncs(res.Outcome)
+	if c.cfg.ReconcileRecorder != nil {
+		c.cfg.ReconcileRecorder.RecordReconcile(res)
+	}
+	if c.breaker != nil && c.breaker.record(err != nil, time.Now()) {
+		c.logger.Errorf("sync error rate over %.0f%% in %s, circuit breaker open: node mutations paused for %s", c.cfg.ErrorCircuitThreshold*100, c.cfg.ErrorCircuitWindow, c.cfg.ErrorCircuitWindow)
+		c.cfg.MetricsRecorder.SetCircuitBreakerOpen(true)
+	}
+	if err != nil {
+		c.handleSyncError(key.(string), err)
+		return true
+	}
+	c.stopped.track(key.(string), nil)
+	c.queue.Forget(key)
+	if res.RequeueAfter > 0 {
+		c.queue.AddAfter(key, res.RequeueAfter)
+	}
+	return true
+}
+
+// syncNode applies all the labelers on the node with a single patch and returns what
+// it did. On plan errors the result has the rest of the changes, they are applied.
+func (c *Labeler) syncNode(key string) (ReconcileResult, error) {
+	res := ReconcileResult{Node: key}
+	if !c.nodesSynced() {
+		res.Outcome, res.RequeueAfter = ReconcileNotSynced, notSyncedRetry
+		return res, nil
+	}
+
+	obj, exists, err := c.getNode(key)
+	if err != nil {
+		return res, err
+	}
+	// Deleted node, nothing to do.
+	if !exists {
+		res.Outcome = ReconcileNotFound
+		return res, nil
+	}
+
+	node, ok := obj.(*corev1.Node)
+	if !ok {
+		return res, fmt.Errorf("invalid node object %s", key)
+	}
+	logger := c.nodeLogger(key)
+	logNoop(logger, c.cfg.LogNoop, "Node updated: %s", node.Name)
+
+	if c.cfg.SkipDrainingNodes {
+		draining, reason, err := c.draining(node)
+		if err != nil {
+			logger.Warningf("could not check if node %s is being drained: %s", node.Name, err)
+		}
+		if draining {
+			logger.Infof("node %s is being drained (%s), sync deferred for %s", node.Name, reason, c.cfg.DrainingRequeue)
+			res.Outcome, res.RequeueAfter = ReconcileDraining, c.cfg.DrainingRequeue
+			return res, nil
+		}
+	}
+
+	lcs := c.controllers()
+	useHash := c.cfg.ContentHash && !c.cfg.DryRun && hashable(lcs)
+	if useHash && !c.forced(key) && node.Annotations[c.cfg.ContentHashAnnotation] == c.nodeContentHash(key, node, lcs) {
+		c.cycle.skip()
+		if c.cfg.TrackDesiredLabels {
+			c.desired.record(node.Name, node.Labels)
+		}
+		res.Outcome = ReconcileSkipped
+		return res, nil
+	}
+
+	dst, planned, requeueAfter, planErr := planNode(lcs, node, c.RequestID(key), true)
+	if c.cfg.OrphanPolicy == OrphanRemove {
+		var orphaned []Mutation
+		dst, orphaned = c.removeOrphans(node, dst)
+		planned = append(planned, orphaned...)
+	}
+	res.RequeueAfter = requeueAfter
+	if c.cfg.TrackDesiredLabels {
+		c.desired.record(node.Name, dst.Labels)
+	}
+	for _, lc := range lcs {
+		if NodeMatchesNodeSelectorTerms(node, lc.l.Spec.NodeSelectorTerms) {
+			res.Matched++
+			res.Conflicts = append(res.Conflicts, lc.conflicts(dst, nil)...)
+		}
+	}
+	var mutations []Mutation
+	for _, m := range planned {
+		if !m.DryRun {
+			mutations = append(mutations, m)
+			continue
+		}
+		logger.Infof("dry run: %s would %s %s on node %s", m.Rule, m.Operation, strings.Join(m.Keys, ", "), m.Node)
+		m.Time, m.RequestID = time.Now(), c.RequestID(key)
+		c.cfg.MutationRecorder.RecordMutation(m)
+		res.Mutations = append(res.Mutations, m)
+	}
+	if c.cfg.AppliedBy != "" && len(mutations) > 0 {
+		dst = c.withAppliedStamps(dst, time.Now())
+	}
+	if c.cfg.FingerprintAnnotation != "" && !c.cfg.DryRun {
+		dst = c.withFingerprint(dst)
+	}
+	// The global dry run doesn't write the hash either, nothing is patched.
+	if c.cfg.ContentHash && !c.cfg.DryRun {
+		// Only a complete plan is hashed, otherwise a stale hash is removed.
+		hash := ""
+		if useHash && planErr == nil {
+			hash = contentHash(dst, lcs, c.hashIgnored()...)
+		}
+		dst = withContentHash(dst, c.cfg.ContentHashAnnotation, hash)
+	}
+	if len(mutations) == 0 && dst == node {
+		res.Outcome = ReconcileUnchanged
+		return res, planErr
+	}
+
+	if c.killed() {
+		// Clearing the kill switch syncs all the nodes again, no need to requeue.
+		log.Debugf(logger, "node mutations stopped by the kill switch, node %s not patched", node.Name)
+		res.Outcome = ReconcileKillSwitch
+		return res, nil
+	}
+	if !c.lease.hold() {
+		// Acquiring the lease syncs all the nodes again, no need to requeue.
+		log.Debugf(logger, "not holding the leader lease, node %s not patched", node.Name)
+		res.Outcome = ReconcileNotLeader
+		return res, nil
+	}
+	defer c.lease.done()
+	if wait := c.frozenFor(); wait > 0 {
+		log.Debugf(logger, "node mutations frozen, node %s not patched", node.Name)
+		res.Outcome, res.RequeueAfter = ReconcileFrozen, wait
+		return res, nil
+	}
+	if ok, wait := c.allowMutations(); !ok {
+		log.Debugf(logger, "circuit breaker open, node %s not patched", node.Name)
+		res.Outcome, res.RequeueAfter = ReconcilePaused, wait
+		return res, nil
+	}
+	if c.zones != nil && disruptive(node, dst) {
+		slot, wait := c.zones.acquire(node, time.Now())
+		if slot == nil {
+			logger.Infof("disruptive mutations of node %s zone %q at --max-unavailable-per-zone, requeued in %s", node.Name, NodeZone(node, c.cfg.ZoneLabel), wait)
+			res.Outcome, res.RequeueAfter = ReconcileZoneLimited, wait
+			return res, nil
+		}
+		defer func() { c.zones.release(slot, res.Outcome == ReconcilePatched, time.Now()) }()
+	}
+	if err := c.checkAnnotationsSize(node.Name, node.Annotations, dst.Annotations); err != nil {
+		return res, err
+	}
+	if c.cfg.TaintEvictionReport {
+		report, err := c.evictionReport(node, dst)
+		if err != nil {
+			logger.Warningf("could not check the taint eviction impact: %s", err)
+		} else if report != nil {
+			c.reportEviction(node, report)
+		}
+	}
+	patched, err := c.patchNode(node, dst)
+	if err != nil {
+		return res, err
+	}
+	if patched == nil {
+		res.Outcome = ReconcileUnchanged
+		return res, planErr
+	}
+	if c.cfg.VerifyIdempotent {
+		c.verifyIdempotent(lcs, patched)
+	}
+	res.Outcome, res.Patched = ReconcilePatched, patched
+	c.cycle.patch()
+	now := time.Now()
+	for _, m := range mutations {
+		m.Time, m.RequestID = now, c.RequestID(key)
+		c.cfg.MutationRecorder.RecordMutation(m)
+		c.reportOverwrites(node, m)
+		res.Mutations = append(res.Mutations, m)
+	}
+	return res, planErr
+}
+
+// noopf logs what doesn't change the nodes, only at debug level unless LogNoop is set.
+func (c *Labeler) noopf(format string, args ...interface{}) {
+	logNoop(c.logger, c.cfg.LogNoop, format, args...)
+}
+
+// allowMutations returns true if the circuit breaker allows mutating the nodes,
+// otherwise when to try again.
+func (c *Labeler) allowMutations() (bool, time.Duration) {
+	if c.breaker == nil {
+		return true, 0
+	}
+	allowed, closed, wait := c.breaker.allow(time.Now())
+	if closed {
+		c.logger.Infof("circuit breaker closed, resuming node mutations")
+		c.cfg.MetricsRecorder.SetCircuitBreakerOpen(false)
+	}
+	return allowed, wait
+}
+
+// patchNode patches the node with all the changes to get the desired one and returns
+// the patched node. It returns nil without calling the API if the node is already the
+// desired one. Patches over the maximum size are applied in sequential chunks, except
+// the server-side applies.
+func (c *Labeler) patchNode(node, dst *corev1.Node) (*corev1.Node, error) {
+	logger := c.nodeLogger(node.Name)
+	patch, err := nodePatch(node, dst)
+	if err != nil {
+		return nil, err
+	}
+	if len(patch) == 0 {
+		log.Debugf(logger, "node %s already in the desired state, not patched", node.Name)
+		return nil, nil
+	}
+
+	// The applies have every owned field of their manager, they are not chunked.
+	chunks := []map[string]interface{}{patch}
+	if c.cfg.PatchType != PatchApply {
+		chunks = chunkPatch(patch, c.cfg.MaxPatchBytes, c.cfg.OwnerAnnotation, c.cfg.ContentHashAnnotation, c.cfg.AppliedByAnnotation, c.cfg.AppliedAtAnnotation, c.cfg.FingerprintAnnotation)
+	}
+	if len(chunks) > 1 {
+		logger.Infof("patch of node %s over %d bytes, applied in %d chunks", node.Name, c.cfg.MaxPatchBytes, len(chunks))
+		c.cfg.MetricsRecorder.IncChunkedPatches()
+	}
+	patched := node
+	for i, chunk := range chunks {
+		if patched, err = c.sendPatch(patched, chunk); err != nil {
+			if len(chunks) > 1 {
+				return nil, chunkError{chunk: i + 1, chunks: len(chunks), err: err}
+			}
+			return nil, err
+		}
+	}
+	logger.Infof("Node %s patched", node.Name)
+	return patched, nil
+}
+
+// chunkError is the error patching a chunk, its cause keeps the API status.
+type chunkError struct {
+	chunk, chunks int
+	err           error
+}
+
+func (e chunkError) Error() string {
+	return fmt.Sprintf("chunk %d of %d: %s", e.chunk, e.chunks, e.err)
+}
+
+// Cause returns the error patching the chunk.
+func (e chunkError) Cause() error {
+	return e.err
+}
+
+// reconcileCycle measures a reconcile cycle: from the first processed node until the
+// node queue is drained.
+type reconcileCycle struct {
+	mu       sync.Mutex
+	start    time.Time
+	inflight int
+	nodes    int
+	apiCalls int
+	// skipped are the nodes skipped by their content hash.
+	skipped int
+	patched int
+}
+
+func (r *reconcileCycle) begin() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.inflight == 0 && r.nodes == 0 {
+		r.start = time.Now()
+	}
+	r.inflight++
+}
+
+func (r *reconcileCycle) skip() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.skipped++
+}
+
+func (r *reconcileCycle) patch() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.patched++
+}
+
+func (r *reconcileCycle) apiCall() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.apiCalls++
+}
+
+// end finishes processing a node, if it's the last one of the cycle the cycle is logged.
+func (r *reconcileCycle) end(queue workqueue.Interface, logf, noopf func(string, ...interface{})) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inflight--
+	r.nodes++
+	if r.inflight > 0 || queue.Len() > 0 {
+		return
+	}
+
+	// Cycles that patched no nodes are no-ops.
+	if r.patched == 0 {
+		logf = noopf
+	}
+	logf("reconcile cycle: %d nodes synced with %d API calls (%d skipped by content hash) in %s", r.nodes, r.apiCalls, r.skipped, time.Since(r.start))
+	r.nodes = 0
+	r.patched = 0
+	r.apiCalls = 0
+	r.skipped = 0
+}
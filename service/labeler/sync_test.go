@@ -0,0 +1,465 @@
+package labeler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	kooperlog "github.com/spotahome/kooper/log"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+func TestPlanNodeDryRun(t *testing.T) {
+	tests := []struct {
+		name          string
+		globalDryRun  bool
+		ruleDryRun    bool
+		expPreviewDry bool
+		expEnforceDry bool
+	}{
+		{
+			name: "Without dry run every labeler is applied.",
+		},
+		{
+			name:          "A dry run labeler is previewed while the others are applied.",
+			ruleDryRun:    true,
+			expPreviewDry: true,
+		},
+		{
+			name:          "The global dry run previews every labeler.",
+			globalDryRun:  true,
+			expPreviewDry: true,
+			expEnforceDry: true,
+		},
+		{
+			name:          "The global dry run previews every labeler, dry run or not.",
+			globalDryRun:  true,
+			ruleDryRun:    true,
+			expPreviewDry: true,
+			expEnforceDry: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node := testNode("n1", map[string]string{"pool": "a"})
+			nodes := cache.NewStore(cache.MetaNamespaceKeyFunc)
+			nodes.Add(node)
+			newController := func(name string, labels map[string]string, dryRun bool) *LabelController {
+				l := &labelerv1alpha1.Labeler{
+					ObjectMeta: metav1.ObjectMeta{Name: name},
+					Spec: labelerv1alpha1.LabelerSpec{
+						NodeSelector: corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{
+							{Key: "pool", Operator: corev1.NodeSelectorOpExists},
+						}}}},
+						Merge:  mergeSpec(labels),
+						DryRun: dryRun,
+					},
+				}
+				return NewLabelController(Config{DryRun: test.globalDryRun}, l, nodes, kooperlog.Dummy)
+			}
+			preview := newController("preview", map[string]string{"preview": "true"}, test.ruleDryRun)
+			enforce := newController("enforce", map[string]string{"enforce": "true"}, false)
+
+			dst, mutations, _, err := PlanNode([]*LabelController{preview, enforce}, node)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(mutations) != 2 {
+				t.Fatalf("expected a mutation by labeler, got %+v", mutations)
+			}
+			for i, exp := range []struct {
+				lc     *LabelController
+				label  string
+				dryRun bool
+			}{{preview, "preview", test.expPreviewDry}, {enforce, "enforce", test.expEnforceDry}} {
+				if mutations[i].DryRun != exp.dryRun {
+					t.Errorf("expected the %s mutation dry run %t, got %t", exp.label, exp.dryRun, mutations[i].DryRun)
+				}
+				if _, applied := dst.Labels[exp.label]; applied == exp.dryRun {
+					t.Errorf("expected the %s label applied %t, got %v", exp.label, !exp.dryRun, dst.Labels)
+				}
+				wouldChange := 0
+				if exp.dryRun {
+					wouldChange = 1
+				}
+				if n := exp.lc.dryRunNodes(); n != wouldChange {
+					t.Errorf("expected the %s labeler to report %d dry run nodes, got %d", exp.label, wouldChange, n)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkPatchNodeAPICalls measures the API calls to patch the changes of three
+// labelers on nodes that got a heartbeat since planned, with a patch per labeler and
+// with their changes coalesced in a single patch.
+func BenchmarkPatchNodeAPICalls(b *testing.B) {
+	labels := []map[string]string{{"a": "1"}, {"b": "2"}, {"c": "3"}}
+	planned := testNode("n1", nil)
+	planned.ResourceVersion = "1"
+	newLabeler := func() (*Labeler, *heartbeatServer, func()) {
+		current := planned.DeepCopy()
+		current.ResourceVersion = "2"
+		s := &heartbeatServer{node: *current}
+		srv := httptest.NewServer(s)
+		cli, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+		if err != nil {
+			b.Fatal(err)
+		}
+		return &Labeler{cfg: Config{}.withDefaults(), logger: kooperlog.Dummy, k8sCli: cli}, s, srv.Close
+	}
+	withLabels := func(node *corev1.Node, sets ...map[string]string) *corev1.Node {
+		dst := node.DeepCopy()
+		if dst.Labels == nil {
+			dst.Labels = map[string]string{}
+		}
+		for _, set := range sets {
+			for k, v := range set {
+				dst.Labels[k] = v
+			}
+		}
+		return dst
+	}
+
+	b.Run("a patch per labeler", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			c, _, stop := newLabeler()
+			node := planned
+			for _, set := range labels {
+				patched, err := c.patchNode(node, withLabels(node, set))
+				if err != nil {
+					b.Fatal(err)
+				}
+				node = patched
+			}
+			stop()
+			b.ReportMetric(float64(c.cycle.apiCalls), "api-calls/node")
+		}
+	})
+	b.Run("coalesced", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			c, _, stop := newLabeler()
+			if _, err := c.patchNode(planned, withLabels(planned, labels...)); err != nil {
+				b.Fatal(err)
+			}
+			stop()
+			b.ReportMetric(float64(c.cycle.apiCalls), "api-calls/node")
+		}
+	})
+}
+
+// nodeServer is a test API server of the nodes: it lists and gets them, applies the
+// merge patches counting them and answers the other requests with not found. The
+// watches get no events until the server is stopped.
+type nodeServer struct {
+	done chan struct{}
+
+	mu    sync.Mutex
+	nodes map[string]*corev1.Node
+	// patches are the bodies of the node patches.
+	patches []string
+	// patchErr fails the patches with its status, and its reason, if set.
+	patchErr    int
+	patchReason metav1.StatusReason
+}
+
+func newNodeServer(nodes ...*corev1.Node) *nodeServer {
+	s := &nodeServer{done: make(chan struct{}), nodes: map[string]*corev1.Node{}}
+	for _, n := range nodes {
+		n = n.DeepCopy()
+		n.APIVersion, n.Kind = "v1", "Node"
+		if n.ResourceVersion == "" {
+			n.ResourceVersion = "1"
+		}
+		s.nodes[n.Name] = n
+	}
+	return s
+}
+
+func (s *nodeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	name := strings.TrimPrefix(r.URL.Path, "/api/v1/nodes/")
+	switch {
+	case r.URL.Path == "/api/v1/nodes" && r.URL.Query().Get("watch") == "true":
+		s.mu.Unlock()
+		<-s.done
+		s.mu.Lock()
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/nodes":
+		list := corev1.NodeList{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "NodeList"}, ListMeta: metav1.ListMeta{ResourceVersion: "1"}}
+		for _, n := range s.nodes {
+			list.Items = append(list.Items, *n)
+		}
+		json.NewEncoder(w).Encode(list)
+	case r.Method == http.MethodGet && s.nodes[name] != nil:
+		json.NewEncoder(w).Encode(s.nodes[name])
+	case r.Method == http.MethodPatch && s.nodes[name] != nil:
+		b, _ := ioutil.ReadAll(r.Body)
+		s.patches = append(s.patches, string(b))
+		if s.patchErr != 0 {
+			w.WriteHeader(s.patchErr)
+			json.NewEncoder(w).Encode(metav1.Status{Status: metav1.StatusFailure, Code: int32(s.patchErr), Reason: s.patchReason})
+			return
+		}
+		var patch, node map[string]interface{}
+		json.Unmarshal(b, &patch)
+		cur, _ := json.Marshal(s.nodes[name])
+		json.Unmarshal(cur, &node)
+		mergeJSON(node, patch)
+		patched := &corev1.Node{}
+		b, _ = json.Marshal(node)
+		json.Unmarshal(b, patched)
+		v, _ := strconv.Atoi(s.nodes[name].ResourceVersion)
+		patched.ResourceVersion = strconv.Itoa(v + 1)
+		s.nodes[name] = patched
+		json.NewEncoder(w).Encode(patched)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(metav1.Status{Status: metav1.StatusFailure, Code: http.StatusNotFound, Reason: metav1.StatusReasonNotFound})
+	}
+}
+
+// node returns the node as stored by the server.
+func (s *nodeServer) node(name string) *corev1.Node {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nodes[name].DeepCopy()
+}
+
+// patchCount returns the number of node patches received.
+func (s *nodeServer) patchCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.patches)
+}
+
+// mergeJSON applies the JSON merge patch on the document.
+func mergeJSON(doc, patch map[string]interface{}) {
+	for k, v := range patch {
+		switch pv := v.(type) {
+		case nil:
+			delete(doc, k)
+		case map[string]interface{}:
+			dv, ok := doc[k].(map[string]interface{})
+			if !ok {
+				dv = map[string]interface{}{}
+			}
+			mergeJSON(dv, pv)
+			doc[k] = dv
+		default:
+			doc[k] = v
+		}
+	}
+}
+
+// newSyncedLabeler returns a labeler of the server nodes with the labelers ensured and
+// its node cache synced, and the func stopping it.
+func newSyncedLabeler(t testing.TB, s *nodeServer, cfg Config, ls ...*labelerv1alpha1.Labeler) (*Labeler, func()) {
+	srv := httptest.NewServer(s)
+	cli, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewLabeler(cfg, cli, kooperlog.Dummy)
+	stopC := make(chan struct{})
+	stop := func() {
+		close(stopC)
+		c.queue.ShutDown()
+		close(s.done)
+		srv.Close()
+	}
+	go c.informer().Run(stopC)
+	if !cache.WaitForCacheSync(stopC, c.nodesSynced) {
+		stop()
+		t.Fatal("expected the node cache synced")
+	}
+	for _, l := range ls {
+		if err := c.EnsureLabeler(l); err != nil {
+			stop()
+			t.Fatal(err)
+		}
+	}
+	return c, stop
+}
+
+// poolLabeler returns a labeler of the nodes of the pool merging the spec.
+func poolLabeler(name, pool string, spec labelerv1alpha1.LabelerSpec) *labelerv1alpha1.Labeler {
+	spec.NodeSelector = corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{
+		{Key: "pool", Operator: corev1.NodeSelectorOpIn, Values: []string{pool}},
+	}}}}
+	return &labelerv1alpha1.Labeler{ObjectMeta: metav1.ObjectMeta{Name: name, Generation: 1}, Spec: spec}
+}
+
+func TestRequeueAfterSuccessfulSync(t *testing.T) {
+	tests := []struct {
+		name         string
+		labels       map[string]string
+		requeueAfter *metav1.Duration
+		expPatches   int
+		expRequeue   time.Duration
+	}{
+		{
+			name:         "A patched node is synced again after requeueAfter.",
+			requeueAfter: &metav1.Duration{Duration: 30 * time.Second},
+			expPatches:   1,
+			expRequeue:   30 * time.Second,
+		},
+		{
+			name:         "An unchanged node is synced again after requeueAfter.",
+			labels:       map[string]string{"checked": "true"},
+			requeueAfter: &metav1.Duration{Duration: time.Minute},
+			expRequeue:   time.Minute,
+		},
+		{
+			name:       "Without requeueAfter the node waits for its events.",
+			expPatches: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			labels := map[string]string{"pool": "a"}
+			for k, v := range test.labels {
+				labels[k] = v
+			}
+			s := newNodeServer(testNode("n1", labels))
+			l := poolLabeler("checked", "a", labelerv1alpha1.LabelerSpec{
+				Merge:        mergeSpec(map[string]string{"checked": "true"}),
+				RequeueAfter: test.requeueAfter,
+			})
+			c, stop := newSyncedLabeler(t, s, Config{}, l)
+			defer stop()
+
+			start := time.Now()
+			c.processNextNode()
+			if n := s.patchCount(); n != test.expPatches {
+				t.Errorf("expected %d patches, got %d", test.expPatches, n)
+			}
+			delayed := c.queue.snapshot().Delayed
+			if test.expRequeue == 0 {
+				if len(delayed) != 0 {
+					t.Errorf("expected the node not requeued, got %+v", delayed)
+				}
+				return
+			}
+			if len(delayed) != 1 || delayed[0].Key != "n1" {
+				t.Fatalf("expected n1 requeued, got %+v", delayed)
+			}
+			if at := delayed[0].ReadyAt; at.Before(start.Add(test.expRequeue)) || at.After(time.Now().Add(test.expRequeue)) {
+				t.Errorf("expected n1 requeued in %s, got in %s", test.expRequeue, at.Sub(start))
+			}
+		})
+	}
+}
+
+// reconcileResults records the node sync results.
+type reconcileResults struct {
+	mu      sync.Mutex
+	results []ReconcileResult
+}
+
+func (r *reconcileResults) RecordReconcile(res ReconcileResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, res)
+}
+
+func TestSyncNodeResult(t *testing.T) {
+	s := newNodeServer(
+		testNode("n1", map[string]string{"pool": "a"}),
+		testNode("n2", map[string]string{"pool": "b", "c": "true"}),
+	)
+	c, stop := newSyncedLabeler(t, s, Config{},
+		poolLabeler("a", "a", labelerv1alpha1.LabelerSpec{Merge: mergeSpec(map[string]string{"team": "a"})}),
+		poolLabeler("b", "a", labelerv1alpha1.LabelerSpec{Merge: mergeSpec(map[string]string{"team": "b", "b": "true"})}),
+		poolLabeler("c", "b", labelerv1alpha1.LabelerSpec{Merge: mergeSpec(map[string]string{"c": "true"})}),
+	)
+	defer stop()
+
+	tests := []struct {
+		name         string
+		key          string
+		expOutcome   string
+		expMatched   int
+		expMutations int
+		expConflicts []string
+	}{
+		{
+			name:         "A node selected by conflicting labelers is patched with the mutations and the conflicts.",
+			key:          "n1",
+			expOutcome:   ReconcilePatched,
+			expMatched:   2,
+			expMutations: 2,
+			expConflicts: []string{"labels/team"},
+		},
+		{
+			name:       "A node in the desired state is unchanged.",
+			key:        "n2",
+			expOutcome: ReconcileUnchanged,
+			expMatched: 1,
+		},
+		{
+			name:       "A deleted node is not found.",
+			key:        "n3",
+			expOutcome: ReconcileNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := c.syncNode(test.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Node != test.key || res.Outcome != test.expOutcome || res.Matched != test.expMatched || len(res.Mutations) != test.expMutations {
+				t.Errorf("expected %s outcome %s, %d matched and %d mutations, got %+v", test.key, test.expOutcome, test.expMatched, test.expMutations, res)
+			}
+			var conflicts []string
+			for _, cf := range res.Conflicts {
+				conflicts = append(conflicts, cf.Key)
+			}
+			if !reflect.DeepEqual(conflicts, test.expConflicts) {
+				t.Errorf("expected the conflicts %v, got %+v", test.expConflicts, res.Conflicts)
+			}
+			if (res.Patched != nil) != (test.expOutcome == ReconcilePatched) {
+				t.Errorf("expected the patched node only when patched, got %v", res.Patched)
+			}
+		})
+	}
+}
+
+func TestProcessNextNodeRecordsResult(t *testing.T) {
+	s := newNodeServer(testNode("n1", map[string]string{"pool": "a"}))
+	s.patchErr = http.StatusInternalServerError
+	results := &reconcileResults{}
+	l := poolLabeler("a", "a", labelerv1alpha1.LabelerSpec{Merge: mergeSpec(map[string]string{"team": "a"})})
+	c, stop := newSyncedLabeler(t, s, Config{ReconcileRecorder: results}, l)
+	defer stop()
+
+	c.processNextNode()
+	if len(results.results) != 1 {
+		t.Fatalf("expected a result, got %+v", results.results)
+	}
+	if res := results.results[0]; res.Outcome != ReconcileError || res.Node != "n1" || res.RequestID == "" {
+		t.Errorf("expected the error outcome of n1 with its request ID, got %+v", res)
+	}
+	if delayed := c.queue.snapshot().Delayed; len(delayed) != 1 || delayed[0].Key != "n1" {
+		t.Errorf("expected the failed node retried after a backoff, got %+v", delayed)
+	}
+}
@@ -0,0 +1,104 @@
+package labeler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+	"github.com/joshisa/resource-labeler-operator/log"
+)
+
+// ConditionDeferredTaintRemoval is set while the removal of the taints dropped from the
+// labeler merge taints is deferred on some nodes.
+const ConditionDeferredTaintRemoval = "DeferredTaintRemoval"
+
+// removalDue returns when the deferred taint removals of the labeler are due: the
+// delay after the spec edit, that is when the label controller was created.
+func (lc *LabelController) removalDue() time.Time {
+	return lc.created.Add(lc.l.Spec.TaintRemovalDelay.Duration)
+}
+
+// removeDroppedTaints removes from the desired node the taints the labeler owns on the
+// node and no longer merges, once the Deferred policy delay is over for the NoSchedule
+// and NoExecute ones. The protected taints are never removed. The removed taints are
+// no longer on the desired node, so no longer owned.
+func (lc *LabelController) removeDroppedTaints(node, dst *corev1.Node, logger log.Logger) {
+	current := map[string]corev1.Taint{}
+	for _, t := range node.Spec.Taints {
+		current[taintKey(t)] = t
+	}
+	deferred := lc.l.Spec.TaintRemovalPolicy == labelerv1alpha1.TaintRemovalPolicyDeferred && time.Now().Before(lc.removalDue())
+
+	var kept []string
+	for _, k := range ownedKeys(node, lc.cfg.OwnerAnnotation)[lc.l.Name] {
+		if !strings.HasPrefix(k, taintsPrefix) {
+			continue
+		}
+		t, ok := current[strings.TrimPrefix(k, taintsPrefix)]
+		if !ok || lc.mergesTaint(t) || lc.soaks(t) {
+			continue
+		}
+		keep := lc.protected(t.Key) ||
+			deferred && (t.Effect == corev1.TaintEffectNoSchedule || t.Effect == corev1.TaintEffectNoExecute)
+		if !keep {
+			removeTaint(dst, t)
+			continue
+		}
+		// The merge taints replace the node ones, the kept taint is set back.
+		removeTaint(dst, t)
+		dst.Spec.Taints = append(dst.Spec.Taints, t)
+		if !lc.protected(t.Key) {
+			kept = append(kept, t.ToString())
+		}
+	}
+	lc.trackDeferredTaints(node.Name, kept, logger)
+}
+
+// trackDeferredTaints records the taints whose removal is deferred on the node, none
+// clears it.
+func (lc *LabelController) trackDeferredTaints(name string, taints []string, logger log.Logger) {
+	lc.states.update(name, func(st *nodeState) {
+		if len(taints) > 0 && len(st.deferredTaints) == 0 {
+			logger.Infof("%s: removal of taints %s of node %s deferred until %s", lc.l.Name, strings.Join(taints, ", "), name, lc.removalDue().UTC().Format(time.RFC3339))
+		}
+		st.deferredTaints = taints
+	})
+}
+
+// removalDeferred returns true if the removal of dropped taints of the node is deferred.
+func (lc *LabelController) removalDeferred(name string) bool {
+	return len(lc.states.get(name).deferredTaints) > 0
+}
+
+// deferredTaintsCondition returns the DeferredTaintRemoval condition of the labeler with
+// the cached nodes whose dropped taints are kept and when they are removed, nil if
+// there are none.
+func (lc *LabelController) deferredTaintsCondition() *Condition {
+	states := lc.states.cached(lc.nodes, func(st *nodeState) bool { return len(st.deferredTaints) > 0 })
+	if len(states) == 0 {
+		return nil
+	}
+	seen := map[string]bool{}
+	var taints []string
+	for _, st := range states {
+		for _, t := range st.deferredTaints {
+			if !seen[t] {
+				seen[t] = true
+				taints = append(taints, t)
+			}
+		}
+	}
+	sort.Strings(taints)
+	return &Condition{
+		Labeler:  lc.l.Name,
+		Type:     ConditionDeferredTaintRemoval,
+		Severity: ConditionSeverityWarning,
+		Since:    lc.created.UTC(),
+		Message: fmt.Sprintf("removal of taints %s deferred on %d nodes, scheduled at %s",
+			strings.Join(taints, ", "), len(states), lc.removalDue().UTC().Format(time.RFC3339)),
+	}
+}
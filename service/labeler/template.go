@@ -0,0 +1,108 @@
+package labeler
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// TemplateType is the value source type of the value templates.
+const TemplateType = "template"
+
+// templateFuncs are the helper functions of the value templates, on top of the
+// text/template built-in ones. The set is explicit: string helpers only, nothing reads
+// files, the environment or the network. The value is the last argument so they can be
+// piped like the sprig ones.
+var templateFuncs = template.FuncMap{
+	// lower converts the value to lower case.
+	"lower": strings.ToLower,
+	// upper converts the value to upper case.
+	"upper": strings.ToUpper,
+	// trimPrefix removes the prefix from the value.
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	// trimSuffix removes the suffix from the value.
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	// replace replaces all the old substrings of the value by new.
+	"replace": func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+	// substr returns the bytes of the value from start to end (excluded), the bounds are
+	// clamped to the value and a negative end is the end of the value.
+	"substr": substr,
+	// default returns the value, or def if the value is empty or missing.
+	"default": func(def string, v interface{}) string {
+		if v == nil || fmt.Sprint(v) == "" {
+			return def
+		}
+		return fmt.Sprint(v)
+	},
+	// sha1sum returns the hex SHA-1 of the value, 40 characters.
+	"sha1sum": func(s string) string {
+		sum := sha1.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	},
+}
+
+// TemplateFuncs returns the names of the value template helper functions.
+func TemplateFuncs() []string {
+	names := make([]string, 0, len(templateFuncs))
+	for name := range templateFuncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func substr(start, end int, s string) string {
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 || end > len(s) {
+		end = len(s)
+	}
+	if start > end {
+		return ""
+	}
+	return s[start:end]
+}
+
+// templateData is what the value templates see of the node.
+type templateData struct {
+	Name        string
+	Labels      map[string]string
+	Annotations map[string]string
+	NodeInfo    corev1.NodeSystemInfo
+}
+
+// newTemplateSource resolves the value rendered by the "template" text/template with
+// the node .Name, .Labels, .Annotations and .NodeInfo. Missing labels and annotations
+// render empty, an empty rendered value is not resolved.
+func newTemplateSource(params map[string]string) (ValueSource, error) {
+	text, err := requiredParam(params, "template")
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(TemplateType).Option("missingkey=zero").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %s", err)
+	}
+
+	return ValueSourceFunc(func(node *corev1.Node) (string, bool, error) {
+		data := templateData{
+			Name:        node.Name,
+			Labels:      node.Labels,
+			Annotations: node.Annotations,
+			NodeInfo:    node.Status.NodeInfo,
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", false, fmt.Errorf("could not render the template: %s", err)
+		}
+		v := strings.TrimSpace(buf.String())
+		return v, v != "", nil
+	}), nil
+}
@@ -0,0 +1,66 @@
+package labeler
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSubstr(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end int
+		exp        string
+	}{
+		{name: "The bytes from start to end.", start: 1, end: 3, exp: "u-"},
+		{name: "A negative start is the start of the value.", start: -2, end: 2, exp: "eu"},
+		{name: "A negative end is the end of the value.", start: 3, end: -1, exp: "west-1a"},
+		{name: "An end over the value is clamped.", start: 3, end: 100, exp: "west-1a"},
+		{name: "A start over the value is empty.", start: 20, end: 30, exp: ""},
+		{name: "A start after the end is empty.", start: 4, end: 2, exp: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := substr(test.start, test.end, "eu-west-1a"); got != test.exp {
+				t.Errorf("expected %q, got %q", test.exp, got)
+			}
+		})
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	node := testNode("Node-1.example.com", map[string]string{"zone": "eu-west-1a", "empty": ""})
+	node.Status.NodeInfo = corev1.NodeSystemInfo{KernelVersion: "5.4.0-1029-aws"}
+	tests := []struct {
+		template string
+		exp      string
+	}{
+		{template: "{{.Name | lower}}", exp: "node-1.example.com"},
+		{template: "{{.Labels.zone | upper}}", exp: "EU-WEST-1A"},
+		{template: `{{.Name | trimSuffix ".example.com"}}`, exp: "Node-1"},
+		{template: `{{.Labels.zone | trimPrefix "eu-"}}`, exp: "west-1a"},
+		{template: `{{.NodeInfo.KernelVersion | replace "." "-"}}`, exp: "5-4-0-1029-aws"},
+		{template: "{{.Labels.zone | substr 0 7}}", exp: "eu-west"},
+		{template: `{{.Labels.empty | default "none"}}`, exp: "none"},
+		{template: `{{.Labels.missing | default "none"}}`, exp: "none"},
+		{template: `{{.Labels.zone | default "none"}}`, exp: "eu-west-1a"},
+		{template: "{{.Name | sha1sum | substr 0 8}}", exp: "2da9b8f1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.template, func(t *testing.T) {
+			src, err := newTemplateSource(map[string]string{"template": test.template})
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, ok, err := src.Resolve(node)
+			if err != nil || !ok {
+				t.Fatalf("expected a resolved value, got %t: %v", ok, err)
+			}
+			if v != test.exp {
+				t.Errorf("expected %q, got %q", test.exp, v)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package labeler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/joshisa/resource-labeler-operator/log"
+)
+
+const (
+	// daemonSetCacheTTL is how long a fetched DaemonSet is reused, a node is usually
+	// planned several times in a row.
+	daemonSetCacheTTL = 30 * time.Second
+	// blockedTaintsRetry is when the nodes with blocked taints are planned again.
+	blockedTaintsRetry = time.Minute
+)
+
+// DaemonSetGetter is where the label controllers get the DaemonSets that need to
+// tolerate the NoExecute taints from.
+type DaemonSetGetter interface {
+	DaemonSet(namespace, name string) (*appsv1.DaemonSet, error)
+}
+
+// cachedDaemonSet is a fetched DaemonSet, or the error getting it.
+type cachedDaemonSet struct {
+	ds      *appsv1.DaemonSet
+	err     error
+	fetched time.Time
+}
+
+// daemonSetCache gets the DaemonSets from the API, reusing them for the TTL.
+type daemonSetCache struct {
+	c  *Labeler
+	mu sync.Mutex
+	ds map[string]cachedDaemonSet
+}
+
+// DaemonSet satisfies DaemonSetGetter interface.
+func (d *daemonSetCache) DaemonSet(namespace, name string) (*appsv1.DaemonSet, error) {
+	key := namespace + "/" + name
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if cds, ok := d.ds[key]; ok && time.Since(cds.fetched) < daemonSetCacheTTL {
+		return cds.ds, cds.err
+	}
+	ds, err := d.c.k8sCli.AppsV1().DaemonSets(namespace).Get(name, metav1.GetOptions{})
+	if d.ds == nil {
+		d.ds = map[string]cachedDaemonSet{}
+	}
+	d.ds[key] = cachedDaemonSet{ds: ds, err: err, fetched: time.Now()}
+	return ds, err
+}
+
+// forget drops the cached DaemonSet, it's got again on next use.
+func (d *daemonSetCache) forget(namespace, name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.ds, namespace+"/"+name)
+}
+
+// blockUntolerated removes from the desired node the NoExecute taints the labeler adds
+// that the pods of its required tolerating DaemonSet don't tolerate, so its agents are
+// not evicted. Without DaemonSet getter (offline) nothing is blocked.
+func (lc *LabelController) blockUntolerated(node, dst *corev1.Node, logger log.Logger) {
+	ref := lc.l.Spec.RequireToleratingDaemonSet
+	if ref == nil || lc.cfg.DaemonSets == nil {
+		return
+	}
+	current := map[string]bool{}
+	for _, t := range node.Spec.Taints {
+		current[taintKey(t)] = true
+	}
+	var added []corev1.Taint
+	for _, t := range dst.Spec.Taints {
+		if t.Effect == corev1.TaintEffectNoExecute && !current[taintKey(t)] && lc.mergesTaint(t) {
+			added = append(added, t)
+		}
+	}
+	if len(added) == 0 {
+		lc.trackBlockedTaints(node.Name, "", logger)
+		return
+	}
+
+	ds, err := lc.cfg.DaemonSets.DaemonSet(ref.Namespace, ref.Name)
+	var blocked []string
+	for _, t := range added {
+		t := t
+		if err == nil && tolerated(ds.Spec.Template.Spec.Tolerations, &t) {
+			continue
+		}
+		blocked = append(blocked, t.ToString())
+		removeTaint(dst, t)
+	}
+	reason := ""
+	switch {
+	case len(blocked) == 0:
+	case err != nil:
+		reason = fmt.Sprintf("NoExecute taints %s blocked, could not get the daemonset %s/%s: %s", strings.Join(blocked, ", "), ref.Namespace, ref.Name, err)
+	default:
+		reason = fmt.Sprintf("NoExecute taints %s blocked, the daemonset %s/%s doesn't tolerate them", strings.Join(blocked, ", "), ref.Namespace, ref.Name)
+	}
+	lc.trackBlockedTaints(node.Name, reason, logger)
+}
+
+// mergesTaint returns true if the taint is one of the labeler merge taints.
+func (lc *LabelController) mergesTaint(t corev1.Taint) bool {
+	for _, mt := range lc.l.Spec.Merge.Taints {
+		if taintKey(mt) == taintKey(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// tolerated returns true if one of the tolerations tolerates the taint.
+func tolerated(tolerations []corev1.Toleration, taint *corev1.Taint) bool {
+	for i := range tolerations {
+		if tolerations[i].ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeTaint removes the taint (by key and effect) from the node.
+func removeTaint(node *corev1.Node, taint corev1.Taint) {
+	var kept []corev1.Taint
+	for _, t := range node.Spec.Taints {
+		if taintKey(t) != taintKey(taint) {
+			kept = append(kept, t)
+		}
+	}
+	node.Spec.Taints = kept
+}
+
+// trackBlockedTaints records why the NoExecute taints of the node are blocked, an empty
+// reason clears it.
+func (lc *LabelController) trackBlockedTaints(name, reason string, logger log.Logger) {
+	lc.states.update(name, func(st *nodeState) {
+		if reason == "" {
+			st.blockedTaints, st.blockedSince = "", time.Time{}
+			return
+		}
+		if st.blockedTaints != reason {
+			logger.Warningf("%s: node %s %s", lc.l.Name, name, reason)
+		}
+		if st.blockedTaints == "" {
+			st.blockedSince = time.Now()
+		}
+		st.blockedTaints = reason
+	})
+}
+
+// taintsBlocked returns true if the NoExecute taints of the node are blocked.
+func (lc *LabelController) taintsBlocked(name string) bool {
+	return lc.states.get(name).blockedTaints != ""
+}
+
+// blockedTaintsCondition returns the Degraded condition of the labeler with the cached
+// nodes whose NoExecute taints are blocked, nil if there are none.
+func (lc *LabelController) blockedTaintsCondition() *Condition {
+	states := lc.states.cached(lc.nodes, func(st *nodeState) bool { return st.blockedTaints != "" })
+	if len(states) == 0 {
+		return nil
+	}
+	var since time.Time
+	seen := map[string]bool{}
+	var reasons []string
+	for _, st := range states {
+		if since.IsZero() || st.blockedSince.Before(since) {
+			since = st.blockedSince
+		}
+		if !seen[st.blockedTaints] {
+			seen[st.blockedTaints] = true
+			reasons = append(reasons, st.blockedTaints)
+		}
+	}
+	sort.Strings(reasons)
+	return &Condition{
+		Labeler:  lc.l.Name,
+		Type:     ConditionDegraded,
+		Severity: ConditionSeverityError,
+		Since:    since.UTC(),
+		Message:  fmt.Sprintf("taints blocked on %d nodes to not evict the requireToleratingDaemonSet pods: %s", len(states), strings.Join(reasons, "; ")),
+	}
+}
@@ -0,0 +1,56 @@
+package labeler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// affixChars are the characters a prefix or a suffix can have, the ones of the label
+// values. They don't need to start and end with alphanumeric characters.
+var affixChars = regexp.MustCompile(`^[-A-Za-z0-9_.]*$`)
+
+// transformValue applies the transform to a resolved value: trim, case, prefix and
+// suffix, and sanitize last so it also fixes what the previous ones produced.
+func transformValue(v string, t *labelerv1alpha1.ValueTransform) string {
+	if t == nil {
+		return v
+	}
+	if t.Trim {
+		v = strings.TrimSpace(v)
+	}
+	switch {
+	case t.Lowercase:
+		v = strings.ToLower(v)
+	case t.Uppercase:
+		v = strings.ToUpper(v)
+	}
+	v = t.Prefix + v + t.Suffix
+	if t.Sanitize {
+		v = sanitizeLabelValue(v)
+	}
+	return v
+}
+
+// validateValueTransform returns an error if the transform can't produce label values.
+func validateValueTransform(t *labelerv1alpha1.ValueTransform) error {
+	if t == nil {
+		return nil
+	}
+	if t.Lowercase && t.Uppercase {
+		return fmt.Errorf("valueTransform lowercase and uppercase are mutually exclusive")
+	}
+	for name, affix := range map[string]string{"prefix": t.Prefix, "suffix": t.Suffix} {
+		if !affixChars.MatchString(affix) {
+			return fmt.Errorf("valueTransform %s %q must have only alphanumeric characters, '-', '_' or '.'", name, affix)
+		}
+		if len(affix) > validation.LabelValueMaxLength {
+			return fmt.Errorf("valueTransform %s %q must be no more than %d characters", name, affix, validation.LabelValueMaxLength)
+		}
+	}
+	return nil
+}
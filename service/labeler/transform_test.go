@@ -0,0 +1,167 @@
+package labeler
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	kooperlog "github.com/spotahome/kooper/log"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+func TestTransformValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		transform *labelerv1alpha1.ValueTransform
+		exp       string
+	}{
+		{
+			name:  "Without transform the value is kept.",
+			value: " Rack 1 ",
+			exp:   " Rack 1 ",
+		},
+		{
+			name:      "Trim removes the white space around the value.",
+			value:     " rack-1\n",
+			transform: &labelerv1alpha1.ValueTransform{Trim: true},
+			exp:       "rack-1",
+		},
+		{
+			name:      "Lowercase converts the value to lower case.",
+			value:     "Rack-1",
+			transform: &labelerv1alpha1.ValueTransform{Lowercase: true},
+			exp:       "rack-1",
+		},
+		{
+			name:      "Uppercase converts the value to upper case.",
+			value:     "rack-1",
+			transform: &labelerv1alpha1.ValueTransform{Uppercase: true},
+			exp:       "RACK-1",
+		},
+		{
+			name:      "Prefix and suffix wrap the value.",
+			value:     "rack-1",
+			transform: &labelerv1alpha1.ValueTransform{Prefix: "eu-west-", Suffix: ".a"},
+			exp:       "eu-west-rack-1.a",
+		},
+		{
+			name:      "The value is trimmed before being wrapped.",
+			value:     " rack-1 ",
+			transform: &labelerv1alpha1.ValueTransform{Trim: true, Prefix: "eu-"},
+			exp:       "eu-rack-1",
+		},
+		{
+			name:      "The case is converted before the prefix and suffix, they are kept as is.",
+			value:     "RACK",
+			transform: &labelerv1alpha1.ValueTransform{Lowercase: true, Prefix: "EU-", Suffix: "-A"},
+			exp:       "EU-rack-A",
+		},
+		{
+			name:      "Sanitize fixes the value last, including what the prefix produced.",
+			value:     "Team A/ops",
+			transform: &labelerv1alpha1.ValueTransform{Prefix: "-", Lowercase: true, Sanitize: true},
+			exp:       "team-a-ops",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := transformValue(test.value, test.transform); got != test.exp {
+				t.Errorf("expected %q, got %q", test.exp, got)
+			}
+		})
+	}
+}
+
+func TestValidateValueTransform(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform *labelerv1alpha1.ValueTransform
+		expErr    bool
+	}{
+		{name: "No transform is valid."},
+		{name: "An affix of label value characters is valid.", transform: &labelerv1alpha1.ValueTransform{Prefix: "-eu_", Suffix: ".a"}},
+		{name: "Lowercase and uppercase are exclusive.", transform: &labelerv1alpha1.ValueTransform{Lowercase: true, Uppercase: true}, expErr: true},
+		{name: "An affix with invalid characters is invalid.", transform: &labelerv1alpha1.ValueTransform{Suffix: "/a"}, expErr: true},
+		{name: "An affix over the label value length is invalid.", transform: &labelerv1alpha1.ValueTransform{Prefix: strings.Repeat("a", 64)}, expErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := validateValueTransform(test.transform); (err != nil) != test.expErr {
+				t.Errorf("expected error %t, got %v", test.expErr, err)
+			}
+		})
+	}
+}
+
+func TestValueTransformComposes(t *testing.T) {
+	def := "Unknown"
+	upper := &labelerv1alpha1.ValueTransform{Uppercase: true, Prefix: "zone-"}
+	tests := []struct {
+		name     string
+		spec     labelerv1alpha1.LabelerSpec
+		labels   map[string]string
+		expValue string
+		expSet   bool
+	}{
+		{
+			name: "A mapped value is transformed.",
+			spec: labelerv1alpha1.LabelerSpec{ValueMap: []labelerv1alpha1.ValueMapSpec{
+				{From: "zone", To: "example.com/zone", Values: map[string]string{"a": "eu-a"}, Default: &def, ValueTransform: upper},
+			}},
+			labels:   map[string]string{"zone": "a"},
+			expValue: "zone-EU-A",
+			expSet:   true,
+		},
+		{
+			name: "The default of an unmapped value is not transformed.",
+			spec: labelerv1alpha1.LabelerSpec{ValueMap: []labelerv1alpha1.ValueMapSpec{
+				{From: "zone", To: "example.com/zone", Values: map[string]string{"a": "eu-a"}, Default: &def, ValueTransform: upper},
+			}},
+			labels:   map[string]string{"zone": "b"},
+			expValue: "Unknown",
+			expSet:   true,
+		},
+		{
+			name: "A rendered template is transformed.",
+			spec: labelerv1alpha1.LabelerSpec{ValueFrom: []labelerv1alpha1.ValueFromSpec{{
+				Label: "example.com/zone", Type: TemplateType,
+				Params:         map[string]string{"template": "{{.Labels.region}} {{.Labels.zone}}"},
+				ValueTransform: &labelerv1alpha1.ValueTransform{Lowercase: true, Sanitize: true},
+			}}},
+			labels:   map[string]string{"region": "EU West", "zone": "a"},
+			expValue: "eu-west-a",
+			expSet:   true,
+		},
+		{
+			name: "A transformed value that is not a valid label value is not set.",
+			spec: labelerv1alpha1.LabelerSpec{ValueFrom: []labelerv1alpha1.ValueFromSpec{{
+				Label: "example.com/zone", Type: TemplateType,
+				Params:         map[string]string{"template": "{{.Labels.region}}"},
+				ValueTransform: &labelerv1alpha1.ValueTransform{Lowercase: true},
+			}}},
+			labels: map[string]string{"region": "EU West"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := &labelerv1alpha1.Labeler{ObjectMeta: metav1.ObjectMeta{Name: "l"}, Spec: test.spec}
+			if err := Validate(l); err != nil {
+				t.Fatal(err)
+			}
+			lc := NewLabelController(Config{}, l, cache.NewStore(cache.MetaNamespaceKeyFunc), kooperlog.Dummy)
+			dst := testNode("n1", test.labels)
+
+			lc.resolveValues(dst, kooperlog.Dummy)
+			if v, ok := dst.Labels["example.com/zone"]; ok != test.expSet || v != test.expValue {
+				t.Errorf("expected the label %q set %t, got %q %t", test.expValue, test.expSet, v, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package labeler
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ConditionUnknownSelectorKey is set on labelers whose selector requires label keys
+// that no node has, usually a typo in the key.
+const ConditionUnknownSelectorKey = "UnknownSelectorKey"
+
+// selectorKeys returns the sorted label keys the selector and the when requirements of
+// the labeler need on a node to match. The DoesNotExist and NotIn requirements match
+// nodes without the key, they don't need it.
+func (lc *LabelController) selectorKeys() []string {
+	set := map[string]bool{}
+	add := func(reqs []corev1.NodeSelectorRequirement) {
+		for _, r := range reqs {
+			if r.Operator != corev1.NodeSelectorOpDoesNotExist && r.Operator != corev1.NodeSelectorOpNotIn {
+				set[r.Key] = true
+			}
+		}
+	}
+	for _, t := range lc.l.Spec.NodeSelectorTerms {
+		add(t.MatchExpressions)
+	}
+	add(lc.l.Spec.When)
+
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// unknownSelectorKeysCondition returns the UnknownSelectorKey condition of the labeler,
+// nil if it's not set.
+func (lc *LabelController) unknownSelectorKeysCondition() *Condition {
+	lc.matchesMu.Lock()
+	defer lc.matchesMu.Unlock()
+	if len(lc.unknownKeys) == 0 {
+		return nil
+	}
+	return &Condition{
+		Labeler:  lc.l.Name,
+		Type:     ConditionUnknownSelectorKey,
+		Severity: ConditionSeverityWarning,
+		Since:    lc.unknownKeysSince.UTC(),
+		Message:  "no node has the selector label keys " + strings.Join(lc.unknownKeys, ", ") + ", check them for typos",
+	}
+}
+
+// checkSelectorKeys sets the UnknownSelectorKey condition of the labelers requiring
+// label keys that no cached node has. Unlike NoMatches it's set right away, a missing
+// key is not a node that didn't join yet. Without nodes nothing is checked, the
+// cluster may be scaled to zero.
+func (c *Labeler) checkSelectorKeys() {
+	known := map[string]bool{}
+	nodes := c.informer().GetStore().List()
+	for _, obj := range nodes {
+		if n, ok := obj.(*corev1.Node); ok {
+			for k := range n.Labels {
+				known[k] = true
+			}
+		}
+	}
+
+	now := time.Now()
+	for _, lc := range c.controllers() {
+		var unknown []string
+		if len(nodes) > 0 {
+			for _, k := range lc.selectorKeys() {
+				if !known[k] {
+					unknown = append(unknown, k)
+				}
+			}
+		}
+
+		lc.matchesMu.Lock()
+		changed := strings.Join(unknown, ",") != strings.Join(lc.unknownKeys, ",")
+		if changed {
+			lc.unknownKeys = unknown
+			lc.unknownKeysSince = now
+		}
+		lc.matchesMu.Unlock()
+
+		if changed && len(unknown) > 0 {
+			c.logger.Warningf("%s: no node has the selector label keys %s, check them for typos", lc.l.Name, strings.Join(unknown, ", "))
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package labeler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// Validate checks that the labeler spec is valid.
+func Validate(l *labelerv1alpha1.Labeler) error {
+	if p := l.Spec.RolloutPercentage; p != nil && (*p < 0 || *p > 100) {
+		return fmt.Errorf("%s: rolloutPercentage must be between 0 and 100, got %d", l.Name, *p)
+	}
+	if m := l.Spec.MaxBlastRadius; m != nil && *m < 0 {
+		return fmt.Errorf("%s: maxBlastRadius can't be negative, got %d", l.Name, *m)
+	}
+
+	// Only the nodes are watched, a labeler for another kind would never apply.
+	if k := l.Spec.TargetKind; k != "" && k != labelerv1alpha1.TargetKindNode {
+		return fmt.Errorf("%s: targetKind %q is not watched by the operator, the only watched kind is %s", l.Name, k, labelerv1alpha1.TargetKindNode)
+	}
+
+	switch l.Spec.RolloutOrder {
+	case "", labelerv1alpha1.RolloutOrderHash, labelerv1alpha1.RolloutOrderNewest, labelerv1alpha1.RolloutOrderOldest:
+	default:
+		return fmt.Errorf("%s: %q is not a valid rolloutOrder", l.Name, l.Spec.RolloutOrder)
+	}
+	switch l.Spec.RolloutStrategy {
+	case "", labelerv1alpha1.RolloutStrategyOrdered, labelerv1alpha1.RolloutStrategyBalancedByZone:
+	default:
+		return fmt.Errorf("%s: %q is not a valid rolloutStrategy", l.Name, l.Spec.RolloutStrategy)
+	}
+	if k := l.Spec.RolloutZoneLabel; k != "" {
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+			return fmt.Errorf("%s: rolloutZoneLabel %q is not valid: %s", l.Name, k, strings.Join(errs, ", "))
+		}
+	}
+
+	if m := l.Spec.FieldManager; m != "" {
+		if errs := validation.IsDNS1123Subdomain(m); len(errs) > 0 {
+			return fmt.Errorf("%s: fieldManager %q is not valid: %s", l.Name, m, strings.Join(errs, ", "))
+		}
+		if len(m) > maxFieldManagerLength {
+			return fmt.Errorf("%s: fieldManager %q is over %d characters", l.Name, m, maxFieldManagerLength)
+		}
+	}
+
+	if _, err := NodeSelectorRequirementsAsSelector(l.Spec.When); err != nil {
+		return fmt.Errorf("%s: invalid when requirements: %s", l.Name, err)
+	}
+
+	if vs := l.Spec.VersionSelector; vs != nil {
+		for _, c := range []struct{ field, constraint string }{{"kubelet", vs.Kubelet}, {"kernel", vs.Kernel}} {
+			if c.constraint == "" {
+				continue
+			}
+			if _, err := parseVersionConstraint(c.constraint); err != nil {
+				return fmt.Errorf("%s: invalid versionSelector %s: %s", l.Name, c.field, err)
+			}
+		}
+	}
+
+	for _, c := range l.Spec.ConditionSelector {
+		if c.Type == "" {
+			return fmt.Errorf("%s: conditionSelector type is required", l.Name)
+		}
+		switch c.Status {
+		case corev1.ConditionTrue, corev1.ConditionFalse, corev1.ConditionUnknown:
+		default:
+			return fmt.Errorf("%s: conditionSelector %s status must be True, False or Unknown, got %q", l.Name, c.Type, c.Status)
+		}
+	}
+
+	for _, g := range l.Spec.NodeGroupSelector {
+		if errs := validation.IsValidLabelValue(g); g == "" || len(errs) > 0 {
+			return fmt.Errorf("%s: nodeGroupSelector group %q is not valid: %s", l.Name, g, strings.Join(errs, ", "))
+		}
+	}
+
+	for _, k := range l.Spec.ProtectedKeys {
+		errs := validation.IsQualifiedName(k)
+		if strings.HasSuffix(k, "/*") {
+			errs = validation.IsDNS1123Subdomain(strings.TrimSuffix(k, "/*"))
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("%s: protectedKeys key %q is not valid: %s", l.Name, k, strings.Join(errs, ", "))
+		}
+	}
+
+	if ref := l.Spec.RequireToleratingDaemonSet; ref != nil {
+		for _, n := range []string{ref.Namespace, ref.Name} {
+			if errs := validation.IsDNS1123Subdomain(n); len(errs) > 0 {
+				return fmt.Errorf("%s: requireToleratingDaemonSet %q is not valid: %s", l.Name, n, strings.Join(errs, ", "))
+			}
+		}
+	}
+
+	switch l.Spec.TaintRemovalPolicy {
+	case "", labelerv1alpha1.TaintRemovalPolicyImmediate:
+		if l.Spec.TaintRemovalDelay != nil {
+			return fmt.Errorf("%s: taintRemovalDelay needs the %s taintRemovalPolicy", l.Name, labelerv1alpha1.TaintRemovalPolicyDeferred)
+		}
+	case labelerv1alpha1.TaintRemovalPolicyDeferred:
+		if d := l.Spec.TaintRemovalDelay; d == nil || d.Duration <= 0 {
+			return fmt.Errorf("%s: the %s taintRemovalPolicy needs a positive taintRemovalDelay", l.Name, labelerv1alpha1.TaintRemovalPolicyDeferred)
+		}
+	default:
+		return fmt.Errorf("%s: %q is not a valid taintRemovalPolicy", l.Name, l.Spec.TaintRemovalPolicy)
+	}
+
+	if esc := l.Spec.TaintEscalation; esc != nil {
+		if esc.Soak.Duration <= 0 {
+			return fmt.Errorf("%s: taintEscalation needs a positive soak", l.Name)
+		}
+		escalated := false
+		keys := map[string]bool{}
+		for _, t := range l.Spec.Merge.Taints {
+			keys[taintKey(t)] = true
+			escalated = escalated || t.Effect == corev1.TaintEffectNoExecute
+		}
+		if !escalated {
+			return fmt.Errorf("%s: taintEscalation needs NoExecute merge taints", l.Name)
+		}
+		for _, t := range l.Spec.Merge.Taints {
+			if t.Effect == corev1.TaintEffectNoExecute && keys[taintKey(soakTaint(t))] {
+				return fmt.Errorf("%s: taint %s can't be merged as %s too, it soaks as %s with taintEscalation", l.Name, t.Key, corev1.TaintEffectNoSchedule, corev1.TaintEffectNoSchedule)
+			}
+		}
+	}
+
+	if pc := l.Spec.PriorityClass; pc != "" && pc != PriorityHigh && pc != PriorityNormal && pc != PriorityLow {
+		return fmt.Errorf("%s: priorityClass must be %s, %s or %s, got %q", l.Name, PriorityHigh, PriorityNormal, PriorityLow, pc)
+	}
+
+	if cs := l.Spec.ClusterSizeCondition; cs != nil {
+		switch {
+		case cs.MinNodes == nil && cs.MaxNodes == nil:
+			return fmt.Errorf("%s: clusterSizeCondition needs minNodes or maxNodes", l.Name)
+		case cs.MinNodes != nil && *cs.MinNodes < 0, cs.MaxNodes != nil && *cs.MaxNodes < 0:
+			return fmt.Errorf("%s: clusterSizeCondition bounds can't be negative", l.Name)
+		case cs.MinNodes != nil && cs.MaxNodes != nil && *cs.MinNodes > *cs.MaxNodes:
+			return fmt.Errorf("%s: clusterSizeCondition minNodes %d is over maxNodes %d", l.Name, *cs.MinNodes, *cs.MaxNodes)
+		}
+	}
+
+	if from, until := l.Spec.EffectiveFrom, l.Spec.EffectiveUntil; from != nil && until != nil && !from.Before(until) {
+		return fmt.Errorf("%s: effectiveFrom %s must be before effectiveUntil %s", l.Name, from.UTC().Format(time.RFC3339), until.UTC().Format(time.RFC3339))
+	}
+
+	if r := l.Spec.RequeueAfter; r != nil && r.Duration < time.Second {
+		return fmt.Errorf("%s: requeueAfter must be at least 1s, got %s", l.Name, r.Duration)
+	}
+
+	for _, vm := range l.Spec.ValueMap {
+		for _, k := range []string{vm.From, vm.To} {
+			if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+				return fmt.Errorf("%s: valueMap key %q is not valid: %s", l.Name, k, strings.Join(errs, ", "))
+			}
+		}
+		for _, v := range vm.Values {
+			if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+				return fmt.Errorf("%s: valueMap %s value %q is not valid: %s", l.Name, vm.To, v, strings.Join(errs, ", "))
+			}
+		}
+		if vm.Default != nil {
+			if errs := validation.IsValidLabelValue(*vm.Default); len(errs) > 0 {
+				return fmt.Errorf("%s: valueMap %s default %q is not valid: %s", l.Name, vm.To, *vm.Default, strings.Join(errs, ", "))
+			}
+		}
+		if err := validateValueTransform(vm.ValueTransform); err != nil {
+			return fmt.Errorf("%s: valueMap %s: %s", l.Name, vm.To, err)
+		}
+		if _, err := compileValuePattern(vm.ValuePattern); err != nil {
+			return fmt.Errorf("%s: valueMap %s: %s", l.Name, vm.To, err)
+		}
+	}
+
+	for _, vf := range l.Spec.ValueFrom {
+		if errs := validation.IsQualifiedName(vf.Label); len(errs) > 0 {
+			return fmt.Errorf("%s: valueFrom label %q is not valid: %s", l.Name, vf.Label, strings.Join(errs, ", "))
+		}
+		if _, err := NewValueSource(vf); err != nil {
+			return fmt.Errorf("%s: valueFrom %s: %s", l.Name, vf.Label, err)
+		}
+		if vf.Default != nil {
+			if errs := validation.IsValidLabelValue(*vf.Default); len(errs) > 0 {
+				return fmt.Errorf("%s: valueFrom %s default %q is not valid: %s", l.Name, vf.Label, *vf.Default, strings.Join(errs, ", "))
+			}
+		}
+		if err := validateValueTransform(vf.ValueTransform); err != nil {
+			return fmt.Errorf("%s: valueFrom %s: %s", l.Name, vf.Label, err)
+		}
+		if _, err := compileValuePattern(vf.ValuePattern); err != nil {
+			return fmt.Errorf("%s: valueFrom %s: %s", l.Name, vf.Label, err)
+		}
+	}
+
+	for _, r := range l.Spec.Rename {
+		if r.From == r.To {
+			return fmt.Errorf("%s: rename from and to must be different keys, got %q", l.Name, r.From)
+		}
+		for _, k := range []string{r.From, r.To} {
+			if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+				return fmt.Errorf("%s: rename key %q is not valid: %s", l.Name, k, strings.Join(errs, ", "))
+			}
+		}
+	}
+
+	for _, entry := range l.Spec.RemoveLabels {
+		if _, err := compileRemoval(entry); err != nil {
+			return fmt.Errorf("%s: %s", l.Name, err)
+		}
+	}
+
+	return ValidateKeyConflicts(l)
+}
+
+// ValidateKeyConflicts returns an error if the labeler sets a label key it also
+// removes, the from key of its renames or a key matching its removeLabels: the syncs
+// would set and remove it in turn.
+func ValidateKeyConflicts(l *labelerv1alpha1.Labeler) error {
+	setBy := map[string]string{}
+	for k := range l.Spec.Merge.Labels {
+		setBy[k] = "merge labels"
+	}
+	for _, vm := range l.Spec.ValueMap {
+		setBy[vm.To] = "valueMap"
+	}
+	for _, vf := range l.Spec.ValueFrom {
+		setBy[vf.Label] = "valueFrom"
+	}
+	for _, r := range l.Spec.Rename {
+		setBy[r.To] = "rename to"
+	}
+	for _, r := range l.Spec.Rename {
+		if by, ok := setBy[r.From]; ok {
+			return fmt.Errorf("%s: label %q is both set by %s and removed by rename from, the labeler can't set and remove the same key", l.Name, r.From, by)
+		}
+	}
+
+	keys := make([]string, 0, len(setBy))
+	for k := range setBy {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, r := range labelRemovals(l) {
+		for _, k := range keys {
+			if r.matches(k) {
+				return fmt.Errorf("%s: label %q is both set by %s and removed by removeLabels %s, the labeler can't set and remove the same key", l.Name, k, setBy[k], r.entry)
+			}
+		}
+	}
+	return nil
+}
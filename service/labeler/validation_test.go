@@ -0,0 +1,160 @@
+package labeler
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+func TestValidateFieldManager(t *testing.T) {
+	tests := []struct {
+		manager string
+		expErr  bool
+	}{
+		{manager: ""},
+		{manager: "gpu-labels"},
+		{manager: "team.example.com"},
+		{manager: "GPU labels", expErr: true},
+		{manager: "-gpu", expErr: true},
+		{manager: strings.Repeat("a", 129), expErr: true},
+	}
+
+	for _, test := range tests {
+		l := &labelerv1alpha1.Labeler{
+			ObjectMeta: metav1.ObjectMeta{Name: "l"},
+			Spec:       labelerv1alpha1.LabelerSpec{FieldManager: test.manager},
+		}
+		if err := Validate(l); (err != nil) != test.expErr {
+			t.Errorf("fieldManager %q: expected error %t, got %v", test.manager, test.expErr, err)
+		}
+	}
+}
+
+func TestValidateRequeueAfter(t *testing.T) {
+	tests := []struct {
+		requeueAfter *metav1.Duration
+		expErr       bool
+	}{
+		{requeueAfter: nil},
+		{requeueAfter: &metav1.Duration{Duration: time.Second}},
+		{requeueAfter: &metav1.Duration{Duration: 500 * time.Millisecond}, expErr: true},
+	}
+
+	for _, test := range tests {
+		l := &labelerv1alpha1.Labeler{
+			ObjectMeta: metav1.ObjectMeta{Name: "l"},
+			Spec:       labelerv1alpha1.LabelerSpec{RequeueAfter: test.requeueAfter},
+		}
+		if err := Validate(l); (err != nil) != test.expErr {
+			t.Errorf("requeueAfter %v: expected error %t, got %v", test.requeueAfter, test.expErr, err)
+		}
+	}
+}
+
+func TestValidateRemoveLabels(t *testing.T) {
+	tests := []struct {
+		entry  string
+		expErr bool
+	}{
+		{entry: "legacy"},
+		{entry: "example.com/legacy"},
+		{entry: `/example\.com\/legacy-.*/`},
+		{entry: "/", expErr: true},
+		{entry: "-legacy", expErr: true},
+		{entry: "/(/", expErr: true},
+	}
+
+	for _, test := range tests {
+		l := &labelerv1alpha1.Labeler{
+			ObjectMeta: metav1.ObjectMeta{Name: "l"},
+			Spec:       labelerv1alpha1.LabelerSpec{RemoveLabels: []string{test.entry}},
+		}
+		if err := Validate(l); (err != nil) != test.expErr {
+			t.Errorf("removeLabels %q: expected error %t, got %v", test.entry, test.expErr, err)
+		}
+	}
+}
+
+func TestValidateKeyConflicts(t *testing.T) {
+	rename := labelerv1alpha1.RenameSpec{From: "zone", To: "example.com/zone"}
+	tests := []struct {
+		name  string
+		spec  labelerv1alpha1.LabelerSpec
+		expBy string
+	}{
+		{
+			name: "A rename alone is valid.",
+			spec: labelerv1alpha1.LabelerSpec{Rename: []labelerv1alpha1.RenameSpec{rename}},
+		},
+		{
+			name: "Reading the renamed key is valid.",
+			spec: labelerv1alpha1.LabelerSpec{
+				Rename:   []labelerv1alpha1.RenameSpec{rename},
+				ValueMap: []labelerv1alpha1.ValueMapSpec{{From: "zone", To: "example.com/region", Values: map[string]string{"eu-west-1a": "eu-west"}}},
+			},
+		},
+		{
+			name:  "Merging the renamed key is rejected.",
+			spec:  labelerv1alpha1.LabelerSpec{Rename: []labelerv1alpha1.RenameSpec{rename}, Merge: mergeSpec(map[string]string{"zone": "a"})},
+			expBy: "merge labels",
+		},
+		{
+			name: "Mapping a value to the renamed key is rejected.",
+			spec: labelerv1alpha1.LabelerSpec{
+				Rename:   []labelerv1alpha1.RenameSpec{rename},
+				ValueMap: []labelerv1alpha1.ValueMapSpec{{From: "region", To: "zone", Values: map[string]string{"eu-west": "eu-west-1a"}}},
+			},
+			expBy: "valueMap",
+		},
+		{
+			name: "A value source of the renamed key is rejected.",
+			spec: labelerv1alpha1.LabelerSpec{
+				Rename:    []labelerv1alpha1.RenameSpec{rename},
+				ValueFrom: []labelerv1alpha1.ValueFromSpec{{Label: "zone", Type: TemplateType, Params: map[string]string{"template": "{{.Name}}"}}},
+			},
+			expBy: "valueFrom",
+		},
+		{
+			name:  "Chained renames are rejected.",
+			spec:  labelerv1alpha1.LabelerSpec{Rename: []labelerv1alpha1.RenameSpec{{From: "region", To: "zone"}, rename}},
+			expBy: "rename to",
+		},
+		{
+			name:  "Removing the merged key is rejected.",
+			spec:  labelerv1alpha1.LabelerSpec{RemoveLabels: []string{"team", "zone"}, Merge: mergeSpec(map[string]string{"zone": "a"})},
+			expBy: "removeLabels zone",
+		},
+		{
+			name: "An expression matching a key set is rejected.",
+			spec: labelerv1alpha1.LabelerSpec{
+				RemoveLabels: []string{"/zo.*/"},
+				ValueFrom:    []labelerv1alpha1.ValueFromSpec{{Label: "zone", Type: TemplateType, Params: map[string]string{"template": "{{.Name}}"}}},
+			},
+			expBy: "valueFrom and removed by removeLabels /zo.*/",
+		},
+		{
+			name: "An expression matching part of a key set is valid, it matches the whole key.",
+			spec: labelerv1alpha1.LabelerSpec{RemoveLabels: []string{"/zo/", "legacy"}, Merge: mergeSpec(map[string]string{"zone": "a"})},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := &labelerv1alpha1.Labeler{ObjectMeta: metav1.ObjectMeta{Name: "l"}, Spec: test.spec}
+			err := ValidateKeyConflicts(l)
+			if (err != nil) != (test.expBy != "") {
+				t.Fatalf("expected error %t, got %v", test.expBy != "", err)
+			}
+			if err != nil && (!strings.Contains(err.Error(), `"zone"`) || !strings.Contains(err.Error(), test.expBy)) {
+				t.Errorf("expected the error naming zone set by %s, got %v", test.expBy, err)
+			}
+			if verr := Validate(l); (verr != nil) != (err != nil) {
+				t.Errorf("expected the validation error %v, got %v", err, verr)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package labeler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/joshisa/resource-labeler-operator/log"
+)
+
+const (
+	// ConditionValueValidationFailed is set while resolved values of the labeler don't
+	// match their value pattern on some nodes.
+	ConditionValueValidationFailed = "ValueValidationFailed"
+
+	// maxConditionMismatches is the number of mismatches named by the condition.
+	maxConditionMismatches = 5
+)
+
+// compileValuePattern returns the compiled value pattern, nil if empty.
+func compileValuePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid valuePattern: %s", err)
+	}
+	return re, nil
+}
+
+// trackValueMismatches records the resolved values of the node that don't match their
+// value pattern, none clears it. The new ones are logged.
+func (lc *LabelController) trackValueMismatches(name string, mismatches []string, logger log.Logger) {
+	lc.states.update(name, func(st *nodeState) {
+		if len(mismatches) == 0 {
+			st.valueMismatches, st.mismatchSince = nil, time.Time{}
+			return
+		}
+		if fmt.Sprint(st.valueMismatches) != fmt.Sprint(mismatches) {
+			logger.Warningf("%s: node %s %s, not set", lc.l.Name, name, strings.Join(mismatches, ", "))
+		}
+		if len(st.valueMismatches) == 0 {
+			st.mismatchSince = time.Now()
+		}
+		st.valueMismatches = mismatches
+	})
+}
+
+// valueMismatchesCondition returns the ValueValidationFailed condition of the labeler
+// naming the first cached nodes with mismatching values, nil if there are none.
+func (lc *LabelController) valueMismatchesCondition() *Condition {
+	states := lc.states.cached(lc.nodes, func(st *nodeState) bool { return len(st.valueMismatches) > 0 })
+	if len(states) == 0 {
+		return nil
+	}
+	var since time.Time
+	var descs []string
+	for _, st := range states {
+		if since.IsZero() || st.mismatchSince.Before(since) {
+			since = st.mismatchSince
+		}
+		if len(descs) < maxConditionMismatches {
+			descs = append(descs, fmt.Sprintf("node %s %s", st.name, strings.Join(st.valueMismatches, ", ")))
+		}
+	}
+	if len(states) > maxConditionMismatches {
+		descs = append(descs, fmt.Sprintf("and %d more nodes", len(states)-maxConditionMismatches))
+	}
+	return &Condition{
+		Labeler:  lc.l.Name,
+		Type:     ConditionValueValidationFailed,
+		Severity: ConditionSeverityWarning,
+		Since:    since.UTC(),
+		Message:  fmt.Sprintf("values not set on %d nodes: %s", len(states), strings.Join(descs, "; ")),
+	}
+}
@@ -0,0 +1,491 @@
+package labeler
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// ValueSource resolves a label value from a node. It returns false if the node
+// doesn't have a value for the source.
+type ValueSource interface {
+	Resolve(node *corev1.Node) (string, bool, error)
+}
+
+// ValueSourceFunc is a helper to use a function as a ValueSource.
+type ValueSourceFunc func(node *corev1.Node) (string, bool, error)
+
+// Resolve satisfies ValueSource interface.
+func (f ValueSourceFunc) Resolve(node *corev1.Node) (string, bool, error) {
+	return f(node)
+}
+
+// PodsValueSource is a value source that resolves the value from the node and the pods
+// assigned to it. Its Resolve is used when the pods are not available (e.g. offline diffs).
+type PodsValueSource interface {
+	ValueSource
+	ResolvePods(node *corev1.Node, pods []*corev1.Pod) (string, bool, error)
+}
+
+// ValueSourceFactory returns the value source of a valueFrom type with its params,
+// an error if the params are not valid.
+type ValueSourceFactory func(params map[string]string) (ValueSource, error)
+
+var (
+	valueSources   = map[string]ValueSourceFactory{}
+	valueSourcesMu sync.RWMutex
+)
+
+// RegisterValueSource registers the factory of a valueFrom type, registering a type
+// twice panics.
+func RegisterValueSource(typ string, f ValueSourceFactory) {
+	valueSourcesMu.Lock()
+	defer valueSourcesMu.Unlock()
+	if _, ok := valueSources[typ]; ok {
+		panic(fmt.Sprintf("value source %q already registered", typ))
+	}
+	valueSources[typ] = f
+}
+
+// ValueSourceTypes returns the registered valueFrom types.
+func ValueSourceTypes() []string {
+	valueSourcesMu.RLock()
+	defer valueSourcesMu.RUnlock()
+	types := make([]string, 0, len(valueSources))
+	for t := range valueSources {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// NewValueSource returns the value source of the valueFrom spec.
+func NewValueSource(vf labelerv1alpha1.ValueFromSpec) (ValueSource, error) {
+	if vf.Type == CompositeType {
+		return newCompositeSource(vf)
+	}
+	if len(vf.Sources) > 0 {
+		return nil, fmt.Errorf("sources are only used by the %s type", CompositeType)
+	}
+	valueSourcesMu.RLock()
+	f, ok := valueSources[vf.Type]
+	valueSourcesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown valueFrom type %q, must be one of %v or %s", vf.Type, ValueSourceTypes(), CompositeType)
+	}
+	return f(vf.Params)
+}
+
+// Built-in value sources.
+func init() {
+	RegisterValueSource("label", newLabelSource)
+	RegisterValueSource("annotation", newAnnotationSource)
+	RegisterValueSource("capacity", newResourceSource(func(n *corev1.Node) corev1.ResourceList { return n.Status.Capacity }))
+	RegisterValueSource("allocatable", newResourceSource(func(n *corev1.Node) corev1.ResourceList { return n.Status.Allocatable }))
+	RegisterValueSource("extendedResource", newExtendedResourceSource)
+	RegisterValueSource("nodeInfo", newNodeInfoSource)
+	RegisterValueSource("regex", newRegexSource)
+	RegisterValueSource(PodResourceSumType, newPodResourceSumSource)
+	RegisterValueSource("nodeGroup", newNodeGroupSource)
+	RegisterValueSource("field", newFieldSource)
+	RegisterValueSource("shard", newShardSource)
+	RegisterValueSource("age", newAgeSource)
+	RegisterValueSource(HTTPType, newHTTPSource)
+	RegisterValueSource(TemplateType, newTemplateSource)
+	RegisterValueSource(NodeLeaseType, newNodeLeaseSource)
+	RegisterValueSource(SchedulingPressureType, newSchedulingPressureSource)
+}
+
+// requiredParam returns the param, an error if it's not set.
+func requiredParam(params map[string]string, name string) (string, error) {
+	v := params[name]
+	if v == "" {
+		return "", fmt.Errorf("missing %q param", name)
+	}
+	return v, nil
+}
+
+// boolParam returns the "true" or "false" param, false if it's not set.
+func boolParam(params map[string]string, name string) (bool, error) {
+	switch params[name] {
+	case "", "false":
+		return false, nil
+	case "true":
+		return true, nil
+	}
+	return false, fmt.Errorf("%s param must be true or false, got %q", name, params[name])
+}
+
+// newLabelSource resolves the value of the "key" label.
+func newLabelSource(params map[string]string) (ValueSource, error) {
+	key, err := requiredParam(params, "key")
+	if err != nil {
+		return nil, err
+	}
+	return ValueSourceFunc(func(node *corev1.Node) (string, bool, error) {
+		v, ok := node.Labels[key]
+		return v, ok, nil
+	}), nil
+}
+
+// newAnnotationSource resolves the value of the "key" annotation, sanitized as a label
+// value if "sanitize" is "true".
+func newAnnotationSource(params map[string]string) (ValueSource, error) {
+	key, err := requiredParam(params, "key")
+	if err != nil {
+		return nil, err
+	}
+	sanitize, err := boolParam(params, "sanitize")
+	if err != nil {
+		return nil, err
+	}
+
+	return ValueSourceFunc(func(node *corev1.Node) (string, bool, error) {
+		v, ok := node.Annotations[key]
+		if !ok {
+			return "", false, nil
+		}
+		if sanitize {
+			v = sanitizeLabelValue(v)
+		}
+		return v, true, nil
+	}), nil
+}
+
+var invalidLabelValueChars = regexp.MustCompile(`[^-A-Za-z0-9_.]+`)
+
+// sanitizeLabelValue converts the value to a valid label value: invalid characters are
+// replaced by "-", it's truncated to the maximum length and trimmed to start and end
+// with alphanumeric characters.
+func sanitizeLabelValue(v string) string {
+	v = invalidLabelValueChars.ReplaceAllString(v, "-")
+	if len(v) > validation.LabelValueMaxLength {
+		v = v[:validation.LabelValueMaxLength]
+	}
+	return strings.TrimFunc(v, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+}
+
+// newResourceSource resolves the quantity of the "resource" on a node resource list.
+func newResourceSource(list func(*corev1.Node) corev1.ResourceList) ValueSourceFactory {
+	return func(params map[string]string) (ValueSource, error) {
+		resource, err := requiredParam(params, "resource")
+		if err != nil {
+			return nil, err
+		}
+		return ValueSourceFunc(func(node *corev1.Node) (string, bool, error) {
+			q, ok := list(node)[corev1.ResourceName(resource)]
+			if !ok {
+				return "", false, nil
+			}
+			return q.String(), true, nil
+		}), nil
+	}
+}
+
+// newExtendedResourceSource resolves if the node capacity has the extended "resource"
+// (e.g. nvidia.com/gpu exposed by a device plugin): the "present" value (default "true")
+// with a non zero quantity, otherwise the "absent" one (default "false").
+func newExtendedResourceSource(params map[string]string) (ValueSource, error) {
+	resource, err := requiredParam(params, "resource")
+	if err != nil {
+		return nil, err
+	}
+	if errs := validation.IsQualifiedName(resource); len(errs) > 0 || !strings.Contains(resource, "/") {
+		return nil, fmt.Errorf("resource %q is not a domain prefixed extended resource name", resource)
+	}
+	values := map[string]string{"present": "true", "absent": "false"}
+	for name := range values {
+		if v, ok := params[name]; ok {
+			if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+				return nil, fmt.Errorf("%s param %q is not a valid label value: %s", name, v, strings.Join(errs, ", "))
+			}
+			values[name] = v
+		}
+	}
+
+	return ValueSourceFunc(func(node *corev1.Node) (string, bool, error) {
+		if q, ok := node.Status.Capacity[corev1.ResourceName(resource)]; ok && !q.IsZero() {
+			return values["present"], true, nil
+		}
+		return values["absent"], true, nil
+	}), nil
+}
+
+// newNodeInfoSource resolves the "field" of the node system info.
+func newNodeInfoSource(params map[string]string) (ValueSource, error) {
+	fields := map[string]func(corev1.NodeSystemInfo) string{
+		"architecture":            func(i corev1.NodeSystemInfo) string { return i.Architecture },
+		"containerRuntimeVersion": func(i corev1.NodeSystemInfo) string { return i.ContainerRuntimeVersion },
+		"kernelVersion":           func(i corev1.NodeSystemInfo) string { return i.KernelVersion },
+		"kubeletVersion":          func(i corev1.NodeSystemInfo) string { return i.KubeletVersion },
+		"operatingSystem":         func(i corev1.NodeSystemInfo) string { return i.OperatingSystem },
+		"osImage":                 func(i corev1.NodeSystemInfo) string { return i.OSImage },
+	}
+
+	name, err := requiredParam(params, "field")
+	if err != nil {
+		return nil, err
+	}
+	field, ok := fields[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown nodeInfo field %q", name)
+	}
+	return ValueSourceFunc(func(node *corev1.Node) (string, bool, error) {
+		v := field(node.Status.NodeInfo)
+		return v, v != "", nil
+	}), nil
+}
+
+// newRegexSource resolves the "replacement" (default "$1") of the "pattern" on the
+// value of the "key" label. Values not matching the pattern are not resolved.
+func newRegexSource(params map[string]string) (ValueSource, error) {
+	key, err := requiredParam(params, "key")
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := requiredParam(params, "pattern")
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %s", err)
+	}
+	replacement := params["replacement"]
+	if replacement == "" {
+		replacement = "$1"
+	}
+
+	return ValueSourceFunc(func(node *corev1.Node) (string, bool, error) {
+		v, ok := node.Labels[key]
+		if !ok {
+			return "", false, nil
+		}
+		m := re.FindStringSubmatchIndex(v)
+		if m == nil {
+			return "", false, nil
+		}
+		return string(re.ExpandString(nil, replacement, v, m)), true, nil
+	}), nil
+}
+
+// PodResourceSumType is the value source type that needs the pods of the nodes.
+const PodResourceSumType = "podResourceSum"
+
+// resourceTier is a named tier of a resource usage percentage, up to (excluding) max.
+type resourceTier struct {
+	name string
+	max  int64
+}
+
+// podResourceSumSource resolves the requests sum of the pods assigned to a node as a
+// percentage of the node allocatable, or the tier of the percentage.
+type podResourceSumSource struct {
+	resource corev1.ResourceName
+	// tiers are ordered by max, the last one has no max.
+	tiers []resourceTier
+}
+
+// newPodResourceSumSource resolves the sum of the "resource" (cpu or memory) requests
+// of the pods on the node as a percentage of the allocatable. With "tiers" like
+// "low:50,medium:80,high" the value is the first tier whose percentage is under its
+// max, the last one has no max.
+func newPodResourceSumSource(params map[string]string) (ValueSource, error) {
+	resource, err := requiredParam(params, "resource")
+	if err != nil {
+		return nil, err
+	}
+	src := podResourceSumSource{resource: corev1.ResourceName(resource)}
+	if src.resource != corev1.ResourceCPU && src.resource != corev1.ResourceMemory {
+		return nil, fmt.Errorf("resource param must be %s or %s, got %q", corev1.ResourceCPU, corev1.ResourceMemory, resource)
+	}
+	if params["tiers"] == "" {
+		return src, nil
+	}
+
+	tiers := strings.Split(params["tiers"], ",")
+	for i, t := range tiers {
+		parts := strings.SplitN(strings.TrimSpace(t), ":", 2)
+		tier := resourceTier{name: parts[0]}
+		if errs := validation.IsValidLabelValue(tier.name); tier.name == "" || len(errs) > 0 {
+			return nil, fmt.Errorf("invalid tier name %q", tier.name)
+		}
+		last := i == len(tiers)-1
+		switch {
+		case last && len(parts) == 2:
+			return nil, fmt.Errorf("the last tier %q can't have a max percentage", tier.name)
+		case !last && len(parts) != 2:
+			return nil, fmt.Errorf("tier %q needs a max percentage", tier.name)
+		case !last:
+			if tier.max, err = strconv.ParseInt(parts[1], 10, 64); err != nil || tier.max <= 0 {
+				return nil, fmt.Errorf("invalid tier %q max percentage %q", tier.name, parts[1])
+			}
+			if i > 0 && tier.max <= src.tiers[i-1].max {
+				return nil, fmt.Errorf("tier %q max percentage must be greater than the previous one", tier.name)
+			}
+		}
+		src.tiers = append(src.tiers, tier)
+	}
+	return src, nil
+}
+
+// Resolve satisfies ValueSource interface, without the pods there is no value.
+func (s podResourceSumSource) Resolve(node *corev1.Node) (string, bool, error) {
+	return "", false, nil
+}
+
+// ResolvePods satisfies PodsValueSource interface.
+func (s podResourceSumSource) ResolvePods(node *corev1.Node, pods []*corev1.Pod) (string, bool, error) {
+	allocatable, ok := node.Status.Allocatable[s.resource]
+	if !ok || allocatable.IsZero() {
+		return "", false, nil
+	}
+
+	var requested int64
+	for _, pod := range pods {
+		if podTerminated(pod) {
+			continue
+		}
+		requested += podRequest(pod, s.resource)
+	}
+	percent := requested * 100 / allocatable.MilliValue()
+	if len(s.tiers) == 0 {
+		return strconv.FormatInt(percent, 10), true, nil
+	}
+	for _, t := range s.tiers[:len(s.tiers)-1] {
+		if percent < t.max {
+			return t.name, true, nil
+		}
+	}
+	return s.tiers[len(s.tiers)-1].name, true, nil
+}
+
+// podRequest returns the effective request of the pod in milli units like the
+// scheduler: the containers sum or the largest init container request.
+func podRequest(pod *corev1.Pod, resource corev1.ResourceName) int64 {
+	var sum int64
+	for _, c := range pod.Spec.Containers {
+		q := c.Resources.Requests[resource]
+		sum += q.MilliValue()
+	}
+	for _, c := range pod.Spec.InitContainers {
+		q := c.Resources.Requests[resource]
+		if q.MilliValue() > sum {
+			sum = q.MilliValue()
+		}
+	}
+	return sum
+}
+
+// newShardSource resolves the shard of the node, from 0 to "shards"-1, as the hash of
+// the node name or of the values of the comma separated "labels" modulo the shards.
+// The hash only depends on the input, a node keeps its shard until the input or the
+// shards change. Nodes missing one of the labels are not resolved.
+func newShardSource(params map[string]string) (ValueSource, error) {
+	v, err := requiredParam(params, "shards")
+	if err != nil {
+		return nil, err
+	}
+	shards, err := strconv.ParseUint(v, 10, 32)
+	if err != nil || shards == 0 {
+		return nil, fmt.Errorf("shards param must be a positive integer, got %q", v)
+	}
+	var keys []string
+	if params["labels"] != "" {
+		for _, k := range strings.Split(params["labels"], ",") {
+			keys = append(keys, strings.TrimSpace(k))
+		}
+	}
+
+	return ValueSourceFunc(func(node *corev1.Node) (string, bool, error) {
+		h := fnv.New32a()
+		if len(keys) == 0 {
+			h.Write([]byte(node.Name))
+		}
+		for _, k := range keys {
+			v, ok := node.Labels[k]
+			if !ok {
+				return "", false, nil
+			}
+			h.Write([]byte(k + "=" + v + "\n"))
+		}
+		return strconv.FormatUint(uint64(h.Sum32())%shards, 10), true, nil
+	}), nil
+}
+
+// mapSource resolves the value mapped from the value of a label, it's the value
+// source of the valueMap spec. Unmapped values resolve to the default if any, nodes
+// without the label are not resolved. Only the mapped values are transformed.
+type mapSource struct {
+	vm labelerv1alpha1.ValueMapSpec
+}
+
+func (m mapSource) Resolve(node *corev1.Node) (string, bool, error) {
+	from, ok := node.Labels[m.vm.From]
+	if !ok {
+		return "", false, nil
+	}
+	if v, ok := m.vm.Values[from]; ok {
+		return transformValue(v, m.vm.ValueTransform), true, nil
+	}
+	if m.vm.Default != nil {
+		return *m.vm.Default, true, nil
+	}
+	return "", false, nil
+}
+
+// labelValue is a label set with the value resolved by a source.
+type labelValue struct {
+	label  string
+	source ValueSource
+	// def is the value if the source doesn't resolve one, the label is not set
+	// without it.
+	def *string
+	// transform transforms the resolved values (optional).
+	transform *labelerv1alpha1.ValueTransform
+	// pattern is what the values need to match to be set (optional).
+	pattern *regexp.Regexp
+}
+
+// labelValues returns the labels of the labeler set with resolved values, the value
+// maps first. The labeler needs to be valid.
+func labelValues(l *labelerv1alpha1.Labeler) []labelValue {
+	var lvs []labelValue
+	for _, vm := range l.Spec.ValueMap {
+		pattern, _ := compileValuePattern(vm.ValuePattern)
+		lvs = append(lvs, labelValue{label: vm.To, source: mapSource{vm: vm}, pattern: pattern})
+	}
+	for _, vf := range l.Spec.ValueFrom {
+		src, err := NewValueSource(vf)
+		if err != nil {
+			continue
+		}
+		pattern, _ := compileValuePattern(vf.ValuePattern)
+		lvs = append(lvs, labelValue{label: vf.Label, source: src, def: vf.Default, transform: vf.ValueTransform, pattern: pattern})
+	}
+	return lvs
+}
+
+// needsPods returns true if the label controller has value sources that need the pods
+// of the nodes.
+func (lc *LabelController) needsPods() bool {
+	for _, lv := range lc.values {
+		for _, src := range leafSources(lv.source) {
+			if _, ok := src.(PodsValueSource); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
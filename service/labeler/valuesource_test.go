@@ -0,0 +1,345 @@
+package labeler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	kooperlog "github.com/spotahome/kooper/log"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// sourceNode returns a node with every attribute the built-in value sources resolve.
+func sourceNode() *corev1.Node {
+	n := testNode("n1", map[string]string{
+		"zone":                          "eu-west-1a",
+		"cloud.google.com/gke-nodepool": "pool-1",
+	})
+	n.Annotations = map[string]string{"owner": "Team A/ops"}
+	n.CreationTimestamp = metav1.NewTime(time.Now().Add(-48 * time.Hour))
+	n.Spec.PodCIDR = "10.0.1.0/24"
+	n.Status.Capacity = corev1.ResourceList{
+		corev1.ResourceMemory: resource.MustParse("16Gi"),
+		"nvidia.com/gpu":      resource.MustParse("2"),
+	}
+	n.Status.Allocatable = corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("4"),
+		corev1.ResourceMemory: resource.MustParse("15Gi"),
+	}
+	n.Status.NodeInfo.Architecture = "arm64"
+	return n
+}
+
+func TestValueSourcesResolve(t *testing.T) {
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+		Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("3")}},
+	}}}}
+	tests := []struct {
+		name   string
+		typ    string
+		params map[string]string
+		// resolve resolves with what the source needs besides the node, if anything.
+		resolve func(src ValueSource, node *corev1.Node) (string, bool, error)
+		node    *corev1.Node
+		exp     string
+		expOK   bool
+	}{
+		{
+			name:   "A label is resolved.",
+			typ:    "label",
+			params: map[string]string{"key": "zone"},
+			exp:    "eu-west-1a",
+			expOK:  true,
+		},
+		{
+			name:   "A missing label is not resolved.",
+			typ:    "label",
+			params: map[string]string{"key": "missing"},
+		},
+		{
+			name:   "An annotation is resolved sanitized.",
+			typ:    "annotation",
+			params: map[string]string{"key": "owner", "sanitize": "true"},
+			exp:    "Team-A-ops",
+			expOK:  true,
+		},
+		{
+			name:   "A capacity is resolved.",
+			typ:    "capacity",
+			params: map[string]string{"resource": "memory"},
+			exp:    "16Gi",
+			expOK:  true,
+		},
+		{
+			name:   "An allocatable is resolved.",
+			typ:    "allocatable",
+			params: map[string]string{"resource": "memory"},
+			exp:    "15Gi",
+			expOK:  true,
+		},
+		{
+			name:   "A present extended resource is resolved.",
+			typ:    "extendedResource",
+			params: map[string]string{"resource": "nvidia.com/gpu"},
+			exp:    "true",
+			expOK:  true,
+		},
+		{
+			name:   "An absent extended resource is resolved as absent.",
+			typ:    "extendedResource",
+			params: map[string]string{"resource": "example.com/fpga", "absent": "none"},
+			exp:    "none",
+			expOK:  true,
+		},
+		{
+			name:   "A node info field is resolved.",
+			typ:    "nodeInfo",
+			params: map[string]string{"field": "architecture"},
+			exp:    "arm64",
+			expOK:  true,
+		},
+		{
+			name:   "A regex replacement is resolved.",
+			typ:    "regex",
+			params: map[string]string{"key": "zone", "pattern": `^(.*)-\d+[a-z]$`},
+			exp:    "eu-west",
+			expOK:  true,
+		},
+		{
+			name:   "A value not matching the regex is not resolved.",
+			typ:    "regex",
+			params: map[string]string{"key": "zone", "pattern": `^us-(.*)$`},
+		},
+		{
+			name:   "Without pods the pod resource sum is not resolved.",
+			typ:    PodResourceSumType,
+			params: map[string]string{"resource": "cpu"},
+		},
+		{
+			name:   "The pod resource sum tier is resolved with the pods.",
+			typ:    PodResourceSumType,
+			params: map[string]string{"resource": "cpu", "tiers": "low:50,high"},
+			resolve: func(src ValueSource, node *corev1.Node) (string, bool, error) {
+				return src.(PodsValueSource).ResolvePods(node, []*corev1.Pod{pod})
+			},
+			exp:   "high",
+			expOK: true,
+		},
+		{
+			name:  "A node group is resolved.",
+			typ:   "nodeGroup",
+			exp:   "pool-1",
+			expOK: true,
+		},
+		{
+			name:   "A node group of other providers is not resolved.",
+			typ:    "nodeGroup",
+			params: map[string]string{"providers": "eks"},
+		},
+		{
+			name:   "A field is resolved.",
+			typ:    "field",
+			params: map[string]string{"path": "spec.podCIDR", "sanitize": "true"},
+			exp:    "10.0.1.0-24",
+			expOK:  true,
+		},
+		{
+			name:   "The shard of the node is resolved.",
+			typ:    "shard",
+			params: map[string]string{"shards": "1"},
+			exp:    "0",
+			expOK:  true,
+		},
+		{
+			name:   "The age tier is resolved.",
+			typ:    "age",
+			params: map[string]string{"tiers": "fresh:1d,aging:7d,stale"},
+			exp:    "aging",
+			expOK:  true,
+		},
+		{
+			name:   "Offline the http value is not available.",
+			typ:    HTTPType,
+			params: map[string]string{"url": "http://inventory.example.com/{node}"},
+			resolve: func(src ValueSource, node *corev1.Node) (string, bool, error) {
+				v, ok, err := src.Resolve(node)
+				if err != errHTTPOffline {
+					t.Errorf("expected the value not available offline, got %v", err)
+				}
+				return v, ok, nil
+			},
+		},
+		{
+			name:   "A template is resolved.",
+			typ:    TemplateType,
+			params: map[string]string{"template": "{{.Name}}.{{index .Labels \"zone\"}}"},
+			exp:    "n1.eu-west-1a",
+			expOK:  true,
+		},
+		{
+			name:   "Without leases the node lease is not resolved.",
+			typ:    NodeLeaseType,
+			params: map[string]string{"staleAfter": "1m"},
+		},
+		{
+			name:   "A node lease not renewed for long is stale.",
+			typ:    NodeLeaseType,
+			params: map[string]string{"staleAfter": "1m"},
+			resolve: func(src ValueSource, node *corev1.Node) (string, bool, error) {
+				return src.(LeaseValueSource).ResolveLease(node, time.Now().Add(-time.Hour))
+			},
+			exp:   "true",
+			expOK: true,
+		},
+		{
+			name:   "Without failures the scheduling pressure is not resolved.",
+			typ:    SchedulingPressureType,
+			params: map[string]string{"threshold": "2", "window": "10m"},
+		},
+		{
+			name:   "Enough recent scheduling failures are pressure.",
+			typ:    SchedulingPressureType,
+			params: map[string]string{"threshold": "2", "window": "10m"},
+			resolve: func(src ValueSource, node *corev1.Node) (string, bool, error) {
+				now := time.Now()
+				return src.(FailuresValueSource).ResolveFailures(node, []time.Time{now.Add(-time.Minute), now.Add(-2 * time.Minute), now.Add(-time.Hour)})
+			},
+			exp:   "true",
+			expOK: true,
+		},
+	}
+
+	tested := map[string]bool{}
+	for _, test := range tests {
+		tested[test.typ] = true
+		t.Run(test.name, func(t *testing.T) {
+			src, err := NewValueSource(labelerv1alpha1.ValueFromSpec{Label: "l", Type: test.typ, Params: test.params})
+			if err != nil {
+				t.Fatal(err)
+			}
+			resolve := test.resolve
+			if resolve == nil {
+				resolve = func(src ValueSource, node *corev1.Node) (string, bool, error) { return src.Resolve(node) }
+			}
+			node := test.node
+			if node == nil {
+				node = sourceNode()
+			}
+			v, ok, err := resolve(src, node)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != test.exp || ok != test.expOK {
+				t.Errorf("expected %q %t, got %q %t", test.exp, test.expOK, v, ok)
+			}
+		})
+	}
+	for _, typ := range ValueSourceTypes() {
+		if !tested[typ] {
+			t.Errorf("expected the built-in value source %s tested", typ)
+		}
+	}
+}
+
+func TestNewValueSourceInvalidParams(t *testing.T) {
+	tests := []struct {
+		typ    string
+		params map[string]string
+	}{
+		{typ: "label"},
+		{typ: "annotation", params: map[string]string{"key": "a", "sanitize": "yes"}},
+		{typ: "capacity"},
+		{typ: "extendedResource", params: map[string]string{"resource": "gpu"}},
+		{typ: "nodeInfo", params: map[string]string{"field": "hostname"}},
+		{typ: "regex", params: map[string]string{"key": "a", "pattern": "("}},
+		{typ: PodResourceSumType, params: map[string]string{"resource": "storage"}},
+		{typ: "field", params: map[string]string{"path": "spec.[bad"}},
+		{typ: "shard", params: map[string]string{"shards": "0"}},
+		{typ: "age", params: map[string]string{"tiers": "fresh"}},
+		{typ: HTTPType},
+		{typ: TemplateType, params: map[string]string{"template": "{{"}},
+		{typ: NodeLeaseType, params: map[string]string{"staleAfter": "1m", "stale": "x", "fresh": "x"}},
+		{typ: SchedulingPressureType, params: map[string]string{"threshold": "0", "window": "1m"}},
+		{typ: "unknown"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.typ, func(t *testing.T) {
+			if _, err := NewValueSource(labelerv1alpha1.ValueFromSpec{Label: "l", Type: test.typ, Params: test.params}); err == nil {
+				t.Errorf("expected params %v rejected", test.params)
+			}
+		})
+	}
+}
+
+func TestResolveValuesWithdrawsOwnedLabels(t *testing.T) {
+	const owner = "owned-keys"
+	def := "none"
+	tests := []struct {
+		name     string
+		vf       labelerv1alpha1.ValueFromSpec
+		owned    string
+		expValue string
+		expSet   bool
+		expOwned []string
+	}{
+		{
+			name:     "An owned label without value is withdrawn.",
+			vf:       labelerv1alpha1.ValueFromSpec{Label: "rack", Type: "label", Params: map[string]string{"key": "missing"}},
+			owned:    `{"l":["labels/rack"]}`,
+			expOwned: []string{},
+		},
+		{
+			name:     "A label not owned without value is left untouched.",
+			vf:       labelerv1alpha1.ValueFromSpec{Label: "rack", Type: "label", Params: map[string]string{"key": "missing"}},
+			owned:    `{"other":["labels/rack"]}`,
+			expValue: "r1",
+			expSet:   true,
+			expOwned: []string{},
+		},
+		{
+			name:     "An owned label without value gets the default.",
+			vf:       labelerv1alpha1.ValueFromSpec{Label: "rack", Type: "label", Params: map[string]string{"key": "missing"}, Default: &def},
+			owned:    `{"l":["labels/rack"]}`,
+			expValue: "none",
+			expSet:   true,
+			expOwned: []string{"labels/rack"},
+		},
+		{
+			name:     "An owned label whose value is not available is left untouched.",
+			vf:       labelerv1alpha1.ValueFromSpec{Label: "rack", Type: HTTPType, Params: map[string]string{"url": "http://inventory.example.com/{node}"}},
+			owned:    `{"l":["labels/rack"]}`,
+			expValue: "r1",
+			expSet:   true,
+			expOwned: []string{"labels/rack"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := &labelerv1alpha1.Labeler{
+				ObjectMeta: metav1.ObjectMeta{Name: "l"},
+				Spec:       labelerv1alpha1.LabelerSpec{ValueFrom: []labelerv1alpha1.ValueFromSpec{test.vf}},
+			}
+			lc := NewLabelController(Config{OwnerAnnotation: owner}, l, cache.NewStore(cache.MetaNamespaceKeyFunc), kooperlog.Dummy)
+			node := testNode("n1", map[string]string{"rack": "r1"})
+			node.Annotations = map[string]string{owner: test.owned}
+			dst := node.DeepCopy()
+
+			lc.resolveValues(dst, kooperlog.Dummy)
+			v, ok := dst.Labels["rack"]
+			if ok != test.expSet || v != test.expValue {
+				t.Errorf("expected the label %q set %t, got %q %t", test.expValue, test.expSet, v, ok)
+			}
+			if keys := lc.appliedKeys(node, dst); !reflect.DeepEqual(keys, test.expOwned) {
+				t.Errorf("expected the owned keys %v, got %v", test.expOwned, keys)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package labeler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+)
+
+// version is the numeric major.minor.patch of a version, the rest of the version
+// (pre-release, build or distribution suffixes like "-1023-azure") is ignored.
+type version [3]int
+
+// parseVersion parses versions like "v1.10.3" or "4.15.0-1023-azure", missing minor
+// or patch numbers are 0.
+func parseVersion(s string) (version, error) {
+	var v version
+	core := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexFunc(core, func(r rune) bool { return r != '.' && (r < '0' || r > '9') }); i >= 0 {
+		core = core[:i]
+	}
+
+	parts := strings.Split(strings.TrimSuffix(core, "."), ".")
+	if core == "" || len(parts) > 3 {
+		return v, fmt.Errorf("invalid version %q", s)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return v, fmt.Errorf("invalid version %q", s)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+func (v version) compare(o version) int {
+	for i := range v {
+		switch {
+		case v[i] < o[i]:
+			return -1
+		case v[i] > o[i]:
+			return 1
+		}
+	}
+	return 0
+}
+
+// comparison is an operator and a version, like ">=1.9.0".
+type comparison struct {
+	op string
+	v  version
+}
+
+// versionOperators are ordered so the longest ones are matched first.
+var versionOperators = []string{">=", "<=", "!=", "==", ">", "<", "="}
+
+func (c comparison) matches(v version) bool {
+	cmp := v.compare(c.v)
+	switch c.op {
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case "!=":
+		return cmp != 0
+	}
+	return cmp == 0
+}
+
+// versionConstraint are alternatives ("||") of comparisons that all need to match (",").
+type versionConstraint [][]comparison
+
+// parseVersionConstraint parses constraints like ">=1.9.0, <1.11.0 || >=1.12.0".
+func parseVersionConstraint(s string) (versionConstraint, error) {
+	var vc versionConstraint
+	for _, alt := range strings.Split(s, "||") {
+		var cs []comparison
+		for _, part := range strings.Split(alt, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				return nil, fmt.Errorf("invalid version constraint %q: empty comparison", s)
+			}
+
+			op := "="
+			for _, o := range versionOperators {
+				if strings.HasPrefix(part, o) {
+					op = o
+					part = part[len(o):]
+					break
+				}
+			}
+			v, err := parseVersion(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version constraint %q: %s", s, err)
+			}
+			cs = append(cs, comparison{op: op, v: v})
+		}
+		vc = append(vc, cs)
+	}
+	return vc, nil
+}
+
+func (vc versionConstraint) matches(v version) bool {
+	for _, cs := range vc {
+		all := true
+		for _, c := range cs {
+			if !c.matches(v) {
+				all = false
+				break
+			}
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+// NodeMatchesVersionSelector checks whether the node info versions are in the ranges
+// of the selector, a nil selector matches every node. Nodes with an unparseable
+// version don't match.
+func NodeMatchesVersionSelector(node *corev1.Node, vs *labelerv1alpha1.VersionSelector) (bool, error) {
+	if vs == nil {
+		return true, nil
+	}
+
+	checks := []struct{ constraint, version string }{
+		{vs.Kubelet, node.Status.NodeInfo.KubeletVersion},
+		{vs.Kernel, node.Status.NodeInfo.KernelVersion},
+	}
+	for _, c := range checks {
+		if c.constraint == "" {
+			continue
+		}
+		vc, err := parseVersionConstraint(c.constraint)
+		if err != nil {
+			return false, err
+		}
+		v, err := parseVersion(c.version)
+		if err != nil || !vc.matches(v) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
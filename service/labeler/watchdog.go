@@ -0,0 +1,112 @@
+package labeler
+
+import (
+	"sync/atomic"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// watchdogChecks is the number of times the watchdog checks the node events per
+	// watch timeout.
+	watchdogChecks = 4
+)
+
+// touch records that the node informer is alive.
+func (c *Labeler) touch() {
+	atomic.StoreInt64(&c.lastEvent, time.Now().UnixNano())
+}
+
+// nodeListWatch returns the list watch of the node informer, recording its lists,
+// watches and watch events. The informer watches again at least every 10 minutes, so
+// a healthy informer of a cluster without node changes is alive too.
+func (c *Labeler) nodeListWatch() *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			c.selectNode(&options, "metadata.name")
+			obj, err := c.k8sCli.CoreV1().Nodes().List(options)
+			if err == nil {
+				c.touch()
+			}
+			return obj, err
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			c.selectNode(&options, "metadata.name")
+			w, err := c.k8sCli.CoreV1().Nodes().Watch(options)
+			if err != nil {
+				return nil, err
+			}
+			c.touch()
+			return watch.Filter(w, func(e watch.Event) (watch.Event, bool) {
+				c.touch()
+				return e, true
+			}), nil
+		},
+	}
+}
+
+// watchdog waits until stopC is closed or the node informer doesn't list, watch or get
+// watch events for the watch timeout. It returns true when the node informer needs to
+// be restarted.
+func (c *Labeler) watchdog(stopC <-chan struct{}) bool {
+	if c.cfg.WatchTimeout <= 0 {
+		<-stopC
+		return false
+	}
+
+	ticker := time.NewTicker(c.cfg.WatchTimeout / watchdogChecks)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopC:
+			return false
+		case <-ticker.C:
+			last := time.Unix(0, atomic.LoadInt64(&c.lastEvent))
+			if time.Since(last) > c.cfg.WatchTimeout {
+				return true
+			}
+		}
+	}
+}
+
+// informer returns the running node informer.
+func (c *Labeler) informer() cache.SharedIndexInformer {
+	c.informerMu.RLock()
+	defer c.informerMu.RUnlock()
+	return c.nodeInformer
+}
+
+// nodesSynced returns true if the running node informer has synced.
+func (c *Labeler) nodesSynced() bool {
+	return c.informer().HasSynced()
+}
+
+// nodeStore is the cache of the running node informer, the label controllers keep
+// working with the new cache when the node informer is restarted.
+type nodeStore struct {
+	c *Labeler
+}
+
+func (s nodeStore) List() []interface{} {
+	return s.c.informer().GetStore().List()
+}
+
+func (s nodeStore) ListKeys() []string {
+	return s.c.informer().GetStore().ListKeys()
+}
+
+func (s nodeStore) GetByKey(key string) (interface{}, bool, error) {
+	return s.c.informer().GetStore().GetByKey(key)
+}
+
+func (s nodeStore) HasSynced() bool {
+	return s.c.nodesSynced()
+}
+
+func (s nodeStore) ByIndex(indexName, indexedValue string) ([]interface{}, error) {
+	return s.c.informer().GetIndexer().ByIndex(indexName, indexedValue)
+}
@@ -0,0 +1,82 @@
+package labeler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	kooperlog "github.com/spotahome/kooper/log"
+)
+
+func TestNodeListWatchRecordsActivity(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("watch") == "true" {
+			node := testNode("n1", nil)
+			node.APIVersion, node.Kind = "v1", "Node"
+			json.NewEncoder(w).Encode(map[string]interface{}{"type": "ADDED", "object": node})
+			return
+		}
+		// A cluster without nodes.
+		json.NewEncoder(w).Encode(corev1.NodeList{})
+	}))
+	defer srv.Close()
+	cli, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Labeler{cfg: Config{}.withDefaults(), logger: kooperlog.Dummy, k8sCli: cli}
+	lw := c.nodeListWatch()
+	touched := func() bool { return atomic.SwapInt64(&c.lastEvent, 0) != 0 }
+
+	if _, err := lw.List(metav1.ListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !touched() {
+		t.Errorf("expected an empty node list recorded")
+	}
+	w, err := lw.Watch(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	if !touched() {
+		t.Errorf("expected the watch recorded")
+	}
+	if _, ok := <-w.ResultChan(); !ok {
+		t.Fatalf("expected a watch event")
+	}
+	if !touched() {
+		t.Errorf("expected the watch event recorded")
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	c := &Labeler{cfg: Config{WatchTimeout: 100 * time.Millisecond}.withDefaults()}
+	c.touch()
+	stopC := make(chan struct{})
+	if !c.watchdog(stopC) {
+		t.Errorf("expected the informer restarted without activity")
+	}
+
+	// The activity keeps it running until stopped.
+	done := make(chan bool)
+	c.touch()
+	go func() { done <- c.watchdog(stopC) }()
+	for i := 0; i < 6; i++ {
+		time.Sleep(40 * time.Millisecond)
+		c.touch()
+	}
+	close(stopC)
+	if <-done {
+		t.Errorf("expected the active informer not restarted")
+	}
+}
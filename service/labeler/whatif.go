@@ -0,0 +1,74 @@
+package labeler
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+	"github.com/joshisa/resource-labeler-operator/metrics"
+	kooperlog "github.com/spotahome/kooper/log"
+)
+
+// WhatIf is the impact on the cached nodes of applying a labeler spec.
+type WhatIf struct {
+	// Relabeled is the number of nodes the spec would mutate.
+	Relabeled int
+	// Added and Removed are the number of nodes the spec would start and stop being
+	// applied to.
+	Added   int
+	Removed int
+}
+
+// String returns the summary of the impact.
+func (w WhatIf) String() string {
+	return fmt.Sprintf("this edit will relabel %d nodes (%d newly selected, %d no longer selected)", w.Relabeled, w.Added, w.Removed)
+}
+
+// WhatIf plans the cached nodes with the labeler spec, without recording nor applying
+// anything, and returns how many nodes it would change against the running spec of
+// the labeler.
+func (c *Labeler) WhatIf(l *labelerv1alpha1.Labeler) (WhatIf, error) {
+	if err := Validate(l); err != nil {
+		return WhatIf{}, err
+	}
+	if !c.nodesSynced() {
+		return WhatIf{}, fmt.Errorf("the nodes are not synced yet")
+	}
+	cfg := c.cfg
+	cfg.MetricsRecorder = metrics.Dummy
+	cfg.MutationRecorder = nil
+	lc := NewLabelController(cfg, l.DeepCopy(), nodeStore{c}, kooperlog.Dummy)
+
+	before := map[string]bool{}
+	if old, ok := c.reg.Load(l.Name); ok {
+		before = old.(*LabelController).selectedNodes()
+	}
+	after := lc.selectedNodes()
+
+	var w WhatIf
+	for name := range after {
+		if !before[name] {
+			w.Added++
+		}
+	}
+	for name := range before {
+		if !after[name] {
+			w.Removed++
+		}
+	}
+	for _, obj := range c.informer().GetStore().List() {
+		node, ok := obj.(*corev1.Node)
+		if !ok {
+			continue
+		}
+		planned, _, _, err := lc.Plan(node)
+		if err != nil {
+			return WhatIf{}, fmt.Errorf("could not plan node %s: %s", node.Name, err)
+		}
+		if planned != nil {
+			w.Relabeled++
+		}
+	}
+	return w, nil
+}
@@ -0,0 +1,119 @@
+package labeler
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// workerScaleInterval is the period the queue depth is checked to scale the workers.
+	workerScaleInterval = 5 * time.Second
+	// workerScaleUpChecks are the consecutive checks with more queued nodes than
+	// workers that double the workers.
+	workerScaleUpChecks = 2
+	// workerScaleDownChecks are the consecutive checks with an empty queue that remove
+	// a worker, longer than scaling up so bursts don't flap the pool.
+	workerScaleDownChecks = 6
+)
+
+// workerPool runs the node workers, between the configured workers and max workers.
+type workerPool struct {
+	mu sync.Mutex
+	// stops are the stop channels of the running workers.
+	stops []chan struct{}
+	// busy and idle are the consecutive checks with a backed up and an empty queue.
+	busy int
+	idle int
+}
+
+// size returns the number of running workers.
+func (p *workerPool) size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.stops)
+}
+
+// desiredWorkers returns the number of workers for the queue depth, it records the
+// check so only sustained depths scale the pool.
+func (p *workerPool) desiredWorkers(depth, min, max int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := len(p.stops)
+	switch {
+	case depth > n:
+		p.busy++
+		p.idle = 0
+	case depth == 0:
+		p.idle++
+		p.busy = 0
+	default:
+		p.busy, p.idle = 0, 0
+	}
+
+	switch {
+	case p.busy >= workerScaleUpChecks && n < max:
+		p.busy = 0
+		if n *= 2; n > max {
+			n = max
+		}
+	case p.idle >= workerScaleDownChecks && n > min:
+		p.idle = 0
+		n--
+	}
+	return n
+}
+
+// runWorkers runs the node workers until stopC is closed. With max workers over the
+// workers the pool is scaled on the queue depth, otherwise it's static.
+func (c *Labeler) runWorkers(stopC <-chan struct{}) {
+	c.scaleWorkers(c.cfg.Workers)
+	if c.cfg.MaxWorkers > c.cfg.Workers {
+		go wait.Until(func() {
+			c.scaleWorkers(c.workers.desiredWorkers(c.queue.Len(), c.cfg.Workers, c.cfg.MaxWorkers))
+		}, workerScaleInterval, stopC)
+	}
+	<-stopC
+	c.scaleWorkers(0)
+}
+
+// scaleWorkers starts or stops workers to have n running. A stopped worker finishes
+// the node it's syncing, if any.
+func (c *Labeler) scaleWorkers(n int) {
+	c.workers.mu.Lock()
+	defer c.workers.mu.Unlock()
+	current := len(c.workers.stops)
+	if n == current {
+		return
+	}
+	for len(c.workers.stops) < n {
+		stopC := make(chan struct{})
+		c.workers.stops = append(c.workers.stops, stopC)
+		go wait.Until(func() { c.runWorkerUntil(stopC) }, time.Second, stopC)
+	}
+	for len(c.workers.stops) > n {
+		last := len(c.workers.stops) - 1
+		close(c.workers.stops[last])
+		c.workers.stops = c.workers.stops[:last]
+	}
+	if n > 0 && current > 0 {
+		c.logger.Infof("scaled node workers from %d to %d (%d queued nodes)", current, n, c.queue.Len())
+	}
+	c.cfg.MetricsRecorder.SetWorkers(n)
+}
+
+// runWorkerUntil processes the queued nodes until the worker is stopped or the queue
+// is shut down.
+func (c *Labeler) runWorkerUntil(stopC <-chan struct{}) {
+	for {
+		select {
+		case <-stopC:
+			return
+		default:
+		}
+		if !c.processNextNode() {
+			return
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package labeler
+
+import "testing"
+
+func TestDesiredWorkers(t *testing.T) {
+	const min, max = 2, 6
+	idle := []int{0, 0, 0, 0, 0, 0}
+	tests := []struct {
+		name    string
+		workers int
+		depths  []int
+		exp     int
+	}{
+		{name: "A single backed up check keeps the workers.", workers: 2, depths: []int{5}, exp: 2},
+		{name: "Sustained backed up checks double the workers.", workers: 2, depths: []int{5, 5}, exp: 4},
+		{name: "The workers are doubled up to the max.", workers: 4, depths: []int{9, 9}, exp: max},
+		{name: "A depth the workers keep up with resets the checks.", workers: 2, depths: []int{5, 2, 5}, exp: 2},
+		{name: "Sustained empty checks remove a worker.", workers: 4, depths: idle, exp: 3},
+		{name: "Fewer empty checks keep the workers.", workers: 4, depths: idle[1:], exp: 4},
+		{name: "The workers are removed down to the min.", workers: min, depths: idle, exp: min},
+		{name: "The checks restart once scaled.", workers: 2, depths: []int{5, 5, 5}, exp: 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &workerPool{}
+			n := test.workers
+			for _, depth := range test.depths {
+				p.stops = make([]chan struct{}, n)
+				n = p.desiredWorkers(depth, min, max)
+			}
+			if n != test.exp {
+				t.Errorf("expected %d workers, got %d", test.exp, n)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package labeler
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/joshisa/resource-labeler-operator/log"
+)
+
+// defaultAPIServer returns the API server URL of the default client, for the logs.
+func defaultAPIServer(cli kubernetes.Interface) string {
+	u := cli.CoreV1().RESTClient().Get().URL()
+	return u.Scheme + "://" + u.Host
+}
+
+// unreachable returns true if the error is not an API server response, the endpoint
+// couldn't be reached.
+func unreachable(err error) bool {
+	if err == nil {
+		return false
+	}
+	_, ok := err.(errors.APIStatus)
+	return !ok
+}
+
+// withZoneAPIServer calls the API for the node with the client of the preferred API
+// server of its zone, and again with the default one if it can't be reached. Without
+// preferred API server for the zone it's called with the default client.
+func (c *Labeler) withZoneAPIServer(node *corev1.Node, call func(cli kubernetes.Interface) (*corev1.Node, error)) (*corev1.Node, error) {
+	zone := NodeZone(node, c.cfg.ZoneLabel)
+	cli, ok := c.cfg.ZoneClients[zone]
+	if !ok {
+		if len(c.cfg.ZoneClients) > 0 {
+			log.Debugf(c.nodeLogger(node.Name), "patch of node %s of zone %q sent to the default API server %s", node.Name, zone, c.apiServer)
+		}
+		return call(c.k8sCli)
+	}
+
+	host := c.cfg.ZoneAPIServers[zone]
+	res, err := call(cli)
+	if !unreachable(err) {
+		log.Debugf(c.nodeLogger(node.Name), "patch of node %s of zone %s sent to the zone API server %s", node.Name, zone, host)
+		return res, err
+	}
+	c.nodeLogger(node.Name).Warningf("zone %s API server %s unreachable patching node %s, falling back to the default API server %s: %s", zone, host, node.Name, c.apiServer, err)
+	log.Debugf(c.nodeLogger(node.Name), "patch of node %s of zone %s sent again to the default API server %s", node.Name, zone, c.apiServer)
+	return call(c.k8sCli)
+}
@@ -0,0 +1,128 @@
+package labeler
+
+import (
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// zoneLimitRetry is when a zone limited node is synced again while the disruptive
+	// mutations of its zone are being patched.
+	zoneLimitRetry = 5 * time.Second
+
+	defaultZoneDisruptionWindow = time.Minute
+)
+
+// zoneSlot is a disruptive mutation of a zone, in flight until the end of the window
+// after its patch, zero while it's being patched.
+type zoneSlot struct {
+	zone  string
+	until time.Time
+}
+
+// zoneLimiter caps the disruptive mutations in flight by zone, like the max unavailable
+// of a PodDisruptionBudget for the node changes.
+type zoneLimiter struct {
+	max    int
+	window time.Duration
+	label  string
+
+	mu    sync.Mutex
+	slots map[string][]*zoneSlot
+}
+
+func newZoneLimiter(max int, window time.Duration, label string) *zoneLimiter {
+	return &zoneLimiter{max: max, window: window, label: label, slots: map[string][]*zoneSlot{}}
+}
+
+// acquire returns a slot of the zone of the node, nil and when to try again if the zone
+// has the maximum disruptive mutations in flight.
+func (z *zoneLimiter) acquire(node *corev1.Node, now time.Time) (*zoneSlot, time.Duration) {
+	zone := NodeZone(node, z.label)
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	slots := z.prune(zone, now)
+	if len(slots) < z.max {
+		slot := &zoneSlot{zone: zone}
+		z.slots[zone] = append(slots, slot)
+		return slot, 0
+	}
+
+	wait := zoneLimitRetry
+	for _, s := range slots {
+		if d := s.until.Sub(now); !s.until.IsZero() && d < wait {
+			wait = d
+		}
+	}
+	return nil, wait
+}
+
+// release keeps the slot in flight for the window if the mutation was patched,
+// otherwise it's freed.
+func (z *zoneLimiter) release(slot *zoneSlot, patched bool, now time.Time) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if patched {
+		slot.until = now.Add(z.window)
+		return
+	}
+	slots := z.slots[slot.zone]
+	for i, s := range slots {
+		if s == slot {
+			z.slots[slot.zone] = append(slots[:i:i], slots[i+1:]...)
+			break
+		}
+	}
+}
+
+// prune removes the slots of the zone whose window has passed, it's called locked.
+func (z *zoneLimiter) prune(zone string, now time.Time) []*zoneSlot {
+	var slots []*zoneSlot
+	for _, s := range z.slots[zone] {
+		if s.until.IsZero() || s.until.After(now) {
+			slots = append(slots, s)
+		}
+	}
+	if len(slots) == 0 {
+		delete(z.slots, zone)
+	}
+	return slots
+}
+
+// inFlight returns the disruptive mutations in flight by zone, nil if there are none.
+func (z *zoneLimiter) inFlight(now time.Time) map[string]int {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	var counts map[string]int
+	for zone := range z.slots {
+		if slots := z.prune(zone, now); len(slots) > 0 {
+			if counts == nil {
+				counts = map[string]int{}
+			}
+			z.slots[zone] = slots
+			counts[zone] = len(slots)
+		}
+	}
+	return counts
+}
+
+// disruptive returns true if the desired node adds or changes NoSchedule or NoExecute
+// taints of the node.
+func disruptive(node, dst *corev1.Node) bool {
+	current := map[string]string{}
+	for _, t := range node.Spec.Taints {
+		current[taintKey(t)] = t.Value
+	}
+	for _, t := range dst.Spec.Taints {
+		if t.Effect != corev1.TaintEffectNoSchedule && t.Effect != corev1.TaintEffectNoExecute {
+			continue
+		}
+		if v, ok := current[taintKey(t)]; !ok || v != t.Value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/joshisa/resource-labeler-operator/log"
+	"github.com/joshisa/resource-labeler-operator/metrics"
+	"github.com/joshisa/resource-labeler-operator/service/labeler"
+)
+
+// Config is the status publisher configuration.
+type Config struct {
+	// Namespace and Name are the ConfigMap the status is published to.
+	Namespace string
+	Name      string
+	// Identity is the key of the operator instance on the ConfigMap data.
+	Identity string
+	// Interval is the period the status is published, the heartbeat.
+	Interval time.Duration
+	// UpdateInterval is the minimum time between publishing status changes, the
+	// changes in between are coalesced (optional). Degraded and error condition
+	// changes are published right away.
+	UpdateInterval time.Duration
+	// MetricsRecorder records the coalesced status changes (optional).
+	MetricsRecorder metrics.Recorder
+}
+
+// checkInterval is how often the status is checked for changes.
+const checkInterval = time.Second
+
+// Source knows the status of the operator.
+type Source interface {
+	Status() labeler.Status
+	// Leading returns true if the operator instance holds the leader lease, or there
+	// is no lease. Only the leader publishes.
+	Leading() bool
+}
+
+// report is the status published by an operator instance.
+type report struct {
+	Identity  string    `json:"identity"`
+	Heartbeat time.Time `json:"heartbeat"`
+	labeler.Status
+}
+
+// Publisher publishes periodically the operator status to a ConfigMap, every
+// operator instance has its own key so a central controller can aggregate them.
+type Publisher struct {
+	cfg    Config
+	source Source
+	k8sCli kubernetes.Interface
+	logger log.Logger
+
+	// published is the last published status and when, seen the last checked one.
+	published     *labeler.Status
+	publishedTime time.Time
+	seen          *labeler.Status
+	// paused is set while not leading, the status is not published.
+	paused bool
+}
+
+// NewPublisher returns a new status publisher.
+func NewPublisher(cfg Config, source Source, k8sCli kubernetes.Interface, logger log.Logger) *Publisher {
+	if cfg.MetricsRecorder == nil {
+		cfg.MetricsRecorder = metrics.Dummy
+	}
+	return &Publisher{
+		cfg:    cfg,
+		source: source,
+		k8sCli: k8sCli,
+		logger: logger,
+	}
+}
+
+// Run publishes the status until stopC is closed. Satisfies kooper controller.Controller interface.
+func (p *Publisher) Run(stopC <-chan struct{}) error {
+	p.logger.Infof("publishing status to %s/%s configmap every %s", p.cfg.Namespace, p.cfg.Name, p.cfg.Interval)
+	if p.cfg.UpdateInterval <= 0 {
+		wait.Until(func() {
+			if p.leading() {
+				p.publishStatus(p.source.Status())
+			}
+		}, p.cfg.Interval, stopC)
+		return nil
+	}
+	wait.Until(func() {
+		if p.leading() {
+			p.check()
+		}
+	}, checkInterval, stopC)
+	return nil
+}
+
+// leading returns true if the operator instance leads, and logs when the publishing
+// stops or resumes. Resuming forgets the published status, it's published again.
+func (p *Publisher) leading() bool {
+	leading := p.source.Leading()
+	switch {
+	case !leading && !p.paused:
+		p.logger.Infof("not holding the leader lease, status publishing to %s/%s configmap stopped", p.cfg.Namespace, p.cfg.Name)
+		p.paused = true
+	case leading && p.paused:
+		p.logger.Infof("holding the leader lease, status publishing to %s/%s configmap resumed", p.cfg.Namespace, p.cfg.Name)
+		p.paused, p.published, p.seen = false, nil, nil
+	}
+	return leading
+}
+
+// check publishes the status if the heartbeat is due, or if it changed and either the
+// update interval has passed or the change is urgent. The rest of the changes wait,
+// they are coalesced.
+func (p *Publisher) check() {
+	st := p.source.Status()
+	since := time.Since(p.publishedTime)
+	changed := p.published == nil || !reflect.DeepEqual(*p.published, st)
+	// Urgent changes are published once, failures are retried with the rest.
+	fresh := p.seen == nil || !reflect.DeepEqual(*p.seen, st)
+	switch {
+	case since >= p.cfg.Interval, changed && (since >= p.cfg.UpdateInterval || fresh && urgent(p.published, st)):
+		p.publishStatus(st)
+	case changed && fresh:
+		p.cfg.MetricsRecorder.IncStatusWritesSuppressed()
+	}
+	p.seen = &st
+}
+
+// urgent returns true if the status change can't wait: the operator became degraded
+// or recovered, or the error conditions changed.
+func urgent(old *labeler.Status, st labeler.Status) bool {
+	if old == nil {
+		return true
+	}
+	return old.Degraded != st.Degraded || !reflect.DeepEqual(errorConditions(*old), errorConditions(st))
+}
+
+// errorConditions returns the conditions with error severity of the status.
+func errorConditions(st labeler.Status) []labeler.Condition {
+	var conds []labeler.Condition
+	for _, c := range st.Conditions {
+		if c.Severity == labeler.ConditionSeverityError {
+			conds = append(conds, c)
+		}
+	}
+	return conds
+}
+
+// publishStatus publishes the status and records it as the published one, failures
+// are retried after the update interval.
+func (p *Publisher) publishStatus(st labeler.Status) {
+	p.publishedTime = time.Now()
+	if err := p.publish(st); err != nil {
+		p.logger.Warningf("could not publish status: %s", err)
+		return
+	}
+	p.published = &st
+}
+
+// publish writes the status on the instance key of the ConfigMap, creating the
+// ConfigMap if needed.
+func (p *Publisher) publish(st labeler.Status) error {
+	b, err := json.Marshal(report{
+		Identity:  p.cfg.Identity,
+		Heartbeat: time.Now().UTC(),
+		Status:    st,
+	})
+	if err != nil {
+		return err
+	}
+
+	cms := p.k8sCli.CoreV1().ConfigMaps(p.cfg.Namespace)
+	cm, err := cms.Get(p.cfg.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = cms.Create(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: p.cfg.Name, Namespace: p.cfg.Namespace},
+			Data:       map[string]string{p.cfg.Identity: string(b)},
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[p.cfg.Identity] = string(b)
+	if _, err := cms.Update(cm); err != nil {
+		return fmt.Errorf("could not update %s/%s configmap: %s", p.cfg.Namespace, p.cfg.Name, err)
+	}
+	return nil
+}
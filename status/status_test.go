@@ -0,0 +1,82 @@
+package status
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	kooperlog "github.com/spotahome/kooper/log"
+
+	"github.com/joshisa/resource-labeler-operator/service/labeler"
+)
+
+// testSource is a status source whose leadership can be changed.
+type testSource struct {
+	mu      sync.Mutex
+	leading bool
+}
+
+func (s *testSource) Status() labeler.Status { return labeler.Status{} }
+
+func (s *testSource) Leading() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.leading
+}
+
+func (s *testSource) setLeading(leading bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.leading = leading
+}
+
+func TestPublisherStopsWhenNotLeading(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+	cli, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	getCalls := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+
+	src := &testSource{}
+	p := NewPublisher(Config{Namespace: "ns", Name: "status", Identity: "me", Interval: 20 * time.Millisecond}, src, cli, kooperlog.Dummy)
+	stopC := make(chan struct{})
+	defer close(stopC)
+	go p.Run(stopC)
+
+	time.Sleep(200 * time.Millisecond)
+	if n := getCalls(); n != 0 {
+		t.Fatalf("expected no status published while not leading, got %d calls", n)
+	}
+
+	src.setLeading(true)
+	time.Sleep(200 * time.Millisecond)
+	if getCalls() == 0 {
+		t.Fatalf("expected the status published while leading")
+	}
+
+	src.setLeading(false)
+	time.Sleep(50 * time.Millisecond)
+	n := getCalls()
+	time.Sleep(200 * time.Millisecond)
+	if got := getCalls(); got != n {
+		t.Errorf("expected the status publishing stopped on leadership loss, got %d more calls", got-n)
+	}
+}
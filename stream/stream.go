@@ -0,0 +1,90 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/joshisa/resource-labeler-operator/log"
+)
+
+const (
+	subscriberBuffer = 100
+)
+
+// Broadcaster streams the published records as JSON server-sent events to all the
+// connected clients. It's best-effort: there is no replay and clients that are not
+// keeping up miss records.
+type Broadcaster struct {
+	subs   map[chan []byte]struct{}
+	mu     sync.Mutex
+	logger log.Logger
+}
+
+// NewBroadcaster returns a new broadcaster.
+func NewBroadcaster(logger log.Logger) *Broadcaster {
+	return &Broadcaster{
+		subs:   map[chan []byte]struct{}{},
+		logger: logger,
+	}
+}
+
+// Publish sends the record to all the connected clients.
+func (b *Broadcaster) Publish(v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		b.logger.Errorf("could not marshal stream record: %s", err)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		select {
+		case sub <- data:
+		default:
+		}
+	}
+}
+
+// ServeHTTP streams the records to the client until it disconnects.
+func (b *Broadcaster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sub := b.subscribe()
+	defer b.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	for {
+		select {
+		case data := <-sub:
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (b *Broadcaster) subscribe() chan []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sub := make(chan []byte, subscriberBuffer)
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+func (b *Broadcaster) unsubscribe(sub chan []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subs, sub)
+}
@@ -0,0 +1,156 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	kooperlog "github.com/spotahome/kooper/log"
+)
+
+// subscribers returns the number of connected clients.
+func subscribers(b *Broadcaster) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// awaitSubscribers waits until the broadcaster has n connected clients.
+func awaitSubscribers(t *testing.T, b *Broadcaster, n int) {
+	deadline := time.Now().Add(time.Second)
+	for subscribers(b) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d subscribers, got %d", n, subscribers(b))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBroadcasterStreamsRecords(t *testing.T) {
+	b := NewBroadcaster(kooperlog.Dummy)
+	srv := httptest.NewServer(b)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected an event stream, got %q", ct)
+	}
+	awaitSubscribers(t, b, 1)
+
+	b.Publish(map[string]string{"node": "n1"})
+	b.Publish(map[string]string{"node": "n2"})
+	r := bufio.NewReader(resp.Body)
+	for _, exp := range []string{`data: {"node":"n1"}`, "", `data: {"node":"n2"}`, ""} {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSuffix(line, "\n"); got != exp {
+			t.Errorf("expected %q, got %q", exp, got)
+		}
+	}
+
+	// A disconnected client is unsubscribed.
+	cancel()
+	awaitSubscribers(t, b, 0)
+}
+
+func TestBroadcasterDropsSlowClients(t *testing.T) {
+	b := NewBroadcaster(kooperlog.Dummy)
+	sub := b.subscribe()
+	defer b.unsubscribe(sub)
+
+	// The publishes don't wait for a client not reading, the records over its buffer
+	// are missed.
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 2*subscriberBuffer; i++ {
+			b.Publish(i)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the publishes not blocked by a slow client")
+	}
+	if n := len(sub); n != subscriberBuffer {
+		t.Errorf("expected %d buffered records, got %d", subscriberBuffer, n)
+	}
+	if first := <-sub; string(first) != "0" {
+		t.Errorf("expected the first records kept, got %s", first)
+	}
+}
+
+func TestBroadcasterUnsubscribe(t *testing.T) {
+	b := NewBroadcaster(kooperlog.Dummy)
+	s1, s2 := b.subscribe(), b.subscribe()
+	b.unsubscribe(s1)
+
+	b.Publish("n1")
+	if len(s1) != 0 {
+		t.Errorf("expected no records for the unsubscribed client")
+	}
+	if len(s2) != 1 {
+		t.Errorf("expected the record for the subscribed client, got %d", len(s2))
+	}
+}
+
+func TestBroadcasterShutdown(t *testing.T) {
+	b := NewBroadcaster(kooperlog.Dummy)
+	srv := httptest.NewServer(b)
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	awaitSubscribers(t, b, 1)
+
+	// Closing the server ends the streams of the connected clients.
+	closed := make(chan struct{})
+	go func() {
+		srv.CloseClientConnections()
+		srv.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the server closed with clients connected")
+	}
+	awaitSubscribers(t, b, 0)
+}
+
+func TestBroadcasterRequiresFlusher(t *testing.T) {
+	b := NewBroadcaster(kooperlog.Dummy)
+	w := &plainWriter{header: http.Header{}}
+	b.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+	if w.status != http.StatusInternalServerError {
+		t.Errorf("expected %d, got %d", http.StatusInternalServerError, w.status)
+	}
+	if n := subscribers(b); n != 0 {
+		t.Errorf("expected no subscribers, got %d", n)
+	}
+}
+
+// plainWriter is a response writer that can't flush.
+type plainWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *plainWriter) Header() http.Header         { return w.header }
+func (w *plainWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *plainWriter) WriteHeader(status int)      { w.status = status }
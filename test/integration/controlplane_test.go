@@ -0,0 +1,186 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// assetsEnv has the directory of the etcd and kube-apiserver binaries, the same
+	// as the controller-runtime envtest.
+	assetsEnv    = "KUBEBUILDER_ASSETS"
+	adminToken   = "integration"
+	startTimeout = time.Minute
+)
+
+// controlPlane is an etcd and a kube-apiserver ran from the assets binaries, without
+// controller manager nor scheduler: the nodes are only API objects.
+type controlPlane struct {
+	dir       string
+	etcd      *exec.Cmd
+	apiserver *exec.Cmd
+	// Config is the admin configuration of the API server.
+	Config *rest.Config
+}
+
+// startControlPlane starts the control plane and waits for the API server to be
+// healthy.
+func startControlPlane(assets string) (cp *controlPlane, err error) {
+	dir, err := ioutil.TempDir("", "labeler-integration")
+	if err != nil {
+		return nil, err
+	}
+	cp = &controlPlane{dir: dir}
+	// The directory is kept on failures, with the logs.
+	defer func() {
+		if err != nil {
+			cp.kill()
+		}
+	}()
+
+	etcdPort, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	peerPort, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	etcdURL := "http://127.0.0.1:" + strconv.Itoa(etcdPort)
+	peerURL := "http://127.0.0.1:" + strconv.Itoa(peerPort)
+	cp.etcd = exec.Command(filepath.Join(assets, "etcd"),
+		"--data-dir="+filepath.Join(dir, "etcd"),
+		"--listen-client-urls="+etcdURL,
+		"--advertise-client-urls="+etcdURL,
+		"--listen-peer-urls="+peerURL,
+		"--initial-advertise-peer-urls="+peerURL,
+		"--initial-cluster=default="+peerURL,
+	)
+	if err := cp.start(cp.etcd, "etcd"); err != nil {
+		return nil, err
+	}
+
+	saKey, err := cp.writeServiceAccountKey()
+	if err != nil {
+		return nil, err
+	}
+	tokens := filepath.Join(dir, "tokens.csv")
+	if err := ioutil.WriteFile(tokens, []byte(adminToken+",admin,admin,system:masters\n"), 0600); err != nil {
+		return nil, err
+	}
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	cp.apiserver = exec.Command(filepath.Join(assets, "kube-apiserver"),
+		"--etcd-servers="+etcdURL,
+		"--cert-dir="+filepath.Join(dir, "certs"),
+		"--bind-address=127.0.0.1",
+		"--advertise-address=127.0.0.1",
+		"--secure-port="+strconv.Itoa(port),
+		"--token-auth-file="+tokens,
+		"--authorization-mode=AlwaysAllow",
+		"--service-cluster-ip-range=10.0.0.0/24",
+		"--service-account-issuer=https://127.0.0.1",
+		"--service-account-key-file="+saKey,
+		"--service-account-signing-key-file="+saKey,
+		"--disable-admission-plugins=ServiceAccount",
+	)
+	if err := cp.start(cp.apiserver, "kube-apiserver"); err != nil {
+		return nil, err
+	}
+
+	cp.Config = &rest.Config{
+		Host:            "https://127.0.0.1:" + strconv.Itoa(port),
+		BearerToken:     adminToken,
+		TLSClientConfig: rest.TLSClientConfig{Insecure: true},
+	}
+	if err := cp.waitHealthy(); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// start starts the process logging its output on the control plane directory.
+func (cp *controlPlane) start(cmd *exec.Cmd, name string) error {
+	out, err := os.Create(filepath.Join(cp.dir, name+".log"))
+	if err != nil {
+		return err
+	}
+	cmd.Stdout, cmd.Stderr = out, out
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("could not start %s: %s", name, err)
+	}
+	return nil
+}
+
+// writeServiceAccountKey writes the key signing the service account tokens, required
+// by the API server.
+func (cp *controlPlane) writeServiceAccountKey() (string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(cp.dir, "sa.key")
+	b := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return path, ioutil.WriteFile(path, b, 0600)
+}
+
+func (cp *controlPlane) waitHealthy() error {
+	cli, err := kubernetes.NewForConfig(cp.Config)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(startTimeout)
+	for {
+		b, err := cli.Discovery().RESTClient().Get().AbsPath("/healthz").DoRaw()
+		if err == nil && string(b) == "ok" {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("the API server is not healthy after %s (logs in %s): %v", startTimeout, cp.dir, err)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// stop stops the processes and removes the control plane directory.
+func (cp *controlPlane) stop() {
+	cp.kill()
+	os.RemoveAll(cp.dir)
+}
+
+func (cp *controlPlane) kill() {
+	for _, cmd := range []*exec.Cmd{cp.apiserver, cp.etcd} {
+		if cmd != nil && cmd.Process != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}
+	}
+}
+
+// freePort returns a free local TCP port.
+func freePort() (int, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
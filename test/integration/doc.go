@@ -0,0 +1,6 @@
+// Package integration has the integration tests of the operator against a real API
+// server, built with the integration tag. They run an etcd and a kube-apiserver from
+// the $KUBEBUILDER_ASSETS binaries and are skipped without them:
+//
+//	KUBEBUILDER_ASSETS=/usr/local/kubebuilder/bin go test -tags integration ./test/integration/
+package integration
@@ -0,0 +1,296 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spotahome/kooper/client/crd"
+	kooperlog "github.com/spotahome/kooper/log"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionscli "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+	labelerk8scli "github.com/joshisa/resource-labeler-operator/client/k8s/clientset/versioned"
+	"github.com/joshisa/resource-labeler-operator/operator"
+)
+
+const (
+	// testLabel selects the nodes of a test.
+	testLabel     = "integration.test/case"
+	holdFinalizer = "integration.test/hold"
+	waitTimeout   = 30 * time.Second
+)
+
+var (
+	kubeCli    kubernetes.Interface
+	labelerCli labelerk8scli.Interface
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+// run runs the tests against a control plane with the operator running, they are
+// skipped without the control plane binaries.
+func run(m *testing.M) int {
+	assets := os.Getenv(assetsEnv)
+	if assets == "" {
+		fmt.Printf("skipping the integration tests, %s is not set\n", assetsEnv)
+		return 0
+	}
+	cp, err := startControlPlane(assets)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer cp.stop()
+
+	stop, err := runOperator(cp)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer stop()
+	return m.Run()
+}
+
+// runOperator runs the operator against the control plane and waits for its CRD, it
+// returns the func stopping it.
+func runOperator(cp *controlPlane) (func(), error) {
+	var err error
+	if kubeCli, err = kubernetes.NewForConfig(cp.Config); err != nil {
+		return nil, err
+	}
+	if labelerCli, err = labelerk8scli.NewForConfig(cp.Config); err != nil {
+		return nil, err
+	}
+	aexCli, err := apiextensionscli.NewForConfig(cp.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := operator.NewOperatorConfig(time.Minute, 0)
+	cfg.ListenAddress = "127.0.0.1:0"
+	op, err := operator.New(cfg, labelerCli, crd.NewClient(aexCli, kooperlog.Dummy), kubeCli, kooperlog.Dummy)
+	if err != nil {
+		return nil, err
+	}
+	stopC := make(chan struct{})
+	errC := make(chan error, 1)
+	go func() {
+		errC <- op.Run(stopC)
+	}()
+
+	deadline := time.Now().Add(startTimeout)
+	for {
+		_, err := labelerCli.LabelerV1alpha1().Labelers().List(metav1.ListOptions{})
+		if err == nil {
+			break
+		}
+		select {
+		case err := <-errC:
+			return nil, fmt.Errorf("the operator stopped: %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			close(stopC)
+			return nil, fmt.Errorf("the labeler CRD is not served after %s: %s", startTimeout, err)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	return func() {
+		close(stopC)
+		<-errC
+	}, nil
+}
+
+// createNode creates a node of the test case.
+func createNode(t *testing.T, name, testCase string) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{testLabel: testCase}}}
+	if _, err := kubeCli.CoreV1().Nodes().Create(node); err != nil {
+		t.Fatalf("could not create node %s: %s", name, err)
+	}
+}
+
+// newLabeler returns a labeler of the nodes of the test case.
+func newLabeler(name, testCase string, merge labelerv1alpha1.MergeSpec) *labelerv1alpha1.Labeler {
+	return &labelerv1alpha1.Labeler{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: labelerv1alpha1.LabelerSpec{
+			NodeSelector: corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+				MatchExpressions: []corev1.NodeSelectorRequirement{{Key: testLabel, Operator: corev1.NodeSelectorOpIn, Values: []string{testCase}}},
+			}}},
+			Merge: merge,
+		},
+	}
+}
+
+func createLabeler(t *testing.T, l *labelerv1alpha1.Labeler) {
+	if _, err := labelerCli.LabelerV1alpha1().Labelers().Create(l); err != nil {
+		t.Fatalf("could not create labeler %s: %s", l.Name, err)
+	}
+}
+
+func deleteLabeler(t *testing.T, name string) {
+	if err := labelerCli.LabelerV1alpha1().Labelers().Delete(name, &metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("could not delete labeler %s: %s", name, err)
+	}
+}
+
+// awaitNode waits for the node to meet the condition.
+func awaitNode(t *testing.T, name, what string, cond func(*corev1.Node) bool) {
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		node, err := kubeCli.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+		if err == nil && cond(node) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected node %s %s after %s, got %+v (%v)", name, what, waitTimeout, node, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// hasTaint returns if the node has the taint key with the effect.
+func hasTaint(node *corev1.Node, key string, effect corev1.TaintEffect) bool {
+	for _, t := range node.Spec.Taints {
+		if t.Key == key && t.Effect == effect {
+			return true
+		}
+	}
+	return false
+}
+
+func TestApplyAndWithdraw(t *testing.T) {
+	createNode(t, "apply-1", "apply")
+	createNode(t, "apply-other", "other")
+	createLabeler(t, newLabeler("apply", "apply", labelerv1alpha1.MergeSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      map[string]string{"integration.test/label": "a"},
+			Annotations: map[string]string{"integration.test/annotation": "b"},
+		},
+		NodeSpec: corev1.NodeSpec{Taints: []corev1.Taint{{Key: "integration.test/taint", Value: "c", Effect: corev1.TaintEffectNoSchedule}}},
+	}))
+
+	awaitNode(t, "apply-1", "labeled, annotated and tainted", func(n *corev1.Node) bool {
+		return n.Labels["integration.test/label"] == "a" &&
+			n.Annotations["integration.test/annotation"] == "b" &&
+			hasTaint(n, "integration.test/taint", corev1.TaintEffectNoSchedule)
+	})
+	node, err := kubeCli.CoreV1().Nodes().Get("apply-other", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := node.Labels["integration.test/label"]; ok {
+		t.Errorf("expected the node not selected unchanged, got %v", node.Labels)
+	}
+
+	deleteLabeler(t, "apply")
+	awaitNode(t, "apply-1", "without the attributes of the deleted labeler", func(n *corev1.Node) bool {
+		_, label := n.Labels["integration.test/label"]
+		_, annotation := n.Annotations["integration.test/annotation"]
+		return !label && !annotation && !hasTaint(n, "integration.test/taint", corev1.TaintEffectNoSchedule)
+	})
+	if node, _ := kubeCli.CoreV1().Nodes().Get("apply-1", metav1.GetOptions{}); node.Labels[testLabel] != "apply" {
+		t.Errorf("expected the labels not set by the labeler kept, got %v", node.Labels)
+	}
+}
+
+func TestFinalizer(t *testing.T) {
+	createNode(t, "finalizer-1", "finalizer")
+	l := newLabeler("finalizer", "finalizer", labelerv1alpha1.MergeSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"integration.test/label": "a"}},
+	})
+	l.Finalizers = []string{holdFinalizer}
+	createLabeler(t, l)
+	awaitNode(t, "finalizer-1", "labeled", func(n *corev1.Node) bool {
+		return n.Labels["integration.test/label"] == "a"
+	})
+
+	// A labeler being deleted is applied until it's gone.
+	deleteLabeler(t, "finalizer")
+	l, err := labelerCli.LabelerV1alpha1().Labelers().Get("finalizer", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.DeletionTimestamp == nil {
+		t.Fatalf("expected the labeler held by its finalizer")
+	}
+	if node, _ := kubeCli.CoreV1().Nodes().Get("finalizer-1", metav1.GetOptions{}); node.Labels["integration.test/label"] != "a" {
+		t.Errorf("expected the labels of the held labeler kept, got %v", node.Labels)
+	}
+
+	l.Finalizers = nil
+	if _, err := labelerCli.LabelerV1alpha1().Labelers().Update(l); err != nil {
+		t.Fatal(err)
+	}
+	awaitNode(t, "finalizer-1", "without the labels of the released labeler", func(n *corev1.Node) bool {
+		_, ok := n.Labels["integration.test/label"]
+		return !ok
+	})
+}
+
+func TestConflict(t *testing.T) {
+	createNode(t, "conflict-1", "conflict")
+	createLabeler(t, newLabeler("conflict-a", "conflict", labelerv1alpha1.MergeSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"integration.test/team": "a"}},
+	}))
+	awaitNode(t, "conflict-1", "labeled by conflict-a", func(n *corev1.Node) bool {
+		return n.Labels["integration.test/team"] == "a"
+	})
+
+	// The first labeler by name wins the conflicting key.
+	createLabeler(t, newLabeler("conflict-b", "conflict", labelerv1alpha1.MergeSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"integration.test/team": "b", "integration.test/b": "true"}},
+	}))
+	awaitNode(t, "conflict-1", "labeled by conflict-b", func(n *corev1.Node) bool {
+		return n.Labels["integration.test/b"] == "true"
+	})
+	if node, _ := kubeCli.CoreV1().Nodes().Get("conflict-1", metav1.GetOptions{}); node.Labels["integration.test/team"] != "a" {
+		t.Errorf("expected the conflicting key of conflict-a kept, got %v", node.Labels)
+	}
+
+	// The key is handed over once the winner is deleted.
+	deleteLabeler(t, "conflict-a")
+	awaitNode(t, "conflict-1", "labeled by conflict-b", func(n *corev1.Node) bool {
+		return n.Labels["integration.test/team"] == "b"
+	})
+	deleteLabeler(t, "conflict-b")
+}
+
+func TestDryRun(t *testing.T) {
+	createNode(t, "dryrun-1", "dryrun")
+	l := newLabeler("dryrun", "dryrun", labelerv1alpha1.MergeSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"integration.test/dry": "true"}},
+		NodeSpec:   corev1.NodeSpec{Taints: []corev1.Taint{{Key: "integration.test/dry", Effect: corev1.TaintEffectNoExecute}}},
+	})
+	l.Spec.DryRun = true
+	createLabeler(t, l)
+	// The labelers are handled in order, the dry run one is planned once the next one
+	// is applied.
+	createLabeler(t, newLabeler("dryrun-marker", "dryrun", labelerv1alpha1.MergeSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"integration.test/marker": "true"}},
+	}))
+	awaitNode(t, "dryrun-1", "labeled by dryrun-marker", func(n *corev1.Node) bool {
+		return n.Labels["integration.test/marker"] == "true"
+	})
+
+	node, err := kubeCli.CoreV1().Nodes().Get("dryrun-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := node.Labels["integration.test/dry"]; ok || hasTaint(node, "integration.test/dry", corev1.TaintEffectNoExecute) {
+		t.Errorf("expected the dry run labeler not applied, got %v and %v", node.Labels, node.Spec.Taints)
+	}
+	deleteLabeler(t, "dryrun")
+	deleteLabeler(t, "dryrun-marker")
+}
@@ -0,0 +1,171 @@
+package watchtable
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/joshisa/resource-labeler-operator/service/labeler"
+)
+
+const (
+	// clearScreen moves the cursor home and clears the terminal.
+	clearScreen = "\x1b[H\x1b[2J"
+	// maxValueLength is the length the values are truncated to.
+	maxValueLength = 40
+
+	defaultRows    = 30
+	defaultRefresh = time.Second
+)
+
+// Config is the watch table configuration.
+type Config struct {
+	// Rows is the number of recent mutated keys shown.
+	Rows int
+	// Refresh is the minimum time between redraws.
+	Refresh time.Duration
+	// OwnerAnnotation is the owner annotation, its changes are not shown.
+	OwnerAnnotation string
+}
+
+func (c Config) withDefaults() Config {
+	if c.Rows <= 0 {
+		c.Rows = defaultRows
+	}
+	if c.Refresh <= 0 {
+		c.Refresh = defaultRefresh
+	}
+	return c
+}
+
+// row is a mutated key of the table.
+type row struct {
+	time      time.Time
+	node      string
+	rule      string
+	operation string
+	key       string
+	value     string
+}
+
+// Table prints the recent node mutations of the reconcile results as a table redrawn
+// on the terminal. It's a development convenience for running the operator locally,
+// not meant to be parsed nor for production.
+type Table struct {
+	cfg Config
+	out io.Writer
+
+	mu sync.Mutex
+	// rows are the recent rows, the most recent last.
+	rows    []row
+	syncs   int
+	patched int
+	dirty   bool
+}
+
+// New returns a new watch table that prints to out.
+func New(cfg Config, out io.Writer) *Table {
+	return &Table{cfg: cfg.withDefaults(), out: out, dirty: true}
+}
+
+// RecordReconcile satisfies labeler.ReconcileRecorder interface.
+func (t *Table) RecordReconcile(res labeler.ReconcileResult) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.syncs++
+	if res.Outcome == labeler.ReconcilePatched {
+		t.patched++
+	}
+	for _, m := range res.Mutations {
+		operation := m.Operation
+		if m.DryRun {
+			operation += " (dry run)"
+		}
+		for _, k := range m.Keys {
+			if k == "annotations/"+t.cfg.OwnerAnnotation {
+				continue
+			}
+			t.rows = append(t.rows, row{
+				time:      m.Time,
+				node:      m.Node,
+				rule:      m.Rule,
+				operation: operation,
+				key:       k,
+				value:     keyValue(res.Patched, k, m.DryRun),
+			})
+		}
+	}
+	if n := len(t.rows) - t.cfg.Rows; n > 0 {
+		t.rows = append([]row(nil), t.rows[n:]...)
+	}
+	t.dirty = true
+}
+
+// keyValue returns the value of the mutation key on the patched node, the taints show
+// their value.
+func keyValue(node *corev1.Node, key string, dryRun bool) string {
+	if node == nil || dryRun {
+		return "-"
+	}
+	var v string
+	var ok bool
+	switch {
+	case strings.HasPrefix(key, "labels/"):
+		v, ok = node.Labels[strings.TrimPrefix(key, "labels/")]
+	case strings.HasPrefix(key, "annotations/"):
+		v, ok = node.Annotations[strings.TrimPrefix(key, "annotations/")]
+	case strings.HasPrefix(key, "taints/"):
+		for _, t := range node.Spec.Taints {
+			if t.Key+":"+string(t.Effect) == strings.TrimPrefix(key, "taints/") {
+				v, ok = t.Value, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return "<removed>"
+	}
+	if len(v) > maxValueLength {
+		v = v[:maxValueLength-3] + "..."
+	}
+	return v
+}
+
+// Run redraws the table every refresh if there are new syncs, until stopped.
+func (t *Table) Run(stopC <-chan struct{}) error {
+	ticker := time.NewTicker(t.cfg.Refresh)
+	defer ticker.Stop()
+	for {
+		t.draw(time.Now())
+		select {
+		case <-stopC:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// draw prints the table, most recent mutations first.
+func (t *Table) draw(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.dirty {
+		return
+	}
+	t.dirty = false
+
+	fmt.Fprint(t.out, clearScreen)
+	fmt.Fprintf(t.out, "%s  %d node syncs, %d patched (last %d mutated keys)\n\n", now.Format("15:04:05"), t.syncs, t.patched, t.cfg.Rows)
+	tw := tabwriter.NewWriter(t.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tNODE\tRULE\tOP\tKEY\tVALUE")
+	for i := len(t.rows) - 1; i >= 0; i-- {
+		r := t.rows[i]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.time.Format("15:04:05"), r.node, r.rule, r.operation, r.key, r.value)
+	}
+	tw.Flush()
+}
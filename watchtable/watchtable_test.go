@@ -0,0 +1,133 @@
+package watchtable
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/joshisa/resource-labeler-operator/service/labeler"
+)
+
+var at = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func patchedNode() *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "n1",
+			Labels:      map[string]string{"team": "ops", "long": strings.Repeat("a", 50)},
+			Annotations: map[string]string{"owner": "ops"},
+		},
+		Spec: corev1.NodeSpec{Taints: []corev1.Taint{{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule}}},
+	}
+}
+
+func TestRecordReconcile(t *testing.T) {
+	tests := []struct {
+		name    string
+		res     labeler.ReconcileResult
+		expRows []row
+	}{
+		{
+			name: "A row per mutated key with its patched value.",
+			res: labeler.ReconcileResult{Outcome: labeler.ReconcilePatched, Patched: patchedNode(), Mutations: []labeler.Mutation{{
+				Time: at, Node: "n1", Rule: "ops", Operation: "merge",
+				Keys: []string{"labels/team", "annotations/owner", "taints/dedicated:NoSchedule", "labels/gone"},
+			}}},
+			expRows: []row{
+				{time: at, node: "n1", rule: "ops", operation: "merge", key: "labels/team", value: "ops"},
+				{time: at, node: "n1", rule: "ops", operation: "merge", key: "annotations/owner", value: "ops"},
+				{time: at, node: "n1", rule: "ops", operation: "merge", key: "taints/dedicated:NoSchedule", value: "gpu"},
+				{time: at, node: "n1", rule: "ops", operation: "merge", key: "labels/gone", value: "<removed>"},
+			},
+		},
+		{
+			name: "The long values are truncated.",
+			res: labeler.ReconcileResult{Outcome: labeler.ReconcilePatched, Patched: patchedNode(), Mutations: []labeler.Mutation{{
+				Time: at, Node: "n1", Rule: "ops", Operation: "merge", Keys: []string{"labels/long"},
+			}}},
+			expRows: []row{
+				{time: at, node: "n1", rule: "ops", operation: "merge", key: "labels/long", value: strings.Repeat("a", maxValueLength-3) + "..."},
+			},
+		},
+		{
+			name: "The owner annotation is not shown.",
+			res: labeler.ReconcileResult{Outcome: labeler.ReconcilePatched, Patched: patchedNode(), Mutations: []labeler.Mutation{{
+				Time: at, Node: "n1", Rule: "ops", Operation: "merge", Keys: []string{"annotations/owned-keys", "labels/team"},
+			}}},
+			expRows: []row{
+				{time: at, node: "n1", rule: "ops", operation: "merge", key: "labels/team", value: "ops"},
+			},
+		},
+		{
+			name: "The dry run mutations have no value.",
+			res: labeler.ReconcileResult{Outcome: labeler.ReconcileUnchanged, Mutations: []labeler.Mutation{{
+				Time: at, Node: "n1", Rule: "ops", Operation: "merge", Keys: []string{"labels/team"}, DryRun: true,
+			}}},
+			expRows: []row{
+				{time: at, node: "n1", rule: "ops", operation: "merge (dry run)", key: "labels/team", value: "-"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tb := New(Config{OwnerAnnotation: "owned-keys"}, &bytes.Buffer{})
+			tb.RecordReconcile(test.res)
+			if !reflect.DeepEqual(tb.rows, test.expRows) {
+				t.Errorf("expected the rows %+v, got %+v", test.expRows, tb.rows)
+			}
+		})
+	}
+}
+
+func TestRecordReconcileKeepsRecentRows(t *testing.T) {
+	tb := New(Config{Rows: 2}, &bytes.Buffer{})
+	for _, node := range []string{"n1", "n2", "n3"} {
+		tb.RecordReconcile(labeler.ReconcileResult{Outcome: labeler.ReconcilePatched, Mutations: []labeler.Mutation{{
+			Time: at, Node: node, Rule: "ops", Operation: "merge", Keys: []string{"labels/team"},
+		}}})
+	}
+	tb.RecordReconcile(labeler.ReconcileResult{Outcome: labeler.ReconcileUnchanged})
+
+	var nodes []string
+	for _, r := range tb.rows {
+		nodes = append(nodes, r.node)
+	}
+	if exp := []string{"n2", "n3"}; !reflect.DeepEqual(nodes, exp) {
+		t.Errorf("expected the rows of %v, got %v", exp, nodes)
+	}
+	if tb.syncs != 4 || tb.patched != 3 {
+		t.Errorf("expected 4 syncs and 3 patched, got %d and %d", tb.syncs, tb.patched)
+	}
+}
+
+func TestDraw(t *testing.T) {
+	var out bytes.Buffer
+	tb := New(Config{}, &out)
+	for _, node := range []string{"n1", "n2"} {
+		tb.RecordReconcile(labeler.ReconcileResult{Outcome: labeler.ReconcilePatched, Patched: patchedNode(), Mutations: []labeler.Mutation{{
+			Time: at, Node: node, Rule: "ops", Operation: "merge", Keys: []string{"labels/team"},
+		}}})
+	}
+
+	tb.draw(at)
+	exp := clearScreen + "03:04:05  2 node syncs, 2 patched (last 30 mutated keys)\n\n" +
+		"TIME      NODE  RULE  OP     KEY          VALUE\n" +
+		"03:04:05  n2    ops   merge  labels/team  ops\n" +
+		"03:04:05  n1    ops   merge  labels/team  ops\n"
+	if got := out.String(); got != exp {
+		t.Errorf("expected the most recent rows first:\n%q\ngot:\n%q", exp, got)
+	}
+
+	// The table is only redrawn on new syncs.
+	out.Reset()
+	tb.draw(at)
+	if out.Len() != 0 {
+		t.Errorf("expected no redraw without new syncs, got %q", out.String())
+	}
+}
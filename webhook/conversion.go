@@ -0,0 +1,94 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+	labelerv1beta1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1beta1"
+)
+
+func (s *Server) handleConvert(w http.ResponseWriter, r *http.Request) {
+	review := &conversionReview{}
+	if err := decodeReview(w, r, review); err != nil || review.Request == nil {
+		http.Error(w, "invalid conversion review", http.StatusBadRequest)
+		return
+	}
+
+	resp := s.convert(review.Request)
+	resp.UID = review.Request.UID
+	review.Request = nil
+	review.Response = resp
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		s.logger.Errorf("could not write conversion response: %s", err)
+	}
+}
+
+// convert converts the labelers of the request to its desired version, it fails if
+// any of them can't be converted.
+func (s *Server) convert(req *conversionRequest) *conversionResponse {
+	resp := &conversionResponse{Result: metav1.Status{Status: metav1.StatusSuccess}}
+	for _, obj := range req.Objects {
+		raw, err := convertLabeler(obj.Raw, req.DesiredAPIVersion)
+		if err != nil {
+			s.logger.Warningf("could not convert labeler to %s: %s", req.DesiredAPIVersion, err)
+			return &conversionResponse{Result: metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}}
+		}
+		resp.ConvertedObjects = append(resp.ConvertedObjects, runtime.RawExtension{Raw: raw})
+	}
+	return resp
+}
+
+// convertLabeler converts the labeler to the version through the hub version.
+func convertLabeler(raw []byte, version string) ([]byte, error) {
+	hub, err := toHub(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	switch version {
+	case labelerv1beta1.SchemeGroupVersion.String():
+		return json.Marshal(hub)
+	case labelerv1alpha1.SchemeGroupVersion.String():
+		l := &labelerv1alpha1.Labeler{}
+		if err := hub.ConvertTo(l); err != nil {
+			return nil, err
+		}
+		return json.Marshal(l)
+	default:
+		return nil, fmt.Errorf("unsupported labeler version %s", version)
+	}
+}
+
+// toHub decodes the labeler of any version as the hub version.
+func toHub(raw []byte) (*labelerv1beta1.Labeler, error) {
+	tm := metav1.TypeMeta{}
+	if err := json.Unmarshal(raw, &tm); err != nil {
+		return nil, err
+	}
+
+	hub := &labelerv1beta1.Labeler{}
+	switch tm.APIVersion {
+	case labelerv1beta1.SchemeGroupVersion.String():
+		if err := json.Unmarshal(raw, hub); err != nil {
+			return nil, err
+		}
+	case labelerv1alpha1.SchemeGroupVersion.String():
+		l := &labelerv1alpha1.Labeler{}
+		if err := json.Unmarshal(raw, l); err != nil {
+			return nil, err
+		}
+		if err := hub.ConvertFrom(l); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported labeler version %s", tm.APIVersion)
+	}
+	return hub, nil
+}
@@ -0,0 +1,134 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	kooperlog "github.com/spotahome/kooper/log"
+)
+
+// postConversion posts the conversion of the objects to the version, it returns the
+// response.
+func postConversion(t *testing.T, version string, objects ...string) *conversionResponse {
+	review := conversionReview{Request: &conversionRequest{UID: "1", DesiredAPIVersion: version}}
+	for _, obj := range objects {
+		review.Request.Objects = append(review.Request.Objects, runtime.RawExtension{Raw: []byte(obj)})
+	}
+	b, err := json.Marshal(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	NewServer(Config{}, nil, nil, kooperlog.Dummy).handleConvert(rec, httptest.NewRequest(http.MethodPost, "/convert", bytes.NewReader(b)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	got := &conversionReview{}
+	if err := json.Unmarshal(rec.Body.Bytes(), got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Response == nil || got.Response.UID != "1" {
+		t.Fatalf("expected the response of the request, got %+v", got.Response)
+	}
+	return got.Response
+}
+
+// decode decodes the JSON object as a generic map.
+func decode(t *testing.T, raw []byte) map[string]interface{} {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+func TestHandleConvert(t *testing.T) {
+	const alpha = `{"apiVersion":"labeler.cfmr.site/v1alpha1","kind":"Labeler","metadata":{"name":"gpu","creationTimestamp":null},` +
+		`"spec":{"merge":{"labels":{"gpu":"true"},"unschedulable":true,"creationTimestamp":null},"dryRun":true}}`
+	tests := []struct {
+		name      string
+		version   string
+		objects   []string
+		expStatus string
+		expObject string
+	}{
+		{
+			name:      "A v1alpha1 labeler is converted to v1beta1.",
+			version:   "labeler.cfmr.site/v1beta1",
+			objects:   []string{alpha},
+			expStatus: metav1.StatusSuccess,
+			expObject: `{"apiVersion":"labeler.cfmr.site/v1beta1","kind":"Labeler","metadata":{"name":"gpu","creationTimestamp":null,` +
+				`"annotations":{"labeler.cfmr.site/v1alpha1-merge":"{\"creationTimestamp\":null,\"unschedulable\":true}"}},` +
+				`"spec":{"nodeSelectorTerms":null,"merge":{"labels":{"gpu":"true"}},"dryRun":true}}`,
+		},
+		{
+			name:      "A v1beta1 labeler is converted to v1alpha1.",
+			version:   "labeler.cfmr.site/v1alpha1",
+			objects:   []string{`{"apiVersion":"labeler.cfmr.site/v1beta1","kind":"Labeler","metadata":{"name":"gpu"},"spec":{"merge":{"taints":[{"key":"gpu","effect":"NoSchedule"}]}}}`},
+			expStatus: metav1.StatusSuccess,
+			expObject: `{"apiVersion":"labeler.cfmr.site/v1alpha1","kind":"Labeler","metadata":{"name":"gpu","creationTimestamp":null},` +
+				`"spec":{"nodeSelectorTerms":null,"merge":{"creationTimestamp":null,"taints":[{"key":"gpu","effect":"NoSchedule"}]}}}`,
+		},
+		{
+			name:      "An unsupported desired version fails.",
+			version:   "labeler.cfmr.site/v2",
+			objects:   []string{alpha},
+			expStatus: metav1.StatusFailure,
+		},
+		{
+			name:      "An unsupported object version fails.",
+			version:   "labeler.cfmr.site/v1beta1",
+			objects:   []string{`{"apiVersion":"labeler.cfmr.site/v2","kind":"Labeler"}`},
+			expStatus: metav1.StatusFailure,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := postConversion(t, test.version, test.objects...)
+			if resp.Result.Status != test.expStatus {
+				t.Fatalf("expected the %s status, got %+v", test.expStatus, resp.Result)
+			}
+			if test.expObject == "" {
+				if len(resp.ConvertedObjects) != 0 {
+					t.Errorf("expected no converted objects, got %d", len(resp.ConvertedObjects))
+				}
+				return
+			}
+			if len(resp.ConvertedObjects) != 1 {
+				t.Fatalf("expected a converted object, got %d", len(resp.ConvertedObjects))
+			}
+			exp, got := decode(t, []byte(test.expObject)), decode(t, resp.ConvertedObjects[0].Raw)
+			if !reflect.DeepEqual(got, exp) {
+				t.Errorf("expected the object %v, got %v", exp, got)
+			}
+		})
+	}
+}
+
+func TestHandleConvertRoundTrip(t *testing.T) {
+	const alpha = `{"apiVersion":"labeler.cfmr.site/v1alpha1","kind":"Labeler","metadata":{"name":"gpu","creationTimestamp":null},` +
+		`"spec":{"nodeSelectorTerms":[{"matchExpressions":[{"key":"pool","operator":"In","values":["gpu"]}]}],` +
+		`"merge":{"name":"unused","labels":{"gpu":"true"},"annotations":{"team":"ml"},"podCIDR":"10.0.0.0/24","creationTimestamp":null},` +
+		`"rolloutPercentage":50,"rename":[{"from":"old","to":"new"}]}}`
+
+	beta := postConversion(t, "labeler.cfmr.site/v1beta1", alpha)
+	if len(beta.ConvertedObjects) != 1 {
+		t.Fatalf("expected a v1beta1 object, got %+v", beta)
+	}
+	back := postConversion(t, "labeler.cfmr.site/v1alpha1", string(beta.ConvertedObjects[0].Raw))
+	if len(back.ConvertedObjects) != 1 {
+		t.Fatalf("expected a v1alpha1 object, got %+v", back)
+	}
+	if exp, got := decode(t, []byte(alpha)), decode(t, back.ConvertedObjects[0].Raw); !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected the labeler unchanged by the round trip %v, got %v", exp, got)
+	}
+}
@@ -0,0 +1,61 @@
+package webhook
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// k8s.io/api/admission is not vendored, these are the subset of the
+// admission.k8s.io/v1beta1 types used by the webhook.
+
+// Admission operations.
+const (
+	operationCreate = "CREATE"
+	operationUpdate = "UPDATE"
+	operationDelete = "DELETE"
+)
+
+type admissionReview struct {
+	metav1.TypeMeta `json:",inline"`
+	Request         *admissionRequest  `json:"request,omitempty"`
+	Response        *admissionResponse `json:"response,omitempty"`
+}
+
+type admissionRequest struct {
+	UID       types.UID               `json:"uid"`
+	Kind      metav1.GroupVersionKind `json:"kind"`
+	Name      string                  `json:"name,omitempty"`
+	Operation string                  `json:"operation"`
+	Object    runtime.RawExtension    `json:"object,omitempty"`
+	OldObject runtime.RawExtension    `json:"oldObject,omitempty"`
+}
+
+type admissionResponse struct {
+	UID              types.UID         `json:"uid"`
+	Allowed          bool              `json:"allowed"`
+	Result           *metav1.Status    `json:"status,omitempty"`
+	AuditAnnotations map[string]string `json:"auditAnnotations,omitempty"`
+	Warnings         []string          `json:"warnings,omitempty"`
+}
+
+// The vendored apiextensions.k8s.io/v1beta1 has no conversion types, these are the
+// subset of the ConversionReview types used by the conversion webhook.
+
+type conversionReview struct {
+	metav1.TypeMeta `json:",inline"`
+	Request         *conversionRequest  `json:"request,omitempty"`
+	Response        *conversionResponse `json:"response,omitempty"`
+}
+
+type conversionRequest struct {
+	UID               types.UID              `json:"uid"`
+	DesiredAPIVersion string                 `json:"desiredAPIVersion"`
+	Objects           []runtime.RawExtension `json:"objects"`
+}
+
+type conversionResponse struct {
+	UID              types.UID              `json:"uid"`
+	ConvertedObjects []runtime.RawExtension `json:"convertedObjects"`
+	Result           metav1.Status          `json:"result"`
+}
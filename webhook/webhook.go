@@ -0,0 +1,245 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apilabeler "github.com/joshisa/resource-labeler-operator/apis/labeler"
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+	labelerk8scli "github.com/joshisa/resource-labeler-operator/client/k8s/clientset/versioned"
+	"github.com/joshisa/resource-labeler-operator/log"
+	"github.com/joshisa/resource-labeler-operator/server"
+	"github.com/joshisa/resource-labeler-operator/service/labeler"
+)
+
+const (
+	shutdownTimeout = 5 * time.Second
+	// maxReviewBytes is the maximum size of a review, above the API server object size
+	// limit (3MiB) twice as the admission reviews have the object and the old object.
+	maxReviewBytes = 8 << 20
+	// whatIfAnnotation is the audit annotation of the what-if summary, the API server
+	// prefixes it with the webhook name.
+	whatIfAnnotation = "what-if"
+)
+
+// Config is the webhook configuration.
+type Config struct {
+	// Address is the address the webhook will listen on.
+	Address string
+	// CertFile and KeyFile are the TLS certificate used by the webhook.
+	CertFile string
+	KeyFile  string
+	// DeleteProtectionThreshold is the number of nodes a labeler needs to own
+	// attributes on so its deletion is denied.
+	DeleteProtectionThreshold int
+	// AllowDeleteAnnotation is the labeler annotation allowing its deletion (optional).
+	AllowDeleteAnnotation string
+	// AllowedTaintEffects are the only taint effects the labelers can merge, empty
+	// allows all of them.
+	AllowedTaintEffects []string
+	// HTTPSourceHosts and HTTPSourceSecrets are the only URL hosts and Secrets the
+	// http value sources can use.
+	HTTPSourceHosts   []string
+	HTTPSourceSecrets []string
+	// WhatIf annotates the allowed creations and updates with how many nodes the new
+	// spec would change, planning it against the node cache of the operator.
+	WhatIf bool
+}
+
+// NodeCounter knows how many nodes a labeler owns attributes on, and would change with
+// a new spec.
+type NodeCounter interface {
+	OwnedNodes(name string) (int, error)
+	WhatIf(l *labelerv1alpha1.Labeler) (labeler.WhatIf, error)
+}
+
+// Server is the validating admission and the conversion webhook of the labelers.
+type Server struct {
+	cfg        Config
+	counter    NodeCounter
+	labelerCli labelerk8scli.Interface
+	logger     log.Logger
+}
+
+// NewServer returns a new webhook server.
+func NewServer(cfg Config, counter NodeCounter, labelerCli labelerk8scli.Interface, logger log.Logger) *Server {
+	if cfg.AllowDeleteAnnotation == "" {
+		cfg.AllowDeleteAnnotation = apilabeler.AllowDeleteAnnotation
+	}
+
+	return &Server{
+		cfg:        cfg,
+		counter:    counter,
+		labelerCli: labelerCli,
+		logger:     logger,
+	}
+}
+
+// Run serves the webhook until stopC is closed. Satisfies kooper controller.Controller interface.
+func (s *Server) Run(stopC <-chan struct{}) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/validate", s.handleValidate)
+	mux.HandleFunc("/convert", s.handleConvert)
+
+	ln, err := server.Listen(s.cfg.Address)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Addr: s.cfg.Address, Handler: mux}
+
+	errC := make(chan error, 1)
+	go func() {
+		s.logger.Infof("listening webhook on %s", s.cfg.Address)
+		errC <- srv.ServeTLS(ln, s.cfg.CertFile, s.cfg.KeyFile)
+	}()
+
+	select {
+	case err := <-errC:
+		return fmt.Errorf("webhook server stopped: %s", err)
+	case <-stopC:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
+
+func (s *Server) handleValidate(w http.ResponseWriter, r *http.Request) {
+	review := &admissionReview{}
+	if err := decodeReview(w, r, review); err != nil || review.Request == nil {
+		http.Error(w, "invalid admission review", http.StatusBadRequest)
+		return
+	}
+
+	resp := s.validate(review.Request)
+	resp.UID = review.Request.UID
+	review.Request = nil
+	review.Response = resp
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		s.logger.Errorf("could not write admission response: %s", err)
+	}
+}
+
+// validate returns the admission decision for the request.
+func (s *Server) validate(req *admissionRequest) *admissionResponse {
+	switch req.Operation {
+	case operationCreate, operationUpdate:
+		return s.validateSpec(req)
+	case operationDelete:
+		return s.validateDelete(req)
+	default:
+		return allow()
+	}
+}
+
+// validateSpec denies creating or updating a labeler merging taints with effects out
+// of the allowed ones, or setting label keys it removes.
+func (s *Server) validateSpec(req *admissionRequest) *admissionResponse {
+	l := &labelerv1alpha1.Labeler{}
+	if err := json.Unmarshal(req.Object.Raw, l); err != nil {
+		s.logger.Warningf("could not decode labeler %s on %s admission: %s", req.Name, req.Operation, err)
+		return allow()
+	}
+	if err := labeler.ValidateTaintEffects(l, s.cfg.AllowedTaintEffects); err != nil {
+		s.logger.Infof("denied %s: %s", req.Operation, err)
+		return deny(err.Error())
+	}
+	if err := labeler.ValidateKeyConflicts(l); err != nil {
+		s.logger.Infof("denied %s: %s", req.Operation, err)
+		return deny(err.Error())
+	}
+	if err := labeler.ValidateHTTPSources(l, s.cfg.HTTPSourceHosts, s.cfg.HTTPSourceSecrets); err != nil {
+		s.logger.Infof("denied %s: %s", req.Operation, err)
+		return deny(err.Error())
+	}
+	resp := allow()
+	if s.cfg.WhatIf {
+		s.annotateWhatIf(resp, l)
+	}
+	return resp
+}
+
+// annotateWhatIf adds to the response the impact of applying the labeler, as an audit
+// annotation and a warning shown by the clients.
+func (s *Server) annotateWhatIf(resp *admissionResponse, l *labelerv1alpha1.Labeler) {
+	w, err := s.counter.WhatIf(l)
+	if err != nil {
+		s.logger.Warningf("could not plan labeler %s what-if: %s", l.Name, err)
+		return
+	}
+	msg := w.String()
+	resp.AuditAnnotations = map[string]string{whatIfAnnotation: msg}
+	resp.Warnings = []string{msg}
+	s.logger.Infof("labeler %s what-if: %s", l.Name, msg)
+}
+
+// validateDelete denies deleting a labeler owning attributes on more nodes than the
+// threshold unless the labeler has the allow delete annotation. The deletion is also
+// denied if the labeler or its nodes can't be checked.
+func (s *Server) validateDelete(req *admissionRequest) *admissionResponse {
+	l, err := s.oldLabeler(req)
+	if err != nil {
+		msg := fmt.Sprintf("could not get labeler %s to check its deletion: %s", req.Name, err)
+		s.logger.Warningf("denied deletion: %s", msg)
+		return deny(msg)
+	}
+	if l.Annotations[s.cfg.AllowDeleteAnnotation] == "true" {
+		return allow()
+	}
+
+	owned, err := s.counter.OwnedNodes(l.Name)
+	if err != nil {
+		msg := fmt.Sprintf("could not count the nodes of labeler %s to check its deletion: %s", l.Name, err)
+		s.logger.Warningf("denied deletion: %s", msg)
+		return deny(msg)
+	}
+	if owned <= s.cfg.DeleteProtectionThreshold {
+		return allow()
+	}
+
+	msg := fmt.Sprintf("labeler %s owns attributes on %d nodes (threshold %d), set the %q annotation to \"true\" to delete it",
+		l.Name, owned, s.cfg.DeleteProtectionThreshold, s.cfg.AllowDeleteAnnotation)
+	s.logger.Infof("denied deletion: %s", msg)
+	return deny(msg)
+}
+
+// oldLabeler returns the labeler being deleted, old API servers don't send it on
+// deletes so it's retrieved from the cluster.
+func (s *Server) oldLabeler(req *admissionRequest) (*labelerv1alpha1.Labeler, error) {
+	if len(req.OldObject.Raw) > 0 {
+		l := &labelerv1alpha1.Labeler{}
+		if err := json.Unmarshal(req.OldObject.Raw, l); err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+	return s.labelerCli.LabelerV1alpha1().Labelers().Get(req.Name, metav1.GetOptions{})
+}
+
+// decodeReview decodes the review of the request body, at most maxReviewBytes.
+func decodeReview(w http.ResponseWriter, r *http.Request, review interface{}) error {
+	return json.NewDecoder(http.MaxBytesReader(w, r.Body, maxReviewBytes)).Decode(review)
+}
+
+func allow() *admissionResponse {
+	return &admissionResponse{Allowed: true}
+}
+
+func deny(msg string) *admissionResponse {
+	return &admissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: msg,
+			Reason:  metav1.StatusReasonForbidden,
+			Code:    http.StatusForbidden,
+		},
+	}
+}
@@ -0,0 +1,238 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+
+	kooperlog "github.com/spotahome/kooper/log"
+
+	apilabeler "github.com/joshisa/resource-labeler-operator/apis/labeler"
+	labelerv1alpha1 "github.com/joshisa/resource-labeler-operator/apis/labeler/v1alpha1"
+	labelerk8scli "github.com/joshisa/resource-labeler-operator/client/k8s/clientset/versioned"
+	"github.com/joshisa/resource-labeler-operator/service/labeler"
+)
+
+// counter is a node counter of fixed owned nodes by labeler.
+type counter struct {
+	owned map[string]int
+	err   error
+}
+
+func (c counter) OwnedNodes(name string) (int, error) { return c.owned[name], c.err }
+
+func (c counter) WhatIf(l *labelerv1alpha1.Labeler) (labeler.WhatIf, error) {
+	return labeler.WhatIf{}, nil
+}
+
+// labelerServer is a test API server of the labelers, the ones it doesn't have are not
+// found.
+func labelerServer(ls ...*labelerv1alpha1.Labeler) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		for _, l := range ls {
+			if strings.HasSuffix(r.URL.Path, "/labelers/"+l.Name) {
+				json.NewEncoder(w).Encode(l)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(metav1.Status{Status: metav1.StatusFailure, Code: http.StatusNotFound, Reason: metav1.StatusReasonNotFound})
+	}))
+}
+
+func testLabeler(name string, annotations map[string]string, taints ...corev1.Taint) *labelerv1alpha1.Labeler {
+	return &labelerv1alpha1.Labeler{
+		TypeMeta:   metav1.TypeMeta{Kind: labelerv1alpha1.LabelerKind, APIVersion: labelerv1alpha1.SchemeGroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: annotations},
+		Spec: labelerv1alpha1.LabelerSpec{Merge: labelerv1alpha1.MergeSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"gpu": "true"}},
+			NodeSpec:   corev1.NodeSpec{Taints: taints},
+		}},
+	}
+}
+
+// removing returns the labeler removing the label keys of the entries.
+func removing(l *labelerv1alpha1.Labeler, entries ...string) *labelerv1alpha1.Labeler {
+	l.Spec.RemoveLabels = entries
+	return l
+}
+
+func raw(t *testing.T, l *labelerv1alpha1.Labeler) runtime.RawExtension {
+	if l == nil {
+		return runtime.RawExtension{}
+	}
+	b, err := json.Marshal(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runtime.RawExtension{Raw: b}
+}
+
+func TestHandleValidate(t *testing.T) {
+	allowDelete := map[string]string{apilabeler.AllowDeleteAnnotation: "true"}
+	noExecute := corev1.Taint{Key: "gpu", Effect: corev1.TaintEffectNoExecute}
+	noSchedule := corev1.Taint{Key: "gpu", Effect: corev1.TaintEffectNoSchedule}
+
+	tests := []struct {
+		name       string
+		operation  string
+		object     *labelerv1alpha1.Labeler
+		oldObject  *labelerv1alpha1.Labeler
+		stored     []*labelerv1alpha1.Labeler
+		counter    counter
+		expAllowed bool
+	}{
+		{
+			name:       "Deleting a labeler owning no more nodes than the threshold is allowed.",
+			operation:  operationDelete,
+			oldObject:  testLabeler("gpu", nil),
+			counter:    counter{owned: map[string]int{"gpu": 2}},
+			expAllowed: true,
+		},
+		{
+			name:       "Deleting a labeler owning more nodes than the threshold is denied.",
+			operation:  operationDelete,
+			oldObject:  testLabeler("gpu", nil),
+			counter:    counter{owned: map[string]int{"gpu": 3}},
+			expAllowed: false,
+		},
+		{
+			name:       "The owned nodes of the deleted labeler are counted, not the ones of others.",
+			operation:  operationDelete,
+			oldObject:  testLabeler("gpu", nil),
+			counter:    counter{owned: map[string]int{"other": 30}},
+			expAllowed: true,
+		},
+		{
+			name:       "The allow delete annotation bypasses the threshold.",
+			operation:  operationDelete,
+			oldObject:  testLabeler("gpu", allowDelete),
+			counter:    counter{owned: map[string]int{"gpu": 30}},
+			expAllowed: true,
+		},
+		{
+			name:       "An allow delete annotation not true doesn't bypass the threshold.",
+			operation:  operationDelete,
+			oldObject:  testLabeler("gpu", map[string]string{apilabeler.AllowDeleteAnnotation: "yes"}),
+			counter:    counter{owned: map[string]int{"gpu": 30}},
+			expAllowed: false,
+		},
+		{
+			name:       "The labeler is retrieved without old object.",
+			operation:  operationDelete,
+			stored:     []*labelerv1alpha1.Labeler{testLabeler("gpu", allowDelete)},
+			counter:    counter{owned: map[string]int{"gpu": 30}},
+			expAllowed: true,
+		},
+		{
+			name:       "A labeler that can't be retrieved is denied.",
+			operation:  operationDelete,
+			counter:    counter{},
+			expAllowed: false,
+		},
+		{
+			name:       "A labeler whose nodes can't be counted is denied.",
+			operation:  operationDelete,
+			oldObject:  testLabeler("gpu", nil),
+			counter:    counter{err: errors.New("the nodes are not synced yet")},
+			expAllowed: false,
+		},
+		{
+			name:       "Creating a labeler with allowed taint effects is allowed.",
+			operation:  operationCreate,
+			object:     testLabeler("gpu", nil, noSchedule),
+			expAllowed: true,
+		},
+		{
+			name:       "Updating a labeler with a taint effect not allowed is denied.",
+			operation:  operationUpdate,
+			object:     testLabeler("gpu", nil, noExecute),
+			expAllowed: false,
+		},
+		{
+			name:       "Removing a key the labeler sets is denied.",
+			operation:  operationCreate,
+			object:     removing(testLabeler("gpu", nil), "gpu"),
+			expAllowed: false,
+		},
+		{
+			name:       "Removing keys matching a key the labeler sets is denied.",
+			operation:  operationUpdate,
+			object:     removing(testLabeler("gpu", nil), "/gp.*/"),
+			expAllowed: false,
+		},
+		{
+			name:       "Removing other keys is allowed, the expressions match the whole key.",
+			operation:  operationCreate,
+			object:     removing(testLabeler("gpu", nil), "legacy", "/g/"),
+			expAllowed: true,
+		},
+		{
+			name:       "Other operations are allowed.",
+			operation:  "CONNECT",
+			expAllowed: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := labelerServer(test.stored...)
+			defer srv.Close()
+			cli, err := labelerk8scli.NewForConfig(&rest.Config{Host: srv.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := Config{DeleteProtectionThreshold: 2, AllowedTaintEffects: []string{string(corev1.TaintEffectNoSchedule)}}
+			s := NewServer(cfg, test.counter, cli, kooperlog.Dummy)
+
+			review := admissionReview{Request: &admissionRequest{
+				UID:       "1",
+				Name:      "gpu",
+				Operation: test.operation,
+				Object:    raw(t, test.object),
+				OldObject: raw(t, test.oldObject),
+			}}
+			b, err := json.Marshal(review)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			s.handleValidate(rec, httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader(b)))
+
+			got := &admissionReview{}
+			if err := json.Unmarshal(rec.Body.Bytes(), got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Response == nil || got.Response.UID != "1" {
+				t.Fatalf("expected the response of the request, got %+v", got.Response)
+			}
+			if got.Response.Allowed != test.expAllowed {
+				t.Errorf("expected allowed %t, got %t (%+v)", test.expAllowed, got.Response.Allowed, got.Response.Result)
+			}
+			if !got.Response.Allowed && (got.Response.Result == nil || got.Response.Result.Code != http.StatusForbidden) {
+				t.Errorf("expected a forbidden status, got %+v", got.Response.Result)
+			}
+		})
+	}
+}
+
+func TestHandleValidateTooLarge(t *testing.T) {
+	s := NewServer(Config{}, counter{}, nil, kooperlog.Dummy)
+	body := `{"request":{"uid":"1","operation":"CREATE","object":{"name":"` + strings.Repeat("a", maxReviewBytes) + `"}}}`
+
+	rec := httptest.NewRecorder()
+	s.handleValidate(rec, httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(body)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a review over the size limit rejected, got %d", rec.Code)
+	}
+}